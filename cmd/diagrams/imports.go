@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// goPackage is the part of a package reported by go list -json that the
+// component diagram is built from.
+type goPackage struct {
+	ImportPath string
+	Name       string
+	Doc        string
+	Imports    []string
+	Module     *struct{ Path string }
+}
+
+// component is a package of the module in the component diagram, with the
+// packages of the module it imports. Paths are relative to the module, the
+// module's root package being ".".
+type component struct {
+	Path    string   `json:"path"`
+	Name    string   `json:"name"`
+	Doc     string   `json:"doc,omitempty"`
+	Imports []string `json:"imports,omitempty"`
+}
+
+// listPackages runs go list -json on the packages of the module in dir.
+// Test files are left out, so the imports are those of the built program.
+func listPackages(dir string) ([]goPackage, error) {
+	cmd := exec.Command("go", "list", "-json", "./...")
+	cmd.Dir = dir
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("go list: %w", err)
+	}
+	var pkgs []goPackage
+	dec := json.NewDecoder(bytes.NewReader(out))
+	for {
+		var p goPackage
+		if err := dec.Decode(&p); errors.Is(err, io.EOF) {
+			return pkgs, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("decoding go list output: %w", err)
+		}
+		pkgs = append(pkgs, p)
+	}
+}
+
+// components returns the packages of pkgs that belong to their module as
+// components, sorted by path, keeping only the imports within the module.
+func components(pkgs []goPackage) []component {
+	var module string
+	for _, p := range pkgs {
+		if p.Module != nil {
+			module = p.Module.Path
+			break
+		}
+	}
+	rel := func(importPath string) (string, bool) {
+		if importPath == module {
+			return ".", true
+		}
+		rest, ok := strings.CutPrefix(importPath, module+"/")
+		return rest, ok
+	}
+
+	var cs []component
+	for _, p := range pkgs {
+		relPath, ok := rel(p.ImportPath)
+		if !ok {
+			continue
+		}
+		c := component{Path: relPath, Name: p.Name, Doc: p.Doc}
+		for _, imp := range p.Imports {
+			if relImp, ok := rel(imp); ok {
+				c.Imports = append(c.Imports, relImp)
+			}
+		}
+		sort.Strings(c.Imports)
+		cs = append(cs, c)
+	}
+	sort.Slice(cs, func(i, j int) bool { return cs[i].Path < cs[j].Path })
+	return cs
+}
+
+// reduce drops the imports of each component that it also reaches through
+// one of its other imports, leaving the transitive reduction of the import
+// graph. Go forbids import cycles, so the graph is acyclic.
+func reduce(cs []component) []component {
+	imports := make(map[string][]string, len(cs))
+	for _, c := range cs {
+		imports[c.Path] = c.Imports
+	}
+	reach := make(map[string]map[string]bool, len(cs))
+	var reachable func(p string) map[string]bool
+	reachable = func(p string) map[string]bool {
+		if r, ok := reach[p]; ok {
+			return r
+		}
+		r := make(map[string]bool)
+		for _, imp := range imports[p] {
+			r[imp] = true
+			for q := range reachable(imp) {
+				r[q] = true
+			}
+		}
+		reach[p] = r
+		return r
+	}
+
+	reduced := make([]component, len(cs))
+	for i, c := range cs {
+		reduced[i] = c
+		reduced[i].Imports = nil
+		for _, imp := range c.Imports {
+			indirect := false
+			for _, other := range c.Imports {
+				if other != imp && reachable(other)[imp] {
+					indirect = true
+					break
+				}
+			}
+			if !indirect {
+				reduced[i].Imports = append(reduced[i].Imports, imp)
+			}
+		}
+	}
+	return reduced
+}
+
+// group returns the top-level directory of a component path, which the
+// component diagram clusters the components by.
+func group(p string) string {
+	if p == "." {
+		return "."
+	}
+	first, _, _ := strings.Cut(p, "/")
+	return first
+}
+
+// writeDOT writes cs to w as a Graphviz digraph titled title, with a
+// cluster for the components of each top-level directory.
+func writeDOT(w io.Writer, title string, cs []component) error {
+	clusters := make(map[string][]component)
+	var names []string
+	for _, c := range cs {
+		g := group(c.Path)
+		if _, ok := clusters[g]; !ok {
+			names = append(names, g)
+		}
+		clusters[g] = append(clusters[g], c)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "digraph components {\n")
+	fmt.Fprintf(&b, "\tlabel=%q;\n\tlabelloc=t;\n\trankdir=LR;\n", title)
+	fmt.Fprintf(&b, "\tnode [shape=box, style=rounded, fontname=Helvetica];\n")
+	for i, g := range names {
+		dir := g
+		if g == "." {
+			dir = "module root"
+		}
+		fmt.Fprintf(&b, "\tsubgraph cluster_%d {\n\t\tlabel=%q;\n", i, dir)
+		for _, c := range clusters[g] {
+			label := c.Path
+			if c.Path == "." {
+				label = "main.go"
+			}
+			fmt.Fprintf(&b, "\t\t%q [label=%q];\n", c.Path, label)
+		}
+		fmt.Fprintf(&b, "\t}\n")
+	}
+	for _, c := range cs {
+		for _, imp := range c.Imports {
+			fmt.Fprintf(&b, "\t%q -> %q;\n", c.Path, imp)
+		}
+	}
+	fmt.Fprintf(&b, "}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// writeComponents writes cs to dir as components.dot and as
+// components.json, for tools that want the import graph itself.
+func writeComponents(dir string, cs []component) error {
+	var dot bytes.Buffer
+	if err := writeDOT(&dot, "rss2socials Components", cs); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, "components.dot"), dot.Bytes(), 0600); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(cs, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, "components.json"), append(data, '\n'), 0600)
+}
+
+// render converts every .dot file of dir to each of formats with Graphviz,
+// next to the .dot file. It reports false when Graphviz is not installed.
+func render(dir string, formats []string) (bool, error) {
+	dot, err := exec.LookPath("dot")
+	if err != nil {
+		return false, nil
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.dot"))
+	if err != nil {
+		return true, err
+	}
+	for _, file := range files {
+		for _, format := range formats {
+			out := strings.TrimSuffix(file, ".dot") + "." + format
+			cmd := exec.Command(dot, "-T"+format, "-o", out, file) // #nosec G204 -- the formats are given by the user running the tool
+			cmd.Stderr = os.Stderr
+			if err := cmd.Run(); err != nil {
+				return true, fmt.Errorf("rendering %s: %w", out, err)
+			}
+		}
+	}
+	return true, nil
+}
@@ -1,25 +1,33 @@
 // Package main provides diagram generation utilities for the rss2socials project.
 //
 // This application generates architectural and component diagrams for the rss2socials
-// application using the go-diagrams library. It creates visual representations of the
-// project structure and component relationships to aid in documentation and understanding.
+// application. The architecture diagram is drawn with the go-diagrams library and
+// shows how the application connects the feed to the social networks. The component
+// diagram is generated from the import graph of the module's packages, as reported
+// by go list -json, so that it never drifts from the code.
 //
 // The generated diagrams are saved as .dot files in the docs/diagrams/go-diagrams/
-// directory and can be converted to various image formats using Graphviz.
+// directory, together with components.json holding the import graph. When Graphviz
+// is installed, they are also rendered to PNG and SVG next to the .dot files.
 //
 // Usage:
 //
-//	go run cmd/diagrams/main.go
+//	go run ./cmd/diagrams [-formats png,svg] [-reduce=false]
 //
 // This will generate:
 //   - architecture.dot: High-level architecture showing RSS feed monitoring flow
-//   - components.dot: Component relationships and dependencies
+//   - components.dot: The packages of the module and the packages they import
+//   - components.json: The same import graph, for other tools
+
 package main
 
 import (
+	"flag"
 	"fmt"
 	"log"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/blushft/go-diagrams/diagram"
 	"github.com/blushft/go-diagrams/nodes/generic"
@@ -29,16 +37,30 @@ import (
 // main is the entry point for the diagram generation utility.
 //
 // This function orchestrates the entire diagram generation process:
-//  1. Creates the output directory structure
-//  2. Changes to the appropriate working directory
+//  1. Lists the packages of the module and their imports
+//  2. Creates the output directory structure and changes to it
 //  3. Generates architecture and component diagrams
-//  4. Reports successful completion
+//  4. Renders them with Graphviz when it is installed
 //
 // The function will terminate with log.Fatal if any critical operation fails,
-// such as directory creation, navigation, or diagram rendering.
+// such as listing the packages, directory creation or diagram rendering.
 func main() {
+	formats := flag.String("formats", "png,svg", "Comma-separated Graphviz output formats to render the diagrams to")
+	reduceEdges := flag.Bool("reduce", true, "Leave out imports that are also reached through another import")
+	flag.Parse()
+
+	// List the packages before leaving the module root
+	pkgs, err := listPackages(".")
+	if err != nil {
+		log.Fatal("Failed to list packages: ", err)
+	}
+	cs := components(pkgs)
+	if *reduceEdges {
+		cs = reduce(cs)
+	}
+
 	// Ensure output directory exists
-	if err := os.MkdirAll("docs/diagrams", 0750); err != nil {
+	if err := os.MkdirAll("docs/diagrams/go-diagrams", 0750); err != nil {
 		log.Fatal("Failed to create output directory:", err)
 	}
 
@@ -51,9 +73,21 @@ func main() {
 	generateArchitectureDiagram()
 
 	// Generate component diagram
-	generateComponentDiagram()
+	if err := writeComponents("go-diagrams", cs); err != nil {
+		log.Fatal("Failed to write component diagram: ", err)
+	}
 
 	fmt.Println("Diagram .dot files generated successfully in ./docs/diagrams/go-diagrams/")
+
+	rendered, err := render("go-diagrams", strings.Split(*formats, ","))
+	switch {
+	case err != nil:
+		log.Fatal(err)
+	case !rendered:
+		fmt.Println("Graphviz (dot) not found: install it to render the .dot files")
+	default:
+		fmt.Printf("Diagrams rendered as %s in %s\n", *formats, filepath.Join("docs", "diagrams", "go-diagrams"))
+	}
 }
 
 // generateArchitectureDiagram creates a high-level architecture diagram showing
@@ -100,60 +134,3 @@ func generateArchitectureDiagram() {
 		log.Fatal(err)
 	}
 }
-
-// generateComponentDiagram creates a detailed component diagram showing the
-// relationships and dependencies between different packages in the rss2socials project.
-//
-// The diagram illustrates:
-//   - main.go as the entry point
-//   - cmd/rss2socials package handling CLI operations
-//   - Integration with internal packages (db, rss, mastodon, gotify, rss2socials)
-//   - Integration with pkg packages (config, version, man)
-//   - Data flow between components
-//
-// The diagram is rendered in left-to-right (LR) direction and saved as
-// "components.dot" in the current working directory. The function will
-// terminate the program with log.Fatal if diagram creation or rendering fails.
-func generateComponentDiagram() {
-	d, err := diagram.New(diagram.Filename("components"), diagram.Label("RSS2Socials Components"), diagram.Direction("LR"))
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	// Main components
-	main := programming.Language.Go(diagram.NodeLabel("main.go"))
-	rootCmd := programming.Language.Go(diagram.NodeLabel("cmd/rss2socials\nroot.go"))
-	config := programming.Language.Go(diagram.NodeLabel("pkg/config\nconfig.go"))
-	rss2socials := programming.Language.Go(diagram.NodeLabel("internal/rss2socials\nrss2socials.go"))
-
-	// Internal packages
-	db := programming.Language.Go(diagram.NodeLabel("internal/db\ndb.go"))
-	rss := programming.Language.Go(diagram.NodeLabel("internal/rss\nrss.go"))
-	mastodon := programming.Language.Go(diagram.NodeLabel("internal/mastodon\nmastodon.go"))
-	bluesky := programming.Language.Go(diagram.NodeLabel("internal/bluesky\nbluesky.go"))
-	threads := programming.Language.Go(diagram.NodeLabel("internal/threads\nthreads.go"))
-	gotify := programming.Language.Go(diagram.NodeLabel("internal/gotify\ngotify.go"))
-
-	// Pkg packages
-	version := programming.Language.Go(diagram.NodeLabel("pkg/version\nversion.go"))
-	man := programming.Language.Go(diagram.NodeLabel("pkg/man\nman.go"))
-
-	// Create connections showing the flow
-	d.Connect(main, rootCmd, diagram.Forward())
-	d.Connect(rootCmd, config, diagram.Forward())
-	d.Connect(rootCmd, rss2socials, diagram.Forward())
-	d.Connect(rootCmd, version, diagram.Forward())
-	d.Connect(rootCmd, man, diagram.Forward())
-
-	// Internal package connections
-	d.Connect(rss2socials, db, diagram.Forward())
-	d.Connect(rss2socials, rss, diagram.Forward())
-	d.Connect(rss2socials, mastodon, diagram.Forward())
-	d.Connect(rss2socials, bluesky, diagram.Forward())
-	d.Connect(rss2socials, threads, diagram.Forward())
-	d.Connect(rss2socials, gotify, diagram.Forward())
-
-	if err := d.Render(); err != nil {
-		log.Fatal(err)
-	}
-}
@@ -0,0 +1,153 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+
+	"github.com/toozej/rss2socials/internal/keyring"
+	"github.com/toozej/rss2socials/pkg/config"
+)
+
+// newAuthCmd returns the "auth" command grouping subcommands that manage the
+// credentials stored in the OS keyring.
+func newAuthCmd() *cobra.Command {
+	authCmd := &cobra.Command{
+		Use:   "auth",
+		Short: "Manage the credentials stored in the OS keyring",
+		Args:  cobra.NoArgs,
+		// The configuration is not validated, as the credentials being
+		// stored are typically the ones missing from it.
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			configureLogging()
+		},
+	}
+
+	authCmd.AddCommand(newAuthStoreCmd(), newAuthDeleteCmd())
+	return authCmd
+}
+
+// newAuthStoreCmd returns the "auth store" command which stores credentials
+// in the OS keyring.
+func newAuthStoreCmd() *cobra.Command {
+	var fromEnv bool
+
+	cmd := &cobra.Command{
+		Use:   "store [VAR...]",
+		Short: "Store credentials in the OS keyring instead of the .env file",
+		Long: `Store credentials in the OS keyring: the login keychain on macOS, the Secret
+Service (GNOME Keyring, KWallet) on Linux, which needs secret-tool, or files
+encrypted for the current user with DPAPI on Windows.
+
+Each VAR is the environment variable the credential would be set in, e.g.
+MASTODON_ACCESS_TOKEN, or ALICE_MASTODON_ACCESS_TOKEN for a tenant, or
+RSS2SOCIALS_CONFIG_KEY for the key of an encrypted .env file. Its value
+is prompted for, or read from standard input when it is not a terminal. With
+--from-env, the credentials currently set in the environment or .env file are
+stored instead, all of them when no VAR is given.
+
+Set SECRET_STORE=keyring for rss2socials to read the credentials that are not
+set in the environment from the keyring, then remove them from the .env file.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			names := args
+			if fromEnv && len(names) == 0 {
+				for _, name := range config.SecretVars {
+					if os.Getenv(name) != "" {
+						names = append(names, name)
+					}
+				}
+				if len(names) == 0 {
+					return errors.New("no credentials are set in the environment")
+				}
+			}
+			if len(names) == 0 {
+				return errors.New("name the variables to store, or use --from-env")
+			}
+
+			in := bufio.NewReader(cmd.InOrStdin())
+			for _, name := range names {
+				name = strings.ToUpper(name)
+				if !isSecretVar(name) {
+					return fmt.Errorf("%s is not a credential; known credentials are %s and %s", name, strings.Join(config.SecretVars, ", "), config.ConfigKeyEnv)
+				}
+				secret := os.Getenv(name)
+				if !fromEnv {
+					var err error
+					if secret, err = readSecret(cmd, in, name); err != nil {
+						return err
+					}
+				}
+				if secret == "" {
+					return fmt.Errorf("no value for %s", name)
+				}
+				if err := keyring.Set(config.KeyringService, name, secret); err != nil {
+					return fmt.Errorf("error storing %s in the keyring: %w", name, err)
+				}
+				fmt.Fprintf(cmd.OutOrStdout(), "Stored %s in the keyring\n", name)
+			}
+			if conf.SecretStore != config.SecretStoreKeyring {
+				fmt.Fprintln(cmd.OutOrStdout(), "Set SECRET_STORE=keyring for rss2socials to use them")
+			}
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&fromEnv, "from-env", false, "Store the values set in the environment or .env file")
+
+	return cmd
+}
+
+// newAuthDeleteCmd returns the "auth delete" command which removes
+// credentials from the OS keyring.
+func newAuthDeleteCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "delete VAR...",
+		Short: "Remove credentials from the OS keyring",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var errs []error
+			for _, name := range args {
+				name = strings.ToUpper(name)
+				if err := keyring.Delete(config.KeyringService, name); err != nil {
+					errs = append(errs, fmt.Errorf("%s: %w", name, err))
+					continue
+				}
+				fmt.Fprintf(cmd.OutOrStdout(), "Removed %s from the keyring\n", name)
+			}
+			return errors.Join(errs...)
+		},
+	}
+}
+
+// isSecretVar reports whether name is the key of the encrypted .env file
+// or one of config.SecretVars, possibly prefixed by a tenant.
+func isSecretVar(name string) bool {
+	return name == config.ConfigKeyEnv || slices.ContainsFunc(config.SecretVars, func(v string) bool {
+		return name == v || strings.HasSuffix(name, "_"+v)
+	})
+}
+
+// readSecret prompts for the value of name without echoing it when standard
+// input is a terminal, and reads a line of in otherwise.
+func readSecret(cmd *cobra.Command, in *bufio.Reader, name string) (string, error) {
+	if f, ok := cmd.InOrStdin().(*os.File); ok && term.IsTerminal(int(f.Fd())) { // #nosec G115 -- file descriptors fit in an int
+		fmt.Fprintf(cmd.ErrOrStderr(), "%s: ", name)
+		secret, err := term.ReadPassword(int(f.Fd())) // #nosec G115 -- file descriptors fit in an int
+		fmt.Fprintln(cmd.ErrOrStderr())
+		if err != nil {
+			return "", fmt.Errorf("error reading %s: %w", name, err)
+		}
+		return strings.TrimSpace(string(secret)), nil
+	}
+	line, err := in.ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", fmt.Errorf("error reading %s: %w", name, err)
+	}
+	return strings.TrimSpace(line), nil
+}
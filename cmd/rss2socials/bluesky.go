@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/spf13/cobra"
+
+	"github.com/toozej/rss2socials/internal/bluesky"
+)
+
+// newBlueskyCmd returns the "bluesky" command grouping Bluesky account
+// subcommands.
+func newBlueskyCmd() *cobra.Command {
+	blueskyCmd := &cobra.Command{
+		Use:   "bluesky",
+		Short: "Manage the Bluesky account rss2socials posts as",
+		Args:  cobra.NoArgs,
+	}
+	blueskyCmd.PersistentFlags().StringVar(&conf.BlueskyHandle, "bluesky-handle", conf.BlueskyHandle, "Bluesky handle")
+	blueskyCmd.PersistentFlags().StringVar(&conf.BlueskyOAuthSessionFile, "bluesky-oauth-session-file", conf.BlueskyOAuthSessionFile, "File the Bluesky OAuth session is stored in")
+
+	blueskyCmd.AddCommand(newBlueskyLoginCmd())
+	return blueskyCmd
+}
+
+// newBlueskyLoginCmd returns the "bluesky login" command which creates the
+// OAuth session used with BLUESKY_AUTH=oauth.
+func newBlueskyLoginCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "login",
+		Short: "Log in to Bluesky with OAuth and store the session",
+		Long: `Log in to Bluesky with OAuth and store the session for BLUESKY_AUTH=oauth.
+
+Open the printed URL in a browser and approve access. The browser is then
+redirected to BLUESKY_OAUTH_REDIRECT_URI, which this command listens on, so it
+must be reachable from the browser; when running on a remote host, forward the
+port first (e.g. ssh -L 8765:127.0.0.1:8765). The session is saved to
+BLUESKY_OAUTH_SESSION_FILE and refreshed automatically while rss2socials runs.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt)
+			defer stop()
+
+			s, err := bluesky.Login(ctx, conf, func(authURL string) {
+				fmt.Fprintf(cmd.OutOrStdout(), "Open this URL in a browser to authorize rss2socials:\n\n  %s\n\nWaiting for the authorization...\n", authURL)
+			})
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Logged in as %s (%s); session saved to %s\n", s.Handle, s.DID, conf.BlueskyOAuthSessionFile)
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&conf.BlueskyOAuthRedirectURI, "bluesky-oauth-redirect-uri", conf.BlueskyOAuthRedirectURI, "OAuth redirect URI to listen on for the authorization callback")
+
+	return cmd
+}
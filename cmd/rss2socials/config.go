@@ -0,0 +1,123 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/toozej/rss2socials/internal/configcrypt"
+	"github.com/toozej/rss2socials/pkg/config"
+)
+
+// newConfigCmd returns the "config" command grouping subcommands that
+// manage the .env file.
+func newConfigCmd() *cobra.Command {
+	configCmd := &cobra.Command{
+		Use:   "config",
+		Short: "Manage the .env configuration file",
+		Args:  cobra.NoArgs,
+		// The configuration is not validated, as it is what is being
+		// managed.
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			configureLogging()
+		},
+	}
+
+	configCmd.AddCommand(newConfigEncryptCmd(), newConfigDecryptCmd())
+	return configCmd
+}
+
+// newConfigEncryptCmd returns the "config encrypt" command which encrypts
+// the .env file with age or GPG.
+func newConfigEncryptCmd() *cobra.Command {
+	var format, output string
+
+	cmd := &cobra.Command{
+		Use:   "encrypt [FILE]",
+		Short: "Encrypt the .env file with age or GPG",
+		Long: `Encrypt FILE (default .env) to FILE.age with age, or to FILE.gpg with GPG,
+which need the age and age-keygen or gpg tools.
+
+The key is read from RSS2SOCIALS_CONFIG_KEY, or else from the OS keyring
+(see "rss2socials auth store"): an age identity, as generated by age-keygen,
+or a GPG passphrase. When there is no .env file, rss2socials decrypts
+.env.age or .env.gpg at startup with the same key, without writing the
+plaintext to disk. Remove the .env file once it is encrypted, as it is loaded
+instead of the encrypted file while it exists.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			in := ".env"
+			if len(args) > 0 {
+				in = args[0]
+			}
+			if format != configcrypt.FormatAge && format != configcrypt.FormatGPG {
+				return fmt.Errorf("unknown format %q: use age or gpg", format)
+			}
+			if output == "" {
+				output = in + "." + format
+			}
+			key, err := config.ConfigKey()
+			if err != nil {
+				return err
+			}
+			if err := configcrypt.Encrypt(format, key, in, output); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Encrypted %s to %s; remove %s to use it\n", in, output, in)
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&format, "format", configcrypt.FormatAge, "Encryption format: age or gpg")
+	cmd.Flags().StringVarP(&output, "output", "o", "", "Encrypted file to write (default FILE.age or FILE.gpg)")
+
+	return cmd
+}
+
+// newConfigDecryptCmd returns the "config decrypt" command which prints the
+// decrypted .env file, e.g. to edit it.
+func newConfigDecryptCmd() *cobra.Command {
+	var output string
+
+	cmd := &cobra.Command{
+		Use:   "decrypt [FILE]",
+		Short: "Decrypt an encrypted .env file",
+		Long: `Decrypt FILE (default .env.age or .env.gpg) with the key from
+RSS2SOCIALS_CONFIG_KEY or the OS keyring, and print it or write it to --output.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var in string
+			if len(args) > 0 {
+				in = args[0]
+			} else {
+				for _, name := range config.EncryptedEnvFiles {
+					if _, err := os.Stat(name); err == nil {
+						in = name
+						break
+					}
+				}
+				if in == "" {
+					return errors.New("no .env.age or .env.gpg file in the current directory")
+				}
+			}
+			key, err := config.ConfigKey()
+			if err != nil {
+				return err
+			}
+			plaintext, err := configcrypt.Decrypt(key, in)
+			if err != nil {
+				return err
+			}
+			if output == "" {
+				_, err := cmd.OutOrStdout().Write(plaintext)
+				return err
+			}
+			return os.WriteFile(filepath.Clean(output), plaintext, 0o600)
+		},
+	}
+	cmd.Flags().StringVarP(&output, "output", "o", "", "File to write the plaintext to, readable only by you (default standard output)")
+
+	return cmd
+}
@@ -0,0 +1,277 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/toozej/rss2socials/internal/db"
+	"github.com/toozej/rss2socials/internal/posttemplate"
+	"github.com/toozej/rss2socials/pkg/config"
+)
+
+// newDBCmd returns the "db" command grouping database maintenance and
+// inspection subcommands.
+func newDBCmd() *cobra.Command {
+	dbCmd := &cobra.Command{
+		Use:   "db",
+		Short: "Inspect and maintain the rss2socials database",
+		Args:  cobra.NoArgs,
+	}
+	dbCmd.PersistentFlags().StringVar(&conf.DBPath, "db-path", conf.DBPath, "Path to SQLite database file")
+
+	dbCmd.AddCommand(newDBContentCmd(), newDBDoctorCmd(), newDBEventsCmd(), newDBListCmd())
+	return dbCmd
+}
+
+// newDBContentCmd returns the "db content" command which prints the stored
+// content snapshots of a post and what the last update added, to tell why an
+// update was detected.
+func newDBContentCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "content <link>",
+		Short: "Show the stored content of a post and what its last update added",
+		Long: `Show the stored content of a post and what its last update added.
+
+Prints the content the post was last stored with and the content it replaced,
+followed by the headings and sentences the update added. Snapshots are only
+stored with STORE_CONTENT enabled.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := requireDBFile(); err != nil {
+				return err
+			}
+			db.InitDB(conf.DBPath)
+			defer db.CloseDB()
+
+			current, previous, err := db.ContentSnapshots(args[0])
+			if err != nil {
+				return fmt.Errorf("error querying content: %w", err)
+			}
+
+			out := cmd.OutOrStdout()
+			fmt.Fprintf(out, "Current content:\n%s\n\n", orNone(current))
+			fmt.Fprintf(out, "Previous content:\n%s\n", orNone(previous))
+			if previous == "" {
+				return nil
+			}
+			diff := posttemplate.DiffContent(previous, current)
+			fmt.Fprintln(out, "\nAdded:")
+			for _, heading := range diff.AddedHeadings {
+				fmt.Fprintf(out, "  heading: %s\n", heading)
+			}
+			for _, sentence := range diff.AddedSentences {
+				fmt.Fprintf(out, "  text: %s\n", sentence)
+			}
+			if len(diff.AddedHeadings) == 0 && len(diff.AddedSentences) == 0 {
+				fmt.Fprintln(out, "  nothing; the update only changed or removed content")
+			}
+			return nil
+		},
+	}
+}
+
+// orNone returns s, or "(none stored)" when it is empty.
+func orNone(s string) string {
+	if s == "" {
+		return "(none stored)"
+	}
+	return s
+}
+
+// newDBDoctorCmd returns the "db doctor" command which checks the database
+// for corruption and orphaned rows and repairs what it can.
+func newDBDoctorCmd() *cobra.Command {
+	var fix, rebuild bool
+
+	cmd := &cobra.Command{
+		Use:   "doctor",
+		Short: "Check the database for corruption and orphaned rows and repair it",
+		Long: `Check the database for corruption and orphaned rows and repair it.
+
+Runs SQLite's integrity check on the database. A sound database is checked for
+retry states of posts that are no longer stored, which --fix removes, and its
+indexes are rebuilt. A corrupt database can be rebuilt from its event log with
+--rebuild: the damaged file is kept next to it, and posts are marked posted to
+every site the log records them as published on. Stop rss2socials first.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := requireDBFile(); err != nil {
+				return err
+			}
+			out := cmd.OutOrStdout()
+			report, err := db.Diagnose(conf.DBPath)
+			if err != nil {
+				return fmt.Errorf("error checking database: %w", err)
+			}
+
+			if report.Corrupt() {
+				fmt.Fprintf(out, "Integrity check of %s failed:\n", conf.DBPath)
+				for _, problem := range report.Integrity {
+					fmt.Fprintf(out, "  %s\n", problem)
+				}
+				if !rebuild {
+					return fmt.Errorf("database is corrupt; run again with --rebuild to rebuild it from its event log")
+				}
+				result, err := db.Rebuild(conf.DBPath)
+				if err != nil {
+					return fmt.Errorf("error rebuilding database: %w", err)
+				}
+				fmt.Fprintf(out, "Rebuilt %s with %d posts from %d events; the damaged file was moved to %s\n", conf.DBPath, result.Posts, result.Events, result.Backup)
+				return nil
+			}
+			fmt.Fprintln(out, "Integrity check: ok")
+
+			if len(report.OrphanedRetries) > 0 {
+				fmt.Fprintf(out, "%d orphaned retry states:\n", len(report.OrphanedRetries))
+				w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+				fmt.Fprintln(w, "LINK\tSITE\tATTEMPTS\tLAST ATTEMPT")
+				for _, r := range report.OrphanedRetries {
+					fmt.Fprintf(w, "%s\t%s\t%d\t%s\n", r.Link, r.Site, r.Attempts, formatTime(r.LastAttempt))
+				}
+				if err := w.Flush(); err != nil {
+					return err
+				}
+				if fix {
+					removed, err := db.RemoveOrphans(conf.DBPath)
+					if err != nil {
+						return fmt.Errorf("error removing orphaned rows: %w", err)
+					}
+					fmt.Fprintf(out, "Removed %d orphaned rows\n", removed)
+				} else {
+					fmt.Fprintln(out, "Run again with --fix to remove them")
+				}
+			} else {
+				fmt.Fprintln(out, "Orphaned rows: none")
+			}
+
+			if err := db.Reindex(conf.DBPath); err != nil {
+				return fmt.Errorf("error rebuilding indexes: %w", err)
+			}
+			fmt.Fprintln(out, "Rebuilt indexes")
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&fix, "fix", false, "Remove orphaned rows")
+	cmd.Flags().BoolVar(&rebuild, "rebuild", false, "Rebuild a corrupt database from its event log")
+
+	return cmd
+}
+
+// newDBEventsCmd returns the "db events" command which prints the audit trail
+// of recorded actions.
+func newDBEventsCmd() *cobra.Command {
+	var since time.Duration
+
+	cmd := &cobra.Command{
+		Use:   "events",
+		Short: "List recorded events (fetches, skips, publishes, failures)",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := requireDBFile(); err != nil {
+				return err
+			}
+			db.InitDB(conf.DBPath)
+			defer db.CloseDB()
+
+			events, err := db.EventsSince(time.Now().Add(-since))
+			if err != nil {
+				return fmt.Errorf("error querying events: %w", err)
+			}
+
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "TIME\tEVENT\tLINK\tDETAIL")
+			for _, ev := range events {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", ev.Timestamp.Format(time.RFC3339), ev.Label(), ev.Link, ev.Detail)
+			}
+			return w.Flush()
+		},
+	}
+	cmd.Flags().DurationVar(&since, "since", 24*time.Hour, "Only show events recorded within this duration (e.g. 24h, 30m)")
+
+	return cmd
+}
+
+// newDBListCmd returns the "db list" command which prints the stored posts
+// with their publication, first-seen and last-posted timestamps, or with
+// --failed the posts that were given up on after repeated failures.
+func newDBListCmd() *cobra.Command {
+	var limit int
+	var failed bool
+
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List stored posts with their published, first seen and last posted times",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := requireDBFile(); err != nil {
+				return err
+			}
+			db.InitDB(conf.DBPath)
+			defer db.CloseDB()
+
+			if failed {
+				return printDeadLetters(cmd, limit)
+			}
+
+			posts, err := db.ListPosts(limit)
+			if err != nil {
+				return fmt.Errorf("error querying posts: %w", err)
+			}
+
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "LINK\tPUBLISHED\tFIRST SEEN\tLAST POSTED\tSITES")
+			for _, post := range posts {
+				sites := strings.Join(post.Sites(), ",")
+				if sites == "" {
+					sites = "-"
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", post.Link, formatTime(post.PublishedAt), formatTime(post.FirstSeen), formatTime(post.LastPosted), sites)
+			}
+			return w.Flush()
+		},
+	}
+	cmd.Flags().IntVarP(&limit, "limit", "n", 50, "Maximum number of posts to list (0 = all)")
+	cmd.Flags().BoolVar(&failed, "failed", false, "List posts that were given up on after RETRY_MAX_ATTEMPTS failures")
+
+	return cmd
+}
+
+// printDeadLetters prints up to limit posts that were given up on, with the
+// site, number of attempts and last error.
+func printDeadLetters(cmd *cobra.Command, limit int) error {
+	retries, err := db.DeadLetters()
+	if err != nil {
+		return fmt.Errorf("error querying failed posts: %w", err)
+	}
+	if limit > 0 && len(retries) > limit {
+		retries = retries[:limit]
+	}
+
+	w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "LINK\tSITE\tATTEMPTS\tLAST ATTEMPT\tERROR")
+	for _, r := range retries {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\n", r.Link, r.Site, r.Attempts, formatTime(r.LastAttempt), r.LastError)
+	}
+	return w.Flush()
+}
+
+// requireDBFile returns an error when DB_DRIVER leaves no database file to
+// work on.
+func requireDBFile() error {
+	if conf.DBDriver == config.DBDriverMemory || conf.DBDriver == config.DBDriverRedis {
+		return fmt.Errorf("there is no database file with DB_DRIVER=%s", conf.DBDriver)
+	}
+	return nil
+}
+
+// formatTime formats t as RFC 3339, or "-" for the zero time.
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Format(time.RFC3339)
+}
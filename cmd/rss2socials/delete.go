@@ -0,0 +1,28 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	rss2socials "github.com/toozej/rss2socials/internal/rss2socials"
+)
+
+// newDeleteCmd returns the "delete" command which removes the social posts
+// published for a retracted blog post.
+func newDeleteCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "delete <link>",
+		Short: "Delete the social posts published for a blog post link (Bluesky only)",
+		Long: `Delete the social posts published for a blog post link.
+
+The Bluesky record created for the link is removed using the record URI stored
+when it was published. The link stays in the database, still marked as posted,
+so it is not republished while it remains in the feed.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return rss2socials.DeletePost(cmd.Context(), conf, args[0])
+		},
+	}
+	cmd.Flags().StringVar(&conf.DBPath, "db-path", conf.DBPath, "Path to SQLite database file")
+
+	return cmd
+}
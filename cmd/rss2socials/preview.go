@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"fmt"
+	"slices"
+	"text/tabwriter"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/toozej/rss2socials/internal/charcount"
+	"github.com/toozej/rss2socials/internal/content"
+	"github.com/toozej/rss2socials/internal/mastodon"
+	"github.com/toozej/rss2socials/internal/posttemplate"
+	"github.com/toozej/rss2socials/internal/rss"
+)
+
+// newPreviewCmd returns the "preview" command which prints the posts that
+// would be published for the latest feed items, without publishing them,
+// along with their length as counted by each network.
+func newPreviewCmd() *cobra.Command {
+	var limit int
+
+	cmd := &cobra.Command{
+		Use:   "preview",
+		Short: "Show the posts that would be published for the latest feed items, with per-network character counts",
+		Long: `Show the posts that would be published for the latest feed items without
+publishing anything.
+
+For every enabled network (or all networks when none are configured) the post
+length is shown as that network counts it: graphemes on Bluesky, characters
+with every link counted as 23 on Mastodon, and characters on Threads. The
+Mastodon limit is read from the instance when MASTODON_URL is set. Posts
+over, or within 10% of, a network's limit are flagged.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if conf.FeedURL == "" {
+				return fmt.Errorf("RSS feed URL is required")
+			}
+			loc, err := conf.Location()
+			if err != nil {
+				loc = time.Local
+			}
+			items, err := rss.CheckRSSFeed(rss.ExpandFeedURL(conf.FeedURL, time.Now().In(loc)))
+			if err != nil {
+				return fmt.Errorf("error fetching RSS feed: %w", err)
+			}
+			if limit > 0 && len(items) > limit {
+				items = items[:limit]
+			}
+
+			sites := conf.EnabledSites()
+			if len(sites) == 0 {
+				sites = []string{"mastodon", "bluesky", "threads"}
+			}
+			if slices.Contains(sites, "mastodon") && conf.MastodonURL != "" {
+				if err := mastodon.Verify(cmd.Context(), &conf); err != nil {
+					log.Warnf("Using the default Mastodon status length limit: %v", err)
+				}
+			}
+
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "LINK\tSITE\tCOUNT\tLIMIT\tSTATUS\tPOST")
+			for _, item := range items {
+				item.Content = content.Select(cmd.Context(), conf.ContentSources, conf.ContentMinChars, item, nil)
+				post, err := posttemplate.Render(conf, item, false)
+				if err != nil {
+					return err
+				}
+				for _, site := range sites {
+					a := charcount.Analyze(site, post)
+					if site == "mastodon" {
+						a = mastodon.Analyze(conf, post)
+					}
+					fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%s\t%q\n", item.Link, site, a.Count, a.Limit, a.Status(), post)
+					if a.Over() || a.NearLimit() {
+						log.Warnf("Post for %s is %s on %s: %d of %d", item.Link, a.Status(), site, a.Count, a.Limit)
+					}
+				}
+			}
+			return w.Flush()
+		},
+	}
+	cmd.Flags().StringVarP(&conf.FeedURL, "feed-url", "f", conf.FeedURL, "RSS feed URL to preview")
+	cmd.Flags().StringVar(&conf.PostTemplate, "post-template", conf.PostTemplate, "Go template for new posts")
+	cmd.Flags().StringSliceVar(&conf.ContentSources, "content-sources", conf.ContentSources, "Item fields used as .Content, in order of priority: description, content:encoded, title, page, article")
+	cmd.Flags().IntVar(&conf.ContentMinChars, "content-min-chars", conf.ContentMinChars, "Skip content sources with less text than this")
+	cmd.Flags().IntVarP(&limit, "limit", "n", 5, "Number of feed items to preview (0 = all)")
+
+	return cmd
+}
@@ -0,0 +1,105 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/toozej/rss2socials/internal/bluesky"
+	"github.com/toozej/rss2socials/internal/mastodon"
+	"github.com/toozej/rss2socials/internal/rss"
+	"github.com/toozej/rss2socials/pkg/config"
+)
+
+// newProfileCmd returns the "profile" command grouping subcommands that
+// manage the profiles of the social accounts.
+func newProfileCmd() *cobra.Command {
+	profileCmd := &cobra.Command{
+		Use:   "profile",
+		Short: "Manage the profiles of the social accounts rss2socials posts as",
+		Args:  cobra.NoArgs,
+	}
+
+	profileCmd.AddCommand(newProfileSyncCmd())
+	return profileCmd
+}
+
+// newProfileSyncCmd returns the "profile sync" command which sets the
+// website and latest post fields of the profiles from the newest feed item.
+func newProfileSyncCmd() *cobra.Command {
+	var dryRun bool
+
+	cmd := &cobra.Command{
+		Use:   "sync",
+		Short: "Set the website and latest post fields of the profiles from the newest feed item",
+		Long: `Set the profile fields of the Mastodon and Bluesky accounts from the newest
+item of the feed: PROFILE_WEBSITE_LABEL to the site it is on, and
+PROFILE_LATEST_LABEL to its link. Fields with other names are kept.
+
+Bluesky profiles have no fields, so there the lines "<label>: <value>" of the
+bio are replaced, or appended when they are missing. Threads profiles cannot
+be edited through the API and are skipped. Profiles are only updated when a
+value changed, so the command can be run after every check, e.g. from cron.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if conf.FeedURL == "" {
+				return fmt.Errorf("RSS feed URL is required")
+			}
+			loc, err := conf.Location()
+			if err != nil {
+				loc = time.Local
+			}
+			items, err := rss.CheckRSSFeed(rss.ExpandFeedURL(conf.FeedURL, time.Now().In(loc)))
+			if err != nil {
+				return fmt.Errorf("error fetching RSS feed: %w", err)
+			}
+			item, ok := rss.Newest(items)
+			if !ok {
+				return fmt.Errorf("the feed has no items")
+			}
+			fields := conf.ProfileFields(item)
+			if len(fields) == 0 {
+				return fmt.Errorf("no profile fields to set: PROFILE_WEBSITE_LABEL and PROFILE_LATEST_LABEL are empty")
+			}
+
+			syncers := map[string]func(context.Context, config.Config, []config.ProfileField) (bool, error){
+				"mastodon": mastodon.SyncProfileFields,
+				"bluesky":  bluesky.SyncProfileFields,
+			}
+			var errs []error
+			for _, site := range conf.EnabledSites() {
+				sync, ok := syncers[site]
+				if !ok {
+					log.Infof("Skipping the %s profile, which cannot be edited through its API", site)
+					continue
+				}
+				if dryRun {
+					for _, f := range fields {
+						fmt.Fprintf(cmd.OutOrStdout(), "%s: %s: %s\n", site, f.Name, f.Value)
+					}
+					continue
+				}
+				changed, err := sync(cmd.Context(), conf, fields)
+				switch {
+				case err != nil:
+					errs = append(errs, fmt.Errorf("%s: %w", site, err))
+				case changed:
+					fmt.Fprintf(cmd.OutOrStdout(), "%s: profile updated to %s\n", site, item.Link)
+				default:
+					fmt.Fprintf(cmd.OutOrStdout(), "%s: profile already up to date\n", site)
+				}
+			}
+			return errors.Join(errs...)
+		},
+	}
+	cmd.Flags().StringVarP(&conf.FeedURL, "feed-url", "f", conf.FeedURL, "RSS feed URL whose newest item is featured")
+	cmd.Flags().StringVar(&conf.ProfileWebsiteLabel, "website-label", conf.ProfileWebsiteLabel, "Name of the profile field set to the site of the newest item (empty to leave it alone)")
+	cmd.Flags().StringVar(&conf.ProfileLatestLabel, "latest-label", conf.ProfileLatestLabel, "Name of the profile field set to the link of the newest item (empty to leave it alone)")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Print the fields that would be set without updating the profiles")
+
+	return cmd
+}
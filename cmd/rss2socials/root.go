@@ -6,7 +6,7 @@
 //
 // The package integrates with several components:
 //   - Configuration management through pkg/config
-//   - Core functionality through internal/rss2socials
+//   - Core functionality through pkg/pipeline
 //   - Manual pages through pkg/man
 //   - Version information through pkg/version
 //
@@ -20,15 +20,25 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 
-	rss2socials "github.com/toozej/rss2socials/internal/rss2socials"
+	"github.com/toozej/rss2socials/internal/logfile"
+	"github.com/toozej/rss2socials/internal/rss2socials"
+	"github.com/toozej/rss2socials/internal/tracing"
+	"github.com/toozej/rss2socials/internal/transport"
 	"github.com/toozej/rss2socials/pkg/config"
 	"github.com/toozej/rss2socials/pkg/man"
+	"github.com/toozej/rss2socials/pkg/pipeline"
 	"github.com/toozej/rss2socials/pkg/version"
 )
 
@@ -39,6 +49,28 @@ var (
 	// debug controls the logging level for the application.
 	// When true, debug-level logging is enabled through logrus.
 	debug bool
+	// trace enables trace-level logging and verbose tracing of every
+	// outbound HTTP request and response.
+	trace bool
+	// replayFeed is a recorded feed document to run the pipeline against
+	// instead of the configured feed URL.
+	replayFeed string
+	// strict makes every configuration problem fatal; lenient only logs
+	// them.
+	strict  bool
+	lenient bool
+	// once runs a single check cycle and exits with a code reflecting its
+	// outcome.
+	once bool
+)
+
+// Exit codes of --once, so that cron or CI wrappers can react to the outcome.
+const (
+	exitOK             = 0 // nothing new, or everything published
+	exitError          = 1
+	exitPartialFailure = 2 // publishing to some sites failed
+	exitPublishFailure = 3 // every publish failed
+	exitFeedFailure    = 4 // the feed could not be fetched
 )
 
 // rootCmd defines the base command for the rss2socials CLI application.
@@ -58,27 +90,149 @@ var rootCmd = &cobra.Command{
 }
 
 // rootCmdRun is the main execution function for the root command.
-// It calls the rss2socials package's Run function with the loaded configuration.
+// It builds a pipeline from the loaded configuration and runs it until the
+// process receives SIGINT/SIGTERM. With TENANTS set, it runs every tenant in
+// a process of its own instead.
 //
 // Parameters:
 //   - cmd: The cobra command being executed
 //   - args: Command-line arguments (unused, as root command takes no args)
 func rootCmdRun(cmd *cobra.Command, args []string) {
-	rss2socials.Run(conf)
+	// Stop cleanly on SIGINT/SIGTERM (e.g. docker stop) so that the post
+	// currently being handled finishes and the database is closed.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if names := conf.TenantNames(); len(names) > 0 {
+		code := runTenants(ctx, names)
+		stop()
+		os.Exit(code)
+	}
+
+	if replayFeed != "" {
+		conf.FeedURL = "file://" + replayFeed
+	}
+
+	p, err := pipeline.New(conf)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if once {
+		outcome, err := p.Check(ctx)
+		os.Exit(exitCode(outcome, err))
+	}
+
+	if err := p.Start(ctx); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// exitCode returns the exit code of --once for the outcome of a check.
+func exitCode(outcome pipeline.Outcome, err error) int {
+	var feedErr *pipeline.FeedError
+	switch {
+	case errors.As(err, &feedErr):
+		log.Errorf("Error fetching RSS feed: %v", err)
+		return exitFeedFailure
+	case err != nil:
+		log.Error(err)
+		return exitError
+	case outcome.Failed > 0 && outcome.Published > 0:
+		log.Warnf("%d of %d publishes failed", outcome.Failed, outcome.Failed+outcome.Published)
+		return exitPartialFailure
+	case outcome.Failed > 0:
+		log.Errorf("All %d publishes failed", outcome.Failed)
+		return exitPublishFailure
+	}
+	return exitOK
 }
 
 // rootCmdPreRun performs setup operations before executing the root command.
 // This function is called before both the root command and any subcommands.
 //
-// It configures the logging level based on the debug flag. When debug mode
-// is enabled, logrus is set to DebugLevel for detailed logging output.
+// It configures how outbound connections are made, redacts configured
+// secrets from all log output and limits outbound requests with
+// rss2socials.Protect, configures logging with configureLogging, and
+// validates the configuration now that flags may have overridden it.
 //
 // Parameters:
 //   - cmd: The cobra command being executed
 //   - args: Command-line arguments
 func rootCmdPreRun(cmd *cobra.Command, args []string) {
-	if debug {
-		log.SetLevel(log.DebugLevel)
+	if conf.Tenant != "" {
+		log.AddHook(tenantHook(conf.Tenant))
+	}
+
+	// Configure the transport before Protect and tracing wrap it.
+	if err := transport.Configure(transport.Options{
+		ForceIPv4:           conf.ForceIPv4,
+		Resolver:            conf.DNSResolver,
+		DialTimeout:         time.Duration(conf.DialTimeoutSeconds) * time.Second,
+		TLSHandshakeTimeout: time.Duration(conf.TLSHandshakeTimeoutSeconds) * time.Second,
+	}); err != nil {
+		log.Errorf("%v; using the default network settings", err)
+	}
+	rss2socials.Protect(conf)
+
+	configureLogging()
+
+	validateConfig()
+}
+
+// configureLogging sets the log format and level, and adds the log file as
+// an output. The level is LOG_LEVEL, lowered to debug by DEBUG or --debug and
+// to trace by --trace. At trace level, every outbound HTTP call is logged.
+func configureLogging() {
+	if conf.LogFormat == config.LogFormatJSON {
+		log.SetFormatter(&log.JSONFormatter{})
+		// With --emit-events, standard output carries only the events.
+		if !conf.EmitEvents {
+			log.SetOutput(os.Stdout)
+		}
+	}
+
+	level, err := log.ParseLevel(conf.LogLevel)
+	if err != nil {
+		// Reported by validateConfig.
+		level = log.InfoLevel
+	}
+	if (debug || conf.Debug) && level < log.DebugLevel {
+		level = log.DebugLevel
+	}
+	if trace {
+		level = log.TraceLevel
+	}
+	log.SetLevel(level)
+	if level == log.TraceLevel {
+		tracing.Enable()
+	}
+
+	if conf.LogFile != "" {
+		w, err := logfile.Open(conf.LogFile, conf.LogFileMaxSizeMB, conf.LogFileMaxBackups)
+		if err != nil {
+			log.Errorf("%v; logging to the console only", err)
+			return
+		}
+		log.SetOutput(io.MultiWriter(log.StandardLogger().Out, w))
+	}
+}
+
+// validateConfig exits with a report of every configuration problem when
+// any of them is fatal, or with --strict when there are any at all. Other
+// problems, or all of them with --lenient, are logged as warnings, and the
+// invalid values are replaced with their defaults.
+func validateConfig() {
+	var verr *config.ValidationError
+	if !errors.As(conf.Validate(), &verr) {
+		return
+	}
+	if strict || (verr.Fatal() && !lenient) {
+		fmt.Fprintf(os.Stderr, "Error loading configuration: %v\n", verr)
+		os.Exit(1)
+	}
+	for _, p := range verr.Problems {
+		log.Warnf("Configuration problem: %s", p)
 	}
 }
 
@@ -107,27 +261,71 @@ func Execute() {
 //   - Loads configuration from environment variables using config.GetEnvVars()
 //   - Defines persistent flags that are available to all commands
 //   - Sets up command-specific flags for the root command
-//   - Registers subcommands (man pages and version information)
+//   - Registers subcommands (database tools, man pages and version information)
 //
 // The debug flag (-d, --debug) enables debug-level logging and is persistent,
 // meaning it's inherited by all subcommands. Other flags allow overriding
 // configuration values from environment variables.
 func init() {
 	// get configuration from environment variables
+	// Missing and invalid settings are reported by validateConfig once flags
+	// are parsed, as flags may provide them.
 	var err error
+	var verr *config.ValidationError
 	conf, err = config.GetEnvVars()
-	if err != nil {
+	if err != nil && !errors.As(err, &verr) {
 		fmt.Fprintf(os.Stderr, "Error loading configuration: %v\n", err)
 		os.Exit(1)
 	}
 
 	// create rootCmd-level flags
 	rootCmd.PersistentFlags().BoolVarP(&debug, "debug", "d", false, "Enable debug-level logging")
+	rootCmd.PersistentFlags().BoolVar(&trace, "trace", false, "Enable trace-level logging of every outbound HTTP request and response (secrets redacted)")
+	rootCmd.PersistentFlags().StringVar(&conf.LogLevel, "log-level", conf.LogLevel, "Least severe level to log: trace, debug, info, warn or error")
+	rootCmd.PersistentFlags().StringVar(&conf.LogFormat, "log-format", conf.LogFormat, "Log format: text on standard error, or json on standard output")
+	rootCmd.PersistentFlags().BoolVar(&conf.EmitEvents, "emit-events", conf.EmitEvents, "Write events (post_detected, published, failed, skipped, ...) as newline-delimited JSON to standard output, and logs to standard error")
+	rootCmd.PersistentFlags().StringVar(&conf.LogFile, "log-file", conf.LogFile, "File to write logs to in addition to the console, rotated by size")
+	rootCmd.PersistentFlags().BoolVar(&strict, "strict", false, "Exit on any configuration problem, instead of replacing invalid values with their defaults")
+	rootCmd.PersistentFlags().BoolVar(&lenient, "lenient", false, "Only warn about configuration problems, including missing required settings")
+	rootCmd.MarkFlagsMutuallyExclusive("strict", "lenient")
+
+	// network flags, shared by all commands making outbound connections
+	rootCmd.PersistentFlags().BoolVar(&conf.ForceIPv4, "force-ipv4", conf.ForceIPv4, "Only connect over IPv4, for hosts with broken IPv6")
+	rootCmd.PersistentFlags().StringVar(&conf.DNSResolver, "dns-resolver", conf.DNSResolver, "DNS server (host[:port]) to resolve host names with instead of the system resolver")
+	rootCmd.PersistentFlags().IntVar(&conf.DialTimeoutSeconds, "dial-timeout", conf.DialTimeoutSeconds, "Seconds to wait for an outbound connection to be established")
+	rootCmd.PersistentFlags().IntVar(&conf.TLSHandshakeTimeoutSeconds, "tls-handshake-timeout", conf.TLSHandshakeTimeoutSeconds, "Seconds to wait for the TLS handshake of an outbound connection")
+	rootCmd.PersistentFlags().StringVar(&conf.UserAgent, "user-agent", conf.UserAgent, "User-Agent to send with outbound requests (default rss2socials/<version> (+repository URL))")
+	rootCmd.PersistentFlags().IntVar(&conf.MaxConnections, "max-connections", conf.MaxConnections, "Maximum number of outbound requests in flight at once (0 for no limit)")
+	rootCmd.PersistentFlags().IntVar(&conf.RequestsPerMinute, "requests-per-minute", conf.RequestsPerMinute, "Maximum rate of outbound requests per minute (0 for no limit)")
+	rootCmd.PersistentFlags().IntVar(&conf.RequestBurst, "request-burst", conf.RequestBurst, "Number of outbound requests sent at once before --requests-per-minute applies")
 
 	// optional flags for configuration, overrides env vars
-	rootCmd.Flags().StringVarP(&conf.FeedURL, "feed-url", "f", conf.FeedURL, "RSS feed URL to watch")
+	rootCmd.Flags().StringVarP(&conf.FeedURL, "feed-url", "f", conf.FeedURL, "RSS feed URL to watch (file:// path, or - for stdin); {{year}}, {{month}} and {{day}} are replaced with the current date")
+	rootCmd.Flags().StringVar(&conf.MetricsAddr, "metrics-addr", conf.MetricsAddr, "Address to serve Prometheus metrics on at /metrics, e.g. :9090")
+	rootCmd.Flags().StringVar(&conf.RecordFeedDir, "record-feed", conf.RecordFeedDir, "Directory to save every fetched feed to, named after the fetch time, for replaying later")
+	rootCmd.Flags().StringVar(&replayFeed, "replay-feed", "", "Run against a feed recorded with --record-feed instead of the feed URL")
 	rootCmd.Flags().IntVarP(&conf.Interval, "interval", "i", conf.Interval, "Interval in minutes to check the RSS feed")
-	rootCmd.Flags().StringVarP(&conf.Category, "category", "c", conf.Category, "Category to filter URL last segment")
+	rootCmd.Flags().StringVar(&conf.CheckSchedule, "check-schedule", conf.CheckSchedule, "Cron expression to check the RSS feed on instead of every interval, e.g. \"*/15 8-20 * * MON-FRI\"")
+	rootCmd.Flags().StringVarP(&conf.Category, "category", "c", conf.Category, "Only publish items in this category")
+	rootCmd.Flags().StringVar(&conf.CategoryFilterMode, "category-filter-mode", conf.CategoryFilterMode, "What --category is matched against: url-segment (last segment of the item URL), rss-category (the item's <category> elements) or both")
+	rootCmd.Flags().StringSliceVar(&conf.LinkDomainAllowlist, "link-domain-allowlist", conf.LinkDomainAllowlist, "Only publish items linking to these domains or their subdomains")
+	rootCmd.Flags().StringSliceVar(&conf.LinkDomainDenylist, "link-domain-denylist", conf.LinkDomainDenylist, "Never publish items linking to these domains or their subdomains")
+	rootCmd.Flags().StringToStringVar(&conf.SensitiveLabels, "sensitive-labels", conf.SensitiveLabels, "Categories or media:rating values marking items as sensitive, with their Bluesky self-label (sexual, porn, nudity, graphic-media or empty), e.g. nsfw=sexual")
+	rootCmd.Flags().StringToStringVar(&conf.ExtensionFilters, "extension-filters", conf.ExtensionFilters, "Only publish items whose namespaced elements contain these values, e.g. itunes:episodeType=full")
+	rootCmd.Flags().StringVar(&conf.PostTemplate, "post-template", conf.PostTemplate, "Go template for new posts (default: the locale's \"New post:\" followed by the link)")
+	rootCmd.Flags().StringVar(&conf.UpdateTemplate, "update-template", conf.UpdateTemplate, "Go template for updated posts (default: the locale's \"Updated post:\" followed by the link)")
+	rootCmd.Flags().StringArrayVar(&conf.TemplateVariants, "template-variant", conf.TemplateVariants, "Template variant for new posts as [site/]name[*weight]=template; repeat for more variants")
+	rootCmd.Flags().StringVar(&conf.TemplateVariantSelection, "template-variant-selection", conf.TemplateVariantSelection, "How variants are picked per post: hash (same variant per link) or random")
+	rootCmd.Flags().StringArrayVar(&conf.FooterLines, "footer-line", conf.FooterLines, "Footer line appended to every --footer-every-th new post, taking turns; repeat for more lines")
+	rootCmd.Flags().StringArrayVar(&conf.Blocklist, "blocklist", conf.Blocklist, "Word, phrase or /regular expression/ that holds back posts containing it from every network; repeat for more entries")
+	rootCmd.Flags().StringVar(&conf.PreviousPost, "previous-post", conf.PreviousPost, "Link new posts to the latest earlier post in their categories: link (a \"Previously:\" line) or quote (a Bluesky quote post, the line elsewhere)")
+	rootCmd.Flags().BoolVar(&conf.SeriesThreading, "series-threading", conf.SeriesThreading, "Publish the parts of a series as replies to the previous part on Mastodon and Bluesky")
+	rootCmd.Flags().StringVar(&conf.SeriesPattern, "series-pattern", conf.SeriesPattern, "Regular expression recognizing series parts by their title, with a (?P<part>...) group and an optional (?P<series>...) group")
+	rootCmd.Flags().IntVar(&conf.FooterEvery, "footer-every", conf.FooterEvery, "Append a footer line to every Nth new post (0 = never)")
+	rootCmd.Flags().StringSliceVar(&conf.ContentSources, "content-sources", conf.ContentSources, "Item fields used as .Content in post templates, in order of priority: description, content:encoded, title, page, article")
+	rootCmd.Flags().IntVar(&conf.ContentMinChars, "content-min-chars", conf.ContentMinChars, "Skip content sources with less text than this, e.g. one-line summaries")
+	rootCmd.Flags().StringVar(&conf.Locale, "locale", conf.Locale, "Language of the phrases in posts, e.g. de or fr_FR (default English)")
+	rootCmd.Flags().StringToStringVar(&conf.Messages, "messages", conf.Messages, "Override phrases of the message catalog, e.g. new_post='Fresh from the blog:'")
 	rootCmd.Flags().StringSliceVar(&conf.SkipPrefixCategories, "skip-prefix-categories", conf.SkipPrefixCategories, "List of categories to skip the 'New blog post:' prefix")
 
 	// Mastodon flags
@@ -135,10 +333,17 @@ func init() {
 	rootCmd.Flags().StringVar(&conf.MastodonClientKey, "mastodon-client-key", conf.MastodonClientKey, "Mastodon Client Key")
 	rootCmd.Flags().StringVar(&conf.MastodonClientSecret, "mastodon-client-secret", conf.MastodonClientSecret, "Mastodon Client Secret")
 	rootCmd.Flags().StringVar(&conf.MastodonAccessToken, "mastodon-access-token", conf.MastodonAccessToken, "Mastodon Access Token")
+	rootCmd.Flags().BoolVar(&conf.MastodonEditUpdates, "mastodon-edit-updates", conf.MastodonEditUpdates, "Edit the original toot of an updated post instead of posting a new status")
+	rootCmd.Flags().BoolVar(&conf.MastodonPinLatest, "mastodon-pin-latest", conf.MastodonPinLatest, "Pin the toot of the newest post to the profile and unpin the one pinned before")
+	rootCmd.Flags().StringVar(&conf.MastodonFlavor, "mastodon-flavor", conf.MastodonFlavor, "Server software behind the Mastodon URL: mastodon, gotosocial, akkoma or pixelfed")
+	rootCmd.Flags().IntVar(&conf.MastodonMaxChars, "mastodon-max-chars", conf.MastodonMaxChars, "Status length limit (0 = as reported by the instance, or the flavor default)")
 
 	// Bluesky flags
 	rootCmd.Flags().StringVar(&conf.BlueskyHandle, "bluesky-handle", conf.BlueskyHandle, "Bluesky handle")
 	rootCmd.Flags().StringVar(&conf.BlueskyAppKey, "bluesky-appkey", conf.BlueskyAppKey, "Bluesky app key/password")
+	rootCmd.Flags().StringVar(&conf.BlueskyAuth, "bluesky-auth", conf.BlueskyAuth, "How to log in to Bluesky: app-password or oauth (see \"rss2socials bluesky login\")")
+	rootCmd.Flags().StringVar(&conf.BlueskyOAuthSessionFile, "bluesky-oauth-session-file", conf.BlueskyOAuthSessionFile, "File the Bluesky OAuth session is stored in")
+	rootCmd.Flags().IntVar(&conf.BlueskyImages, "bluesky-images", conf.BlueskyImages, "Attach up to this many images (max 4) from the feed item's content to Bluesky posts")
 
 	// Threads flags
 	rootCmd.Flags().StringVar(&conf.ThreadsUserID, "threads-user-id", conf.ThreadsUserID, "Threads User ID")
@@ -146,20 +351,69 @@ func init() {
 	rootCmd.Flags().StringVar(&conf.ThreadsClientID, "threads-client-id", conf.ThreadsClientID, "Threads Client ID")
 	rootCmd.Flags().StringVar(&conf.ThreadsClientSecret, "threads-client-secret", conf.ThreadsClientSecret, "Threads Client Secret")
 	rootCmd.Flags().StringVar(&conf.ThreadsRedirectURI, "threads-redirect-uri", conf.ThreadsRedirectURI, "Threads Redirect URI")
+	rootCmd.Flags().StringVar(&conf.ThreadsUpdateMode, "threads-update-mode", conf.ThreadsUpdateMode, "How updated posts are published to Threads: post, reply or quote")
+
+	// Newsletter flags
+	rootCmd.Flags().StringVar(&conf.NewsletterProvider, "newsletter-provider", conf.NewsletterProvider, "Also announce new posts by email through smtp, listmonk or buttondown")
+	rootCmd.Flags().StringSliceVar(&conf.NewsletterEmailTo, "newsletter-email-to", conf.NewsletterEmailTo, "Recipients of the newsletter with --newsletter-provider=smtp")
+	rootCmd.Flags().StringVar(&conf.NewsletterSubjectTemplate, "newsletter-subject-template", conf.NewsletterSubjectTemplate, "Go template for the subject of newsletter emails")
+	rootCmd.Flags().StringVar(&conf.NewsletterTemplate, "newsletter-template", conf.NewsletterTemplate, "Go html/template for the body of newsletter emails (default: the linked title and the content)")
 
 	// Social sites filter flag
-	rootCmd.Flags().StringSliceVar(&conf.SocialSites, "social-sites", conf.SocialSites, "Social media sites to post to (mastodon,bluesky,threads). Defaults to all sites with credentials configured.")
+	rootCmd.Flags().StringSliceVar(&conf.SocialSites, "social-sites", conf.SocialSites, "Social media sites to post to (mastodon,bluesky,threads,newsletter). Defaults to all sites with credentials configured.")
+	rootCmd.Flags().StringSliceVar(&conf.SiteOrder, "site-order", conf.SiteOrder, "Order to publish to sites in; unlisted sites follow in the default order mastodon,bluesky,threads,newsletter")
+	rootCmd.Flags().StringToStringVar(&conf.SiteDependencies, "site-dependencies", conf.SiteDependencies, "Only publish to a site once the site it depends on succeeded, e.g. bluesky=mastodon")
 
 	// Gotify flags
+	rootCmd.Flags().IntVar(&conf.GotifyPriority, "gotify-priority", conf.GotifyPriority, "Priority of Gotify notifications")
 	rootCmd.Flags().BoolVar(&conf.GotifyNotifyOnSuccess, "gotify-notify-on-success", conf.GotifyNotifyOnSuccess, "Send Gotify notifications on successful posts")
+	rootCmd.Flags().StringToIntVar(&conf.GotifyPriorities, "gotify-priorities", conf.GotifyPriorities, "Priority of Gotify notifications per event type or severity, e.g. post_failure=8,info=2")
+
+	// Notification routing flags
+	rootCmd.Flags().StringToStringVar(&conf.NotifyRoutes, "notify-routes", conf.NotifyRoutes, "Route events or severities to notification channels, e.g. post_failure=gotify:8,post_success=ntfy:low")
+	rootCmd.Flags().StringVar(&conf.NtfyURL, "ntfy-url", conf.NtfyURL, "ntfy topic URL for notifications")
 
 	// Dedup flags
 	rootCmd.Flags().BoolVar(&conf.PostNewEntriesOnly, "post-new-entries-only", conf.PostNewEntriesOnly, "Only post entries that appear after first startup (skip existing feed entries)")
+	rootCmd.Flags().BoolVar(&conf.ReplayProtection, "replay-protection", conf.ReplayProtection, "Never post items dated before the latest published item of the feed, even when they are no longer in the database")
+	rootCmd.Flags().BoolVar(&conf.ScheduleFutureItems, "schedule-future-items", conf.ScheduleFutureItems, "Hold back future-dated feed items until their pubDate, scheduling them on Mastodon where supported")
+	rootCmd.Flags().BoolVar(&conf.CanonicalLinks, "canonical-links", conf.CanonicalLinks, "Post and store items under the canonical URL of their page instead of the feed link")
+	rootCmd.Flags().BoolVar(&conf.LinkCheck, "link-check", conf.LinkCheck, "Hold back new items until their page answers 200 OK and is not a soft 404")
+	rootCmd.Flags().IntVar(&conf.LinkCheckGraceMinutes, "link-check-grace-minutes", conf.LinkCheckGraceMinutes, "Minutes after an item was first seen to wait for its page before posting it anyway")
+	rootCmd.Flags().IntVar(&conf.EnrichmentCacheHours, "enrichment-cache-hours", conf.EnrichmentCacheHours, "Hours to cache the canonical URL and page content fetched for a feed item, by its guid (0 = disabled)")
+	rootCmd.Flags().BoolVar(&conf.GitHubActions, "github-actions", conf.GitHubActions, "Annotate the GitHub Actions workflow run with ::error and ::notice commands, and write a summary table to GITHUB_STEP_SUMMARY")
+	rootCmd.Flags().BoolVar(&once, "once", false, "Check the feed once and exit: 0 when nothing failed, 2 when some and 3 when all publishes failed, 4 when the feed could not be fetched")
 	rootCmd.Flags().BoolVar(&conf.ShortRun, "short-run", conf.ShortRun, "Short run mode: only process the 3 most recent RSS feed items")
+	rootCmd.Flags().IntVar(&conf.EventsRetentionDays, "events-retention-days", conf.EventsRetentionDays, "Days to keep entries in the database events audit trail (0 = forever)")
+	rootCmd.Flags().IntVar(&conf.RetryMaxAttempts, "retry-max-attempts", conf.RetryMaxAttempts, "Attempts to publish a post to a site before giving up on it (0 = retry forever)")
+	rootCmd.Flags().IntVar(&conf.RetryBackoffMinutes, "retry-backoff-minutes", conf.RetryBackoffMinutes, "Minutes before the first retry of a failed post, doubled for every further retry")
+	rootCmd.Flags().IntVar(&conf.MaxPostsPerCycle, "max-posts-per-cycle", conf.MaxPostsPerCycle, "Maximum number of feed items to publish per check cycle (0 = unlimited)")
+	rootCmd.Flags().IntVar(&conf.PostTimeoutSeconds, "post-timeout", conf.PostTimeoutSeconds, "Seconds a feed item may take to be prepared and published to every site before it is left for the next cycle (0 = no limit)")
+	rootCmd.Flags().IntVar(&conf.ClockJumpMaxPosts, "clock-jump-max-posts", conf.ClockJumpMaxPosts, "Maximum number of feed items to publish in the first check cycle after the clock jumped ahead, e.g. on resume from sleep (0 = no limit)")
+	rootCmd.Flags().IntVar(&conf.RepromoteAfterDays, "repromote-after-days", conf.RepromoteAfterDays, "Boost/repost each published post once this many days later (0 = disabled)")
+	rootCmd.Flags().StringSliceVar(&conf.RepromoteCategories, "repromote-categories", conf.RepromoteCategories, "Only re-promote posts whose URL last segment contains one of these categories")
+	rootCmd.Flags().IntVar(&conf.CredentialCheckDays, "credential-check-days", conf.CredentialCheckDays, "Check the credentials of the enabled sites every this many days and alert when they are rejected or expiring (0 = disabled)")
+	rootCmd.Flags().IntVar(&conf.CredentialExpiryWarningDays, "credential-expiry-warning-days", conf.CredentialExpiryWarningDays, "Days before a credential expires to start warning about it")
+	rootCmd.Flags().StringVar(&conf.Timezone, "timezone", conf.Timezone, "IANA time zone for scheduling and stored timestamps (e.g. Europe/Berlin); defaults to local time")
+	rootCmd.Flags().StringVar(&conf.DBDriver, "db-driver", conf.DBDriver, "Where to store posts: sqlite, redis, or memory for stateless runs")
+	rootCmd.Flags().StringVar(&conf.RedisURL, "redis-url", conf.RedisURL, "URL of the Redis server used with --db-driver=redis, e.g. redis://:password@localhost:6379/0")
 	rootCmd.Flags().StringVar(&conf.DBPath, "db-path", conf.DBPath, "Path to SQLite database file")
+	rootCmd.Flags().StringVar(&conf.HashAlgorithm, "hash-algorithm", conf.HashAlgorithm, "Algorithm content is hashed with to detect updates: sha256, sha512 or fnv64a")
+	rootCmd.Flags().StringSliceVar(&conf.HashNormalize, "hash-normalize", conf.HashNormalize, "Normalization applied to content before hashing, in order: strip_html, collapse_whitespace, lowercase, or none")
+	rootCmd.Flags().BoolVar(&conf.StoreContent, "store-content", conf.StoreContent, "Store the compressed content of posts to describe and debug updates")
+	rootCmd.Flags().BoolVar(&conf.DBMemoryFallback, "db-memory-fallback", conf.DBMemoryFallback, "Keep running with an in-memory database when the database file cannot be opened")
+	rootCmd.Flags().BoolVar(&conf.CycleLock, "cycle-lock", conf.CycleLock, "Only run a cycle while holding a lock in the shared database, so replicas take turns")
 
 	// add sub-commands
 	rootCmd.AddCommand(
+		newAuthCmd(),
+		newBlueskyCmd(),
+		newConfigCmd(),
+		newDBCmd(),
+		newDeleteCmd(),
+		newPreviewCmd(),
+		newProfileCmd(),
+		newStatsCmd(),
 		man.NewManCmd(),
 		version.Command(),
 	)
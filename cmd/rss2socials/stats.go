@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/toozej/rss2socials/internal/db"
+)
+
+// newStatsCmd returns the "stats" command which prints totals of the stored
+// posts and the event log, overall, per site and per feed.
+func newStatsCmd() *cobra.Command {
+	var format string
+
+	cmd := &cobra.Command{
+		Use:   "stats",
+		Short: "Show posts published per site, failure rates and recent activity per feed",
+		Long: `Show posts published per site, failure rates and recent activity per feed.
+
+Totals of published posts are computed from the stored posts. Failure rates and
+the activity per feed are computed from the event log, so they only cover the
+last EVENTS_RETENTION_DAYS. Posts are counted for the feed fetched last before
+they were published. Posts published with TEMPLATE_VARIANTS are also counted
+per site and variant, to compare phrasing styles.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if format != "table" && format != "json" {
+				return fmt.Errorf("--format must be table or json, got %q", format)
+			}
+			if err := requireDBFile(); err != nil {
+				return err
+			}
+			db.InitDB(conf.DBPath)
+			defer db.CloseDB()
+
+			stats, err := db.ComputeStats(time.Now())
+			if err != nil {
+				return fmt.Errorf("error computing statistics: %w", err)
+			}
+			if format == "json" {
+				enc := json.NewEncoder(cmd.OutOrStdout())
+				enc.SetIndent("", "  ")
+				return enc.Encode(stats)
+			}
+			return printStats(cmd, stats)
+		},
+	}
+	cmd.Flags().StringVar(&conf.DBPath, "db-path", conf.DBPath, "Path to SQLite database file")
+	cmd.Flags().StringVar(&format, "format", "table", "Output format: table or json")
+
+	return cmd
+}
+
+// printStats prints stats as tables.
+func printStats(cmd *cobra.Command, stats db.Stats) error {
+	w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Posts stored:\t%d\n", stats.Posts)
+	fmt.Fprintf(w, "Posts published:\t%d\n", stats.Published)
+	fmt.Fprintf(w, "Posts per week:\t%.1f\n", stats.PostsPerWeek)
+	fmt.Fprintf(w, "Failure rate:\t%s\n", formatRate(stats.FailureRate))
+	fmt.Fprintf(w, "First seen:\t%s\n", formatTime(stats.FirstSeen))
+	fmt.Fprintf(w, "Last posted:\t%s\n", formatTime(stats.LastPosted))
+	fmt.Fprintf(w, "Events since:\t%s\n", formatTime(stats.EventsSince))
+
+	fmt.Fprintln(w, "\nSITE\tPUBLISHED\tATTEMPTS\tFAILURES\tFAILURE RATE")
+	for _, s := range stats.Sites {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%s\n", s.Site, s.Published, s.Attempts, s.Failures, formatRate(s.FailureRate))
+	}
+
+	if len(stats.Variants) > 0 {
+		fmt.Fprintln(w, "\nSITE\tVARIANT\tPUBLISHED")
+		for _, v := range stats.Variants {
+			fmt.Fprintf(w, "%s\t%s\t%d\n", v.Site, v.Variant, v.Published)
+		}
+	}
+
+	if len(stats.Feeds) > 0 {
+		fmt.Fprintln(w, "\nFEED\tFETCHES\tFETCH FAILURES\tPUBLISHED\tLAST FETCHED\tLAST PUBLISHED")
+		for _, f := range stats.Feeds {
+			fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%s\t%s\n", f.URL, f.Fetches, f.FetchFailures, f.Published, formatTime(f.LastFetched), formatTime(f.LastPublished))
+		}
+	}
+	return w.Flush()
+}
+
+// formatRate formats a rate between 0 and 1 as a percentage.
+func formatRate(r float64) string {
+	return fmt.Sprintf("%.1f%%", r*100)
+}
@@ -0,0 +1,103 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"sync"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/toozej/rss2socials/pkg/config"
+)
+
+const (
+	// tenantRestartDelay is how long a tenant whose process exited is left
+	// alone before it is started again.
+	tenantRestartDelay = time.Minute
+	// tenantStopTimeout is how long the process of a tenant is given to
+	// finish the post it is handling once asked to stop.
+	tenantStopTimeout = 30 * time.Second
+)
+
+// runTenants runs rss2socials for every tenant in a process of its own,
+// with the same arguments and TenantEnv naming the tenant, until ctx is
+// cancelled. A tenant whose process exits is started again after
+// tenantRestartDelay. With --once, every tenant is checked once and the exit
+// code of the first tenant that failed, in the order of TENANTS, is
+// returned.
+func runTenants(ctx context.Context, names []string) int {
+	self, err := os.Executable()
+	if err != nil {
+		log.Errorf("Error finding the rss2socials executable: %v", err)
+		return exitError
+	}
+
+	codes := make([]int, len(names))
+	var wg sync.WaitGroup
+	for i, name := range names {
+		wg.Go(func() {
+			for {
+				codes[i] = runTenant(ctx, self, name)
+				if once || ctx.Err() != nil {
+					return
+				}
+				log.Errorf("Tenant %s exited with code %d, restarting it in %s", name, codes[i], tenantRestartDelay)
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(tenantRestartDelay):
+				}
+			}
+		})
+	}
+	wg.Wait()
+
+	for _, code := range codes {
+		if code != exitOK {
+			return code
+		}
+	}
+	return exitOK
+}
+
+// runTenant runs the process of tenant name and returns its exit code. It
+// is asked to stop with SIGTERM when ctx is cancelled.
+func runTenant(ctx context.Context, self, name string) int {
+	cmd := exec.CommandContext(ctx, self, os.Args[1:]...) // #nosec G204 -- runs this executable with its own arguments
+	cmd.Env = append(os.Environ(), config.TenantEnv+"="+name)
+	cmd.Stdin = nil
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Cancel = func() error { return cmd.Process.Signal(syscall.SIGTERM) }
+	cmd.WaitDelay = tenantStopTimeout
+
+	log.Infof("Starting tenant %s", name)
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.As(err, &exitErr) && exitErr.ExitCode() > 0:
+		return exitErr.ExitCode()
+	case ctx.Err() != nil:
+		// Stopped by the signal.
+		return exitOK
+	default:
+		log.Errorf("Error running tenant %s: %v", name, err)
+		return exitError
+	}
+}
+
+// tenantHook adds the tenant a process runs for to its log entries.
+type tenantHook string
+
+func (h tenantHook) Levels() []log.Level { return log.AllLevels }
+
+func (h tenantHook) Fire(entry *log.Entry) error {
+	entry.Data["tenant"] = string(h)
+	return nil
+}
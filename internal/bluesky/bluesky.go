@@ -5,6 +5,10 @@ import (
 	"fmt"
 
 	"github.com/davhofer/botsky/pkg/botsky"
+	"github.com/davhofer/indigo/api/atproto"
+	"github.com/toozej/rss2socials/internal/media"
+	"github.com/toozej/rss2socials/internal/messages"
+	"github.com/toozej/rss2socials/internal/rss"
 	"github.com/toozej/rss2socials/pkg/config"
 )
 
@@ -17,7 +21,13 @@ func NewClient(ctx context.Context, conf config.Config) (*botsky.Client, error)
 	// so we cannot set a custom PDS host (e.g. for testing with a mock server).
 	// When botsky adds a WithPDS/PDSHost option or exposes SetHost on the Client,
 	// update NewClient to pass conf.BlueskyPDS through so that self-hosted
-	// PDS instances and test mocks work correctly. See TODO.md.
+	// PDS instances and test mocks work correctly. See TODO.md. Until then,
+	// checkPDS fails early with a clear error for accounts the entryway
+	// cannot log in.
+	if err := checkPDS(ctx, conf); err != nil {
+		return nil, err
+	}
+
 	client, err := botsky.NewClient(ctx, conf.BlueskyHandle, conf.BlueskyAppKey)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create bluesky client: %w", err)
@@ -30,20 +40,208 @@ func NewClient(ctx context.Context, conf config.Config) (*botsky.Client, error)
 	return client, nil
 }
 
+// useOAuth reports whether conf logs in with an OAuth session rather than
+// an app password.
+func useOAuth(conf config.Config) bool {
+	return conf.BlueskyAuth == config.BlueskyAuthOAuth
+}
+
+// newOAuthClient returns a client of the PDS of the stored OAuth session.
+func newOAuthClient(ctx context.Context, conf config.Config) (*repoClient, error) {
+	s, key, err := oauthSession(ctx, conf)
+	if err != nil {
+		return nil, err
+	}
+	return newRepoClient(s, key), nil
+}
+
+// CheckCredentials logs in with the app password, or checks the OAuth
+// session with the PDS, refreshing it first when it is about to expire.
+func CheckCredentials(ctx context.Context, conf config.Config) error {
+	if useOAuth(conf) {
+		client, err := newOAuthClient(ctx, conf)
+		if err != nil {
+			return err
+		}
+		if _, err := atproto.ServerGetSession(ctx, client.xrpc); err != nil {
+			return fmt.Errorf("bluesky rejected the OAuth session: %w", err)
+		}
+		return nil
+	}
+	_, err := NewClient(ctx, conf)
+	return err
+}
+
 func Post(ctx context.Context, conf config.Config, content string) error {
+	_, err := Publish(ctx, conf, content, Options{})
+	return err
+}
+
+// Options are the optional parts of a post.
+type Options struct {
+	// Labels are self-labels of the post, such as "sexual".
+	Labels []string
+	// Quote is the at:// URI of a post the post quotes.
+	Quote string
+	// ReplyTo is the at:// URI of a post the post replies to, in its
+	// thread.
+	ReplyTo string
+}
+
+// needsRecord reports whether a post with opts must be created as a record
+// through XRPC, as the botsky client cannot create it.
+func (opts Options) needsRecord() bool {
+	return len(opts.Labels) > 0 || opts.Quote != "" || opts.ReplyTo != ""
+}
+
+// Publish creates a Bluesky post with opts and returns its at:// record
+// URI, which is needed to delete the post later.
+func Publish(ctx context.Context, conf config.Config, content string, opts Options) (string, error) {
+	if useOAuth(conf) {
+		return publishOAuth(ctx, conf, content, opts, nil)
+	}
+	if conf.BlueskyHandle == "" || conf.BlueskyAppKey == "" {
+		return "", fmt.Errorf("bluesky handle and appkey are required")
+	}
+	if opts.needsRecord() {
+		return publishRecord(ctx, conf, content, opts, nil)
+	}
+
+	client, err := NewClient(ctx, conf)
+	if err != nil {
+		return "", err
+	}
+
+	return post(ctx, client, conf, botsky.NewPostBuilder(content))
+}
+
+// PublishWithImages creates a Bluesky post with up to MaxImages of images
+// attached as an app.bsky.embed.images embed, each with its alt text. Images
+// are fetched through the media cache at Config.MediaCacheDir and scaled
+// down to ImageLimits before they are uploaded. Images that cannot be used are skipped; when none
+// are left a text-only post is created. The opts are those of Publish.
+func PublishWithImages(ctx context.Context, conf config.Config, content string, opts Options, images []rss.Image) (string, error) {
+	if useOAuth(conf) {
+		return publishOAuth(ctx, conf, content, opts, images)
+	}
 	if conf.BlueskyHandle == "" || conf.BlueskyAppKey == "" {
-		return fmt.Errorf("bluesky handle and appkey are required")
+		return "", fmt.Errorf("bluesky handle and appkey are required")
+	}
+	if opts.needsRecord() {
+		return publishRecord(ctx, conf, content, opts, images)
 	}
 
 	client, err := NewClient(ctx, conf)
 	if err != nil {
-		return err
+		return "", err
 	}
 
 	pb := botsky.NewPostBuilder(content)
-	_, _, err = client.Post(ctx, pb)
+	if sources := prepareImages(ctx, media.NewCache(conf.MediaCacheDir), images); len(sources) > 0 {
+		pb.AddImages(sources)
+	}
+	return post(ctx, client, conf, pb)
+}
+
+// post creates the post of pb, tagged with the language of Config.Locale
+// when one is configured.
+func post(ctx context.Context, client *botsky.Client, conf config.Config, pb *botsky.PostBuilder) (string, error) {
+	if lang := messages.Language(conf.Locale); lang != "" {
+		pb.AddLanguage(lang)
+	}
+	_, uri, err := client.Post(ctx, pb)
+	if err != nil {
+		return "", fmt.Errorf("failed to create bluesky post: %w", err)
+	}
+
+	return uri, nil
+}
+
+func publishOAuth(ctx context.Context, conf config.Config, content string, opts Options, images []rss.Image) (string, error) {
+	client, err := newOAuthClient(ctx, conf)
+	if err != nil {
+		return "", err
+	}
+	return createPost(ctx, client, conf, content, opts, images)
+}
+
+// publishRecord creates a post with opts through an app password session,
+// as botsky cannot create it.
+func publishRecord(ctx context.Context, conf config.Config, content string, opts Options, images []rss.Image) (string, error) {
+	client, err := newSessionClient(ctx, conf)
+	if err != nil {
+		return "", err
+	}
+	return createPost(ctx, client, conf, content, opts, images)
+}
+
+func createPost(ctx context.Context, client *repoClient, conf config.Config, content string, opts Options, images []rss.Image) (string, error) {
+	var sources []botsky.ImageSource
+	if len(images) > 0 {
+		sources = prepareImages(ctx, media.NewCache(conf.MediaCacheDir), images)
+	}
+	uri, err := client.createPost(ctx, content, messages.Language(conf.Locale), opts, sources)
+	if err != nil {
+		return "", fmt.Errorf("failed to create bluesky post: %w", err)
+	}
+
+	return uri, nil
+}
+
+// Repost reposts the post record identified by its at:// URI.
+func Repost(ctx context.Context, conf config.Config, uri string) error {
+	if uri == "" {
+		return fmt.Errorf("bluesky post URI is required")
+	}
+
+	if useOAuth(conf) {
+		client, err := newOAuthClient(ctx, conf)
+		if err != nil {
+			return err
+		}
+		if err := client.repost(ctx, uri); err != nil {
+			return fmt.Errorf("failed to repost bluesky post: %w", err)
+		}
+		return nil
+	}
+
+	client, err := NewClient(ctx, conf)
 	if err != nil {
-		return fmt.Errorf("failed to create bluesky post: %w", err)
+		return err
+	}
+
+	if _, _, err := client.Repost(ctx, uri); err != nil {
+		return fmt.Errorf("failed to repost bluesky post: %w", err)
+	}
+
+	return nil
+}
+
+// DeletePost deletes the post record identified by its at:// URI using
+// com.atproto.repo.deleteRecord.
+func DeletePost(ctx context.Context, conf config.Config, uri string) error {
+	if uri == "" {
+		return fmt.Errorf("bluesky post URI is required")
+	}
+
+	if useOAuth(conf) {
+		client, err := newOAuthClient(ctx, conf)
+		if err != nil {
+			return err
+		}
+		if err := client.deleteRecord(ctx, uri); err != nil {
+			return fmt.Errorf("failed to delete bluesky post: %w", err)
+		}
+		return nil
+	}
+
+	client, err := NewClient(ctx, conf)
+	if err != nil {
+		return err
+	}
+
+	if err := client.RepoDeletePost(ctx, uri); err != nil {
+		return fmt.Errorf("failed to delete bluesky post: %w", err)
 	}
 
 	return nil
@@ -1,10 +1,22 @@
 package bluesky
 
 import (
+	"bytes"
 	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/toozej/rss2socials/internal/media"
+	"github.com/toozej/rss2socials/internal/rss"
+	"github.com/toozej/rss2socials/internal/testutil"
 	"github.com/toozej/rss2socials/pkg/config"
 )
 
@@ -83,3 +95,137 @@ func TestNewClient_Integration(t *testing.T) {
 	assert.Error(t, err)
 	assert.Nil(t, client)
 }
+
+func TestPrepareImages(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing.png" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write(encodePNG(t, 20, 20))
+	}))
+	defer server.Close()
+
+	images := []rss.Image{
+		{URL: server.URL + "/a.png", Alt: "First"},
+		{URL: server.URL + "/missing.png", Alt: "Missing"},
+		{URL: server.URL + "/b.png"},
+	}
+	sources := prepareImages(context.Background(), media.NewCache(t.TempDir()), images)
+	require.Len(t, sources, 2)
+	assert.Equal(t, "First", sources[0].Alt)
+	assert.Equal(t, "", sources[1].Alt)
+	assert.FileExists(t, sources[0].Uri)
+}
+
+func encodePNG(t *testing.T, w, h int) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.RGBA{uint8(x), uint8(y), uint8(x + y), 255})
+		}
+	}
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, img))
+	return buf.Bytes()
+}
+
+// newIdentityServer serves resolveHandle for the handles in dids and the
+// did:plc documents of pds, which maps DIDs to their PDS endpoint. DID
+// documents list the handles mapped to them, except those starting with
+// "unlisted.".
+func newIdentityServer(t *testing.T, dids map[string]string, pds map[string]string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/xrpc/com.atproto.identity.resolveHandle" {
+			did, ok := dids[r.URL.Query().Get("handle")]
+			if !ok {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			fmt.Fprintf(w, `{"did":%q}`, did)
+			return
+		}
+		did := strings.TrimPrefix(r.URL.Path, "/")
+		endpoint, ok := pds[did]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		var handles []string
+		for h, d := range dids {
+			if d == did && !strings.HasPrefix(h, "unlisted.") {
+				handles = append(handles, `"at://`+h+`"`)
+			}
+		}
+		fmt.Fprintf(w, `{"id":%q,"alsoKnownAs":[%s],"service":[{"id":"#atproto_pds","type":"AtprotoPersonalDataServer","serviceEndpoint":%q}]}`,
+			did, strings.Join(handles, ","), endpoint)
+	}))
+	t.Cleanup(srv.Close)
+
+	orig := PLCDirectory
+	PLCDirectory = srv.URL
+	t.Cleanup(func() { PLCDirectory = orig })
+	return srv
+}
+
+func TestResolveIdentity(t *testing.T) {
+	srv := newIdentityServer(t,
+		map[string]string{"alice.example": "did:plc:alice", "unlisted.example": "did:plc:alice"},
+		map[string]string{"did:plc:alice": "https://pds.example"},
+	)
+	ctx := context.Background()
+
+	id, err := ResolveIdentity(ctx, srv.URL, "@alice.example")
+	require.NoError(t, err)
+	assert.Equal(t, Identity{Handle: "alice.example", DID: "did:plc:alice", PDS: "https://pds.example"}, id)
+
+	id, err = ResolveIdentity(ctx, srv.URL, "did:plc:alice")
+	require.NoError(t, err)
+	assert.Equal(t, "alice.example", id.Handle, "a configured DID takes its handle from the DID document")
+
+	_, err = ResolveIdentity(ctx, srv.URL, "unlisted.example")
+	assert.ErrorContains(t, err, "DID document of did:plc:alice does not list the handle unlisted.example")
+	_, err = ResolveIdentity(ctx, srv.URL, "nobody.example")
+	assert.ErrorContains(t, err, "failed to resolve handle nobody.example")
+	_, err = ResolveIdentity(ctx, srv.URL, "did:plc:unknown")
+	assert.ErrorContains(t, err, "failed to fetch DID document")
+}
+
+func TestDIDDocumentURL(t *testing.T) {
+	u, err := didDocumentURL("did:web:example.com")
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com/.well-known/did.json", u)
+
+	u, err = didDocumentURL("did:web:localhost%3A8080")
+	require.NoError(t, err)
+	assert.Equal(t, "https://localhost:8080/.well-known/did.json", u)
+
+	_, err = didDocumentURL("did:key:z6Mk")
+	assert.Error(t, err)
+}
+
+func TestCheckPDS(t *testing.T) {
+	srv := newIdentityServer(t,
+		map[string]string{"hosted.example": "did:plc:hosted", "selfhosted.example": "did:plc:self", "moved.example": "did:plc:moved"},
+		map[string]string{
+			"did:plc:hosted": "https://morel.us-east.host.bsky.network",
+			"did:plc:self":   "https://pds.example",
+			"did:plc:moved":  "https://new-pds.example",
+		},
+	)
+	testutil.RouteHost(t, "bsky.social", srv.URL)
+	testutil.RouteHost(t, "pds.example", srv.URL)
+	ctx := context.Background()
+
+	assert.NoError(t, checkPDS(ctx, config.Config{BlueskyHandle: "hosted.example"}))
+
+	err := checkPDS(ctx, config.Config{BlueskyHandle: "moved.example", BlueskyPDS: "https://pds.example"})
+	assert.ErrorContains(t, err, "BLUESKY_PDS is https://pds.example, but the repo of moved.example (did:plc:moved) is hosted on https://new-pds.example")
+
+	err = checkPDS(ctx, config.Config{BlueskyHandle: "selfhosted.example", BlueskyPDS: "https://pds.example"})
+	assert.ErrorContains(t, err, "is hosted on the PDS https://pds.example")
+	assert.ErrorContains(t, err, "self-hosted PDSes are only supported with BLUESKY_AUTH=oauth")
+}
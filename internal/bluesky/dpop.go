@@ -0,0 +1,181 @@
+package bluesky
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// dpopKey is the ES256 key OAuth tokens are bound to with DPoP (RFC 9449).
+// Every request made with a token carries a proof signed with it.
+type dpopKey struct {
+	*ecdsa.PrivateKey
+}
+
+func newDPoPKey() (dpopKey, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return dpopKey{}, fmt.Errorf("failed to generate DPoP key: %w", err)
+	}
+	return dpopKey{key}, nil
+}
+
+// parseDPoPKey reads a key encoded by dpopKey.encode.
+func parseDPoPKey(s string) (dpopKey, error) {
+	block, _ := pem.Decode([]byte(s))
+	if block == nil {
+		return dpopKey{}, fmt.Errorf("invalid DPoP key")
+	}
+	key, err := x509.ParseECPrivateKey(block.Bytes)
+	if err != nil {
+		return dpopKey{}, fmt.Errorf("invalid DPoP key: %w", err)
+	}
+	return dpopKey{key}, nil
+}
+
+// encode returns the key PEM encoded.
+func (k dpopKey) encode() (string, error) {
+	der, err := x509.MarshalECPrivateKey(k.PrivateKey)
+	if err != nil {
+		return "", err
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})), nil
+}
+
+// jwk returns the public key as a JSON Web Key.
+func (k dpopKey) jwk() (map[string]string, error) {
+	b, err := k.PublicKey.Bytes() // uncompressed: 0x04 || x || y
+	if err != nil {
+		return nil, err
+	}
+	return map[string]string{
+		"kty": "EC",
+		"crv": "P-256",
+		"x":   b64(b[1:33]),
+		"y":   b64(b[33:]),
+	}, nil
+}
+
+// proof returns a DPoP proof JWT for a request of method to htu. nonce is
+// the server's latest DPoP-Nonce and accessToken the token the request is
+// authorized with, if any.
+func (k dpopKey) proof(method, htu, nonce, accessToken string) (string, error) {
+	jwk, err := k.jwk()
+	if err != nil {
+		return "", err
+	}
+	header, err := json.Marshal(map[string]any{
+		"typ": "dpop+jwt",
+		"alg": "ES256",
+		"jwk": jwk,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	jti := make([]byte, 16)
+	if _, err := rand.Read(jti); err != nil {
+		return "", err
+	}
+	claims := map[string]any{
+		"jti": b64(jti),
+		"htm": method,
+		"htu": htu,
+		"iat": time.Now().Unix(),
+	}
+	if nonce != "" {
+		claims["nonce"] = nonce
+	}
+	if accessToken != "" {
+		sum := sha256.Sum256([]byte(accessToken))
+		claims["ath"] = b64(sum[:])
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := b64(header) + "." + b64(payload)
+	digest := sha256.Sum256([]byte(signingInput))
+	r, s, err := ecdsa.Sign(rand.Reader, k.PrivateKey, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to sign DPoP proof: %w", err)
+	}
+	sig := make([]byte, 64)
+	r.FillBytes(sig[:32])
+	s.FillBytes(sig[32:])
+	return signingInput + "." + b64(sig), nil
+}
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// htu returns the htu claim of a proof for req: its URL without query and
+// fragment.
+func htu(req *http.Request) string {
+	u := *req.URL
+	u.RawQuery, u.Fragment = "", ""
+	return u.String()
+}
+
+// dpopTransport authorizes requests to a PDS with a DPoP-bound access
+// token. A request the server rejects for a missing or stale nonce is sent
+// once more with the nonce it returned.
+type dpopTransport struct {
+	key   dpopKey
+	token string
+
+	mu    sync.Mutex
+	nonce string
+}
+
+func (t *dpopTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		r := req.Clone(req.Context())
+		if attempt > 0 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			r.Body = body
+		}
+
+		t.mu.Lock()
+		nonce := t.nonce
+		t.mu.Unlock()
+		proof, err := t.key.proof(req.Method, htu(req), nonce, t.token)
+		if err != nil {
+			return nil, err
+		}
+		r.Header.Set("Authorization", "DPoP "+t.token)
+		r.Header.Set("DPoP", proof)
+
+		resp, err := http.DefaultTransport.RoundTrip(r)
+		if err != nil {
+			return nil, err
+		}
+		if n := resp.Header.Get("DPoP-Nonce"); n != "" {
+			t.mu.Lock()
+			t.nonce = n
+			t.mu.Unlock()
+		}
+		retry := attempt == 0 && (req.Body == nil || req.GetBody != nil) &&
+			resp.StatusCode == http.StatusUnauthorized &&
+			strings.Contains(resp.Header.Get("WWW-Authenticate"), "use_dpop_nonce")
+		if !retry {
+			return resp, nil
+		}
+		resp.Body.Close()
+	}
+}
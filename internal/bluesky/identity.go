@@ -0,0 +1,228 @@
+package bluesky
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/davhofer/botsky/pkg/botsky"
+
+	"github.com/toozej/rss2socials/internal/httpbody"
+	"github.com/toozej/rss2socials/pkg/config"
+)
+
+// PLCDirectory is the directory did:plc documents are fetched from.
+var PLCDirectory = "https://plc.directory"
+
+// identityTTL is how long a resolved identity is reused before it is
+// resolved again, e.g. to notice an account that moved to another PDS.
+const identityTTL = time.Hour
+
+// Identity is an atproto account: its handle, DID and the PDS hosting its
+// repo, as declared in its DID document.
+type Identity struct {
+	Handle string
+	DID    string
+	PDS    string
+}
+
+// didDocument is the part of a DID document identities are resolved from.
+type didDocument struct {
+	ID          string   `json:"id"`
+	AlsoKnownAs []string `json:"alsoKnownAs"`
+	Service     []struct {
+		ID              string `json:"id"`
+		Type            string `json:"type"`
+		ServiceEndpoint string `json:"serviceEndpoint"`
+	} `json:"service"`
+}
+
+var identityClient = &http.Client{Timeout: 10 * time.Second}
+
+var identities = struct {
+	sync.Mutex
+	m map[string]cachedIdentity
+}{m: make(map[string]cachedIdentity)}
+
+type cachedIdentity struct {
+	Identity
+	expires time.Time
+}
+
+// ResolveIdentity resolves handle, or a DID, to its DID with
+// com.atproto.identity.resolveHandle on host, and reads the PDS hosting the
+// account from its DID document. The handle must be confirmed by the DID
+// document's alsoKnownAs.
+func ResolveIdentity(ctx context.Context, host, handle string) (Identity, error) {
+	handle = strings.TrimPrefix(strings.TrimSpace(handle), "@")
+	did := handle
+	if !strings.HasPrefix(handle, "did:") {
+		var out struct {
+			DID string `json:"did"`
+		}
+		u := strings.TrimSuffix(host, "/") + "/xrpc/com.atproto.identity.resolveHandle?handle=" + url.QueryEscape(handle)
+		if err := getJSON(ctx, u, &out); err != nil {
+			return Identity{}, fmt.Errorf("failed to resolve handle %s: %w", handle, err)
+		}
+		did = out.DID
+	}
+
+	docURL, err := didDocumentURL(did)
+	if err != nil {
+		return Identity{}, err
+	}
+	var doc didDocument
+	if err := getJSON(ctx, docURL, &doc); err != nil {
+		return Identity{}, fmt.Errorf("failed to fetch DID document of %s: %w", did, err)
+	}
+	if doc.ID != did {
+		return Identity{}, fmt.Errorf("DID document of %s is for %s", did, doc.ID)
+	}
+
+	// A configured DID needs no confirmation; its first handle is used.
+	id := Identity{Handle: handle, DID: did}
+	isDID := handle == did
+	confirmed := isDID
+	for _, aka := range doc.AlsoKnownAs {
+		h, ok := strings.CutPrefix(aka, "at://")
+		if !ok {
+			continue
+		}
+		if isDID && id.Handle == did {
+			id.Handle = h
+		}
+		if strings.EqualFold(h, handle) {
+			confirmed = true
+		}
+	}
+	if !confirmed {
+		return Identity{}, fmt.Errorf("DID document of %s does not list the handle %s", did, handle)
+	}
+
+	for _, s := range doc.Service {
+		if (s.ID == "#atproto_pds" || s.ID == did+"#atproto_pds") && s.Type == "AtprotoPersonalDataServer" {
+			id.PDS = s.ServiceEndpoint
+		}
+	}
+	if id.PDS == "" {
+		return Identity{}, fmt.Errorf("DID document of %s declares no PDS", did)
+	}
+	return id, nil
+}
+
+// didDocumentURL returns where the DID document of did is published.
+func didDocumentURL(did string) (string, error) {
+	switch {
+	case strings.HasPrefix(did, "did:plc:"):
+		return strings.TrimSuffix(PLCDirectory, "/") + "/" + did, nil
+	case strings.HasPrefix(did, "did:web:"):
+		host, err := url.PathUnescape(strings.TrimPrefix(did, "did:web:"))
+		if err != nil || host == "" || strings.Contains(host, "/") {
+			return "", fmt.Errorf("invalid did:web %q", did)
+		}
+		return "https://" + host + "/.well-known/did.json", nil
+	}
+	return "", fmt.Errorf("unsupported DID method: %q", did)
+}
+
+func getJSON(ctx context.Context, u string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := identityClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("HTTP request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected HTTP status: %d", resp.StatusCode)
+	}
+	return httpbody.DecodeJSON(resp.Body, v)
+}
+
+// checkPDS verifies, before logging in, that the account of
+// conf.BlueskyHandle can be posted to: its repo must be hosted on
+// conf.BlueskyPDS, when set, and reachable through the bsky.social
+// entryway, which is the only host the client library talks to. Resolved
+// identities are cached for identityTTL.
+func checkPDS(ctx context.Context, conf config.Config) error {
+	id, err := identity(ctx, conf)
+	if err != nil {
+		return err
+	}
+
+	if conf.BlueskyPDS != "" && !sameHost(conf.BlueskyPDS, id.PDS) {
+		return fmt.Errorf("BLUESKY_PDS is %s, but the repo of %s (%s) is hosted on %s according to its DID document", conf.BlueskyPDS, id.Handle, id.DID, id.PDS)
+	}
+	if !servedByEntryway(id.PDS) {
+		return fmt.Errorf("the repo of %s (%s) is hosted on the PDS %s, which cannot be posted to through %s; self-hosted PDSes are only supported with BLUESKY_AUTH=oauth", id.Handle, id.DID, id.PDS, botsky.ApiEntryway)
+	}
+	return nil
+}
+
+// identity resolves conf.BlueskyHandle on conf.BlueskyPDS, or the entryway,
+// reusing identities resolved within identityTTL.
+func identity(ctx context.Context, conf config.Config) (Identity, error) {
+	host := conf.BlueskyPDS
+	if host == "" {
+		host = botsky.ApiEntryway
+	}
+
+	key := host + " " + conf.BlueskyHandle
+	identities.Lock()
+	cached, ok := identities.m[key]
+	identities.Unlock()
+	if ok && time.Now().Before(cached.expires) {
+		return cached.Identity, nil
+	}
+	id, err := ResolveIdentity(ctx, host, conf.BlueskyHandle)
+	if err != nil {
+		return Identity{}, err
+	}
+	identities.Lock()
+	identities.m[key] = cachedIdentity{Identity: id, expires: time.Now().Add(identityTTL)}
+	identities.Unlock()
+	return id, nil
+}
+
+// Account returns the handle posts are published as, e.g.
+// "@blog.bsky.social": the handle of the OAuth session, or else the handle
+// BLUESKY_HANDLE resolves to.
+func Account(ctx context.Context, conf config.Config) (string, error) {
+	if useOAuth(conf) {
+		s, err := LoadSession(conf.BlueskyOAuthSessionFile)
+		if err != nil {
+			return "", err
+		}
+		return "@" + s.Handle, nil
+	}
+	id, err := identity(ctx, conf)
+	if err != nil {
+		return "", err
+	}
+	return "@" + id.Handle, nil
+}
+
+// sameHost reports whether the URLs a and b have the same host.
+func sameHost(a, b string) bool {
+	ua, errA := url.Parse(a)
+	ub, errB := url.Parse(b)
+	return errA == nil && errB == nil && strings.EqualFold(ua.Host, ub.Host)
+}
+
+// servedByEntryway reports whether the PDS at endpoint is one of Bluesky's
+// own, whose accounts log in through the bsky.social entryway.
+func servedByEntryway(endpoint string) bool {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+	return host == "bsky.social" || strings.HasSuffix(host, ".bsky.network")
+}
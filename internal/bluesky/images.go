@@ -0,0 +1,37 @@
+package bluesky
+
+import (
+	"context"
+
+	"github.com/davhofer/botsky/pkg/botsky"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/toozej/rss2socials/internal/media"
+	"github.com/toozej/rss2socials/internal/rss"
+)
+
+// MaxImages is the maximum number of images of an app.bsky.embed.images
+// embed.
+const MaxImages = 4
+
+// ImageLimits are Bluesky's constraints on image blobs.
+var ImageLimits = media.Limits{MaxBytes: 1_000_000, MaxDimension: 2000}
+
+// prepareImages fetches images through cache, resized to ImageLimits, and
+// returns them as botsky image sources with their alt text. Images that
+// cannot be used are skipped with a warning.
+func prepareImages(ctx context.Context, cache *media.Cache, images []rss.Image) []botsky.ImageSource {
+	var sources []botsky.ImageSource
+	for _, img := range images {
+		if len(sources) == MaxImages {
+			break
+		}
+		path, err := cache.Fetch(ctx, img.URL, ImageLimits)
+		if err != nil {
+			log.Warnf("Skipping Bluesky image %s: %v", img.URL, err)
+			continue
+		}
+		sources = append(sources, botsky.ImageSource{Uri: path, Alt: img.Alt})
+	}
+	return sources
+}
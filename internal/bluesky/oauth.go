@@ -0,0 +1,405 @@
+package bluesky
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/davhofer/botsky/pkg/botsky"
+
+	"github.com/toozej/rss2socials/internal/httpbody"
+	"github.com/toozej/rss2socials/internal/redact"
+	"github.com/toozej/rss2socials/pkg/config"
+)
+
+// oauthScope grants what an app password does: posting and managing the
+// account's records.
+const oauthScope = "atproto transition:generic"
+
+// oauthRefreshMargin is how long before it expires an access token is
+// refreshed.
+const oauthRefreshMargin = 5 * time.Minute
+
+// Session is an OAuth session of a Bluesky account, as stored in
+// Config.BlueskyOAuthSessionFile. The tokens are bound to DPoPKey and are
+// useless without it.
+type Session struct {
+	Handle        string    `json:"handle"`
+	DID           string    `json:"did"`
+	PDS           string    `json:"pds"`
+	Issuer        string    `json:"issuer"`
+	TokenEndpoint string    `json:"token_endpoint"`
+	ClientID      string    `json:"client_id"`
+	AccessToken   string    `json:"access_token"`
+	RefreshToken  string    `json:"refresh_token"`
+	ExpiresAt     time.Time `json:"expires_at"`
+	// DPoPKey is the PEM encoded private key the tokens are bound to.
+	DPoPKey string `json:"dpop_key"`
+	// AuthServerNonce is the authorization server's latest DPoP nonce.
+	AuthServerNonce string `json:"auth_server_nonce,omitempty"`
+}
+
+// LoadSession reads the OAuth session stored at path.
+func LoadSession(path string) (Session, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return Session{}, fmt.Errorf("no bluesky OAuth session at %s; run \"rss2socials bluesky login\" first", path)
+		}
+		return Session{}, fmt.Errorf("failed to read bluesky OAuth session: %w", err)
+	}
+	var s Session
+	if err := json.Unmarshal(data, &s); err != nil {
+		return Session{}, fmt.Errorf("failed to parse bluesky OAuth session %s: %w", path, err)
+	}
+	redact.Register(s.AccessToken, s.RefreshToken)
+	return s, nil
+}
+
+// saveSession writes s to path, readable by the owner only. It is written
+// to a temporary file first, so that a crash never leaves a truncated
+// session behind: the refresh token it replaces is already spent.
+func saveSession(path string, s Session) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			return fmt.Errorf("failed to create bluesky OAuth session directory: %w", err)
+		}
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("failed to save bluesky OAuth session: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to save bluesky OAuth session: %w", err)
+	}
+	return nil
+}
+
+// authServerMetadata is the part of an authorization server's
+// /.well-known/oauth-authorization-server document that is used.
+type authServerMetadata struct {
+	Issuer                             string `json:"issuer"`
+	AuthorizationEndpoint              string `json:"authorization_endpoint"`
+	TokenEndpoint                      string `json:"token_endpoint"`
+	PushedAuthorizationRequestEndpoint string `json:"pushed_authorization_request_endpoint"`
+}
+
+// authServer discovers the authorization server of the PDS at pds.
+func authServer(ctx context.Context, pds string) (authServerMetadata, error) {
+	var resource struct {
+		AuthorizationServers []string `json:"authorization_servers"`
+	}
+	if err := getJSON(ctx, strings.TrimSuffix(pds, "/")+"/.well-known/oauth-protected-resource", &resource); err != nil {
+		return authServerMetadata{}, fmt.Errorf("failed to fetch OAuth metadata of %s: %w", pds, err)
+	}
+	if len(resource.AuthorizationServers) == 0 {
+		return authServerMetadata{}, fmt.Errorf("PDS %s declares no OAuth authorization server", pds)
+	}
+
+	issuer := strings.TrimSuffix(resource.AuthorizationServers[0], "/")
+	var meta authServerMetadata
+	if err := getJSON(ctx, issuer+"/.well-known/oauth-authorization-server", &meta); err != nil {
+		return authServerMetadata{}, fmt.Errorf("failed to fetch metadata of authorization server %s: %w", issuer, err)
+	}
+	if strings.TrimSuffix(meta.Issuer, "/") != issuer {
+		return authServerMetadata{}, fmt.Errorf("authorization server %s claims to be %s", issuer, meta.Issuer)
+	}
+	if meta.PushedAuthorizationRequestEndpoint == "" || meta.AuthorizationEndpoint == "" || meta.TokenEndpoint == "" {
+		return authServerMetadata{}, fmt.Errorf("authorization server %s does not support pushed authorization requests", issuer)
+	}
+	return meta, nil
+}
+
+// clientID returns the OAuth client_id: Config.BlueskyOAuthClientID, or a
+// loopback client for redirectURI, whose metadata is implied by its URL.
+func clientID(conf config.Config, redirectURI string) string {
+	if conf.BlueskyOAuthClientID != "" {
+		return conf.BlueskyOAuthClientID
+	}
+	return "http://localhost?" + url.Values{
+		"redirect_uri": {redirectURI},
+		"scope":        {oauthScope},
+	}.Encode()
+}
+
+// Login creates an OAuth session for conf.BlueskyHandle and saves it to
+// conf.BlueskyOAuthSessionFile. The user approves access in the browser at
+// the URL passed to open, which redirects back to a listener on the address
+// of conf.BlueskyOAuthRedirectURI.
+func Login(ctx context.Context, conf config.Config, open func(authURL string)) (Session, error) {
+	if conf.BlueskyHandle == "" {
+		return Session{}, fmt.Errorf("bluesky handle is required")
+	}
+	host := conf.BlueskyPDS
+	if host == "" {
+		host = botsky.ApiEntryway
+	}
+	id, err := ResolveIdentity(ctx, host, conf.BlueskyHandle)
+	if err != nil {
+		return Session{}, err
+	}
+	meta, err := authServer(ctx, id.PDS)
+	if err != nil {
+		return Session{}, err
+	}
+
+	redirect, err := url.Parse(conf.BlueskyOAuthRedirectURI)
+	if err != nil || redirect.Scheme != "http" || redirect.Host == "" {
+		return Session{}, fmt.Errorf("invalid BLUESKY_OAUTH_REDIRECT_URI %q: must be an http:// URL to listen on", conf.BlueskyOAuthRedirectURI)
+	}
+	ln, err := net.Listen("tcp", redirect.Host)
+	if err != nil {
+		return Session{}, fmt.Errorf("failed to listen for the OAuth callback: %w", err)
+	}
+	defer ln.Close()
+	if redirect.Port() == "0" {
+		redirect.Host = ln.Addr().String()
+	}
+	redirectURI := redirect.String()
+
+	key, err := newDPoPKey()
+	if err != nil {
+		return Session{}, err
+	}
+	s := Session{
+		Handle:        id.Handle,
+		DID:           id.DID,
+		PDS:           id.PDS,
+		Issuer:        meta.Issuer,
+		TokenEndpoint: meta.TokenEndpoint,
+		ClientID:      clientID(conf, redirectURI),
+	}
+	if s.DPoPKey, err = key.encode(); err != nil {
+		return Session{}, err
+	}
+
+	verifier, state := randomString(), randomString()
+	challenge := sha256.Sum256([]byte(verifier))
+	var par struct {
+		RequestURI string `json:"request_uri"`
+	}
+	if err := tokenRequest(ctx, meta.PushedAuthorizationRequestEndpoint, key, &s.AuthServerNonce, url.Values{
+		"client_id":             {s.ClientID},
+		"response_type":         {"code"},
+		"code_challenge":        {b64(challenge[:])},
+		"code_challenge_method": {"S256"},
+		"state":                 {state},
+		"redirect_uri":          {redirectURI},
+		"scope":                 {oauthScope},
+		"login_hint":            {id.Handle},
+	}, &par); err != nil {
+		return Session{}, fmt.Errorf("pushed authorization request failed: %w", err)
+	}
+
+	code, err := awaitCallback(ctx, ln, redirect.Path, state, meta.Issuer, func() {
+		open(meta.AuthorizationEndpoint + "?" + url.Values{
+			"client_id":   {s.ClientID},
+			"request_uri": {par.RequestURI},
+		}.Encode())
+	})
+	if err != nil {
+		return Session{}, err
+	}
+
+	if err := requestTokens(ctx, &s, key, url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {redirectURI},
+		"client_id":     {s.ClientID},
+		"code_verifier": {verifier},
+	}); err != nil {
+		return Session{}, err
+	}
+	if err := saveSession(conf.BlueskyOAuthSessionFile, s); err != nil {
+		return Session{}, err
+	}
+	return s, nil
+}
+
+// awaitCallback serves the OAuth redirect on ln, calls open once it is
+// listening and returns the authorization code of the callback matching
+// state.
+func awaitCallback(ctx context.Context, ln net.Listener, path, state, issuer string, open func()) (string, error) {
+	if path == "" {
+		path = "/"
+	}
+	type result struct {
+		code string
+		err  error
+	}
+	results := make(chan result, 1)
+	mux := http.NewServeMux()
+	mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("state") != state {
+			http.Error(w, "unknown OAuth state", http.StatusBadRequest)
+			return
+		}
+		var res result
+		switch {
+		case q.Get("error") != "":
+			res.err = fmt.Errorf("authorization failed: %s %s", q.Get("error"), q.Get("error_description"))
+		case q.Get("iss") != issuer:
+			res.err = fmt.Errorf("authorization response is from %q, not %s", q.Get("iss"), issuer)
+		default:
+			res.code = q.Get("code")
+		}
+		if res.err != nil {
+			http.Error(w, res.err.Error(), http.StatusBadRequest)
+		} else {
+			_, _ = fmt.Fprintln(w, "rss2socials is now logged in to Bluesky. You can close this window.")
+		}
+		select {
+		case results <- res:
+		default:
+		}
+	})
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() { _ = srv.Serve(ln) }()
+	defer srv.Close()
+
+	open()
+	select {
+	case res := <-results:
+		return res.code, res.err
+	case <-ctx.Done():
+		return "", fmt.Errorf("waiting for the OAuth callback: %w", ctx.Err())
+	}
+}
+
+// requestTokens requests tokens for s with the grant in form, checks they
+// were issued for the account of s and stores them in s.
+func requestTokens(ctx context.Context, s *Session, key dpopKey, form url.Values) error {
+	var tokens struct {
+		AccessToken  string `json:"access_token"`
+		TokenType    string `json:"token_type"`
+		ExpiresIn    int    `json:"expires_in"`
+		RefreshToken string `json:"refresh_token"`
+		Scope        string `json:"scope"`
+		Sub          string `json:"sub"`
+	}
+	if err := tokenRequest(ctx, s.TokenEndpoint, key, &s.AuthServerNonce, form, &tokens); err != nil {
+		return fmt.Errorf("token request failed: %w", err)
+	}
+	if tokens.Sub != s.DID {
+		return fmt.Errorf("tokens were issued for %q, not %s", tokens.Sub, s.DID)
+	}
+	if !strings.EqualFold(tokens.TokenType, "DPoP") {
+		return fmt.Errorf("unexpected token type %q", tokens.TokenType)
+	}
+	if !strings.Contains(" "+tokens.Scope+" ", " atproto ") {
+		return fmt.Errorf("tokens lack the atproto scope: %q", tokens.Scope)
+	}
+
+	s.AccessToken, s.RefreshToken = tokens.AccessToken, tokens.RefreshToken
+	s.ExpiresAt = time.Now().UTC().Add(time.Duration(tokens.ExpiresIn) * time.Second).Truncate(time.Second)
+	redact.Register(s.AccessToken, s.RefreshToken)
+	return nil
+}
+
+// tokenRequest posts form to an authorization server endpoint with a DPoP
+// proof and decodes the JSON response into out. *nonce is updated with the
+// server's nonce; a request rejected for a missing or stale nonce is sent
+// once more.
+func tokenRequest(ctx context.Context, endpoint string, key dpopKey, nonce *string, form url.Values, out any) error {
+	for attempt := 0; ; attempt++ {
+		proof, err := key.proof(http.MethodPost, endpoint, *nonce, "")
+		if err != nil {
+			return err
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("DPoP", proof)
+
+		resp, err := identityClient.Do(req)
+		if err != nil {
+			return fmt.Errorf("HTTP request failed: %w", err)
+		}
+		if n := resp.Header.Get("DPoP-Nonce"); n != "" {
+			*nonce = n
+		}
+		if resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusCreated {
+			err := httpbody.DecodeJSON(resp.Body, out)
+			resp.Body.Close()
+			return err
+		}
+
+		var oauthErr struct {
+			Error       string `json:"error"`
+			Description string `json:"error_description"`
+		}
+		body, _ := httpbody.Read(resp.Body, httpbody.MaxJSON)
+		resp.Body.Close()
+		_ = json.Unmarshal(body, &oauthErr)
+		if oauthErr.Error == "use_dpop_nonce" && attempt == 0 {
+			continue
+		}
+		if oauthErr.Error != "" {
+			return fmt.Errorf("%s: %s", oauthErr.Error, oauthErr.Description)
+		}
+		return fmt.Errorf("unexpected HTTP status: %d: %s", resp.StatusCode, httpbody.ErrorText(bytes.NewReader(body)))
+	}
+}
+
+// sessions serializes token refreshes: a refresh token can only be used
+// once.
+var sessions sync.Mutex
+
+// oauthSession returns the stored session of conf, with its tokens
+// refreshed and saved first when the access token is about to expire.
+func oauthSession(ctx context.Context, conf config.Config) (Session, dpopKey, error) {
+	sessions.Lock()
+	defer sessions.Unlock()
+
+	s, err := LoadSession(conf.BlueskyOAuthSessionFile)
+	if err != nil {
+		return Session{}, dpopKey{}, err
+	}
+	key, err := parseDPoPKey(s.DPoPKey)
+	if err != nil {
+		return Session{}, dpopKey{}, err
+	}
+	if conf.BlueskyHandle != "" && !strings.EqualFold(conf.BlueskyHandle, s.Handle) && conf.BlueskyHandle != s.DID {
+		return Session{}, dpopKey{}, fmt.Errorf("bluesky OAuth session is for %s, not %s; run \"rss2socials bluesky login\" again", s.Handle, conf.BlueskyHandle)
+	}
+	if time.Until(s.ExpiresAt) > oauthRefreshMargin {
+		return s, key, nil
+	}
+
+	if err := requestTokens(ctx, &s, key, url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {s.RefreshToken},
+		"client_id":     {s.ClientID},
+	}); err != nil {
+		return Session{}, dpopKey{}, fmt.Errorf("failed to refresh bluesky OAuth session: %w", err)
+	}
+	if err := saveSession(conf.BlueskyOAuthSessionFile, s); err != nil {
+		return Session{}, dpopKey{}, err
+	}
+	return s, key, nil
+}
+
+func randomString() string {
+	b := make([]byte, 32)
+	_, _ = rand.Read(b)
+	return b64(b)
+}
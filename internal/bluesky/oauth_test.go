@@ -0,0 +1,436 @@
+package bluesky
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/toozej/rss2socials/pkg/config"
+)
+
+const oauthTestDID = "did:plc:oauthtest"
+
+// oauthServer is a fake authorization server and PDS. Both require DPoP
+// nonces, so that every client request is retried once with the nonce.
+type oauthServer struct {
+	*httptest.Server
+	t *testing.T
+	// identity resolves the handle oauth.example to the account.
+	identity *httptest.Server
+
+	mu        sync.Mutex
+	requests  map[string]map[string]string // request_uri -> PAR parameters
+	access    string
+	refresh   string
+	refreshes int
+	records   []map[string]any
+	deletes   []map[string]any
+	puts      []map[string]any
+	// profile is the JSON value of the account's profile record.
+	profile string
+	// posts are the JSON values of post records by rkey.
+	posts map[string]string
+}
+
+func newOAuthServer(t *testing.T) *oauthServer {
+	t.Helper()
+	s := &oauthServer{t: t, requests: make(map[string]map[string]string)}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	t.Cleanup(s.Close)
+	s.identity = newIdentityServer(t,
+		map[string]string{"oauth.example": oauthTestDID},
+		map[string]string{oauthTestDID: s.URL},
+	)
+	return s
+}
+
+func (s *oauthServer) serve(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+
+	switch r.URL.Path {
+	case "/.well-known/oauth-protected-resource":
+		fmt.Fprintf(w, `{"authorization_servers":[%q]}`, s.URL)
+		return
+	case "/.well-known/oauth-authorization-server":
+		fmt.Fprintf(w, `{"issuer":%q,"authorization_endpoint":%q,"token_endpoint":%q,"pushed_authorization_request_endpoint":%q}`,
+			s.URL, s.URL+"/oauth/authorize", s.URL+"/oauth/token", s.URL+"/oauth/par")
+		return
+	case "/oauth/authorize":
+		par, ok := s.requests[r.URL.Query().Get("request_uri")]
+		if !ok {
+			http.Error(w, "unknown request_uri", http.StatusBadRequest)
+			return
+		}
+		http.Redirect(w, r, par["redirect_uri"]+"?code=code1&state="+par["state"]+"&iss="+s.URL, http.StatusFound)
+		return
+	}
+
+	claims := verifyProof(s.t, r)
+	if strings.HasPrefix(r.URL.Path, "/oauth/") {
+		if claims["nonce"] != "as-nonce" {
+			w.Header().Set("DPoP-Nonce", "as-nonce")
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"error":"use_dpop_nonce"}`)
+			return
+		}
+		require.NoError(s.t, r.ParseForm())
+		s.serveAuthServer(w, r)
+		return
+	}
+
+	if claims["nonce"] != "pds-nonce" {
+		w.Header().Set("DPoP-Nonce", "pds-nonce")
+		w.Header().Set("WWW-Authenticate", `DPoP error="use_dpop_nonce"`)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	sum := sha256.Sum256([]byte(s.access))
+	if r.Header.Get("Authorization") != "DPoP "+s.access || claims["ath"] != b64(sum[:]) {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprint(w, `{"error":"InvalidToken"}`)
+		return
+	}
+	s.servePDS(w, r)
+}
+
+func (s *oauthServer) serveAuthServer(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/oauth/par":
+		uri := fmt.Sprintf("urn:request:%d", len(s.requests))
+		s.requests[uri] = make(map[string]string)
+		for k := range r.PostForm {
+			s.requests[uri][k] = r.PostForm.Get(k)
+		}
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, `{"request_uri":%q,"expires_in":60}`, uri)
+	case "/oauth/token":
+		switch r.PostForm.Get("grant_type") {
+		case "authorization_code":
+			var par map[string]string
+			for _, p := range s.requests {
+				par = p
+			}
+			challenge := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+			if r.PostForm.Get("code") != "code1" || b64(challenge[:]) != par["code_challenge"] ||
+				r.PostForm.Get("redirect_uri") != par["redirect_uri"] || r.PostForm.Get("client_id") != par["client_id"] {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprint(w, `{"error":"invalid_grant"}`)
+				return
+			}
+		case "refresh_token":
+			if r.PostForm.Get("refresh_token") != s.refresh {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprint(w, `{"error":"invalid_grant","error_description":"refresh token replayed"}`)
+				return
+			}
+			s.refreshes++
+		}
+		n := s.refreshes + 1
+		s.access, s.refresh = fmt.Sprintf("access-token-%d", n), fmt.Sprintf("refresh-token-%d", n)
+		fmt.Fprintf(w, `{"access_token":%q,"token_type":"DPoP","expires_in":3600,"refresh_token":%q,"scope":%q,"sub":%q}`,
+			s.access, s.refresh, oauthScope, oauthTestDID)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *oauthServer) servePDS(w http.ResponseWriter, r *http.Request) {
+	var body map[string]any
+	if r.Body != nil && r.Method == http.MethodPost {
+		require.NoError(s.t, json.NewDecoder(r.Body).Decode(&body))
+	}
+	switch strings.TrimPrefix(r.URL.Path, "/xrpc/") {
+	case "com.atproto.repo.createRecord":
+		s.records = append(s.records, body)
+		fmt.Fprintf(w, `{"uri":"at://%s/%s/rkey%d","cid":"bafyrecord"}`, oauthTestDID, body["collection"], len(s.records))
+	case "com.atproto.repo.getRecord":
+		q := r.URL.Query()
+		value := "{}"
+		if q.Get("collection") == "app.bsky.actor.profile" && s.profile != "" {
+			value = s.profile
+		}
+		if post, ok := s.posts[q.Get("rkey")]; ok && q.Get("collection") == "app.bsky.feed.post" {
+			value = post
+		}
+		fmt.Fprintf(w, `{"uri":"at://%s/%s/%s","cid":"bafyoriginal","value":%s}`, q.Get("repo"), q.Get("collection"), q.Get("rkey"), value)
+	case "com.atproto.repo.putRecord":
+		s.puts = append(s.puts, body)
+		fmt.Fprintf(w, `{"uri":"at://%s/%s/%s","cid":"bafyput"}`, oauthTestDID, body["collection"], body["rkey"])
+	case "com.atproto.repo.deleteRecord":
+		s.deletes = append(s.deletes, body)
+		fmt.Fprint(w, `{}`)
+	case "com.atproto.server.getSession":
+		fmt.Fprintf(w, `{"did":%q,"handle":"oauth.example"}`, oauthTestDID)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// verifyProof checks the DPoP proof of r is signed by the key in its header
+// and bound to the request, and returns its claims.
+func verifyProof(t *testing.T, r *http.Request) map[string]any {
+	t.Helper()
+	parts := strings.Split(r.Header.Get("DPoP"), ".")
+	require.Len(t, parts, 3, "DPoP proof")
+
+	var header struct {
+		Typ string            `json:"typ"`
+		Alg string            `json:"alg"`
+		JWK map[string]string `json:"jwk"`
+	}
+	var claims map[string]any
+	decode := func(s string, v any) {
+		data, err := base64.RawURLEncoding.DecodeString(s)
+		require.NoError(t, err)
+		require.NoError(t, json.Unmarshal(data, v))
+	}
+	decode(parts[0], &header)
+	decode(parts[1], &claims)
+	assert.Equal(t, "dpop+jwt", header.Typ)
+	assert.Equal(t, "ES256", header.Alg)
+
+	x, err := base64.RawURLEncoding.DecodeString(header.JWK["x"])
+	require.NoError(t, err)
+	y, err := base64.RawURLEncoding.DecodeString(header.JWK["y"])
+	require.NoError(t, err)
+	pub, err := ecdsa.ParseUncompressedPublicKey(elliptic.P256(), append(append([]byte{4}, x...), y...))
+	require.NoError(t, err)
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	require.NoError(t, err)
+	require.Len(t, sig, 64)
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	assert.True(t, ecdsa.Verify(pub, digest[:], new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])), "DPoP proof signature")
+
+	assert.Equal(t, r.Method, claims["htm"])
+	assert.Equal(t, "http://"+r.Host+r.URL.Path, claims["htu"])
+	return claims
+}
+
+func oauthConfig(t *testing.T, srv *oauthServer) config.Config {
+	return config.Config{
+		BlueskyHandle:           "oauth.example",
+		BlueskyPDS:              srv.identity.URL,
+		BlueskyAuth:             config.BlueskyAuthOAuth,
+		BlueskyOAuthRedirectURI: "http://127.0.0.1:0/callback",
+		BlueskyOAuthSessionFile: filepath.Join(t.TempDir(), "session.json"),
+	}
+}
+
+// browse follows authURL like a browser would, through to the callback.
+func browse(t *testing.T) func(string) {
+	return func(authURL string) {
+		resp, err := http.Get(authURL)
+		if !assert.NoError(t, err) {
+			return
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode, string(body))
+	}
+}
+
+func TestLogin(t *testing.T) {
+	srv := newOAuthServer(t)
+	conf := oauthConfig(t, srv)
+
+	s, err := Login(context.Background(), conf, browse(t))
+	require.NoError(t, err)
+	assert.Equal(t, "oauth.example", s.Handle)
+	assert.Equal(t, oauthTestDID, s.DID)
+	assert.Equal(t, srv.URL, s.PDS)
+	assert.Equal(t, "access-token-1", s.AccessToken)
+	assert.True(t, strings.HasPrefix(s.ClientID, "http://localhost?"), s.ClientID)
+	assert.Equal(t, "oauth.example", srv.requests["urn:request:0"]["login_hint"])
+
+	info, err := os.Stat(conf.BlueskyOAuthSessionFile)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+	stored, err := LoadSession(conf.BlueskyOAuthSessionFile)
+	require.NoError(t, err)
+	assert.Equal(t, s, stored)
+
+	conf.Locale = "de"
+	uri, err := Publish(context.Background(), conf, "New post: https://example.com/hello #golang", Options{Labels: []string{"sexual"}})
+	require.NoError(t, err)
+	assert.Equal(t, "at://"+oauthTestDID+"/app.bsky.feed.post/rkey1", uri)
+	require.Len(t, srv.records, 1)
+	record := srv.records[0]["record"].(map[string]any)
+	assert.Equal(t, "app.bsky.feed.post", record["$type"])
+	assert.Equal(t, "New post: https://example.com/hello #golang", record["text"])
+	assert.Len(t, record["facets"], 2)
+	assert.Equal(t, []any{"de"}, record["langs"])
+	assert.Equal(t, map[string]any{
+		"$type":  "com.atproto.label.defs#selfLabels",
+		"values": []any{map[string]any{"val": "sexual"}},
+	}, record["labels"])
+	assert.Equal(t, oauthTestDID, srv.records[0]["repo"])
+}
+
+func TestLogin_WrongAccount(t *testing.T) {
+	srv := newOAuthServer(t)
+	conf := oauthConfig(t, srv)
+	conf.BlueskyHandle = "nobody.example"
+
+	_, err := Login(context.Background(), conf, browse(t))
+	assert.Error(t, err)
+	assert.NoFileExists(t, conf.BlueskyOAuthSessionFile)
+}
+
+// storeSession saves a session of the account of srv whose access token
+// expires at expires.
+func storeSession(t *testing.T, srv *oauthServer, conf config.Config, expires time.Time) {
+	t.Helper()
+	key, err := newDPoPKey()
+	require.NoError(t, err)
+	encoded, err := key.encode()
+	require.NoError(t, err)
+
+	srv.access, srv.refresh = "access-token-1", "refresh-token-1"
+	require.NoError(t, saveSession(conf.BlueskyOAuthSessionFile, Session{
+		Handle:        "oauth.example",
+		DID:           oauthTestDID,
+		PDS:           srv.URL,
+		Issuer:        srv.URL,
+		TokenEndpoint: srv.URL + "/oauth/token",
+		ClientID:      "https://rss2socials.example/client-metadata.json",
+		AccessToken:   srv.access,
+		RefreshToken:  srv.refresh,
+		ExpiresAt:     expires,
+		DPoPKey:       encoded,
+	}))
+}
+
+func TestOAuthSession_Refresh(t *testing.T) {
+	srv := newOAuthServer(t)
+	conf := oauthConfig(t, srv)
+	storeSession(t, srv, conf, time.Now().Add(time.Minute))
+
+	_, err := Publish(context.Background(), conf, "Hello", Options{})
+	require.NoError(t, err)
+	assert.Equal(t, 1, srv.refreshes)
+
+	s, err := LoadSession(conf.BlueskyOAuthSessionFile)
+	require.NoError(t, err)
+	assert.Equal(t, "access-token-2", s.AccessToken)
+	assert.Equal(t, "refresh-token-2", s.RefreshToken, "the rotated refresh token is saved")
+	assert.Equal(t, "as-nonce", s.AuthServerNonce)
+
+	_, err = Publish(context.Background(), conf, "Hello again", Options{})
+	require.NoError(t, err)
+	assert.Equal(t, 1, srv.refreshes, "a fresh access token is reused")
+}
+
+func TestOAuthSession_OtherHandle(t *testing.T) {
+	srv := newOAuthServer(t)
+	conf := oauthConfig(t, srv)
+	storeSession(t, srv, conf, time.Now().Add(time.Hour))
+	conf.BlueskyHandle = "someone.else"
+
+	_, err := Publish(context.Background(), conf, "Hello", Options{})
+	assert.ErrorContains(t, err, "bluesky login")
+}
+
+func TestLoadSession_Missing(t *testing.T) {
+	_, err := LoadSession(filepath.Join(t.TempDir(), "missing.json"))
+	assert.ErrorContains(t, err, "bluesky login")
+}
+
+func TestOAuth_RepostAndDelete(t *testing.T) {
+	srv := newOAuthServer(t)
+	conf := oauthConfig(t, srv)
+	storeSession(t, srv, conf, time.Now().Add(time.Hour))
+	ctx := context.Background()
+	uri := "at://" + oauthTestDID + "/app.bsky.feed.post/abc"
+
+	require.NoError(t, Repost(ctx, conf, uri))
+	require.Len(t, srv.records, 1)
+	assert.Equal(t, "app.bsky.feed.repost", srv.records[0]["collection"])
+	subject := srv.records[0]["record"].(map[string]any)["subject"].(map[string]any)
+	assert.Equal(t, uri, subject["uri"])
+	assert.Equal(t, "bafyoriginal", subject["cid"])
+
+	require.NoError(t, DeletePost(ctx, conf, uri))
+	require.Len(t, srv.deletes, 1)
+	assert.Equal(t, map[string]any{"collection": "app.bsky.feed.post", "repo": oauthTestDID, "rkey": "abc"}, srv.deletes[0])
+
+	assert.Error(t, DeletePost(ctx, conf, "at://did:plc:other/app.bsky.feed.post/abc"))
+	assert.Error(t, DeletePost(ctx, conf, "https://bsky.app/profile/x/post/abc"))
+}
+
+func TestOAuth_Reply(t *testing.T) {
+	srv := newOAuthServer(t)
+	conf := oauthConfig(t, srv)
+	storeSession(t, srv, conf, time.Now().Add(time.Hour))
+	ctx := context.Background()
+	root := "at://" + oauthTestDID + "/app.bsky.feed.post/part1"
+	parent := "at://" + oauthTestDID + "/app.bsky.feed.post/part2"
+	srv.posts = map[string]string{"part2": fmt.Sprintf(`{"reply":{"root":{"uri":%q,"cid":"bafyroot"},"parent":{"uri":%q,"cid":"bafyroot"}}}`, root, root)}
+
+	_, err := Publish(ctx, conf, "Part 2", Options{ReplyTo: root})
+	require.NoError(t, err)
+	_, err = Publish(ctx, conf, "Part 3", Options{ReplyTo: parent})
+	require.NoError(t, err)
+	require.Len(t, srv.records, 2)
+
+	reply := srv.records[0]["record"].(map[string]any)["reply"].(map[string]any)
+	assert.Equal(t, root, reply["root"].(map[string]any)["uri"], "a reply to a post that is no reply starts its thread")
+	assert.Equal(t, root, reply["parent"].(map[string]any)["uri"])
+	reply = srv.records[1]["record"].(map[string]any)["reply"].(map[string]any)
+	assert.Equal(t, root, reply["root"].(map[string]any)["uri"], "replies stay in the thread of the parent")
+	assert.Equal(t, "bafyroot", reply["root"].(map[string]any)["cid"])
+	assert.Equal(t, parent, reply["parent"].(map[string]any)["uri"])
+	assert.Equal(t, "bafyoriginal", reply["parent"].(map[string]any)["cid"])
+}
+
+func TestCheckCredentials_OAuth(t *testing.T) {
+	srv := newOAuthServer(t)
+	conf := oauthConfig(t, srv)
+	storeSession(t, srv, conf, time.Now().Add(time.Hour))
+	ctx := context.Background()
+
+	require.NoError(t, CheckCredentials(ctx, conf))
+
+	srv.access = "revoked"
+	assert.ErrorContains(t, CheckCredentials(ctx, conf), "rejected the OAuth session")
+}
+
+func TestFacets(t *testing.T) {
+	text := "Read https://example.com/a?b=1#c. #go #2024 (#gopher) x#no"
+	var got []string
+	for _, f := range facets(text) {
+		span := text[f.Index.ByteStart:f.Index.ByteEnd]
+		switch feature := f.Features[0]; {
+		case feature.RichtextFacet_Link != nil:
+			assert.Equal(t, span, feature.RichtextFacet_Link.Uri)
+			got = append(got, "link "+span)
+		case feature.RichtextFacet_Tag != nil:
+			assert.Equal(t, span, "#"+feature.RichtextFacet_Tag.Tag)
+			got = append(got, "tag "+span)
+		}
+	}
+	assert.Equal(t, []string{"link https://example.com/a?b=1#c", "tag #go"}, got)
+
+	text = "Über #Café"
+	f := facets(text)
+	require.Len(t, f, 1)
+	assert.Equal(t, "#Café", text[f[0].Index.ByteStart:f[0].Index.ByteEnd], "offsets are in bytes")
+}
@@ -0,0 +1,120 @@
+package bluesky
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/davhofer/indigo/api/bsky"
+	"github.com/davhofer/indigo/xrpc"
+
+	"github.com/toozej/rss2socials/internal/charcount"
+	"github.com/toozej/rss2socials/pkg/config"
+)
+
+// MaxDescriptionGraphemes is how long the description (bio) of a Bluesky
+// profile can be.
+const MaxDescriptionGraphemes = 256
+
+// SyncProfileFields sets the lines "<name>: <value>" of the profile
+// description to the values of fields, as Bluesky profiles have no fields.
+// Lines of fields that are not in the description yet are appended. The
+// profile is only updated when a line changed, which is reported.
+func SyncProfileFields(ctx context.Context, conf config.Config, fields []config.ProfileField) (bool, error) {
+	if useOAuth(conf) {
+		client, err := newOAuthClient(ctx, conf)
+		if err != nil {
+			return false, err
+		}
+		return client.syncProfileFields(ctx, fields)
+	}
+
+	client, err := NewClient(ctx, conf)
+	if err != nil {
+		return false, err
+	}
+	var profile bsky.ActorProfile
+	if err := client.RepoGetRecordAsType(ctx, "at://"+client.Did+"/app.bsky.actor.profile/self", &profile); err != nil {
+		return false, fmt.Errorf("failed to fetch bluesky profile: %w", err)
+	}
+	var description string
+	if profile.Description != nil {
+		description = *profile.Description
+	}
+	description, changed, err := mergeDescription(description, fields)
+	if err != nil || !changed {
+		return false, err
+	}
+	if err := client.UpdateProfileDescription(ctx, description); err != nil {
+		return false, fmt.Errorf("failed to update bluesky profile: %w", err)
+	}
+	return true, nil
+}
+
+// syncProfileFields is SyncProfileFields for an OAuth session. The profile
+// record is kept as JSON, so that properties the lexicon of indigo does not
+// know are not dropped, and only replaced if it did not change meanwhile.
+func (c *repoClient) syncProfileFields(ctx context.Context, fields []config.ProfileField) (bool, error) {
+	var record struct {
+		CID   string         `json:"cid"`
+		Value map[string]any `json:"value"`
+	}
+	params := map[string]any{"repo": c.did, "collection": "app.bsky.actor.profile", "rkey": "self"}
+	if err := c.xrpc.Do(ctx, xrpc.Query, "", "com.atproto.repo.getRecord", params, nil, &record); err != nil {
+		return false, fmt.Errorf("failed to fetch bluesky profile: %w", err)
+	}
+	if record.Value == nil {
+		record.Value = map[string]any{}
+	}
+
+	description, _ := record.Value["description"].(string)
+	description, changed, err := mergeDescription(description, fields)
+	if err != nil || !changed {
+		return false, err
+	}
+	record.Value["$type"] = "app.bsky.actor.profile"
+	record.Value["description"] = description
+
+	input := map[string]any{
+		"repo":       c.did,
+		"collection": "app.bsky.actor.profile",
+		"rkey":       "self",
+		"record":     record.Value,
+		"swapRecord": record.CID,
+	}
+	if err := c.xrpc.Do(ctx, xrpc.Procedure, "application/json", "com.atproto.repo.putRecord", nil, input, nil); err != nil {
+		return false, fmt.Errorf("failed to update bluesky profile: %w", err)
+	}
+	return true, nil
+}
+
+// mergeDescription returns description with the line of each field set to
+// "<name>: <value>", and whether any line changed. An error is returned
+// when the description would get longer than MaxDescriptionGraphemes.
+func mergeDescription(description string, fields []config.ProfileField) (string, bool, error) {
+	var lines []string
+	if description != "" {
+		lines = strings.Split(description, "\n")
+	}
+
+	changed := false
+	for _, f := range fields {
+		line := f.Name + ": " + f.Value
+		i := slices.IndexFunc(lines, func(l string) bool { return strings.HasPrefix(l, f.Name+":") })
+		switch {
+		case i < 0:
+			lines = append(lines, line)
+			changed = true
+		case lines[i] != line:
+			lines[i] = line
+			changed = true
+		}
+	}
+
+	merged := strings.Join(lines, "\n")
+	if changed && charcount.Graphemes(merged) > MaxDescriptionGraphemes {
+		return "", false, fmt.Errorf("bluesky profile description would be %d graphemes long, over the limit of %d", charcount.Graphemes(merged), MaxDescriptionGraphemes)
+	}
+	return merged, changed, nil
+}
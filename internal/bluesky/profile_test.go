@@ -0,0 +1,70 @@
+package bluesky
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/toozej/rss2socials/pkg/config"
+)
+
+func TestMergeDescription(t *testing.T) {
+	fields := []config.ProfileField{
+		{Name: "Website", Value: "https://example.com"},
+		{Name: "Latest post", Value: "https://example.com/new"},
+	}
+
+	tests := []struct {
+		name        string
+		description string
+		want        string
+		changed     bool
+	}{
+		{name: "empty", description: "", want: "Website: https://example.com\nLatest post: https://example.com/new", changed: true},
+		{name: "appended", description: "I write about Go.", want: "I write about Go.\nWebsite: https://example.com\nLatest post: https://example.com/new", changed: true},
+		{name: "replaced in place", description: "Latest post: https://example.com/old\nI write about Go.\nWebsite: https://example.com",
+			want: "Latest post: https://example.com/new\nI write about Go.\nWebsite: https://example.com", changed: true},
+		{name: "up to date", description: "Bio\nWebsite: https://example.com\nLatest post: https://example.com/new",
+			want: "Bio\nWebsite: https://example.com\nLatest post: https://example.com/new", changed: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, changed, err := mergeDescription(tt.description, fields)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.changed, changed)
+		})
+	}
+
+	_, _, err := mergeDescription(strings.Repeat("x", 200), fields)
+	assert.ErrorContains(t, err, "over the limit of 256")
+}
+
+func TestOAuth_SyncProfileFields(t *testing.T) {
+	srv := newOAuthServer(t)
+	srv.profile = `{"$type":"app.bsky.actor.profile","displayName":"Blog","description":"Bio\nLatest post: https://example.com/old","pronouns":"they/them"}`
+	conf := oauthConfig(t, srv)
+	storeSession(t, srv, conf, time.Now().Add(time.Hour))
+	ctx := context.Background()
+
+	changed, err := SyncProfileFields(ctx, conf, []config.ProfileField{{Name: "Latest post", Value: "https://example.com/old"}})
+	require.NoError(t, err)
+	assert.False(t, changed)
+	assert.Empty(t, srv.puts)
+
+	changed, err = SyncProfileFields(ctx, conf, []config.ProfileField{{Name: "Latest post", Value: "https://example.com/new"}})
+	require.NoError(t, err)
+	assert.True(t, changed)
+	require.Len(t, srv.puts, 1)
+	assert.Equal(t, "app.bsky.actor.profile", srv.puts[0]["collection"])
+	assert.Equal(t, "self", srv.puts[0]["rkey"])
+	assert.Equal(t, "bafyoriginal", srv.puts[0]["swapRecord"])
+	record := srv.puts[0]["record"].(map[string]any)
+	assert.Equal(t, "Bio\nLatest post: https://example.com/new", record["description"])
+	assert.Equal(t, "Blog", record["displayName"])
+	assert.Equal(t, "they/them", record["pronouns"], "properties unknown to the lexicon are kept")
+}
@@ -0,0 +1,261 @@
+package bluesky
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/davhofer/botsky/pkg/botsky"
+	"github.com/davhofer/indigo/api/atproto"
+	"github.com/davhofer/indigo/api/bsky"
+	lexutil "github.com/davhofer/indigo/lex/util"
+	"github.com/davhofer/indigo/xrpc"
+
+	"github.com/toozej/rss2socials/pkg/config"
+)
+
+// The OAuth flow talks to the account's PDS directly through XRPC, as the
+// botsky client only logs in with app passwords. So do posts with Options,
+// which botsky cannot create.
+
+// repoClient is an XRPC client of the PDS of an OAuth or app password
+// session.
+type repoClient struct {
+	xrpc *xrpc.Client
+	did  string
+}
+
+func newRepoClient(s Session, key dpopKey) *repoClient {
+	return &repoClient{
+		xrpc: &xrpc.Client{
+			Client: &http.Client{Transport: &dpopTransport{key: key, token: s.AccessToken}},
+			Host:   strings.TrimSuffix(s.PDS, "/"),
+		},
+		did: s.DID,
+	}
+}
+
+// newSessionClient logs in to the entryway with the app password of conf
+// and returns a client of the session.
+func newSessionClient(ctx context.Context, conf config.Config) (*repoClient, error) {
+	if err := checkPDS(ctx, conf); err != nil {
+		return nil, err
+	}
+	client := &xrpc.Client{Client: new(http.Client), Host: botsky.ApiEntryway}
+	out, err := atproto.ServerCreateSession(ctx, client, &atproto.ServerCreateSession_Input{
+		Identifier: conf.BlueskyHandle,
+		Password:   conf.BlueskyAppKey,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to authenticate with bluesky: %w", err)
+	}
+	client.Auth = &xrpc.AuthInfo{AccessJwt: out.AccessJwt, RefreshJwt: out.RefreshJwt, Handle: out.Handle, Did: out.Did}
+	return &repoClient{xrpc: client, did: out.Did}, nil
+}
+
+// createPost creates an app.bsky.feed.post record of text in the language
+// lang, with the options opts, link and hashtag facets and images uploaded
+// as blobs, and returns its at:// URI.
+func (c *repoClient) createPost(ctx context.Context, text, lang string, opts Options, images []botsky.ImageSource) (string, error) {
+	post := &bsky.FeedPost{
+		LexiconTypeID: "app.bsky.feed.post",
+		Text:          text,
+		CreatedAt:     time.Now().UTC().Format(time.RFC3339),
+		Facets:        facets(text),
+	}
+	if lang != "" {
+		post.Langs = []string{lang}
+	}
+	if len(opts.Labels) > 0 {
+		selfLabels := &atproto.LabelDefs_SelfLabels{LexiconTypeID: "com.atproto.label.defs#selfLabels"}
+		for _, label := range opts.Labels {
+			selfLabels.Values = append(selfLabels.Values, &atproto.LabelDefs_SelfLabel{Val: label})
+		}
+		post.Labels = &bsky.FeedPost_Labels{LabelDefs_SelfLabels: selfLabels}
+	}
+
+	var embeds []*bsky.EmbedImages_Image
+	for _, img := range images {
+		data, err := os.ReadFile(img.Uri)
+		if err != nil {
+			return "", fmt.Errorf("failed to read image: %w", err)
+		}
+		out, err := atproto.RepoUploadBlob(ctx, c.xrpc, bytes.NewReader(data))
+		if err != nil {
+			return "", fmt.Errorf("failed to upload image: %w", err)
+		}
+		embeds = append(embeds, &bsky.EmbedImages_Image{Alt: img.Alt, Image: out.Blob})
+	}
+	if opts.ReplyTo != "" {
+		ref, err := c.replyRef(ctx, opts.ReplyTo)
+		if err != nil {
+			return "", fmt.Errorf("failed to fetch parent post: %w", err)
+		}
+		post.Reply = ref
+	}
+	var quoted *atproto.RepoStrongRef
+	if opts.Quote != "" {
+		ref, err := c.strongRef(ctx, opts.Quote)
+		if err != nil {
+			return "", fmt.Errorf("failed to fetch quoted post: %w", err)
+		}
+		quoted = ref
+	}
+	var imagesEmbed *bsky.EmbedImages
+	if len(embeds) > 0 {
+		imagesEmbed = &bsky.EmbedImages{LexiconTypeID: "app.bsky.embed.images", Images: embeds}
+	}
+	switch {
+	case quoted != nil && imagesEmbed != nil:
+		post.Embed = &bsky.FeedPost_Embed{EmbedRecordWithMedia: &bsky.EmbedRecordWithMedia{
+			LexiconTypeID: "app.bsky.embed.recordWithMedia",
+			Record:        &bsky.EmbedRecord{LexiconTypeID: "app.bsky.embed.record", Record: quoted},
+			Media:         &bsky.EmbedRecordWithMedia_Media{EmbedImages: imagesEmbed},
+		}}
+	case quoted != nil:
+		post.Embed = &bsky.FeedPost_Embed{EmbedRecord: &bsky.EmbedRecord{LexiconTypeID: "app.bsky.embed.record", Record: quoted}}
+	case imagesEmbed != nil:
+		post.Embed = &bsky.FeedPost_Embed{EmbedImages: imagesEmbed}
+	}
+
+	return c.createRecord(ctx, "app.bsky.feed.post", post)
+}
+
+// getRecord decodes the record at uri into out.
+func (c *repoClient) getRecord(ctx context.Context, uri string, out any) error {
+	repo, collection, rkey, err := parseRecordURI(uri)
+	if err != nil {
+		return err
+	}
+	params := map[string]any{"repo": repo, "collection": collection, "rkey": rkey}
+	return c.xrpc.Do(ctx, xrpc.Query, "", "com.atproto.repo.getRecord", params, nil, out)
+}
+
+// strongRef returns the URI and CID of the record at uri.
+func (c *repoClient) strongRef(ctx context.Context, uri string) (*atproto.RepoStrongRef, error) {
+	var record struct {
+		URI string `json:"uri"`
+		CID string `json:"cid"`
+	}
+	if err := c.getRecord(ctx, uri, &record); err != nil {
+		return nil, err
+	}
+	return &atproto.RepoStrongRef{Uri: record.URI, Cid: record.CID}, nil
+}
+
+// replyRef returns the reference of a reply to the post at uri, in the
+// thread of the post: its root is that of the post, or the post itself when
+// it is no reply.
+func (c *repoClient) replyRef(ctx context.Context, uri string) (*bsky.FeedPost_ReplyRef, error) {
+	var record struct {
+		URI   string `json:"uri"`
+		CID   string `json:"cid"`
+		Value struct {
+			Reply *struct {
+				Root *atproto.RepoStrongRef `json:"root"`
+			} `json:"reply"`
+		} `json:"value"`
+	}
+	if err := c.getRecord(ctx, uri, &record); err != nil {
+		return nil, err
+	}
+	parent := &atproto.RepoStrongRef{Uri: record.URI, Cid: record.CID}
+	root := parent
+	if reply := record.Value.Reply; reply != nil && reply.Root != nil {
+		root = &atproto.RepoStrongRef{Uri: reply.Root.Uri, Cid: reply.Root.Cid}
+	}
+	return &bsky.FeedPost_ReplyRef{Root: root, Parent: parent}, nil
+}
+
+// repost creates an app.bsky.feed.repost record of the post at uri.
+func (c *repoClient) repost(ctx context.Context, uri string) error {
+	subject, err := c.strongRef(ctx, uri)
+	if err != nil {
+		return fmt.Errorf("failed to fetch post: %w", err)
+	}
+
+	_, err = c.createRecord(ctx, "app.bsky.feed.repost", &bsky.FeedRepost{
+		LexiconTypeID: "app.bsky.feed.repost",
+		CreatedAt:     time.Now().UTC().Format(time.RFC3339),
+		Subject:       subject,
+	})
+	return err
+}
+
+// deleteRecord deletes the record at uri, which must be in the session's
+// repo.
+func (c *repoClient) deleteRecord(ctx context.Context, uri string) error {
+	repo, collection, rkey, err := parseRecordURI(uri)
+	if err != nil {
+		return err
+	}
+	if repo != c.did {
+		return fmt.Errorf("record %s is not in the repo of %s", uri, c.did)
+	}
+	_, err = atproto.RepoDeleteRecord(ctx, c.xrpc, &atproto.RepoDeleteRecord_Input{
+		Collection: collection,
+		Repo:       repo,
+		Rkey:       rkey,
+	})
+	return err
+}
+
+func (c *repoClient) createRecord(ctx context.Context, collection string, record lexutil.CBOR) (string, error) {
+	out, err := atproto.RepoCreateRecord(ctx, c.xrpc, &atproto.RepoCreateRecord_Input{
+		Collection: collection,
+		Repo:       c.did,
+		Record:     &lexutil.LexiconTypeDecoder{Val: record},
+	})
+	if err != nil {
+		return "", err
+	}
+	return out.Uri, nil
+}
+
+// parseRecordURI splits an at://<repo>/<collection>/<rkey> URI.
+func parseRecordURI(uri string) (repo, collection, rkey string, err error) {
+	parts := strings.Split(strings.TrimPrefix(uri, "at://"), "/")
+	if !strings.HasPrefix(uri, "at://") || len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		return "", "", "", fmt.Errorf("invalid record URI %q", uri)
+	}
+	return parts[0], parts[1], parts[2], nil
+}
+
+var (
+	linkPattern    = regexp.MustCompile(`https?://[^\s<>"]+`)
+	hashtagPattern = regexp.MustCompile(`(?:^|\s)(#[^\d\s#][^\s#]*)`)
+)
+
+// facets returns the link and hashtag facets of text, indexed by byte
+// offset. Trailing punctuation is not part of a link or hashtag.
+func facets(text string) []*bsky.RichtextFacet {
+	var out []*bsky.RichtextFacet
+	add := func(start, end int, feature *bsky.RichtextFacet_Features_Elem) {
+		out = append(out, &bsky.RichtextFacet{
+			Index:    &bsky.RichtextFacet_ByteSlice{ByteStart: int64(start), ByteEnd: int64(end)},
+			Features: []*bsky.RichtextFacet_Features_Elem{feature},
+		})
+	}
+
+	for _, m := range linkPattern.FindAllStringIndex(text, -1) {
+		link := strings.TrimRight(text[m[0]:m[1]], ".,;:!?)'")
+		add(m[0], m[0]+len(link), &bsky.RichtextFacet_Features_Elem{
+			RichtextFacet_Link: &bsky.RichtextFacet_Link{LexiconTypeID: "app.bsky.richtext.facet#link", Uri: link},
+		})
+	}
+	for _, m := range hashtagPattern.FindAllStringSubmatchIndex(text, -1) {
+		tag := strings.TrimRight(text[m[2]:m[3]], ".,;:!?)'\"")
+		if len(tag) < 2 {
+			continue
+		}
+		add(m[2], m[2]+len(tag), &bsky.RichtextFacet_Features_Elem{
+			RichtextFacet_Tag: &bsky.RichtextFacet_Tag{LexiconTypeID: "app.bsky.richtext.facet#tag", Tag: tag[1:]},
+		})
+	}
+	return out
+}
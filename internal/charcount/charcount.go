@@ -0,0 +1,181 @@
+// Package charcount measures post length the way each social network does,
+// so that content can be checked against per-network limits before it is
+// published.
+//
+// Bluesky limits posts to 300 graphemes, Mastodon to 500 characters with
+// every link counted as 23 characters, and Threads to 500 characters.
+package charcount
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// MastodonURLLength is the number of characters Mastodon counts for every
+// link, regardless of its actual length.
+const MastodonURLLength = 23
+
+// Limits are the maximum post lengths of each network, in the units returned
+// by Count.
+var Limits = map[string]int{
+	"mastodon": 500,
+	"bluesky":  300,
+	"threads":  500,
+}
+
+// WarnRatio is the fraction of a network's limit above which a post is
+// considered close to the limit.
+const WarnRatio = 0.9
+
+// urlPattern matches the http(s) links Mastodon shortens when counting.
+var urlPattern = regexp.MustCompile(`https?://[^\s<>"]+`)
+
+const (
+	zeroWidthJoiner = '\u200d'
+	// regionalIndicatorA..Z are paired into a single flag grapheme.
+	regionalIndicatorA = '\U0001F1E6'
+	regionalIndicatorZ = '\U0001F1FF'
+)
+
+// Graphemes returns an approximation of the number of user-perceived
+// characters (extended grapheme clusters) in s. Combining marks, variation
+// selectors, emoji modifiers and zero-width-joiner sequences are counted as
+// part of the preceding character and regional indicator pairs as a single
+// flag.
+func Graphemes(s string) int {
+	count := 0
+	joinNext := false
+	pendingIndicator := false
+	for _, r := range s {
+		switch {
+		case joinNext:
+			joinNext = false
+		case r == zeroWidthJoiner:
+			joinNext = count > 0
+		case extendsPrevious(r):
+			if count == 0 {
+				count++
+			}
+		case r >= regionalIndicatorA && r <= regionalIndicatorZ:
+			if pendingIndicator {
+				pendingIndicator = false
+			} else {
+				pendingIndicator = true
+				count++
+			}
+		default:
+			pendingIndicator = false
+			count++
+		}
+	}
+	return count
+}
+
+// extendsPrevious reports whether r is displayed as part of the preceding
+// character rather than on its own.
+func extendsPrevious(r rune) bool {
+	return unicode.In(r, unicode.Mn, unicode.Me) ||
+		(r >= '\ufe00' && r <= '\ufe0f') || // variation selectors
+		(r >= '\U0001F3FB' && r <= '\U0001F3FF') || // emoji skin tone modifiers
+		(r >= '\U000E0020' && r <= '\U000E007F') // emoji tag sequences
+}
+
+// Mastodon returns the length of s as counted by Mastodon: every link counts
+// as MastodonURLLength characters and everything else by code point.
+func Mastodon(s string) int {
+	count := 0
+	last := 0
+	for _, loc := range urlPattern.FindAllStringIndex(s, -1) {
+		count += utf8.RuneCountInString(s[last:loc[0]]) + MastodonURLLength
+		last = loc[1]
+	}
+	return count + utf8.RuneCountInString(s[last:])
+}
+
+// Count returns the length of s as counted by site. Unknown sites count code
+// points.
+func Count(site, s string) int {
+	switch site {
+	case "mastodon":
+		return Mastodon(s)
+	case "bluesky":
+		return Graphemes(s)
+	}
+	return utf8.RuneCountInString(s)
+}
+
+// Ellipsis is appended to truncated posts.
+const Ellipsis = "…"
+
+// Truncate shortens s so that its length as counted by site, including a
+// trailing Ellipsis, fits within limit. Links are never cut: a link that does
+// not fit is dropped along with everything after it. Because Mastodon counts
+// every link as MastodonURLLength characters, long links do not cause
+// unnecessary truncation there. A non-positive limit returns s unchanged.
+func Truncate(site, s string, limit int) string {
+	if limit <= 0 || Count(site, s) <= limit {
+		return s
+	}
+
+	fits := func(prefix string) bool {
+		return Count(site, prefix+Ellipsis) <= limit
+	}
+
+	var b strings.Builder
+	last := 0
+	segments := append(urlPattern.FindAllStringIndex(s, -1), []int{len(s), len(s)})
+	for _, loc := range segments {
+		for _, r := range s[last:loc[0]] {
+			if !fits(b.String() + string(r)) {
+				return strings.TrimRightFunc(b.String(), unicode.IsSpace) + Ellipsis
+			}
+			b.WriteRune(r)
+		}
+		if url := s[loc[0]:loc[1]]; url != "" {
+			if !fits(b.String() + url) {
+				return strings.TrimRightFunc(b.String(), unicode.IsSpace) + Ellipsis
+			}
+			b.WriteString(url)
+		}
+		last = loc[1]
+	}
+	return b.String()
+}
+
+// Analysis is the length of a post on a single network compared to that
+// network's limit.
+type Analysis struct {
+	Site  string
+	Count int
+	// Limit is zero for networks without a known limit.
+	Limit int
+}
+
+// Analyze measures s for site.
+func Analyze(site, s string) Analysis {
+	return Analysis{Site: site, Count: Count(site, s), Limit: Limits[site]}
+}
+
+// Over reports whether the post exceeds the network's limit.
+func (a Analysis) Over() bool {
+	return a.Limit > 0 && a.Count > a.Limit
+}
+
+// NearLimit reports whether the post is within the limit but uses more than
+// WarnRatio of it.
+func (a Analysis) NearLimit() bool {
+	return a.Limit > 0 && !a.Over() && float64(a.Count) > float64(a.Limit)*WarnRatio
+}
+
+// Status returns "over", "near limit" or "ok".
+func (a Analysis) Status() string {
+	switch {
+	case a.Over():
+		return "over"
+	case a.NearLimit():
+		return "near limit"
+	}
+	return "ok"
+}
@@ -0,0 +1,78 @@
+package charcount
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGraphemes(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want int
+	}{
+		{name: "ASCII", in: "hello", want: 5},
+		{name: "Empty", in: "", want: 0},
+		{name: "Accented code points", in: "café", want: 4},
+		{name: "Combining mark", in: "cafe\u0301", want: 4},
+		{name: "Emoji with skin tone", in: "👍🏽", want: 1},
+		{name: "ZWJ family", in: "\U0001F468\u200d\U0001F469\u200d\U0001F467", want: 1},
+		{name: "Flags", in: "🇩🇪🇫🇷", want: 2},
+		{name: "Variation selector", in: "\u2764\ufe0f!", want: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, Graphemes(tt.in))
+		})
+	}
+}
+
+func TestMastodon(t *testing.T) {
+	long := "https://example.com/" + strings.Repeat("a", 100)
+	assert.Equal(t, len("New post: ")+MastodonURLLength, Mastodon("New post: "+long))
+	assert.Equal(t, 2*MastodonURLLength+1, Mastodon("http://a.b https://c.d/e"))
+	assert.Equal(t, 5, Mastodon("héllo"))
+}
+
+func TestAnalyze(t *testing.T) {
+	ok := Analyze("bluesky", "short")
+	assert.Equal(t, Analysis{Site: "bluesky", Count: 5, Limit: 300}, ok)
+	assert.Equal(t, "ok", ok.Status())
+
+	near := Analyze("bluesky", strings.Repeat("a", 280))
+	assert.True(t, near.NearLimit())
+	assert.Equal(t, "near limit", near.Status())
+
+	over := Analyze("bluesky", strings.Repeat("a", 301))
+	assert.True(t, over.Over())
+	assert.False(t, over.NearLimit())
+	assert.Equal(t, "over", over.Status())
+
+	unknown := Analyze("unknown", strings.Repeat("a", 10000))
+	assert.Equal(t, "ok", unknown.Status())
+}
+
+func TestTruncate(t *testing.T) {
+	long := "https://example.com/" + strings.Repeat("a", 100)
+
+	// Unchanged when within the limit, even though the raw length is over
+	// it, because Mastodon counts the link as 23 characters.
+	post := "New post: " + long
+	assert.Equal(t, post, Truncate("mastodon", post, 40))
+
+	// Text is cut before the link would overflow; links are never cut.
+	post = strings.Repeat("word ", 10) + long
+	assert.Equal(t, "word word word word word word…", Truncate("mastodon", post, 30))
+	assert.Equal(t, strings.Repeat("word ", 10)+long, Truncate("mastodon", post, 50+MastodonURLLength))
+	assert.Equal(t, strings.TrimSpace(strings.Repeat("word ", 10))+"…", Truncate("mastodon", post, 50+MastodonURLLength-1))
+
+	// Bluesky counts links at full length.
+	got := Truncate("bluesky", "Read "+long, 50)
+	assert.Equal(t, "Read…", got)
+	assert.LessOrEqual(t, Graphemes(got), 50)
+
+	assert.Equal(t, "abc", Truncate("mastodon", "abc", 0))
+}
@@ -0,0 +1,102 @@
+// Package configcrypt encrypts and decrypts the .env file with age or GPG,
+// so that credentials are not stored in plaintext on shared hosts. It uses
+// the age and gpg tools, which must be installed.
+//
+// With age, the key is an age identity ("AGE-SECRET-KEY-1..."), and files
+// are encrypted to its recipient. With GPG, the key is a passphrase, and
+// files are encrypted symmetrically with AES-256.
+package configcrypt
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Formats of encrypted files, which are also their file extensions.
+const (
+	FormatAge = "age"
+	FormatGPG = "gpg"
+)
+
+// Format returns the format of the encrypted file path from its extension,
+// or an empty string when path is not encrypted.
+func Format(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case "." + FormatAge:
+		return FormatAge
+	case "." + FormatGPG, ".asc":
+		return FormatGPG
+	}
+	return ""
+}
+
+// Encrypt encrypts the file in to the file out in format with key.
+func Encrypt(format, key, in, out string) error {
+	if key == "" {
+		return errors.New("no encryption key")
+	}
+	switch format {
+	case FormatAge:
+		recipient, err := run(key, "age-keygen", "-y")
+		if err != nil {
+			return fmt.Errorf("invalid age identity: %w", err)
+		}
+		if _, err := run("", "age", "--encrypt", "--recipient", strings.TrimSpace(string(recipient)), "--output", out, in); err != nil {
+			return fmt.Errorf("failed to encrypt %s with age: %w", in, err)
+		}
+	case FormatGPG:
+		if _, err := run(key+"\n", "gpg", append(gpgArgs, "--yes", "--symmetric", "--cipher-algo", "AES256", "--output", out, in)...); err != nil {
+			return fmt.Errorf("failed to encrypt %s with gpg: %w", in, err)
+		}
+	default:
+		return fmt.Errorf("unknown encryption format %q", format)
+	}
+	return nil
+}
+
+// Decrypt returns the decrypted content of the encrypted file path, whose
+// format is told by its extension.
+func Decrypt(key, path string) ([]byte, error) {
+	if key == "" {
+		return nil, errors.New("no decryption key")
+	}
+	var out []byte
+	var err error
+	switch Format(path) {
+	case FormatAge:
+		out, err = run(key, "age", "--decrypt", "--identity", "-", path)
+	case FormatGPG:
+		out, err = run(key+"\n", "gpg", append(gpgArgs, "--decrypt", path)...)
+	default:
+		return nil, fmt.Errorf("%s is not an .age or .gpg file", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt %s: %w", path, err)
+	}
+	return out, nil
+}
+
+// gpgArgs make gpg read the passphrase from the first line of standard
+// input, without prompting.
+var gpgArgs = []string{"--batch", "--quiet", "--pinentry-mode", "loopback", "--passphrase-fd", "0"}
+
+// run runs the command name with args, writing stdin to its standard input,
+// and returns its standard output. It is replaceable in tests.
+var run = func(stdin, name string, args ...string) ([]byte, error) {
+	cmd := exec.Command(name, args...) // #nosec G204 -- the tools are fixed, the arguments are passed without a shell
+	cmd.Stdin = strings.NewReader(stdin)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%s: %w: %s", name, err, msg)
+		}
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return out, nil
+}
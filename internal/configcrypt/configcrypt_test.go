@@ -0,0 +1,78 @@
+package configcrypt
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormat(t *testing.T) {
+	assert.Equal(t, FormatAge, Format(".env.age"))
+	assert.Equal(t, FormatGPG, Format("/etc/rss2socials/.env.GPG"))
+	assert.Equal(t, FormatGPG, Format(".env.asc"))
+	assert.Empty(t, Format(".env"))
+}
+
+func TestAge(t *testing.T) {
+	type call struct {
+		stdin string
+		args  []string
+	}
+	var calls []call
+	original := run
+	run = func(stdin, name string, args ...string) ([]byte, error) {
+		calls = append(calls, call{stdin: stdin, args: append([]string{name}, args...)})
+		if name == "age-keygen" {
+			return []byte("age1recipient\n"), nil
+		}
+		return []byte("MASTODON_ACCESS_TOKEN=token\n"), nil
+	}
+	defer func() { run = original }()
+
+	require.NoError(t, Encrypt(FormatAge, "AGE-SECRET-KEY-1X", ".env", ".env.age"))
+	got, err := Decrypt("AGE-SECRET-KEY-1X", ".env.age")
+	require.NoError(t, err)
+	assert.Equal(t, "MASTODON_ACCESS_TOKEN=token\n", string(got))
+
+	// The identity is only ever passed on standard input.
+	assert.Equal(t, []call{
+		{stdin: "AGE-SECRET-KEY-1X", args: []string{"age-keygen", "-y"}},
+		{args: []string{"age", "--encrypt", "--recipient", "age1recipient", "--output", ".env.age", ".env"}},
+		{stdin: "AGE-SECRET-KEY-1X", args: []string{"age", "--decrypt", "--identity", "-", ".env.age"}},
+	}, calls)
+}
+
+func TestGPG_RoundTrip(t *testing.T) {
+	if _, err := exec.LookPath("gpg"); err != nil {
+		t.Skip("gpg is not installed")
+	}
+	t.Setenv("GNUPGHOME", t.TempDir())
+	dir := t.TempDir()
+	in := filepath.Join(dir, ".env")
+	require.NoError(t, os.WriteFile(in, []byte("GOTIFY_TOKEN=secret\n"), 0o600))
+
+	require.NoError(t, Encrypt(FormatGPG, "correct horse", in, in+".gpg"))
+	encrypted, err := os.ReadFile(in + ".gpg")
+	require.NoError(t, err)
+	assert.NotContains(t, string(encrypted), "secret")
+
+	got, err := Decrypt("correct horse", in+".gpg")
+	require.NoError(t, err)
+	assert.Equal(t, "GOTIFY_TOKEN=secret\n", string(got))
+
+	_, err = Decrypt("wrong", in+".gpg")
+	assert.Error(t, err)
+}
+
+func TestErrors(t *testing.T) {
+	assert.Error(t, Encrypt(FormatAge, "", ".env", ".env.age"))
+	assert.Error(t, Encrypt("zip", "key", ".env", ".env.zip"))
+	_, err := Decrypt("", ".env.age")
+	assert.Error(t, err)
+	_, err = Decrypt("key", ".env")
+	assert.Error(t, err)
+}
@@ -0,0 +1,181 @@
+package content
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// minParagraphChars is the shortest paragraph that counts towards the
+// score of its container; shorter ones are usually captions or bylines.
+const minParagraphChars = 25
+
+var (
+	// positiveClass and negativeClass match class and id attributes of
+	// elements that are likely, or unlikely, to hold the article.
+	positiveClass = regexp.MustCompile(`(?i)article|body|content|entry|main|page|post|text|blog|story`)
+	negativeClass = regexp.MustCompile(`(?i)comment|footer|foot|sidebar|side|nav|menu|share|social|related|promo|advert|\bads?\b|banner|meta|widget|cookie|popup|subscribe`)
+
+	// unlikelyElements never contain article text.
+	unlikelyElements = map[atom.Atom]bool{
+		atom.Script: true, atom.Style: true, atom.Noscript: true, atom.Nav: true,
+		atom.Header: true, atom.Footer: true, atom.Aside: true, atom.Form: true,
+		atom.Iframe: true, atom.Svg: true, atom.Button: true, atom.Select: true,
+	}
+
+	// paragraphElements are the blocks whose text makes up the article.
+	paragraphElements = map[atom.Atom]bool{
+		atom.P: true, atom.Pre: true, atom.Blockquote: true, atom.Li: true,
+		atom.H2: true, atom.H3: true, atom.H4: true,
+	}
+)
+
+// FetchArticle fetches the page at url and returns its main text, see
+// ExtractArticle.
+func FetchArticle(ctx context.Context, url string) (string, error) {
+	page, err := fetchPage(ctx, url)
+	if err != nil {
+		return "", err
+	}
+	return ExtractArticle(bytes.NewReader(page))
+}
+
+// ExtractArticle returns the main text of the HTML page read from r as
+// paragraphs separated by blank lines, or "" when no article was found.
+//
+// It is a simplified readability algorithm: every paragraph scores its
+// parent, and half as much its grandparent, by its length and number of
+// commas; containers whose class or id hint at the article, or at
+// navigation and comments, are weighted accordingly; and the paragraphs of
+// the best scoring container are returned.
+func ExtractArticle(r io.Reader) (string, error) {
+	doc, err := html.Parse(r)
+	if err != nil {
+		return "", err
+	}
+
+	scores := make(map[*html.Node]float64)
+	var order []*html.Node
+	addScore := func(n *html.Node, score float64) {
+		if n == nil || n.Type != html.ElementNode {
+			return
+		}
+		if _, ok := scores[n]; !ok {
+			order = append(order, n)
+			scores[n] = classWeight(n)
+		}
+		scores[n] += score
+	}
+
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && (unlikelyElements[n.DataAtom] || isUnlikelyCandidate(n)) {
+			return
+		}
+		if n.Type == html.ElementNode && n.DataAtom == atom.P {
+			text := nodeText(n)
+			if chars := utf8.RuneCountInString(text); chars >= minParagraphChars {
+				score := 1 + float64(strings.Count(text, ",")) + min(float64(chars)/100, 3)
+				addScore(n.Parent, score)
+				if n.Parent != nil {
+					addScore(n.Parent.Parent, score/2)
+				}
+			}
+			return
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+
+	var best *html.Node
+	for _, n := range order {
+		if best == nil || scores[n] > scores[best] {
+			best = n
+		}
+	}
+	if best == nil {
+		return "", nil
+	}
+
+	var paragraphs []string
+	var collect func(*html.Node)
+	collect = func(n *html.Node) {
+		if n.Type == html.ElementNode && unlikelyElements[n.DataAtom] {
+			return
+		}
+		if n.Type == html.ElementNode && paragraphElements[n.DataAtom] {
+			if text := nodeText(n); text != "" {
+				paragraphs = append(paragraphs, text)
+			}
+			return
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			collect(c)
+		}
+	}
+	collect(best)
+	return strings.Join(paragraphs, "\n\n"), nil
+}
+
+// classWeight is the initial score of a container, from its class and id.
+func classWeight(n *html.Node) float64 {
+	var weight float64
+	if n.DataAtom == atom.Article || n.DataAtom == atom.Main {
+		weight += 10
+	}
+	for _, a := range n.Attr {
+		if a.Key != "class" && a.Key != "id" {
+			continue
+		}
+		if negativeClass.MatchString(a.Val) {
+			weight -= 25
+		}
+		if positiveClass.MatchString(a.Val) {
+			weight += 25
+		}
+	}
+	return weight
+}
+
+// isUnlikelyCandidate reports whether n is a container that is unlikely to
+// hold the article, such as a comment section, judging by its class and id.
+func isUnlikelyCandidate(n *html.Node) bool {
+	if n.DataAtom == atom.Body || n.DataAtom == atom.Article || n.DataAtom == atom.Main {
+		return false
+	}
+	for _, a := range n.Attr {
+		if (a.Key == "class" || a.Key == "id") && negativeClass.MatchString(a.Val) && !positiveClass.MatchString(a.Val) {
+			return true
+		}
+	}
+	return false
+}
+
+// nodeText returns the text of n with runs of whitespace collapsed.
+func nodeText(n *html.Node) string {
+	var b strings.Builder
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			b.WriteString(n.Data)
+			b.WriteByte(' ')
+			return
+		}
+		if n.Type == html.ElementNode && unlikelyElements[n.DataAtom] {
+			return
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return strings.Join(strings.Fields(b.String()), " ")
+}
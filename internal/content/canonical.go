@@ -0,0 +1,50 @@
+package content
+
+import (
+	"context"
+	"html"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+var (
+	linkTagPattern  = regexp.MustCompile(`(?is)<link\s[^>]*>`)
+	linkAttrPattern = regexp.MustCompile(`(?is)\b(rel|href)\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s>]+))`)
+)
+
+// CanonicalURL fetches the page at rawURL and returns the URL of its
+// <link rel="canonical"> tag, resolved against the URL the page was served
+// from, or "" when it has none or it is not an http(s) URL.
+func CanonicalURL(ctx context.Context, rawURL string) (string, error) {
+	page, base, err := fetchPageURL(ctx, rawURL)
+	if err != nil {
+		return "", err
+	}
+
+	for _, tag := range linkTagPattern.FindAllString(string(page), -1) {
+		var rel, href string
+		for _, m := range linkAttrPattern.FindAllStringSubmatch(tag, -1) {
+			v := html.UnescapeString(m[2] + m[3] + m[4])
+			if strings.EqualFold(m[1], "rel") {
+				rel = strings.ToLower(v)
+			} else {
+				href = strings.TrimSpace(v)
+			}
+		}
+		if !slices.Contains(strings.Fields(rel), "canonical") || href == "" {
+			continue
+		}
+		ref, err := url.Parse(href)
+		if err != nil {
+			return "", nil
+		}
+		canonical := base.ResolveReference(ref)
+		if canonical.Scheme != "http" && canonical.Scheme != "https" {
+			return "", nil
+		}
+		return canonical.String(), nil
+	}
+	return "", nil
+}
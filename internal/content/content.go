@@ -0,0 +1,208 @@
+// Package content selects the text of a feed item that post templates see
+// as .Content. Feeds differ in where they put an article's text: some only
+// have a summary in description, others the full article in
+// content:encoded, and some nothing useful at all, in which case an excerpt
+// of the article page can be used.
+package content
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/toozej/rss2socials/internal/posttemplate"
+	"github.com/toozej/rss2socials/internal/rss"
+	"github.com/toozej/rss2socials/pkg/config"
+)
+
+// Content sources, in the form they are configured in.
+const (
+	// Description is the item's description element.
+	Description = "description"
+	// Encoded is the item's content:encoded element.
+	Encoded = "content:encoded"
+	// Title is the item's title.
+	Title = "title"
+	// Page is the description of the article page the item links to, from
+	// its description or og:description meta tag.
+	Page = "page"
+	// Article is the main text of the article page the item links to,
+	// extracted with a readability algorithm.
+	Article = "article"
+)
+
+// maxPageSize caps how much of an article page is read looking for its
+// excerpt.
+const maxPageSize = 2 << 20
+
+// Client is the HTTP client used to fetch article pages.
+var Client = &http.Client{Timeout: 10 * time.Second}
+
+// Cache keeps the text fetched from the pages of items for the Page and
+// Article sources, so that the pages of items selected again, e.g. while
+// they wait to be published, are not fetched every time. key identifies
+// the item, see rss.RSSItem.Key.
+type Cache interface {
+	Get(key, source string) (text string, ok bool)
+	Put(key, source, text string)
+}
+
+// Validate reports whether every source in sources is known.
+func Validate(sources []string) error {
+	for _, source := range sources {
+		switch source {
+		case Description, Encoded, Title, Page, Article:
+		default:
+			return fmt.Errorf("unknown content source %q, known are %s, %s, %s, %s and %s", source, Description, Encoded, Title, Page, Article)
+		}
+	}
+	return nil
+}
+
+func init() {
+	config.RegisterCheck(func(conf config.Config) []config.Problem {
+		if err := Validate(conf.ContentSources); err != nil {
+			return []config.Problem{{Var: "CONTENT_SOURCES", Message: err.Error(), Example: "content:encoded,description"}}
+		}
+		return nil
+	})
+}
+
+// Select returns the first source of item's content with at least minChars
+// characters of text, trying sources in order, or the first non-empty one
+// when none is that long. An empty sources selects the description. Pages
+// are looked up in cache first, unless it is nil.
+func Select(ctx context.Context, sources []string, minChars int, item rss.RSSItem, cache Cache) string {
+	if len(sources) == 0 {
+		return item.Content
+	}
+	var fallback string
+	for _, source := range sources {
+		var text string
+		switch source {
+		case Description:
+			text = item.Content
+		case Encoded:
+			text = item.Encoded
+		case Title:
+			text = item.Title
+		case Page:
+			text = cached(cache, item, Page, func() (string, error) {
+				excerpt, err := PageExcerpt(ctx, item.Link)
+				if err != nil {
+					log.Warnf("Error fetching page excerpt of %s: %v", item.Link, err)
+				}
+				return excerpt, err
+			})
+		case Article:
+			text = cached(cache, item, Article, func() (string, error) {
+				article, err := FetchArticle(ctx, item.Link)
+				if err != nil {
+					log.Warnf("Error fetching article %s: %v", item.Link, err)
+				}
+				return article, err
+			})
+		}
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+		if utf8.RuneCountInString(posttemplate.StripHTML(text)) >= minChars {
+			return text
+		}
+		if fallback == "" {
+			fallback = text
+		}
+	}
+	return fallback
+}
+
+// cached returns the text of source for item from cache, or else fetches
+// it and, unless that failed, caches it.
+func cached(cache Cache, item rss.RSSItem, source string, fetch func() (string, error)) string {
+	if cache == nil {
+		text, _ := fetch()
+		return text
+	}
+	if text, ok := cache.Get(item.Key(), source); ok {
+		return text
+	}
+	text, err := fetch()
+	if err == nil {
+		cache.Put(item.Key(), source, text)
+	}
+	return text
+}
+
+var (
+	metaTagPattern  = regexp.MustCompile(`(?is)<meta\s[^>]*>`)
+	metaAttrPattern = regexp.MustCompile(`(?is)\b(name|property|content)\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s>]+))`)
+)
+
+// PageExcerpt fetches the page at url and returns its description meta
+// tag, preferring og:description, or "" when it has none.
+func PageExcerpt(ctx context.Context, url string) (string, error) {
+	page, err := fetchPage(ctx, url)
+	if err != nil {
+		return "", err
+	}
+
+	var description string
+	for _, tag := range metaTagPattern.FindAllString(string(page), -1) {
+		var name, value string
+		for _, m := range metaAttrPattern.FindAllStringSubmatch(tag, -1) {
+			v := html.UnescapeString(m[2] + m[3] + m[4])
+			if strings.EqualFold(m[1], "content") {
+				value = v
+			} else {
+				name = strings.ToLower(v)
+			}
+		}
+		switch name {
+		case "og:description":
+			return strings.TrimSpace(value), nil
+		case "description":
+			if description == "" {
+				description = strings.TrimSpace(value)
+			}
+		}
+	}
+	return description, nil
+}
+
+// fetchPage returns the first maxPageSize bytes of the page at url.
+func fetchPage(ctx context.Context, url string) ([]byte, error) {
+	page, _, err := fetchPageURL(ctx, url)
+	return page, err
+}
+
+// fetchPageURL returns the first maxPageSize bytes of the page at rawURL,
+// and the URL it was served from after redirects.
+func fetchPageURL(ctx context.Context, rawURL string) ([]byte, *url.URL, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	resp, err := Client.Do(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("HTTP request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("unexpected HTTP status: %d", resp.StatusCode)
+	}
+	page, err := io.ReadAll(io.LimitReader(resp.Body, maxPageSize))
+	return page, resp.Request.URL, err
+}
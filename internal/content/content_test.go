@@ -0,0 +1,221 @@
+package content
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/toozej/rss2socials/internal/rss"
+	"github.com/toozej/rss2socials/pkg/config"
+)
+
+func TestValidate(t *testing.T) {
+	assert.NoError(t, Validate(nil))
+	assert.NoError(t, Validate([]string{Encoded, Description, Title, Page}))
+	assert.ErrorContains(t, Validate([]string{"summary"}), `unknown content source "summary"`)
+
+	conf, _ := config.Config{ContentSources: []string{"summary"}}.WithDefaults()
+	assert.Equal(t, []string{Description}, conf.ContentSources, "unknown sources are replaced with the default")
+}
+
+func TestSelect(t *testing.T) {
+	item := rss.RSSItem{Title: "Title", Content: "Summary", Encoded: "<p>Full text</p>"}
+
+	assert.Equal(t, "Summary", Select(context.Background(), nil, 0, item, nil))
+	assert.Equal(t, "<p>Full text</p>", Select(context.Background(), []string{Encoded, Description}, 0, item, nil))
+	assert.Equal(t, "Title", Select(context.Background(), []string{Title}, 0, item, nil))
+
+	item.Encoded = "  "
+	assert.Equal(t, "Summary", Select(context.Background(), []string{Encoded, Description}, 0, item, nil), "empty sources are skipped")
+	item.Content = ""
+	assert.Equal(t, "", Select(context.Background(), []string{Encoded, Description}, 0, item, nil))
+}
+
+func TestSelect_Page(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/og":
+			fmt.Fprint(w, `<html><head>
+<meta name="description" content="Plain description">
+<meta content='Open &amp; Graph' property="og:description">
+</head></html>`)
+		case "/plain":
+			fmt.Fprint(w, `<meta name=description content="Plain description">`)
+		case "/none":
+			fmt.Fprint(w, `<html><body>No meta</body></html>`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	sources := []string{Page, Title}
+	assert.Equal(t, "Open & Graph", Select(context.Background(), sources, 0, rss.RSSItem{Title: "T", Link: srv.URL + "/og"}, nil))
+	assert.Equal(t, "Plain description", Select(context.Background(), sources, 0, rss.RSSItem{Title: "T", Link: srv.URL + "/plain"}, nil))
+	assert.Equal(t, "T", Select(context.Background(), sources, 0, rss.RSSItem{Title: "T", Link: srv.URL + "/none"}, nil))
+	assert.Equal(t, "T", Select(context.Background(), sources, 0, rss.RSSItem{Title: "T", Link: srv.URL + "/missing"}, nil), "fetch errors fall through")
+
+	_, err := PageExcerpt(context.Background(), srv.URL+"/missing")
+	require.Error(t, err)
+}
+
+// mapCache is a Cache in a map.
+type mapCache map[string]string
+
+func (c mapCache) Get(key, source string) (string, bool) {
+	text, ok := c[key+" "+source]
+	return text, ok
+}
+
+func (c mapCache) Put(key, source, text string) { c[key+" "+source] = text }
+
+func TestSelect_Cache(t *testing.T) {
+	var fetches int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, `<meta name="description" content="Excerpt">`)
+	}))
+	defer srv.Close()
+
+	cache := mapCache{}
+	sources := []string{Page, Title}
+	item := rss.RSSItem{Title: "T", Link: srv.URL + "/post", GUID: "post-1"}
+	assert.Equal(t, "Excerpt", Select(context.Background(), sources, 0, item, cache))
+	assert.Equal(t, "Excerpt", Select(context.Background(), sources, 0, item, cache))
+	assert.Equal(t, 1, fetches, "the page is fetched once")
+	assert.Equal(t, mapCache{"post-1 page": "Excerpt"}, cache, "results are keyed by the guid")
+
+	missing := rss.RSSItem{Title: "T", Link: srv.URL + "/missing"}
+	assert.Equal(t, "T", Select(context.Background(), sources, 0, missing, cache))
+	assert.Equal(t, "T", Select(context.Background(), sources, 0, missing, cache))
+	assert.Equal(t, 3, fetches, "failed fetches are not cached")
+}
+
+const articlePage = `<html><head><title>Post</title><script>var x = "not, text, at, all, really";</script></head>
+<body>
+<nav><p>Home, About, Archive, Contact, Subscribe, Imprint</p></nav>
+<div class="sidebar"><p>Popular posts, recent comments, tags, and more links here.</p></div>
+<article class="post">
+  <h1>Post</h1>
+  <p>The first paragraph of the article, with enough text to count.</p>
+  <p>The second paragraph, which goes on about the topic, at length.</p>
+  <p>Short.</p>
+  <ul><li>A list item of the article</li></ul>
+</article>
+<div id="comments"><p>Great post, thanks for writing it, I learned a lot!</p></div>
+<footer><p>Copyright, all rights reserved, powered by something.</p></footer>
+</body></html>`
+
+func TestExtractArticle(t *testing.T) {
+	got, err := ExtractArticle(strings.NewReader(articlePage))
+	require.NoError(t, err)
+	assert.Equal(t, "The first paragraph of the article, with enough text to count.\n\n"+
+		"The second paragraph, which goes on about the topic, at length.\n\n"+
+		"Short.\n\n"+
+		"A list item of the article", got)
+
+	got, err = ExtractArticle(strings.NewReader(`<html><body><p>Too short.</p></body></html>`))
+	require.NoError(t, err)
+	assert.Empty(t, got)
+}
+
+func TestSelect_ArticleForShortSummaries(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, articlePage)
+	}))
+	defer srv.Close()
+
+	sources := []string{Description, Article}
+	short := rss.RSSItem{Link: srv.URL, Content: "<p>One line.</p>"}
+	assert.Contains(t, Select(context.Background(), sources, 40, short, nil), "The first paragraph of the article")
+	assert.Equal(t, "<p>One line.</p>", Select(context.Background(), sources, 0, short, nil), "without a minimum the summary is used")
+
+	long := rss.RSSItem{Link: srv.URL, Content: strings.Repeat("A long summary. ", 5)}
+	assert.Equal(t, long.Content, Select(context.Background(), sources, 40, long, nil))
+
+	short.Link = srv.URL + "\x00"
+	assert.Equal(t, short.Content, Select(context.Background(), sources, 40, short, nil), "the first non-empty source is the fallback")
+}
+
+func TestCheckPage(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/live":
+			fmt.Fprint(w, `<html><head><title>A post</title></head></html>`)
+		case "/soft":
+			fmt.Fprint(w, `<html><head><title>Oops! Page Not Found</title></head></html>`)
+		case "/moved":
+			http.Redirect(w, r, "/", http.StatusFound)
+		case "/":
+			fmt.Fprint(w, `<html><head><title>Home</title></head></html>`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	soft404 := []string{"page not found"}
+	require.NoError(t, CheckPage(context.Background(), srv.URL+"/live", soft404))
+	require.NoError(t, CheckPage(context.Background(), srv.URL+"/", soft404), "the home page itself is live")
+
+	err := CheckPage(context.Background(), srv.URL+"/missing", soft404)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "404")
+
+	err = CheckPage(context.Background(), srv.URL+"/soft", soft404)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "soft 404")
+	require.NoError(t, CheckPage(context.Background(), srv.URL+"/soft", nil), "without phrases titles are not checked")
+
+	err = CheckPage(context.Background(), srv.URL+"/moved", soft404)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "redirected")
+}
+
+func TestCanonicalURL(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/absolute":
+			fmt.Fprint(w, `<html><head><link rel="stylesheet" href="/style.css"><link rel="canonical" href="https://blog.example.com/post?a=1&amp;b=2"></head></html>`)
+		case "/relative":
+			fmt.Fprint(w, `<link href='/posts/hello' rel='Canonical'>`)
+		case "/proxy":
+			http.Redirect(w, r, "/relative", http.StatusFound)
+		case "/none":
+			fmt.Fprint(w, `<html><head><title>No canonical</title></head></html>`)
+		case "/unsafe":
+			fmt.Fprint(w, `<link rel="canonical" href="javascript:alert(1)">`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	got, err := CanonicalURL(ctx, srv.URL+"/absolute")
+	require.NoError(t, err)
+	assert.Equal(t, "https://blog.example.com/post?a=1&b=2", got)
+
+	got, err = CanonicalURL(ctx, srv.URL+"/proxy")
+	require.NoError(t, err)
+	assert.Equal(t, srv.URL+"/posts/hello", got, "relative URLs are resolved against the page after redirects")
+
+	for _, path := range []string{"/none", "/unsafe"} {
+		got, err = CanonicalURL(ctx, srv.URL+path)
+		require.NoError(t, err)
+		assert.Empty(t, got, path)
+	}
+
+	_, err = CanonicalURL(ctx, srv.URL+"/missing")
+	require.Error(t, err)
+}
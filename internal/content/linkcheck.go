@@ -0,0 +1,54 @@
+package content
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var titlePattern = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+
+// CheckPage fetches the page at url and returns an error describing why it
+// is not live: when it does not answer 200 OK, or is a soft 404, i.e. it
+// redirects to the home page of its site or its title contains one of the
+// soft404 phrases, ignoring case.
+func CheckPage(ctx context.Context, url string, soft404 []string) error {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("HTTP request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected HTTP status: %d", resp.StatusCode)
+	}
+	if final := resp.Request.URL; strings.Trim(final.Path, "/") == "" && strings.Trim(req.URL.Path, "/") != "" {
+		return fmt.Errorf("soft 404: redirected to %s", final)
+	}
+
+	page, err := io.ReadAll(io.LimitReader(resp.Body, maxPageSize))
+	if err != nil {
+		return fmt.Errorf("error reading page: %w", err)
+	}
+	if m := titlePattern.FindSubmatch(page); m != nil {
+		title := strings.TrimSpace(html.UnescapeString(string(m[1])))
+		for _, phrase := range soft404 {
+			if phrase = strings.TrimSpace(phrase); phrase != "" && strings.Contains(strings.ToLower(title), strings.ToLower(phrase)) {
+				return fmt.Errorf("soft 404: page title %q", title)
+			}
+		}
+	}
+	return nil
+}
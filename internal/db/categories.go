@@ -0,0 +1,68 @@
+package db
+
+import (
+	"slices"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// PostCategory is a category of a stored post, in lower case, to find the
+// earlier posts in the same category.
+type PostCategory struct {
+	Link     string `gorm:"primaryKey"`
+	Category string `gorm:"primaryKey;index"`
+}
+
+// SetCategories replaces the categories of the post with link.
+func SetCategories(link string, categories []string) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("link = ?", link).Delete(&PostCategory{}).Error; err != nil {
+			return err
+		}
+		rows := make([]PostCategory, 0, len(categories))
+		for _, category := range normalizeCategories(categories) {
+			rows = append(rows, PostCategory{Link: link, Category: category})
+		}
+		if len(rows) == 0 {
+			return nil
+		}
+		return tx.Create(&rows).Error
+	})
+}
+
+// LatestInCategories returns the post published to at least one site with
+// the latest pubDate among those in any of categories, other than exclude,
+// and reports whether there is one.
+func LatestInCategories(categories []string, exclude string) (TootedPost, bool, error) {
+	categories = normalizeCategories(categories)
+	if len(categories) == 0 {
+		return TootedPost{}, false, nil
+	}
+	var posts []TootedPost
+	err := DB.Model(&TootedPost{}).
+		Select("tooted_posts.link", "tooted_posts.bluesky_uri").
+		Joins("JOIN post_categories ON post_categories.link = tooted_posts.link").
+		Where("post_categories.category IN ? AND tooted_posts.link != ?", categories, exclude).
+		Where("mastodon_posted = ? OR bluesky_posted = ? OR threads_posted = ? OR newsletter_posted = ?", true, true, true, true).
+		Order("tooted_posts.published_at DESC, tooted_posts.first_seen DESC").
+		Limit(1).
+		Find(&posts).Error
+	if err != nil || len(posts) == 0 {
+		return TootedPost{}, false, err
+	}
+	return posts[0], true, nil
+}
+
+// normalizeCategories returns categories trimmed, in lower case and without
+// duplicates or empty ones.
+func normalizeCategories(categories []string) []string {
+	var out []string
+	for _, category := range categories {
+		category = strings.ToLower(strings.TrimSpace(category))
+		if category != "" && !slices.Contains(out, category) {
+			out = append(out, category)
+		}
+	}
+	return out
+}
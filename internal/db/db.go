@@ -1,7 +1,11 @@
 package db
 
 import (
+	"bytes"
+	"compress/gzip"
+	"database/sql"
 	"fmt"
+	"io"
 	"os"
 	"time"
 
@@ -14,38 +18,153 @@ import (
 )
 
 type TootedPost struct {
-	Link           string `gorm:"primaryKey"`
-	ContentHash    string
-	Timestamp      string
-	StartupTime    string
-	MastodonPosted bool `gorm:"default:false"`
-	BlueskyPosted  bool `gorm:"default:false"`
-	ThreadsPosted  bool `gorm:"default:false"`
+	Link        string `gorm:"primaryKey"`
+	ContentHash string
+	// Content is the content the post was last stored with, compressed
+	// with CompressContent, to describe what an update changed.
+	// PreviousContent is the content it replaced, to tell why an update was
+	// detected. Both are empty for posts stored by older versions or with
+	// storing content disabled.
+	Content         []byte
+	PreviousContent []byte
+	Timestamp       string
+	StartupTime     string
+	MastodonPosted  bool `gorm:"default:false"`
+	BlueskyPosted   bool `gorm:"default:false"`
+	ThreadsPosted   bool `gorm:"default:false"`
+	// NewsletterPosted records that the post was emailed with
+	// Config.NewsletterProvider.
+	NewsletterPosted bool `gorm:"default:false"`
+	// MastodonStatusID is the ID of the Mastodon status, used to edit it.
+	MastodonStatusID string
+	// BlueskyURI is the at:// URI of the Bluesky post record, used to delete it.
+	BlueskyURI string
+	// ThreadsMediaID is the media ID of the Threads post, used to reply to
+	// or quote it.
+	ThreadsMediaID string
+	// NewsletterID is the ID of the Listmonk campaign or Buttondown email
+	// the post was sent as.
+	NewsletterID string
+	// MastodonVariant, BlueskyVariant and ThreadsVariant name the template
+	// variant the post was published with on each site, if any.
+	MastodonVariant string
+	BlueskyVariant  string
+	ThreadsVariant  string
+	// MastodonPinned records that the Mastodon status was pinned with
+	// MastodonPinLatest.
+	MastodonPinned bool `gorm:"default:false"`
+	// Repromoted records that the post has been boosted/reposted after
+	// RepromoteAfterDays.
+	Repromoted bool `gorm:"default:false"`
+	// PublishedAt is the item's parsed pubDate, or zero when the feed did not
+	// provide a parsable one.
+	PublishedAt time.Time
+	// FirstSeen is when the item was first stored.
+	FirstSeen time.Time
+	// FeedLink is the link of the item in the feed, when Link is its
+	// canonical URL; see SetFeedLink.
+	FeedLink string `gorm:"index"`
+	// LastPosted is when the item was last published or updated on any site.
+	LastPosted time.Time
 }
 
 var DB *gorm.DB
 
+// Content says how StoreTootedPost treats the content of posts.
+type Content struct {
+	// Hashing is how content is hashed to detect updates.
+	Hashing rss.Hashing
+	// Snapshots enables storing the content of posts, compressed, along
+	// with its hash. Without it, update announcements cannot describe what
+	// changed.
+	Snapshots bool
+}
+
+// DefaultContent hashes content with rss.DefaultHashing and stores
+// snapshots.
+var DefaultContent = Content{Hashing: rss.DefaultHashing, Snapshots: true}
+
 func InitDB(path ...string) {
-	var err error
-	dbPath := "./tooted_posts.db"
-	if len(path) > 0 && path[0] != "" {
-		dbPath = path[0]
-	} else if p := os.Getenv("DB_PATH"); p != "" {
-		dbPath = p
+	if err := Init(path...); err != nil {
+		log.Fatal(err)
 	}
+}
+
+// Init opens and migrates the database like InitDB, but returns an error
+// instead of exiting when the database cannot be opened or written to.
+func Init(path ...string) error {
+	dbPath := resolvePath(path...)
 
 	log.Debugf("Opening database at %s", dbPath)
-	DB, err = gorm.Open(sqlite.Open(dbPath), &gorm.Config{
-		Logger: logger.Default.LogMode(logger.Silent),
-	})
+	d, err := open(dbPath)
 	if err != nil {
-		log.Fatal("Failed to open database:", err)
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	if err := migrate(d); err != nil {
+		closeHandle(d)
+		return fmt.Errorf("failed to auto-migrate database: %w", err)
+	}
+	if err := checkWritable(d); err != nil {
+		closeHandle(d)
+		return fmt.Errorf("database %s is not writable: %w", dbPath, err)
 	}
+	DB = d
+	return nil
+}
 
-	err = DB.AutoMigrate(&TootedPost{})
+// InitMemory opens an empty database that only lives in memory, for running
+// when the database file is unavailable. Nothing stored in it survives
+// CloseDB.
+func InitMemory() error {
+	d, err := open(":memory:")
 	if err != nil {
-		log.Fatal("Failed to auto-migrate database:", err)
+		return err
+	}
+	// Every connection to :memory: is a database of its own.
+	sqlDB, err := d.DB()
+	if err != nil {
+		return err
+	}
+	sqlDB.SetMaxOpenConns(1)
+	if err := migrate(d); err != nil {
+		closeHandle(d)
+		return err
+	}
+	DB = d
+	return nil
+}
+
+// checkWritable writes the schema version back unchanged, which fails on a
+// database opened read-only, e.g. on a read-only filesystem. AutoMigrate
+// does not write to an up-to-date database, so it does not notice.
+func checkWritable(d *gorm.DB) error {
+	var version int
+	if err := d.Raw("PRAGMA user_version").Scan(&version).Error; err != nil {
+		return err
+	}
+	return d.Exec(fmt.Sprintf("PRAGMA user_version = %d", version)).Error
+}
+
+// resolvePath returns the database path: the given path, or else DB_PATH,
+// or else ./tooted_posts.db.
+func resolvePath(path ...string) string {
+	if len(path) > 0 && path[0] != "" {
+		return path[0]
 	}
+	if p := os.Getenv("DB_PATH"); p != "" {
+		return p
+	}
+	return "./tooted_posts.db"
+}
+
+func open(path string) (*gorm.DB, error) {
+	return gorm.Open(sqlite.Open(path), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+}
+
+func migrate(db *gorm.DB) error {
+	return db.AutoMigrate(&TootedPost{}, &Event{}, &Retry{}, &Lock{}, &Enrichment{}, &HighWater{}, &PostCategory{}, &SeriesPart{})
 }
 
 func CloseDB() {
@@ -60,33 +179,127 @@ func CloseDB() {
 	}
 }
 
-func StoreTootedPost(link string, content string, startupTime string) error {
-	contentHash := fmt.Sprintf("%x", rss.HashContent(content))
+// StoreTootedPost stores the post with link, first seen at now, or updates
+// its content hash, timestamp and startup time when it is already stored.
+// The content is hashed, and kept as a snapshot, as c says, and timestamps
+// are written in the time zone loc.
+func StoreTootedPost(link string, content string, startupTime string, now time.Time, c Content, loc *time.Location) error {
+	contentHash := c.Hashing.Hash(content)
+	now = now.In(loc)
 	post := TootedPost{
 		Link:        link,
 		ContentHash: contentHash,
-		Timestamp:   time.Now().Format(time.RFC3339),
+		Timestamp:   now.Format(time.RFC3339),
 		StartupTime: startupTime,
+		FirstSeen:   now,
+	}
+	if c.Snapshots {
+		post.Content = CompressContent(content)
+	}
+	// The snapshot an update replaces is kept as the previous content.
+	keepPrevious := clause.Assignment{
+		Column: clause.Column{Name: "previous_content"},
+		Value:  gorm.Expr("CASE WHEN tooted_posts.content_hash <> excluded.content_hash THEN tooted_posts.content ELSE tooted_posts.previous_content END"),
 	}
 	result := DB.Clauses(clause.OnConflict{
 		Columns:   []clause.Column{{Name: "link"}},
-		DoUpdates: clause.AssignmentColumns([]string{"content_hash", "timestamp", "startup_time"}),
+		DoUpdates: append(clause.Set{keepPrevious}, clause.AssignmentColumns([]string{"content_hash", "content", "timestamp", "startup_time"})...),
 	}).Create(&post)
 	return result.Error
 }
 
+// CompressContent compresses content for storing it as a snapshot, or
+// returns nil for empty content.
+func CompressContent(content string) []byte {
+	if content == "" {
+		return nil
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	// Writes to a bytes.Buffer do not fail.
+	_, _ = zw.Write([]byte(content))
+	_ = zw.Close()
+	return buf.Bytes()
+}
+
+// gzipMagic starts every snapshot made by CompressContent.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// DecompressContent returns the content of a snapshot made by
+// CompressContent. Content stored uncompressed by older versions is returned
+// as is.
+func DecompressContent(snapshot []byte) (string, error) {
+	if !bytes.HasPrefix(snapshot, gzipMagic) {
+		return string(snapshot), nil
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(snapshot))
+	if err != nil {
+		return "", fmt.Errorf("corrupt content snapshot: %w", err)
+	}
+	content, err := io.ReadAll(zr)
+	if err != nil {
+		return "", fmt.Errorf("corrupt content snapshot: %w", err)
+	}
+	return string(content), nil
+}
+
 var validSites = map[string]string{
-	"mastodon": "mastodon_posted",
-	"bluesky":  "bluesky_posted",
-	"threads":  "threads_posted",
+	"mastodon":   "mastodon_posted",
+	"bluesky":    "bluesky_posted",
+	"threads":    "threads_posted",
+	"newsletter": "newsletter_posted",
 }
 
-func MarkSitePosted(link string, site string) error {
+// MarkSitePosted records that the post with link was published to site at
+// now, written in the time zone loc.
+func MarkSitePosted(link string, site string, now time.Time, loc *time.Location) error {
 	column, ok := validSites[site]
 	if !ok {
 		return fmt.Errorf("unknown site: %s", site)
 	}
-	result := DB.Model(&TootedPost{}).Where("link = ?", link).Update(column, true)
+	result := DB.Model(&TootedPost{}).Where("link = ?", link).Updates(map[string]interface{}{
+		column:        true,
+		"last_posted": now.In(loc),
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("no post found with link: %s", link)
+	}
+	return nil
+}
+
+// SetPublishedAt stores the parsed pubDate of the item with the given link
+// in the time zone loc.
+func SetPublishedAt(link string, published time.Time, loc *time.Location) error {
+	result := DB.Model(&TootedPost{}).Where("link = ?", link).Update("published_at", published.In(loc))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("no post found with link: %s", link)
+	}
+	return nil
+}
+
+// FirstSeen returns when the item with the given link was first stored.
+func FirstSeen(link string) (time.Time, error) {
+	var post TootedPost
+	result := DB.Select("first_seen").Where("link = ?", link).Limit(1).Find(&post)
+	if result.Error != nil {
+		return time.Time{}, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return time.Time{}, fmt.Errorf("no post found with link: %s", link)
+	}
+	return post.FirstSeen, nil
+}
+
+// SetFeedLink records that the post stored under link appears in the feed
+// as feedLink, so that StoredLink finds it without resolving feedLink again.
+func SetFeedLink(link, feedLink string) error {
+	result := DB.Model(&TootedPost{}).Where("link = ?", link).Update("feed_link", feedLink)
 	if result.Error != nil {
 		return result.Error
 	}
@@ -96,6 +309,177 @@ func MarkSitePosted(link string, site string) error {
 	return nil
 }
 
+// StoredLink returns the link the item appearing in the feed as feedLink
+// is stored under: the link recorded by SetFeedLink, or feedLink itself for
+// posts stored under their feed link. It returns an empty string when the
+// item is not stored.
+func StoredLink(feedLink string) (string, error) {
+	var posts []TootedPost
+	if err := DB.Select("link").Where("feed_link = ?", feedLink).Limit(1).Find(&posts).Error; err != nil {
+		return "", err
+	}
+	if len(posts) == 0 {
+		if err := DB.Select("link").Where("link = ?", feedLink).Limit(1).Find(&posts).Error; err != nil {
+			return "", err
+		}
+	}
+	if len(posts) == 0 {
+		return "", nil
+	}
+	return posts[0].Link, nil
+}
+
+// SetMastodonPinned records whether the Mastodon status of link is pinned.
+func SetMastodonPinned(link string, pinned bool) error {
+	result := DB.Model(&TootedPost{}).Where("link = ?", link).Update("mastodon_pinned", pinned)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("no post found with link: %s", link)
+	}
+	return nil
+}
+
+// MastodonPinnedPosts returns the links of the posts whose Mastodon status
+// is recorded as pinned.
+func MastodonPinnedPosts() ([]string, error) {
+	var links []string
+	err := DB.Model(&TootedPost{}).Where("mastodon_pinned = ?", true).Order("first_seen").Pluck("link", &links).Error
+	return links, err
+}
+
+// ListPosts returns up to limit stored posts, most recently first seen first.
+// A non-positive limit returns every post.
+func ListPosts(limit int) ([]TootedPost, error) {
+	var posts []TootedPost
+	query := DB.Order("first_seen DESC").Order("timestamp DESC")
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	err := query.Find(&posts).Error
+	return posts, err
+}
+
+// Sites returns the sites the post has been published to.
+func (p TootedPost) Sites() []string {
+	var sites []string
+	if p.MastodonPosted {
+		sites = append(sites, "mastodon")
+	}
+	if p.BlueskyPosted {
+		sites = append(sites, "bluesky")
+	}
+	if p.ThreadsPosted {
+		sites = append(sites, "threads")
+	}
+	if p.NewsletterPosted {
+		sites = append(sites, "newsletter")
+	}
+	return sites
+}
+
+// sitePostIDColumns maps sites to the column storing the identifier of the
+// post created on that site.
+var sitePostIDColumns = map[string]string{
+	"mastodon":   "mastodon_status_id",
+	"bluesky":    "bluesky_uri",
+	"threads":    "threads_media_id",
+	"newsletter": "newsletter_id",
+}
+
+// siteVariantColumns maps sites to the column storing the template variant
+// the post was published with on that site.
+var siteVariantColumns = map[string]string{
+	"mastodon": "mastodon_variant",
+	"bluesky":  "bluesky_variant",
+	"threads":  "threads_variant",
+}
+
+// SetSiteVariant stores the name of the template variant link was published
+// with on site.
+func SetSiteVariant(link, site, variant string) error {
+	column, ok := siteVariantColumns[site]
+	if !ok {
+		return nil
+	}
+	result := DB.Model(&TootedPost{}).Where("link = ?", link).Update(column, variant)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("no post found with link: %s", link)
+	}
+	return nil
+}
+
+// SetSitePostID stores the identifier of the post created on site for link.
+// Sites that do not support stored identifiers are ignored.
+func SetSitePostID(link string, site string, id string) error {
+	column, ok := sitePostIDColumns[site]
+	if !ok {
+		return nil
+	}
+	result := DB.Model(&TootedPost{}).Where("link = ?", link).Update(column, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("no post found with link: %s", link)
+	}
+	return nil
+}
+
+// SitePostID returns the stored identifier of the post created on site for
+// link, or an empty string when none was recorded.
+func SitePostID(link string, site string) (string, error) {
+	column, ok := sitePostIDColumns[site]
+	if !ok {
+		return "", fmt.Errorf("unknown site: %s", site)
+	}
+	var ids []sql.NullString
+	if err := DB.Model(&TootedPost{}).Where("link = ?", link).Pluck(column, &ids).Error; err != nil {
+		return "", err
+	}
+	if len(ids) == 0 {
+		return "", fmt.Errorf("no post found with link: %s", link)
+	}
+	return ids[0].String, nil
+}
+
+// StoredContent returns the content the post with link was last stored
+// with, or an empty string when it is not stored or was stored without its
+// content.
+func StoredContent(link string) (string, error) {
+	var post TootedPost
+	result := DB.Select("content").Where("link = ?", link).Limit(1).Find(&post)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return "", result.Error
+	}
+	return DecompressContent(post.Content)
+}
+
+// ContentSnapshots returns the content the post with link was last stored
+// with and the content that one replaced, for debugging why an update was
+// detected. Either is empty when it was not stored.
+func ContentSnapshots(link string) (current, previous string, err error) {
+	var post TootedPost
+	result := DB.Select("content", "previous_content").Where("link = ?", link).Limit(1).Find(&post)
+	if result.Error != nil {
+		return "", "", result.Error
+	}
+	if result.RowsAffected == 0 {
+		return "", "", fmt.Errorf("no post found with link: %s", link)
+	}
+	if current, err = DecompressContent(post.Content); err != nil {
+		return "", "", err
+	}
+	if previous, err = DecompressContent(post.PreviousContent); err != nil {
+		return "", "", err
+	}
+	return current, previous, nil
+}
+
 func IsSitePosted(link string, site string) (bool, error) {
 	column, ok := validSites[site]
 	if !ok {
@@ -117,13 +501,17 @@ func IsSitePosted(link string, site string) (bool, error) {
 		return post.BlueskyPosted, nil
 	case "threads":
 		return post.ThreadsPosted, nil
+	case "newsletter":
+		return post.NewsletterPosted, nil
 	}
 	return false, fmt.Errorf("unknown site: %s", site)
 }
 
-func HasPostChanged(link string, content string) (exists bool, updated bool, err error) {
+// HasPostChanged reports whether the post with link is stored and, if so,
+// whether content hashed with h differs from the stored hash.
+func HasPostChanged(link string, content string, h rss.Hashing) (exists bool, updated bool, err error) {
 	var post TootedPost
-	result := DB.Select("content_hash").Where("link = ?", link).First(&post)
+	result := DB.Select("content_hash", "content").Where("link = ?", link).First(&post)
 	if result.Error == gorm.ErrRecordNotFound {
 		return false, false, nil
 	}
@@ -131,11 +519,97 @@ func HasPostChanged(link string, content string) (exists bool, updated bool, err
 		return false, false, result.Error
 	}
 
-	newHash := fmt.Sprintf("%x", rss.HashContent(content))
-	if post.ContentHash != newHash {
-		return true, true, nil
+	newHash := h.Hash(content)
+	if post.ContentHash == "" {
+		// Posts rebuilt from the event log have no content hash; adopt the
+		// current content instead of treating it as an update.
+		err := DB.Model(&TootedPost{}).Where("link = ?", link).Update("content_hash", newHash).Error
+		return true, false, err
+	}
+	if !h.Comparable(post.ContentHash) {
+		// The hash was made with other hashing settings. Rehash the stored
+		// snapshot, or adopt the current content when there is none, rather
+		// than taking every post for updated.
+		rehashed := newHash
+		if snapshot, err := DecompressContent(post.Content); err == nil && snapshot != "" {
+			rehashed = h.Hash(snapshot)
+		}
+		err := DB.Model(&TootedPost{}).Where("link = ?", link).Update("content_hash", rehashed).Error
+		return true, rehashed != newHash, err
 	}
-	return true, false, nil
+	return true, post.ContentHash != newHash, nil
+}
+
+// UnpublishedPosts returns the links of stored posts that have not been
+// marked as posted to any site and for which no attempt or outcome was
+// recorded, neither an event nor a retry. These are the posts that were in
+// flight when the previous process was stopped or crashed between storing
+// the post and publishing it; posts that failed, were skipped or were held
+// back are left out.
+func UnpublishedPosts() ([]string, error) {
+	var links []string
+	err := DB.Model(&TootedPost{}).
+		Where("mastodon_posted = ? AND bluesky_posted = ? AND threads_posted = ? AND newsletter_posted = ?", false, false, false, false).
+		Where("NOT EXISTS (SELECT 1 FROM events WHERE events.link = tooted_posts.link AND events.action <> ?)", ActionFetched).
+		Where("NOT EXISTS (SELECT 1 FROM retries WHERE retries.link = tooted_posts.link)").
+		Pluck("link", &links).Error
+	return links, err
+}
+
+// CountPublished returns the number of posts published to at least one
+// site.
+func CountPublished() (int, error) {
+	var n int64
+	err := DB.Model(&TootedPost{}).
+		Where("mastodon_posted = ? OR bluesky_posted = ? OR threads_posted = ? OR newsletter_posted = ?", true, true, true, true).
+		Count(&n).Error
+	return int(n), err
+}
+
+// PostsToRepromote returns the links of posts that have not been re-promoted
+// yet, were published at or before publishedBefore and have a stored
+// Mastodon status ID or Bluesky URI to boost or repost. The published time
+// is PublishedAt, or FirstSeen for items without a pubDate; the timestamp,
+// which every update rewrites, is only used for rows stored without either.
+func PostsToRepromote(publishedBefore time.Time) ([]string, error) {
+	var posts []TootedPost
+	err := DB.Select("link", "timestamp", "published_at", "first_seen").
+		Where("repromoted = ?", false).
+		Where("COALESCE(mastodon_status_id, '') != '' OR COALESCE(bluesky_uri, '') != ''").
+		Find(&posts).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var links []string
+	for _, post := range posts {
+		published := post.PublishedAt
+		if published.IsZero() {
+			published = post.FirstSeen
+		}
+		if published.IsZero() {
+			if published, err = time.Parse(time.RFC3339, post.Timestamp); err != nil {
+				log.Warnf("Unparsable timestamp %q for %s: %v", post.Timestamp, post.Link, err)
+				continue
+			}
+		}
+		if !published.After(publishedBefore) {
+			links = append(links, post.Link)
+		}
+	}
+	return links, nil
+}
+
+// MarkRepromoted records that the post with the given link was re-promoted.
+func MarkRepromoted(link string) error {
+	result := DB.Model(&TootedPost{}).Where("link = ?", link).Update("repromoted", true)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("no post found with link: %s", link)
+	}
+	return nil
 }
 
 func IsFirstCycle() bool {
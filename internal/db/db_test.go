@@ -2,10 +2,15 @@ package db
 
 import (
 	"os"
+	"path"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/toozej/rss2socials/internal/rss"
 )
 
 func TestInitDB(t *testing.T) {
@@ -49,7 +54,7 @@ func TestStoreTootedPost_NewPost(t *testing.T) {
 	defer CloseDB()
 	defer os.Remove("./tooted_posts.db")
 
-	err := StoreTootedPost("https://example.com/test-post", "Test post content", "2026-01-01T00:00:00Z")
+	err := StoreTootedPost("https://example.com/test-post", "Test post content", "2026-01-01T00:00:00Z", time.Now(), DefaultContent, time.Local)
 	assert.NoError(t, err)
 
 	var post TootedPost
@@ -65,16 +70,180 @@ func TestStoreTootedPost_UpdateExisting(t *testing.T) {
 	defer CloseDB()
 	defer os.Remove("./tooted_posts.db")
 
-	err := StoreTootedPost("https://example.com/test-post", "Original content", "2026-01-01T00:00:00Z")
+	err := StoreTootedPost("https://example.com/test-post", "Original content", "2026-01-01T00:00:00Z", time.Now(), DefaultContent, time.Local)
 	require.NoError(t, err)
 
-	err = StoreTootedPost("https://example.com/test-post", "Updated content", "2026-01-02T00:00:00Z")
+	err = StoreTootedPost("https://example.com/test-post", "Updated content", "2026-01-02T00:00:00Z", time.Now(), DefaultContent, time.Local)
 	assert.NoError(t, err)
 
 	var post TootedPost
 	result := DB.Where("link = ?", "https://example.com/test-post").First(&post)
 	assert.NoError(t, result.Error)
 	assert.Equal(t, "2026-01-02T00:00:00Z", post.StartupTime)
+
+	content, err := StoredContent("https://example.com/test-post")
+	require.NoError(t, err)
+	assert.Equal(t, "Updated content", content)
+	content, err = StoredContent("https://example.com/missing")
+	require.NoError(t, err)
+	assert.Empty(t, content)
+}
+
+func TestContentSnapshots(t *testing.T) {
+	InitDB()
+	defer CloseDB()
+	defer os.Remove("./tooted_posts.db")
+	link := "https://example.com/snapshot-post"
+
+	require.NoError(t, StoreTootedPost(link, "Original content.", "2026-01-01T00:00:00Z", time.Now(), DefaultContent, time.Local))
+	current, previous, err := ContentSnapshots(link)
+	require.NoError(t, err)
+	assert.Equal(t, "Original content.", current)
+	assert.Empty(t, previous)
+
+	require.NoError(t, StoreTootedPost(link, "Original content. More.", "2026-01-02T00:00:00Z", time.Now(), DefaultContent, time.Local))
+	// Storing unchanged content keeps the previous snapshot.
+	require.NoError(t, StoreTootedPost(link, "Original content. More.", "2026-01-03T00:00:00Z", time.Now(), DefaultContent, time.Local))
+	current, previous, err = ContentSnapshots(link)
+	require.NoError(t, err)
+	assert.Equal(t, "Original content. More.", current)
+	assert.Equal(t, "Original content.", previous)
+
+	var post TootedPost
+	require.NoError(t, DB.Where("link = ?", link).First(&post).Error)
+	assert.NotEqual(t, []byte(current), post.Content, "content is stored compressed")
+
+	_, _, err = ContentSnapshots("https://example.com/missing")
+	assert.Error(t, err)
+}
+
+func TestStoreTootedPost_WithoutSnapshots(t *testing.T) {
+	InitDB()
+	defer CloseDB()
+	defer os.Remove("./tooted_posts.db")
+	hashOnly := Content{Hashing: rss.DefaultHashing}
+
+	require.NoError(t, StoreTootedPost("https://example.com/hash-only", "content", "2026-01-01T00:00:00Z", time.Now(), hashOnly, time.Local))
+	content, err := StoredContent("https://example.com/hash-only")
+	require.NoError(t, err)
+	assert.Empty(t, content)
+	exists, updated, err := HasPostChanged("https://example.com/hash-only", "edited", rss.DefaultHashing)
+	require.NoError(t, err)
+	assert.True(t, exists)
+	assert.True(t, updated)
+}
+
+func TestDecompressContent(t *testing.T) {
+	content, err := DecompressContent(CompressContent("some content"))
+	require.NoError(t, err)
+	assert.Equal(t, "some content", content)
+
+	// Content stored uncompressed by older versions is returned as is.
+	content, err = DecompressContent([]byte("plain content"))
+	require.NoError(t, err)
+	assert.Equal(t, "plain content", content)
+
+	_, err = DecompressContent([]byte{0x1f, 0x8b, 0x00})
+	assert.Error(t, err)
+}
+
+func TestHasPostChanged_RehashesAfterHashingChange(t *testing.T) {
+	InitDB()
+	defer CloseDB()
+	defer os.Remove("./tooted_posts.db")
+	bare := rss.Hashing{Algorithm: rss.HashSHA256}
+
+	require.NoError(t, StoreTootedPost("https://example.com/snapshot", "<p>Content.</p>", "2026-01-01T00:00:00Z", time.Now(), Content{Hashing: bare, Snapshots: true}, time.Local))
+	require.NoError(t, StoreTootedPost("https://example.com/edited", "<p>Content.</p>", "2026-01-01T00:00:00Z", time.Now(), Content{Hashing: bare, Snapshots: true}, time.Local))
+	require.NoError(t, StoreTootedPost("https://example.com/hash-only", "<p>Content.</p>", "2026-01-01T00:00:00Z", time.Now(), Content{Hashing: bare}, time.Local))
+
+	_, updated, err := HasPostChanged("https://example.com/snapshot", `<p class="new">Content.</p>`, rss.DefaultHashing)
+	require.NoError(t, err)
+	assert.False(t, updated, "a cosmetic change is no update under the new hashing")
+	_, updated, err = HasPostChanged("https://example.com/edited", "<p>Content. More.</p>", rss.DefaultHashing)
+	require.NoError(t, err)
+	assert.True(t, updated, "the stored snapshot is rehashed to detect real updates")
+	_, updated, err = HasPostChanged("https://example.com/hash-only", "<p>Content. More.</p>", rss.DefaultHashing)
+	require.NoError(t, err)
+	assert.False(t, updated, "without a snapshot the current content is adopted")
+
+	var post TootedPost
+	require.NoError(t, DB.Where("link = ?", "https://example.com/hash-only").First(&post).Error)
+	assert.True(t, rss.DefaultHashing.Comparable(post.ContentHash))
+}
+
+func TestCountPublished(t *testing.T) {
+	InitDB(filepath.Join(t.TempDir(), "count.db"))
+	defer CloseDB()
+
+	require.NoError(t, StoreTootedPost("https://example.com/a", "a", "2026-01-01T00:00:00Z", time.Now(), DefaultContent, time.Local))
+	require.NoError(t, StoreTootedPost("https://example.com/b", "b", "2026-01-01T00:00:00Z", time.Now(), DefaultContent, time.Local))
+	require.NoError(t, StoreTootedPost("https://example.com/c", "c", "2026-01-01T00:00:00Z", time.Now(), DefaultContent, time.Local))
+	require.NoError(t, MarkSitePosted("https://example.com/a", "mastodon", time.Now(), time.Local))
+	require.NoError(t, MarkSitePosted("https://example.com/a", "bluesky", time.Now(), time.Local))
+	require.NoError(t, MarkSitePosted("https://example.com/b", "threads", time.Now(), time.Local))
+
+	n, err := CountPublished()
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+}
+
+func TestFirstSeen(t *testing.T) {
+	InitDB(filepath.Join(t.TempDir(), "seen.db"))
+	defer CloseDB()
+
+	before := time.Now().Add(-time.Second)
+	require.NoError(t, StoreTootedPost("https://example.com/a", "a", "2026-01-01T00:00:00Z", time.Now(), DefaultContent, time.Local))
+	seen, err := FirstSeen("https://example.com/a")
+	require.NoError(t, err)
+	assert.True(t, seen.After(before), seen)
+
+	require.NoError(t, StoreTootedPost("https://example.com/a", "changed", "2026-01-01T00:00:00Z", time.Now(), DefaultContent, time.Local))
+	again, err := FirstSeen("https://example.com/a")
+	require.NoError(t, err)
+	assert.True(t, again.Equal(seen), "storing the post again keeps when it was first seen")
+
+	_, err = FirstSeen("https://example.com/missing")
+	require.Error(t, err)
+}
+
+func TestStoredLink(t *testing.T) {
+	InitDB(filepath.Join(t.TempDir(), "links.db"))
+	defer CloseDB()
+
+	canonical, feedLink := "https://example.com/post", "https://proxy.example.net/~r/post"
+	stored, err := StoredLink(feedLink)
+	require.NoError(t, err)
+	assert.Empty(t, stored)
+
+	require.NoError(t, StoreTootedPost(canonical, "content", "2026-01-01T00:00:00Z", time.Now(), DefaultContent, time.Local))
+	require.NoError(t, SetFeedLink(canonical, feedLink))
+	stored, err = StoredLink(feedLink)
+	require.NoError(t, err)
+	assert.Equal(t, canonical, stored)
+
+	require.NoError(t, StoreTootedPost("https://example.com/legacy", "content", "2026-01-01T00:00:00Z", time.Now(), DefaultContent, time.Local))
+	stored, err = StoredLink("https://example.com/legacy")
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com/legacy", stored, "posts stored under their feed link are found too")
+
+	require.Error(t, SetFeedLink("https://example.com/missing", feedLink))
+}
+
+func TestMastodonPinned(t *testing.T) {
+	InitDB(filepath.Join(t.TempDir(), "pins.db"))
+	defer CloseDB()
+
+	require.NoError(t, StoreTootedPost("https://example.com/a", "a", "2026-01-01T00:00:00Z", time.Now(), DefaultContent, time.Local))
+	require.NoError(t, StoreTootedPost("https://example.com/b", "b", "2026-01-01T00:00:00Z", time.Now(), DefaultContent, time.Local))
+	require.NoError(t, SetMastodonPinned("https://example.com/a", true))
+	require.NoError(t, SetMastodonPinned("https://example.com/b", true))
+	require.NoError(t, SetMastodonPinned("https://example.com/a", false))
+
+	links, err := MastodonPinnedPosts()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"https://example.com/b"}, links)
+	require.Error(t, SetMastodonPinned("https://example.com/missing", true))
 }
 
 func TestHasPostChanged_NewPost(t *testing.T) {
@@ -82,7 +251,7 @@ func TestHasPostChanged_NewPost(t *testing.T) {
 	defer CloseDB()
 	defer os.Remove("./tooted_posts.db")
 
-	exists, updated, err := HasPostChanged("https://example.com/test-post-2", "Test post 2 content")
+	exists, updated, err := HasPostChanged("https://example.com/test-post-2", "Test post 2 content", rss.DefaultHashing)
 	assert.NoError(t, err)
 	assert.False(t, exists, "Expected post to be new")
 	assert.False(t, updated, "Expected post to be new, not updated")
@@ -93,10 +262,10 @@ func TestHasPostChanged_UpdatedPost(t *testing.T) {
 	defer CloseDB()
 	defer os.Remove("./tooted_posts.db")
 
-	err := StoreTootedPost("https://example.com/test-post", "Original content", "2026-01-01T00:00:00Z")
+	err := StoreTootedPost("https://example.com/test-post", "Original content", "2026-01-01T00:00:00Z", time.Now(), DefaultContent, time.Local)
 	require.NoError(t, err)
 
-	exists, updated, err := HasPostChanged("https://example.com/test-post", "Updated content")
+	exists, updated, err := HasPostChanged("https://example.com/test-post", "Updated content", rss.DefaultHashing)
 	assert.NoError(t, err)
 	assert.True(t, exists, "Expected post to exist")
 	assert.True(t, updated, "Expected post to be updated")
@@ -107,10 +276,10 @@ func TestHasPostChanged_UnchangedPost(t *testing.T) {
 	defer CloseDB()
 	defer os.Remove("./tooted_posts.db")
 
-	err := StoreTootedPost("https://example.com/test-post", "Test post content", "2026-01-01T00:00:00Z")
+	err := StoreTootedPost("https://example.com/test-post", "Test post content", "2026-01-01T00:00:00Z", time.Now(), DefaultContent, time.Local)
 	require.NoError(t, err)
 
-	exists, updated, err := HasPostChanged("https://example.com/test-post", "Test post content")
+	exists, updated, err := HasPostChanged("https://example.com/test-post", "Test post content", rss.DefaultHashing)
 	assert.NoError(t, err)
 	assert.True(t, exists, "Expected post to exist")
 	assert.False(t, updated, "Expected post to be unchanged")
@@ -121,7 +290,7 @@ func TestMarkSitePosted(t *testing.T) {
 	defer CloseDB()
 	defer os.Remove("./tooted_posts.db")
 
-	err := StoreTootedPost("https://example.com/mark-test", "content", "2026-01-01T00:00:00Z")
+	err := StoreTootedPost("https://example.com/mark-test", "content", "2026-01-01T00:00:00Z", time.Now(), DefaultContent, time.Local)
 	require.NoError(t, err)
 
 	sites := []string{"mastodon", "bluesky", "threads"}
@@ -130,7 +299,7 @@ func TestMarkSitePosted(t *testing.T) {
 		require.NoError(t, err)
 		assert.False(t, posted, "Expected %s to not be posted yet", site)
 
-		err = MarkSitePosted("https://example.com/mark-test", site)
+		err = MarkSitePosted("https://example.com/mark-test", site, time.Now(), time.Local)
 		require.NoError(t, err)
 
 		posted, err = IsSitePosted("https://example.com/mark-test", site)
@@ -144,10 +313,10 @@ func TestMarkSitePosted_UnknownSite(t *testing.T) {
 	defer CloseDB()
 	defer os.Remove("./tooted_posts.db")
 
-	err := StoreTootedPost("https://example.com/test", "content", "2026-01-01T00:00:00Z")
+	err := StoreTootedPost("https://example.com/test", "content", "2026-01-01T00:00:00Z", time.Now(), DefaultContent, time.Local)
 	require.NoError(t, err)
 
-	err = MarkSitePosted("https://example.com/test", "unknown_site")
+	err = MarkSitePosted("https://example.com/test", "unknown_site", time.Now(), time.Local)
 	assert.Error(t, err, "Expected error for unknown site")
 }
 
@@ -156,7 +325,7 @@ func TestMarkSitePosted_NonExistentLink(t *testing.T) {
 	defer CloseDB()
 	defer os.Remove("./tooted_posts.db")
 
-	err := MarkSitePosted("https://example.com/nonexistent", "mastodon")
+	err := MarkSitePosted("https://example.com/nonexistent", "mastodon", time.Now(), time.Local)
 	assert.Error(t, err, "Expected error when marking non-existent link")
 }
 
@@ -184,10 +353,10 @@ func TestMarkSitePosted_Independence(t *testing.T) {
 	defer CloseDB()
 	defer os.Remove("./tooted_posts.db")
 
-	err := StoreTootedPost("https://example.com/indep-test", "content", "2026-01-01T00:00:00Z")
+	err := StoreTootedPost("https://example.com/indep-test", "content", "2026-01-01T00:00:00Z", time.Now(), DefaultContent, time.Local)
 	require.NoError(t, err)
 
-	err = MarkSitePosted("https://example.com/indep-test", "mastodon")
+	err = MarkSitePosted("https://example.com/indep-test", "mastodon", time.Now(), time.Local)
 	require.NoError(t, err)
 
 	mastodonPosted, err := IsSitePosted("https://example.com/indep-test", "mastodon")
@@ -208,17 +377,17 @@ func TestStoreTootedPost_PreservesSiteFlagsOnConflict(t *testing.T) {
 	defer CloseDB()
 	defer os.Remove("./tooted_posts.db")
 
-	err := StoreTootedPost("https://example.com/reset-test", "original", "2026-01-01T00:00:00Z")
+	err := StoreTootedPost("https://example.com/reset-test", "original", "2026-01-01T00:00:00Z", time.Now(), DefaultContent, time.Local)
 	require.NoError(t, err)
 
-	err = MarkSitePosted("https://example.com/reset-test", "mastodon")
+	err = MarkSitePosted("https://example.com/reset-test", "mastodon", time.Now(), time.Local)
 	require.NoError(t, err)
 
 	mastodonPosted, err := IsSitePosted("https://example.com/reset-test", "mastodon")
 	require.NoError(t, err)
 	assert.True(t, mastodonPosted, "Expected mastodon to be posted after marking")
 
-	err = StoreTootedPost("https://example.com/reset-test", "updated content", "2026-01-02T00:00:00Z")
+	err = StoreTootedPost("https://example.com/reset-test", "updated content", "2026-01-02T00:00:00Z", time.Now(), DefaultContent, time.Local)
 	require.NoError(t, err)
 
 	mastodonPosted, err = IsSitePosted("https://example.com/reset-test", "mastodon")
@@ -233,7 +402,7 @@ func TestIsFirstCycle(t *testing.T) {
 
 	assert.True(t, IsFirstCycle(), "Expected IsFirstCycle() to be true on empty DB")
 
-	err := StoreTootedPost("https://example.com/first-cycle-test", "content", "2026-01-01T00:00:00Z")
+	err := StoreTootedPost("https://example.com/first-cycle-test", "content", "2026-01-01T00:00:00Z", time.Now(), DefaultContent, time.Local)
 	require.NoError(t, err)
 
 	assert.False(t, IsFirstCycle(), "Expected IsFirstCycle() to be false after storing a post")
@@ -244,7 +413,7 @@ func TestIsFirstCycle_AfterDelete(t *testing.T) {
 	defer CloseDB()
 	defer os.Remove("./tooted_posts.db")
 
-	err := StoreTootedPost("https://example.com/delete-test", "content", "2026-01-01T00:00:00Z")
+	err := StoreTootedPost("https://example.com/delete-test", "content", "2026-01-01T00:00:00Z", time.Now(), DefaultContent, time.Local)
 	require.NoError(t, err)
 	assert.False(t, IsFirstCycle())
 
@@ -259,15 +428,15 @@ func TestStoreTootedPost_ContentHashConsistency(t *testing.T) {
 
 	link := "https://example.com/hash-test"
 	content := "consistent content"
-	err := StoreTootedPost(link, content, "2026-01-01T00:00:00Z")
+	err := StoreTootedPost(link, content, "2026-01-01T00:00:00Z", time.Now(), DefaultContent, time.Local)
 	require.NoError(t, err)
 
-	exists, updated, err := HasPostChanged(link, content)
+	exists, updated, err := HasPostChanged(link, content, rss.DefaultHashing)
 	require.NoError(t, err)
 	assert.True(t, exists)
 	assert.False(t, updated, "Same content should not be detected as updated")
 
-	exists, updated, err = HasPostChanged(link, "different content")
+	exists, updated, err = HasPostChanged(link, "different content", rss.DefaultHashing)
 	require.NoError(t, err)
 	assert.True(t, exists)
 	assert.True(t, updated, "Different content should be detected as updated")
@@ -279,7 +448,7 @@ func TestMarkSitePosted_AllSitesSequentially(t *testing.T) {
 	defer os.Remove("./tooted_posts.db")
 
 	link := "https://example.com/all-sites"
-	err := StoreTootedPost(link, "content", "2026-01-01T00:00:00Z")
+	err := StoreTootedPost(link, "content", "2026-01-01T00:00:00Z", time.Now(), DefaultContent, time.Local)
 	require.NoError(t, err)
 
 	for _, site := range []string{"mastodon", "bluesky", "threads"} {
@@ -288,11 +457,11 @@ func TestMarkSitePosted_AllSitesSequentially(t *testing.T) {
 		assert.False(t, posted, "Expected %s to not be posted initially", site)
 	}
 
-	err = MarkSitePosted(link, "mastodon")
+	err = MarkSitePosted(link, "mastodon", time.Now(), time.Local)
 	require.NoError(t, err)
-	err = MarkSitePosted(link, "bluesky")
+	err = MarkSitePosted(link, "bluesky", time.Now(), time.Local)
 	require.NoError(t, err)
-	err = MarkSitePosted(link, "threads")
+	err = MarkSitePosted(link, "threads", time.Now(), time.Local)
 	require.NoError(t, err)
 
 	for _, site := range []string{"mastodon", "bluesky", "threads"} {
@@ -335,3 +504,405 @@ func TestMain(m *testing.M) {
 	os.Remove("./test_custom.db")
 	os.Exit(code)
 }
+
+func TestStoreTootedPost_UsesLocation(t *testing.T) {
+	InitDB()
+	defer CloseDB()
+	defer os.Remove("./tooted_posts.db")
+
+	loc := time.FixedZone("UTC+5", 5*60*60)
+	require.NoError(t, StoreTootedPost("https://example.com/tz-post", "content", "2026-01-01T00:00:00Z", time.Now(), DefaultContent, loc))
+
+	var post TootedPost
+	require.NoError(t, DB.Where("link = ?", "https://example.com/tz-post").First(&post).Error)
+	ts, err := time.Parse(time.RFC3339, post.Timestamp)
+	require.NoError(t, err)
+	_, offset := ts.Zone()
+	assert.Equal(t, 5*60*60, offset)
+}
+
+func TestUnpublishedPosts(t *testing.T) {
+	InitDB()
+	defer CloseDB()
+	defer os.Remove("./tooted_posts.db")
+
+	require.NoError(t, StoreTootedPost("https://example.com/posted", "a", "2026-01-01T00:00:00Z", time.Now(), DefaultContent, time.Local))
+	require.NoError(t, MarkSitePosted("https://example.com/posted", "bluesky", time.Now(), time.Local))
+	require.NoError(t, StoreTootedPost("https://example.com/in-flight", "b", "2026-01-01T00:00:00Z", time.Now(), DefaultContent, time.Local))
+	require.NoError(t, StoreTootedPost("https://example.com/failed", "c", "2026-01-01T00:00:00Z", time.Now(), DefaultContent, time.Local))
+	require.NoError(t, SaveRetry(Retry{Link: "https://example.com/failed", Site: "mastodon", Attempts: 1, Dead: true}, time.Local))
+	require.NoError(t, StoreTootedPost("https://example.com/held-back", "d", "2026-01-01T00:00:00Z", time.Now(), DefaultContent, time.Local))
+	require.NoError(t, RecordEvent(ActionHeldBack, "", "https://example.com/held-back", "link check", time.Now(), time.Local))
+	require.NoError(t, RecordEvent(ActionFetched, "", "https://example.com/in-flight", "1 items", time.Now(), time.Local))
+
+	links, err := UnpublishedPosts()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"https://example.com/in-flight"}, links)
+}
+
+func TestRecordEventAndEventsSince(t *testing.T) {
+	InitDB()
+	defer CloseDB()
+	defer os.Remove("./tooted_posts.db")
+
+	require.NoError(t, RecordEvent(ActionFetched, "", "https://example.com/rss", "2 items", time.Now(), time.Local))
+	require.NoError(t, RecordEvent(ActionPublished, "mastodon", "https://example.com/post", "", time.Now(), time.Local))
+	require.NoError(t, RecordEvent(ActionFailed, "bluesky", "https://example.com/post", "auth failed", time.Now(), time.Local))
+
+	events, err := EventsSince(time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+	require.Len(t, events, 3)
+	assert.Equal(t, "fetched", events[0].Label())
+	assert.Equal(t, "published-mastodon", events[1].Label())
+	assert.Equal(t, "failed-bluesky", events[2].Label())
+	assert.Equal(t, "auth failed", events[2].Detail)
+
+	events, err = EventsSince(time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	assert.Empty(t, events)
+}
+
+func TestPruneEvents(t *testing.T) {
+	InitDB()
+	defer CloseDB()
+	defer os.Remove("./tooted_posts.db")
+
+	require.NoError(t, DB.Create(&Event{Timestamp: time.Now().AddDate(0, 0, -40), Action: ActionFetched}).Error)
+	require.NoError(t, RecordEvent(ActionFetched, "", "", "", time.Now(), time.Local))
+
+	n, err := PruneEvents(time.Now().AddDate(0, 0, -30))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+
+	events, err := EventsSince(time.Time{})
+	require.NoError(t, err)
+	assert.Len(t, events, 1)
+}
+
+func TestLastEventTime(t *testing.T) {
+	InitDB()
+	defer CloseDB()
+	defer os.Remove("./tooted_posts.db")
+
+	last, err := LastEventTime(ActionCredentialsChecked, "threads")
+	require.NoError(t, err)
+	assert.True(t, last.IsZero())
+
+	checked := time.Now().AddDate(0, 0, -3).Truncate(time.Second)
+	require.NoError(t, DB.Create(&Event{Timestamp: checked.AddDate(0, 0, -7), Action: ActionCredentialsChecked, Site: "threads"}).Error)
+	require.NoError(t, DB.Create(&Event{Timestamp: checked, Action: ActionCredentialsChecked, Site: "threads"}).Error)
+	require.NoError(t, RecordEvent(ActionCredentialsChecked, "mastodon", "", "valid", time.Now(), time.Local))
+	require.NoError(t, RecordEvent(ActionPublished, "threads", "https://example.com/post", "", time.Now(), time.Local))
+
+	last, err = LastEventTime(ActionCredentialsChecked, "threads")
+	require.NoError(t, err)
+	assert.True(t, checked.Equal(last), "got %s, want %s", last, checked)
+}
+
+func TestEnrichments(t *testing.T) {
+	InitDB()
+	defer CloseDB()
+	defer os.Remove("./tooted_posts.db")
+
+	now := time.Now()
+	_, ok, err := CachedEnrichment("guid-1", "article", now.Add(-time.Hour))
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	require.NoError(t, SaveEnrichment("guid-1", "article", "old text", now.Add(-2*time.Hour), time.Local))
+	_, ok, err = CachedEnrichment("guid-1", "article", now.Add(-time.Hour))
+	require.NoError(t, err)
+	assert.False(t, ok, "results fetched before since are expired")
+
+	require.NoError(t, SaveEnrichment("guid-1", "article", "new text", now, time.Local))
+	require.NoError(t, SaveEnrichment("guid-1", "canonical", "", now.Add(-2*time.Hour), time.Local))
+	value, ok, err := CachedEnrichment("guid-1", "article", now.Add(-time.Hour))
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "new text", value, "saving replaces the earlier result")
+
+	n, err := PruneEnrichments(now.Add(-time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+	_, ok, err = CachedEnrichment("guid-1", "canonical", time.Time{})
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestHighWaterMark(t *testing.T) {
+	InitDB()
+	defer CloseDB()
+	defer os.Remove("./tooted_posts.db")
+
+	feed := "https://example.com/feed.xml"
+	mark, err := HighWaterMark(feed)
+	require.NoError(t, err)
+	assert.True(t, mark.IsZero())
+
+	published := time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC)
+	require.NoError(t, RaiseHighWaterMark(feed, published, time.Local))
+	require.NoError(t, RaiseHighWaterMark(feed, published.Add(-time.Hour), time.Local))
+	mark, err = HighWaterMark(feed)
+	require.NoError(t, err)
+	assert.True(t, mark.Equal(published), "the mark is never lowered, got %s", mark)
+
+	require.NoError(t, RaiseHighWaterMark(feed, published.Add(time.Hour), time.Local))
+	mark, err = HighWaterMark(feed)
+	require.NoError(t, err)
+	assert.True(t, mark.Equal(published.Add(time.Hour)), "got %s", mark)
+
+	mark, err = HighWaterMark("https://example.com/other.xml")
+	require.NoError(t, err)
+	assert.True(t, mark.IsZero(), "marks are per feed")
+}
+
+func TestLatestInCategories(t *testing.T) {
+	InitDB()
+	defer CloseDB()
+	defer os.Remove("./tooted_posts.db")
+
+	store := func(link string, published time.Time, posted bool, categories ...string) {
+		t.Helper()
+		require.NoError(t, StoreTootedPost(link, "content", "2026-01-01T00:00:00Z", time.Now(), DefaultContent, time.Local))
+		require.NoError(t, SetPublishedAt(link, published, time.Local))
+		require.NoError(t, SetCategories(link, categories))
+		if posted {
+			require.NoError(t, MarkSitePosted(link, "bluesky", time.Now(), time.Local))
+			require.NoError(t, SetSitePostID(link, "bluesky", "at://did:plc:test/app.bsky.feed.post/"+path.Base(link)))
+		}
+	}
+	day := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	store("https://example.com/go-1", day, true, "Go", " go ", "Tools")
+	store("https://example.com/go-2", day.AddDate(0, 0, 2), true, "go")
+	store("https://example.com/go-unposted", day.AddDate(0, 0, 3), false, "go")
+	store("https://example.com/rust", day.AddDate(0, 0, 4), true, "rust")
+	store("https://example.com/go-3", day.AddDate(0, 0, 5), false, "GO")
+
+	post, ok, err := LatestInCategories([]string{"Go"}, "https://example.com/go-3")
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, "https://example.com/go-2", post.Link, "the latest published post other than exclude")
+	assert.Equal(t, "at://did:plc:test/app.bsky.feed.post/go-2", post.BlueskyURI)
+
+	post, ok, err = LatestInCategories([]string{"tools", "python"}, "")
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, "https://example.com/go-1", post.Link)
+
+	_, ok, err = LatestInCategories([]string{"python"}, "")
+	require.NoError(t, err)
+	assert.False(t, ok)
+	_, ok, err = LatestInCategories(nil, "")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	require.NoError(t, SetCategories("https://example.com/go-2", []string{"life"}))
+	post, _, err = LatestInCategories([]string{"go"}, "https://example.com/go-3")
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com/go-1", post.Link, "categories are replaced")
+}
+
+func TestPreviousPart(t *testing.T) {
+	InitDB()
+	defer CloseDB()
+	defer os.Remove("./tooted_posts.db")
+
+	require.NoError(t, SetSeriesPart("https://example.com/go-1", "go", 1))
+	require.NoError(t, SetSeriesPart("https://example.com/go-2", "go", 2))
+	require.NoError(t, SetSeriesPart("https://example.com/go-4", "go", 4))
+	require.NoError(t, SetSeriesPart("https://example.com/rust-3", "rust", 3))
+
+	link, ok, err := PreviousPart("go", 4)
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, "https://example.com/go-2", link, "missing parts are skipped")
+
+	_, ok, err = PreviousPart("go", 1)
+	require.NoError(t, err)
+	assert.False(t, ok)
+	_, ok, err = PreviousPart("", 5)
+	require.NoError(t, err)
+	assert.False(t, ok, "series are kept apart")
+
+	require.NoError(t, SetSeriesPart("https://example.com/go-2", "go", 5))
+	link, _, err = PreviousPart("go", 4)
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com/go-1", link, "parts are replaced")
+}
+
+func TestSetSitePostID(t *testing.T) {
+	InitDB()
+	defer CloseDB()
+	defer os.Remove("./tooted_posts.db")
+
+	link := "https://example.com/post-id"
+	require.NoError(t, StoreTootedPost(link, "content", "2026-01-01T00:00:00Z", time.Now(), DefaultContent, time.Local))
+
+	id, err := SitePostID(link, "bluesky")
+	require.NoError(t, err)
+	assert.Empty(t, id)
+
+	uri := "at://did:plc:test/app.bsky.feed.post/abc"
+	require.NoError(t, SetSitePostID(link, "bluesky", uri))
+	id, err = SitePostID(link, "bluesky")
+	require.NoError(t, err)
+	assert.Equal(t, uri, id)
+
+	// Sites without a stored identifier are ignored.
+	assert.NoError(t, SetSitePostID(link, "unknown_site", "123"))
+	_, err = SitePostID(link, "unknown_site")
+	assert.Error(t, err)
+
+	_, err = SitePostID("https://example.com/nonexistent", "bluesky")
+	assert.Error(t, err)
+}
+
+func TestPostsToRepromote(t *testing.T) {
+	InitDB()
+	defer CloseDB()
+	defer os.Remove("./tooted_posts.db")
+
+	require.NoError(t, StoreTootedPost("https://example.com/published", "content", "2026-01-01T00:00:00Z", time.Now(), DefaultContent, time.Local))
+	require.NoError(t, SetSitePostID("https://example.com/published", "mastodon", "123"))
+	require.NoError(t, StoreTootedPost("https://example.com/unpublished", "content", "2026-01-01T00:00:00Z", time.Now(), DefaultContent, time.Local))
+
+	links, err := PostsToRepromote(time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+	assert.Empty(t, links, "recently published posts are not due")
+
+	require.NoError(t, SetPublishedAt("https://example.com/published", time.Now().Add(-48*time.Hour), time.Local))
+	require.NoError(t, StoreTootedPost("https://example.com/published", "edited", "2026-01-01T00:00:00Z", time.Now(), DefaultContent, time.Local))
+	links, err = PostsToRepromote(time.Now().Add(-24 * time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"https://example.com/published"}, links, "updates do not delay re-promotion")
+
+	links, err = PostsToRepromote(time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"https://example.com/published"}, links, "only posts with a stored post ID are due")
+
+	require.NoError(t, MarkRepromoted("https://example.com/published"))
+	links, err = PostsToRepromote(time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	assert.Empty(t, links)
+
+	assert.Error(t, MarkRepromoted("https://example.com/nonexistent"))
+}
+
+func TestPostTimestamps(t *testing.T) {
+	InitDB()
+	defer CloseDB()
+	defer os.Remove("./tooted_posts.db")
+
+	link := "https://example.com/timestamps"
+	require.NoError(t, StoreTootedPost(link, "content", "2026-01-01T00:00:00Z", time.Now(), DefaultContent, time.Local))
+	published := time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC)
+	require.NoError(t, SetPublishedAt(link, published, time.Local))
+
+	posts, err := ListPosts(0)
+	require.NoError(t, err)
+	require.Len(t, posts, 1)
+	assert.True(t, posts[0].PublishedAt.Equal(published))
+	assert.False(t, posts[0].FirstSeen.IsZero())
+	assert.True(t, posts[0].LastPosted.IsZero(), "not posted yet")
+	assert.Empty(t, posts[0].Sites())
+
+	firstSeen := posts[0].FirstSeen
+	require.NoError(t, MarkSitePosted(link, "bluesky", time.Now(), time.Local))
+	require.NoError(t, StoreTootedPost(link, "updated content", "2026-01-01T00:00:00Z", time.Now(), DefaultContent, time.Local))
+
+	posts, err = ListPosts(1)
+	require.NoError(t, err)
+	require.Len(t, posts, 1)
+	assert.True(t, posts[0].FirstSeen.Equal(firstSeen), "first seen is kept when the post is updated")
+	assert.False(t, posts[0].LastPosted.IsZero())
+	assert.Equal(t, []string{"bluesky"}, posts[0].Sites())
+
+	assert.Error(t, SetPublishedAt("https://example.com/nonexistent", published, time.Local))
+}
+
+func TestRetries(t *testing.T) {
+	InitDB()
+	defer CloseDB()
+	defer os.Remove("./tooted_posts.db")
+
+	link := "https://example.com/retry"
+	r, err := GetRetry(link, "mastodon")
+	require.NoError(t, err)
+	assert.Equal(t, Retry{Link: link, Site: "mastodon"}, r)
+
+	now := time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC)
+	r.Attempts, r.LastAttempt, r.NextAttempt, r.LastError = 1, now, now.Add(time.Hour), "boom"
+	require.NoError(t, SaveRetry(r, time.Local))
+	r.Attempts, r.Dead = 2, true
+	require.NoError(t, SaveRetry(r, time.Local))
+	require.NoError(t, SaveRetry(Retry{Link: link, Site: "bluesky", Attempts: 1, LastError: "down"}, time.Local))
+
+	got, err := GetRetry(link, "mastodon")
+	require.NoError(t, err)
+	assert.Equal(t, 2, got.Attempts)
+	assert.True(t, got.Dead)
+	assert.True(t, got.NextAttempt.Equal(now.Add(time.Hour)))
+
+	dead, err := DeadLetters()
+	require.NoError(t, err)
+	require.Len(t, dead, 1)
+	assert.Equal(t, "mastodon", dead[0].Site)
+	assert.Equal(t, "boom", dead[0].LastError)
+
+	require.NoError(t, ClearRetry(link, "mastodon"))
+	got, err = GetRetry(link, "mastodon")
+	require.NoError(t, err)
+	assert.Zero(t, got.Attempts)
+}
+
+func TestInit_ReadOnly(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "readonly.db")
+	require.NoError(t, Init(path))
+	CloseDB()
+
+	err := Init("file:" + path + "?mode=ro")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "not writable")
+
+	assert.Error(t, Init(filepath.Join(t.TempDir(), "missing", "db.sqlite")))
+}
+
+func TestInitMemory(t *testing.T) {
+	require.NoError(t, InitMemory())
+	defer CloseDB()
+
+	assert.True(t, IsFirstCycle())
+	require.NoError(t, StoreTootedPost("https://example.com/memory", "content", "2026-01-01T00:00:00Z", time.Now(), DefaultContent, time.Local))
+	require.NoError(t, MarkSitePosted("https://example.com/memory", "mastodon", time.Now(), time.Local))
+	posted, err := IsSitePosted("https://example.com/memory", "mastodon")
+	require.NoError(t, err)
+	assert.True(t, posted)
+}
+
+func TestLocks(t *testing.T) {
+	require.NoError(t, Init(filepath.Join(t.TempDir(), "locks.db")))
+	defer CloseDB()
+
+	acquired, err := AcquireLock("cycle", "a", time.Minute)
+	require.NoError(t, err)
+	assert.True(t, acquired)
+	acquired, err = AcquireLock("cycle", "b", time.Minute)
+	require.NoError(t, err)
+	assert.False(t, acquired, "the lock is held by a")
+	acquired, err = AcquireLock("cycle", "a", -time.Second)
+	require.NoError(t, err)
+	assert.True(t, acquired, "the holder renews its lease")
+
+	acquired, err = AcquireLock("cycle", "b", time.Minute)
+	require.NoError(t, err)
+	assert.True(t, acquired, "an expired lease is taken over")
+	require.NoError(t, ReleaseLock("cycle", "a"), "releasing a lock held by another owner is a no-op")
+	acquired, err = AcquireLock("cycle", "a", time.Minute)
+	require.NoError(t, err)
+	assert.False(t, acquired)
+
+	require.NoError(t, ReleaseLock("cycle", "b"))
+	acquired, err = AcquireLock("cycle", "a", time.Minute)
+	require.NoError(t, err)
+	assert.True(t, acquired)
+}
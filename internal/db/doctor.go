@@ -0,0 +1,283 @@
+package db
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// Report is the result of Diagnose.
+type Report struct {
+	// Integrity lists the problems reported by PRAGMA integrity_check, or
+	// the error that kept it from running. It is empty for a sound file.
+	Integrity []string
+	// OrphanedRetries are retry states of links that are not stored as
+	// posts, or of unknown sites.
+	OrphanedRetries []Retry
+}
+
+// Corrupt reports whether the integrity check found the file damaged.
+func (r Report) Corrupt() bool {
+	return len(r.Integrity) > 0
+}
+
+// Diagnose checks the database at path without migrating it, so that it also
+// works on files InitDB fails to open. Orphaned rows are only looked for when
+// the file passes the integrity check.
+func Diagnose(path string) (Report, error) {
+	var report Report
+	if _, err := os.Stat(path); err != nil {
+		return report, err
+	}
+	d, err := open(path)
+	if err != nil {
+		report.Integrity = []string{err.Error()}
+		return report, nil
+	}
+	defer closeHandle(d)
+
+	var results []string
+	if err := d.Raw("PRAGMA integrity_check").Scan(&results).Error; err != nil {
+		report.Integrity = []string{err.Error()}
+		return report, nil
+	}
+	for _, r := range results {
+		if r != "ok" {
+			report.Integrity = append(report.Integrity, r)
+		}
+	}
+	if report.Corrupt() {
+		return report, nil
+	}
+
+	report.OrphanedRetries, err = orphanedRetries(d)
+	return report, err
+}
+
+func orphanedRetries(d *gorm.DB) ([]Retry, error) {
+	if !d.Migrator().HasTable(&Retry{}) {
+		return nil, nil
+	}
+	sites := make([]string, 0, len(validSites))
+	for site := range validSites {
+		sites = append(sites, site)
+	}
+	query := d.Where("site NOT IN ?", sites)
+	if d.Migrator().HasTable(&TootedPost{}) {
+		query = query.Or("link NOT IN (?)", d.Model(&TootedPost{}).Select("link"))
+	}
+	var retries []Retry
+	err := query.Order("id asc").Find(&retries).Error
+	return retries, err
+}
+
+// RemoveOrphans deletes the orphaned rows of the database at path and returns
+// how many were removed.
+func RemoveOrphans(path string) (int64, error) {
+	d, err := openExisting(path)
+	if err != nil {
+		return 0, err
+	}
+	defer closeHandle(d)
+
+	retries, err := orphanedRetries(d)
+	if err != nil || len(retries) == 0 {
+		return 0, err
+	}
+	ids := make([]uint, 0, len(retries))
+	for _, r := range retries {
+		ids = append(ids, r.ID)
+	}
+	result := d.Delete(&Retry{}, ids)
+	return result.RowsAffected, result.Error
+}
+
+// Reindex rebuilds every index of the database at path.
+func Reindex(path string) error {
+	d, err := openExisting(path)
+	if err != nil {
+		return err
+	}
+	defer closeHandle(d)
+	return d.Exec("REINDEX").Error
+}
+
+// RebuildResult describes a database rebuilt by Rebuild.
+type RebuildResult struct {
+	// Backup is where the damaged file was moved to.
+	Backup string
+	// Events is the number of events recovered from the damaged file.
+	Events int
+	// Posts is the number of posts reconstructed from the events.
+	Posts int
+}
+
+// Rebuild replaces the database at path with one reconstructed from its event
+// log, reading as many events as the damaged file still yields. The damaged
+// file is kept next to it with a ".corrupt-<time>" suffix.
+//
+// Posts are marked posted to every site they have a published, updated or
+// scheduled event for, and posts given up on are dead-lettered again. Content
+// hashes, pubDates and the IDs of the created posts are not in the event log:
+// the content seen next is adopted as is, and such posts can no longer be
+// edited, re-promoted or deleted by rss2socials.
+func Rebuild(path string) (RebuildResult, error) {
+	var result RebuildResult
+	events, err := recoverEvents(path)
+	if err != nil {
+		return result, err
+	}
+	if len(events) == 0 {
+		return result, fmt.Errorf("no events could be read from %s, so there is nothing to rebuild it from", path)
+	}
+	result.Events = len(events)
+
+	result.Backup = fmt.Sprintf("%s.corrupt-%s", path, time.Now().Format("20060102T150405"))
+	if err := os.Rename(path, result.Backup); err != nil {
+		return result, fmt.Errorf("failed to move the damaged database aside: %w", err)
+	}
+
+	d, err := open(path)
+	if err != nil {
+		return result, err
+	}
+	defer closeHandle(d)
+	if err := migrate(d); err != nil {
+		return result, err
+	}
+
+	posts, retries := replayEvents(events)
+	result.Posts = len(posts)
+	err = d.Transaction(func(tx *gorm.DB) error {
+		if err := tx.CreateInBatches(events, 500).Error; err != nil {
+			return err
+		}
+		if len(posts) > 0 {
+			if err := tx.CreateInBatches(posts, 500).Error; err != nil {
+				return err
+			}
+		}
+		if len(retries) > 0 {
+			return tx.CreateInBatches(retries, 500).Error
+		}
+		return nil
+	})
+	if err != nil {
+		return result, fmt.Errorf("failed to write the rebuilt database: %w", err)
+	}
+	return result, nil
+}
+
+// recoverEvents reads the events of the database at path in ID order,
+// stopping at the first row that cannot be read.
+func recoverEvents(path string) ([]Event, error) {
+	d, err := openExisting(path)
+	if err != nil {
+		return nil, err
+	}
+	defer closeHandle(d)
+
+	rows, err := d.Model(&Event{}).Order("id asc").Rows()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the event log: %w", err)
+	}
+	defer rows.Close()
+
+	var events []Event
+	for rows.Next() {
+		var ev Event
+		if err := d.ScanRows(rows, &ev); err != nil {
+			log.Warnf("Stopped reading the event log after %d events: %v", len(events), err)
+			return events, nil
+		}
+		events = append(events, ev)
+	}
+	if err := rows.Err(); err != nil {
+		log.Warnf("Stopped reading the event log after %d events: %v", len(events), err)
+	}
+	return events, nil
+}
+
+// replayEvents reconstructs the posts and dead letters recorded by events,
+// which must be in the order they were recorded.
+func replayEvents(events []Event) ([]TootedPost, []Retry) {
+	posts := make(map[string]*TootedPost)
+	var order []string
+	dead := make(map[[2]string]*Retry)
+	var deadOrder [][2]string
+	seen := make(map[[2]string]bool)
+
+	for _, ev := range events {
+		if _, ok := validSites[ev.Site]; !ok || ev.Link == "" {
+			continue
+		}
+		p, ok := posts[ev.Link]
+		if !ok {
+			p = &TootedPost{
+				Link:      ev.Link,
+				Timestamp: ev.Timestamp.Format(time.RFC3339),
+				FirstSeen: ev.Timestamp,
+			}
+			posts[ev.Link] = p
+			order = append(order, ev.Link)
+		}
+
+		key := [2]string{ev.Link, ev.Site}
+		switch ev.Action {
+		case ActionPublished, ActionUpdated, ActionScheduled:
+			switch ev.Site {
+			case "mastodon":
+				p.MastodonPosted = true
+			case "bluesky":
+				p.BlueskyPosted = true
+			case "threads":
+				p.ThreadsPosted = true
+			case "newsletter":
+				p.NewsletterPosted = true
+			}
+			p.LastPosted = ev.Timestamp
+			delete(dead, key)
+		case ActionRepromoted:
+			p.Repromoted = true
+		case ActionDeadLettered:
+			if !seen[key] {
+				seen[key] = true
+				deadOrder = append(deadOrder, key)
+			}
+			dead[key] = &Retry{Link: ev.Link, Site: ev.Site, LastAttempt: ev.Timestamp, LastError: ev.Detail, Dead: true}
+		}
+	}
+
+	out := make([]TootedPost, 0, len(order))
+	for _, link := range order {
+		out = append(out, *posts[link])
+	}
+	var retries []Retry
+	for _, key := range deadOrder {
+		if r, ok := dead[key]; ok {
+			retries = append(retries, *r)
+		}
+	}
+	return out, retries
+}
+
+// openExisting opens the database at path, which unlike open must exist.
+func openExisting(path string) (*gorm.DB, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+	return open(path)
+}
+
+func closeHandle(d *gorm.DB) {
+	sqlDB, err := d.DB()
+	if err == nil {
+		err = sqlDB.Close()
+	}
+	if err != nil {
+		log.Error("Error closing SQLite database connection: ", err)
+	}
+}
@@ -0,0 +1,103 @@
+package db
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/toozej/rss2socials/internal/rss"
+)
+
+func TestDiagnose_OrphanedRetries(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "doctor.db")
+	InitDB(path)
+	require.NoError(t, StoreTootedPost("https://example.com/stored", "a", "2026-01-01T00:00:00Z", time.Now(), DefaultContent, time.Local))
+	require.NoError(t, SaveRetry(Retry{Link: "https://example.com/stored", Site: "mastodon", Attempts: 1}, time.Local))
+	require.NoError(t, SaveRetry(Retry{Link: "https://example.com/gone", Site: "bluesky", Attempts: 2}, time.Local))
+	require.NoError(t, SaveRetry(Retry{Link: "https://example.com/stored", Site: "myspace", Attempts: 1}, time.Local))
+	CloseDB()
+
+	report, err := Diagnose(path)
+	require.NoError(t, err)
+	assert.False(t, report.Corrupt())
+	require.Len(t, report.OrphanedRetries, 2)
+	assert.Equal(t, "https://example.com/gone", report.OrphanedRetries[0].Link)
+	assert.Equal(t, "myspace", report.OrphanedRetries[1].Site)
+
+	removed, err := RemoveOrphans(path)
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, removed)
+	require.NoError(t, Reindex(path))
+
+	report, err = Diagnose(path)
+	require.NoError(t, err)
+	assert.Empty(t, report.OrphanedRetries)
+}
+
+func TestDiagnose_Corrupt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "garbage.db")
+	require.NoError(t, os.WriteFile(path, []byte("this is not an SQLite database, just some bytes padded out a little"), 0o600))
+
+	report, err := Diagnose(path)
+	require.NoError(t, err)
+	assert.True(t, report.Corrupt())
+
+	_, err = Rebuild(path)
+	assert.Error(t, err, "a file without a readable event log cannot be rebuilt")
+	assert.FileExists(t, path, "the file is left in place when it cannot be rebuilt")
+
+	_, err = Diagnose(filepath.Join(t.TempDir(), "missing.db"))
+	assert.Error(t, err)
+}
+
+func TestRebuild(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rebuild.db")
+	InitDB(path)
+	require.NoError(t, RecordEvent(ActionFetched, "", "https://example.com/feed", "2 items", time.Now(), time.Local))
+	require.NoError(t, RecordEvent(ActionPublished, "mastodon", "https://example.com/one", "", time.Now(), time.Local))
+	require.NoError(t, RecordEvent(ActionFailed, "bluesky", "https://example.com/one", "down", time.Now(), time.Local))
+	require.NoError(t, RecordEvent(ActionDeadLettered, "bluesky", "https://example.com/one", "down", time.Now(), time.Local))
+	require.NoError(t, RecordEvent(ActionScheduled, "mastodon", "https://example.com/two", "2026-01-01T12:00:00Z", time.Now(), time.Local))
+	require.NoError(t, RecordEvent(ActionPublished, "threads", "https://example.com/two", "", time.Now(), time.Local))
+	require.NoError(t, RecordEvent(ActionRepromoted, "mastodon", "https://example.com/two", "", time.Now(), time.Local))
+	CloseDB()
+
+	result, err := Rebuild(path)
+	require.NoError(t, err)
+	assert.Equal(t, 7, result.Events)
+	assert.Equal(t, 2, result.Posts)
+	assert.FileExists(t, result.Backup)
+
+	InitDB(path)
+	defer CloseDB()
+
+	for site, want := range map[string]bool{"mastodon": true, "bluesky": false, "threads": false} {
+		posted, err := IsSitePosted("https://example.com/one", site)
+		require.NoError(t, err)
+		assert.Equal(t, want, posted, site)
+	}
+	posted, err := IsSitePosted("https://example.com/two", "threads")
+	require.NoError(t, err)
+	assert.True(t, posted)
+
+	dead, err := DeadLetters()
+	require.NoError(t, err)
+	require.Len(t, dead, 1)
+	assert.Equal(t, "bluesky", dead[0].Site)
+
+	events, err := EventsSince(time.Time{})
+	require.NoError(t, err)
+	assert.Len(t, events, 7)
+
+	exists, updated, err := HasPostChanged("https://example.com/one", "current content", rss.DefaultHashing)
+	require.NoError(t, err)
+	assert.True(t, exists)
+	assert.False(t, updated, "the content seen after a rebuild is adopted")
+	_, updated, err = HasPostChanged("https://example.com/one", "edited content", rss.DefaultHashing)
+	require.NoError(t, err)
+	assert.True(t, updated)
+}
@@ -0,0 +1,47 @@
+package db
+
+import (
+	"time"
+
+	"gorm.io/gorm/clause"
+)
+
+// Enrichment is the cached result of a lookup on the page of a feed item,
+// such as its canonical URL or the text of its article, so that the page
+// is not fetched again every cycle while the item waits to be published.
+type Enrichment struct {
+	// GUID identifies the feed item, see rss.RSSItem.Key.
+	GUID string `gorm:"primaryKey"`
+	// Kind is the lookup, e.g. "canonical" or "article".
+	Kind      string `gorm:"primaryKey"`
+	Value     string
+	FetchedAt time.Time `gorm:"index"`
+}
+
+// CachedEnrichment returns the result of the lookup kind for the item guid
+// when it was fetched at or after since, and reports whether there is one.
+func CachedEnrichment(guid, kind string, since time.Time) (string, bool, error) {
+	var enrichments []Enrichment
+	err := DB.Where("guid = ? AND kind = ? AND fetched_at >= ?", guid, kind, since).Limit(1).Find(&enrichments).Error
+	if err != nil || len(enrichments) == 0 {
+		return "", false, err
+	}
+	return enrichments[0].Value, true, nil
+}
+
+// SaveEnrichment stores value as the result of the lookup kind for the item
+// guid, fetched at fetched, replacing an earlier result. fetched is written in
+// the time zone loc.
+func SaveEnrichment(guid, kind, value string, fetched time.Time, loc *time.Location) error {
+	return DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "guid"}, {Name: "kind"}},
+		DoUpdates: clause.AssignmentColumns([]string{"value", "fetched_at"}),
+	}).Create(&Enrichment{GUID: guid, Kind: kind, Value: value, FetchedAt: fetched.In(loc)}).Error
+}
+
+// PruneEnrichments deletes the lookup results fetched before the given time
+// and returns the number of rows removed.
+func PruneEnrichments(before time.Time) (int64, error) {
+	result := DB.Where("fetched_at < ?", before).Delete(&Enrichment{})
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,81 @@
+package db
+
+import (
+	"time"
+)
+
+// Event actions recorded in the events table.
+const (
+	ActionFetched            = "fetched"
+	ActionSkippedFilter      = "skipped-filter"
+	ActionSkippedDependency  = "skipped-dependency"
+	ActionSkippedBlocklist   = "skipped-blocklist"
+	ActionHeldBack           = "held-back"
+	ActionPublished          = "published"
+	ActionScheduled          = "scheduled"
+	ActionFailed             = "failed"
+	ActionUpdated            = "updated"
+	ActionDeleted            = "deleted"
+	ActionRepromoted         = "repromoted"
+	ActionPinned             = "pinned"
+	ActionDeadLettered       = "dead-lettered"
+	ActionCredentialsChecked = "credentials-checked"
+)
+
+// Event is a single entry in the audit trail of actions taken by rss2socials.
+type Event struct {
+	ID        uint      `gorm:"primaryKey"`
+	Timestamp time.Time `gorm:"index"`
+	Action    string    `gorm:"index"`
+	Site      string
+	Link      string
+	Detail    string
+}
+
+// RecordEvent appends an event that happened at now to the events table.
+// Failures are returned but callers typically only log them, since the audit
+// trail must never block posting. detail holds free-form context such as an
+// error message. now is written in the time zone loc.
+func RecordEvent(action, site, link, detail string, now time.Time, loc *time.Location) error {
+	ev := Event{
+		Timestamp: now.In(loc),
+		Action:    action,
+		Site:      site,
+		Link:      link,
+		Detail:    detail,
+	}
+	return DB.Create(&ev).Error
+}
+
+// EventsSince returns events recorded at or after since, oldest first.
+func EventsSince(since time.Time) ([]Event, error) {
+	var events []Event
+	err := DB.Where("timestamp >= ?", since).Order("timestamp asc, id asc").Find(&events).Error
+	return events, err
+}
+
+// LastEventTime returns when action was last recorded for site, or the zero
+// time when it was not recorded within the retention of the events.
+func LastEventTime(action, site string) (time.Time, error) {
+	var events []Event
+	err := DB.Where("action = ? AND site = ?", action, site).Order("timestamp desc, id desc").Limit(1).Find(&events).Error
+	if err != nil || len(events) == 0 {
+		return time.Time{}, err
+	}
+	return events[0].Timestamp, nil
+}
+
+// PruneEvents deletes events recorded before the given time and returns the
+// number of rows removed.
+func PruneEvents(before time.Time) (int64, error) {
+	result := DB.Where("timestamp < ?", before).Delete(&Event{})
+	return result.RowsAffected, result.Error
+}
+
+// Label returns the action combined with the site, e.g. "published-mastodon".
+func (e Event) Label() string {
+	if e.Site == "" {
+		return e.Action
+	}
+	return e.Action + "-" + e.Site
+}
@@ -0,0 +1,37 @@
+package db
+
+import (
+	"time"
+
+	"gorm.io/gorm/clause"
+)
+
+// HighWater is the latest pubDate of the items published from a feed. Items
+// of the feed dated before it are not new, even when their posts are no
+// longer stored.
+type HighWater struct {
+	// Feed is the feed URL as configured.
+	Feed        string `gorm:"primaryKey"`
+	PublishedAt time.Time
+}
+
+// HighWaterMark returns the high-water mark of feed, or the zero time when
+// none was recorded.
+func HighWaterMark(feed string) (time.Time, error) {
+	var marks []HighWater
+	if err := DB.Where("feed = ?", feed).Limit(1).Find(&marks).Error; err != nil || len(marks) == 0 {
+		return time.Time{}, err
+	}
+	return marks[0].PublishedAt, nil
+}
+
+// RaiseHighWaterMark sets the high-water mark of feed to published unless
+// it is already later, written in the time zone loc.
+func RaiseHighWaterMark(feed string, published time.Time, loc *time.Location) error {
+	published = published.In(loc)
+	return DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "feed"}},
+		DoUpdates: clause.Assignments(map[string]any{"published_at": published}),
+		Where:     clause.Where{Exprs: []clause.Expression{clause.Lt{Column: clause.Column{Table: "high_waters", Name: "published_at"}, Value: published}}},
+	}).Create(&HighWater{Feed: feed, PublishedAt: published}).Error
+}
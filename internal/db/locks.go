@@ -0,0 +1,38 @@
+package db
+
+import (
+	"time"
+
+	"gorm.io/gorm/clause"
+)
+
+// Lock is a lease on a named lock, held by one of the instances sharing the
+// database until it expires.
+type Lock struct {
+	Name  string `gorm:"primaryKey"`
+	Owner string
+	// Expires is when the lease ends, in Unix milliseconds, so that it
+	// compares correctly regardless of the time zone of the writer.
+	Expires int64
+}
+
+// AcquireLock takes the lock name for owner, or renews it when owner holds
+// it already, until ttl from now. It reports false when another owner holds
+// a lease that has not expired.
+func AcquireLock(name, owner string, ttl time.Duration) (bool, error) {
+	now := time.Now()
+	result := DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "name"}},
+		DoUpdates: clause.AssignmentColumns([]string{"owner", "expires"}),
+		Where: clause.Where{Exprs: []clause.Expression{clause.Or(
+			clause.Eq{Column: clause.Column{Table: "locks", Name: "owner"}, Value: owner},
+			clause.Lt{Column: clause.Column{Table: "locks", Name: "expires"}, Value: now.UnixMilli()},
+		)}},
+	}).Create(&Lock{Name: name, Owner: owner, Expires: now.Add(ttl).UnixMilli()})
+	return result.RowsAffected > 0, result.Error
+}
+
+// ReleaseLock gives up the lock name, if owner holds it.
+func ReleaseLock(name, owner string) error {
+	return DB.Where("name = ? AND owner = ?", name, owner).Delete(&Lock{}).Error
+}
@@ -0,0 +1,64 @@
+package db
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Retry is the retry state of publishing a post to a single site after it
+// failed. Dead is set once the post was given up on.
+type Retry struct {
+	ID          uint   `gorm:"primaryKey"`
+	Link        string `gorm:"uniqueIndex:idx_retry_link_site"`
+	Site        string `gorm:"uniqueIndex:idx_retry_link_site"`
+	Attempts    int
+	LastAttempt time.Time
+	NextAttempt time.Time
+	LastError   string
+	Dead        bool `gorm:"index"`
+}
+
+// GetRetry returns the retry state of link on site, or a zero Retry with the
+// link and site set when publishing it has not failed.
+func GetRetry(link, site string) (Retry, error) {
+	var r Retry
+	err := DB.Where("link = ? AND site = ?", link, site).First(&r).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return Retry{Link: link, Site: site}, nil
+	}
+	return r, err
+}
+
+// SaveRetry creates or replaces the retry state of r.Link on r.Site, with
+// its times written in the time zone loc.
+func SaveRetry(r Retry, loc *time.Location) error {
+	r.ID = 0
+	r.LastAttempt = r.LastAttempt.In(loc)
+	r.NextAttempt = r.NextAttempt.In(loc)
+	return DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "link"}, {Name: "site"}},
+		DoUpdates: clause.AssignmentColumns([]string{"attempts", "last_attempt", "next_attempt", "last_error", "dead"}),
+	}).Create(&r).Error
+}
+
+// ClearRetry removes the retry state of link on site, once it was published.
+func ClearRetry(link, site string) error {
+	return DB.Where("link = ? AND site = ?", link, site).Delete(&Retry{}).Error
+}
+
+// PendingRetries returns the failed posts that are still being retried.
+func PendingRetries() ([]Retry, error) {
+	var retries []Retry
+	err := DB.Where("dead = ?", false).Order("next_attempt asc, id asc").Find(&retries).Error
+	return retries, err
+}
+
+// DeadLetters returns the posts that were given up on, most recent first.
+func DeadLetters() ([]Retry, error) {
+	var retries []Retry
+	err := DB.Where("dead = ?", true).Order("last_attempt desc, id desc").Find(&retries).Error
+	return retries, err
+}
@@ -0,0 +1,32 @@
+package db
+
+import "gorm.io/gorm/clause"
+
+// SeriesPart is a stored post that is a part of a series, to reply to the
+// post of the previous part.
+type SeriesPart struct {
+	Link string `gorm:"primaryKey"`
+	// Series is the name of the series in lower case, or empty for posts
+	// that only carry a part number.
+	Series string `gorm:"index"`
+	Part   int
+}
+
+// SetSeriesPart records the post with link as part of series.
+func SetSeriesPart(link, series string, part int) error {
+	return DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "link"}},
+		DoUpdates: clause.AssignmentColumns([]string{"series", "part"}),
+	}).Create(&SeriesPart{Link: link, Series: series, Part: part}).Error
+}
+
+// PreviousPart returns the link of the part of series before part, the one
+// with the highest lower number, and reports whether there is one.
+func PreviousPart(series string, part int) (string, bool, error) {
+	var parts []SeriesPart
+	err := DB.Where("series = ? AND part < ?", series, part).Order("part DESC").Limit(1).Find(&parts).Error
+	if err != nil || len(parts) == 0 {
+		return "", false, err
+	}
+	return parts[0].Link, true, nil
+}
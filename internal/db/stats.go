@@ -0,0 +1,194 @@
+package db
+
+import (
+	"slices"
+	"sort"
+	"time"
+)
+
+// Stats are totals over the stored posts and the event log, reported by
+// the stats command.
+type Stats struct {
+	// Posts is the number of stored posts, published or not.
+	Posts int `json:"posts"`
+	// Published is the number of posts published to at least one site.
+	Published int `json:"published"`
+	// PostsPerWeek is the average number of posts published per week since
+	// the first one was seen.
+	PostsPerWeek float64 `json:"posts_per_week"`
+	// FailureRate is the share of publish attempts in the event log that
+	// failed, across all sites.
+	FailureRate float64 `json:"failure_rate"`
+	// FirstSeen and LastPosted bound the activity of the stored posts.
+	FirstSeen  time.Time `json:"first_seen,omitzero"`
+	LastPosted time.Time `json:"last_posted,omitzero"`
+	// EventsSince is when the oldest event still in the log was recorded;
+	// failure rates and feed activity only cover the time since.
+	EventsSince time.Time   `json:"events_since,omitzero"`
+	Sites       []SiteStats `json:"sites"`
+	// Variants are the posts published per site and template variant, for
+	// posts published with a variant.
+	Variants []VariantStats `json:"variants,omitempty"`
+	Feeds    []FeedStats    `json:"feeds"`
+}
+
+// SiteStats are the totals of a site.
+type SiteStats struct {
+	Site string `json:"site"`
+	// Published is the number of stored posts published to the site.
+	Published int `json:"published"`
+	// Attempts and Failures count the publish attempts in the event log.
+	Attempts    int     `json:"attempts"`
+	Failures    int     `json:"failures"`
+	FailureRate float64 `json:"failure_rate"`
+}
+
+// VariantStats are the totals of a template variant on a site.
+type VariantStats struct {
+	Site    string `json:"site"`
+	Variant string `json:"variant"`
+	// Published is the number of stored posts published to the site with
+	// the variant.
+	Published int `json:"published"`
+}
+
+// FeedStats are the totals of a feed URL found in the event log.
+type FeedStats struct {
+	URL           string `json:"url"`
+	Fetches       int    `json:"fetches"`
+	FetchFailures int    `json:"fetch_failures"`
+	// Published counts the posts published after fetching the feed, up to
+	// the next fetch of another feed.
+	Published     int       `json:"published"`
+	LastFetched   time.Time `json:"last_fetched,omitzero"`
+	LastPublished time.Time `json:"last_published,omitzero"`
+}
+
+// statsSites are the sites reported by ComputeStats, in order.
+var statsSites = []string{"mastodon", "bluesky", "threads", "newsletter"}
+
+// ComputeStats returns the totals of the stored posts and the event log,
+// with averages up to now.
+func ComputeStats(now time.Time) (Stats, error) {
+	var posts []TootedPost
+	if err := DB.Select("mastodon_posted", "bluesky_posted", "threads_posted", "newsletter_posted", "mastodon_variant", "bluesky_variant", "threads_variant", "first_seen", "last_posted").Find(&posts).Error; err != nil {
+		return Stats{}, err
+	}
+	var events []Event
+	if err := DB.Order("timestamp asc, id asc").Find(&events).Error; err != nil {
+		return Stats{}, err
+	}
+
+	stats := Stats{Posts: len(posts)}
+	sites := make(map[string]*SiteStats, len(statsSites))
+	for _, site := range statsSites {
+		sites[site] = &SiteStats{Site: site}
+	}
+	variants := make(map[[2]string]int)
+	for _, post := range posts {
+		published := post.Sites()
+		for _, site := range published {
+			sites[site].Published++
+			if v := post.variant(site); v != "" {
+				variants[[2]string{site, v}]++
+			}
+		}
+		if len(published) > 0 {
+			stats.Published++
+		}
+		if !post.FirstSeen.IsZero() && (stats.FirstSeen.IsZero() || post.FirstSeen.Before(stats.FirstSeen)) {
+			stats.FirstSeen = post.FirstSeen
+		}
+		if post.LastPosted.After(stats.LastPosted) {
+			stats.LastPosted = post.LastPosted
+		}
+	}
+	if !stats.FirstSeen.IsZero() {
+		// Spans under a week count as a week, so that a fresh database
+		// does not report inflated rates.
+		weeks := max(now.Sub(stats.FirstSeen).Hours()/(7*24), 1)
+		stats.PostsPerWeek = float64(stats.Published) / weeks
+	}
+
+	feeds := make(map[string]*FeedStats)
+	var current *FeedStats
+	feed := func(url string) *FeedStats {
+		if feeds[url] == nil {
+			feeds[url] = &FeedStats{URL: url}
+		}
+		return feeds[url]
+	}
+	var attempts, failures int
+	for _, ev := range events {
+		if stats.EventsSince.IsZero() {
+			stats.EventsSince = ev.Timestamp
+		}
+		switch {
+		case ev.Action == ActionFetched:
+			current = feed(ev.Link)
+			current.Fetches++
+			current.LastFetched = ev.Timestamp
+		case ev.Action == ActionFailed && ev.Site == "feed":
+			feed(ev.Link).FetchFailures++
+		case ev.Action == ActionPublished || ev.Action == ActionFailed:
+			s, ok := sites[ev.Site]
+			if !ok {
+				continue
+			}
+			s.Attempts++
+			attempts++
+			if ev.Action == ActionFailed {
+				s.Failures++
+				failures++
+			} else if current != nil {
+				current.Published++
+				current.LastPublished = ev.Timestamp
+			}
+		}
+	}
+	stats.FailureRate = rate(failures, attempts)
+
+	for _, site := range statsSites {
+		s := sites[site]
+		s.FailureRate = rate(s.Failures, s.Attempts)
+		stats.Sites = append(stats.Sites, *s)
+	}
+	for key, n := range variants {
+		stats.Variants = append(stats.Variants, VariantStats{Site: key[0], Variant: key[1], Published: n})
+	}
+	sort.Slice(stats.Variants, func(i, j int) bool {
+		a, b := stats.Variants[i], stats.Variants[j]
+		if a.Site != b.Site {
+			return slices.Index(statsSites, a.Site) < slices.Index(statsSites, b.Site)
+		}
+		return a.Variant < b.Variant
+	})
+	for _, f := range feeds {
+		stats.Feeds = append(stats.Feeds, *f)
+	}
+	sort.Slice(stats.Feeds, func(i, j int) bool {
+		return stats.Feeds[i].LastFetched.After(stats.Feeds[j].LastFetched)
+	})
+	return stats, nil
+}
+
+// variant returns the template variant p was published with on site.
+func (p TootedPost) variant(site string) string {
+	switch site {
+	case "mastodon":
+		return p.MastodonVariant
+	case "bluesky":
+		return p.BlueskyVariant
+	case "threads":
+		return p.ThreadsVariant
+	}
+	return ""
+}
+
+// rate returns n/total, or 0 when total is 0.
+func rate(n, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(n) / float64(total)
+}
@@ -0,0 +1,92 @@
+package db
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestComputeStats(t *testing.T) {
+	InitDB(filepath.Join(t.TempDir(), "stats.db"))
+	defer CloseDB()
+
+	now := time.Now()
+	require.NoError(t, StoreTootedPost("https://example.com/a", "a", "2026-01-01T00:00:00Z", time.Now(), DefaultContent, time.Local))
+	require.NoError(t, StoreTootedPost("https://example.com/b", "b", "2026-01-01T00:00:00Z", time.Now(), DefaultContent, time.Local))
+	require.NoError(t, StoreTootedPost("https://example.com/c", "c", "2026-01-01T00:00:00Z", time.Now(), DefaultContent, time.Local))
+	require.NoError(t, MarkSitePosted("https://example.com/a", "mastodon", time.Now(), time.Local))
+	require.NoError(t, MarkSitePosted("https://example.com/a", "bluesky", time.Now(), time.Local))
+	require.NoError(t, MarkSitePosted("https://example.com/b", "mastodon", time.Now(), time.Local))
+	// Backdate the first post so that the posts span two weeks.
+	require.NoError(t, DB.Model(&TootedPost{}).Where("link = ?", "https://example.com/a").Update("first_seen", now.Add(-14*24*time.Hour)).Error)
+
+	require.NoError(t, RecordEvent(ActionFetched, "", "https://example.com/old.xml", "1 items", time.Now(), time.Local))
+	require.NoError(t, RecordEvent(ActionPublished, "mastodon", "https://example.com/a", "", time.Now(), time.Local))
+	require.NoError(t, RecordEvent(ActionFailed, "feed", "https://example.com/feed.xml", "timeout", time.Now(), time.Local))
+	require.NoError(t, RecordEvent(ActionFetched, "", "https://example.com/feed.xml", "2 items", time.Now(), time.Local))
+	require.NoError(t, RecordEvent(ActionPublished, "bluesky", "https://example.com/a", "", time.Now(), time.Local))
+	require.NoError(t, RecordEvent(ActionFailed, "bluesky", "https://example.com/b", "auth failed", time.Now(), time.Local))
+	require.NoError(t, RecordEvent(ActionPublished, "mastodon", "https://example.com/b", "", time.Now(), time.Local))
+
+	stats, err := ComputeStats(now)
+	require.NoError(t, err)
+	assert.Equal(t, 3, stats.Posts)
+	assert.Equal(t, 2, stats.Published)
+	assert.InDelta(t, 1.0, stats.PostsPerWeek, 0.01)
+	assert.InDelta(t, 0.25, stats.FailureRate, 0.001)
+	assert.False(t, stats.LastPosted.IsZero())
+
+	require.Len(t, stats.Sites, 4)
+	assert.Equal(t, SiteStats{Site: "mastodon", Published: 2, Attempts: 2}, stats.Sites[0])
+	assert.Equal(t, SiteStats{Site: "bluesky", Published: 1, Attempts: 2, Failures: 1, FailureRate: 0.5}, stats.Sites[1])
+	assert.Equal(t, SiteStats{Site: "threads"}, stats.Sites[2])
+	assert.Equal(t, SiteStats{Site: "newsletter"}, stats.Sites[3])
+
+	require.Len(t, stats.Feeds, 2)
+	feed := stats.Feeds[0]
+	assert.Equal(t, "https://example.com/feed.xml", feed.URL)
+	assert.Equal(t, 1, feed.Fetches)
+	assert.Equal(t, 1, feed.FetchFailures)
+	assert.Equal(t, 2, feed.Published)
+	assert.Equal(t, "https://example.com/old.xml", stats.Feeds[1].URL)
+	assert.Equal(t, 1, stats.Feeds[1].Published)
+}
+
+func TestComputeStats_Variants(t *testing.T) {
+	InitDB(filepath.Join(t.TempDir(), "stats.db"))
+	defer CloseDB()
+
+	for _, link := range []string{"https://example.com/a", "https://example.com/b", "https://example.com/c"} {
+		require.NoError(t, StoreTootedPost(link, "content", "2026-01-01T00:00:00Z", time.Now(), DefaultContent, time.Local))
+		require.NoError(t, MarkSitePosted(link, "mastodon", time.Now(), time.Local))
+	}
+	require.NoError(t, SetSiteVariant("https://example.com/a", "mastodon", "teaser"))
+	require.NoError(t, SetSiteVariant("https://example.com/b", "mastodon", "teaser"))
+	require.NoError(t, SetSiteVariant("https://example.com/c", "mastodon", "short"))
+	// Variants of sites the post was not published to are not counted.
+	require.NoError(t, SetSiteVariant("https://example.com/c", "bluesky", "short"))
+	require.Error(t, SetSiteVariant("https://example.com/missing", "mastodon", "short"))
+
+	stats, err := ComputeStats(time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, []VariantStats{
+		{Site: "mastodon", Variant: "short", Published: 1},
+		{Site: "mastodon", Variant: "teaser", Published: 2},
+	}, stats.Variants)
+}
+
+func TestComputeStats_Empty(t *testing.T) {
+	InitDB(filepath.Join(t.TempDir(), "stats.db"))
+	defer CloseDB()
+
+	stats, err := ComputeStats(time.Now())
+	require.NoError(t, err)
+	assert.Zero(t, stats.Posts)
+	assert.Zero(t, stats.PostsPerWeek)
+	assert.Zero(t, stats.FailureRate)
+	assert.Len(t, stats.Sites, 4)
+	assert.Empty(t, stats.Feeds)
+}
@@ -0,0 +1,243 @@
+// Package errreport reports errors and panics to Sentry, so that recurring
+// problems show up as aggregated trends rather than as one notification per
+// occurrence. Events are sent by a Reporter to the store endpoint of the
+// project named by its DSN, in the background; a nil Reporter reports
+// nothing.
+package errreport
+
+import (
+	"bytes"
+	"cmp"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/toozej/rss2socials/internal/redact"
+	"github.com/toozej/rss2socials/pkg/version"
+)
+
+// Event is an error to report.
+type Event struct {
+	// Message summarizes what failed, e.g. "Failed to publish to Mastodon",
+	// and titles the issue together with Err.
+	Message string
+	Err     error
+	// Tags are indexed by Sentry for searching and grouping, e.g. the feed,
+	// network and post link.
+	Tags map[string]string
+	// Fingerprint groups events into issues. Sentry groups by stack trace
+	// and message when it is empty.
+	Fingerprint []string
+}
+
+// Reporter sends events to a Sentry project. Its methods do nothing on a
+// nil Reporter, so that reporting is disabled by not creating one.
+type Reporter struct {
+	storeURL    string
+	auth        string
+	environment string
+	client      *http.Client
+	wg          sync.WaitGroup
+}
+
+// New returns a Reporter to the Sentry project of dsn, e.g.
+// "https://public@o1.ingest.sentry.io/42", tagging events with environment.
+// It returns nil when dsn is empty.
+func New(dsn, environment string) (*Reporter, error) {
+	if dsn == "" {
+		return nil, nil
+	}
+	u, err := url.Parse(dsn)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.User == nil {
+		// The DSN is not quoted, as it contains the project key.
+		return nil, errors.New("invalid Sentry DSN: must look like https://key@host/project")
+	}
+	dir, project := "", strings.Trim(u.Path, "/")
+	if i := strings.LastIndex(project, "/"); i >= 0 {
+		dir, project = "/"+project[:i], project[i+1:]
+	}
+	if project == "" {
+		return nil, errors.New("invalid Sentry DSN: the project ID is missing")
+	}
+	return &Reporter{
+		storeURL:    fmt.Sprintf("%s://%s%s/api/%s/store/", u.Scheme, u.Host, dir, project),
+		auth:        fmt.Sprintf("Sentry sentry_version=7, sentry_client=rss2socials/%s, sentry_key=%s", version.Version, u.User.Username()),
+		environment: environment,
+		client:      &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+// Enabled reports whether r reports events, that is whether it is not nil.
+func (r *Reporter) Enabled() bool {
+	return r != nil
+}
+
+// Capture reports ev in the background.
+func (r *Reporter) Capture(ev Event) {
+	if r != nil {
+		r.sendAsync(r.payload(ev, "error", "", stacktrace(3)))
+	}
+}
+
+// CapturePanic reports v, a value recovered from a panic, in the background.
+// ev adds context, e.g. the post being handled; its Err is replaced by v. It
+// is meant to be called by the deferred function that recovered v, so that
+// the reported stack includes the panicking frames.
+func (r *Reporter) CapturePanic(v any, ev Event) {
+	if r != nil {
+		ev.Err = fmt.Errorf("%v", v)
+		r.sendAsync(r.payload(ev, "error", "panic", stacktrace(3)))
+	}
+}
+
+// Recover reports a panic, waits for it to be sent and panics again. It must
+// be deferred directly: defer r.Recover().
+func (r *Reporter) Recover() {
+	v := recover()
+	if v == nil {
+		return
+	}
+	if r != nil {
+		body := r.payload(Event{Err: fmt.Errorf("%v", v)}, "fatal", "panic", stacktrace(4))
+		if err := r.send(body); err != nil {
+			log.Warnf("Failed to report panic to Sentry: %v", err)
+		}
+	}
+	panic(v)
+}
+
+// Flush waits up to timeout for the events being sent, and reports whether
+// they all were.
+func (r *Reporter) Flush(timeout time.Duration) bool {
+	if r == nil {
+		return true
+	}
+	done := make(chan struct{})
+	go func() {
+		r.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// frame is a stack frame in Sentry's format.
+type frame struct {
+	Function string `json:"function"`
+	AbsPath  string `json:"abs_path"`
+	Lineno   int    `json:"lineno"`
+	InApp    bool   `json:"in_app"`
+}
+
+// stacktrace returns the stack of the caller skip frames up, oldest first
+// as Sentry expects.
+func stacktrace(skip int) []frame {
+	pcs := make([]uintptr, 64)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(skip, pcs)])
+	var out []frame
+	for {
+		f, more := frames.Next()
+		out = append(out, frame{
+			Function: f.Function,
+			AbsPath:  f.File,
+			Lineno:   f.Line,
+			InApp:    strings.HasPrefix(f.Function, "github.com/toozej/rss2socials/"),
+		})
+		if !more {
+			break
+		}
+	}
+	slices.Reverse(out)
+	return out
+}
+
+// payload encodes ev as a Sentry event. Secrets are redacted from its
+// message and tags.
+func (r *Reporter) payload(ev Event, level, errType string, frames []frame) []byte {
+	if errType == "" {
+		errType = cmp.Or(ev.Message, "error")
+	}
+	message, value := ev.Message, ev.Message
+	if ev.Err != nil {
+		value = ev.Err.Error()
+		message = cmp.Or(ev.Message, errType) + ": " + value
+	}
+	tags := make(map[string]string, len(ev.Tags))
+	for k, v := range ev.Tags {
+		tags[k] = redact.String(v)
+	}
+	id := make([]byte, 16)
+	_, _ = rand.Read(id)
+	host, _ := os.Hostname()
+
+	event := map[string]any{
+		"event_id":    hex.EncodeToString(id),
+		"timestamp":   time.Now().UTC().Format(time.RFC3339),
+		"platform":    "go",
+		"level":       level,
+		"logger":      "rss2socials",
+		"server_name": host,
+		"release":     "rss2socials@" + version.Version,
+		"message":     map[string]string{"formatted": redact.String(message)},
+		"exception": map[string]any{"values": []map[string]any{{
+			"type":       errType,
+			"value":      redact.String(value),
+			"stacktrace": map[string]any{"frames": frames},
+		}}},
+		"tags": tags,
+	}
+	if r.environment != "" {
+		event["environment"] = r.environment
+	}
+	if len(ev.Fingerprint) > 0 {
+		event["fingerprint"] = ev.Fingerprint
+	}
+	body, _ := json.Marshal(event)
+	return body
+}
+
+// sendAsync sends an encoded event in the background; Flush waits for it.
+func (r *Reporter) sendAsync(body []byte) {
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		if err := r.send(body); err != nil {
+			log.Warnf("Failed to report error to Sentry: %v", err)
+		}
+	}()
+}
+
+// send posts an encoded event to the store endpoint.
+func (r *Reporter) send(body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, r.storeURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Sentry-Auth", r.auth)
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected HTTP status: %d", resp.StatusCode)
+	}
+	return nil
+}
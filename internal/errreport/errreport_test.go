@@ -0,0 +1,141 @@
+package errreport
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSentry records the events posted to it.
+type fakeSentry struct {
+	mu     sync.Mutex
+	paths  []string
+	auths  []string
+	events []map[string]any
+}
+
+func newFakeSentry(t *testing.T) (*fakeSentry, string) {
+	t.Helper()
+	f := &fakeSentry{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event map[string]any
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		f.mu.Lock()
+		f.paths = append(f.paths, r.URL.Path)
+		f.auths = append(f.auths, r.Header.Get("X-Sentry-Auth"))
+		f.events = append(f.events, event)
+		f.mu.Unlock()
+	}))
+	t.Cleanup(srv.Close)
+	return f, strings.Replace(srv.URL, "http://", "http://publickey@", 1)
+}
+
+func TestNew(t *testing.T) {
+	r, err := New("", "")
+	require.NoError(t, err)
+	assert.False(t, r.Enabled())
+
+	for _, dsn := range []string{"not a url", "https://o1.ingest.sentry.io/42", "https://key@o1.ingest.sentry.io/", "ftp://key@host/1"} {
+		_, err := New(dsn, "")
+		assert.Error(t, err, dsn)
+	}
+
+	r, err = New("https://key@sentry.example.com/prefix/42", "production")
+	require.NoError(t, err)
+	assert.True(t, r.Enabled())
+	assert.Equal(t, "https://sentry.example.com/prefix/api/42/store/", r.storeURL)
+	assert.Contains(t, r.auth, "sentry_key=key")
+}
+
+func TestCapture(t *testing.T) {
+	f, dsn := newFakeSentry(t)
+	r, err := New(dsn+"/42", "staging")
+	require.NoError(t, err)
+
+	r.Capture(Event{
+		Message:     "Failed to publish to Mastodon",
+		Err:         errors.New("connection refused"),
+		Tags:        map[string]string{"network": "mastodon", "link": "https://example.com/post"},
+		Fingerprint: []string{"publish-failure", "mastodon"},
+	})
+	require.True(t, r.Flush(5*time.Second))
+
+	require.Len(t, f.events, 1)
+	assert.Equal(t, "/api/42/store/", f.paths[0])
+	assert.Contains(t, f.auths[0], "sentry_key=publickey")
+	event := f.events[0]
+	assert.Equal(t, "error", event["level"])
+	assert.Equal(t, "staging", event["environment"])
+	assert.Equal(t, map[string]any{"formatted": "Failed to publish to Mastodon: connection refused"}, event["message"])
+	assert.Equal(t, map[string]any{"network": "mastodon", "link": "https://example.com/post"}, event["tags"])
+	assert.Equal(t, []any{"publish-failure", "mastodon"}, event["fingerprint"])
+
+	exception := event["exception"].(map[string]any)["values"].([]any)[0].(map[string]any)
+	assert.Equal(t, "Failed to publish to Mastodon", exception["type"])
+	assert.Equal(t, "connection refused", exception["value"])
+	frames := exception["stacktrace"].(map[string]any)["frames"].([]any)
+	last := frames[len(frames)-1].(map[string]any)
+	assert.Contains(t, last["function"], "TestCapture", "the newest frame is the caller of Capture")
+}
+
+func TestRecover(t *testing.T) {
+	f, dsn := newFakeSentry(t)
+	r, err := New(dsn+"/42", "")
+	require.NoError(t, err)
+
+	assert.PanicsWithValue(t, "boom", func() {
+		defer r.Recover()
+		panic("boom")
+	}, "the panic continues once reported")
+
+	require.Len(t, f.events, 1, "the panic is sent before Recover returns")
+	event := f.events[0]
+	assert.Equal(t, "fatal", event["level"])
+	exception := event["exception"].(map[string]any)["values"].([]any)[0].(map[string]any)
+	assert.Equal(t, "panic", exception["type"])
+	assert.Equal(t, "boom", exception["value"])
+}
+
+func TestCapturePanic(t *testing.T) {
+	f, dsn := newFakeSentry(t)
+	r, err := New(dsn+"/42", "")
+	require.NoError(t, err)
+
+	func() {
+		defer func() {
+			if v := recover(); v != nil {
+				r.CapturePanic(v, Event{Message: "Panic publishing to Bluesky", Tags: map[string]string{"network": "bluesky"}})
+			}
+		}()
+		panic("nil response")
+	}()
+	require.True(t, r.Flush(5*time.Second))
+
+	require.Len(t, f.events, 1)
+	event := f.events[0]
+	assert.Equal(t, "error", event["level"])
+	assert.Equal(t, map[string]any{"formatted": "Panic publishing to Bluesky: nil response"}, event["message"])
+	exception := event["exception"].(map[string]any)["values"].([]any)[0].(map[string]any)
+	assert.Equal(t, "panic", exception["type"])
+	assert.Equal(t, "nil response", exception["value"])
+}
+
+func TestCapture_Disabled(t *testing.T) {
+	var r *Reporter
+	r.Capture(Event{Err: errors.New("ignored")})
+	assert.True(t, r.Flush(time.Second))
+	assert.NotPanics(t, func() {
+		defer r.Recover()
+	})
+}
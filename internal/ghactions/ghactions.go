@@ -0,0 +1,111 @@
+// Package ghactions reports to GitHub Actions when rss2socials runs as a
+// scheduled workflow: it writes workflow commands that annotate the run, e.g.
+// ::error title=...::message, and appends a summary table to the job summary
+// at GITHUB_STEP_SUMMARY.
+package ghactions
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// SummaryEnv names the file GitHub Actions renders as the job summary.
+const SummaryEnv = "GITHUB_STEP_SUMMARY"
+
+// Row is a line of the summary table.
+type Row struct {
+	Event  string
+	Site   string
+	Link   string
+	Detail string
+}
+
+// Reporter writes workflow commands to w and collects the rows of the
+// summary table. It is safe for concurrent use.
+type Reporter struct {
+	mu   sync.Mutex
+	w    io.Writer
+	rows []Row
+}
+
+// New returns a Reporter writing workflow commands to w, which must be the
+// standard output of the step.
+func New(w io.Writer) *Reporter {
+	return &Reporter{w: w}
+}
+
+// Error annotates the run with an error.
+func (r *Reporter) Error(title, message string) {
+	r.command("error", title, message)
+}
+
+// Notice annotates the run with a notice.
+func (r *Reporter) Notice(title, message string) {
+	r.command("notice", title, message)
+}
+
+func (r *Reporter) command(name, title, message string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, _ = fmt.Fprintf(r.w, "::%s title=%s::%s\n", name, escapeProperty(title), escapeData(message))
+}
+
+// Add adds row to the summary table.
+func (r *Reporter) Add(row Row) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.rows = append(r.rows, row)
+}
+
+// WriteSummary appends the summary table, headed by title, to the file named
+// by GITHUB_STEP_SUMMARY. It does nothing outside of GitHub Actions.
+func (r *Reporter) WriteSummary(title string) error {
+	path := os.Getenv(SummaryEnv)
+	if path == "" {
+		return nil
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644) // #nosec G304 -- the path is set by the workflow runner
+	if err != nil {
+		return fmt.Errorf("failed to open job summary: %w", err)
+	}
+	if _, err := io.WriteString(f, r.Summary(title)); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("failed to write job summary: %w", err)
+	}
+	return f.Close()
+}
+
+// Summary returns the summary table as markdown.
+func (r *Reporter) Summary(title string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var b strings.Builder
+	fmt.Fprintf(&b, "### %s\n\n", title)
+	if len(r.rows) == 0 {
+		b.WriteString("Nothing was published.\n")
+		return b.String()
+	}
+	b.WriteString("| Event | Site | Post | Detail |\n| --- | --- | --- | --- |\n")
+	for _, row := range r.rows {
+		fmt.Fprintf(&b, "| %s | %s | %s | %s |\n", escapeCell(row.Event), escapeCell(row.Site), escapeCell(row.Link), escapeCell(row.Detail))
+	}
+	return b.String()
+}
+
+// escapeData escapes the message of a workflow command.
+func escapeData(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(s)
+}
+
+// escapeProperty escapes a property value of a workflow command.
+func escapeProperty(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C").Replace(s)
+}
+
+// escapeCell keeps s from breaking out of a markdown table cell.
+func escapeCell(s string) string {
+	return strings.NewReplacer("|", `\|`, "\r", " ", "\n", " ").Replace(s)
+}
@@ -0,0 +1,50 @@
+package ghactions
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReporter_Commands(t *testing.T) {
+	var out strings.Builder
+	r := New(&out)
+
+	r.Error("Publishing to Bluesky failed", "https://example.com/a: 100% down\nretrying")
+	r.Notice("Published: a, b", "https://example.com/a")
+
+	assert.Equal(t,
+		"::error title=Publishing to Bluesky failed::https://example.com/a: 100%25 down%0Aretrying\n"+
+			"::notice title=Published%3A a%2C b::https://example.com/a\n",
+		out.String())
+}
+
+func TestReporter_WriteSummary(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "summary.md")
+	require.NoError(t, os.WriteFile(path, []byte("previous step\n"), 0o600))
+	t.Setenv(SummaryEnv, path)
+
+	r := New(&strings.Builder{})
+	r.Add(Row{Event: "published", Site: "Mastodon", Link: "https://example.com/a"})
+	r.Add(Row{Event: "failed", Site: "Bluesky", Link: "https://example.com/a", Detail: "a | b"})
+	require.NoError(t, r.WriteSummary("rss2socials"))
+
+	got, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "previous step\n"+
+		"### rss2socials\n\n"+
+		"| Event | Site | Post | Detail |\n| --- | --- | --- | --- |\n"+
+		"| published | Mastodon | https://example.com/a |  |\n"+
+		"| failed | Bluesky | https://example.com/a | a \\| b |\n", string(got))
+}
+
+func TestReporter_WriteSummaryOutsideActions(t *testing.T) {
+	t.Setenv(SummaryEnv, "")
+	r := New(&strings.Builder{})
+	assert.NoError(t, r.WriteSummary("rss2socials"))
+	assert.Equal(t, "### rss2socials\n\nNothing was published.\n", r.Summary("rss2socials"))
+}
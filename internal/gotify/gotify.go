@@ -4,15 +4,44 @@ package gotify
 
 import (
 	"bytes"
+	"cmp"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
+	"strings"
+	"time"
 
 	log "github.com/sirupsen/logrus"
+	"github.com/toozej/rss2socials/internal/httpbody"
+	"github.com/toozej/rss2socials/internal/redact"
 	"github.com/toozej/rss2socials/pkg/config"
 )
 
+// defaultPriority is used when neither the message nor the configuration
+// specify a priority.
+const defaultPriority = 5
+
+// client sends the notifications. Its timeout keeps an unresponsive Gotify
+// server from holding up the failure it is told about.
+var client = &http.Client{Timeout: 10 * time.Second}
+
+// Message is a single Gotify notification.
+type Message struct {
+	// Title is the notification title.
+	Title string
+	// Message is the notification body.
+	Message string
+	// Priority is the Gotify priority. Zero uses the configured GotifyPriority.
+	Priority int
+	// ClickURL, when set, is opened by Gotify clients when the notification
+	// is clicked (e.g. the post that failed to publish).
+	ClickURL string
+	// Token is the token of the Gotify application to send to. Empty uses
+	// the configured GotifyToken.
+	Token string
+}
+
 // LogFailure logs the error and sends a notification to the Gotify instance.
 func LogFailure(message string, err error, conf *config.Config) {
 	log.Printf("%s: %s", message, err)
@@ -34,18 +63,39 @@ func LogSuccess(message string, conf *config.Config) {
 	}
 }
 
-// SendGotifyNotification sends a notification to Gotify.
+// SendGotifyNotification sends a notification to Gotify with the configured priority.
 func SendGotifyNotification(conf *config.Config, title, message string) error {
-	// sendGotifyNotification sends a notification to the Gotify instance using the provided configuration.
-	// It marshals the notification data as JSON and posts it via HTTP.
-	if conf.GotifyURL == "" || conf.GotifyToken == "" {
+	return Send(conf, Message{Title: title, Message: message})
+}
+
+// Send sends msg to the Gotify instance using the provided configuration.
+// The application token is passed in the X-Gotify-Key header rather than the
+// URL so that it does not end up in proxy or access logs.
+func Send(conf *config.Config, msg Message) error {
+	token := cmp.Or(msg.Token, conf.GotifyToken)
+	if conf.GotifyURL == "" || token == "" {
 		return errors.New("gotify URL or token is not configured")
 	}
 
+	priority := msg.Priority
+	if priority == 0 {
+		priority = conf.GotifyPriority
+	}
+	if priority <= 0 {
+		priority = defaultPriority
+	}
+
 	notification := map[string]interface{}{
-		"title":    title,
-		"message":  message,
-		"priority": 5,
+		"title":    redact.String(msg.Title),
+		"message":  redact.String(msg.Message),
+		"priority": priority,
+	}
+	if msg.ClickURL != "" {
+		notification["extras"] = map[string]interface{}{
+			"client::notification": map[string]interface{}{
+				"click": map[string]string{"url": msg.ClickURL},
+			},
+		}
 	}
 
 	jsonData, err := json.Marshal(notification)
@@ -53,14 +103,14 @@ func SendGotifyNotification(conf *config.Config, title, message string) error {
 		return fmt.Errorf("failed to marshal Gotify notification: %w", err)
 	}
 
-	req, err := http.NewRequest("POST", fmt.Sprintf("%s/message?token=%s", conf.GotifyURL, conf.GotifyToken), bytes.NewBuffer(jsonData))
+	req, err := http.NewRequest("POST", strings.TrimSuffix(conf.GotifyURL, "/")+"/message", bytes.NewBuffer(jsonData))
 	if err != nil {
 		return fmt.Errorf("failed to create Gotify request: %w", err)
 	}
 
 	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Gotify-Key", token)
 
-	client := &http.Client{}
 	resp, err := client.Do(req) // #nosec G704 -- GotifyURL is from config, not user input
 	if err != nil {
 		return fmt.Errorf("failed to send Gotify request: %w", err)
@@ -68,7 +118,7 @@ func SendGotifyNotification(conf *config.Config, title, message string) error {
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("gotify returned non-OK status: %s", resp.Status)
+		return fmt.Errorf("gotify returned non-OK status: %s", httpbody.Status(resp))
 	}
 
 	return nil
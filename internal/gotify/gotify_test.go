@@ -1,10 +1,12 @@
 package gotify
 
 import (
+	"encoding/json"
 	"errors"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/toozej/rss2socials/pkg/config"
 )
@@ -67,8 +69,11 @@ func TestSendGotifyNotification_Success(t *testing.T) {
 			t.Errorf("Expected POST request, got %s", r.Method)
 		}
 
-		if r.URL.Query().Get("token") != "test-token" {
-			t.Errorf("Expected token 'test-token', got %s", r.URL.Query().Get("token"))
+		if r.Header.Get("X-Gotify-Key") != "test-token" {
+			t.Errorf("Expected X-Gotify-Key 'test-token', got %s", r.Header.Get("X-Gotify-Key"))
+		}
+		if r.URL.Query().Get("token") != "" {
+			t.Errorf("Expected no token in query string, got %s", r.URL.RawQuery)
 		}
 
 		w.WriteHeader(http.StatusOK)
@@ -105,6 +110,28 @@ func TestSendGotifyNotification_Failure(t *testing.T) {
 	}
 }
 
+// Test SendGotifyNotification with a server that does not respond
+func TestSendGotifyNotification_Timeout(t *testing.T) {
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-done
+	}))
+	defer server.Close()
+	defer close(done)
+	defer func(c *http.Client) { client = c }(client)
+	client = &http.Client{Timeout: 50 * time.Millisecond}
+
+	conf := &config.Config{
+		GotifyURL:   server.URL,
+		GotifyToken: "test-token",
+	}
+
+	err := SendGotifyNotification(conf, "Test Title", "Test Message")
+	if err == nil {
+		t.Error("Expected a timeout error, got nil")
+	}
+}
+
 // Test 	SendGotifyNotification with missing URL
 func TestSendGotifyNotification_MissingURL(t *testing.T) {
 	conf := &config.Config{
@@ -130,3 +157,59 @@ func TestSendGotifyNotification_MissingToken(t *testing.T) {
 		t.Errorf("Expected 'gotify URL or token is not configured', got %v", err)
 	}
 }
+
+// Test Send with custom priority and click URL extras
+func TestSend_PriorityAndClickURL(t *testing.T) {
+	var payload map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Errorf("failed to decode payload: %v", err)
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	conf := &config.Config{
+		GotifyURL:      server.URL,
+		GotifyToken:    "test-token",
+		GotifyPriority: 8,
+	}
+
+	err := Send(conf, Message{Title: "Failed", Message: "boom", ClickURL: "https://example.com/post"})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if payload["priority"] != float64(8) {
+		t.Errorf("Expected priority 8, got %v", payload["priority"])
+	}
+	extras, _ := payload["extras"].(map[string]interface{})
+	notification, _ := extras["client::notification"].(map[string]interface{})
+	click, _ := notification["click"].(map[string]interface{})
+	if click["url"] != "https://example.com/post" {
+		t.Errorf("Expected click URL in extras, got %v", payload["extras"])
+	}
+}
+
+// Test Send falls back to the default priority when none is configured
+func TestSend_DefaultPriority(t *testing.T) {
+	var payload map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Errorf("failed to decode payload: %v", err)
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	conf := &config.Config{GotifyURL: server.URL, GotifyToken: "test-token"}
+	if err := Send(conf, Message{Title: "t", Message: "m"}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if payload["priority"] != float64(5) {
+		t.Errorf("Expected default priority 5, got %v", payload["priority"])
+	}
+	if _, ok := payload["extras"]; ok {
+		t.Errorf("Expected no extras without click URL, got %v", payload["extras"])
+	}
+}
@@ -0,0 +1,98 @@
+// Package httpbody reads the bodies of HTTP responses within size limits,
+// so that a misbehaving server cannot make rss2socials read an unbounded
+// amount of data into memory, and formats the bodies of error responses
+// the same way for every API client.
+package httpbody
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// MaxJSON caps the JSON documents decoded from API responses.
+	MaxJSON = 1 << 20
+	// MaxErrorText caps how much of the body of an error response is read
+	// and included in errors.
+	MaxErrorText = 512
+)
+
+// TooLargeError is returned when a body is longer than Limit bytes.
+type TooLargeError struct {
+	Limit int64
+}
+
+func (e *TooLargeError) Error() string {
+	return fmt.Sprintf("response body exceeds %d bytes", e.Limit)
+}
+
+// Read reads r to the end, returning a *TooLargeError when it holds more
+// than limit bytes.
+func Read(r io.Reader, limit int64) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, &TooLargeError{Limit: limit}
+	}
+	return data, nil
+}
+
+// DecodeJSON decodes the JSON document read from r into v. Fields v does
+// not have are ignored, as APIs add fields over time, but a document larger
+// than MaxJSON, or followed by anything but whitespace, is an error.
+func DecodeJSON(r io.Reader, v any) error {
+	data, err := Read(r, MaxJSON)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+	if _, err := dec.Token(); !errors.Is(err, io.EOF) {
+		return errors.New("unexpected data after the JSON document")
+	}
+	return nil
+}
+
+// ErrorText returns the start of the body read from r for an error
+// message: at most MaxErrorText bytes, cut at a character boundary and
+// marked with "…" when the body is longer, with runs of whitespace
+// collapsed.
+func ErrorText(r io.Reader) string {
+	data, _ := io.ReadAll(io.LimitReader(r, MaxErrorText+1))
+	cut := len(data) > MaxErrorText
+	if cut {
+		data = data[:MaxErrorText]
+		// Drop the bytes of a character that was cut in half.
+		for i := 0; i < utf8.UTFMax-1 && len(data) > 0; i++ {
+			if r, _ := utf8.DecodeLastRune(data); r != utf8.RuneError {
+				break
+			}
+			data = data[:len(data)-1]
+		}
+	}
+	text := strings.Join(strings.Fields(string(data)), " ")
+	if cut {
+		text += "…"
+	}
+	return text
+}
+
+// Status returns the status of resp followed by the start of its body, see
+// ErrorText, for errors about unexpected responses, e.g.
+// "403 Forbidden: invalid token".
+func Status(resp *http.Response) string {
+	if text := ErrorText(resp.Body); text != "" {
+		return resp.Status + ": " + text
+	}
+	return resp.Status
+}
@@ -0,0 +1,50 @@
+package httpbody
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRead(t *testing.T) {
+	data, err := Read(strings.NewReader("12345"), 5)
+	require.NoError(t, err)
+	assert.Equal(t, "12345", string(data))
+
+	_, err = Read(strings.NewReader("123456"), 5)
+	var tooLarge *TooLargeError
+	require.ErrorAs(t, err, &tooLarge)
+	assert.EqualError(t, err, "response body exceeds 5 bytes")
+}
+
+func TestDecodeJSON(t *testing.T) {
+	var v struct {
+		Name string `json:"name"`
+	}
+	require.NoError(t, DecodeJSON(strings.NewReader(`{"name":"a","added_later":1}`+"\n"), &v), "unknown fields are ignored")
+	assert.Equal(t, "a", v.Name)
+
+	assert.ErrorContains(t, DecodeJSON(strings.NewReader(`{"name":"a"}{"name":"b"}`), &v), "unexpected data")
+	assert.ErrorContains(t, DecodeJSON(strings.NewReader(`<html>Bad gateway</html>`), &v), "invalid character")
+	assert.ErrorContains(t, DecodeJSON(strings.NewReader(`{"name":"`+strings.Repeat("a", MaxJSON)+`"}`), &v), "exceeds")
+}
+
+func TestErrorText(t *testing.T) {
+	assert.Equal(t, `{"error": "invalid token"}`, ErrorText(strings.NewReader("  {\"error\":\n\t\"invalid token\"}\n")))
+	assert.Equal(t, "", ErrorText(strings.NewReader("")))
+
+	long := ErrorText(strings.NewReader(strings.Repeat("a", MaxErrorText-1) + "ééé"))
+	assert.Equal(t, strings.Repeat("a", MaxErrorText-1)+"…", long, "cut characters are dropped")
+}
+
+func TestStatus(t *testing.T) {
+	resp := &http.Response{Status: "403 Forbidden", Body: io.NopCloser(strings.NewReader("invalid token\n"))}
+	assert.Equal(t, "403 Forbidden: invalid token", Status(resp))
+
+	resp = &http.Response{Status: "502 Bad Gateway", Body: http.NoBody}
+	assert.Equal(t, "502 Bad Gateway", Status(resp))
+}
@@ -0,0 +1,74 @@
+// Package keyring stores secrets in the keyring of the operating system, so
+// that desktop users need not keep tokens in a plaintext .env file: the
+// login keychain on macOS, the Secret Service (GNOME Keyring, KWallet) on
+// Linux through secret-tool, and files encrypted with DPAPI for the current
+// user on Windows.
+//
+// Secrets are identified by a service, e.g. "rss2socials", and a key, e.g.
+// the name of the environment variable they replace.
+package keyring
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// ErrNotFound is returned by Get and Delete when the keyring holds no
+// secret for the service and key.
+var ErrNotFound = errors.New("secret not found in the keyring")
+
+// ErrUnsupported is returned on platforms without a supported keyring.
+var ErrUnsupported = errors.New("no OS keyring is supported on this platform")
+
+// Get returns the secret stored for service and key.
+func Get(service, key string) (string, error) {
+	return get(service, key)
+}
+
+// Set stores secret for service and key, replacing any secret stored before.
+func Set(service, key, secret string) error {
+	if key == "" {
+		return errors.New("keyring key must not be empty")
+	}
+	return set(service, key, secret)
+}
+
+// Delete removes the secret stored for service and key.
+func Delete(service, key string) error {
+	return del(service, key)
+}
+
+// run runs the command name with args, writing stdin to its standard input,
+// and returns its standard output. It is replaceable in tests.
+var run = func(stdin, name string, args ...string) ([]byte, error) {
+	cmd := exec.Command(name, args...) // #nosec G204 -- the keyring tools are fixed, the arguments are passed without a shell
+	cmd.Stdin = strings.NewReader(stdin)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return out, &toolError{name: name, code: exitErr.ExitCode(), stderr: strings.TrimSpace(stderr.String())}
+		}
+		return out, fmt.Errorf("failed to run %s: %w", name, err)
+	}
+	return out, nil
+}
+
+// toolError is the failure of a keyring tool with exit code code.
+type toolError struct {
+	name   string
+	code   int
+	stderr string
+}
+
+func (e *toolError) Error() string {
+	if e.stderr == "" {
+		return fmt.Sprintf("%s exited with code %d", e.name, e.code)
+	}
+	return fmt.Sprintf("%s exited with code %d: %s", e.name, e.code, e.stderr)
+}
@@ -0,0 +1,51 @@
+package keyring
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// The login keychain is used through the security tool, with the service
+// and key as the service and account of a generic password.
+
+// errSecItemNotFound is the exit code of security for missing items.
+const errSecItemNotFound = 44
+
+func get(service, key string) (string, error) {
+	out, err := run("", "security", "find-generic-password", "-s", service, "-a", key, "-w")
+	switch {
+	case exitCode(err) == errSecItemNotFound:
+		return "", ErrNotFound
+	case err != nil:
+		return "", err
+	}
+	return strings.TrimSuffix(string(out), "\n"), nil
+}
+
+func set(service, key, secret string) error {
+	// The secret is passed hex encoded on standard input rather than as an
+	// argument, which other users could see in the process list.
+	cmd := fmt.Sprintf("add-generic-password -U -s %q -a %q -X %s\n", service, key, hex.EncodeToString([]byte(secret)))
+	_, err := run(cmd, "security", "-i")
+	return err
+}
+
+func del(service, key string) error {
+	_, err := run("", "security", "delete-generic-password", "-s", service, "-a", key)
+	if exitCode(err) == errSecItemNotFound {
+		return ErrNotFound
+	}
+	return err
+}
+
+// exitCode returns the exit code of the keyring tool err is the failure of,
+// or -1.
+func exitCode(err error) int {
+	var te *toolError
+	if errors.As(err, &te) {
+		return te.code
+	}
+	return -1
+}
@@ -0,0 +1,36 @@
+package keyring
+
+import (
+	"errors"
+	"strings"
+)
+
+// The Secret Service is used through secret-tool of libsecret, with the
+// service and key as the attributes of the secret.
+
+func get(service, key string) (string, error) {
+	out, err := run("", "secret-tool", "lookup", "service", service, "key", key)
+	var te *toolError
+	switch {
+	// secret-tool also exits with 1 on errors, which it explains.
+	case errors.As(err, &te) && te.code == 1 && te.stderr == "" && len(out) == 0:
+		return "", ErrNotFound
+	case err != nil:
+		return "", err
+	}
+	return strings.TrimSuffix(string(out), "\n"), nil
+}
+
+func set(service, key, secret string) error {
+	_, err := run(secret, "secret-tool", "store", "--label="+service+" "+key, "service", service, "key", key)
+	return err
+}
+
+func del(service, key string) error {
+	// secret-tool clear succeeds whether or not there was a secret.
+	if _, err := get(service, key); err != nil {
+		return err
+	}
+	_, err := run("", "secret-tool", "clear", "service", service, "key", key)
+	return err
+}
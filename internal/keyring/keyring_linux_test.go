@@ -0,0 +1,68 @@
+package keyring
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSecretTool replaces run with an in-memory secret-tool.
+func fakeSecretTool(t *testing.T) map[string]string {
+	t.Helper()
+	secrets := make(map[string]string)
+	original := run
+	run = func(stdin, name string, args ...string) ([]byte, error) {
+		require.Equal(t, "secret-tool", name)
+		attrs := args[len(args)-4:]
+		require.Equal(t, []string{"service", "rss2socials", "key"}, attrs[:3])
+		key := attrs[3]
+		switch args[0] {
+		case "lookup":
+			secret, ok := secrets[key]
+			if !ok {
+				return nil, &toolError{name: name, code: 1}
+			}
+			return []byte(secret), nil
+		case "store":
+			assert.Equal(t, "--label=rss2socials "+key, args[1])
+			secrets[key] = stdin
+		case "clear":
+			delete(secrets, key)
+		}
+		return nil, nil
+	}
+	t.Cleanup(func() { run = original })
+	return secrets
+}
+
+func TestKeyring(t *testing.T) {
+	secrets := fakeSecretTool(t)
+
+	_, err := Get("rss2socials", "MASTODON_ACCESS_TOKEN")
+	require.ErrorIs(t, err, ErrNotFound)
+
+	require.NoError(t, Set("rss2socials", "MASTODON_ACCESS_TOKEN", "s3cret"))
+	assert.Equal(t, "s3cret", secrets["MASTODON_ACCESS_TOKEN"], "the secret is passed on standard input")
+	got, err := Get("rss2socials", "MASTODON_ACCESS_TOKEN")
+	require.NoError(t, err)
+	assert.Equal(t, "s3cret", got)
+
+	require.NoError(t, Delete("rss2socials", "MASTODON_ACCESS_TOKEN"))
+	assert.Empty(t, secrets)
+	require.ErrorIs(t, Delete("rss2socials", "MASTODON_ACCESS_TOKEN"), ErrNotFound)
+	require.Error(t, Set("rss2socials", "", "s3cret"))
+}
+
+func TestGet_ToolFailure(t *testing.T) {
+	original := run
+	run = func(string, string, ...string) ([]byte, error) {
+		return nil, &toolError{name: "secret-tool", code: 1, stderr: "Cannot autolaunch D-Bus without X11 $DISPLAY"}
+	}
+	defer func() { run = original }()
+
+	_, err := Get("rss2socials", "MASTODON_ACCESS_TOKEN")
+	require.Error(t, err)
+	assert.NotErrorIs(t, err, ErrNotFound)
+	assert.Contains(t, err.Error(), "D-Bus")
+}
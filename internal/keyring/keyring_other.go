@@ -0,0 +1,9 @@
+//go:build !darwin && !linux && !windows
+
+package keyring
+
+func get(string, string) (string, error) { return "", ErrUnsupported }
+
+func set(string, string, string) error { return ErrUnsupported }
+
+func del(string, string) error { return ErrUnsupported }
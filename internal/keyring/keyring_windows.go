@@ -0,0 +1,111 @@
+package keyring
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// Secrets are encrypted with DPAPI for the current user and stored in
+// files under the user's configuration directory, e.g.
+// %AppData%\rss2socials\keyring\MASTODON_ACCESS_TOKEN.
+
+// keyPattern matches keys that are safe to use as file names.
+var keyPattern = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+func path(service, key string) (string, error) {
+	if !keyPattern.MatchString(service) || !keyPattern.MatchString(key) {
+		return "", fmt.Errorf("invalid keyring key %q", key)
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, service, "keyring", key), nil
+}
+
+func get(service, key string) (string, error) {
+	p, err := path(service, key)
+	if err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(p) // #nosec G304 -- the path is built from a validated key
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", ErrNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	secret, err := unprotect(data)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt %s: %w", key, err)
+	}
+	return string(secret), nil
+}
+
+func set(service, key, secret string) error {
+	p, err := path(service, key)
+	if err != nil {
+		return err
+	}
+	data, err := protect([]byte(secret))
+	if err != nil {
+		return fmt.Errorf("failed to encrypt %s: %w", key, err)
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o700); err != nil {
+		return err
+	}
+	return os.WriteFile(p, data, 0o600)
+}
+
+func del(service, key string) error {
+	p, err := path(service, key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); errors.Is(err, fs.ErrNotExist) {
+		return ErrNotFound
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
+
+func protect(data []byte) ([]byte, error) {
+	var out windows.DataBlob
+	if err := windows.CryptProtectData(blob(data), nil, nil, 0, nil, windows.CRYPTPROTECT_UI_FORBIDDEN, &out); err != nil {
+		return nil, err
+	}
+	return take(&out), nil
+}
+
+func unprotect(data []byte) ([]byte, error) {
+	var out windows.DataBlob
+	if err := windows.CryptUnprotectData(blob(data), nil, nil, 0, nil, windows.CRYPTPROTECT_UI_FORBIDDEN, &out); err != nil {
+		return nil, err
+	}
+	return take(&out), nil
+}
+
+// blob returns a DataBlob of data.
+func blob(data []byte) *windows.DataBlob {
+	if len(data) == 0 {
+		return &windows.DataBlob{}
+	}
+	return &windows.DataBlob{Size: uint32(len(data)), Data: &data[0]} // #nosec G115 -- secrets are far below 4 GiB
+}
+
+// take copies the data of a DataBlob allocated by DPAPI and frees it.
+func take(b *windows.DataBlob) []byte {
+	if b.Data == nil {
+		return nil
+	}
+	defer windows.LocalFree(windows.Handle(unsafe.Pointer(b.Data))) // #nosec G103 -- the blob was allocated by DPAPI with LocalAlloc
+	return append([]byte(nil), unsafe.Slice(b.Data, b.Size)...)
+}
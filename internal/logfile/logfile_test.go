@@ -0,0 +1,67 @@
+package logfile
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func read(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	return string(data)
+}
+
+func TestWriter_Rotates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "rss2socials.log")
+	w, err := Open(path, 1, 2)
+	require.NoError(t, err)
+	defer w.Close()
+
+	line := strings.Repeat("a", 600*1024) + "\n"
+	for _, prefix := range []string{"1", "2", "3", "4"} {
+		_, err := w.Write([]byte(prefix + line))
+		require.NoError(t, err)
+	}
+
+	assert.True(t, strings.HasPrefix(read(t, path), "4"), "the newest entry is in the current file")
+	assert.True(t, strings.HasPrefix(read(t, path+".1"), "3"))
+	assert.True(t, strings.HasPrefix(read(t, path+".2"), "2"))
+	assert.NoFileExists(t, path+".3", "only maxBackups rotated files are kept")
+}
+
+func TestWriter_AppendsToExistingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rss2socials.log")
+	require.NoError(t, os.WriteFile(path, []byte("before\n"), 0o644))
+
+	w, err := Open(path, 0, 0)
+	require.NoError(t, err)
+	_, err = w.Write([]byte("after\n"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	assert.Equal(t, "before\nafter\n", read(t, path))
+	_, err = w.Write([]byte("closed\n"))
+	assert.ErrorIs(t, err, os.ErrClosed)
+}
+
+func TestWriter_NoBackups(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rss2socials.log")
+	w, err := Open(path, 1, 0)
+	require.NoError(t, err)
+	defer w.Close()
+
+	line := strings.Repeat("a", 600*1024)
+	_, err = w.Write([]byte("1" + line))
+	require.NoError(t, err)
+	_, err = w.Write([]byte("2" + line))
+	require.NoError(t, err)
+
+	assert.True(t, strings.HasPrefix(read(t, path), "2"))
+	assert.NoFileExists(t, path+".1")
+}
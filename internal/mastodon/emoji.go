@@ -0,0 +1,88 @@
+package mastodon
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/toozej/rss2socials/internal/httpbody"
+	"github.com/toozej/rss2socials/internal/posttemplate"
+	"github.com/toozej/rss2socials/pkg/config"
+)
+
+// CustomEmojis fetches the shortcodes of the custom emoji of the instance at
+// conf.MastodonURL from GET /api/v1/custom_emojis.
+func CustomEmojis(ctx context.Context, conf config.Config) ([]string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(conf.MastodonURL, "/")+"/api/v1/custom_emojis", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := instanceClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("HTTP request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected HTTP status: %d", resp.StatusCode)
+	}
+
+	var emojis []struct {
+		Shortcode string `json:"shortcode"`
+	}
+	if err := httpbody.DecodeJSON(resp.Body, &emojis); err != nil {
+		return nil, fmt.Errorf("failed to parse custom emoji: %w", err)
+	}
+	codes := make([]string, 0, len(emojis))
+	for _, e := range emojis {
+		codes = append(codes, e.Shortcode)
+	}
+	return codes, nil
+}
+
+// UnknownEmojis returns the custom emoji shortcodes of the templates and
+// footer lines of Mastodon posts that are not among known, by where they
+// are used, e.g. "post template" or "footer lines".
+func UnknownEmojis(conf config.Config, known []string) map[string][]string {
+	unknown := make(map[string][]string)
+	check := func(name string, codes []string) {
+		for _, code := range codes {
+			if !slices.Contains(known, code) && !slices.Contains(unknown[name], code) {
+				unknown[name] = append(unknown[name], code)
+			}
+		}
+	}
+	templates := posttemplate.SiteTemplates(conf, "mastodon")
+	for _, name := range slices.Sorted(maps.Keys(templates)) {
+		// Templates that do not parse are reported by Validate.
+		codes, _ := posttemplate.Shortcodes(templates[name])
+		check(name+" template", codes)
+	}
+	for _, line := range conf.SiteFooterLines("mastodon") {
+		check("footer lines", posttemplate.TextShortcodes(line))
+	}
+	return unknown
+}
+
+// checkEmojis warns about custom emoji shortcodes in the templates and
+// footer lines of Mastodon posts that the instance does not have, as they
+// are posted as text.
+func checkEmojis(ctx context.Context, conf config.Config) {
+	known, err := CustomEmojis(ctx, conf)
+	if err != nil {
+		log.Warnf("Failed to fetch the custom emoji of %s: %v", conf.MastodonURL, err)
+		return
+	}
+	unknown := UnknownEmojis(conf, known)
+	for _, name := range slices.Sorted(maps.Keys(unknown)) {
+		codes := unknown[name]
+		for i, code := range codes {
+			codes[i] = ":" + code + ":"
+		}
+		log.Warnf("Custom emoji %s in the %s are unknown to %s and would be posted as text", strings.Join(codes, ", "), name, conf.MastodonURL)
+	}
+}
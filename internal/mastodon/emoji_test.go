@@ -0,0 +1,46 @@
+package mastodon
+
+import (
+	"context"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/toozej/rss2socials/pkg/config"
+)
+
+func TestCustomEmojis(t *testing.T) {
+	srv := newInstanceServer(t, map[string]string{
+		"/api/v1/custom_emojis": `[{"shortcode":"blobcat","url":"https://example.com/blobcat.png"},{"shortcode":"rss"}]`,
+	})
+
+	codes, err := CustomEmojis(context.Background(), config.Config{MastodonURL: srv.URL})
+	if err != nil {
+		t.Fatalf("CustomEmojis() unexpected error: %v", err)
+	}
+	if !slices.Equal(codes, []string{"blobcat", "rss"}) {
+		t.Errorf("CustomEmojis() = %v, want [blobcat rss]", codes)
+	}
+
+	if _, err := CustomEmojis(context.Background(), config.Config{MastodonURL: srv.URL + "/missing"}); err == nil {
+		t.Error("CustomEmojis() expected error for a missing API")
+	}
+}
+
+func TestUnknownEmojis(t *testing.T) {
+	conf := config.Config{
+		PostTemplate:        `:rss: {{emoji "blobcat"}} {{.Link}}`,
+		TemplateVariants:    []string{`bluesky/teaser=:sparkles: {{.Link}}`, `short=:wave: {{.Link}}`},
+		FooterLines:         []string{"Everywhere :heart:"},
+		MastodonFooterLines: []string{"Support me :kofi: :rss:"},
+	}
+
+	got := UnknownEmojis(conf, []string{"rss", "blobcat"})
+	want := map[string][]string{
+		"short variant template": {"wave"},
+		"footer lines":           {"kofi"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("UnknownEmojis() = %v, want %v", got, want)
+	}
+}
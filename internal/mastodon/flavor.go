@@ -0,0 +1,200 @@
+package mastodon
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/toozej/rss2socials/internal/charcount"
+	"github.com/toozej/rss2socials/internal/httpbody"
+	"github.com/toozej/rss2socials/pkg/config"
+)
+
+// Flavor describes how a Mastodon API compatible server behaves where it
+// matters for publishing.
+type Flavor struct {
+	// MaxChars is the server's default status length limit.
+	MaxChars int
+	// ShortensLinks is set for servers that count every link as
+	// charcount.MastodonURLLength characters. Links are counted in full on
+	// the others, which at worst truncates a little early.
+	ShortensLinks bool
+	// RequiresMedia is set for servers that reject statuses without an
+	// attachment.
+	RequiresMedia bool
+	// CanEdit is set for servers that support editing statuses with
+	// PUT /api/v1/statuses/{id}.
+	CanEdit bool
+	// CanSchedule is set for servers that publish statuses created with
+	// scheduled_at at that time.
+	CanSchedule bool
+	// MaxImages is the maximum number of attachments of a status.
+	MaxImages int
+}
+
+// Flavors are the known Mastodon API compatible servers, by
+// Config.MastodonFlavor.
+var Flavors = map[string]Flavor{
+	config.MastodonFlavorMastodon:   {MaxChars: 500, ShortensLinks: true, CanEdit: true, CanSchedule: true, MaxImages: 4},
+	config.MastodonFlavorGoToSocial: {MaxChars: 5000, CanEdit: true, MaxImages: 6},
+	config.MastodonFlavorAkkoma:     {MaxChars: 5000, CanEdit: true, CanSchedule: true, MaxImages: 4},
+	// Pixelfed statuses are captions of photo posts.
+	config.MastodonFlavorPixelfed: {MaxChars: 500, RequiresMedia: true, MaxImages: 4},
+}
+
+// FlavorOf returns the Flavor of conf.MastodonFlavor, or Mastodon's for
+// unknown flavors.
+func FlavorOf(conf config.Config) Flavor {
+	if f, ok := Flavors[conf.MastodonFlavor]; ok {
+		return f
+	}
+	return Flavors[config.MastodonFlavorMastodon]
+}
+
+// MaxChars returns the status length limit: conf.MastodonMaxChars when set,
+// or else the flavor's default.
+func MaxChars(conf config.Config) int {
+	if conf.MastodonMaxChars > 0 {
+		return conf.MastodonMaxChars
+	}
+	return FlavorOf(conf).MaxChars
+}
+
+// countAs returns the charcount site whose counting matches the server.
+func countAs(conf config.Config) string {
+	if FlavorOf(conf).ShortensLinks {
+		return "mastodon"
+	}
+	return "" // code points, links in full
+}
+
+// Truncate shortens content to the status length limit, counted the way the
+// server counts it.
+func Truncate(conf config.Config, content string) string {
+	return charcount.Truncate(countAs(conf), content, MaxChars(conf))
+}
+
+// Analyze returns the length of content as the server counts it, compared to
+// the status length limit.
+func Analyze(conf config.Config, content string) charcount.Analysis {
+	return charcount.Analysis{Site: "mastodon", Count: charcount.Count(countAs(conf), content), Limit: MaxChars(conf)}
+}
+
+// Instance is what the instance API of a server says about it.
+type Instance struct {
+	Version string
+	// Flavor is the flavor detected from Version.
+	Flavor string
+	// MaxChars is the status length limit, or zero when not reported.
+	MaxChars int
+}
+
+var instanceClient = &http.Client{Timeout: 10 * time.Second}
+
+// instanceBody is the part of the instance API responses that is used. v1
+// and v2 share it, except for the Pleroma and Akkoma extension.
+type instanceBody struct {
+	Version       string `json:"version"`
+	Configuration struct {
+		Statuses struct {
+			MaxCharacters int `json:"max_characters"`
+		} `json:"statuses"`
+	} `json:"configuration"`
+	// MaxTootChars is reported by Pleroma and Akkoma in v1.
+	MaxTootChars int `json:"max_toot_chars"`
+}
+
+// GetInstance fetches GET /api/v2/instance of conf.MastodonURL, or
+// /api/v1/instance on servers without v2, such as Mastodon before 4.0,
+// Akkoma and Pixelfed.
+func GetInstance(ctx context.Context, conf config.Config) (Instance, error) {
+	body, status, err := getInstance(ctx, conf, "/api/v2/instance")
+	if status == http.StatusNotFound || (err == nil && body.Configuration.Statuses.MaxCharacters == 0) {
+		if v1, _, v1Err := getInstance(ctx, conf, "/api/v1/instance"); v1Err == nil || err != nil {
+			body, err = v1, v1Err
+		}
+	}
+	if err != nil {
+		return Instance{}, err
+	}
+
+	inst := Instance{
+		Version:  body.Version,
+		Flavor:   DetectFlavor(body.Version),
+		MaxChars: body.Configuration.Statuses.MaxCharacters,
+	}
+	if inst.MaxChars == 0 {
+		inst.MaxChars = body.MaxTootChars
+	}
+	return inst, nil
+}
+
+// getInstance fetches the instance API at path and returns the response
+// status along with the decoded body.
+func getInstance(ctx context.Context, conf config.Config, path string) (instanceBody, int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(conf.MastodonURL, "/")+path, nil)
+	if err != nil {
+		return instanceBody{}, 0, err
+	}
+	resp, err := instanceClient.Do(req)
+	if err != nil {
+		return instanceBody{}, 0, fmt.Errorf("HTTP request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return instanceBody{}, resp.StatusCode, fmt.Errorf("unexpected HTTP status: %d", resp.StatusCode)
+	}
+
+	var body instanceBody
+	if err := httpbody.DecodeJSON(resp.Body, &body); err != nil {
+		return instanceBody{}, resp.StatusCode, fmt.Errorf("failed to parse instance: %w", err)
+	}
+	return body, resp.StatusCode, nil
+}
+
+// DetectFlavor returns the flavor of a server from the version of its
+// instance API. Compatible servers report a Mastodon version followed by
+// their own, e.g. "3.5.3 (compatible; Pixelfed 0.12.4)"; GoToSocial reports
+// its own 0.x version only.
+func DetectFlavor(version string) string {
+	v := strings.ToLower(version)
+	switch {
+	case strings.Contains(v, "pixelfed"):
+		return config.MastodonFlavorPixelfed
+	case strings.Contains(v, "akkoma"), strings.Contains(v, "pleroma"):
+		return config.MastodonFlavorAkkoma
+	case strings.Contains(v, "gotosocial"), strings.HasPrefix(v, "0."):
+		return config.MastodonFlavorGoToSocial
+	}
+	return config.MastodonFlavorMastodon
+}
+
+// Verify checks conf.MastodonFlavor against the instance at conf.MastodonURL
+// and, unless conf.MastodonMaxChars is set, adopts the status length limit
+// the instance reports. A flavor mismatch is logged; the configured flavor
+// is kept. Custom emoji the instance does not have are logged too.
+func Verify(ctx context.Context, conf *config.Config) error {
+	inst, err := GetInstance(ctx, *conf)
+	if err != nil {
+		return fmt.Errorf("failed to fetch mastodon instance: %w", err)
+	}
+
+	flavor := conf.MastodonFlavor
+	if flavor == "" {
+		flavor = config.MastodonFlavorMastodon
+	}
+	if inst.Flavor != flavor {
+		log.Warnf("MASTODON_FLAVOR is %s, but %s looks like %s (version %q); set MASTODON_FLAVOR=%s if posts fail",
+			flavor, conf.MastodonURL, inst.Flavor, inst.Version, inst.Flavor)
+	}
+	if conf.MastodonMaxChars == 0 && inst.MaxChars > 0 {
+		conf.MastodonMaxChars = inst.MaxChars
+		log.Infof("Using the status length limit of %s: %d characters", conf.MastodonURL, inst.MaxChars)
+	}
+	checkEmojis(ctx, *conf)
+	return nil
+}
@@ -0,0 +1,223 @@
+package mastodon
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/toozej/rss2socials/internal/rss"
+	"github.com/toozej/rss2socials/pkg/config"
+)
+
+func TestDetectFlavor(t *testing.T) {
+	tests := []struct {
+		version string
+		want    string
+	}{
+		{"4.3.2", config.MastodonFlavorMastodon},
+		{"4.4.0-nightly.2025-01-01", config.MastodonFlavorMastodon},
+		{"3.5.3 (compatible; Pixelfed 0.12.4)", config.MastodonFlavorPixelfed},
+		{"2.7.2 (compatible; Akkoma 3.13.2)", config.MastodonFlavorAkkoma},
+		{"2.7.2 (compatible; Pleroma 2.6.0)", config.MastodonFlavorAkkoma},
+		{"0.17.3+git-3bd8ac8", config.MastodonFlavorGoToSocial},
+		{"", config.MastodonFlavorMastodon},
+	}
+	for _, tt := range tests {
+		if got := DetectFlavor(tt.version); got != tt.want {
+			t.Errorf("DetectFlavor(%q) = %q, want %q", tt.version, got, tt.want)
+		}
+	}
+}
+
+// newInstanceServer serves the given instance API responses by path, e.g.
+// "/api/v1/instance".
+func newInstanceServer(t *testing.T, bodies map[string]string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := bodies[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, body)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestGetInstance(t *testing.T) {
+	tests := []struct {
+		name     string
+		bodies   map[string]string
+		flavor   string
+		maxChars int
+	}{
+		{
+			name: "v2 preferred",
+			bodies: map[string]string{
+				"/api/v2/instance": `{"version":"4.3.2","configuration":{"statuses":{"max_characters":1500}}}`,
+				"/api/v1/instance": `{"version":"4.3.2","configuration":{"statuses":{"max_characters":500}}}`,
+			},
+			flavor:   config.MastodonFlavorMastodon,
+			maxChars: 1500,
+		},
+		{
+			name: "v1 only",
+			bodies: map[string]string{
+				"/api/v1/instance": `{"version":"0.17.3+git-3bd8ac8","configuration":{"statuses":{"max_characters":2000}}}`,
+			},
+			flavor:   config.MastodonFlavorGoToSocial,
+			maxChars: 2000,
+		},
+		{
+			name: "v2 without limit",
+			bodies: map[string]string{
+				"/api/v2/instance": `{"version":"2.7.2 (compatible; Akkoma 3.13.2)"}`,
+				"/api/v1/instance": `{"version":"2.7.2 (compatible; Akkoma 3.13.2)","max_toot_chars":8000}`,
+			},
+			flavor:   config.MastodonFlavorAkkoma,
+			maxChars: 8000,
+		},
+		{
+			name: "no limit reported",
+			bodies: map[string]string{
+				"/api/v2/instance": `{"version":"4.3.2"}`,
+			},
+			flavor: config.MastodonFlavorMastodon,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newInstanceServer(t, tt.bodies)
+			inst, err := GetInstance(context.Background(), config.Config{MastodonURL: srv.URL + "/"})
+			if err != nil {
+				t.Fatalf("GetInstance() unexpected error: %v", err)
+			}
+			if inst.Flavor != tt.flavor || inst.MaxChars != tt.maxChars {
+				t.Errorf("GetInstance() = %+v, want %s with %d characters", inst, tt.flavor, tt.maxChars)
+			}
+		})
+	}
+}
+
+func TestVerify(t *testing.T) {
+	srv := newInstanceServer(t, map[string]string{
+		"/api/v1/instance": `{"version":"4.3.2","configuration":{"statuses":{"max_characters":1000}}}`,
+	})
+
+	conf := config.Config{MastodonURL: srv.URL, MastodonFlavor: config.MastodonFlavorMastodon}
+	if err := Verify(context.Background(), &conf); err != nil {
+		t.Fatalf("Verify() unexpected error: %v", err)
+	}
+	if conf.MastodonMaxChars != 1000 {
+		t.Errorf("MastodonMaxChars = %d, want the instance's 1000", conf.MastodonMaxChars)
+	}
+
+	conf = config.Config{MastodonURL: srv.URL, MastodonMaxChars: 300}
+	if err := Verify(context.Background(), &conf); err != nil {
+		t.Fatalf("Verify() unexpected error: %v", err)
+	}
+	if conf.MastodonMaxChars != 300 {
+		t.Errorf("MastodonMaxChars = %d, want the configured 300", conf.MastodonMaxChars)
+	}
+
+	conf = config.Config{MastodonURL: srv.URL + "/missing"}
+	if err := Verify(context.Background(), &conf); err == nil {
+		t.Error("Verify() expected error for an unreachable instance API")
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	content := "New post: https://example.com/" + strings.Repeat("a", 600)
+
+	if got := Truncate(config.Config{}, content); got != content {
+		t.Errorf("Mastodon counts the link as 23 characters, got %q", got)
+	}
+	gts := config.Config{MastodonFlavor: config.MastodonFlavorGoToSocial, MastodonMaxChars: 500}
+	if got := Truncate(gts, content); got != "New post:…" {
+		t.Errorf("GoToSocial counts the link in full, got %q", got)
+	}
+	if a := Analyze(gts, content); a.Limit != 500 || a.Count != len(content) {
+		t.Errorf("Analyze() = %+v, want %d of 500", a, len(content))
+	}
+	if got := MaxChars(config.Config{MastodonFlavor: config.MastodonFlavorAkkoma}); got != 5000 {
+		t.Errorf("MaxChars() = %d, want Akkoma's default 5000", got)
+	}
+}
+
+func TestPublish_PixelfedRequiresMedia(t *testing.T) {
+	conf := config.Config{
+		MastodonURL:         "http://127.0.0.1:0",
+		MastodonAccessToken: "test-token",
+		MastodonFlavor:      config.MastodonFlavorPixelfed,
+	}
+	if _, err := Publish(conf, "Text only", Options{}); err == nil || !strings.Contains(err.Error(), "requires an image") {
+		t.Errorf("Publish() error = %v, want an error about the missing image", err)
+	}
+}
+
+func TestPublishWithImages(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 32, 32))); err != nil {
+		t.Fatal(err)
+	}
+
+	var uploads []string
+	var mediaIDs []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/image.png":
+			w.Header().Set("Content-Type", "image/png")
+			_, _ = w.Write(buf.Bytes())
+		case "/api/v2/media":
+			if err := r.ParseMultipartForm(1 << 20); err != nil {
+				t.Errorf("failed to parse upload: %v", err)
+			}
+			uploads = append(uploads, r.FormValue("description"))
+			fmt.Fprintf(w, `{"id":"media-%d"}`, len(uploads))
+		case "/api/v1/statuses":
+			if err := r.ParseForm(); err != nil {
+				t.Errorf("failed to parse form: %v", err)
+			}
+			mediaIDs = r.PostForm["media_ids[]"]
+			fmt.Fprint(w, `{"id":"123"}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	conf := config.Config{
+		MastodonURL:         srv.URL,
+		MastodonAccessToken: "test-token",
+		MastodonFlavor:      config.MastodonFlavorPixelfed,
+		MediaCacheDir:       filepath.Join(t.TempDir(), "media"),
+	}
+	id, err := PublishWithImages(context.Background(), conf, "Caption", Options{}, []rss.Image{
+		{URL: srv.URL + "/missing.png", Alt: "skipped"},
+		{URL: srv.URL + "/image.png", Alt: "A picture"},
+	})
+	if err != nil {
+		t.Fatalf("PublishWithImages() unexpected error: %v", err)
+	}
+	if id != "123" {
+		t.Errorf("PublishWithImages() = %q, want 123", id)
+	}
+	if len(uploads) != 1 || uploads[0] != "A picture" {
+		t.Errorf("uploads = %q, want the usable image with its alt text", uploads)
+	}
+	if len(mediaIDs) != 1 || mediaIDs[0] != "media-1" {
+		t.Errorf("media_ids = %q, want [media-1]", mediaIDs)
+	}
+
+	if _, err := PublishWithImages(context.Background(), conf, "Caption", Options{}, []rss.Image{{URL: srv.URL + "/missing.png"}}); err == nil {
+		t.Error("PublishWithImages() expected error when Pixelfed gets no usable image")
+	}
+}
@@ -6,12 +6,31 @@ package mastodon
 import (
 	"context"
 	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
 
 	"github.com/mattn/go-mastodon"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/toozej/rss2socials/internal/httpbody"
+	"github.com/toozej/rss2socials/internal/media"
+	"github.com/toozej/rss2socials/internal/messages"
 	"github.com/toozej/rss2socials/internal/rss"
 	"github.com/toozej/rss2socials/pkg/config"
 )
 
+// ImageLimits are the constraints images are scaled down to before they are
+// uploaded. They are within the defaults of all supported flavors.
+var ImageLimits = media.Limits{MaxBytes: 8_000_000, MaxDimension: 3840}
+
+// MinScheduleLead is how far in the future a status must be scheduled.
+// Mastodon rejects scheduled_at less than five minutes ahead; the extra
+// minute absorbs request latency and clock skew.
+const MinScheduleLead = 6 * time.Minute
+
 // GetTootContent constructs the toot message for the given RSS item.
 // Only the link is included to avoid posting large content that may exceed
 // social site API limits or render poorly.
@@ -29,16 +48,221 @@ func NewClient(conf config.Config) *mastodon.Client {
 	})
 }
 
+// Account returns the account the access token belongs to, e.g.
+// "@blog@mastodon.social".
+func Account(ctx context.Context, conf config.Config) (string, error) {
+	acct, err := NewClient(conf).GetAccountCurrentUser(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch mastodon account: %w", err)
+	}
+	if strings.Contains(acct.Acct, "@") {
+		return "@" + acct.Acct, nil
+	}
+	u, err := url.Parse(conf.MastodonURL)
+	if err != nil || u.Host == "" {
+		return "@" + acct.Acct, nil
+	}
+	return "@" + acct.Acct + "@" + u.Host, nil
+}
+
+// CheckCredentials verifies the access token with verify_credentials.
+// Mastodon access tokens do not expire, but they can be revoked.
+func CheckCredentials(ctx context.Context, conf config.Config) error {
+	if _, err := NewClient(conf).GetAccountCurrentUser(ctx); err != nil {
+		return fmt.Errorf("mastodon rejected the access token: %w", err)
+	}
+	return nil
+}
+
 // TootPost sends a post to Mastodon using the go-mastodon library.
 func TootPost(conf config.Config, content string) error {
+	_, err := Publish(conf, content, Options{})
+	return err
+}
+
+// Options are the optional parts of a status.
+type Options struct {
+	// ContentWarning marks the status as sensitive and hides it behind this
+	// content warning unless it is empty.
+	ContentWarning string
+	// InReplyTo is the ID of a status the status replies to.
+	InReplyTo string
+}
+
+// Publish sends a post to Mastodon with opts and returns the ID of the
+// created status, which is needed to edit it later.
+func Publish(conf config.Config, content string, opts Options) (string, error) {
 	if conf.MastodonURL == "" || conf.MastodonAccessToken == "" {
-		return fmt.Errorf("mastodon URL and access token must be set")
+		return "", fmt.Errorf("mastodon URL and access token must be set")
+	}
+
+	if FlavorOf(conf).RequiresMedia {
+		return "", fmt.Errorf("%s requires an image on every post, but the feed item has none", conf.MastodonFlavor)
+	}
+
+	return postStatus(context.Background(), NewClient(conf), conf, content, opts, nil, nil)
+}
+
+// PublishWithImages sends a post with up to the flavor's MaxImages of
+// images attached, each with its alt text. Images are fetched through the
+// media cache at Config.MediaCacheDir and scaled down to ImageLimits before
+// they are uploaded. Images that cannot be used are skipped; when none are
+// left a text-only post is sent, unless the flavor requires media. The opts
+// are those of Publish.
+func PublishWithImages(ctx context.Context, conf config.Config, content string, opts Options, images []rss.Image) (string, error) {
+	if conf.MastodonURL == "" || conf.MastodonAccessToken == "" {
+		return "", fmt.Errorf("mastodon URL and access token must be set")
 	}
 
 	client := NewClient(conf)
-	_, err := client.PostStatus(context.Background(), &mastodon.Toot{
-		Status:     content,
-		Visibility: mastodon.VisibilityPublic,
+	cache := media.NewCache(conf.MediaCacheDir)
+	var ids []mastodon.ID
+	for _, img := range images {
+		if len(ids) == FlavorOf(conf).MaxImages {
+			break
+		}
+		id, err := uploadImage(ctx, client, cache, img)
+		if err != nil {
+			log.Warnf("Skipping Mastodon image %s: %v", img.URL, err)
+			continue
+		}
+		ids = append(ids, id)
+	}
+	if len(ids) == 0 && FlavorOf(conf).RequiresMedia {
+		return "", fmt.Errorf("%s requires an image on every post, but none of the feed item's images could be uploaded", conf.MastodonFlavor)
+	}
+
+	return postStatus(ctx, client, conf, content, opts, ids, nil)
+}
+
+// CanSchedule reports whether a status can be scheduled on the server for
+// at: the flavor must support scheduling and at must be at least
+// MinScheduleLead after now.
+func CanSchedule(conf config.Config, at, now time.Time) bool {
+	return FlavorOf(conf).CanSchedule && at.Sub(now) >= MinScheduleLead
+}
+
+// Schedule creates a scheduled status that the server publishes at at. The
+// server assigns the status its ID only once it is published, so none is
+// returned. The opts are those of Publish.
+func Schedule(ctx context.Context, conf config.Config, content string, opts Options, at time.Time) error {
+	if conf.MastodonURL == "" || conf.MastodonAccessToken == "" {
+		return fmt.Errorf("mastodon URL and access token must be set")
+	}
+	if !FlavorOf(conf).CanSchedule {
+		return fmt.Errorf("%s does not support scheduled statuses", conf.MastodonFlavor)
+	}
+
+	_, err := postStatus(ctx, NewClient(conf), conf, content, opts, nil, &at)
+	return err
+}
+
+func uploadImage(ctx context.Context, client *mastodon.Client, cache *media.Cache, img rss.Image) (mastodon.ID, error) {
+	path, err := cache.Fetch(ctx, img.URL, ImageLimits)
+	if err != nil {
+		return "", err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	attachment, err := client.UploadMediaFromMedia(ctx, &mastodon.Media{File: f, Description: img.Alt})
+	if err != nil {
+		return "", fmt.Errorf("failed to upload image: %w", err)
+	}
+	return attachment.ID, nil
+}
+
+// postStatus posts content with opts, tagged with the language of
+// Config.Locale when one is configured.
+func postStatus(ctx context.Context, client *mastodon.Client, conf config.Config, content string, opts Options, mediaIDs []mastodon.ID, scheduledAt *time.Time) (string, error) {
+	status, err := client.PostStatus(ctx, &mastodon.Toot{
+		Status:      content,
+		InReplyToID: mastodon.ID(opts.InReplyTo),
+		MediaIDs:    mediaIDs,
+		Sensitive:   opts.ContentWarning != "",
+		SpoilerText: opts.ContentWarning,
+		Visibility:  mastodon.VisibilityPublic,
+		ScheduledAt: scheduledAt,
+		Language:    messages.Language(conf.Locale),
 	})
+	if err != nil {
+		return "", err
+	}
+	return string(status.ID), nil
+}
+
+// Boost reblogs the status with the given ID.
+func Boost(conf config.Config, id string) error {
+	if conf.MastodonURL == "" || conf.MastodonAccessToken == "" {
+		return fmt.Errorf("mastodon URL and access token must be set")
+	}
+	if id == "" {
+		return fmt.Errorf("mastodon status ID is required")
+	}
+
+	client := NewClient(conf)
+	_, err := client.Reblog(context.Background(), mastodon.ID(id))
+	return err
+}
+
+// Pin pins the status with the given ID to the profile via
+// POST /api/v1/statuses/{id}/pin.
+func Pin(ctx context.Context, conf config.Config, id string) error {
+	return statusAction(ctx, conf, id, "pin")
+}
+
+// Unpin unpins the status with the given ID from the profile via
+// POST /api/v1/statuses/{id}/unpin.
+func Unpin(ctx context.Context, conf config.Config, id string) error {
+	return statusAction(ctx, conf, id, "unpin")
+}
+
+// statusAction posts to the action endpoint of the status with the given
+// ID, which go-mastodon has no methods for.
+func statusAction(ctx context.Context, conf config.Config, id, action string) error {
+	if conf.MastodonURL == "" || conf.MastodonAccessToken == "" {
+		return fmt.Errorf("mastodon URL and access token must be set")
+	}
+	if id == "" {
+		return fmt.Errorf("mastodon status ID is required")
+	}
+
+	endpoint := strings.TrimSuffix(conf.MastodonURL, "/") + "/api/v1/statuses/" + url.PathEscape(id) + "/" + action
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+conf.MastodonAccessToken)
+	resp, err := NewClient(conf).Do(req)
+	if err != nil {
+		return fmt.Errorf("HTTP request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to %s status %s: HTTP %d: %s", action, id, resp.StatusCode, httpbody.ErrorText(resp.Body))
+	}
+	return nil
+}
+
+// EditPost replaces the text and content warning of the status with the
+// given ID via PUT /api/v1/statuses/{id}. The warning is that of Publish.
+func EditPost(conf config.Config, id, content, warning string) error {
+	if conf.MastodonURL == "" || conf.MastodonAccessToken == "" {
+		return fmt.Errorf("mastodon URL and access token must be set")
+	}
+	if id == "" {
+		return fmt.Errorf("mastodon status ID is required")
+	}
+
+	client := NewClient(conf)
+	_, err := client.UpdateStatus(context.Background(), &mastodon.Toot{
+		Status:      content,
+		Sensitive:   warning != "",
+		SpoilerText: warning,
+		Language:    messages.Language(conf.Locale),
+	}, mastodon.ID(id))
 	return err
 }
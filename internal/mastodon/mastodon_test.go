@@ -1,10 +1,13 @@
 package mastodon
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/toozej/rss2socials/internal/rss"
 	"github.com/toozej/rss2socials/pkg/config"
@@ -168,3 +171,164 @@ func TestTootPost(t *testing.T) {
 		})
 	}
 }
+
+func TestEditPost(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/statuses/123456" {
+			t.Errorf("Expected path /api/v1/statuses/123456, got %s", r.URL.Path)
+		}
+		if r.Method != http.MethodPut {
+			t.Errorf("Expected PUT method, got %s", r.Method)
+		}
+		if err := r.ParseForm(); err != nil {
+			t.Fatalf("failed to parse form: %v", err)
+		}
+		if status := r.Form.Get("status"); status != "Updated toot content" {
+			t.Errorf("Expected status 'Updated toot content', got %q", status)
+		}
+		if language := r.Form.Get("language"); language != "de" {
+			t.Errorf("Expected language 'de', got %q", language)
+		}
+		if sensitive, warning := r.Form.Get("sensitive"), r.Form.Get("spoiler_text"); sensitive != "true" || warning != "Sensibler Inhalt" {
+			t.Errorf("Expected a sensitive status behind 'Sensibler Inhalt', got sensitive %q and spoiler_text %q", sensitive, warning)
+		}
+		if err := json.NewEncoder(w).Encode(map[string]string{"id": "123456"}); err != nil {
+			t.Fatalf("failed to encode response body: %v", err)
+		}
+	}))
+	defer mockServer.Close()
+
+	conf := config.Config{
+		MastodonURL:         mockServer.URL,
+		MastodonAccessToken: "test-token",
+		Locale:              "de_AT",
+	}
+
+	if err := EditPost(conf, "123456", "Updated toot content", "Sensibler Inhalt"); err != nil {
+		t.Errorf("EditPost() unexpected error: %v", err)
+	}
+	if err := EditPost(conf, "", "Updated toot content", ""); err == nil {
+		t.Error("EditPost() expected error for empty status ID")
+	}
+}
+
+func TestSchedule(t *testing.T) {
+	at := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Fatalf("failed to parse form: %v", err)
+		}
+		if got := r.Form.Get("scheduled_at"); got != "2026-01-01T12:00:00Z" {
+			t.Errorf("Expected scheduled_at 2026-01-01T12:00:00Z, got %q", got)
+		}
+		if got := r.Form.Get("in_reply_to_id"); got != "6" {
+			t.Errorf("Expected in_reply_to_id 6, got %q", got)
+		}
+		if err := json.NewEncoder(w).Encode(map[string]string{"id": "7", "scheduled_at": "2026-01-01T12:00:00Z"}); err != nil {
+			t.Fatalf("failed to encode response body: %v", err)
+		}
+	}))
+	defer mockServer.Close()
+
+	conf := config.Config{
+		MastodonURL:         mockServer.URL,
+		MastodonAccessToken: "test-token",
+	}
+	if err := Schedule(context.Background(), conf, "Embargoed", Options{InReplyTo: "6"}, at); err != nil {
+		t.Errorf("Schedule() unexpected error: %v", err)
+	}
+
+	if !CanSchedule(conf, at, at.Add(-time.Hour)) {
+		t.Error("CanSchedule() = false, want true an hour ahead")
+	}
+	if CanSchedule(conf, at, at.Add(-time.Minute)) {
+		t.Error("CanSchedule() = true, want false less than MinScheduleLead ahead")
+	}
+	conf.MastodonFlavor = config.MastodonFlavorGoToSocial
+	if CanSchedule(conf, at, at.Add(-time.Hour)) {
+		t.Error("CanSchedule() = true, want false for GoToSocial")
+	}
+	if err := Schedule(context.Background(), conf, "Embargoed", Options{InReplyTo: "6"}, at); err == nil {
+		t.Error("Schedule() expected error for GoToSocial")
+	}
+}
+
+func TestPinAndUnpin(t *testing.T) {
+	var calls []string
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			t.Errorf("Expected POST method, got %s", r.Method)
+		}
+		if auth := r.Header.Get("Authorization"); auth != "Bearer test-token" {
+			t.Errorf("Expected bearer token, got %q", auth)
+		}
+		calls = append(calls, r.URL.Path)
+		if r.URL.Path == "/api/v1/statuses/999/pin" {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			_, _ = w.Write([]byte(`{"error":"Validation failed: You have already pinned the maximum number of toots"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"id":"1","pinned":true}`))
+	}))
+	defer mockServer.Close()
+
+	conf := config.Config{
+		MastodonURL:         mockServer.URL + "/",
+		MastodonAccessToken: "test-token",
+	}
+	ctx := context.Background()
+	if err := Pin(ctx, conf, "123"); err != nil {
+		t.Errorf("Pin() unexpected error: %v", err)
+	}
+	if err := Unpin(ctx, conf, "122"); err != nil {
+		t.Errorf("Unpin() unexpected error: %v", err)
+	}
+	want := []string{"/api/v1/statuses/123/pin", "/api/v1/statuses/122/unpin"}
+	if len(calls) != len(want) || calls[0] != want[0] || calls[1] != want[1] {
+		t.Errorf("Expected calls %v, got %v", want, calls)
+	}
+
+	if err := Pin(ctx, conf, "999"); err == nil || !strings.Contains(err.Error(), "maximum number") {
+		t.Errorf("Pin() expected error with the server's message, got %v", err)
+	}
+	if err := Pin(ctx, conf, ""); err == nil {
+		t.Error("Pin() expected error for empty status ID")
+	}
+	if err := Unpin(ctx, config.Config{}, "1"); err == nil {
+		t.Error("Unpin() expected error for missing configuration")
+	}
+}
+
+func TestCheckCredentials(t *testing.T) {
+	tests := []struct {
+		name          string
+		statusCode    int
+		expectedError bool
+	}{
+		{name: "Valid", statusCode: http.StatusOK},
+		{name: "Revoked", statusCode: http.StatusUnauthorized, expectedError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/api/v1/accounts/verify_credentials" {
+					t.Errorf("Expected path /api/v1/accounts/verify_credentials, got %s", r.URL.Path)
+				}
+				w.WriteHeader(tt.statusCode)
+				if tt.statusCode != http.StatusOK {
+					_, _ = w.Write([]byte(`{"error":"The access token was revoked"}`))
+					return
+				}
+				_, _ = w.Write([]byte(`{"id":"1","acct":"blog"}`))
+			}))
+			defer mockServer.Close()
+
+			conf := config.Config{MastodonURL: mockServer.URL, MastodonAccessToken: "test-token"}
+			err := CheckCredentials(context.Background(), conf)
+			if (err != nil) != tt.expectedError {
+				t.Errorf("CheckCredentials(%s): expected error: %v, got: %v", tt.name, tt.expectedError, err)
+			}
+		})
+	}
+}
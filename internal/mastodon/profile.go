@@ -0,0 +1,70 @@
+package mastodon
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/mattn/go-mastodon"
+
+	"github.com/toozej/rss2socials/pkg/config"
+)
+
+// MaxProfileFields is how many profile fields a Mastodon account can have.
+const MaxProfileFields = 4
+
+// SyncProfileFields sets the profile fields of the account to the values of
+// fields, replacing fields with the same name and appending the others. The
+// profile is only updated when a value changed, which is reported.
+func SyncProfileFields(ctx context.Context, conf config.Config, fields []config.ProfileField) (bool, error) {
+	if conf.MastodonURL == "" || conf.MastodonAccessToken == "" {
+		return false, fmt.Errorf("mastodon URL and access token must be set")
+	}
+
+	client := NewClient(conf)
+	acct, err := client.GetAccountCurrentUser(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to fetch mastodon account: %w", err)
+	}
+	// The source fields hold the values as entered, the account fields
+	// their rendered HTML.
+	current := acct.Fields
+	if acct.Source != nil && acct.Source.Fields != nil {
+		current = *acct.Source.Fields
+	}
+
+	merged, changed := mergeFields(current, fields)
+	if !changed {
+		return false, nil
+	}
+	if len(merged) > MaxProfileFields {
+		return false, fmt.Errorf("mastodon profiles have at most %d fields, and %d are needed", MaxProfileFields, len(merged))
+	}
+	if _, err := client.AccountUpdate(ctx, &mastodon.Profile{Fields: &merged}); err != nil {
+		return false, fmt.Errorf("failed to update mastodon profile: %w", err)
+	}
+	return true, nil
+}
+
+// mergeFields returns current with the values of fields set, and whether
+// any of them changed.
+func mergeFields(current []mastodon.Field, fields []config.ProfileField) ([]mastodon.Field, bool) {
+	merged := make([]mastodon.Field, 0, len(current)+len(fields))
+	for _, f := range current {
+		merged = append(merged, mastodon.Field{Name: f.Name, Value: f.Value})
+	}
+
+	changed := false
+	for _, f := range fields {
+		i := slices.IndexFunc(merged, func(m mastodon.Field) bool { return m.Name == f.Name })
+		switch {
+		case i < 0:
+			merged = append(merged, mastodon.Field{Name: f.Name, Value: f.Value})
+			changed = true
+		case merged[i].Value != f.Value:
+			merged[i].Value = f.Value
+			changed = true
+		}
+	}
+	return merged, changed
+}
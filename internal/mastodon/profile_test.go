@@ -0,0 +1,120 @@
+package mastodon
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mattn/go-mastodon"
+
+	"github.com/toozej/rss2socials/pkg/config"
+)
+
+func TestMergeFields(t *testing.T) {
+	current := []mastodon.Field{
+		{Name: "Pronouns", Value: "they/them"},
+		{Name: "Latest post", Value: "https://example.com/old"},
+	}
+	fields := []config.ProfileField{
+		{Name: "Website", Value: "https://example.com"},
+		{Name: "Latest post", Value: "https://example.com/new"},
+	}
+
+	merged, changed := mergeFields(current, fields)
+	if !changed {
+		t.Error("mergeFields() expected a change")
+	}
+	want := []mastodon.Field{
+		{Name: "Pronouns", Value: "they/them"},
+		{Name: "Latest post", Value: "https://example.com/new"},
+		{Name: "Website", Value: "https://example.com"},
+	}
+	if len(merged) != len(want) {
+		t.Fatalf("mergeFields() = %v, want %v", merged, want)
+	}
+	for i := range want {
+		if merged[i] != want[i] {
+			t.Errorf("field %d = %v, want %v", i, merged[i], want[i])
+		}
+	}
+	if current[1].Value != "https://example.com/old" {
+		t.Error("mergeFields() modified the current fields")
+	}
+
+	if _, changed := mergeFields(merged, fields); changed {
+		t.Error("mergeFields() expected no change when the values are set")
+	}
+}
+
+func TestSyncProfileFields(t *testing.T) {
+	var updates []map[string]string
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/accounts/verify_credentials":
+			_, _ = w.Write([]byte(`{"id":"1","acct":"blog",
+				"fields":[{"name":"Latest post","value":"<a href=\"https://example.com/old\">example.com/old</a>"}],
+				"source":{"fields":[{"name":"Latest post","value":"https://example.com/old"}]}}`))
+		case "/api/v1/accounts/update_credentials":
+			if r.Method != http.MethodPatch {
+				t.Errorf("Expected PATCH method, got %s", r.Method)
+			}
+			if err := r.ParseForm(); err != nil {
+				t.Fatal(err)
+			}
+			update := make(map[string]string)
+			for k := range r.PostForm {
+				update[k] = r.PostForm.Get(k)
+			}
+			updates = append(updates, update)
+			_, _ = w.Write([]byte(`{"id":"1","acct":"blog"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer mockServer.Close()
+
+	conf := config.Config{MastodonURL: mockServer.URL, MastodonAccessToken: "test-token"}
+	ctx := context.Background()
+
+	changed, err := SyncProfileFields(ctx, conf, []config.ProfileField{{Name: "Latest post", Value: "https://example.com/old"}})
+	if err != nil || changed {
+		t.Errorf("SyncProfileFields() = %v, %v; want no change", changed, err)
+	}
+	if len(updates) != 0 {
+		t.Errorf("Expected no update, got %v", updates)
+	}
+
+	changed, err = SyncProfileFields(ctx, conf, []config.ProfileField{
+		{Name: "Website", Value: "https://example.com"},
+		{Name: "Latest post", Value: "https://example.com/new"},
+	})
+	if err != nil || !changed {
+		t.Fatalf("SyncProfileFields() = %v, %v; want a change", changed, err)
+	}
+	want := map[string]string{
+		"fields_attributes[0][name]":  "Latest post",
+		"fields_attributes[0][value]": "https://example.com/new",
+		"fields_attributes[1][name]":  "Website",
+		"fields_attributes[1][value]": "https://example.com",
+	}
+	if len(updates) != 1 || len(updates[0]) != len(want) {
+		t.Fatalf("Expected one update with %v, got %v", want, updates)
+	}
+	for k, v := range want {
+		if updates[0][k] != v {
+			t.Errorf("update %s = %q, want %q", k, updates[0][k], v)
+		}
+	}
+
+	var tooMany []config.ProfileField
+	for _, name := range []string{"A", "B", "C", "D"} {
+		tooMany = append(tooMany, config.ProfileField{Name: name, Value: "x"})
+	}
+	if _, err := SyncProfileFields(ctx, conf, tooMany); err == nil {
+		t.Error("SyncProfileFields() expected error for more than 4 fields")
+	}
+	if _, err := SyncProfileFields(ctx, config.Config{}, nil); err == nil {
+		t.Error("SyncProfileFields() expected error for missing configuration")
+	}
+}
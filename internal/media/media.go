@@ -0,0 +1,274 @@
+// Package media downloads, validates and resizes the images attached to
+// social posts, caching them on disk keyed by a hash of their URL so that
+// the same image is downloaded only once no matter how many networks it is
+// attached to.
+package media
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif" // register GIF decoding
+	"image/jpeg"
+	_ "image/png" // register PNG decoding
+	"io"
+	"math"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// MinDimension is the shortest side an image must have. Smaller images
+	// are usually tracking pixels or spacers.
+	MinDimension = 16
+	// MaxPixels is the largest number of pixels an image may have, to avoid
+	// decoding decompression bombs.
+	MaxPixels = 50_000_000
+
+	// maxDownloadSize caps how much of an image is downloaded before it is
+	// given up on.
+	maxDownloadSize = 20 << 20
+)
+
+// Limits are a network's constraints on attached images. Zero fields are
+// not enforced.
+type Limits struct {
+	// MaxBytes is the largest accepted file size.
+	MaxBytes int
+	// MaxDimension is the longest accepted side, in pixels.
+	MaxDimension int
+}
+
+// Cache downloads images into a directory and keeps them there, along with
+// the variants resized for each set of Limits.
+type Cache struct {
+	// Dir is the cache directory, created on first use.
+	Dir string
+	// Client is the HTTP client used for downloads. Defaults to
+	// http.DefaultClient.
+	Client *http.Client
+}
+
+// NewCache returns a Cache storing images in dir, or in a directory below
+// os.TempDir when dir is empty.
+func NewCache(dir string) *Cache {
+	if dir == "" {
+		dir = filepath.Join(os.TempDir(), "rss2socials-media")
+	}
+	return &Cache{Dir: dir}
+}
+
+// Fetch returns the path of a local copy of the image at url that satisfies
+// limits, downloading, validating and, if needed, scaling it down and
+// re-encoding it as JPEG. Images that are already cached are not downloaded
+// again.
+func (c *Cache) Fetch(ctx context.Context, url string, limits Limits) (string, error) {
+	if err := os.MkdirAll(c.Dir, 0o700); err != nil {
+		return "", fmt.Errorf("failed to create media cache: %w", err)
+	}
+
+	key := Key(url)
+	variant := filepath.Join(c.Dir, fmt.Sprintf("%s-%d-%d", key, limits.MaxBytes, limits.MaxDimension))
+	if _, err := os.Stat(variant); err == nil {
+		return variant, nil
+	}
+
+	original := filepath.Join(c.Dir, key)
+	data, err := os.ReadFile(original)
+	if err != nil {
+		if data, err = c.download(ctx, url); err != nil {
+			return "", err
+		}
+		if err := writeFile(original, data); err != nil {
+			return "", err
+		}
+	}
+
+	if data, err = Fit(data, limits); err != nil {
+		return "", err
+	}
+	if err := writeFile(variant, data); err != nil {
+		return "", err
+	}
+	return variant, nil
+}
+
+// Key returns the cache key of url.
+func Key(url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return hex.EncodeToString(sum[:])
+}
+
+// download fetches the image at url and validates it.
+func (c *Cache) download(ctx context.Context, url string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	client := c.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("HTTP request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected HTTP status: %d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxDownloadSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxDownloadSize {
+		return nil, fmt.Errorf("image is larger than %d bytes", maxDownloadSize)
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = http.DetectContentType(data)
+	}
+	if err := Validate(contentType, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// Validate checks that contentType is an image type and that data, when it
+// is in a format that can be decoded, has sensible dimensions.
+func Validate(contentType string, data []byte) error {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil || !strings.HasPrefix(mediaType, "image/") {
+		return fmt.Errorf("unsupported content type %q", contentType)
+	}
+
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		// Formats without a registered decoder, such as WebP, are passed
+		// through as long as they do not need resizing.
+		return nil
+	}
+	if cfg.Width < MinDimension || cfg.Height < MinDimension {
+		return fmt.Errorf("image is too small: %dx%d", cfg.Width, cfg.Height)
+	}
+	if cfg.Width*cfg.Height > MaxPixels {
+		return fmt.Errorf("image has too many pixels: %dx%d", cfg.Width, cfg.Height)
+	}
+	return nil
+}
+
+// Fit returns data unchanged when it satisfies limits, and otherwise a
+// scaled-down JPEG re-encoding of it that does.
+func Fit(data []byte, limits Limits) ([]byte, error) {
+	maxBytes, maxDimension := limits.MaxBytes, limits.MaxDimension
+	if maxBytes <= 0 {
+		maxBytes = math.MaxInt
+	}
+
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	fits := len(data) <= maxBytes
+	if err == nil && maxDimension > 0 {
+		fits = fits && cfg.Width <= maxDimension && cfg.Height <= maxDimension
+	}
+	if fits {
+		return data, nil
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("image is too large and cannot be decoded for resizing: %w", err)
+	}
+
+	img := src
+	if maxDimension > 0 {
+		img = ScaleDown(src, maxDimension)
+	}
+	for quality := 85; ; quality -= 15 {
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+			return nil, fmt.Errorf("failed to encode resized image: %w", err)
+		}
+		if buf.Len() <= maxBytes {
+			return buf.Bytes(), nil
+		}
+		if quality <= 40 {
+			// Halve the dimensions and try again from the top.
+			b := img.Bounds()
+			img = ScaleDown(img, max(b.Dx(), b.Dy())/2)
+			quality = 100
+		}
+	}
+}
+
+// ScaleDown returns src scaled so that its longest side is at most maxSide,
+// averaging the source pixels covered by every destination pixel. src is
+// returned as is when it is already small enough.
+func ScaleDown(src image.Image, maxSide int) image.Image {
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if maxSide < 1 {
+		maxSide = 1
+	}
+	if w <= maxSide && h <= maxSide {
+		return src
+	}
+
+	dw, dh := maxSide, max(1, h*maxSide/w)
+	if h > w {
+		dw, dh = max(1, w*maxSide/h), maxSide
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		y0, y1 := b.Min.Y+y*h/dh, b.Min.Y+max((y+1)*h/dh, y*h/dh+1)
+		for x := 0; x < dw; x++ {
+			x0, x1 := b.Min.X+x*w/dw, b.Min.X+max((x+1)*w/dw, x*w/dw+1)
+			var r, g, bl, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := src.At(sx, sy).RGBA()
+					r, g, bl, a = r+uint64(cr), g+uint64(cg), bl+uint64(cb), a+uint64(ca)
+					n++
+				}
+			}
+			dst.Set(x, y, color.RGBA64{uint16(r / n), uint16(g / n), uint16(bl / n), uint16(a / n)})
+		}
+	}
+	return dst
+}
+
+// writeFile writes data to path atomically, so that a concurrent Fetch never
+// sees a partially written cache entry.
+func writeFile(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-")
+	if err != nil {
+		return fmt.Errorf("failed to write media cache: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write media cache: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write media cache: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to write media cache: %w", err)
+	}
+	return nil
+}
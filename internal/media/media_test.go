@@ -0,0 +1,116 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCache_FetchDownloadsOnce(t *testing.T) {
+	var downloads atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		downloads.Add(1)
+		w.Header().Set("Content-Type", "image/png")
+		_, _ = w.Write(encodePNG(t, 400, 100))
+	}))
+	defer server.Close()
+
+	cache := NewCache(t.TempDir())
+	ctx := context.Background()
+
+	path, err := cache.Fetch(ctx, server.URL+"/hero.png", Limits{})
+	require.NoError(t, err)
+	assert.FileExists(t, path)
+
+	again, err := cache.Fetch(ctx, server.URL+"/hero.png", Limits{})
+	require.NoError(t, err)
+	assert.Equal(t, path, again)
+
+	resized, err := cache.Fetch(ctx, server.URL+"/hero.png", Limits{MaxDimension: 200})
+	require.NoError(t, err)
+	assert.NotEqual(t, path, resized, "every set of limits has its own variant")
+	data, err := os.ReadFile(resized)
+	require.NoError(t, err)
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	require.NoError(t, err)
+	assert.Equal(t, 200, cfg.Width)
+	assert.Equal(t, 50, cfg.Height)
+
+	assert.EqualValues(t, 1, downloads.Load(), "the image is downloaded only once")
+}
+
+func TestCache_FetchRejectsInvalidImages(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/page.html":
+			w.Header().Set("Content-Type", "text/html")
+			_, _ = w.Write([]byte("<html></html>"))
+		case "/pixel.png":
+			w.Header().Set("Content-Type", "image/png")
+			_, _ = w.Write(encodePNG(t, 1, 1))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	cache := NewCache(t.TempDir())
+	for _, path := range []string{"/page.html", "/pixel.png", "/missing.png"} {
+		_, err := cache.Fetch(context.Background(), server.URL+path, Limits{})
+		assert.Error(t, err, path)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	img := encodePNG(t, 20, 20)
+	assert.NoError(t, Validate("image/png", img))
+	assert.NoError(t, Validate("image/webp", []byte("RIFF....WEBP")), "undecodable formats pass")
+	assert.Error(t, Validate("text/html; charset=utf-8", img))
+	assert.Error(t, Validate("", img))
+	assert.Error(t, Validate("image/png", encodePNG(t, 20, 8)))
+}
+
+func TestFit(t *testing.T) {
+	small := encodePNG(t, 10, 10)
+	got, err := Fit(small, Limits{MaxBytes: 1_000_000, MaxDimension: 2000})
+	require.NoError(t, err)
+	assert.Equal(t, small, got, "images within the limits are unchanged")
+
+	got, err = Fit(encodePNG(t, 4000, 100), Limits{MaxBytes: 1_000_000, MaxDimension: 2000})
+	require.NoError(t, err)
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(got))
+	require.NoError(t, err)
+	assert.Equal(t, "jpeg", format)
+	assert.Equal(t, 2000, cfg.Width)
+	assert.Equal(t, 50, cfg.Height)
+
+	got, err = Fit(encodePNG(t, 300, 300), Limits{MaxBytes: 2000})
+	require.NoError(t, err)
+	assert.LessOrEqual(t, len(got), 2000, "dimensions are reduced until the size fits")
+
+	_, err = Fit(bytes.Repeat([]byte("x"), 101), Limits{MaxBytes: 100})
+	assert.Error(t, err, "oversized images that cannot be decoded are rejected")
+}
+
+func encodePNG(t *testing.T, w, h int) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.RGBA{uint8(x * 7), uint8(y * 13), uint8(x ^ y), 255})
+		}
+	}
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, img))
+	return buf.Bytes()
+}
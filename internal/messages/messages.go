@@ -0,0 +1,122 @@
+// Package messages is the catalog of the user-facing phrases that end up in
+// social posts, such as the "New post:" prefix of the default templates,
+// translated per locale so that non-English blogs do not post a mix of
+// languages.
+//
+// Post templates look phrases up with the msg function, e.g.
+//
+//	{{msg "new_post"}} {{.Link}}
+package messages
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Message keys.
+const (
+	// NewPost prefixes the announcement of a new post.
+	NewPost = "new_post"
+	// UpdatedPost prefixes the announcement of an updated post.
+	UpdatedPost = "updated_post"
+	// AddedSection prefixes the headings an update added, in the
+	// description of what changed.
+	AddedSection = "added_section"
+	// AddedText prefixes a sentence an update added, in the description of
+	// what changed.
+	AddedText = "added_text"
+	// ContentWarning is the content warning of sensitive Mastodon posts.
+	ContentWarning = "content_warning"
+	// Previously prefixes the link to the previous post in the same
+	// category.
+	Previously = "previously"
+)
+
+// DefaultLocale is used when no locale is configured, and for phrases
+// missing from a locale.
+const DefaultLocale = "en"
+
+// catalog maps locales to the phrases of every message key.
+var catalog = map[string]map[string]string{
+	"en": {NewPost: "New post:", UpdatedPost: "Updated post:", AddedSection: "added section on", AddedText: "added:", ContentWarning: "Sensitive content", Previously: "Previously:"},
+	"de": {NewPost: "Neuer Beitrag:", UpdatedPost: "Aktualisierter Beitrag:", AddedSection: "neuer Abschnitt zu", AddedText: "ergänzt:", ContentWarning: "Sensibler Inhalt", Previously: "Zuvor:"},
+	"es": {NewPost: "Nueva entrada:", UpdatedPost: "Entrada actualizada:", AddedSection: "nueva sección sobre", AddedText: "añadido:", ContentWarning: "Contenido sensible", Previously: "Anteriormente:"},
+	"fr": {NewPost: "Nouvel article :", UpdatedPost: "Article mis à jour :", AddedSection: "nouvelle section sur", AddedText: "ajout :", ContentWarning: "Contenu sensible", Previously: "Précédemment :"},
+	"it": {NewPost: "Nuovo articolo:", UpdatedPost: "Articolo aggiornato:", AddedSection: "nuova sezione su", AddedText: "aggiunto:", ContentWarning: "Contenuto sensibile", Previously: "In precedenza:"},
+	"nl": {NewPost: "Nieuw bericht:", UpdatedPost: "Bericht bijgewerkt:", AddedSection: "nieuwe sectie over", AddedText: "toegevoegd:", ContentWarning: "Gevoelige inhoud", Previously: "Eerder:"},
+	"pt": {NewPost: "Nova publicação:", UpdatedPost: "Publicação atualizada:", AddedSection: "nova seção sobre", AddedText: "adicionado:", ContentWarning: "Conteúdo sensível", Previously: "Anteriormente:"},
+}
+
+// Locales returns the locales of the built-in catalog, sorted.
+func Locales() []string {
+	locales := make([]string, 0, len(catalog))
+	for locale := range catalog {
+		locales = append(locales, locale)
+	}
+	slices.Sort(locales)
+	return locales
+}
+
+// Keys returns the message keys, sorted.
+func Keys() []string {
+	keys := make([]string, 0, len(catalog[DefaultLocale]))
+	for key := range catalog[DefaultLocale] {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// Catalog looks up the phrases of one locale, with per-key overrides.
+type Catalog struct {
+	locale    string
+	overrides map[string]string
+}
+
+// New returns the Catalog of locale, with the phrases in overrides taking
+// precedence. The locale may carry a region or encoding, e.g. "de_AT.UTF-8",
+// in which case the language's phrases are used; an empty locale selects
+// DefaultLocale. It returns an error for unknown locales and override keys.
+func New(locale string, overrides map[string]string) (Catalog, error) {
+	lang := DefaultLocale
+	if locale != "" {
+		lang = Language(locale)
+	}
+	if _, ok := catalog[lang]; !ok {
+		return Catalog{}, fmt.Errorf("unsupported locale %q, supported are %s", locale, strings.Join(Locales(), ", "))
+	}
+	for key := range overrides {
+		if _, ok := catalog[DefaultLocale][key]; !ok {
+			return Catalog{}, fmt.Errorf("unknown message %q, known are %s", key, strings.Join(Keys(), ", "))
+		}
+	}
+	return Catalog{locale: lang, overrides: overrides}, nil
+}
+
+// Language returns the language code of locale, e.g. "de" for
+// "de_AT.UTF-8", or an empty string for an empty locale.
+func Language(locale string) string {
+	fields := strings.FieldsFunc(locale, func(r rune) bool {
+		return r == '_' || r == '-' || r == '.' || r == '@'
+	})
+	if len(fields) == 0 {
+		return ""
+	}
+	return strings.ToLower(fields[0])
+}
+
+// Get returns the phrase of key, falling back to DefaultLocale. It is
+// available to templates as msg.
+func (c Catalog) Get(key string) (string, error) {
+	if s, ok := c.overrides[key]; ok {
+		return s, nil
+	}
+	if s, ok := catalog[c.locale][key]; ok {
+		return s, nil
+	}
+	if s, ok := catalog[DefaultLocale][key]; ok {
+		return s, nil
+	}
+	return "", fmt.Errorf("unknown message %q", key)
+}
@@ -0,0 +1,67 @@
+package messages
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew_Locales(t *testing.T) {
+	tests := []struct {
+		locale string
+		want   string
+	}{
+		{"", "New post:"},
+		{"en", "New post:"},
+		{"de", "Neuer Beitrag:"},
+		{"de_AT.UTF-8", "Neuer Beitrag:"},
+		{"FR-ca", "Nouvel article :"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.locale, func(t *testing.T) {
+			c, err := New(tt.locale, nil)
+			require.NoError(t, err)
+			got, err := c.Get(NewPost)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	_, err := New("xx", nil)
+	assert.ErrorContains(t, err, `unsupported locale "xx"`)
+	_, err = New("_", nil)
+	assert.Error(t, err)
+}
+
+func TestLanguage(t *testing.T) {
+	assert.Equal(t, "", Language(""))
+	assert.Equal(t, "de", Language("de_AT.UTF-8"))
+	assert.Equal(t, "fr", Language("FR-ca"))
+	assert.Equal(t, "", Language("_"))
+}
+
+func TestCatalog_Overrides(t *testing.T) {
+	c, err := New("de", map[string]string{UpdatedPost: "Neu überarbeitet:"})
+	require.NoError(t, err)
+
+	got, err := c.Get(UpdatedPost)
+	require.NoError(t, err)
+	assert.Equal(t, "Neu überarbeitet:", got)
+	got, err = c.Get(NewPost)
+	require.NoError(t, err)
+	assert.Equal(t, "Neuer Beitrag:", got)
+
+	_, err = c.Get("nope")
+	assert.Error(t, err)
+	_, err = New("", map[string]string{"nope": "x"})
+	assert.ErrorContains(t, err, `unknown message "nope"`)
+}
+
+func TestCatalog_Complete(t *testing.T) {
+	for _, locale := range Locales() {
+		for _, key := range Keys() {
+			assert.NotEmpty(t, catalog[locale][key], "%s is missing %s", locale, key)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+// Package metrics provides simple in-process counters used to surface feed
+// anomalies (malformed items, filtered items, gated items and duplicate
+// suppressions, in total and in the latest cycle) so that a quietly degrading
+// feed or a safety check that stopped working is noticed early, and
+// timing histograms of feed fetches and publishes. Both can be exposed to
+// Prometheus with Handler.
+package metrics
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Counter names.
+const (
+	// ItemsFetched counts items returned by the feed.
+	ItemsFetched = "items_fetched"
+	// MalformedItems counts items skipped because they lack required fields.
+	MalformedItems = "malformed_items"
+	// UnparsablePubDates counts items whose pubDate could not be parsed.
+	UnparsablePubDates = "unparsable_pubdates"
+	// FilteredCategory counts items skipped by the CATEGORY filter.
+	FilteredCategory = "filtered_category"
+	// FilteredSkipPrefix counts items skipped by SKIP_PREFIX_CATEGORIES.
+	FilteredSkipPrefix = "filtered_skip_prefix"
+	// FilteredExtension counts items skipped by EXTENSION_FILTERS.
+	FilteredExtension = "filtered_extension"
+	// FilteredDomain counts items skipped by LINK_DOMAIN_ALLOWLIST and
+	// LINK_DOMAIN_DENYLIST.
+	FilteredDomain = "filtered_domain"
+	// GatedPubDate counts items gated because their pubDate predates startup.
+	GatedPubDate = "gated_pubdate"
+	// DuplicatesSuppressed counts items not republished because they were
+	// already posted.
+	DuplicatesSuppressed = "duplicates_suppressed"
+	// HighWaterSuppressed counts new items not posted because their pubDate
+	// is before the latest published item of the feed, e.g. after the feed
+	// was regenerated with new links.
+	HighWaterSuppressed = "high_water_suppressed"
+	// PanicsRecovered counts panics recovered while checking the feed or
+	// handling an item.
+	PanicsRecovered = "panics_recovered"
+	// ClockJumps counts waits between checks over which the wall clock
+	// jumped ahead, e.g. by a suspend or an NTP step.
+	ClockJumps = "clock_jumps"
+)
+
+// Counters is a concurrency-safe set of named counters.
+type Counters struct {
+	mu     sync.Mutex
+	values map[string]int64
+}
+
+// New returns an empty set of counters.
+func New() *Counters {
+	return &Counters{values: make(map[string]int64)}
+}
+
+// Default holds the process-wide cumulative counters.
+var Default = New()
+
+// Inc increments the named counter in Default by one.
+func Inc(name string) {
+	Default.Add(name, 1)
+}
+
+// Add increments the named counter by delta.
+func (c *Counters) Add(name string, delta int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.values[name] += delta
+}
+
+// Get returns the current value of the named counter.
+func (c *Counters) Get(name string) int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.values[name]
+}
+
+// Snapshot returns a copy of all counters.
+func (c *Counters) Snapshot() Snapshot {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := make(Snapshot, len(c.values))
+	for k, v := range c.values {
+		s[k] = v
+	}
+	return s
+}
+
+// Reset sets all counters back to zero.
+func (c *Counters) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.values = make(map[string]int64)
+}
+
+// lastCycle holds the counters of the latest check cycle.
+var lastCycle struct {
+	mu sync.Mutex
+	s  Snapshot
+}
+
+// SetLastCycle records s as the counters of the latest check cycle.
+func SetLastCycle(s Snapshot) {
+	lastCycle.mu.Lock()
+	defer lastCycle.mu.Unlock()
+	lastCycle.s = s
+}
+
+// LastCycle returns the counters of the latest check cycle, as recorded by
+// SetLastCycle.
+func LastCycle() Snapshot {
+	lastCycle.mu.Lock()
+	defer lastCycle.mu.Unlock()
+	return lastCycle.s
+}
+
+// Snapshot is a point-in-time copy of counter values.
+type Snapshot map[string]int64
+
+// Sub returns the per-counter difference s - prev, omitting zero deltas.
+func (s Snapshot) Sub(prev Snapshot) Snapshot {
+	d := make(Snapshot)
+	for k, v := range s {
+		if delta := v - prev[k]; delta != 0 {
+			d[k] = delta
+		}
+	}
+	return d
+}
+
+// String formats the snapshot as sorted "name=value" pairs.
+func (s Snapshot) String() string {
+	keys := make([]string, 0, len(s))
+	for k := range s {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		parts = append(parts, fmt.Sprintf("%s=%d", k, s[k]))
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,95 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCounters(t *testing.T) {
+	c := New()
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.Add(MalformedItems, 1)
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int64(10), c.Get(MalformedItems))
+	assert.Equal(t, int64(0), c.Get(FilteredCategory))
+
+	c.Reset()
+	assert.Equal(t, int64(0), c.Get(MalformedItems))
+}
+
+func TestSnapshot_SubAndString(t *testing.T) {
+	c := New()
+	c.Add(FilteredCategory, 2)
+	before := c.Snapshot()
+
+	c.Add(FilteredCategory, 3)
+	c.Add(DuplicatesSuppressed, 1)
+
+	delta := c.Snapshot().Sub(before)
+	assert.Equal(t, Snapshot{FilteredCategory: 3, DuplicatesSuppressed: 1}, delta)
+	assert.Equal(t, "duplicates_suppressed=1 filtered_category=3", delta.String())
+	assert.Empty(t, c.Snapshot().Sub(c.Snapshot()))
+}
+
+func TestTimings_SnapshotSubAndString(t *testing.T) {
+	timings := NewTimings()
+	timings.Observe(Series{Name: FeedFetch}, 100*time.Millisecond)
+	before := timings.Snapshot()
+
+	timings.Observe(Series{Name: FeedFetch}, 120*time.Millisecond)
+	timings.Observe(Series{Name: Publish, Network: "mastodon"}, 400*time.Millisecond)
+	timings.Observe(Series{Name: Publish, Network: "mastodon"}, 500*time.Millisecond)
+
+	delta := timings.Snapshot().Sub(before)
+	assert.Equal(t, TimingSnapshot{
+		{Name: FeedFetch}:                    {Count: 1, Sum: 120 * time.Millisecond},
+		{Name: Publish, Network: "mastodon"}: {Count: 2, Sum: 900 * time.Millisecond},
+	}, delta)
+	assert.Equal(t, "feed_fetch=120ms publish_mastodon=900ms/2", delta.String())
+
+	timings.Reset()
+	assert.Empty(t, timings.Snapshot())
+}
+
+func TestWritePrometheus(t *testing.T) {
+	Default.Reset()
+	DefaultTimings.Reset()
+	t.Cleanup(Default.Reset)
+	t.Cleanup(DefaultTimings.Reset)
+
+	Inc(MalformedItems)
+	Inc(DuplicatesSuppressed)
+	SetLastCycle(Snapshot{DuplicatesSuppressed: 1})
+	t.Cleanup(func() { SetLastCycle(nil) })
+	Observe(FeedFetch, "", 30*time.Millisecond)
+	Observe(Publish, "bluesky", 2*time.Second)
+	Observe(Publish, "bluesky", time.Minute)
+
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := rec.Body.String()
+
+	assert.Contains(t, rec.Header().Get("Content-Type"), "text/plain")
+	assert.Contains(t, body, "# TYPE rss2socials_malformed_items_total counter\nrss2socials_malformed_items_total 1\n")
+	assert.Contains(t, body, "# TYPE rss2socials_duplicates_suppressed_last_cycle gauge\nrss2socials_duplicates_suppressed_last_cycle 1\n")
+	assert.Contains(t, body, "rss2socials_malformed_items_last_cycle 0\n")
+	assert.Contains(t, body, "# TYPE rss2socials_feed_fetch_duration_seconds histogram\n")
+	assert.Contains(t, body, `rss2socials_feed_fetch_duration_seconds_bucket{le="0.01"} 0`)
+	assert.Contains(t, body, `rss2socials_feed_fetch_duration_seconds_bucket{le="0.05"} 1`)
+	assert.Contains(t, body, `rss2socials_feed_fetch_duration_seconds_count 1`)
+	assert.Contains(t, body, `rss2socials_publish_duration_seconds_bucket{network="bluesky",le="2.5"} 1`)
+	assert.Contains(t, body, `rss2socials_publish_duration_seconds_bucket{network="bluesky",le="+Inf"} 2`)
+	assert.Contains(t, body, `rss2socials_publish_duration_seconds_sum{network="bluesky"} 62`)
+}
@@ -0,0 +1,100 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+)
+
+// namespace prefixes the names of the exported metrics.
+const namespace = "rss2socials_"
+
+// timingHelp describes the timings in the Prometheus HELP lines.
+var timingHelp = map[string]string{
+	FeedFetch: "Time taken to fetch the feed document.",
+	FeedParse: "Time taken to parse the feed document.",
+	Publish:   "Time taken to publish a post or an update to a network.",
+}
+
+// WritePrometheus writes the counters of Default and the timings of
+// DefaultTimings to w in the Prometheus text exposition format. Counters are
+// named rss2socials_<name>_total, timings rss2socials_<name>_duration_seconds.
+// The counters of the latest cycle are gauges named
+// rss2socials_<name>_last_cycle, zero for counters not counted in it.
+func WritePrometheus(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+
+	counters := Default.Snapshot()
+	names := make([]string, 0, len(counters))
+	for name := range counters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		metric := namespace + name + "_total"
+		fmt.Fprintf(bw, "# TYPE %s counter\n%s %d\n", metric, metric, counters[name])
+	}
+	cycle := LastCycle()
+	for _, name := range names {
+		metric := namespace + name + "_last_cycle"
+		fmt.Fprintf(bw, "# TYPE %s gauge\n%s %d\n", metric, metric, cycle[name])
+	}
+
+	DefaultTimings.writePrometheus(bw)
+	return bw.Flush()
+}
+
+func (t *Timings) writePrometheus(w io.Writer) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	bySeries := make(map[string][]Series)
+	for series := range t.series {
+		bySeries[series.Name] = append(bySeries[series.Name], series)
+	}
+	names := make([]string, 0, len(bySeries))
+	for name := range bySeries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		metric := namespace + name + "_duration_seconds"
+		if help := timingHelp[name]; help != "" {
+			fmt.Fprintf(w, "# HELP %s %s\n", metric, help)
+		}
+		fmt.Fprintf(w, "# TYPE %s histogram\n", metric)
+		series := bySeries[name]
+		sort.Slice(series, func(i, j int) bool { return series[i].Network < series[j].Network })
+		for _, s := range series {
+			h := t.series[s]
+			labels := ""
+			if s.Network != "" {
+				labels = fmt.Sprintf("network=%q,", s.Network)
+			}
+			var cumulative int64
+			for i, bound := range Buckets {
+				cumulative += h.counts[i]
+				fmt.Fprintf(w, "%s_bucket{%sle=%q} %d\n", metric, labels, strconv.FormatFloat(bound, 'g', -1, 64), cumulative)
+			}
+			fmt.Fprintf(w, "%s_bucket{%sle=\"+Inf\"} %d\n", metric, labels, h.count)
+			suffix := ""
+			if s.Network != "" {
+				suffix = fmt.Sprintf("{network=%q}", s.Network)
+			}
+			fmt.Fprintf(w, "%s_sum%s %g\n", metric, suffix, h.sum.Seconds())
+			fmt.Fprintf(w, "%s_count%s %d\n", metric, suffix, h.count)
+		}
+	}
+}
+
+// Handler serves the metrics in the Prometheus text exposition format.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_ = WritePrometheus(w)
+	})
+}
@@ -0,0 +1,140 @@
+package metrics
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Timing names.
+const (
+	// FeedFetch times downloading (or reading) the feed document.
+	FeedFetch = "feed_fetch"
+	// FeedParse times parsing the feed document into items.
+	FeedParse = "feed_parse"
+	// Publish times publishing a post, or an update to it, to a network.
+	Publish = "publish"
+)
+
+// Buckets are the upper bounds, in seconds, of the timing histograms.
+var Buckets = []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// Series identifies a timing histogram: a timing name, and the network it
+// was measured on when it applies to a single one.
+type Series struct {
+	Name    string
+	Network string
+}
+
+func (s Series) String() string {
+	if s.Network == "" {
+		return s.Name
+	}
+	return s.Name + "_" + s.Network
+}
+
+// histogram counts observations per bucket of Buckets; counts[len(Buckets)]
+// holds those above the largest bound.
+type histogram struct {
+	counts []int64
+	sum    time.Duration
+	count  int64
+}
+
+// Timings is a concurrency-safe set of timing histograms.
+type Timings struct {
+	mu     sync.Mutex
+	series map[Series]*histogram
+}
+
+// NewTimings returns an empty set of timings.
+func NewTimings() *Timings {
+	return &Timings{series: make(map[Series]*histogram)}
+}
+
+// DefaultTimings holds the process-wide timings.
+var DefaultTimings = NewTimings()
+
+// Observe records a duration d of the named timing on network, which is
+// empty for timings that do not apply to a single network, in DefaultTimings.
+func Observe(name, network string, d time.Duration) {
+	DefaultTimings.Observe(Series{Name: name, Network: network}, d)
+}
+
+// Observe records a duration d of series.
+func (t *Timings) Observe(series Series, d time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	h := t.series[series]
+	if h == nil {
+		h = &histogram{counts: make([]int64, len(Buckets)+1)}
+		t.series[series] = h
+	}
+	i := sort.SearchFloat64s(Buckets, d.Seconds())
+	h.counts[i]++
+	h.sum += d
+	h.count++
+}
+
+// Snapshot returns the number and total duration of the observations of
+// every series.
+func (t *Timings) Snapshot() TimingSnapshot {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s := make(TimingSnapshot, len(t.series))
+	for series, h := range t.series {
+		s[series] = Timing{Count: h.count, Sum: h.sum}
+	}
+	return s
+}
+
+// Reset discards all observations.
+func (t *Timings) Reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.series = make(map[Series]*histogram)
+}
+
+// Timing is the number and total duration of the observations of a series.
+type Timing struct {
+	Count int64
+	Sum   time.Duration
+}
+
+// TimingSnapshot is a point-in-time copy of timings.
+type TimingSnapshot map[Series]Timing
+
+// Sub returns the per-series difference s - prev, omitting series without
+// new observations.
+func (s TimingSnapshot) Sub(prev TimingSnapshot) TimingSnapshot {
+	d := make(TimingSnapshot)
+	for series, t := range s {
+		if count := t.Count - prev[series].Count; count != 0 {
+			d[series] = Timing{Count: count, Sum: t.Sum - prev[series].Sum}
+		}
+	}
+	return d
+}
+
+// String formats the snapshot as sorted "series=total" pairs in
+// milliseconds, followed by the number of observations when there was more
+// than one, e.g. "feed_fetch=120ms publish_mastodon=900ms/2".
+func (s TimingSnapshot) String() string {
+	keys := make([]Series, 0, len(s))
+	for series := range s {
+		keys = append(keys, series)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+	parts := make([]string, 0, len(keys))
+	for _, series := range keys {
+		t := s[series]
+		part := fmt.Sprintf("%s=%dms", series, t.Sum.Milliseconds())
+		if t.Count > 1 {
+			part += fmt.Sprintf("/%d", t.Count)
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,94 @@
+// Package neterr classifies network errors, such as those of feed fetches
+// and publisher API calls, into the handful of failure kinds an operator
+// debugging a headless server needs to tell apart: DNS failures, TLS
+// certificate errors, timeouts and refused or broken connections.
+package neterr
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+)
+
+// Kinds of network failures.
+const (
+	DNS            = "DNS lookup failed"
+	TLSCertificate = "TLS certificate error"
+	TLSHandshake   = "TLS handshake failed"
+	Refused        = "connection refused"
+	Reset          = "connection reset"
+	Unreachable    = "network unreachable"
+	Timeout        = "timeout"
+)
+
+// Error is a network error with its kind.
+type Error struct {
+	Kind string
+	Err  error
+}
+
+// Error returns the kind followed by the underlying error.
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %v", e.Kind, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Classify returns err wrapped in an Error when it is a network failure of a
+// known kind, and err unchanged otherwise, including when it is already
+// classified.
+func Classify(err error) error {
+	if err == nil {
+		return nil
+	}
+	var classified *Error
+	if errors.As(err, &classified) {
+		return err
+	}
+	if kind := KindOf(err); kind != "" {
+		return &Error{Kind: kind, Err: err}
+	}
+	return err
+}
+
+// KindOf returns the kind of network failure err is, or "" when it is none
+// of the known kinds.
+func KindOf(err error) string {
+	var (
+		dnsErr      *net.DNSError
+		unknownCA   x509.UnknownAuthorityError
+		hostnameErr x509.HostnameError
+		invalidErr  x509.CertificateInvalidError
+		verifyErr   *tls.CertificateVerificationError
+		recordErr   tls.RecordHeaderError
+		alertErr    tls.AlertError
+		netErr      net.Error
+		classified  *Error
+	)
+	switch {
+	case errors.As(err, &classified):
+		return classified.Kind
+	case errors.As(err, &dnsErr):
+		return DNS
+	case errors.As(err, &unknownCA), errors.As(err, &hostnameErr), errors.As(err, &invalidErr), errors.As(err, &verifyErr):
+		return TLSCertificate
+	case errors.As(err, &recordErr), errors.As(err, &alertErr):
+		return TLSHandshake
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return Refused
+	case errors.Is(err, syscall.ECONNRESET), errors.Is(err, syscall.EPIPE):
+		return Reset
+	case errors.Is(err, syscall.ENETUNREACH), errors.Is(err, syscall.EHOSTUNREACH):
+		return Unreachable
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return Timeout
+	}
+	return ""
+}
@@ -0,0 +1,64 @@
+package neterr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKindOf(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{"dns", &net.DNSError{Err: "no such host", Name: "bsky.social", IsNotFound: true}, DNS},
+		{"dns timeout is dns", &net.DNSError{Err: "i/o timeout", Name: "bsky.social", IsTimeout: true}, DNS},
+		{"refused", &net.OpError{Op: "dial", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}, Refused},
+		{"reset", fmt.Errorf("read: %w", syscall.ECONNRESET), Reset},
+		{"unreachable", &net.OpError{Op: "dial", Err: os.NewSyscallError("connect", syscall.ENETUNREACH)}, Unreachable},
+		{"deadline", fmt.Errorf("request: %w", context.DeadlineExceeded), Timeout},
+		{"other", errors.New("unexpected HTTP status: 500"), ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, KindOf(tt.err))
+		})
+	}
+}
+
+func TestClassify(t *testing.T) {
+	assert.NoError(t, Classify(nil))
+
+	other := errors.New("unexpected HTTP status: 500")
+	assert.Same(t, other, Classify(other), "unclassified errors are returned unchanged")
+
+	refused := &net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}
+	err := Classify(fmt.Errorf("HTTP request failed: %w", refused))
+	assert.EqualError(t, err, "connection refused: HTTP request failed: dial tcp: connect: connection refused")
+	assert.ErrorIs(t, err, syscall.ECONNREFUSED)
+	assert.Equal(t, err, Classify(err), "errors are classified once")
+}
+
+func TestClassify_RealFailures(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := ln.Addr().String()
+	require.NoError(t, ln.Close())
+	_, err = http.Get("http://" + addr)
+	assert.Equal(t, Refused, KindOf(err))
+
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	defer srv.Close()
+	_, err = http.Get(srv.URL)
+	assert.Equal(t, TLSCertificate, KindOf(err), "self-signed certificates are TLS certificate errors")
+}
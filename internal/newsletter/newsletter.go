@@ -0,0 +1,139 @@
+// Package newsletter announces new posts to an email list, either by
+// mailing them through an SMTP server or by sending a campaign through the
+// API of Listmonk or Buttondown. The email body is rendered from the feed
+// item with a Go html/template, the subject with a text/template.
+package newsletter
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html/template"
+	"strings"
+	"time"
+
+	"github.com/toozej/rss2socials/internal/content"
+	"github.com/toozej/rss2socials/internal/messages"
+	"github.com/toozej/rss2socials/internal/posttemplate"
+	"github.com/toozej/rss2socials/internal/rss"
+	"github.com/toozej/rss2socials/pkg/config"
+)
+
+// DefaultTemplate is the email body used when Config.NewsletterTemplate is
+// empty: the linked title followed by the content of the item.
+const DefaultTemplate = `<h1><a href="{{.Link}}">{{.Title}}</a></h1>
+{{.Content | safeHTML}}
+<p><a href="{{.Link}}">{{.Link}}</a></p>`
+
+// DefaultSubjectTemplate is the default of Config.NewsletterSubjectTemplate.
+const DefaultSubjectTemplate = "{{.Title}}"
+
+// Data is the value the email body template is executed with.
+type Data struct {
+	Title string
+	Link  string
+	// Content is the content of the item, selected by
+	// Config.ContentSources. It is HTML from the feed, which is escaped
+	// unless passed through safeHTML.
+	Content   string
+	PubDate   string
+	Published time.Time
+	// Post is the text posted to the social sites for the item.
+	Post string
+}
+
+// Funcs returns the helper functions available to the body template: those
+// of post templates, and safeHTML, which marks HTML from the feed as safe
+// to include unescaped.
+func Funcs() template.FuncMap {
+	funcs := template.FuncMap(posttemplate.Funcs())
+	funcs["safeHTML"] = func(s string) template.HTML { return template.HTML(s) } // #nosec G203 -- the feed is the user's own
+	return funcs
+}
+
+// Parse parses the email body template text.
+func Parse(text string) (*template.Template, error) {
+	if text == "" {
+		text = DefaultTemplate
+	}
+	t, err := template.New("newsletter").Funcs(Funcs()).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid newsletter template: %w", err)
+	}
+	return t, nil
+}
+
+func init() {
+	config.RegisterCheck(check)
+}
+
+// check reports the subject and body templates of conf that do not parse.
+func check(conf config.Config) []config.Problem {
+	var problems []config.Problem
+	if _, err := posttemplate.Parse("newsletter subject", conf.NewsletterSubjectTemplate); err != nil {
+		problems = append(problems, config.Problem{Var: "NEWSLETTER_SUBJECT_TEMPLATE", Message: err.Error(), Example: DefaultSubjectTemplate})
+	}
+	if _, err := Parse(conf.NewsletterTemplate); err != nil {
+		problems = append(problems, config.Problem{Var: "NEWSLETTER_TEMPLATE", Message: err.Error(), Example: `<p><a href="{{.Link}}">{{.Title}}</a></p>`})
+	}
+	return problems
+}
+
+// Render returns the subject and HTML body of the email announcing item,
+// whose social post is post. The subject falls back to the first line of
+// post when the template renders it empty.
+func Render(ctx context.Context, conf config.Config, item rss.RSSItem, post string) (subject, body string, err error) {
+	catalog, err := messages.New(conf.Locale, conf.Messages)
+	if err != nil {
+		return "", "", err
+	}
+	item.Content = content.Select(ctx, conf.ContentSources, conf.ContentMinChars, item, nil)
+
+	subject, err = posttemplate.RenderText(conf, "newsletter subject", conf.NewsletterSubjectTemplate, item)
+	if err != nil {
+		return "", "", err
+	}
+	if subject == "" {
+		subject, _, _ = strings.Cut(post, "\n")
+	}
+
+	t, err := Parse(conf.NewsletterTemplate)
+	if err != nil {
+		return "", "", err
+	}
+	t.Funcs(template.FuncMap{"msg": catalog.Get})
+	published, _ := item.ParsePubDate()
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, Data{
+		Title:     item.Title,
+		Link:      item.Link,
+		Content:   item.Content,
+		PubDate:   item.PubDate,
+		Published: published,
+		Post:      post,
+	}); err != nil {
+		return "", "", fmt.Errorf("error rendering newsletter template: %w", err)
+	}
+	return strings.TrimSpace(subject), strings.TrimSpace(buf.String()), nil
+}
+
+// Send emails item, whose social post is post, through
+// Config.NewsletterProvider and returns the ID of the sent campaign, or an
+// empty string for SMTP.
+func Send(ctx context.Context, conf config.Config, item rss.RSSItem, post string) (string, error) {
+	if !conf.NewsletterConfigured() {
+		return "", fmt.Errorf("newsletter provider %q is not configured", conf.NewsletterProvider)
+	}
+	subject, body, err := Render(ctx, conf, item, post)
+	if err != nil {
+		return "", err
+	}
+
+	switch conf.NewsletterProvider {
+	case config.NewsletterListmonk:
+		return sendListmonk(ctx, conf, subject, body)
+	case config.NewsletterButtondown:
+		return sendButtondown(ctx, conf, subject, body)
+	}
+	return "", sendSMTP(conf, subject, body)
+}
@@ -0,0 +1,146 @@
+package newsletter
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/smtp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/toozej/rss2socials/internal/rss"
+	"github.com/toozej/rss2socials/pkg/config"
+)
+
+var item = rss.RSSItem{
+	Title:   "Hello <World>",
+	Link:    "https://example.com/hello",
+	Content: "<p>First paragraph.</p>",
+	PubDate: "Mon, 02 Jan 2026 15:04:05 +0000",
+}
+
+func TestRender(t *testing.T) {
+	conf := config.Config{NewsletterSubjectTemplate: DefaultSubjectTemplate}
+	subject, body, err := Render(context.Background(), conf, item, "New post: https://example.com/hello")
+	require.NoError(t, err)
+	assert.Equal(t, "Hello <World>", subject)
+	assert.Contains(t, body, `<h1><a href="https://example.com/hello">Hello &lt;World&gt;</a></h1>`)
+	assert.Contains(t, body, "<p>First paragraph.</p>")
+
+	conf.NewsletterSubjectTemplate = ""
+	conf.NewsletterTemplate = `{{.Post}} ({{.Published.Format "2006-01-02"}})`
+	subject, body, err = Render(context.Background(), conf, item, "New post: https://example.com/hello\nmore")
+	require.NoError(t, err)
+	assert.Equal(t, "New post: https://example.com/hello", subject)
+	assert.Equal(t, "New post: https://example.com/hello\nmore (2026-01-02)", body)
+}
+
+func TestCheck(t *testing.T) {
+	assert.Empty(t, check(config.Config{NewsletterSubjectTemplate: DefaultSubjectTemplate}))
+	assert.Len(t, check(config.Config{NewsletterSubjectTemplate: "{{.Title"}), 1)
+	assert.Len(t, check(config.Config{NewsletterTemplate: "{{unknown .Title}}"}), 1)
+
+	conf, _ := config.Config{NewsletterSubjectTemplate: "{{.Title", NewsletterTemplate: "{{unknown .Title}}"}.WithDefaults()
+	assert.Equal(t, DefaultSubjectTemplate, conf.NewsletterSubjectTemplate, "invalid templates are replaced with the defaults")
+	assert.Empty(t, conf.NewsletterTemplate)
+}
+
+func TestSend_SMTP(t *testing.T) {
+	var gotAddr, gotMsg string
+	var gotTo []string
+	sendMail = func(addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+		gotAddr, gotTo, gotMsg = addr, to, string(msg)
+		return nil
+	}
+	defer func() { sendMail = smtp.SendMail }()
+
+	conf := config.Config{
+		NewsletterProvider:        config.NewsletterSMTP,
+		NewsletterEmailTo:         []string{"readers@lists.example.com"},
+		NewsletterSubjectTemplate: "{{.Title}}\nBcc: x",
+		SMTPHost:                  "smtp.example.com",
+		SMTPPort:                  587,
+		SMTPFrom:                  "blog@example.com",
+	}
+	id, err := Send(context.Background(), conf, item, "")
+	require.NoError(t, err)
+	assert.Empty(t, id)
+	assert.Equal(t, "smtp.example.com:587", gotAddr)
+	assert.Equal(t, []string{"readers@lists.example.com"}, gotTo)
+	assert.Contains(t, gotMsg, "Subject: Hello <World> Bcc: x\r\n")
+	assert.Contains(t, gotMsg, "Content-Type: text/html; charset=UTF-8\r\n")
+}
+
+func TestSend_Listmonk(t *testing.T) {
+	var calls []string
+	var campaign map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, r.Method+" "+r.URL.Path)
+		assert.Equal(t, "token api:secret", r.Header.Get("Authorization"))
+		if r.Method == http.MethodPost {
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&campaign))
+			_, _ = w.Write([]byte(`{"data":{"id":42}}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"data":true}`))
+	}))
+	defer srv.Close()
+
+	conf := config.Config{
+		NewsletterProvider: config.NewsletterListmonk,
+		ListmonkURL:        srv.URL + "/",
+		ListmonkUsername:   "api",
+		ListmonkToken:      "secret",
+		ListmonkListIDs:    []int{1, 3},
+	}
+	id, err := Send(context.Background(), conf, item, "New post")
+	require.NoError(t, err)
+	assert.Equal(t, "42", id)
+	assert.Equal(t, []string{"POST /api/campaigns", "PUT /api/campaigns/42/status"}, calls)
+	assert.Equal(t, "New post", campaign["subject"])
+	assert.Equal(t, []any{1.0, 3.0}, campaign["lists"])
+	assert.Equal(t, "html", campaign["content_type"])
+}
+
+func TestSend_Buttondown(t *testing.T) {
+	var email map[string]string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/emails", r.URL.Path)
+		assert.Equal(t, "Token key", r.Header.Get("Authorization"))
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&email))
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"id":"em_123"}`))
+	}))
+	defer srv.Close()
+
+	conf := config.Config{
+		NewsletterProvider:        config.NewsletterButtondown,
+		NewsletterSubjectTemplate: DefaultSubjectTemplate,
+		ButtondownAPIKey:          "key",
+		ButtondownAPIURL:          srv.URL,
+	}
+	id, err := Send(context.Background(), conf, item, "")
+	require.NoError(t, err)
+	assert.Equal(t, "em_123", id)
+	assert.Equal(t, "Hello <World>", email["subject"])
+	assert.Equal(t, "about_to_send", email["status"])
+}
+
+func TestSend_Errors(t *testing.T) {
+	_, err := Send(context.Background(), config.Config{NewsletterProvider: config.NewsletterButtondown}, item, "")
+	require.Error(t, err)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "invalid API key", http.StatusUnauthorized)
+	}))
+	defer srv.Close()
+	_, err = Send(context.Background(), config.Config{
+		NewsletterProvider: config.NewsletterButtondown,
+		ButtondownAPIKey:   "wrong",
+		ButtondownAPIURL:   srv.URL,
+	}, item, "")
+	assert.ErrorContains(t, err, "HTTP 401: invalid API key")
+}
@@ -0,0 +1,143 @@
+package newsletter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/toozej/rss2socials/internal/httpbody"
+	"github.com/toozej/rss2socials/pkg/config"
+)
+
+// DefaultButtondownAPIURL is the Buttondown API used when
+// Config.ButtondownAPIURL is empty.
+const DefaultButtondownAPIURL = "https://api.buttondown.com"
+
+// sendMail is the SMTP send function, replaceable in tests.
+var sendMail = smtp.SendMail
+
+// sendSMTP mails the HTML body to Config.NewsletterEmailTo through the SMTP
+// server of the email notifications.
+func sendSMTP(conf config.Config, subject, body string) error {
+	var auth smtp.Auth
+	if conf.SMTPUsername != "" {
+		auth = smtp.PlainAuth("", conf.SMTPUsername, conf.SMTPPassword, conf.SMTPHost)
+	}
+
+	msg := strings.Join([]string{
+		"From: " + conf.SMTPFrom,
+		"To: " + strings.Join(conf.NewsletterEmailTo, ", "),
+		"Subject: " + mime.QEncoding.Encode("UTF-8", sanitizeHeader(subject)),
+		"Date: " + time.Now().Format(time.RFC1123Z),
+		"MIME-Version: 1.0",
+		"Content-Type: text/html; charset=UTF-8",
+		"",
+		body,
+	}, "\r\n")
+
+	addr := net.JoinHostPort(conf.SMTPHost, strconv.Itoa(conf.SMTPPort))
+	if err := sendMail(addr, auth, conf.SMTPFrom, conf.NewsletterEmailTo, []byte(msg)); err != nil {
+		return fmt.Errorf("failed to send newsletter email: %w", err)
+	}
+	return nil
+}
+
+// sanitizeHeader strips line breaks so a value cannot inject extra headers.
+func sanitizeHeader(s string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(s)
+}
+
+// sendListmonk creates a campaign of the HTML body for Config.ListmonkListIDs
+// and starts it, returning the campaign ID.
+func sendListmonk(ctx context.Context, conf config.Config, subject, body string) (string, error) {
+	base := strings.TrimSuffix(conf.ListmonkURL, "/") + "/api/campaigns"
+	auth := "token " + conf.ListmonkUsername + ":" + conf.ListmonkToken
+
+	var created struct {
+		Data struct {
+			ID int `json:"id"`
+		} `json:"data"`
+	}
+	err := doJSON(ctx, "listmonk", http.MethodPost, base, auth, map[string]any{
+		"name":         subject,
+		"subject":      subject,
+		"lists":        conf.ListmonkListIDs,
+		"type":         "regular",
+		"content_type": "html",
+		"body":         body,
+	}, &created)
+	if err != nil {
+		return "", fmt.Errorf("failed to create listmonk campaign: %w", err)
+	}
+
+	id := strconv.Itoa(created.Data.ID)
+	if err := doJSON(ctx, "listmonk", http.MethodPut, base+"/"+id+"/status", auth, map[string]string{"status": "running"}, nil); err != nil {
+		return "", fmt.Errorf("failed to start listmonk campaign %s: %w", id, err)
+	}
+	return id, nil
+}
+
+// sendButtondown sends the HTML body as an email to the subscribers of the
+// Buttondown newsletter, returning the email ID.
+func sendButtondown(ctx context.Context, conf config.Config, subject, body string) (string, error) {
+	base := conf.ButtondownAPIURL
+	if base == "" {
+		base = DefaultButtondownAPIURL
+	}
+
+	var created struct {
+		ID string `json:"id"`
+	}
+	err := doJSON(ctx, "buttondown", http.MethodPost, strings.TrimSuffix(base, "/")+"/v1/emails", "Token "+conf.ButtondownAPIKey, map[string]string{
+		"subject": subject,
+		"body":    body,
+		"status":  "about_to_send",
+	}, &created)
+	if err != nil {
+		return "", fmt.Errorf("failed to send buttondown email: %w", err)
+	}
+	return created.ID, nil
+}
+
+// doJSON sends payload as JSON to the API of service at url with the
+// Authorization header auth, and decodes the response into out unless it
+// is nil. Responses other than 2xx are returned as errors with the start of
+// their body.
+func doJSON(ctx context.Context, service, method, url, auth string, payload, out any) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s request: %w", service, err)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to create %s request: %w", service, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", auth)
+
+	client := &http.Client{}
+	resp, err := client.Do(req) // #nosec G704 -- the API URL is from config, not user input
+	if err != nil {
+		return fmt.Errorf("HTTP request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, httpbody.ErrorText(resp.Body))
+	}
+	if out == nil {
+		return nil
+	}
+	if err := httpbody.DecodeJSON(resp.Body, out); err != nil {
+		return fmt.Errorf("failed to decode %s response: %w", service, err)
+	}
+	return nil
+}
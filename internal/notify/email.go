@@ -0,0 +1,52 @@
+package notify
+
+import (
+	"fmt"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+
+	"github.com/toozej/rss2socials/internal/redact"
+	"github.com/toozej/rss2socials/pkg/config"
+)
+
+// sendMail is the SMTP send function, replaceable in tests.
+var sendMail = smtp.SendMail
+
+// sendEmail sends ev as a plain-text email through the configured SMTP server.
+func sendEmail(conf *config.Config, ev Event) error {
+	if conf.SMTPHost == "" || conf.SMTPFrom == "" || len(conf.NotifyEmailTo) == 0 {
+		return fmt.Errorf("SMTP host, sender and recipients must be configured")
+	}
+
+	var auth smtp.Auth
+	if conf.SMTPUsername != "" {
+		auth = smtp.PlainAuth("", conf.SMTPUsername, conf.SMTPPassword, conf.SMTPHost)
+	}
+
+	body := redact.String(ev.Message)
+	if ev.URL != "" {
+		body += "\n\n" + ev.URL
+	}
+
+	msg := strings.Join([]string{
+		"From: " + conf.SMTPFrom,
+		"To: " + strings.Join(conf.NotifyEmailTo, ", "),
+		"Subject: " + sanitizeHeader(redact.String(ev.Title)),
+		"Content-Type: text/plain; charset=UTF-8",
+		"",
+		body,
+	}, "\r\n")
+
+	addr := net.JoinHostPort(conf.SMTPHost, strconv.Itoa(conf.SMTPPort))
+	if err := sendMail(addr, auth, conf.SMTPFrom, conf.NotifyEmailTo, []byte(msg)); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	return nil
+}
+
+// sanitizeHeader strips line breaks so a value cannot inject extra headers.
+func sanitizeHeader(s string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(s)
+}
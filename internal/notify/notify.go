@@ -0,0 +1,242 @@
+// Package notify routes application events to notification channels.
+// Each event has a type and a severity; the NOTIFY_ROUTES configuration maps
+// event types or severities to one or more channels (Gotify, ntfy, email,
+// Slack, Mattermost), optionally with a per-route priority.
+//
+// When no routes are configured, the historical behavior is kept: failures
+// go to Gotify, and successes go to Gotify only when GotifyNotifyOnSuccess
+// is enabled. GOTIFY_TOKENS and GOTIFY_PRIORITIES pick the Gotify
+// application and priority of an event the same way routes are picked.
+package notify
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/toozej/rss2socials/internal/gotify"
+	"github.com/toozej/rss2socials/pkg/config"
+)
+
+// EventType identifies the kind of event being reported.
+type EventType string
+
+const (
+	// EventPostFailure is a failure to publish a post to a social site.
+	EventPostFailure EventType = "post_failure"
+	// EventPostSuccess is a successful publish to a social site.
+	EventPostSuccess EventType = "post_success"
+	// EventTokenExpiry warns that a credential is expired or about to expire.
+	EventTokenExpiry EventType = "token_expiry"
+	// EventError is any other operational error.
+	EventError EventType = "error"
+)
+
+// Severity is the importance of an event.
+type Severity string
+
+const (
+	SeverityInfo    Severity = "info"
+	SeverityWarning Severity = "warning"
+	SeverityError   Severity = "error"
+)
+
+// Channel names accepted in NOTIFY_ROUTES.
+const (
+	ChannelGotify     = "gotify"
+	ChannelNtfy       = "ntfy"
+	ChannelEmail      = "email"
+	ChannelSlack      = "slack"
+	ChannelMattermost = "mattermost"
+)
+
+func init() {
+	config.RegisterCheck(checkRoutes)
+}
+
+// checkRoutes reports routes of conf to unknown channels.
+func checkRoutes(conf config.Config) []config.Problem {
+	for _, spec := range conf.NotifyRoutes {
+		for _, target := range ParseTargets(spec) {
+			switch target.Channel {
+			case ChannelGotify, ChannelNtfy, ChannelEmail, ChannelSlack, ChannelMattermost:
+			default:
+				return []config.Problem{{
+					Var:     "NOTIFY_ROUTES",
+					Message: fmt.Sprintf("unknown channel %q, known are %s, %s, %s, %s and %s", target.Channel, ChannelGotify, ChannelNtfy, ChannelEmail, ChannelSlack, ChannelMattermost),
+					Example: "post_failure=gotify:8,post_success=ntfy:low",
+				}}
+			}
+		}
+	}
+	return nil
+}
+
+// Event is a single notification-worthy occurrence.
+type Event struct {
+	Type     EventType
+	Severity Severity
+	Title    string
+	Message  string
+	// URL is an optional link related to the event, such as the post that
+	// failed to publish.
+	URL string
+}
+
+// Target is a channel an event is routed to, with an optional priority whose
+// meaning depends on the channel (an integer for Gotify, a name or 1-5 for ntfy).
+type Target struct {
+	Channel  string
+	Priority string
+}
+
+// LogFailure logs a post failure and notifies the channels routed for it.
+func LogFailure(conf *config.Config, title string, postURL string, err error) {
+	log.Printf("%s: %s", title, err)
+	Send(conf, Event{
+		Type:     EventPostFailure,
+		Severity: SeverityError,
+		Title:    title,
+		Message:  err.Error(),
+		URL:      postURL,
+	})
+}
+
+// LogSuccess logs a successful post and notifies the channels routed for it.
+func LogSuccess(conf *config.Config, message string, postURL string) {
+	log.Info(message)
+	Send(conf, Event{
+		Type:     EventPostSuccess,
+		Severity: SeverityInfo,
+		Title:    "rss2socials success",
+		Message:  message,
+		URL:      postURL,
+	})
+}
+
+// Send delivers ev to every channel it is routed to. Delivery errors are
+// logged rather than returned so that notification problems never interrupt
+// posting.
+func Send(conf *config.Config, ev Event) {
+	for _, target := range Routes(conf, ev) {
+		if err := deliver(conf, target, ev); err != nil {
+			log.Printf("Error sending %s notification: %s", target.Channel, err)
+		}
+	}
+}
+
+// Routes returns the targets ev should be delivered to. Routes configured for
+// the event type take precedence over routes configured for its severity,
+// which take precedence over a "*" catch-all route.
+func Routes(conf *config.Config, ev Event) []Target {
+	if len(conf.NotifyRoutes) == 0 {
+		return defaultRoutes(conf, ev)
+	}
+	if spec, ok := lookup(conf.NotifyRoutes, ev); ok {
+		return ParseTargets(spec)
+	}
+	return nil
+}
+
+// lookup returns the value m configures for ev: the one for its event type,
+// else the one for its severity, else the "*" catch-all.
+func lookup[V any](m map[string]V, ev Event) (V, bool) {
+	for _, key := range []string{string(ev.Type), string(ev.Severity), "*"} {
+		if v, ok := m[key]; ok {
+			return v, true
+		}
+	}
+	var zero V
+	return zero, false
+}
+
+// ParseTargets parses a route specification of the form
+// "channel[:priority]|channel[:priority]", e.g. "gotify:8|ntfy:low".
+// The value "none" routes an event nowhere.
+func ParseTargets(spec string) []Target {
+	var targets []Target
+	for _, part := range strings.Split(spec, "|") {
+		part = strings.TrimSpace(part)
+		if part == "" || part == "none" {
+			continue
+		}
+		channel, priority, _ := strings.Cut(part, ":")
+		targets = append(targets, Target{
+			Channel:  strings.ToLower(strings.TrimSpace(channel)),
+			Priority: strings.TrimSpace(priority),
+		})
+	}
+	return targets
+}
+
+// Channels returns the channels any event can be delivered to, sorted.
+func Channels(conf *config.Config) []string {
+	if len(conf.NotifyRoutes) == 0 {
+		if conf.GotifyURL == "" || conf.GotifyToken == "" {
+			return nil
+		}
+		return []string{ChannelGotify}
+	}
+	var channels []string
+	for _, spec := range conf.NotifyRoutes {
+		for _, target := range ParseTargets(spec) {
+			if !slices.Contains(channels, target.Channel) {
+				channels = append(channels, target.Channel)
+			}
+		}
+	}
+	slices.Sort(channels)
+	return channels
+}
+
+func defaultRoutes(conf *config.Config, ev Event) []Target {
+	if conf.GotifyURL == "" || conf.GotifyToken == "" {
+		return nil
+	}
+	if ev.Type == EventPostSuccess && !conf.GotifyNotifyOnSuccess {
+		return nil
+	}
+	return []Target{{Channel: ChannelGotify}}
+}
+
+func deliver(conf *config.Config, target Target, ev Event) error {
+	switch target.Channel {
+	case ChannelGotify:
+		// Zero falls back to GotifyPriority, an empty token to GotifyToken.
+		priority, _ := lookup(conf.GotifyPriorities, ev)
+		token, _ := lookup(conf.GotifyTokens, ev)
+		if target.Priority != "" {
+			p, err := strconv.Atoi(target.Priority)
+			if err != nil {
+				return fmt.Errorf("invalid gotify priority %q", target.Priority)
+			}
+			priority = p
+		}
+		// Gotify clients only open the click URL when tapped, so the link is
+		// also included in the body to identify the post.
+		message := ev.Message
+		if ev.URL != "" {
+			message += "\n\n" + ev.URL
+		}
+		return gotify.Send(conf, gotify.Message{
+			Title:    ev.Title,
+			Message:  message,
+			Priority: priority,
+			ClickURL: ev.URL,
+			Token:    token,
+		})
+	case ChannelNtfy:
+		return sendNtfy(conf, target.Priority, ev)
+	case ChannelEmail:
+		return sendEmail(conf, ev)
+	case ChannelSlack:
+		return sendSlack(conf, ev)
+	case ChannelMattermost:
+		return sendMattermost(conf, ev)
+	}
+	return errors.New("unknown notification channel: " + target.Channel)
+}
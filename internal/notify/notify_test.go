@@ -0,0 +1,234 @@
+package notify
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/smtp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/toozej/rss2socials/pkg/config"
+)
+
+func TestParseTargets(t *testing.T) {
+	assert.Equal(t, []Target{{Channel: "gotify", Priority: "8"}, {Channel: "ntfy", Priority: "low"}}, ParseTargets("gotify:8|NTFY:low"))
+	assert.Equal(t, []Target{{Channel: "email"}}, ParseTargets(" email "))
+	assert.Nil(t, ParseTargets("none"))
+}
+
+func TestRoutes(t *testing.T) {
+	conf := &config.Config{
+		NotifyRoutes: map[string]string{
+			"post_failure": "gotify:8",
+			"warning":      "email",
+			"*":            "ntfy:min",
+		},
+	}
+
+	tests := []struct {
+		name     string
+		event    Event
+		expected []Target
+	}{
+		{"event type route", Event{Type: EventPostFailure, Severity: SeverityError}, []Target{{Channel: "gotify", Priority: "8"}}},
+		{"severity route", Event{Type: EventTokenExpiry, Severity: SeverityWarning}, []Target{{Channel: "email"}}},
+		{"catch-all route", Event{Type: EventPostSuccess, Severity: SeverityInfo}, []Target{{Channel: "ntfy", Priority: "min"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, Routes(conf, tt.event))
+		})
+	}
+}
+
+func TestRoutes_DefaultsToGotify(t *testing.T) {
+	conf := &config.Config{GotifyURL: "https://gotify.example.com", GotifyToken: "token"}
+
+	assert.Equal(t, []Target{{Channel: ChannelGotify}}, Routes(conf, Event{Type: EventPostFailure}))
+	assert.Nil(t, Routes(conf, Event{Type: EventPostSuccess}), "successes only go to Gotify when GotifyNotifyOnSuccess is set")
+
+	conf.GotifyNotifyOnSuccess = true
+	assert.Equal(t, []Target{{Channel: ChannelGotify}}, Routes(conf, Event{Type: EventPostSuccess}))
+
+	assert.Nil(t, Routes(&config.Config{}, Event{Type: EventPostFailure}), "no Gotify credentials means no default route")
+}
+
+func TestChannels(t *testing.T) {
+	assert.Nil(t, Channels(&config.Config{}))
+	assert.Equal(t, []string{ChannelGotify}, Channels(&config.Config{GotifyURL: "https://gotify.example.com", GotifyToken: "token"}))
+	assert.Equal(t, []string{ChannelEmail, ChannelGotify, ChannelNtfy}, Channels(&config.Config{NotifyRoutes: map[string]string{
+		"post_failure": "gotify:8|ntfy",
+		"post_success": "ntfy:low",
+		"token_expiry": "email",
+		"info":         "none",
+	}}))
+}
+
+func TestCheckRoutes(t *testing.T) {
+	assert.Empty(t, checkRoutes(config.Config{NotifyRoutes: map[string]string{"error": "gotify:8|Slack", "info": "none"}}))
+	problems := checkRoutes(config.Config{NotifyRoutes: map[string]string{"error": "gotify|pager"}})
+	require.Len(t, problems, 1)
+	assert.Equal(t, "NOTIFY_ROUTES", problems[0].Var)
+	assert.Contains(t, problems[0].Message, `unknown channel "pager"`)
+
+	conf, _ := config.Config{NotifyRoutes: map[string]string{"error": "pager"}}.WithDefaults()
+	assert.Nil(t, conf.NotifyRoutes, "invalid routes are replaced with the default")
+}
+
+func TestSend_Ntfy(t *testing.T) {
+	var gotPriority, gotTitle, gotClick, gotBody string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPriority = r.Header.Get("Priority")
+		gotTitle = r.Header.Get("Title")
+		gotClick = r.Header.Get("Click")
+		body, _ := io.ReadAll(r.Body)
+		gotBody = string(body)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	conf := &config.Config{
+		NtfyURL:      server.URL + "/topic",
+		NotifyRoutes: map[string]string{"post_success": "ntfy:low"},
+	}
+	LogSuccess(conf, "Successfully posted to Mastodon: Hello", "https://example.com/hello")
+
+	assert.Equal(t, "low", gotPriority)
+	assert.Equal(t, "rss2socials success", gotTitle)
+	assert.Equal(t, "https://example.com/hello", gotClick)
+	assert.Equal(t, "Successfully posted to Mastodon: Hello", gotBody)
+}
+
+func TestSend_GotifyIncludesPostLink(t *testing.T) {
+	var payload map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&payload)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	conf := &config.Config{GotifyURL: server.URL, GotifyToken: "token"}
+	LogFailure(conf, "Failed to post to Bluesky: Hello", "https://example.com/hello", errors.New("bluesky down"))
+
+	assert.Equal(t, "Failed to post to Bluesky: Hello", payload["title"])
+	assert.Equal(t, "bluesky down\n\nhttps://example.com/hello", payload["message"])
+}
+
+func TestSend_GotifyApplicationsAndPriorities(t *testing.T) {
+	type received struct {
+		token    string
+		priority float64
+	}
+	var got []received
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]any
+		_ = json.NewDecoder(r.Body).Decode(&payload)
+		got = append(got, received{r.Header.Get("X-Gotify-Key"), payload["priority"].(float64)})
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	conf := &config.Config{
+		GotifyURL:             server.URL,
+		GotifyToken:           "default-token",
+		GotifyPriority:        5,
+		GotifyNotifyOnSuccess: true,
+		GotifyTokens:          map[string]string{"error": "alerts-token", "info": "digest-token"},
+		GotifyPriorities:      map[string]int{"post_failure": 9, "info": 1},
+	}
+	LogFailure(conf, "Failed to post to Bluesky: Hello", "https://example.com/hello", errors.New("bluesky down"))
+	LogSuccess(conf, "Successfully posted to Bluesky: Hello", "https://example.com/hello")
+	Send(conf, Event{Type: EventTokenExpiry, Severity: SeverityWarning, Title: "Token expiring"})
+
+	conf.NotifyRoutes = map[string]string{"*": "gotify:7"}
+	LogFailure(conf, "Failed to post to Bluesky: Hello", "https://example.com/hello", errors.New("bluesky down"))
+
+	assert.Equal(t, []received{
+		{"alerts-token", 9},
+		{"digest-token", 1},
+		{"default-token", 5},
+		{"alerts-token", 7}, // a route priority wins
+	}, got)
+}
+
+func TestSend_Slack(t *testing.T) {
+	var payload map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&payload)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	conf := &config.Config{
+		SlackWebhookURL: server.URL + "/services/T000/B000/secret",
+		NotifyRoutes:    map[string]string{"post_failure": "slack"},
+	}
+	LogFailure(conf, "Failed to post to Bluesky: Hello", "https://example.com/hello?a=1&b=2", errors.New("status 500: <html>"))
+
+	assert.Equal(t, ":rotating_light: Failed to post to Bluesky: Hello: status 500: &lt;html&gt;", payload["text"])
+	blocks := payload["blocks"].([]any)
+	require.Len(t, blocks, 3)
+	assert.Equal(t, map[string]any{"type": "plain_text", "text": ":rotating_light: Failed to post to Bluesky: Hello", "emoji": true}, blocks[0].(map[string]any)["text"])
+	assert.Equal(t, map[string]any{"type": "mrkdwn", "text": "status 500: &lt;html&gt;"}, blocks[1].(map[string]any)["text"])
+	assert.Equal(t, []any{map[string]any{"type": "mrkdwn", "text": "<https://example.com/hello?a=1&amp;b=2|View post>"}}, blocks[2].(map[string]any)["elements"])
+}
+
+func TestSend_Mattermost(t *testing.T) {
+	var payload map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&payload)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	conf := &config.Config{
+		MattermostWebhookURL: server.URL + "/hooks/secret",
+		NotifyRoutes:         map[string]string{"post_success": "mattermost"},
+	}
+	LogSuccess(conf, "Successfully posted to Mastodon: Hello", "https://example.com/hello")
+
+	assert.Equal(t, "#### :white_check_mark: rss2socials success\nSuccessfully posted to Mastodon: Hello\n\n[View post](https://example.com/hello)", payload["text"])
+}
+
+func TestSend_Email(t *testing.T) {
+	var gotAddr string
+	var gotTo []string
+	var gotMsg string
+	sendMail = func(addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+		gotAddr, gotTo, gotMsg = addr, to, string(msg)
+		return nil
+	}
+	defer func() { sendMail = smtp.SendMail }()
+
+	conf := &config.Config{
+		SMTPHost:      "smtp.example.com",
+		SMTPPort:      587,
+		SMTPFrom:      "bot@example.com",
+		NotifyEmailTo: []string{"me@example.com"},
+		NotifyRoutes:  map[string]string{"token_expiry": "email"},
+	}
+	Send(conf, Event{Type: EventTokenExpiry, Severity: SeverityWarning, Title: "Token expiring\nBcc: x", Message: "Threads token expires soon"})
+
+	assert.Equal(t, "smtp.example.com:587", gotAddr)
+	assert.Equal(t, []string{"me@example.com"}, gotTo)
+	assert.Contains(t, gotMsg, "Subject: Token expiring Bcc: x\r\n")
+	assert.True(t, strings.HasSuffix(gotMsg, "Threads token expires soon"))
+}
+
+func TestDeliver_Errors(t *testing.T) {
+	conf := &config.Config{}
+	require.Error(t, deliver(conf, Target{Channel: "pager"}, Event{}))
+	require.Error(t, deliver(conf, Target{Channel: ChannelNtfy}, Event{}))
+	require.Error(t, deliver(conf, Target{Channel: ChannelEmail}, Event{}))
+	require.Error(t, deliver(conf, Target{Channel: ChannelSlack}, Event{}))
+	require.Error(t, deliver(conf, Target{Channel: ChannelMattermost}, Event{}))
+
+	conf.GotifyURL, conf.GotifyToken = "https://gotify.example.com", "token"
+	assert.EqualError(t, deliver(conf, Target{Channel: ChannelGotify, Priority: "high"}, Event{}), `invalid gotify priority "high"`)
+}
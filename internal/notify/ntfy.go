@@ -0,0 +1,49 @@
+package notify
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/toozej/rss2socials/internal/httpbody"
+	"github.com/toozej/rss2socials/internal/redact"
+	"github.com/toozej/rss2socials/pkg/config"
+)
+
+// sendNtfy publishes ev to the configured ntfy topic URL. priority may be a
+// ntfy priority name (min, low, default, high, urgent) or number (1-5).
+func sendNtfy(conf *config.Config, priority string, ev Event) error {
+	if conf.NtfyURL == "" {
+		return fmt.Errorf("ntfy URL is not configured")
+	}
+
+	req, err := http.NewRequest("POST", conf.NtfyURL, strings.NewReader(redact.String(ev.Message)))
+	if err != nil {
+		return fmt.Errorf("failed to create ntfy request: %w", err)
+	}
+
+	req.Header.Set("Title", redact.String(ev.Title))
+	if priority != "" {
+		req.Header.Set("Priority", priority)
+	}
+	if ev.URL != "" {
+		req.Header.Set("Click", ev.URL)
+	}
+	req.Header.Set("Tags", string(ev.Severity))
+	if conf.NtfyToken != "" {
+		req.Header.Set("Authorization", "Bearer "+conf.NtfyToken)
+	}
+
+	client := &http.Client{}
+	resp, err := client.Do(req) // #nosec G704 -- NtfyURL is from config, not user input
+	if err != nil {
+		return fmt.Errorf("failed to send ntfy request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("ntfy returned non-OK status: %s", httpbody.Status(resp))
+	}
+
+	return nil
+}
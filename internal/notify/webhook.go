@@ -0,0 +1,101 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/toozej/rss2socials/internal/httpbody"
+	"github.com/toozej/rss2socials/internal/redact"
+	"github.com/toozej/rss2socials/pkg/config"
+)
+
+// slackHeaderMaxChars is the length limit of a Block Kit header.
+const slackHeaderMaxChars = 150
+
+// severityEmoji prefixes the titles of chat messages, so that failures
+// stand out in a busy channel. Slack and Mattermost share the shortcodes.
+var severityEmoji = map[Severity]string{
+	SeverityInfo:    ":white_check_mark:",
+	SeverityWarning: ":warning:",
+	SeverityError:   ":rotating_light:",
+}
+
+// sendSlack posts ev to the configured Slack incoming webhook as Block Kit
+// blocks: the title as a header, the message, and a link to the post.
+func sendSlack(conf *config.Config, ev Event) error {
+	if conf.SlackWebhookURL == "" {
+		return fmt.Errorf("slack webhook URL is not configured")
+	}
+	title := strings.TrimSpace(severityEmoji[ev.Severity] + " " + redact.String(ev.Title))
+	if r := []rune(title); len(r) > slackHeaderMaxChars {
+		title = string(r[:slackHeaderMaxChars-1]) + "…"
+	}
+	message := slackEscape(redact.String(ev.Message))
+
+	blocks := []map[string]any{
+		{"type": "header", "text": map[string]any{"type": "plain_text", "text": title, "emoji": true}},
+	}
+	if message != "" {
+		blocks = append(blocks, map[string]any{"type": "section", "text": map[string]string{"type": "mrkdwn", "text": message}})
+	}
+	if ev.URL != "" {
+		blocks = append(blocks, map[string]any{"type": "context", "elements": []map[string]string{
+			{"type": "mrkdwn", "text": fmt.Sprintf("<%s|View post>", slackEscape(ev.URL))},
+		}})
+	}
+	// text is shown in notifications, where blocks are not rendered.
+	return postWebhook("slack", conf.SlackWebhookURL, map[string]any{
+		"text":   title + ": " + message,
+		"blocks": blocks,
+	})
+}
+
+// sendMattermost posts ev to the configured Mattermost incoming webhook as
+// markdown.
+func sendMattermost(conf *config.Config, ev Event) error {
+	if conf.MattermostWebhookURL == "" {
+		return fmt.Errorf("mattermost webhook URL is not configured")
+	}
+	text := fmt.Sprintf("#### %s %s", severityEmoji[ev.Severity], redact.String(ev.Title))
+	if ev.Message != "" {
+		text += "\n" + redact.String(ev.Message)
+	}
+	if ev.URL != "" {
+		text += fmt.Sprintf("\n\n[View post](%s)", ev.URL)
+	}
+	return postWebhook("mattermost", conf.MattermostWebhookURL, map[string]any{"text": text})
+}
+
+// slackEscape escapes the characters Slack's mrkdwn gives a meaning.
+func slackEscape(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(s)
+}
+
+// postWebhook posts payload as JSON to the incoming webhook url of service.
+func postWebhook(service, url string, payload any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s message: %w", service, err)
+	}
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		// The webhook URL is not included, as it is a credential.
+		return fmt.Errorf("failed to create %s request", service)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := &http.Client{}
+	resp, err := client.Do(req) // #nosec G704 -- the webhook URL is from config, not user input
+	if err != nil {
+		return fmt.Errorf("failed to send %s request: %w", service, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned non-OK status: %s", service, httpbody.Status(resp))
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package posttemplate
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/toozej/rss2socials/internal/rss"
+	"github.com/toozej/rss2socials/pkg/config"
+)
+
+var benchItem = rss.RSSItem{
+	Title:   "Faster Builds with Go 1.26",
+	Link:    "https://example.com/posts/faster-builds/",
+	PubDate: "Mon, 02 Mar 2026 10:00:00 +0000",
+	Content: strings.Repeat(`<p>Lorem ipsum dolor sit amet, <a href="https://example.com">consectetur</a> adipiscing elit.</p>`+"\n", 20),
+}
+
+func BenchmarkRender(b *testing.B) {
+	for name, conf := range map[string]config.Config{
+		"default": {},
+		"custom":  {PostTemplate: `{{.Title}}: {{.Content | stripHTML | firstSentence | ellipsis 280}} {{.Link}}`},
+		"locale":  {Locale: "de", Messages: map[string]string{"new_post": "Neu:"}},
+	} {
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			for b.Loop() {
+				if _, err := Render(conf, benchItem, false); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkStripHTML(b *testing.B) {
+	b.SetBytes(int64(len(benchItem.Content)))
+	b.ReportAllocs()
+	for b.Loop() {
+		StripHTML(benchItem.Content)
+	}
+}
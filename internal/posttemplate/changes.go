@@ -0,0 +1,107 @@
+package posttemplate
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/toozej/rss2socials/internal/messages"
+)
+
+// changeSummaryChars caps the length of an added sentence quoted in the
+// description of what changed.
+const changeSummaryChars = 80
+
+var (
+	htmlHeadingPattern     = regexp.MustCompile(`(?is)<h[1-6][^>]*>(.*?)</h[1-6]\s*>`)
+	markdownHeadingPattern = regexp.MustCompile(`(?m)^#{1,6}[ \t]+(.+?)[ \t#]*$`)
+	// blockTagPattern matches the tags that end a sentence even without
+	// punctuation, e.g. between list items.
+	blockTagPattern    = regexp.MustCompile(`(?i)</?(?:p|div|br|li|ul|ol|blockquote|pre|table|tr|td|th|section|article|header|footer)\b[^>]*>`)
+	sentenceEndPattern = regexp.MustCompile(`([.!?…])\s+`)
+)
+
+// ContentDiff is what an update added to the content of a post.
+type ContentDiff struct {
+	// AddedHeadings are the HTML or Markdown headings the previous
+	// content lacked.
+	AddedHeadings []string
+	// AddedSentences are the sentences outside of headings the previous
+	// content lacked.
+	AddedSentences []string
+}
+
+// DiffContent returns what current added over previous. Text is compared
+// without markup, ignoring case and whitespace. Nothing is reported when
+// previous is empty, as then nothing is known about it.
+func DiffContent(previous, current string) ContentDiff {
+	if strings.TrimSpace(previous) == "" {
+		return ContentDiff{}
+	}
+	return ContentDiff{
+		AddedHeadings:  added(headings(previous), headings(current)),
+		AddedSentences: added(sentences(previous), sentences(current)),
+	}
+}
+
+// describe briefly describes d with the phrases of catalog, e.g. "added
+// section on Deployment", or returns an empty string when nothing was added.
+func (d ContentDiff) describe(catalog messages.Catalog) (string, error) {
+	var key, text string
+	switch {
+	case len(d.AddedHeadings) > 0:
+		key, text = messages.AddedSection, strings.Join(d.AddedHeadings, ", ")
+	case len(d.AddedSentences) > 0:
+		key, text = messages.AddedText, Ellipsis(changeSummaryChars, d.AddedSentences[0])
+	default:
+		return "", nil
+	}
+	prefix, err := catalog.Get(key)
+	if err != nil {
+		return "", err
+	}
+	return prefix + " " + text, nil
+}
+
+// headings returns the text of the HTML and Markdown headings of s.
+func headings(s string) []string {
+	var found []string
+	for _, m := range htmlHeadingPattern.FindAllStringSubmatch(s, -1) {
+		found = append(found, StripHTML(m[1]))
+	}
+	for _, m := range markdownHeadingPattern.FindAllStringSubmatch(s, -1) {
+		found = append(found, StripHTML(m[1]))
+	}
+	return found
+}
+
+// sentences returns the sentences of s outside of headings.
+func sentences(s string) []string {
+	s = htmlHeadingPattern.ReplaceAllString(s, "\n")
+	s = markdownHeadingPattern.ReplaceAllString(s, "\n")
+	s = blockTagPattern.ReplaceAllString(s, "\n")
+	s = sentenceEndPattern.ReplaceAllString(s, "$1\n")
+	var found []string
+	for _, line := range strings.Split(s, "\n") {
+		found = append(found, StripHTML(line))
+	}
+	return found
+}
+
+// added returns the non-empty texts of current missing from previous, in
+// order and without duplicates.
+func added(previous, current []string) []string {
+	known := make(map[string]bool, len(previous))
+	for _, text := range previous {
+		known[strings.ToLower(text)] = true
+	}
+	var result []string
+	for _, text := range current {
+		key := strings.ToLower(text)
+		if text == "" || known[key] {
+			continue
+		}
+		known[key] = true
+		result = append(result, text)
+	}
+	return result
+}
@@ -0,0 +1,48 @@
+package posttemplate
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/toozej/rss2socials/internal/rss"
+	"github.com/toozej/rss2socials/pkg/config"
+)
+
+func TestDiffContent(t *testing.T) {
+	previous := `<h2>Setup</h2><p>Install it. Run it!</p><ul><li>Fast</li><li>Small</li></ul>`
+	current := `<h2>Setup</h2><p>Install it.  run it! Then configure it.</p><ul><li>Fast</li><li>Small</li><li>Safe</li></ul>
+<h2 id="deploy">Deploying to <em>Kubernetes</em></h2><p>Use the chart.</p>`
+
+	assert.Equal(t, ContentDiff{
+		AddedHeadings:  []string{"Deploying to Kubernetes"},
+		AddedSentences: []string{"Then configure it.", "Safe", "Use the chart."},
+	}, DiffContent(previous, current))
+
+	assert.Equal(t, ContentDiff{AddedHeadings: []string{"Testing"}, AddedSentences: []string{"Run go test."}},
+		DiffContent("# Intro\nHello.", "# Intro\nHello.\n\n## Testing ##\nRun go test."))
+	assert.Equal(t, ContentDiff{}, DiffContent("", current), "nothing is known about content stored without it")
+	assert.Equal(t, ContentDiff{}, DiffContent(current, previous), "removals are not described")
+}
+
+func TestRenderUpdate(t *testing.T) {
+	item := rss.RSSItem{Link: "https://example.com/hello"}
+
+	got, err := RenderUpdate(config.Config{}, item, ContentDiff{AddedHeadings: []string{"Deployment", "Testing"}})
+	require.NoError(t, err)
+	assert.Equal(t, "Updated post: https://example.com/hello (added section on Deployment, Testing)", got)
+
+	got, err = RenderUpdate(config.Config{Locale: "de"}, item, ContentDiff{AddedSentences: []string{"Jetzt auch mit Docker."}})
+	require.NoError(t, err)
+	assert.Equal(t, "Aktualisierter Beitrag: https://example.com/hello (ergänzt: Jetzt auch mit Docker.)", got)
+
+	got, err = RenderUpdate(config.Config{}, item, ContentDiff{})
+	require.NoError(t, err)
+	assert.Equal(t, "Updated post: https://example.com/hello", got)
+
+	conf := config.Config{UpdateTemplate: `{{range .AddedHeadings}}New: {{.}} {{end}}{{.Link}}`}
+	got, err = RenderUpdate(conf, item, ContentDiff{AddedHeadings: []string{"Deployment"}})
+	require.NoError(t, err)
+	assert.Equal(t, "New: Deployment https://example.com/hello", got)
+}
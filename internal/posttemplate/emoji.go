@@ -0,0 +1,117 @@
+package posttemplate
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+	"text/template/parse"
+
+	"github.com/toozej/rss2socials/pkg/config"
+)
+
+// shortcodePattern matches the custom emoji shortcodes of Mastodon, e.g.
+// ":blobcat:", that are not part of a word, such as a time of day.
+var shortcodePattern = regexp.MustCompile(`(?:^|\W):(\w{2,}):`)
+
+// Emoji returns the custom emoji shortcode of name, e.g. "blobcat" ->
+// ":blobcat:", which Mastodon renders as the instance's emoji.
+func Emoji(name string) string {
+	return ":" + strings.Trim(name, ":") + ":"
+}
+
+// TextShortcodes returns the custom emoji shortcodes of text, without
+// colons and in the order they appear.
+func TextShortcodes(text string) []string {
+	var codes []string
+	for _, m := range shortcodePattern.FindAllStringSubmatch(text, -1) {
+		if !slices.Contains(codes, m[1]) {
+			codes = append(codes, m[1])
+		}
+	}
+	return codes
+}
+
+// Shortcodes returns the custom emoji shortcodes of the template text,
+// without colons and in the order they appear: those in its text and those
+// of its emoji calls with a constant name.
+func Shortcodes(text string) ([]string, error) {
+	t, err := Parse("emoji", text)
+	if err != nil {
+		return nil, err
+	}
+	var codes []string
+	add := func(code string) {
+		if !slices.Contains(codes, code) {
+			codes = append(codes, code)
+		}
+	}
+	var walk func(parse.Node)
+	walk = func(node parse.Node) {
+		switch n := node.(type) {
+		case *parse.ListNode:
+			if n == nil {
+				return
+			}
+			for _, child := range n.Nodes {
+				walk(child)
+			}
+		case *parse.TextNode:
+			for _, code := range TextShortcodes(string(n.Text)) {
+				add(code)
+			}
+		case *parse.ActionNode:
+			walk(n.Pipe)
+		case *parse.PipeNode:
+			if n == nil {
+				return
+			}
+			for _, cmd := range n.Cmds {
+				walk(cmd)
+			}
+		case *parse.CommandNode:
+			if len(n.Args) == 2 {
+				if fn, ok := n.Args[0].(*parse.IdentifierNode); ok && fn.Ident == "emoji" {
+					if name, ok := n.Args[1].(*parse.StringNode); ok {
+						add(strings.Trim(name.Text, ":"))
+					}
+				}
+			}
+			for _, arg := range n.Args {
+				walk(arg)
+			}
+		case *parse.IfNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.RangeNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.WithNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		}
+	}
+	walk(t.Root)
+	return codes, nil
+}
+
+// SiteTemplates returns the templates posts to site are rendered from by
+// name: the post and update templates and its template variants.
+func SiteTemplates(conf config.Config, site string) map[string]string {
+	templates := map[string]string{"post": conf.PostTemplate, "update": conf.UpdateTemplate}
+	if templates["post"] == "" {
+		templates["post"] = DefaultPost
+	}
+	if templates["update"] == "" {
+		templates["update"] = DefaultUpdate
+	}
+	variants, _ := conf.Variants()
+	for _, v := range variants {
+		if v.Site == "" || v.Site == site {
+			templates[variantName(v)] = v.Template
+		}
+	}
+	return templates
+}
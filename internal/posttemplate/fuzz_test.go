@@ -0,0 +1,58 @@
+package posttemplate
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// FuzzStripHTML checks that StripHTML leaves no surrounding whitespace or
+// runs of whitespace, and keeps valid UTF-8 valid.
+func FuzzStripHTML(f *testing.F) {
+	f.Add(`<p>Hello <b>world</b></p>`)
+	f.Add(`<script>if (a < b) {}</script>after`)
+	f.Add(`&lt;p&gt;escaped&lt;/p&gt; &amp;amp; &#x1F600; &#xD800; &nbsp;`)
+	f.Add("<p\n class='x'>multi\nline</p>\t\t<br/>")
+	f.Add(`<unterminated`)
+	f.Add(`&Tab;&NewLine;&#9;`)
+	f.Fuzz(func(t *testing.T, s string) {
+		got := StripHTML(s)
+		if got != strings.TrimSpace(got) {
+			t.Fatalf("StripHTML(%q) = %q, has surrounding whitespace", s, got)
+		}
+		if strings.ContainsAny(got, "\t\n\f\r") || strings.Contains(got, "  ") {
+			t.Fatalf("StripHTML(%q) = %q, has uncollapsed whitespace", s, got)
+		}
+		if utf8.ValidString(s) && !utf8.ValidString(got) {
+			t.Fatalf("StripHTML(%q) = %q, is not valid UTF-8", s, got)
+		}
+	})
+}
+
+// FuzzEllipsis checks that Ellipsis, Truncate and FirstSentence never
+// return more characters than they were given or asked for.
+func FuzzEllipsis(f *testing.F) {
+	f.Add(10, "The quick brown fox jumps over the lazy dog.")
+	f.Add(1, "ab")
+	f.Add(0, "abc")
+	f.Add(-5, "abc")
+	f.Add(3, "日本語のテキスト")
+	f.Add(5, "Done! Next.")
+	f.Fuzz(func(t *testing.T, n int, s string) {
+		if utf8.RuneCountInString(s) <= n {
+			if Ellipsis(n, s) != s || Truncate(n, s) != s {
+				t.Fatalf("Ellipsis or Truncate shortened %q, which fits in %d characters", s, n)
+			}
+		} else {
+			if got := utf8.RuneCountInString(Ellipsis(n, s)); got > max(n, 0) {
+				t.Fatalf("Ellipsis(%d, %q) has %d characters", n, s, got)
+			}
+			if got := utf8.RuneCountInString(Truncate(n, s)); got > max(n, 0) {
+				t.Fatalf("Truncate(%d, %q) has %d characters", n, s, got)
+			}
+		}
+		if got := FirstSentence(s); !strings.Contains(s, got) {
+			t.Fatalf("FirstSentence(%q) = %q, not part of its input", s, got)
+		}
+	})
+}
@@ -0,0 +1,298 @@
+// Package posttemplate renders the text of social posts from feed items
+// using Go text/template, so that post formats can be customized through
+// configuration without code changes.
+//
+// Templates are executed with a Data value and can use the helper functions
+// returned by Funcs, for example:
+//
+//	{{.Title | upper}}: {{.Content | stripHTML | firstSentence | ellipsis 200}} {{.Link}}
+//	Published {{.Published.Format "Jan 2"}}: {{.Link}}
+package posttemplate
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"slices"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/toozej/rss2socials/internal/charcount"
+	"github.com/toozej/rss2socials/internal/messages"
+	"github.com/toozej/rss2socials/internal/rss"
+	"github.com/toozej/rss2socials/pkg/config"
+)
+
+// Default templates used when Config.PostTemplate or Config.UpdateTemplate
+// is empty. Their phrases come from the message catalog of Config.Locale.
+const (
+	DefaultPost   = `{{msg "new_post"}} {{.Link}}`
+	DefaultUpdate = `{{msg "updated_post"}} {{.Link}}{{with .Changes}} ({{.}}){{end}}`
+)
+
+// Data is the value post templates are executed with.
+type Data struct {
+	Title   string
+	Link    string
+	Content string
+	PubDate string
+	// Published is the parsed PubDate, or the zero time when the item has
+	// no parsable pubDate. Use it as {{.Published.Format "2006-01-02"}}.
+	Published time.Time
+	// IsUpdate is true when the post announces an update to an item that
+	// was already published.
+	IsUpdate bool
+	// Changes briefly describes what an update added, e.g. "added section
+	// on Deployment", in the phrases of the locale. It is empty for new
+	// posts, and for updates that only removed or reworded content.
+	Changes string
+	// AddedHeadings and AddedSentences are what an update added to the
+	// content, for templates describing the changes themselves.
+	AddedHeadings  []string
+	AddedSentences []string
+	// Extensions are the item's namespaced elements, e.g.
+	// {{.Extensions.Get "itunes:duration"}} or
+	// {{.Extensions.Attr "media:content" "url"}}.
+	Extensions rss.Extensions
+}
+
+// Funcs returns the helper functions available to post templates:
+//
+//   - truncate N s: the first N characters of s
+//   - ellipsis N s: s shortened to N characters including a trailing "…"
+//   - stripHTML s: s without HTML tags and with entities decoded
+//   - firstSentence s: the first sentence of s
+//   - hashtags s: the words of s as hashtags, e.g. "Go, RSS" -> "#Go #RSS"
+//   - upper s, lower s: s in upper or lower case
+//   - chars s, words s, graphemes s: wc-style counts of s
+//   - msg KEY: the phrase KEY of the message catalog, e.g. msg "new_post"
+//   - emoji NAME: the Mastodon custom emoji shortcode NAME, e.g.
+//     emoji "blobcat" -> ":blobcat:"
+func Funcs() template.FuncMap {
+	return template.FuncMap{
+		"truncate":      Truncate,
+		"ellipsis":      Ellipsis,
+		"stripHTML":     StripHTML,
+		"firstSentence": FirstSentence,
+		"hashtags":      Hashtags,
+		"upper":         strings.ToUpper,
+		"lower":         strings.ToLower,
+		"chars":         utf8.RuneCountInString,
+		"words":         func(s string) int { return len(strings.Fields(s)) },
+		"graphemes":     charcount.Graphemes,
+		"msg":           messages.Catalog{}.Get,
+		"emoji":         Emoji,
+	}
+}
+
+// Parse parses a post template with the helper functions available.
+func Parse(name, text string) (*template.Template, error) {
+	t, err := template.New(name).Funcs(Funcs()).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s template: %w", name, err)
+	}
+	return t, nil
+}
+
+func init() {
+	config.RegisterCheck(check)
+}
+
+// check reports the post, update and variant templates of conf that do not
+// parse.
+func check(conf config.Config) []config.Problem {
+	var problems []config.Problem
+	if _, err := Parse("post", conf.PostTemplate); err != nil {
+		problems = append(problems, config.Problem{Var: "POST_TEMPLATE", Message: err.Error(), Example: "{{.Title}} {{.Link}}"})
+	}
+	if _, err := Parse("update", conf.UpdateTemplate); err != nil {
+		problems = append(problems, config.Problem{Var: "UPDATE_TEMPLATE", Message: err.Error(), Example: "Updated: {{.Link}}"})
+	}
+	// Variants that do not split are reported by Config.Validate.
+	variants, _ := conf.Variants()
+	for _, v := range variants {
+		if _, err := Parse(variantName(v), v.Template); err != nil {
+			problems = append(problems, config.Problem{Var: "TEMPLATE_VARIANTS", Message: err.Error(), Example: "short=New: {{.Link}};;teaser*2={{.Title}} {{.Link}}"})
+			break
+		}
+	}
+	return problems
+}
+
+// Render returns the post text for item using conf.PostTemplate, or
+// conf.UpdateTemplate when isUpdate is set, falling back to the defaults when
+// they are empty.
+func Render(conf config.Config, item rss.RSSItem, isUpdate bool) (string, error) {
+	return render(conf, item, isUpdate, ContentDiff{})
+}
+
+// RenderUpdate returns the post text announcing the update of item using
+// conf.UpdateTemplate, describing the changes of diff.
+func RenderUpdate(conf config.Config, item rss.RSSItem, diff ContentDiff) (string, error) {
+	return render(conf, item, true, diff)
+}
+
+// RenderText returns the text of the template text, called name in errors,
+// for the new item, such as the subject of the newsletter.
+func RenderText(conf config.Config, name, text string, item rss.RSSItem) (string, error) {
+	return execute(conf, name, text, item, false, ContentDiff{})
+}
+
+func render(conf config.Config, item rss.RSSItem, isUpdate bool, diff ContentDiff) (string, error) {
+	name, text := "post", conf.PostTemplate
+	if text == "" {
+		text = DefaultPost
+	}
+	if isUpdate {
+		name, text = "update", conf.UpdateTemplate
+		if text == "" {
+			text = DefaultUpdate
+		}
+	}
+	return execute(conf, name, text, item, isUpdate, diff)
+}
+
+// parsed caches the templates parsed by execute, keyed by parsedKey, as
+// the same few templates are rendered for every item of every cycle.
+var parsed sync.Map
+
+// parsedKey identifies a template by its name and text and the messages
+// its msg function returns.
+type parsedKey struct{ name, text, locale, messages string }
+
+// cached returns the template text, called name in errors, with the msg
+// function of catalog, parsing it only the first time.
+func cached(conf config.Config, name, text string, catalog messages.Catalog) (*template.Template, error) {
+	key := parsedKey{name: name, text: text, locale: conf.Locale}
+	if len(conf.Messages) > 0 {
+		overrides := make([]string, 0, len(conf.Messages))
+		for k, v := range conf.Messages {
+			overrides = append(overrides, k+"="+v)
+		}
+		slices.Sort(overrides)
+		key.messages = strings.Join(overrides, "\x00")
+	}
+	if t, ok := parsed.Load(key); ok {
+		return t.(*template.Template), nil
+	}
+	t, err := Parse(name, text)
+	if err != nil {
+		return nil, err
+	}
+	t.Funcs(template.FuncMap{"msg": catalog.Get})
+	actual, _ := parsed.LoadOrStore(key, t)
+	return actual.(*template.Template), nil
+}
+
+// execute renders the template text, called name in errors, for item.
+func execute(conf config.Config, name, text string, item rss.RSSItem, isUpdate bool, diff ContentDiff) (string, error) {
+	catalog, err := messages.New(conf.Locale, conf.Messages)
+	if err != nil {
+		return "", err
+	}
+	t, err := cached(conf, name, text, catalog)
+	if err != nil {
+		return "", err
+	}
+
+	published, _ := item.ParsePubDate()
+	changes, err := diff.describe(catalog)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, Data{
+		Title:          item.Title,
+		Link:           item.Link,
+		Content:        item.Content,
+		PubDate:        item.PubDate,
+		Published:      published,
+		IsUpdate:       isUpdate,
+		Changes:        changes,
+		AddedHeadings:  diff.AddedHeadings,
+		AddedSentences: diff.AddedSentences,
+		Extensions:     item.Extensions,
+	}); err != nil {
+		return "", fmt.Errorf("error rendering %s template: %w", name, err)
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
+
+// Truncate returns the first n characters of s.
+func Truncate(n int, s string) string {
+	if n < 0 {
+		n = 0
+	}
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n])
+}
+
+// Ellipsis shortens s to at most n characters, replacing the end with "…"
+// and avoiding cutting words in half when possible.
+func Ellipsis(n int, s string) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	if n <= 0 {
+		return ""
+	}
+	cut := string(runes[:n-1])
+	if i := strings.LastIndexFunc(cut, unicode.IsSpace); i > 0 {
+		cut = cut[:i]
+	}
+	return strings.TrimRightFunc(cut, func(r rune) bool {
+		return unicode.IsSpace(r) || unicode.IsPunct(r)
+	}) + "…"
+}
+
+// StripHTML removes HTML tags from s, decodes entities and collapses runs of
+// whitespace.
+func StripHTML(s string) string {
+	return rss.CollapseWhitespace(html.UnescapeString(rss.StripTags(s)))
+}
+
+// FirstSentence returns s up to and including the first '.', '!' or '?'
+// followed by whitespace or the end of s.
+func FirstSentence(s string) string {
+	s = strings.TrimSpace(s)
+	for i, r := range s {
+		if r != '.' && r != '!' && r != '?' {
+			continue
+		}
+		next := i + utf8.RuneLen(r)
+		if next == len(s) {
+			return s
+		}
+		if nr, _ := utf8.DecodeRuneInString(s[next:]); unicode.IsSpace(nr) {
+			return s[:next]
+		}
+	}
+	return s
+}
+
+// Hashtags turns the comma- or space-separated words of s into hashtags,
+// dropping characters that are not letters or digits.
+func Hashtags(s string) string {
+	var tags []string
+	for _, word := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || unicode.IsSpace(r) }) {
+		tag := strings.Map(func(r rune) rune {
+			if unicode.IsLetter(r) || unicode.IsDigit(r) {
+				return r
+			}
+			return -1
+		}, word)
+		if tag != "" {
+			tags = append(tags, "#"+tag)
+		}
+	}
+	return strings.Join(tags, " ")
+}
@@ -0,0 +1,174 @@
+package posttemplate
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/toozej/rss2socials/internal/rss"
+	"github.com/toozej/rss2socials/pkg/config"
+)
+
+func TestRender_Defaults(t *testing.T) {
+	item := rss.RSSItem{Title: "Hello", Link: "https://example.com/hello"}
+
+	got, err := Render(config.Config{}, item, false)
+	require.NoError(t, err)
+	assert.Equal(t, "New post: https://example.com/hello", got)
+
+	got, err = Render(config.Config{}, item, true)
+	require.NoError(t, err)
+	assert.Equal(t, "Updated post: https://example.com/hello", got)
+}
+
+func TestRender_CustomTemplateWithHelpers(t *testing.T) {
+	conf := config.Config{
+		PostTemplate: `{{.Title | upper}}: {{.Content | stripHTML | firstSentence}} {{hashtags "go, rss"}} {{.Link}}`,
+	}
+	item := rss.RSSItem{
+		Title:   "Hello",
+		Link:    "https://example.com/hello",
+		Content: "<p>First &amp; foremost. Second sentence.</p>",
+	}
+
+	got, err := Render(conf, item, false)
+	require.NoError(t, err)
+	assert.Equal(t, "HELLO: First & foremost. #go #rss https://example.com/hello", got)
+}
+
+func TestRender_Published(t *testing.T) {
+	conf := config.Config{PostTemplate: `Published {{.Published.Format "2006-01-02"}}: {{.Link}}`}
+	item := rss.RSSItem{Link: "https://example.com/hello", PubDate: "Mon, 02 Mar 2026 10:00:00 +0000"}
+
+	got, err := Render(conf, item, false)
+	require.NoError(t, err)
+	assert.Equal(t, "Published 2026-03-02: https://example.com/hello", got)
+}
+
+func TestRender_Extensions(t *testing.T) {
+	conf := config.Config{PostTemplate: `{{.Title}} ({{.Extensions.Get "itunes:duration"}}){{range .Extensions.media.content}} {{.Attrs.url}}{{end}}{{if .Extensions.Has "itunes:explicit"}} explicit{{end}}`}
+	item := rss.RSSItem{Title: "Episode", Extensions: rss.Extensions{
+		"itunes": {"duration": {{Name: "duration", Value: "42:00"}}},
+		"media":  {"content": {{Name: "content", Attrs: map[string]string{"url": "https://example.com/a.jpg"}}}},
+	}}
+
+	got, err := Render(conf, item, false)
+	require.NoError(t, err)
+	assert.Equal(t, "Episode (42:00) https://example.com/a.jpg", got)
+}
+
+func TestRender_InvalidTemplate(t *testing.T) {
+	conf := config.Config{PostTemplate: "{{.Title"}
+	_, err := Render(conf, rss.RSSItem{}, false)
+	assert.Error(t, err)
+	assert.Len(t, check(conf), 1)
+	assert.Empty(t, check(config.Config{}))
+	conf, _ = conf.WithDefaults()
+	assert.Empty(t, conf.PostTemplate, "an invalid template is replaced with the default")
+
+	conf = config.Config{PostTemplate: "{{.Missing}}"}
+	_, err = Render(conf, rss.RSSItem{}, false)
+	assert.Error(t, err)
+}
+
+func TestHelpers(t *testing.T) {
+	assert.Equal(t, "héll", Truncate(4, "héllo"))
+	assert.Equal(t, "hi", Truncate(5, "hi"))
+	assert.Equal(t, "", Truncate(-1, "hi"))
+
+	assert.Equal(t, "The quick…", Ellipsis(15, "The quick brown fox"))
+	assert.Equal(t, "short", Ellipsis(15, "short"))
+	assert.Equal(t, "", Ellipsis(0, "text"))
+
+	assert.Equal(t, "a b & c", StripHTML("<p>a</p>\n<b>b</b> &amp; c"))
+
+	assert.Equal(t, "Hi there!", FirstSentence("Hi there! More text."))
+	assert.Equal(t, "Version 1.2 is out.", FirstSentence("Version 1.2 is out. Yay"))
+	assert.Equal(t, "No terminator", FirstSentence("No terminator"))
+
+	assert.Equal(t, "#Go #RSS #socialmedia", Hashtags("Go, RSS social-media"))
+	assert.Equal(t, "", Hashtags(" , "))
+
+	funcs := Funcs()
+	assert.Equal(t, 3, funcs["words"].(func(string) int)("one two  three"))
+	assert.Equal(t, 5, funcs["chars"].(func(string) int)("héllo"))
+}
+
+func TestShortcodes(t *testing.T) {
+	codes, err := Shortcodes(`:rss: {{.Title}} {{emoji "blobcat"}}{{if .IsUpdate}} :update:{{else}}:new:{{end}} at 12:30:45 {{emoji ":rss:"}}`)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"rss", "blobcat", "update", "new"}, codes)
+
+	_, err = Shortcodes(`{{emoji`)
+	assert.Error(t, err)
+
+	assert.Equal(t, []string{"wave"}, TextShortcodes("Say hi :wave: at 10:15:00"))
+
+	got, err := Render(config.Config{PostTemplate: `{{emoji "blobcat"}} {{.Link}}`}, rss.RSSItem{Link: "https://example.com/hello"}, false)
+	require.NoError(t, err)
+	assert.Equal(t, ":blobcat: https://example.com/hello", got)
+}
+
+func TestRender_Locale(t *testing.T) {
+	item := rss.RSSItem{Title: "Hallo", Link: "https://example.com/hallo"}
+	conf := config.Config{Locale: "de_DE.UTF-8"}
+
+	got, err := Render(conf, item, false)
+	require.NoError(t, err)
+	assert.Equal(t, "Neuer Beitrag: https://example.com/hallo", got)
+
+	conf.Messages = map[string]string{"updated_post": "Überarbeitet:"}
+	got, err = Render(conf, item, true)
+	require.NoError(t, err)
+	assert.Equal(t, "Überarbeitet: https://example.com/hallo", got)
+
+	conf.PostTemplate = `{{.Title}} – {{msg "new_post" | lower}} {{.Link}}`
+	got, err = Render(conf, item, false)
+	require.NoError(t, err)
+	assert.Equal(t, "Hallo – neuer beitrag: https://example.com/hallo", got)
+}
+
+func TestSelectVariant(t *testing.T) {
+	conf := config.Config{TemplateVariants: []string{
+		"short=New: {{.Link}}",
+		"teaser*3={{.Title}} {{.Link}}",
+		"threads/plain={{.Link}}",
+	}}
+
+	counts := make(map[string]int)
+	for i := range 400 {
+		item := rss.RSSItem{Link: fmt.Sprintf("https://example.com/%d", i)}
+		v, ok := SelectVariant(conf, "mastodon", item)
+		require.True(t, ok)
+		again, _ := SelectVariant(conf, "mastodon", item)
+		assert.Equal(t, v, again, "hash selection picks the same variant for a link")
+		counts[v.Name]++
+	}
+	assert.InDelta(t, 100, counts["short"], 40, "variants are picked by weight")
+	assert.InDelta(t, 300, counts["teaser"], 40, "variants are picked by weight")
+
+	v, ok := SelectVariant(conf, "threads", rss.RSSItem{Link: "https://example.com/1"})
+	require.True(t, ok)
+	assert.Equal(t, "plain", v.Name, "site variants replace the shared ones")
+
+	conf.TemplateVariantSelection = config.VariantSelectionRandom
+	_, ok = SelectVariant(conf, "bluesky", rss.RSSItem{})
+	assert.True(t, ok)
+
+	_, ok = SelectVariant(config.Config{}, "mastodon", rss.RSSItem{})
+	assert.False(t, ok, "no variants configured")
+}
+
+func TestRenderVariant(t *testing.T) {
+	item := rss.RSSItem{Title: "Hello", Link: "https://example.com/hello"}
+	got, err := RenderVariant(config.Config{}, item, config.TemplateVariant{Name: "teaser", Template: "{{.Title | upper}} {{.Link}}"})
+	require.NoError(t, err)
+	assert.Equal(t, "HELLO https://example.com/hello", got)
+
+	problems := check(config.Config{TemplateVariants: []string{"broken={{.Title"}})
+	require.Len(t, problems, 1)
+	assert.Equal(t, "TEMPLATE_VARIANTS", problems[0].Var)
+	assert.Contains(t, problems[0].Message, "broken variant")
+}
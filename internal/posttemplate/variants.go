@@ -0,0 +1,55 @@
+package posttemplate
+
+import (
+	"hash/fnv"
+	"math/rand/v2"
+
+	"github.com/toozej/rss2socials/internal/rss"
+	"github.com/toozej/rss2socials/pkg/config"
+)
+
+// SelectVariant returns the template variant of conf used for new posts of
+// item on site, and false when site has no variants. With the "hash"
+// selection the variant only depends on the link of item, so that a post
+// gets the same variant when it is retried; with "random" it is drawn anew.
+// Either way variants are picked in proportion to their weights.
+func SelectVariant(conf config.Config, site string, item rss.RSSItem) (config.TemplateVariant, bool) {
+	variants := conf.SiteVariants(site)
+	if len(variants) == 0 {
+		return config.TemplateVariant{}, false
+	}
+	total := 0
+	for _, v := range variants {
+		total += v.Weight
+	}
+
+	var n int
+	if conf.TemplateVariantSelection == config.VariantSelectionRandom {
+		n = rand.IntN(total) // #nosec G404 -- picking a phrasing needs no secure randomness
+	} else {
+		h := fnv.New32a()
+		h.Write([]byte(item.Link))
+		n = int(h.Sum32() % uint32(total)) // #nosec G115 -- total is a positive int
+	}
+	for _, v := range variants {
+		if n < v.Weight {
+			return v, true
+		}
+		n -= v.Weight
+	}
+	return variants[len(variants)-1], true
+}
+
+// RenderVariant returns the text of a new post for item using the template
+// of variant v.
+func RenderVariant(conf config.Config, item rss.RSSItem, v config.TemplateVariant) (string, error) {
+	return execute(conf, variantName(v), v.Template, item, false, ContentDiff{})
+}
+
+// variantName names the template of v in errors.
+func variantName(v config.TemplateVariant) string {
+	if v.Site != "" {
+		return v.Site + "/" + v.Name + " variant"
+	}
+	return v.Name + " variant"
+}
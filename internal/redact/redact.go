@@ -0,0 +1,107 @@
+// Package redact removes configured secrets from log output and from messages
+// sent to notifiers. Secrets are registered once at startup; a logrus hook
+// then scrubs every log entry, and String can be used on any text leaving the
+// process.
+package redact
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Placeholder replaces every occurrence of a registered secret.
+const Placeholder = "[REDACTED]"
+
+// minSecretLength avoids redacting trivially short values that would
+// otherwise mangle unrelated log text.
+const minSecretLength = 4
+
+var (
+	mu       sync.RWMutex
+	current  []string
+	replacer *strings.Replacer
+)
+
+// Register adds secrets to the set redacted from logs and notifications.
+// Empty and very short values are ignored.
+func Register(secrets ...string) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	known := make(map[string]bool)
+	for _, s := range current {
+		known[s] = true
+	}
+	for _, s := range secrets {
+		if len(s) >= minSecretLength && !known[s] {
+			current = append(current, s)
+			known[s] = true
+		}
+	}
+	// Replace longer secrets first so a secret containing another is fully redacted.
+	sort.Slice(current, func(i, j int) bool { return len(current[i]) > len(current[j]) })
+
+	pairs := make([]string, 0, 2*len(current))
+	for _, s := range current {
+		pairs = append(pairs, s, Placeholder)
+	}
+	replacer = strings.NewReplacer(pairs...)
+}
+
+// Reset forgets all registered secrets.
+func Reset() {
+	mu.Lock()
+	defer mu.Unlock()
+	current = nil
+	replacer = nil
+}
+
+// String returns s with every registered secret replaced by Placeholder.
+func String(s string) string {
+	mu.RLock()
+	r := replacer
+	mu.RUnlock()
+	if r == nil {
+		return s
+	}
+	return r.Replace(s)
+}
+
+// Error returns err with its message redacted, or nil when err is nil.
+func Error(err error) error {
+	if err == nil {
+		return nil
+	}
+	msg := err.Error()
+	if redacted := String(msg); redacted != msg {
+		return errors.New(redacted)
+	}
+	return err
+}
+
+// Hook is a logrus hook that redacts registered secrets from the message and
+// string or error fields of every log entry.
+type Hook struct{}
+
+// Levels implements log.Hook.
+func (Hook) Levels() []log.Level {
+	return log.AllLevels
+}
+
+// Fire implements log.Hook.
+func (Hook) Fire(entry *log.Entry) error {
+	entry.Message = String(entry.Message)
+	for key, value := range entry.Data {
+		switch v := value.(type) {
+		case string:
+			entry.Data[key] = String(v)
+		case error:
+			entry.Data[key] = Error(v)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package redact
+
+import (
+	"errors"
+	"io"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestString(t *testing.T) {
+	Register("gotify-token", "gotify-token-long", "abc", "")
+	defer Reset()
+
+	assert.Equal(t, "url?token=[REDACTED]", String("url?token=gotify-token"))
+	assert.Equal(t, "token [REDACTED] used", String("token gotify-token-long used"), "longer secrets must be fully redacted")
+	assert.Equal(t, "abc is too short to redact", String("abc is too short to redact"))
+}
+
+func TestString_NoSecrets(t *testing.T) {
+	Reset()
+	assert.Equal(t, "nothing to hide", String("nothing to hide"))
+}
+
+func TestError(t *testing.T) {
+	Register("s3cr3t-value")
+	defer Reset()
+
+	assert.Nil(t, Error(nil))
+	assert.EqualError(t, Error(errors.New("auth failed for s3cr3t-value")), "auth failed for [REDACTED]")
+
+	plain := errors.New("plain error")
+	assert.Same(t, plain, Error(plain))
+}
+
+func TestHook(t *testing.T) {
+	Register("hook-secret")
+	defer Reset()
+
+	// The redaction hook must be registered before the recording hook.
+	logger := log.New()
+	logger.SetOutput(io.Discard)
+	logger.AddHook(Hook{})
+	hook := test.NewLocal(logger)
+
+	logger.WithFields(log.Fields{
+		"url":   "https://example.com/?token=hook-secret",
+		"error": errors.New("bad hook-secret"),
+		"count": 3,
+	}).Error("request with hook-secret failed")
+
+	entry := hook.LastEntry()
+	require.NotNil(t, entry)
+	assert.Equal(t, "request with [REDACTED] failed", entry.Message)
+	assert.Equal(t, "https://example.com/?token=[REDACTED]", entry.Data["url"])
+	assert.EqualError(t, entry.Data["error"].(error), "bad [REDACTED]")
+	assert.Equal(t, 3, entry.Data["count"])
+}
@@ -0,0 +1,266 @@
+package redisstore
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// commandTimeout bounds connecting and every command round trip.
+const commandTimeout = 10 * time.Second
+
+// Error is an error reply of the Redis server.
+type Error string
+
+func (e Error) Error() string { return "redis: " + string(e) }
+
+// client is a minimal RESP2 client holding a single connection, which is
+// re-established when it breaks.
+type client struct {
+	addr     string
+	username string
+	password string
+	db       int
+	tls      bool
+
+	mu   sync.Mutex
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// parseURL parses a redis:// or rediss:// (TLS) URL of the form
+// redis://[[user]:password@]host[:port][/db].
+func parseURL(rawURL string) (*client, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Redis URL: %w", err)
+	}
+	c := &client{}
+	switch u.Scheme {
+	case "redis":
+	case "rediss":
+		c.tls = true
+	default:
+		return nil, fmt.Errorf("invalid Redis URL scheme %q, expected redis or rediss", u.Scheme)
+	}
+	if u.Hostname() == "" {
+		return nil, fmt.Errorf("invalid Redis URL: missing host")
+	}
+	port := u.Port()
+	if port == "" {
+		port = "6379"
+	}
+	c.addr = net.JoinHostPort(u.Hostname(), port)
+	if u.User != nil {
+		c.username = u.User.Username()
+		c.password, _ = u.User.Password()
+	}
+	if db := strings.Trim(u.Path, "/"); db != "" {
+		if c.db, err = strconv.Atoi(db); err != nil || c.db < 0 {
+			return nil, fmt.Errorf("invalid Redis database %q", db)
+		}
+	}
+	return c, nil
+}
+
+// idempotent lists the commands that may safely run twice, so that one whose
+// reply was lost with the connection can be sent again. INCR and SET NX are
+// not among them; the scripts sent with EVAL are.
+var idempotent = map[string]bool{
+	"PING": true, "EXISTS": true, "GET": true, "HGET": true, "HMGET": true,
+	"HVALS": true, "SCARD": true, "SMEMBERS": true, "ZRANGE": true,
+	"HSET": true, "HSETNX": true, "HDEL": true, "SADD": true, "ZADD": true,
+	"ZREMRANGEBYSCORE": true, "PEXPIRE": true, "EVAL": true,
+}
+
+// do sends a command and returns its reply: a string, an int64, nil or a
+// []any of those. Error replies are returned as Error. A command that fails
+// on a broken connection is sent once more on a new one, unless it was
+// written already and is not idempotent: the server may have run it.
+func (c *client) do(args ...string) (any, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	reply, sent, err := c.roundTrip(args)
+	var redisErr Error
+	if err != nil && !errors.As(err, &redisErr) {
+		c.closeConn()
+		if sent && !idempotent[args[0]] {
+			return nil, err
+		}
+		reply, _, err = c.roundTrip(args)
+		if err != nil && !errors.As(err, &redisErr) {
+			c.closeConn()
+		}
+	}
+	return reply, err
+}
+
+// roundTrip sends a command and reads its reply, reporting whether the
+// command was written to the connection.
+func (c *client) roundTrip(args []string) (reply any, sent bool, err error) {
+	if c.conn == nil {
+		if err := c.connect(); err != nil {
+			return nil, false, err
+		}
+	}
+	if err := c.conn.SetDeadline(time.Now().Add(commandTimeout)); err != nil {
+		return nil, false, err
+	}
+	if err := c.write(args); err != nil {
+		return nil, false, err
+	}
+	reply, err = c.read()
+	return reply, true, err
+}
+
+func (c *client) connect() error {
+	dialer := &net.Dialer{Timeout: commandTimeout}
+	var conn net.Conn
+	var err error
+	if c.tls {
+		host, _, _ := net.SplitHostPort(c.addr)
+		conn, err = tls.DialWithDialer(dialer, "tcp", c.addr, &tls.Config{ServerName: host, MinVersion: tls.VersionTLS12})
+	} else {
+		conn, err = dialer.Dial("tcp", c.addr)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to connect to Redis: %w", err)
+	}
+	c.conn, c.r = conn, bufio.NewReader(conn)
+
+	var setup [][]string
+	switch {
+	case c.username != "" && c.password != "":
+		setup = append(setup, []string{"AUTH", c.username, c.password})
+	case c.password != "":
+		setup = append(setup, []string{"AUTH", c.password})
+	}
+	if c.db != 0 {
+		setup = append(setup, []string{"SELECT", strconv.Itoa(c.db)})
+	}
+	for _, args := range setup {
+		if _, _, err := c.roundTrip(args); err != nil {
+			c.closeConn()
+			return fmt.Errorf("failed to set up Redis connection: %w", err)
+		}
+	}
+	return nil
+}
+
+func (c *client) closeConn() {
+	if c.conn != nil {
+		c.conn.Close()
+		c.conn, c.r = nil, nil
+	}
+}
+
+func (c *client) close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closeConn()
+	return nil
+}
+
+func (c *client) write(args []string) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, a := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(a), a)
+	}
+	_, err := io.WriteString(c.conn, b.String())
+	return err
+}
+
+func (c *client) read() (any, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || !strings.HasSuffix(line, "\r\n") {
+		return nil, fmt.Errorf("redis: malformed reply %q", line)
+	}
+	line = line[:len(line)-2]
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, Error(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		items := make([]any, n)
+		for i := range items {
+			if items[i], err = c.read(); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("redis: malformed reply %q", line)
+}
+
+// str returns reply as a string, or "" for a nil reply.
+func str(reply any, err error) (string, error) {
+	if err != nil || reply == nil {
+		return "", err
+	}
+	s, ok := reply.(string)
+	if !ok {
+		return "", fmt.Errorf("redis: unexpected reply %v", reply)
+	}
+	return s, nil
+}
+
+// integer returns reply as an int64.
+func integer(reply any, err error) (int64, error) {
+	if err != nil {
+		return 0, err
+	}
+	n, ok := reply.(int64)
+	if !ok {
+		return 0, fmt.Errorf("redis: unexpected reply %v", reply)
+	}
+	return n, nil
+}
+
+// strs returns an array reply as strings, with "" for nil elements.
+func strs(reply any, err error) ([]string, error) {
+	if err != nil || reply == nil {
+		return nil, err
+	}
+	items, ok := reply.([]any)
+	if !ok {
+		return nil, fmt.Errorf("redis: unexpected reply %v", reply)
+	}
+	out := make([]string, len(items))
+	for i, item := range items {
+		if out[i], err = str(item, nil); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
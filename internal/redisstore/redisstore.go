@@ -0,0 +1,557 @@
+// Package redisstore stores the posts, retries and events of rss2socials in
+// Redis, so that several replicas can share them. It implements the Store
+// interface of the pipeline with the semantics of the db package.
+//
+// Every key starts with the configured prefix:
+//
+//	<prefix>post:<link>  hash of the fields of a stored post
+//	<prefix>posts        set of the links of stored posts
+//	<prefix>feed-links   hash of the links posts are stored under, by feed link
+//	<prefix>high-water   hash of the high-water marks, by feed URL
+//	<prefix>pinned       set of the links of pinned Mastodon posts
+//	<prefix>retries      hash of retry states as JSON, by "<site> <link>"
+//	<prefix>events       sorted set of events as JSON, scored by time
+//	<prefix>events:id    counter of event IDs
+//	<prefix>lock:<name>  owner of the lock name, expiring with its lease
+//
+// Only the event log and the locks expire: the events key when no event was
+// recorded for the retention passed to New, and a lock with its lease. The
+// other keys are kept forever, like the rows of the SQLite database, since
+// they are what keeps items from being published twice: a forgotten post
+// would be published again while its item is still in the feed, a
+// forgotten high-water mark lets a regenerated feed be replayed, and the
+// retry state of a post that was given up on keeps it from being retried.
+// Retry states are removed once their post is published, and events:id is
+// a single counter that keeps event IDs increasing across the expiry of the
+// event log.
+package redisstore
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/toozej/rss2socials/internal/db"
+	"github.com/toozej/rss2socials/internal/rss"
+)
+
+// postedFields, idFields and variantFields map sites to the post hash
+// fields recording whether, as what and with which template variant the
+// post was published there.
+var (
+	postedFields = map[string]string{
+		"mastodon":   "mastodon_posted",
+		"bluesky":    "bluesky_posted",
+		"threads":    "threads_posted",
+		"newsletter": "newsletter_posted",
+	}
+	idFields = map[string]string{
+		"mastodon":   "mastodon_status_id",
+		"bluesky":    "bluesky_uri",
+		"threads":    "threads_media_id",
+		"newsletter": "newsletter_id",
+	}
+	variantFields = map[string]string{
+		"mastodon": "mastodon_variant",
+		"bluesky":  "bluesky_variant",
+		"threads":  "threads_variant",
+	}
+)
+
+// Store is a Redis-backed store.
+type Store struct {
+	c      *client
+	prefix string
+	// retention is the TTL of the event log, refreshed with every event.
+	// Zero keeps it forever.
+	retention time.Duration
+	// noContent disables storing content snapshots; see SetStoreContent.
+	noContent bool
+	// hashing is how content is hashed; see SetHashing.
+	hashing rss.Hashing
+	// now returns the time of the changes recorded; see SetClock.
+	now func() time.Time
+}
+
+// SetClock sets where the times of stored posts, publishes and events
+// come from, time.Now by default.
+func (s *Store) SetClock(now func() time.Time) {
+	s.now = now
+}
+
+// SetStoreContent sets whether StoreTootedPost stores the content of posts,
+// compressed, along with its hash, as db.Content.Snapshots does.
+func (s *Store) SetStoreContent(enabled bool) {
+	s.noContent = !enabled
+}
+
+// SetHashing sets how content is hashed to detect updates,
+// rss.DefaultHashing by default. h must be valid.
+func (s *Store) SetHashing(h rss.Hashing) {
+	s.hashing = h
+}
+
+// New returns a Store for the Redis server at rawURL, e.g.
+// redis://:password@localhost:6379/0 or rediss:// for TLS. Keys are
+// prefixed with prefix. The event log expires when no event was recorded
+// for retention; zero keeps it. No connection is made until the first
+// command.
+func New(rawURL, prefix string, retention time.Duration) (*Store, error) {
+	c, err := parseURL(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	return &Store{c: c, prefix: prefix, retention: retention, hashing: rss.DefaultHashing, now: time.Now}, nil
+}
+
+// Ping checks that the server can be reached.
+func (s *Store) Ping() error {
+	_, err := s.c.do("PING")
+	return err
+}
+
+// Close closes the connection.
+func (s *Store) Close() error {
+	return s.c.close()
+}
+
+func (s *Store) postKey(link string) string { return s.prefix + "post:" + link }
+
+// HasPostChanged reports whether a post with link is stored and whether its
+// content differs from content.
+func (s *Store) HasPostChanged(link, content string) (bool, bool, error) {
+	reply, err := s.c.do("HMGET", s.postKey(link), "link", "content_hash", "content")
+	fields, err := strs(reply, err)
+	if err != nil {
+		return false, false, err
+	}
+	if fields[0] == "" {
+		return false, false, nil
+	}
+	newHash := s.hashing.Hash(content)
+	if !s.hashing.Comparable(fields[1]) {
+		// Made with other hashing settings; rehash as db.HasPostChanged does.
+		rehashed := newHash
+		if snapshot, err := db.DecompressContent([]byte(fields[2])); err == nil && snapshot != "" {
+			rehashed = s.hashing.Hash(snapshot)
+		}
+		_, err := s.c.do("HSET", s.postKey(link), "content_hash", rehashed)
+		return true, rehashed != newHash, err
+	}
+	return true, fields[1] != newHash, nil
+}
+
+// storeScript stores the post at KEYS[1] and adds its link to the set at
+// KEYS[2]. ARGV holds the link, content hash, content snapshot, timestamp,
+// startup time and first-seen time; the snapshot an update replaces is kept
+// as the previous content.
+const storeScript = `local old = redis.call("hmget", KEYS[1], "content_hash", "content")
+if old[1] and old[1] ~= "" and old[1] ~= ARGV[2] then redis.call("hset", KEYS[1], "previous_content", old[2] or "") end
+redis.call("hset", KEYS[1], "link", ARGV[1], "content_hash", ARGV[2], "content", ARGV[3], "timestamp", ARGV[4], "startup_time", ARGV[5])
+redis.call("hsetnx", KEYS[1], "first_seen", ARGV[6])
+return redis.call("sadd", KEYS[2], ARGV[1])`
+
+// StoreTootedPost stores the post with link, or updates its content hash and
+// startup time when it is already stored.
+func (s *Store) StoreTootedPost(link, content, startupTime string) error {
+	now := s.now()
+	var snapshot string
+	if !s.noContent {
+		snapshot = string(db.CompressContent(content))
+	}
+	_, err := s.c.do("EVAL", storeScript, "2", s.postKey(link), s.prefix+"posts",
+		link, s.hashing.Hash(content), snapshot, now.Format(time.RFC3339), startupTime, now.Format(time.RFC3339Nano))
+	return err
+}
+
+// update sets fields of the stored post with link, failing when there is
+// none.
+func (s *Store) update(link string, fieldValues ...string) error {
+	key := s.postKey(link)
+	exists, err := integer(s.c.do("EXISTS", key))
+	if err != nil {
+		return err
+	}
+	if exists == 0 {
+		return fmt.Errorf("no post found with link: %s", link)
+	}
+	_, err = s.c.do(append([]string{"HSET", key}, fieldValues...)...)
+	return err
+}
+
+// IsSitePosted reports whether the post with link was published to site.
+func (s *Store) IsSitePosted(link, site string) (bool, error) {
+	field, ok := postedFields[site]
+	if !ok {
+		return false, fmt.Errorf("unknown site: %s", site)
+	}
+	v, err := str(s.c.do("HGET", s.postKey(link), field))
+	return v == "1", err
+}
+
+// MarkSitePosted records that the post with link was published to site.
+func (s *Store) MarkSitePosted(link, site string) error {
+	field, ok := postedFields[site]
+	if !ok {
+		return fmt.Errorf("unknown site: %s", site)
+	}
+	return s.update(link, field, "1", "last_posted", s.now().Format(time.RFC3339Nano))
+}
+
+// SetPublishedAt stores the parsed pubDate of the post with link.
+func (s *Store) SetPublishedAt(link string, published time.Time) error {
+	return s.update(link, "published_at", published.Format(time.RFC3339Nano))
+}
+
+// SetSitePostID stores the identifier of the post created on site for link.
+// Sites that do not support stored identifiers are ignored.
+func (s *Store) SetSitePostID(link, site, id string) error {
+	field, ok := idFields[site]
+	if !ok {
+		return nil
+	}
+	return s.update(link, field, id)
+}
+
+// SetSiteVariant stores the name of the template variant link was published
+// with on site.
+func (s *Store) SetSiteVariant(link, site, variant string) error {
+	field, ok := variantFields[site]
+	if !ok {
+		return nil
+	}
+	return s.update(link, field, variant)
+}
+
+// StoredContent returns the content the post with link was last stored
+// with, or an empty string when it is not stored.
+func (s *Store) StoredContent(link string) (string, error) {
+	snapshot, err := str(s.c.do("HGET", s.postKey(link), "content"))
+	if err != nil {
+		return "", err
+	}
+	return db.DecompressContent([]byte(snapshot))
+}
+
+// SitePostID returns the stored identifier of the post created on site for
+// link, or an empty string when none was recorded.
+func (s *Store) SitePostID(link, site string) (string, error) {
+	field, ok := idFields[site]
+	if !ok {
+		return "", fmt.Errorf("unknown site: %s", site)
+	}
+	fields, err := strs(s.c.do("HMGET", s.postKey(link), "link", field))
+	if err != nil {
+		return "", err
+	}
+	if fields[0] == "" {
+		return "", fmt.Errorf("no post found with link: %s", link)
+	}
+	return fields[1], nil
+}
+
+// FirstSeen returns when the post with link was first stored.
+func (s *Store) FirstSeen(link string) (time.Time, error) {
+	fields, err := strs(s.c.do("HMGET", s.postKey(link), "link", "first_seen"))
+	if err != nil {
+		return time.Time{}, err
+	}
+	if fields[0] == "" {
+		return time.Time{}, fmt.Errorf("no post found with link: %s", link)
+	}
+	return time.Parse(time.RFC3339Nano, fields[1])
+}
+
+// SetFeedLink records that the post stored under link appears in the feed
+// as feedLink.
+func (s *Store) SetFeedLink(link, feedLink string) error {
+	if err := s.update(link, "feed_link", feedLink); err != nil {
+		return err
+	}
+	_, err := s.c.do("HSET", s.prefix+"feed-links", feedLink, link)
+	return err
+}
+
+// StoredLink returns the link the item appearing in the feed as feedLink
+// is stored under, or an empty string when it is not stored.
+func (s *Store) StoredLink(feedLink string) (string, error) {
+	link, err := str(s.c.do("HGET", s.prefix+"feed-links", feedLink))
+	if err != nil || link != "" {
+		return link, err
+	}
+	exists, err := integer(s.c.do("EXISTS", s.postKey(feedLink)))
+	if err != nil || exists == 0 {
+		return "", err
+	}
+	return feedLink, nil
+}
+
+// HighWaterMark returns the latest pubDate of the items published from
+// feed, or the zero time when none was recorded.
+func (s *Store) HighWaterMark(feed string) (time.Time, error) {
+	mark, err := str(s.c.do("HGET", s.prefix+"high-water", feed))
+	if err != nil || mark == "" {
+		return time.Time{}, err
+	}
+	return time.Parse(time.RFC3339Nano, mark)
+}
+
+// RaiseHighWaterMark sets the high-water mark of feed to published unless
+// it is already later. Replicas only publish while holding the cycle lock,
+// so the mark is not raised concurrently.
+func (s *Store) RaiseHighWaterMark(feed string, published time.Time) error {
+	mark, err := s.HighWaterMark(feed)
+	if err != nil || !mark.Before(published) {
+		return err
+	}
+	_, err = s.c.do("HSET", s.prefix+"high-water", feed, published.Format(time.RFC3339Nano))
+	return err
+}
+
+// SetMastodonPinned records whether the Mastodon status of link is pinned.
+func (s *Store) SetMastodonPinned(link string, pinned bool) error {
+	value, op := "0", "SREM"
+	if pinned {
+		value, op = "1", "SADD"
+	}
+	if err := s.update(link, "mastodon_pinned", value); err != nil {
+		return err
+	}
+	_, err := s.c.do(op, s.prefix+"pinned", link)
+	return err
+}
+
+// MastodonPinnedPosts returns the links of the posts whose Mastodon status
+// is recorded as pinned.
+func (s *Store) MastodonPinnedPosts() ([]string, error) {
+	links, err := strs(s.c.do("SMEMBERS", s.prefix+"pinned"))
+	slices.Sort(links)
+	return links, err
+}
+
+// IsFirstCycle reports whether no posts are stored yet.
+func (s *Store) IsFirstCycle() bool {
+	n, err := integer(s.c.do("SCARD", s.prefix+"posts"))
+	if err != nil {
+		log.Errorf("Error counting posts: %v", err)
+		return false
+	}
+	return n == 0
+}
+
+// posts calls fn with the given fields of every stored post.
+func (s *Store) posts(fn func(link string, fields []string), fields ...string) error {
+	links, err := strs(s.c.do("SMEMBERS", s.prefix+"posts"))
+	if err != nil {
+		return err
+	}
+	slices.Sort(links)
+	for _, link := range links {
+		values, err := strs(s.c.do(append([]string{"HMGET", s.postKey(link)}, fields...)...))
+		if err != nil {
+			return err
+		}
+		fn(link, values)
+	}
+	return nil
+}
+
+// UnpublishedPosts returns the links of stored posts that have not been
+// marked as posted to any site and for which no attempt or outcome was
+// recorded, as db.UnpublishedPosts does.
+func (s *Store) UnpublishedPosts() ([]string, error) {
+	handled, err := s.handledLinks()
+	if err != nil {
+		return nil, err
+	}
+	var links []string
+	err = s.posts(func(link string, posted []string) {
+		if !slices.Contains(posted, "1") && !handled[link] {
+			links = append(links, link)
+		}
+	}, "mastodon_posted", "bluesky_posted", "threads_posted", "newsletter_posted")
+	return links, err
+}
+
+// handledLinks returns the links with a retry state or an event other than
+// a feed fetch.
+func (s *Store) handledLinks() (map[string]bool, error) {
+	handled := make(map[string]bool)
+	retries, err := strs(s.c.do("HVALS", s.prefix+"retries"))
+	if err != nil {
+		return nil, err
+	}
+	for _, data := range retries {
+		var r db.Retry
+		if err := json.Unmarshal([]byte(data), &r); err != nil {
+			return nil, err
+		}
+		handled[r.Link] = true
+	}
+	events, err := strs(s.c.do("ZRANGE", s.prefix+"events", "0", "-1"))
+	if err != nil {
+		return nil, err
+	}
+	for _, data := range events {
+		var ev db.Event
+		if err := json.Unmarshal([]byte(data), &ev); err != nil {
+			return nil, err
+		}
+		if ev.Action != db.ActionFetched {
+			handled[ev.Link] = true
+		}
+	}
+	return handled, nil
+}
+
+// CountPublished returns the number of posts published to at least one
+// site.
+func (s *Store) CountPublished() (int, error) {
+	n := 0
+	err := s.posts(func(_ string, posted []string) {
+		if slices.Contains(posted, "1") {
+			n++
+		}
+	}, "mastodon_posted", "bluesky_posted", "threads_posted", "newsletter_posted")
+	return n, err
+}
+
+// PostsToRepromote returns the links of posts that have not been re-promoted
+// yet, were published at or before publishedBefore and have a stored
+// Mastodon status ID or Bluesky URI. The published time is the one stored
+// with SetPublishedAt, or the first-seen time for items without a pubDate.
+func (s *Store) PostsToRepromote(publishedBefore time.Time) ([]string, error) {
+	var links []string
+	err := s.posts(func(link string, f []string) {
+		if f[0] == "1" || (f[1] == "" && f[2] == "") {
+			return
+		}
+		value := cmp.Or(f[3], f[4])
+		published, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			log.Warnf("Unparsable published time %q for %s: %v", value, link, err)
+			return
+		}
+		if !published.After(publishedBefore) {
+			links = append(links, link)
+		}
+	}, "repromoted", "mastodon_status_id", "bluesky_uri", "published_at", "first_seen")
+	return links, err
+}
+
+// MarkRepromoted records that the post with link was re-promoted.
+func (s *Store) MarkRepromoted(link string) error {
+	return s.update(link, "repromoted", "1")
+}
+
+func retryField(link, site string) string { return site + " " + link }
+
+// Retry returns the retry state of link on site, or a zero Retry with the
+// link and site set when publishing it has not failed.
+func (s *Store) Retry(link, site string) (db.Retry, error) {
+	v, err := str(s.c.do("HGET", s.prefix+"retries", retryField(link, site)))
+	if err != nil || v == "" {
+		return db.Retry{Link: link, Site: site}, err
+	}
+	var r db.Retry
+	err = json.Unmarshal([]byte(v), &r)
+	return r, err
+}
+
+// SaveRetry creates or replaces the retry state of r.Link on r.Site.
+func (s *Store) SaveRetry(r db.Retry) error {
+	r.ID = 0
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	_, err = s.c.do("HSET", s.prefix+"retries", retryField(r.Link, r.Site), string(data))
+	return err
+}
+
+// ClearRetry removes the retry state of link on site.
+func (s *Store) ClearRetry(link, site string) error {
+	_, err := s.c.do("HDEL", s.prefix+"retries", retryField(link, site))
+	return err
+}
+
+// PendingRetries returns the failed posts that are still being retried,
+// next due first.
+func (s *Store) PendingRetries() ([]db.Retry, error) {
+	values, err := strs(s.c.do("HVALS", s.prefix+"retries"))
+	if err != nil {
+		return nil, err
+	}
+	var retries []db.Retry
+	for _, v := range values {
+		var r db.Retry
+		if err := json.Unmarshal([]byte(v), &r); err != nil {
+			return nil, err
+		}
+		if !r.Dead {
+			retries = append(retries, r)
+		}
+	}
+	slices.SortStableFunc(retries, func(a, b db.Retry) int {
+		return a.NextAttempt.Compare(b.NextAttempt)
+	})
+	return retries, nil
+}
+
+// RecordEvent appends an event to the event log.
+func (s *Store) RecordEvent(action, site, link, detail string) error {
+	id, err := integer(s.c.do("INCR", s.prefix+"events:id"))
+	if err != nil {
+		return err
+	}
+	ev := db.Event{ID: uint(id), Timestamp: s.now(), Action: action, Site: site, Link: link, Detail: detail}
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	key := s.prefix + "events"
+	if _, err := s.c.do("ZADD", key, strconv.FormatInt(ev.Timestamp.UnixMilli(), 10), string(data)); err != nil {
+		return err
+	}
+	if s.retention > 0 {
+		_, err = s.c.do("PEXPIRE", key, strconv.FormatInt(s.retention.Milliseconds(), 10))
+	}
+	return err
+}
+
+// PruneEvents deletes events recorded before the given time and returns the
+// number of events removed.
+func (s *Store) PruneEvents(before time.Time) (int64, error) {
+	return integer(s.c.do("ZREMRANGEBYSCORE", s.prefix+"events", "-inf", "("+strconv.FormatInt(before.UnixMilli(), 10)))
+}
+
+// renewScript extends the lease on KEYS[1] to ARGV[2] milliseconds if it is
+// held by ARGV[1]; releaseScript deletes it if so.
+const (
+	renewScript   = `if redis.call("get", KEYS[1]) == ARGV[1] then return redis.call("pexpire", KEYS[1], ARGV[2]) end return 0`
+	releaseScript = `if redis.call("get", KEYS[1]) == ARGV[1] then return redis.call("del", KEYS[1]) end return 0`
+)
+
+// AcquireLock takes the lock name for owner, or renews it when owner holds
+// it already, until ttl from now. It reports false when another owner holds
+// a lease that has not expired.
+func (s *Store) AcquireLock(name, owner string, ttl time.Duration) (bool, error) {
+	key, ms := s.prefix+"lock:"+name, strconv.FormatInt(max(ttl.Milliseconds(), 1), 10)
+	reply, err := s.c.do("SET", key, owner, "NX", "PX", ms)
+	if err != nil || reply != nil {
+		return err == nil, err
+	}
+	renewed, err := integer(s.c.do("EVAL", renewScript, "1", key, owner, ms))
+	return renewed == 1, err
+}
+
+// ReleaseLock gives up the lock name, if owner holds it.
+func (s *Store) ReleaseLock(name, owner string) error {
+	_, err := s.c.do("EVAL", releaseScript, "1", s.prefix+"lock:"+name, owner)
+	return err
+}
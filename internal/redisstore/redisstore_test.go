@@ -0,0 +1,290 @@
+package redisstore
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/toozej/rss2socials/internal/db"
+	"github.com/toozej/rss2socials/internal/testutil"
+)
+
+func newStore(t *testing.T, retention time.Duration) (*Store, *testutil.RedisServer) {
+	t.Helper()
+	srv := testutil.NewRedisServer(t, "secret")
+	s, err := New(srv.URL, "test:", retention)
+	require.NoError(t, err)
+	t.Cleanup(func() { s.Close() })
+	return s, srv
+}
+
+func TestParseURL(t *testing.T) {
+	tests := []struct {
+		url      string
+		addr     string
+		username string
+		password string
+		db       int
+		tls      bool
+		wantErr  bool
+	}{
+		{url: "redis://localhost", addr: "localhost:6379"},
+		{url: "redis://:pw@redis.example.com:6380/2", addr: "redis.example.com:6380", password: "pw", db: 2},
+		{url: "rediss://user:pw@redis.example.com", addr: "redis.example.com:6379", username: "user", password: "pw", tls: true},
+		{url: "http://localhost", wantErr: true},
+		{url: "redis://", wantErr: true},
+		{url: "redis://localhost/db", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			c, err := parseURL(tt.url)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.addr, c.addr)
+			assert.Equal(t, tt.username, c.username)
+			assert.Equal(t, tt.password, c.password)
+			assert.Equal(t, tt.db, c.db)
+			assert.Equal(t, tt.tls, c.tls)
+		})
+	}
+}
+
+func TestStore_Posts(t *testing.T) {
+	s, _ := newStore(t, 0)
+	link := "https://example.com/post"
+
+	assert.True(t, s.IsFirstCycle())
+	exists, _, err := s.HasPostChanged(link, "content")
+	require.NoError(t, err)
+	assert.False(t, exists)
+	assert.Error(t, s.MarkSitePosted(link, "mastodon"), "only stored posts can be marked")
+
+	require.NoError(t, s.StoreTootedPost(link, "content", "2026-01-01T00:00:00Z"))
+	assert.False(t, s.IsFirstCycle())
+	exists, updated, err := s.HasPostChanged(link, "content")
+	require.NoError(t, err)
+	assert.True(t, exists)
+	assert.False(t, updated)
+	_, updated, err = s.HasPostChanged(link, "edited")
+	require.NoError(t, err)
+	assert.True(t, updated)
+	stored, err := s.StoredContent(link)
+	require.NoError(t, err)
+	assert.Equal(t, "content", stored)
+	require.NoError(t, s.StoreTootedPost(link, "edited", "2026-01-01T00:00:00Z"))
+	stored, err = s.StoredContent(link)
+	require.NoError(t, err)
+	assert.Equal(t, "edited", stored)
+	previous, err := str(s.c.do("HGET", s.postKey(link), "previous_content"))
+	require.NoError(t, err)
+	assert.Equal(t, string(db.CompressContent("content")), previous)
+
+	unpublished, err := s.UnpublishedPosts()
+	require.NoError(t, err)
+	assert.Equal(t, []string{link}, unpublished)
+	require.NoError(t, s.StoreTootedPost("https://example.com/held-back", "content", "2026-01-01T00:00:00Z"))
+	require.NoError(t, s.RecordEvent(db.ActionHeldBack, "", "https://example.com/held-back", "link check"))
+	require.NoError(t, s.StoreTootedPost("https://example.com/failed", "content", "2026-01-01T00:00:00Z"))
+	require.NoError(t, s.SaveRetry(db.Retry{Link: "https://example.com/failed", Site: "mastodon", Attempts: 1}))
+	unpublished, err = s.UnpublishedPosts()
+	require.NoError(t, err)
+	assert.Equal(t, []string{link}, unpublished, "posts with a recorded attempt or outcome are not in flight")
+
+	require.NoError(t, s.MarkSitePosted(link, "mastodon"))
+	require.NoError(t, s.SetSitePostID(link, "mastodon", "123"))
+	require.NoError(t, s.SetPublishedAt(link, time.Now().Add(-48*time.Hour)))
+	posted, err := s.IsSitePosted(link, "mastodon")
+	require.NoError(t, err)
+	assert.True(t, posted)
+	posted, err = s.IsSitePosted(link, "bluesky")
+	require.NoError(t, err)
+	assert.False(t, posted)
+	_, err = s.IsSitePosted(link, "myspace")
+	assert.Error(t, err)
+
+	id, err := s.SitePostID(link, "mastodon")
+	require.NoError(t, err)
+	assert.Equal(t, "123", id)
+	_, err = s.SitePostID("https://example.com/missing", "mastodon")
+	assert.Error(t, err)
+
+	unpublished, err = s.UnpublishedPosts()
+	require.NoError(t, err)
+	assert.Empty(t, unpublished)
+
+	links, err := s.PostsToRepromote(time.Now().Add(-72 * time.Hour))
+	require.NoError(t, err)
+	assert.Empty(t, links, "published too recently")
+	require.NoError(t, s.StoreTootedPost(link, "edited again", "2026-01-01T00:00:00Z"))
+	links, err = s.PostsToRepromote(time.Now().Add(-24 * time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, []string{link}, links, "updates do not delay re-promotion")
+	require.NoError(t, s.MarkRepromoted(link))
+	links, err = s.PostsToRepromote(time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	assert.Empty(t, links)
+}
+
+func TestStore_FeedLinks(t *testing.T) {
+	s, _ := newStore(t, 0)
+	canonical, feedLink := "https://example.com/post", "https://proxy.example.net/~r/post"
+
+	stored, err := s.StoredLink(feedLink)
+	require.NoError(t, err)
+	assert.Empty(t, stored)
+	assert.Error(t, s.SetFeedLink(canonical, feedLink), "only stored posts can be linked")
+
+	require.NoError(t, s.StoreTootedPost(canonical, "content", "2026-01-01T00:00:00Z"))
+	require.NoError(t, s.SetFeedLink(canonical, feedLink))
+	stored, err = s.StoredLink(feedLink)
+	require.NoError(t, err)
+	assert.Equal(t, canonical, stored)
+	stored, err = s.StoredLink(canonical)
+	require.NoError(t, err)
+	assert.Equal(t, canonical, stored, "posts stored under their feed link are found too")
+
+	require.NoError(t, s.SetMastodonPinned(canonical, true))
+	pinned, err := s.MastodonPinnedPosts()
+	require.NoError(t, err)
+	assert.Equal(t, []string{canonical}, pinned)
+	require.NoError(t, s.SetMastodonPinned(canonical, false))
+	pinned, err = s.MastodonPinnedPosts()
+	require.NoError(t, err)
+	assert.Empty(t, pinned)
+	assert.Error(t, s.SetMastodonPinned(feedLink, true), "only stored posts can be pinned")
+
+	seen, err := s.FirstSeen(canonical)
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now(), seen, time.Minute)
+	_, err = s.FirstSeen(feedLink)
+	assert.Error(t, err)
+}
+
+func TestStore_HighWaterMark(t *testing.T) {
+	s, _ := newStore(t, 0)
+	feed := "https://example.com/feed.xml"
+
+	mark, err := s.HighWaterMark(feed)
+	require.NoError(t, err)
+	assert.True(t, mark.IsZero())
+
+	published := time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC)
+	require.NoError(t, s.RaiseHighWaterMark(feed, published))
+	require.NoError(t, s.RaiseHighWaterMark(feed, published.Add(-time.Hour)))
+	mark, err = s.HighWaterMark(feed)
+	require.NoError(t, err)
+	assert.True(t, mark.Equal(published), "the mark is never lowered, got %s", mark)
+
+	mark, err = s.HighWaterMark("https://example.com/other.xml")
+	require.NoError(t, err)
+	assert.True(t, mark.IsZero(), "marks are per feed")
+}
+
+func TestStore_Retries(t *testing.T) {
+	s, _ := newStore(t, 0)
+	link := "https://example.com/retry"
+
+	r, err := s.Retry(link, "mastodon")
+	require.NoError(t, err)
+	assert.Equal(t, db.Retry{Link: link, Site: "mastodon"}, r)
+
+	now := time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC)
+	require.NoError(t, s.SaveRetry(db.Retry{Link: link, Site: "mastodon", Attempts: 1, NextAttempt: now.Add(time.Hour), LastError: "boom"}))
+	require.NoError(t, s.SaveRetry(db.Retry{Link: link, Site: "bluesky", Attempts: 1, NextAttempt: now}))
+	require.NoError(t, s.SaveRetry(db.Retry{Link: link, Site: "threads", Attempts: 5, Dead: true}))
+
+	got, err := s.Retry(link, "mastodon")
+	require.NoError(t, err)
+	assert.Equal(t, 1, got.Attempts)
+	assert.Equal(t, "boom", got.LastError)
+	assert.True(t, got.NextAttempt.Equal(now.Add(time.Hour)))
+
+	pending, err := s.PendingRetries()
+	require.NoError(t, err)
+	require.Len(t, pending, 2)
+	assert.Equal(t, "bluesky", pending[0].Site, "next due first")
+	assert.Equal(t, "mastodon", pending[1].Site)
+
+	require.NoError(t, s.ClearRetry(link, "mastodon"))
+	got, err = s.Retry(link, "mastodon")
+	require.NoError(t, err)
+	assert.Zero(t, got.Attempts)
+}
+
+func TestStore_Events(t *testing.T) {
+	s, srv := newStore(t, 30*24*time.Hour)
+	recorded := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	s.SetClock(func() time.Time { return recorded })
+
+	require.NoError(t, s.RecordEvent(db.ActionPublished, "mastodon", "https://example.com/post", ""))
+	assert.Equal(t, 30*24*time.Hour, srv.TTL("test:events"), "the event log expires with the retention period")
+
+	removed, err := s.PruneEvents(recorded.Add(-time.Hour))
+	require.NoError(t, err)
+	assert.Zero(t, removed)
+	removed, err = s.PruneEvents(recorded.Add(time.Hour))
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, removed)
+}
+
+func TestStore_AuthAndReconnect(t *testing.T) {
+	s, srv := newStore(t, 0)
+	require.NoError(t, s.Ping())
+
+	srv.DropConnections()
+	require.NoError(t, s.Ping(), "a dropped connection is re-established")
+
+	wrong, err := New(strings.Replace(srv.URL, "secret", "wrong", 1), "test:", 0)
+	require.NoError(t, err)
+	defer wrong.Close()
+	err = wrong.Ping()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "WRONGPASS")
+}
+
+func TestStore_ResendsOnlyIdempotentCommands(t *testing.T) {
+	s, srv := newStore(t, 0)
+
+	srv.DropReplyTo("PING")
+	require.NoError(t, s.Ping(), "a lost PING reply is sent again")
+
+	srv.DropReplyTo("INCR")
+	require.Error(t, s.RecordEvent(db.ActionPublished, "mastodon", "https://example.com/post", ""))
+	id, err := integer(s.c.do("INCR", "test:events:id"))
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, id, "an INCR whose reply was lost is not sent again")
+}
+
+func TestStore_Locks(t *testing.T) {
+	s, _ := newStore(t, 0)
+
+	acquired, err := s.AcquireLock("cycle", "a", time.Minute)
+	require.NoError(t, err)
+	assert.True(t, acquired)
+	acquired, err = s.AcquireLock("cycle", "b", time.Minute)
+	require.NoError(t, err)
+	assert.False(t, acquired, "the lock is held by a")
+	acquired, err = s.AcquireLock("cycle", "a", time.Millisecond)
+	require.NoError(t, err)
+	assert.True(t, acquired, "the holder renews its lease")
+
+	time.Sleep(5 * time.Millisecond)
+	acquired, err = s.AcquireLock("cycle", "b", time.Minute)
+	require.NoError(t, err)
+	assert.True(t, acquired, "an expired lease is taken over")
+	require.NoError(t, s.ReleaseLock("cycle", "a"), "releasing a lock held by another owner is a no-op")
+	acquired, err = s.AcquireLock("cycle", "a", time.Minute)
+	require.NoError(t, err)
+	assert.False(t, acquired)
+
+	require.NoError(t, s.ReleaseLock("cycle", "b"))
+	acquired, err = s.AcquireLock("cycle", "a", time.Minute)
+	require.NoError(t, err)
+	assert.True(t, acquired)
+}
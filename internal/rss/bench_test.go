@@ -0,0 +1,87 @@
+package rss
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// benchFeed returns an RSS document with n items of a few kilobytes of
+// HTML each, the size of a typical blog feed.
+func benchFeed(n int) string {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0" xmlns:content="http://purl.org/rss/1.0/modules/content/" xmlns:media="http://search.yahoo.com/mrss/">
+<channel><title>Bench</title>`)
+	for i := range n {
+		fmt.Fprintf(&b, `<item><title>Post %d</title><link>https://example.com/posts/%d/</link>`, i, i)
+		fmt.Fprintf(&b, `<guid>https://example.com/?p=%d</guid><pubDate>Mon, 02 Mar 2026 10:%02d:00 +0000</pubDate>`, i, i%60)
+		b.WriteString(`<category>Go</category><category>RSS</category>`)
+		fmt.Fprintf(&b, `<description>&lt;p&gt;Summary of post %d.&lt;/p&gt;&lt;img src="/img/%d.png" alt="Figure"&gt;</description>`, i, i)
+		b.WriteString(`<content:encoded><![CDATA[`)
+		for range 20 {
+			b.WriteString(`<p>Lorem ipsum dolor sit amet, <a href="https://example.com">consectetur</a> adipiscing elit, sed do <em>eiusmod</em> tempor.</p>` + "\n")
+		}
+		b.WriteString(`]]></content:encoded><media:content url="https://example.com/v.mp4" medium="video"/></item>`)
+	}
+	b.WriteString(`</channel></rss>`)
+	return b.String()
+}
+
+func BenchmarkCheckRSSFeed(b *testing.B) {
+	path := filepath.Join(b.TempDir(), "feed.xml")
+	if err := os.WriteFile(path, []byte(benchFeed(50)), 0o644); err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	for b.Loop() {
+		if _, err := CheckRSSFeed("file://" + path); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkParseFeed(b *testing.B) {
+	feed := benchFeed(50)
+	b.SetBytes(int64(len(feed)))
+	b.ReportAllocs()
+	for b.Loop() {
+		if _, err := ParseFeed(strings.NewReader(feed)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkContentHash(b *testing.B) {
+	items, err := ParseFeed(strings.NewReader(benchFeed(1)))
+	if err != nil {
+		b.Fatal(err)
+	}
+	content := items[0].Encoded
+	for _, h := range []Hashing{
+		{Algorithm: HashSHA256},
+		DefaultHashing,
+		{Algorithm: HashFNV, Normalize: []string{NormalizeStripHTML, NormalizeWhitespace, NormalizeLowercase}},
+	} {
+		b.Run(h.Algorithm+"/"+strings.Join(h.Normalize, "+"), func(b *testing.B) {
+			b.SetBytes(int64(len(content)))
+			b.ReportAllocs()
+			for b.Loop() {
+				h.Hash(content)
+			}
+		})
+	}
+}
+
+func BenchmarkImages(b *testing.B) {
+	items, err := ParseFeed(strings.NewReader(benchFeed(1)))
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	for b.Loop() {
+		items[0].Images(4)
+	}
+}
@@ -0,0 +1,160 @@
+package rss
+
+import (
+	"encoding/xml"
+	"slices"
+	"strings"
+)
+
+// Extension is an element of a feed item from a namespace that has no field
+// of its own in RSSItem, such as media:content or itunes:duration.
+type Extension struct {
+	Name  string
+	Value string
+	// Attrs are the element's attributes by local name.
+	Attrs map[string]string
+	// Children are the element's child elements by local name.
+	Children map[string][]Extension
+}
+
+// Extensions are the namespaced elements of an item by namespace prefix and
+// local name, e.g. ext["itunes"]["duration"]. Namespaces the feed declares
+// are keyed by the prefix it declares them with, well-known ones by their
+// usual prefix, and any others by their URI.
+type Extensions map[string]map[string][]Extension
+
+// Get returns the value of the first element named "prefix:name", or "" if
+// the item has none.
+func (e Extensions) Get(name string) string {
+	if ext, ok := e.first(name); ok {
+		return ext.Value
+	}
+	return ""
+}
+
+// Attr returns the attribute attr of the first element named
+// "prefix:name", or "" if the item has no such element or attribute.
+func (e Extensions) Attr(name, attr string) string {
+	if ext, ok := e.first(name); ok {
+		return ext.Attrs[attr]
+	}
+	return ""
+}
+
+// Has reports whether the item has an element named "prefix:name".
+func (e Extensions) Has(name string) bool {
+	_, ok := e.first(name)
+	return ok
+}
+
+func (e Extensions) first(name string) (Extension, bool) {
+	prefix, local, ok := strings.Cut(name, ":")
+	if !ok {
+		return Extension{}, false
+	}
+	exts := e[prefix][local]
+	if len(exts) == 0 {
+		return Extension{}, false
+	}
+	return exts[0], true
+}
+
+// MediaRatings returns the values of the item's media:rating elements,
+// including those of its media:group and media:content elements.
+func (item RSSItem) MediaRatings() []string {
+	var ratings []string
+	var collect func(exts map[string][]Extension)
+	collect = func(exts map[string][]Extension) {
+		for _, rating := range exts["rating"] {
+			ratings = append(ratings, rating.Value)
+		}
+		for _, child := range append(slices.Clone(exts["group"]), exts["content"]...) {
+			collect(child.Children)
+		}
+	}
+	collect(item.Extensions["media"])
+	return ratings
+}
+
+// knownNamespaces are the usual prefixes of common feed namespaces, for
+// feeds that declare them somewhere other than the rss element.
+var knownNamespaces = map[string]string{
+	"http://search.yahoo.com/mrss/":                   "media",
+	"http://www.itunes.com/dtds/podcast-1.0.dtd":      "itunes",
+	"https://podcastindex.org/namespace/1.0":          "podcast",
+	"http://www.google.com/schemas/play-podcasts/1.0": "googleplay",
+	"http://purl.org/dc/elements/1.1/":                "dc",
+	"http://purl.org/rss/1.0/modules/content/":        "content",
+	"http://purl.org/rss/1.0/modules/slash/":          "slash",
+	"http://wellformedweb.org/CommentAPI/":            "wfw",
+	"http://www.w3.org/2005/Atom":                     "atom",
+	"http://www.georss.org/georss":                    "georss",
+}
+
+// rawElement is an element of an item captured as is for Extensions.
+type rawElement struct {
+	XMLName  xml.Name
+	Attrs    []xml.Attr   `xml:",any,attr"`
+	Text     string       `xml:",chardata"`
+	Children []rawElement `xml:",any"`
+}
+
+// namespacePrefixes maps the namespace URIs declared by attrs, the
+// attributes of the rss element, to their prefixes.
+func namespacePrefixes(attrs []xml.Attr) map[string]string {
+	prefixes := make(map[string]string)
+	for _, attr := range attrs {
+		if attr.Name.Space == "xmlns" && attr.Value != "" {
+			prefixes[attr.Value] = attr.Name.Local
+		}
+	}
+	return prefixes
+}
+
+// extensions converts the namespaced elements of raw to Extensions, or nil
+// when there are none. Elements without a namespace are RSS elements
+// RSSItem does not know and are left out.
+func extensions(raw []rawElement, prefixes map[string]string) Extensions {
+	var exts Extensions
+	for _, el := range raw {
+		space := el.XMLName.Space
+		if space == "" {
+			continue
+		}
+		prefix, ok := prefixes[space]
+		if !ok {
+			if prefix, ok = knownNamespaces[space]; !ok {
+				// encoding/xml leaves undeclared prefixes as they are.
+				prefix = space
+			}
+		}
+		if exts == nil {
+			exts = make(Extensions)
+		}
+		if exts[prefix] == nil {
+			exts[prefix] = make(map[string][]Extension)
+		}
+		exts[prefix][el.XMLName.Local] = append(exts[prefix][el.XMLName.Local], el.extension())
+	}
+	return exts
+}
+
+func (el rawElement) extension() Extension {
+	ext := Extension{Name: el.XMLName.Local, Value: strings.TrimSpace(el.Text)}
+	for _, attr := range el.Attrs {
+		if attr.Name.Space == "xmlns" || (attr.Name.Space == "" && attr.Name.Local == "xmlns") {
+			continue
+		}
+		if ext.Attrs == nil {
+			ext.Attrs = make(map[string]string)
+		}
+		ext.Attrs[attr.Name.Local] = attr.Value
+	}
+	for _, child := range el.Children {
+		if ext.Children == nil {
+			ext.Children = make(map[string][]Extension)
+		}
+		ext.Children[child.XMLName.Local] = append(ext.Children[child.XMLName.Local], child.extension())
+	}
+	return ext
+}
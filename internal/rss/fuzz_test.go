@@ -0,0 +1,93 @@
+package rss
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// fuzzFeeds seed FuzzParseFeed with the shapes of feeds seen in the wild.
+var fuzzFeeds = []string{
+	`<rss><channel><title>Blog</title><item><title>Post</title><link>https://example.com/post</link><description>Text</description><pubDate>Mon, 02 Jan 2006 15:04:05 -0700</pubDate></item></channel></rss>`,
+	`<rss xmlns:media="http://search.yahoo.com/mrss/" xmlns:content="http://purl.org/rss/1.0/modules/content/"><channel><item><guid>1</guid><content:encoded><![CDATA[<p>Hi <img src="/a.png" alt='A'></p>]]></content:encoded><media:group><media:content url="https://example.com/v.mp4"><media:rating>adult</media:rating></media:content></media:group></item></channel></rss>`,
+	`<rss><channel><item><description>&lt;img src=x&gt;&lt;img src="data:image/png;base64,AA"&gt;</description><category>a</category><category>b</category></item></channel></rss>`,
+	`<feed xmlns="http://www.w3.org/2005/Atom"><entry><title>Atom</title></entry></feed>`,
+	`<rss><channel><item><x:y xmlns:x="urn:x" a="1"><x:z/></x:y></item></channel></rss>`,
+	`<rss><channel><item>`,
+	``,
+}
+
+// FuzzParseFeed checks that no document makes ParseFeed, or the accessors
+// run on the items it returns, panic or hang.
+func FuzzParseFeed(f *testing.F) {
+	for _, feed := range fuzzFeeds {
+		f.Add(feed)
+	}
+	f.Fuzz(func(t *testing.T, feed string) {
+		items, err := ParseFeed(strings.NewReader(feed))
+		if err != nil {
+			if items != nil {
+				t.Fatalf("ParseFeed returned items with error %v", err)
+			}
+			return
+		}
+		for _, item := range items {
+			_ = item.Key()
+			_, _ = item.ParsePubDate()
+			_ = item.MediaRatings()
+			_ = item.Extensions.Get("media:content")
+			_ = item.Extensions.Attr("media:content", "url")
+			for _, img := range item.Images(4) {
+				if !strings.HasPrefix(img.URL, "http://") && !strings.HasPrefix(img.URL, "https://") {
+					t.Fatalf("Images returned non-http(s) URL %q", img.URL)
+				}
+			}
+		}
+		_, _ = Newest(items)
+	})
+}
+
+// FuzzImages checks that Images only returns http(s) URLs, at most max of
+// them, whatever the content and link of the item.
+func FuzzImages(f *testing.F) {
+	f.Add(`<img src="/a.png" alt="A">`, "https://example.com/post/")
+	f.Add(`<IMG ALT='x' SRC=b.jpg>`, "")
+	f.Add(`<img src="javascript:alert(1)">`, "https://example.com")
+	f.Add(`<img src="http://[::1">`, "%zz")
+	f.Add(`<img src="//cdn.example.com/c.gif">`, "https://example.com")
+	f.Fuzz(func(t *testing.T, content, link string) {
+		images := RSSItem{Content: content, Link: link}.Images(3)
+		if len(images) > 3 {
+			t.Fatalf("Images(3) returned %d images", len(images))
+		}
+		for _, img := range images {
+			if !strings.HasPrefix(img.URL, "http://") && !strings.HasPrefix(img.URL, "https://") {
+				t.Fatalf("Images returned non-http(s) URL %q", img.URL)
+			}
+			if utf8.ValidString(content) && !utf8.ValidString(img.Alt) {
+				t.Fatalf("Images returned invalid UTF-8 alt text %q", img.Alt)
+			}
+		}
+	})
+}
+
+// FuzzStripTags checks StripTags and CollapseWhitespace against the
+// regexps they replace.
+func FuzzStripTags(f *testing.F) {
+	f.Add("<p>a <b>b</b></p>")
+	f.Add("a < b > c <d")
+	f.Add("<<>>")
+	f.Add(" \t\r\n\f x   y\v\v z \n")
+	f.Add("no tags")
+	tags := regexp.MustCompile(`(?s)<[^>]*>`)
+	spaces := regexp.MustCompile(`\s+`)
+	f.Fuzz(func(t *testing.T, s string) {
+		if got, want := StripTags(s), tags.ReplaceAllString(s, " "); got != want {
+			t.Fatalf("StripTags(%q) = %q, want %q", s, got, want)
+		}
+		if got, want := CollapseWhitespace(s), strings.TrimSpace(spaces.ReplaceAllString(s, " ")); got != want {
+			t.Fatalf("CollapseWhitespace(%q) = %q, want %q", s, got, want)
+		}
+	})
+}
@@ -0,0 +1,118 @@
+package rss
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"hash/fnv"
+	"html"
+	"io"
+	"strings"
+)
+
+// Hash algorithms for Hashing.
+const (
+	HashSHA256 = "sha256"
+	HashSHA512 = "sha512"
+	// HashFNV is the non-cryptographic 64-bit FNV-1a, which is enough to
+	// detect changes and keeps stored hashes short.
+	HashFNV = "fnv64a"
+)
+
+// Normalization steps applied to content before hashing it, in the order
+// they are given.
+const (
+	// NormalizeStripHTML removes HTML tags, attributes included, and
+	// decodes entities.
+	NormalizeStripHTML = "strip_html"
+	// NormalizeWhitespace collapses runs of whitespace into a single space
+	// and trims the ends.
+	NormalizeWhitespace = "collapse_whitespace"
+	// NormalizeLowercase lowercases the content.
+	NormalizeLowercase = "lowercase"
+)
+
+var (
+	hashes = map[string]func() hash.Hash{
+		HashSHA256: sha256.New,
+		HashSHA512: sha512.New,
+		HashFNV:    func() hash.Hash { return fnv.New64a() },
+	}
+
+	normalizers = map[string]func(string) string{
+		NormalizeStripHTML: func(s string) string {
+			return html.UnescapeString(StripTags(s))
+		},
+		NormalizeWhitespace: CollapseWhitespace,
+		NormalizeLowercase:  strings.ToLower,
+	}
+)
+
+// DefaultHashing is the hashing used unless configured otherwise: SHA-256 of the content stripped of HTML with whitespace
+// collapsed, so that cosmetic changes of a CMS are not taken for updates.
+var DefaultHashing = Hashing{
+	Algorithm: HashSHA256,
+	Normalize: []string{NormalizeStripHTML, NormalizeWhitespace},
+}
+
+// Hashing describes how content is hashed to detect updates.
+type Hashing struct {
+	// Algorithm is one of HashSHA256, HashSHA512 or HashFNV.
+	Algorithm string
+	// Normalize are the normalization steps applied before hashing, in
+	// order.
+	Normalize []string
+}
+
+// Validate returns an error naming the first unknown algorithm or
+// normalization step of h.
+func (h Hashing) Validate() error {
+	if _, ok := hashes[h.Algorithm]; !ok {
+		return fmt.Errorf("unknown hash algorithm %q, must be one of %s, %s or %s", h.Algorithm, HashSHA256, HashSHA512, HashFNV)
+	}
+	for _, step := range h.Normalize {
+		if _, ok := normalizers[step]; !ok {
+			return fmt.Errorf("unknown normalization %q, must be one of %s, %s or %s", step, NormalizeStripHTML, NormalizeWhitespace, NormalizeLowercase)
+		}
+	}
+	return nil
+}
+
+// scheme identifies h in the hashes it makes. SHA-256 without normalization
+// has the empty scheme, matching the bare hashes of older versions.
+func (h Hashing) scheme() string {
+	if h.Algorithm == HashSHA256 && len(h.Normalize) == 0 {
+		return ""
+	}
+	return h.Algorithm + "/" + strings.Join(h.Normalize, "+") + ":"
+}
+
+// Hash returns the hash of content as stored to detect updates, normalized
+// and hashed as h says. The hash starts with an identifier of the algorithm
+// and normalization, so that hashes made with other settings are told apart
+// by Comparable. h must be valid.
+func (h Hashing) Hash(content string) string {
+	for _, step := range h.Normalize {
+		content = normalizers[step](content)
+	}
+	hasher := hashes[h.Algorithm]()
+	io.WriteString(hasher, content)
+	var sum [sha512.Size]byte
+	scheme := h.scheme()
+	out := make([]byte, 0, len(scheme)+2*hasher.Size())
+	out = append(out, scheme...)
+	return string(hex.AppendEncode(out, hasher.Sum(sum[:0])))
+}
+
+// Comparable reports whether stored, a hash made by Hash, was made with the
+// settings of h and can be compared with a new hash.
+func (h Hashing) Comparable(stored string) bool {
+	scheme := h.scheme()
+	if scheme == "" {
+		// Bare hashes have no ':', which hex digits never contain.
+		return !strings.Contains(stored, ":")
+	}
+	return strings.HasPrefix(stored, scheme)
+}
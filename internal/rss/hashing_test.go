@@ -0,0 +1,50 @@
+package rss
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHash_IgnoresCosmeticChanges(t *testing.T) {
+	h := DefaultHashing
+	original := `<p class="intro">Hello &amp; welcome.</p>
+<p>Second paragraph.</p>`
+
+	assert.Equal(t, h.Hash(original), h.Hash(`<p class="lead" id="x">Hello &amp; welcome.</p>   <p>Second   paragraph.</p>`))
+	assert.Equal(t, h.Hash(original), h.Hash("Hello & welcome. Second paragraph."))
+	assert.NotEqual(t, h.Hash(original), h.Hash(`<p>Hello &amp; welcome.</p><p>Third paragraph.</p>`))
+	assert.NotEqual(t, h.Hash("Hello"), h.Hash("hello"), "case is kept without lowercase")
+}
+
+func TestHash_Settings(t *testing.T) {
+	content := "<b>Some</b> content"
+
+	h := Hashing{Algorithm: HashSHA256}
+	assert.Len(t, h.Hash(content), 64)
+	assert.NotContains(t, h.Hash(content), ":", "unnormalized SHA-256 hashes match those of older versions")
+
+	h = Hashing{Algorithm: HashSHA512, Normalize: []string{NormalizeStripHTML}}
+	assert.Regexp(t, `^sha512/strip_html:[0-9a-f]{128}$`, h.Hash(content))
+
+	h = Hashing{Algorithm: HashFNV, Normalize: []string{NormalizeStripHTML, NormalizeWhitespace, NormalizeLowercase}}
+	assert.Regexp(t, `^fnv64a/strip_html\+collapse_whitespace\+lowercase:[0-9a-f]{16}$`, h.Hash(content))
+	assert.Equal(t, h.Hash(content), h.Hash("SOME CONTENT"))
+}
+
+func TestComparable(t *testing.T) {
+	bare := Hashing{Algorithm: HashSHA256}
+	legacy := bare.Hash("content")
+	assert.True(t, bare.Comparable(legacy))
+
+	assert.False(t, DefaultHashing.Comparable(legacy))
+	assert.True(t, DefaultHashing.Comparable(DefaultHashing.Hash("content")))
+
+	assert.False(t, bare.Comparable("sha256/strip_html+collapse_whitespace:"+legacy))
+}
+
+func TestValidate_Invalid(t *testing.T) {
+	assert.NoError(t, DefaultHashing.Validate())
+	assert.Error(t, Hashing{Algorithm: "md5"}.Validate())
+	assert.Error(t, Hashing{Algorithm: HashSHA256, Normalize: []string{"stem"}}.Validate())
+}
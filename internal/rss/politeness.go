@@ -0,0 +1,137 @@
+package rss
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxRetryAfter caps how long a Retry-After header can hold back fetches
+// from a host, so that a misconfigured server cannot stop them for good.
+const maxRetryAfter = 24 * time.Hour
+
+// StatusError is returned by FetchFeed when the feed server responds with a
+// status other than 200 OK.
+type StatusError struct {
+	StatusCode int
+	// RetryAfter is how long the server asked to wait with a 429 Too Many
+	// Requests or 503 Service Unavailable response, if it did.
+	RetryAfter time.Duration
+}
+
+func (e *StatusError) Error() string {
+	if e.RetryAfter > 0 {
+		return fmt.Sprintf("unexpected HTTP status: %d (retry after %s)", e.StatusCode, e.RetryAfter)
+	}
+	return fmt.Sprintf("unexpected HTTP status: %d", e.StatusCode)
+}
+
+// ThrottledError is returned by FetchFeed, without making a request, while
+// the host of the feed must not be fetched from.
+type ThrottledError struct {
+	Host  string
+	Until time.Time
+}
+
+func (e *ThrottledError) Error() string {
+	return fmt.Sprintf("not fetching from %s again before %s", e.Host, e.Until.Format(time.RFC3339))
+}
+
+// hostGate spaces out the fetches from each host: after a fetch, the host is
+// held back for the minimum interval, and after a Retry-After header for as
+// long as the server asked.
+type hostGate struct {
+	mu       sync.Mutex
+	interval time.Duration
+	until    map[string]time.Time
+}
+
+func newHostGate(interval time.Duration) *hostGate {
+	return &hostGate{interval: interval, until: make(map[string]time.Time)}
+}
+
+// allow returns a ThrottledError while host is held back.
+func (g *hostGate) allow(host string, t time.Time) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if until := g.until[host]; t.Before(until) {
+		return &ThrottledError{Host: host, Until: until}
+	}
+	return nil
+}
+
+// fetched holds host back for the minimum interval after a fetch at t.
+func (g *hostGate) fetched(host string, t time.Time) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.hold(host, t.Add(g.interval))
+}
+
+// hold holds host back until t, unless it is held back longer already. g.mu
+// must be held.
+func (g *hostGate) hold(host string, t time.Time) {
+	if t.After(g.until[host]) {
+		g.until[host] = t
+	}
+}
+
+// feedHost returns the host:port fetches of feedURL are spaced out by.
+func feedHost(feedURL string) string {
+	u, err := url.Parse(feedURL)
+	if err != nil {
+		return feedURL
+	}
+	return u.Host
+}
+
+// statusError returns the StatusError for resp, holding host back for as
+// long as its Retry-After header asks.
+func (g *hostGate) statusError(host string, resp *http.Response, t time.Time) *StatusError {
+	err := &StatusError{StatusCode: resp.StatusCode}
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+		err.RetryAfter = parseRetryAfter(resp.Header.Get("Retry-After"), t)
+		g.mu.Lock()
+		g.hold(host, t.Add(err.RetryAfter))
+		g.mu.Unlock()
+	}
+	return err
+}
+
+// parseRetryAfter returns the delay a Retry-After header value asks for,
+// either in seconds or as an HTTP date, at most maxRetryAfter. Missing or
+// invalid values yield zero.
+func parseRetryAfter(value string, t time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	var d time.Duration
+	if secs, err := strconv.Atoi(value); err == nil {
+		d = time.Duration(secs) * time.Second
+	} else if date, err := http.ParseTime(value); err == nil {
+		d = date.Sub(t)
+	}
+	return min(max(d, 0), maxRetryAfter)
+}
+
+// RetryAfter returns how long to wait before fetching again after err,
+// which the server asked for or the minimum host interval requires, or zero
+// when err is neither a StatusError nor a ThrottledError.
+func RetryAfter(err error, t time.Time) time.Duration {
+	var (
+		status    *StatusError
+		throttled *ThrottledError
+	)
+	switch {
+	case errors.As(err, &status):
+		return status.RetryAfter
+	case errors.As(err, &throttled):
+		return max(throttled.Until.Sub(t), 0)
+	}
+	return 0
+}
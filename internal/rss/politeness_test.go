@@ -0,0 +1,96 @@
+package rss
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeNow makes the host gate of f run on a settable clock.
+func fakeNow(f *Fetcher) *time.Time {
+	current := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	f.now = func() time.Time { return current }
+	return &current
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	at := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{"", 0},
+		{"120", 2 * time.Minute},
+		{" 30 ", 30 * time.Second},
+		{"Thu, 01 Jan 2026 12:05:00 GMT", 5 * time.Minute},
+		{"Thu, 01 Jan 2026 11:00:00 GMT", 0},
+		{"-5", 0},
+		{"999999", maxRetryAfter},
+		{"soon", 0},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, parseRetryAfter(tt.value, at), tt.value)
+	}
+}
+
+func TestFetchFeed_HonorsRetryAfter(t *testing.T) {
+	f := NewFetcher(DefaultRedirectPolicy, 0)
+	current := fakeNow(f)
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			w.Header().Set("Retry-After", "600")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		_, _ = w.Write([]byte("<rss></rss>"))
+	}))
+	defer srv.Close()
+
+	_, err := f.FetchFeed(srv.URL)
+	var status *StatusError
+	require.True(t, errors.As(err, &status))
+	assert.Equal(t, http.StatusTooManyRequests, status.StatusCode)
+	assert.Equal(t, 10*time.Minute, RetryAfter(err, *current))
+
+	*current = current.Add(5 * time.Minute)
+	_, err = f.FetchFeed(srv.URL)
+	var throttled *ThrottledError
+	require.True(t, errors.As(err, &throttled), "the host is not fetched from before Retry-After elapsed")
+	assert.Equal(t, 5*time.Minute, RetryAfter(err, *current))
+	assert.Equal(t, 1, requests)
+
+	*current = current.Add(5 * time.Minute)
+	_, err = f.FetchFeed(srv.URL)
+	require.NoError(t, err)
+	assert.Equal(t, 2, requests)
+}
+
+func TestFetchFeed_MinHostInterval(t *testing.T) {
+	f := NewFetcher(DefaultRedirectPolicy, time.Minute)
+	current := fakeNow(f)
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		_, _ = w.Write([]byte("<rss></rss>"))
+	}))
+	defer srv.Close()
+
+	_, err := f.FetchFeed(srv.URL + "/a.xml")
+	require.NoError(t, err)
+	_, err = f.FetchFeed(srv.URL + "/b.xml")
+	var throttled *ThrottledError
+	require.True(t, errors.As(err, &throttled), "the interval applies to every feed of a host")
+	assert.Equal(t, 1, requests)
+
+	*current = current.Add(time.Minute)
+	_, err = f.FetchFeed(srv.URL + "/b.xml")
+	require.NoError(t, err)
+	assert.Equal(t, 2, requests)
+}
@@ -0,0 +1,40 @@
+package rss
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// RedirectPolicy limits the redirects FetchFeed follows, so that a feed
+// moved behind a URL shortener or an open redirect does not silently end up
+// somewhere else.
+type RedirectPolicy struct {
+	// MaxRedirects is how many redirects are followed; 0 follows none.
+	MaxRedirects int
+	// AllowDowngrade follows redirects from https to plain http.
+	AllowDowngrade bool
+	// PinHost refuses redirects to a host other than the feed URL's.
+	PinHost bool
+}
+
+// DefaultRedirectPolicy follows up to 10 redirects, as net/http does, but
+// never from https to http.
+var DefaultRedirectPolicy = RedirectPolicy{MaxRedirects: 10}
+
+// checkRedirect is an http.Client CheckRedirect function enforcing p. req is
+// the redirect about to be followed and via the requests made so far, oldest
+// first.
+func (p RedirectPolicy) checkRedirect(req *http.Request, via []*http.Request) error {
+	from, to := via[len(via)-1].URL, req.URL
+	if len(via) > p.MaxRedirects {
+		return fmt.Errorf("refusing redirect to %s: stopped after %d redirects", to.Redacted(), p.MaxRedirects)
+	}
+	if !p.AllowDowngrade && from.Scheme == "https" && to.Scheme == "http" {
+		return fmt.Errorf("refusing redirect from %s to %s: downgrade from https to http", from.Redacted(), to.Redacted())
+	}
+	if origin := via[0].URL; p.PinHost && !strings.EqualFold(origin.Hostname(), to.Hostname()) {
+		return fmt.Errorf("refusing redirect to %s: the feed host is pinned to %s", to.Redacted(), origin.Hostname())
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package rss
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedirectPolicy_CheckRedirect(t *testing.T) {
+	get := func(url string) *http.Request {
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		require.NoError(t, err)
+		return req
+	}
+	origin := get("https://example.com/feed.xml")
+
+	tests := []struct {
+		name    string
+		policy  RedirectPolicy
+		to      string
+		via     []*http.Request
+		wantErr string
+	}{
+		{name: "same host", policy: DefaultRedirectPolicy, to: "https://example.com/rss"},
+		{name: "other host", policy: DefaultRedirectPolicy, to: "https://cdn.example.net/rss"},
+		{name: "too many", policy: RedirectPolicy{MaxRedirects: 1}, to: "https://example.com/c", via: []*http.Request{get("https://example.com/b")}, wantErr: "stopped after 1 redirects"},
+		{name: "none allowed", policy: RedirectPolicy{}, to: "https://example.com/rss", wantErr: "stopped after 0 redirects"},
+		{name: "downgrade", policy: DefaultRedirectPolicy, to: "http://example.com/rss", wantErr: "downgrade from https to http"},
+		{name: "downgrade allowed", policy: RedirectPolicy{MaxRedirects: 10, AllowDowngrade: true}, to: "http://example.com/rss"},
+		{name: "pinned host", policy: RedirectPolicy{MaxRedirects: 10, PinHost: true}, to: "https://sho.rt/abc", wantErr: "the feed host is pinned to example.com"},
+		{name: "pinned host, other port", policy: RedirectPolicy{MaxRedirects: 10, PinHost: true}, to: "https://EXAMPLE.com:8443/rss"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.policy.checkRedirect(get(tt.to), append([]*http.Request{origin}, tt.via...))
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestFetchFeed_RedirectPolicy(t *testing.T) {
+	feed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("<rss></rss>"))
+	}))
+	defer feed.Close()
+	shortener := httptest.NewServer(http.RedirectHandler(feed.URL+"/feed.xml", http.StatusMovedPermanently))
+	defer shortener.Close()
+
+	_, err := FetchFeed(shortener.URL)
+	require.NoError(t, err, "both test servers are on 127.0.0.1")
+
+	_, err = NewFetcher(RedirectPolicy{}, 0).FetchFeed(shortener.URL)
+	assert.ErrorContains(t, err, "stopped after 0 redirects")
+}
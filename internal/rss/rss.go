@@ -3,11 +3,22 @@
 package rss
 
 import (
+	"bytes"
 	"crypto/sha256"
 	"encoding/xml"
 	"fmt"
+	"html"
+	"io"
 	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
 	"time"
+
+	"github.com/toozej/rss2socials/internal/httpbody"
 )
 
 type RSSFeed struct {
@@ -24,6 +35,33 @@ type RSSItem struct {
 	Link    string `xml:"link"`
 	Content string `xml:"description"`
 	PubDate string `xml:"pubDate"`
+	// GUID is the item's guid element, which identifies it across fetches
+	// even when its link or content change.
+	GUID string `xml:"guid"`
+	// Encoded is the full content of the item from content:encoded. The
+	// element is matched by its local name so that feeds which forget to
+	// declare the content namespace are still read.
+	Encoded string `xml:"encoded"`
+	// Categories are the item's category elements.
+	Categories []string `xml:"category"`
+	// FeedLink is the link of the item in the feed when Link was replaced
+	// by the canonical URL of its page, and empty otherwise.
+	FeedLink string `xml:"-"`
+	// Extensions are the item's elements from other namespaces, such as
+	// media:*, itunes:* or a feed's own, for templates and filters.
+	Extensions Extensions `xml:"-"`
+}
+
+// Key identifies the item across fetches: its guid, or else the link it
+// has in the feed.
+func (item RSSItem) Key() string {
+	if guid := strings.TrimSpace(item.GUID); guid != "" {
+		return guid
+	}
+	if item.FeedLink != "" {
+		return item.FeedLink
+	}
+	return item.Link
 }
 
 // ParsePubDate attempts to parse the item's PubDate field into a time.Time value.
@@ -50,30 +88,239 @@ func (item RSSItem) ParsePubDate() (time.Time, error) {
 	return time.Time{}, fmt.Errorf("failed to parse pubDate: %q", item.PubDate)
 }
 
+// Newest returns the item with the latest pubDate, or the first item when
+// none has a pubDate that can be parsed, as feeds list their newest item
+// first. It returns false for an empty feed.
+func Newest(items []RSSItem) (RSSItem, bool) {
+	if len(items) == 0 {
+		return RSSItem{}, false
+	}
+	newest, latest := items[0], time.Time{}
+	for _, item := range items {
+		if t, err := item.ParsePubDate(); err == nil && t.After(latest) {
+			newest, latest = item, t
+		}
+	}
+	return newest, true
+}
+
+// Image is an image referenced by an <img> tag in an item's content.
+type Image struct {
+	URL string
+	Alt string
+}
+
+var (
+	imgTagPattern  = regexp.MustCompile(`(?is)<img\s[^>]*>`)
+	imgAttrPattern = regexp.MustCompile(`(?is)\b(src|alt)\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s>]+))`)
+)
+
+// Images returns up to max images of the item's content, in document order,
+// with relative URLs resolved against the item's link. Images without an
+// http(s) source with a host, such as data: URIs, are skipped. A
+// non-positive max returns nil.
+func (item RSSItem) Images(max int) []Image {
+	if max <= 0 {
+		return nil
+	}
+	base, _ := url.Parse(item.Link)
+
+	var images []Image
+	for _, tag := range imgTagPattern.FindAllString(item.Content, -1) {
+		var img Image
+		for _, m := range imgAttrPattern.FindAllStringSubmatch(tag, -1) {
+			value := html.UnescapeString(m[2] + m[3] + m[4])
+			if strings.EqualFold(m[1], "src") {
+				img.URL = value
+			} else {
+				img.Alt = value
+			}
+		}
+		u, err := url.Parse(img.URL)
+		if err != nil || img.URL == "" {
+			continue
+		}
+		if base != nil {
+			u = base.ResolveReference(u)
+		}
+		if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			continue
+		}
+		img.URL = u.String()
+		images = append(images, img)
+		if len(images) == max {
+			break
+		}
+	}
+	return images
+}
+
+// StdinFeed is the feed URL that reads the feed from standard input.
+const StdinFeed = "-"
+
+// MaxFeedSize caps the size of a feed fetched over HTTP.
+const MaxFeedSize = 20 << 20
+
+// feedURLPlaceholders expands the date placeholders of feed URLs.
+var feedURLPlaceholders = []struct {
+	name   string
+	layout string
+}{
+	{"{{year}}", "2006"},
+	{"{{month}}", "01"},
+	{"{{day}}", "02"},
+}
+
+// ExpandFeedURL replaces the date placeholders {{year}}, {{month}} and
+// {{day}} in feedURL with the date of t, e.g. "/feed/{{year}}.xml" with
+// "/feed/2026.xml", so that a feed archived per year or month does not need
+// its URL edited every time it moves on.
+func ExpandFeedURL(feedURL string, t time.Time) string {
+	if !strings.Contains(feedURL, "{{") {
+		return feedURL
+	}
+	for _, p := range feedURLPlaceholders {
+		feedURL = strings.ReplaceAll(feedURL, p.name, t.Format(p.layout))
+	}
+	return feedURL
+}
+
+var (
+	// stdin is read by CheckRSSFeed for StdinFeed; replaced in tests.
+	stdin io.Reader = os.Stdin
+
+	stdinOnce sync.Once
+	stdinData []byte
+	stdinErr  error
+)
+
 // CheckRSSFeed fetches and parses the RSS feed from the provided URL
 func CheckRSSFeed(feedURL string) ([]RSSItem, error) {
 	// CheckRSSFeed fetches the RSS feed from the given URL, parses it into RSSItems, and returns them.
-	// It handles HTTP requests with timeout and XML decoding.
+	// Besides http(s) URLs it accepts file:// paths and "-" for standard input,
+	// which is read once and re-parsed on every call.
+	data, err := FetchFeed(feedURL)
+	if err != nil {
+		return nil, err
+	}
+	return ParseFeed(bytes.NewReader(data))
+}
+
+// Fetcher fetches feeds, following redirects as its redirect policy allows
+// and spacing out the fetches from each host. A Fetcher is safe for
+// concurrent use.
+type Fetcher struct {
+	redirects RedirectPolicy
+	gate      *hostGate
+	// now is the time the gate is checked against; replaced in tests.
+	now func() time.Time
+}
+
+// NewFetcher returns a Fetcher following redirects as redirects allows and
+// waiting at least minHostInterval between two fetches from the same host,
+// so that an aggressive polling configuration cannot get the client banned.
+// Zero disables the minimum; Retry-After is always honored.
+func NewFetcher(redirects RedirectPolicy, minHostInterval time.Duration) *Fetcher {
+	return &Fetcher{redirects: redirects, gate: newHostGate(minHostInterval), now: time.Now}
+}
+
+// defaultFetcher is the Fetcher of FetchFeed and CheckRSSFeed.
+var defaultFetcher = NewFetcher(DefaultRedirectPolicy, 0)
+
+// FetchFeed fetches feedURL with a Fetcher using DefaultRedirectPolicy and
+// no minimum host interval, shared by every caller of FetchFeed.
+func FetchFeed(feedURL string) ([]byte, error) {
+	return defaultFetcher.FetchFeed(feedURL)
+}
+
+// FetchFeed returns the raw feed document at feedURL, which may be an
+// http(s) URL, a file:// path or StdinFeed. Fetches from the same host are
+// spaced out by the minimum host interval and any Retry-After the server
+// sent; until then, a ThrottledError is returned without making a request.
+// A response other than 200 OK is returned as a StatusError.
+// Redirects are followed as the redirect policy allows.
+func (f *Fetcher) FetchFeed(feedURL string) ([]byte, error) {
+	switch {
+	case feedURL == StdinFeed:
+		stdinOnce.Do(func() { stdinData, stdinErr = io.ReadAll(stdin) })
+		if stdinErr != nil {
+			return nil, fmt.Errorf("failed to read feed from stdin: %w", stdinErr)
+		}
+		return stdinData, nil
+	case strings.HasPrefix(feedURL, "file://"):
+		data, err := os.ReadFile(strings.TrimPrefix(feedURL, "file://"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to open feed file: %w", err)
+		}
+		return data, nil
+	}
+
+	host := feedHost(feedURL)
+	if err := f.gate.allow(host, f.now()); err != nil {
+		return nil, err
+	}
+
 	client := http.Client{
-		Timeout: 10 * time.Second,
+		Timeout:       10 * time.Second,
+		CheckRedirect: f.redirects.checkRedirect,
 	}
 
 	resp, err := client.Get(feedURL)
+	f.gate.fetched(host, f.now())
 	if err != nil {
 		return nil, fmt.Errorf("HTTP request failed: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected HTTP status: %d", resp.StatusCode)
+		return nil, f.gate.statusError(host, resp, f.now())
 	}
 
-	var feed RSSFeed
-	if err := xml.NewDecoder(resp.Body).Decode(&feed); err != nil {
+	data, err := httpbody.Read(resp.Body, MaxFeedSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read RSS feed: %w", err)
+	}
+	return data, nil
+}
+
+// RecordFeed saves a fetched feed document in dir, named after the time it
+// was fetched, and returns its path. The recording can be replayed with a
+// file:// feed URL.
+func RecordFeed(dir string, data []byte, fetched time.Time) (string, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("failed to create feed recording directory: %w", err)
+	}
+	path := filepath.Join(dir, "feed-"+fetched.UTC().Format("20060102T150405.000Z")+".xml")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return "", fmt.Errorf("failed to record feed: %w", err)
+	}
+	return path, nil
+}
+
+// ParseFeed parses the RSS document read from r and returns its items.
+func ParseFeed(r io.Reader) ([]RSSItem, error) {
+	// The document is decoded with the unmatched elements of each item,
+	// which become its Extensions.
+	var feed struct {
+		Attrs   []xml.Attr `xml:",any,attr"`
+		Channel struct {
+			Items []struct {
+				RSSItem
+				Raw []rawElement `xml:",any"`
+			} `xml:"item"`
+		} `xml:"channel"`
+	}
+	if err := xml.NewDecoder(r).Decode(&feed); err != nil {
 		return nil, fmt.Errorf("failed to parse RSS feed: %w", err)
 	}
 
-	return feed.Channel.Items, nil
+	prefixes := namespacePrefixes(feed.Attrs)
+	items := make([]RSSItem, 0, len(feed.Channel.Items))
+	for _, item := range feed.Channel.Items {
+		item.Extensions = extensions(item.Raw, prefixes)
+		items = append(items, item.RSSItem)
+	}
+	return items, nil
 }
 
 // HashContent creates a SHA-256 hash of the post content
@@ -3,9 +3,15 @@ package rss
 import (
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // Table-driven tests for CheckRSSFeed with various scenarios
@@ -128,6 +134,14 @@ func TestCheckRSSFeed(t *testing.T) {
 }
 
 // Test hash content function
+func TestExpandFeedURL(t *testing.T) {
+	at := time.Date(2026, 3, 7, 23, 30, 0, 0, time.UTC)
+	assert.Equal(t, "https://example.com/feed/2026.xml", ExpandFeedURL("https://example.com/feed/{{year}}.xml", at))
+	assert.Equal(t, "https://example.com/2026/03/07/rss", ExpandFeedURL("https://example.com/{{year}}/{{month}}/{{day}}/rss", at))
+	assert.Equal(t, "https://example.com/{{week}}.xml", ExpandFeedURL("https://example.com/{{week}}.xml", at), "unknown placeholders are kept")
+	assert.Equal(t, "https://example.com/rss", ExpandFeedURL("https://example.com/rss", at))
+}
+
 func TestHashContent(t *testing.T) {
 	content := "This is a test post"
 	actualHash := HashContent(content)
@@ -239,3 +253,171 @@ func mockHTTPServer(response string, status int) *httptest.Server {
 
 	}))
 }
+
+func TestRSSItem_Images(t *testing.T) {
+	item := RSSItem{
+		Link: "https://example.com/posts/hello",
+		Content: `<p>Intro</p><img src="/img/one.png" alt="First &amp; best">` +
+			`<IMG ALT='Second' SRC='https://cdn.example.com/two.jpg'>` +
+			`<img src="data:image/png;base64,AAAA" alt="inline">` +
+			`<img src=three.gif>` +
+			`<img alt="no source">` +
+			`<img src="four.webp"><img src="five.png">`,
+	}
+
+	images := item.Images(4)
+	assert.Equal(t, []Image{
+		{URL: "https://example.com/img/one.png", Alt: "First & best"},
+		{URL: "https://cdn.example.com/two.jpg", Alt: "Second"},
+		{URL: "https://example.com/posts/three.gif"},
+		{URL: "https://example.com/posts/four.webp"},
+	}, images)
+
+	assert.Len(t, item.Images(1), 1)
+	assert.Nil(t, item.Images(0))
+	assert.Empty(t, RSSItem{Content: "<p>No images</p>"}.Images(4))
+}
+
+const fixtureFeed = `<rss><channel><title>Local</title>
+<item><title>Local Post</title><link>https://example.com/local</link></item>
+</channel></rss>`
+
+func TestCheckRSSFeed_File(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "feed.xml")
+	require.NoError(t, os.WriteFile(path, []byte(fixtureFeed), 0o600))
+
+	items, err := CheckRSSFeed("file://" + path)
+	require.NoError(t, err)
+	require.Len(t, items, 1)
+	assert.Equal(t, "Local Post", items[0].Title)
+
+	_, err = CheckRSSFeed("file://" + filepath.Join(t.TempDir(), "missing.xml"))
+	assert.Error(t, err)
+}
+
+func TestCheckRSSFeed_Stdin(t *testing.T) {
+	origStdin := stdin
+	stdin = strings.NewReader(fixtureFeed)
+	stdinOnce, stdinData, stdinErr = sync.Once{}, nil, nil
+	defer func() {
+		stdin = origStdin
+		stdinOnce, stdinData, stdinErr = sync.Once{}, nil, nil
+	}()
+
+	for i := 0; i < 2; i++ {
+		items, err := CheckRSSFeed(StdinFeed)
+		require.NoError(t, err)
+		require.Len(t, items, 1, "stdin is read once and re-parsed on every call")
+		assert.Equal(t, "https://example.com/local", items[0].Link)
+	}
+}
+
+func TestRecordFeed(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "recordings")
+	fetched := time.Date(2024, 3, 9, 14, 5, 6, 7_000_000, time.FixedZone("CET", 3600))
+
+	path, err := RecordFeed(dir, []byte(fixtureFeed), fetched)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "feed-20240309T130506.007Z.xml"), path)
+
+	items, err := CheckRSSFeed("file://" + path)
+	require.NoError(t, err, "a recording replays as a file:// feed")
+	require.Len(t, items, 1)
+	assert.Equal(t, "Local Post", items[0].Title)
+}
+
+func TestParseFeed_ContentEncoded(t *testing.T) {
+	items, err := ParseFeed(strings.NewReader(`<rss xmlns:content="http://purl.org/rss/1.0/modules/content/"><channel>
+<item><title>Post</title><description>Summary</description><content:encoded><![CDATA[<p>Full text</p>]]></content:encoded></item>
+</channel></rss>`))
+	require.NoError(t, err)
+	require.Len(t, items, 1)
+	assert.Equal(t, "Summary", items[0].Content)
+	assert.Equal(t, "<p>Full text</p>", items[0].Encoded)
+}
+
+func TestParseFeed_Categories(t *testing.T) {
+	items, err := ParseFeed(strings.NewReader(`<rss><channel>
+<item><title>Post</title><category>Go</category><category domain="tags">Tech</category></item>
+</channel></rss>`))
+	require.NoError(t, err)
+	require.Len(t, items, 1)
+	assert.Equal(t, []string{"Go", "Tech"}, items[0].Categories)
+}
+
+func TestParseFeed_Extensions(t *testing.T) {
+	items, err := ParseFeed(strings.NewReader(`<rss xmlns:itunes="http://www.itunes.com/dtds/podcast-1.0.dtd" xmlns:m="http://search.yahoo.com/mrss/" xmlns:content="http://purl.org/rss/1.0/modules/content/"><channel>
+<item><title>Episode</title><content:encoded>Notes</content:encoded><unknown>plain</unknown>
+<itunes:duration> 42:00 </itunes:duration>
+<m:content url="https://example.com/a.jpg" medium="image"><m:title>A</m:title></m:content>
+<m:content url="https://example.com/b.jpg" medium="image"/>
+<dc:creator xmlns:dc="http://purl.org/dc/elements/1.1/">Jane</dc:creator>
+<my:rating xmlns:my="https://example.com/ns">5</my:rating>
+<undeclared:tag>x</undeclared:tag>
+</item>
+<item><title>Plain</title></item>
+</channel></rss>`))
+	require.NoError(t, err)
+	require.Len(t, items, 2)
+
+	ext := items[0].Extensions
+	assert.Equal(t, "Notes", items[0].Encoded, "known elements stay fields")
+	assert.NotContains(t, ext, "content")
+	assert.Equal(t, "42:00", ext.Get("itunes:duration"))
+	assert.Equal(t, "https://example.com/a.jpg", ext.Attr("m:content", "url"), "declared prefixes are kept")
+	require.Len(t, ext["m"]["content"], 2)
+	assert.Equal(t, "https://example.com/b.jpg", ext["m"]["content"][1].Attrs["url"])
+	assert.Equal(t, "A", ext["m"]["content"][0].Children["title"][0].Value)
+	assert.Equal(t, "Jane", ext.Get("dc:creator"), "well-known namespaces get their usual prefix")
+	assert.Empty(t, ext["dc"]["creator"][0].Attrs, "namespace declarations are not attributes")
+	assert.Equal(t, "5", ext["https://example.com/ns"]["rating"][0].Value, "unknown namespaces are keyed by URI")
+	assert.Equal(t, "x", ext.Get("undeclared:tag"))
+	assert.True(t, ext.Has("itunes:duration"))
+	assert.False(t, ext.Has("itunes:explicit"))
+	assert.Empty(t, ext.Get("duration"))
+	assert.Nil(t, items[1].Extensions)
+}
+
+func TestRSSItem_MediaRatings(t *testing.T) {
+	items, err := ParseFeed(strings.NewReader(`<rss xmlns:media="http://search.yahoo.com/mrss/"><channel>
+<item><title>Post</title><media:rating scheme="urn:simple">adult</media:rating>
+<media:group><media:content url="https://example.com/a.mp4"><media:rating scheme="urn:mpaa">r</media:rating></media:content></media:group>
+</item>
+<item><title>Plain</title></item>
+</channel></rss>`))
+	require.NoError(t, err)
+	require.Len(t, items, 2)
+	assert.Equal(t, []string{"adult", "r"}, items[0].MediaRatings())
+	assert.Empty(t, items[1].MediaRatings())
+}
+
+func TestRSSItem_Key(t *testing.T) {
+	items, err := ParseFeed(strings.NewReader(`<rss><channel>
+<item><title>Post</title><link>https://example.com/post</link><guid isPermaLink="false"> tag:example.com,2026:1 </guid></item>
+<item><title>No guid</title><link>https://example.com/other</link></item>
+</channel></rss>`))
+	require.NoError(t, err)
+	require.Len(t, items, 2)
+	assert.Equal(t, "tag:example.com,2026:1", items[0].Key())
+	assert.Equal(t, "https://example.com/other", items[1].Key())
+
+	items[1].FeedLink, items[1].Link = items[1].Link, "https://example.com/canonical"
+	assert.Equal(t, "https://example.com/other", items[1].Key(), "the feed link is kept when the link is replaced")
+}
+
+func TestNewest(t *testing.T) {
+	_, ok := Newest(nil)
+	assert.False(t, ok)
+
+	items := []RSSItem{
+		{Link: "https://example.com/b", PubDate: "Mon, 02 Mar 2026 10:00:00 +0000"},
+		{Link: "https://example.com/c", PubDate: "Wed, 04 Mar 2026 10:00:00 +0000"},
+		{Link: "https://example.com/a", PubDate: "not a date"},
+	}
+	newest, ok := Newest(items)
+	assert.True(t, ok)
+	assert.Equal(t, "https://example.com/c", newest.Link)
+
+	newest, _ = Newest([]RSSItem{{Link: "https://example.com/first"}, {Link: "https://example.com/second"}})
+	assert.Equal(t, "https://example.com/first", newest.Link, "without pubDates the first item is the newest")
+}
@@ -0,0 +1,71 @@
+package rss
+
+import "strings"
+
+// StripTags replaces every HTML tag of s, from '<' to the next '>', with a
+// space. A '<' without a closing '>' is kept as is. It does the work of
+// the regexp `(?s)<[^>]*>` without its cost, as it runs on the content of
+// every item on every check.
+func StripTags(s string) string {
+	start := strings.IndexByte(s, '<')
+	if start < 0 || strings.IndexByte(s[start:], '>') < 0 {
+		return s
+	}
+	var b strings.Builder
+	b.Grow(len(s))
+	for {
+		end := strings.IndexByte(s[start:], '>')
+		if end < 0 {
+			break
+		}
+		b.WriteString(s[:start])
+		b.WriteByte(' ')
+		s = s[start+end+1:]
+		if start = strings.IndexByte(s, '<'); start < 0 {
+			break
+		}
+	}
+	b.WriteString(s)
+	return b.String()
+}
+
+// CollapseWhitespace replaces runs of ASCII whitespace in s with a single
+// space and trims the ends, like the regexp `\s+`, whose class has the same
+// characters, followed by strings.TrimSpace.
+func CollapseWhitespace(s string) string {
+	s = strings.TrimSpace(s)
+	// The ends are trimmed, so the first run to replace is found by a
+	// space other than ' ' or by two spaces in a row.
+	i := 0
+	for ; i < len(s); i++ {
+		if isSpace(s[i]) && (s[i] != ' ' || isSpace(s[i+1])) {
+			break
+		}
+	}
+	if i == len(s) {
+		return s
+	}
+	var b strings.Builder
+	b.Grow(len(s))
+	b.WriteString(s[:i])
+	for i < len(s) {
+		j := i
+		if isSpace(s[i]) {
+			for j < len(s) && isSpace(s[j]) {
+				j++
+			}
+			b.WriteByte(' ')
+		} else {
+			for j < len(s) && !isSpace(s[j]) {
+				j++
+			}
+			b.WriteString(s[i:j])
+		}
+		i = j
+	}
+	return b.String()
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\f' || c == '\r'
+}
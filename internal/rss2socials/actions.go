@@ -0,0 +1,48 @@
+package rss2socials
+
+import (
+	"cmp"
+	"fmt"
+
+	"github.com/toozej/rss2socials/internal/db"
+	"github.com/toozej/rss2socials/internal/ghactions"
+)
+
+// actionTitles are the titles of the annotations of the audit trail actions
+// reported to GitHub Actions, by the name of the site.
+var actionTitles = map[string]string{
+	db.ActionPublished:    "Published to %s",
+	db.ActionUpdated:      "Updated on %s",
+	db.ActionScheduled:    "Scheduled on %s",
+	db.ActionRepromoted:   "Repromoted on %s",
+	db.ActionPinned:       "Pinned on %s",
+	db.ActionDeleted:      "Deleted from %s",
+	db.ActionFailed:       "Publishing to %s failed",
+	db.ActionDeadLettered: "Gave up publishing to %s",
+}
+
+// annotate reports ev to GitHub Actions: failures as errors, and publishes
+// and deletions as notices, each as a row of the job summary. Other events
+// are left to the logs.
+func annotate(a *ghactions.Reporter, ev StreamEvent) {
+	format, ok := actionTitles[ev.Action]
+	if !ok {
+		return
+	}
+	site := cmp.Or(siteNames[ev.Site], ev.Site)
+	title := fmt.Sprintf(format, site)
+	if ev.Site == "feed" {
+		title = "Fetching the feed failed"
+	}
+	message := ev.Link
+	if ev.Detail != "" {
+		message += ": " + ev.Detail
+	}
+
+	if ev.Event == EventFailed {
+		a.Error(title, message)
+	} else {
+		a.Notice(title, message)
+	}
+	a.Add(ghactions.Row{Event: ev.Action, Site: site, Link: ev.Link, Detail: ev.Detail})
+}
@@ -0,0 +1,48 @@
+package rss2socials
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/toozej/rss2socials/internal/rss"
+	"github.com/toozej/rss2socials/pkg/config"
+)
+
+// BenchmarkRunOnce measures a check cycle of a feed whose 50 items were all
+// published before, the common case of polling a feed every minute.
+func BenchmarkRunOnce(b *testing.B) {
+	items := make([]rss.RSSItem, 50)
+	for i := range items {
+		items[i] = rss.RSSItem{
+			Title:   fmt.Sprintf("Post %d", i),
+			Link:    fmt.Sprintf("https://example.com/posts/%d/", i),
+			PubDate: "Mon, 02 Mar 2026 10:00:00 +0000",
+			Content: strings.Repeat("<p>Lorem ipsum dolor sit amet, <em>consectetur</em> adipiscing elit.</p>\n", 20),
+		}
+	}
+	conf := config.Config{
+		FeedURL:      "memory://feed",
+		SocialSites:  []string{"mastodon"},
+		PostTemplate: `{{.Title}}: {{.Content | stripHTML | firstSentence | ellipsis 280}} {{.Link}}`,
+	}
+	deps := Deps{
+		FeedFetcher: staticFeed(items...),
+		Publishers:  map[string]Publisher{"mastodon": &recordingPublisher{}},
+		Store:       newMemStore(),
+		Notifier:    &recordingNotifier{},
+		Clock:       fixedClock{now: time.Date(2026, 3, 2, 12, 0, 0, 0, time.UTC)},
+	}
+	if err := RunOnce(context.Background(), conf, deps); err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	for b.Loop() {
+		if err := RunOnce(context.Background(), conf, deps); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
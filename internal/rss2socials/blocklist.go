@@ -0,0 +1,42 @@
+package rss2socials
+
+import (
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/toozej/rss2socials/internal/db"
+	"github.com/toozej/rss2socials/pkg/config"
+)
+
+// blockedBy returns the entry of the blocklist of site that content
+// matches. A blocklist that does not parse blocks everything, so that
+// nothing it should hold back goes out.
+func blockedBy(conf *config.Config, site, content string) (string, bool) {
+	rules, err := conf.SiteBlocklist(site)
+	if err != nil {
+		log.Errorf("Holding back every %s post: %v", siteNames[site], err)
+		return "an invalid blocklist", true
+	}
+	for _, rule := range rules {
+		if rule.Pattern.MatchString(content) {
+			return rule.Entry, true
+		}
+	}
+	return "", false
+}
+
+// skipBlocked skips publishing c to site because its content matches the
+// blocklist entry. The skip is recorded and notified when c is first seen
+// or updated, and not again when the post is checked in later cycles.
+func (d Deps) skipBlocked(conf *config.Config, site string, c candidate, entry string) {
+	post := c.post
+	if c.exists && !c.isUpdate {
+		log.Debugf("Skipping %s: %s still matches the blocklist entry %q", siteNames[site], post.Link, entry)
+		return
+	}
+	log.Warnf("Not posting %s to %s: it matches the blocklist entry %q", post.Link, siteNames[site], entry)
+	d.recordEvent(db.ActionSkippedBlocklist, site, post.Link, entry)
+	d.Notifier.LogFailure(conf, fmt.Sprintf("Blocked post to %s: %s", siteNames[site], post.Title), post.Link,
+		fmt.Errorf("the post matches the blocklist entry %q and was not published there", entry))
+}
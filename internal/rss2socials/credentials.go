@@ -0,0 +1,113 @@
+package rss2socials
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/toozej/rss2socials/internal/db"
+	"github.com/toozej/rss2socials/internal/neterr"
+	"github.com/toozej/rss2socials/internal/notify"
+	"github.com/toozej/rss2socials/pkg/config"
+)
+
+// checkCredentials checks the credentials of the enabled sites whose
+// publisher implements CredentialChecker every CredentialCheckDays, and
+// alerts when a site rejects them or they expire within
+// CredentialExpiryWarningDays, rather than when a post fails. A check that
+// fails for a network error is retried in the next cycle.
+func (r *runner) checkCredentials(ctx context.Context) {
+	conf := &r.conf
+	d := r.deps
+	if conf.CredentialCheckDays <= 0 {
+		return
+	}
+
+	now := d.Clock.Now()
+	for _, site := range conf.EnabledSites() {
+		checker, ok := d.Publishers[site].(CredentialChecker)
+		if !ok || !siteConfigured(conf, site) || !r.credentialCheckDue(site, now) {
+			continue
+		}
+		expires, err := checker.CheckCredentials(ctx, *conf)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil && neterr.KindOf(err) != "" {
+			log.Warnf("Could not check the %s credentials: %v", siteNames[site], neterr.Classify(err))
+			continue
+		}
+		r.credentialsChecked[site] = now
+
+		name := siteNames[site]
+		switch {
+		case err != nil:
+			log.Errorf("%s rejected the credentials: %v", name, err)
+			d.recordEvent(db.ActionCredentialsChecked, site, "", err.Error())
+			d.notifyEvent(conf, notify.Event{
+				Type:     notify.EventTokenExpiry,
+				Severity: notify.SeverityError,
+				Title:    fmt.Sprintf("%s credentials rejected", name),
+				Message:  fmt.Sprintf("%s no longer accepts the configured credentials, which may have been revoked; posts to %s fail until they are renewed: %v", name, name, err),
+			})
+		case !expires.IsZero() && !expires.After(now):
+			log.Errorf("The %s credentials expired on %s", name, expires.Format(time.DateOnly))
+			d.recordEvent(db.ActionCredentialsChecked, site, "", "expired on "+expires.Format(time.RFC3339))
+			d.notifyEvent(conf, notify.Event{
+				Type:     notify.EventTokenExpiry,
+				Severity: notify.SeverityError,
+				Title:    fmt.Sprintf("%s credentials expired", name),
+				Message:  fmt.Sprintf("The %s credentials expired on %s; posts to %s fail until they are renewed.", name, expires.Format(time.DateOnly), name),
+			})
+		case !expires.IsZero() && expires.Before(now.AddDate(0, 0, conf.CredentialExpiryWarningDays)):
+			days := int(expires.Sub(now).Hours() / 24)
+			log.Warnf("The %s credentials expire on %s, in %d days", name, expires.Format(time.DateOnly), days)
+			d.recordEvent(db.ActionCredentialsChecked, site, "", "expires on "+expires.Format(time.RFC3339))
+			d.notifyEvent(conf, notify.Event{
+				Type:     notify.EventTokenExpiry,
+				Severity: notify.SeverityWarning,
+				Title:    fmt.Sprintf("%s credentials expire soon", name),
+				Message:  fmt.Sprintf("The %s credentials expire on %s, in %d days; renew them before then to keep posting to %s.", name, expires.Format(time.DateOnly), days, name),
+			})
+		case expires.IsZero():
+			log.Infof("The %s credentials are valid", name)
+			d.recordEvent(db.ActionCredentialsChecked, site, "", "valid")
+		default:
+			log.Infof("The %s credentials are valid until %s", name, expires.Format(time.DateOnly))
+			d.recordEvent(db.ActionCredentialsChecked, site, "", "valid until "+expires.Format(time.RFC3339))
+		}
+	}
+}
+
+// credentialCheckDue reports whether the credentials of site were not
+// checked within CredentialCheckDays of now. The time of the last check is
+// read from the Store, if it is an EventTimeStore, the first time.
+func (r *runner) credentialCheckDue(site string, now time.Time) bool {
+	if r.credentialsChecked == nil {
+		r.credentialsChecked = make(map[string]time.Time)
+	}
+	last, ok := r.credentialsChecked[site]
+	if !ok {
+		if store, isStore := r.deps.Store.(EventTimeStore); isStore {
+			var err error
+			if last, err = store.LastEventTime(db.ActionCredentialsChecked, site); err != nil {
+				log.Errorf("Failed to load when the %s credentials were last checked: %v", siteNames[site], err)
+			}
+		}
+		r.credentialsChecked[site] = last
+	}
+	return last.IsZero() || !now.Before(last.AddDate(0, 0, r.conf.CredentialCheckDays))
+}
+
+// notifyEvent reports ev through the Notifier, as a failure when it is not
+// an EventNotifier.
+func (d Deps) notifyEvent(conf *config.Config, ev notify.Event) {
+	if n, ok := d.Notifier.(EventNotifier); ok {
+		n.Notify(conf, ev)
+		return
+	}
+	d.Notifier.LogFailure(conf, ev.Title, ev.URL, errors.New(ev.Message))
+}
@@ -0,0 +1,648 @@
+package rss2socials
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/toozej/rss2socials/internal/bluesky"
+	"github.com/toozej/rss2socials/internal/content"
+	"github.com/toozej/rss2socials/internal/db"
+	"github.com/toozej/rss2socials/internal/errreport"
+	"github.com/toozej/rss2socials/internal/ghactions"
+	"github.com/toozej/rss2socials/internal/mastodon"
+	"github.com/toozej/rss2socials/internal/metrics"
+	"github.com/toozej/rss2socials/internal/newsletter"
+	"github.com/toozej/rss2socials/internal/notify"
+	"github.com/toozej/rss2socials/internal/rss"
+	"github.com/toozej/rss2socials/internal/threads"
+	"github.com/toozej/rss2socials/pkg/config"
+)
+
+// FeedFetcher fetches and parses the items of an RSS feed.
+type FeedFetcher interface {
+	Fetch(ctx context.Context, feedURL string) ([]rss.RSSItem, error)
+}
+
+// FeedFetcherFunc adapts a function to the FeedFetcher interface.
+type FeedFetcherFunc func(ctx context.Context, feedURL string) ([]rss.RSSItem, error)
+
+// Fetch calls f(ctx, feedURL).
+func (f FeedFetcherFunc) Fetch(ctx context.Context, feedURL string) ([]rss.RSSItem, error) {
+	return f(ctx, feedURL)
+}
+
+// LinkChecker reports whether the page of a feed item is live, returning
+// an error describing why it is not.
+type LinkChecker interface {
+	CheckLink(ctx context.Context, conf config.Config, link string) error
+}
+
+// LinkCheckerFunc adapts a function to the LinkChecker interface.
+type LinkCheckerFunc func(ctx context.Context, conf config.Config, link string) error
+
+// CheckLink calls f(ctx, conf, link).
+func (f LinkCheckerFunc) CheckLink(ctx context.Context, conf config.Config, link string) error {
+	return f(ctx, conf, link)
+}
+
+// Publisher publishes posts to a single social site, rendering them as the
+// site supports, e.g. with the images of the item attached. Publish returns
+// the site's identifier for the created post, such as a Bluesky at:// URI,
+// or an empty string when the site does not need one stored.
+type Publisher interface {
+	Publish(ctx context.Context, conf config.Config, post Post) (string, error)
+}
+
+// PublisherFunc adapts a function to the Publisher interface.
+type PublisherFunc func(ctx context.Context, conf config.Config, post Post) (string, error)
+
+// Publish calls f(ctx, conf, post).
+func (f PublisherFunc) Publish(ctx context.Context, conf config.Config, post Post) (string, error) {
+	return f(ctx, conf, post)
+}
+
+// Updater is implemented by publishers that can publish an update in relation
+// to a post they published earlier, identified by the ID Publish returned,
+// for example by editing it or replying to it.
+type Updater interface {
+	Update(ctx context.Context, conf config.Config, id string, post Post) error
+}
+
+// Reposter is implemented by publishers that can boost or repost a post they
+// published earlier, identified by the ID Publish returned.
+type Reposter interface {
+	Repost(ctx context.Context, conf config.Config, id string) error
+}
+
+// Pinner is implemented by publishers that can pin a post they published
+// earlier to the profile, and unpin it, identified by the ID Publish
+// returned.
+type Pinner interface {
+	Pin(ctx context.Context, conf config.Config, id string) error
+	Unpin(ctx context.Context, conf config.Config, id string) error
+}
+
+// Scheduler is implemented by publishers whose site can publish a post at a
+// later time by itself. CanSchedule reports whether a post can be scheduled
+// for at when it is now; if not, the pipeline holds the post back and
+// publishes it in the first cycle after at instead.
+type Scheduler interface {
+	CanSchedule(conf config.Config, at, now time.Time) bool
+	Schedule(ctx context.Context, conf config.Config, post Post, at time.Time) error
+}
+
+// Verifier is implemented by publishers that check the site against the
+// configuration once at startup. Verify may adjust conf to what the site
+// reports, such as its post length limit. Errors are logged and do not stop
+// the pipeline.
+type Verifier interface {
+	Verify(ctx context.Context, conf *config.Config) error
+}
+
+// CredentialChecker is implemented by publishers that can check whether
+// the site still accepts their credentials. CheckCredentials returns when
+// the credentials expire, or the zero time when they do not or the site does
+// not tell.
+type CredentialChecker interface {
+	CheckCredentials(ctx context.Context, conf config.Config) (time.Time, error)
+}
+
+// AccountResolver is implemented by publishers that can look up the account
+// they publish as, which is shown in the settings summary at startup.
+type AccountResolver interface {
+	Account(ctx context.Context, conf config.Config) (string, error)
+}
+
+// Store persists which posts have been seen and published, along with the
+// audit trail of events. It mirrors the functions of the db package, and must
+// be safe for concurrent use by the stages of a cycle.
+type Store interface {
+	HasPostChanged(link, content string) (exists bool, updated bool, err error)
+	StoreTootedPost(link, content, startupTime string) error
+	IsSitePosted(link, site string) (bool, error)
+	MarkSitePosted(link, site string) error
+	IsFirstCycle() bool
+	UnpublishedPosts() ([]string, error)
+	RecordEvent(action, site, link, detail string) error
+	PruneEvents(before time.Time) (int64, error)
+}
+
+// RetryStore is implemented by Stores that keep the retry state of failed
+// publishes, so that retries back off and are given up on after
+// Config.RetryMaxAttempts. Retry returns a Retry with only the link and site
+// set when publishing link to site has not failed. With other Stores, a
+// failed publish is retried in every cycle.
+type RetryStore interface {
+	Retry(link, site string) (db.Retry, error)
+	SaveRetry(r db.Retry) error
+	ClearRetry(link, site string) error
+	PendingRetries() ([]db.Retry, error)
+}
+
+// PublishedAtStore is implemented by Stores that record the parsed pubDate
+// of stored posts, e.g. to find the latest post of a category for
+// Config.PreviousPost.
+type PublishedAtStore interface {
+	SetPublishedAt(link string, published time.Time) error
+}
+
+// PostIDStore is implemented by Stores that keep the identifiers of the posts
+// created on each site, which replies, edits, pins and re-promotion refer to.
+// SitePostID returns an empty string when no identifier is stored. With other
+// Stores, updates are published as new posts and series are not threaded.
+type PostIDStore interface {
+	SetSitePostID(link, site, id string) error
+	SitePostID(link, site string) (string, error)
+}
+
+// RepromoteStore is implemented by Stores that know which published posts
+// were re-promoted, for Config.RepromoteAfterDays. PostsToRepromote returns
+// the posts published before publishedBefore that were not re-promoted yet.
+// Re-promotion also needs a PostIDStore.
+type RepromoteStore interface {
+	PostsToRepromote(publishedBefore time.Time) ([]string, error)
+	MarkRepromoted(link string) error
+}
+
+// Locker is implemented by Stores that can hold a lock for replicas sharing
+// them. AcquireLock takes or renews the lock name for owner until ttl from
+// now and reports false while another owner holds it.
+type Locker interface {
+	AcquireLock(name, owner string, ttl time.Duration) (bool, error)
+	ReleaseLock(name, owner string) error
+}
+
+// PostCounter is implemented by Stores that can count the posts published
+// to at least one site, so that footers rotate across restarts.
+type PostCounter interface {
+	CountPublished() (int, error)
+}
+
+// VariantStore is implemented by Stores that record the template variant a
+// post was published with on each site, to compare variants later.
+type VariantStore interface {
+	SetSiteVariant(link, site, variant string) error
+}
+
+// FirstSeenStore is implemented by Stores that know when a post was first
+// stored, which starts the grace period of Config.LinkCheck.
+type FirstSeenStore interface {
+	FirstSeen(link string) (time.Time, error)
+}
+
+// LinkStore is implemented by Stores that remember the feed links of posts
+// stored under their canonical URL with Config.CanonicalLinks, so that the
+// pages of stored items are not fetched again to resolve them.
+type LinkStore interface {
+	StoredLink(feedLink string) (string, error)
+	SetFeedLink(link, feedLink string) error
+}
+
+// EnrichmentStore is implemented by Stores that cache the results of
+// lookups on the pages of feed items, keyed by the item's guid, for
+// Config.EnrichmentCacheHours. CachedEnrichment reports false when there is
+// no result fetched at or after since.
+type EnrichmentStore interface {
+	CachedEnrichment(guid, kind string, since time.Time) (string, bool, error)
+	SaveEnrichment(guid, kind, value string, fetched time.Time) error
+	PruneEnrichments(before time.Time) (int64, error)
+}
+
+// HighWaterStore is implemented by Stores that keep the high-water mark of
+// feeds, the latest pubDate of the items published from them, for
+// Config.ReplayProtection. HighWaterMark returns the zero time when no item
+// of the feed was published.
+type HighWaterStore interface {
+	HighWaterMark(feed string) (time.Time, error)
+	RaiseHighWaterMark(feed string, published time.Time) error
+}
+
+// CategoryStore is implemented by Stores that record the categories of
+// posts, to link new posts to the latest earlier post in one of their
+// categories with Config.PreviousPost. LatestInCategories reports false when
+// no other post in the categories was published.
+type CategoryStore interface {
+	SetCategories(link string, categories []string) error
+	LatestInCategories(categories []string, exclude string) (db.TootedPost, bool, error)
+}
+
+// SeriesStore is implemented by Stores that record the parts of series, to
+// publish them as replies to the previous part with Config.SeriesThreading.
+// PreviousPart reports false when no earlier part of the series is stored.
+type SeriesStore interface {
+	SetSeriesPart(link, series string, part int) error
+	PreviousPart(series string, part int) (string, bool, error)
+}
+
+// PinStore is implemented by Stores that record which Mastodon statuses
+// were pinned with Config.MastodonPinLatest, so that they are unpinned once
+// a newer post is pinned.
+type PinStore interface {
+	MastodonPinnedPosts() ([]string, error)
+	SetMastodonPinned(link string, pinned bool) error
+}
+
+// EventTimeStore is implemented by Stores that can tell when an action was
+// last recorded for a site, so that periodic checks such as those of
+// Config.CredentialCheckDays keep their pace across restarts. LastEventTime
+// returns the zero time when the action is not recorded.
+type EventTimeStore interface {
+	LastEventTime(action, site string) (time.Time, error)
+}
+
+// ContentStore is implemented by Stores that keep the content of stored
+// posts, so that update announcements can describe what changed.
+// StoredContent returns an empty string when the content is unknown.
+type ContentStore interface {
+	StoredContent(link string) (string, error)
+}
+
+// Notifier reports publish outcomes to the user. It must be safe for
+// concurrent use by the stages of a cycle.
+type Notifier interface {
+	LogFailure(conf *config.Config, title, postURL string, err error)
+	LogSuccess(conf *config.Config, message, postURL string)
+}
+
+// EventNotifier is implemented by Notifiers that also report events other
+// than publish outcomes, such as credentials about to expire. Other
+// Notifiers are given these events as failures.
+type EventNotifier interface {
+	Notify(conf *config.Config, ev notify.Event)
+}
+
+// Clock abstracts the passage of time. After should measure d on a monotonic
+// clock, as time.After does, so that waits are not cut short by changes of
+// the wall clock.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+// Deps holds the replaceable dependencies of the pipeline. Zero-valued fields
+// fall back to the production implementations.
+type Deps struct {
+	// FeedFetcher fetches the feed. Defaults to an rss.Fetcher with the
+	// redirect policy and minimum host interval of the Config, and
+	// rss.ParseFeed, which are timed in the metrics.
+	FeedFetcher FeedFetcher
+	// Publishers maps site names ("mastodon", "bluesky", "threads",
+	// "newsletter") to their publisher. Sites missing from the map use the built-in clients.
+	Publishers map[string]Publisher
+	// Store defaults to the SQLite database at Config.DBPath, which is then
+	// opened and closed by Run and RunOnce. A custom Store is used as is.
+	Store Store
+	// Notifier defaults to the notify package.
+	Notifier Notifier
+	// Clock is what the loop waits on and what check schedules, retry
+	// backoff and the times the built-in stores record are based on, so
+	// that tests can advance time rather than sleep. Defaults to the
+	// system clock.
+	Clock Clock
+	// LinkChecker checks the pages of new items with Config.LinkCheck.
+	// Defaults to content.CheckPage.
+	LinkChecker LinkChecker
+	// Events receives the event stream, a StreamEvent per line as JSON.
+	// Defaults to standard output with Config.EmitEvents, and to no stream
+	// otherwise. Writes are serialized, so it need not be safe for
+	// concurrent use.
+	Events io.Writer
+
+	stream *eventStream
+	// actions reports the events to GitHub Actions with
+	// Config.GitHubActions.
+	actions *ghactions.Reporter
+	// reporter reports errors and panics to Sentry with Config.SentryDSN.
+	reporter *errreport.Reporter
+	// fetcher fetches the feed for the default FeedFetcher, with the
+	// redirect policy and minimum host interval of the Config.
+	fetcher *rss.Fetcher
+	// content is how the built-in stores hash and keep the content of
+	// posts.
+	content db.Content
+	// loc is the time zone of the timestamps the built-in SQLite store
+	// writes, from Config.Timezone. Defaults to time.Local.
+	loc *time.Location
+}
+
+// recordingFeedFetcher fetches the feed like the default FeedFetcher and
+// saves every fetched document in dir. Failing to record is logged but does
+// not fail the fetch.
+func recordingFeedFetcher(dir string, clock Clock, fetcher *rss.Fetcher) FeedFetcher {
+	return FeedFetcherFunc(func(_ context.Context, feedURL string) ([]rss.RSSItem, error) {
+		data, err := fetchFeed(fetcher, feedURL)
+		if err != nil {
+			return nil, err
+		}
+		if path, err := rss.RecordFeed(dir, data, clock.Now()); err != nil {
+			log.Errorf("Error recording feed: %v", err)
+		} else {
+			log.Infof("Recorded feed to %s", path)
+		}
+		return parseFeed(data)
+	})
+}
+
+// fetchFeed fetches the feed document at feedURL with fetcher, timing the
+// fetch.
+func fetchFeed(fetcher *rss.Fetcher, feedURL string) ([]byte, error) {
+	start := time.Now()
+	defer func() { metrics.Observe(metrics.FeedFetch, "", time.Since(start)) }()
+	return fetcher.FetchFeed(feedURL)
+}
+
+// parseFeed parses the feed document data, timing the parse.
+func parseFeed(data []byte) ([]rss.RSSItem, error) {
+	start := time.Now()
+	defer func() { metrics.Observe(metrics.FeedParse, "", time.Since(start)) }()
+	return rss.ParseFeed(bytes.NewReader(data))
+}
+
+func (d Deps) withDefaults() Deps {
+	if d.fetcher == nil {
+		d.fetcher = rss.NewFetcher(rss.DefaultRedirectPolicy, 0)
+	}
+	if d.content.Hashing.Algorithm == "" {
+		d.content = db.DefaultContent
+	}
+	if d.FeedFetcher == nil {
+		fetcher := d.fetcher
+		d.FeedFetcher = FeedFetcherFunc(func(_ context.Context, feedURL string) ([]rss.RSSItem, error) {
+			data, err := fetchFeed(fetcher, feedURL)
+			if err != nil {
+				return nil, err
+			}
+			return parseFeed(data)
+		})
+	}
+
+	publishers := map[string]Publisher{
+		"mastodon":   mastodonPublisher{},
+		"bluesky":    blueskyPublisher{},
+		"threads":    threadsPublisher{},
+		"newsletter": newsletterPublisher{},
+	}
+	for site, p := range d.Publishers {
+		publishers[site] = p
+	}
+	d.Publishers = publishers
+
+	if d.Clock == nil {
+		d.Clock = systemClock{}
+	}
+	if d.loc == nil {
+		d.loc = time.Local
+	}
+	if d.Store == nil {
+		d.Store = dbStore{clock: d.Clock, content: d.content, loc: d.loc}
+	}
+	if d.Notifier == nil {
+		d.Notifier = notifier{}
+	}
+	if d.LinkChecker == nil {
+		d.LinkChecker = LinkCheckerFunc(func(ctx context.Context, conf config.Config, link string) error {
+			return content.CheckPage(ctx, link, conf.LinkCheckSoft404)
+		})
+	}
+	if d.Events != nil && d.stream == nil {
+		d.stream = newEventStream(d.Events)
+	}
+	return d
+}
+
+// mastodonPublisher publishes toots and edits them in place. Images are
+// only attached for flavors that require media, such as Pixelfed.
+type mastodonPublisher struct{}
+
+func (mastodonPublisher) Publish(ctx context.Context, conf config.Config, post Post) (string, error) {
+	if !mastodon.FlavorOf(conf).RequiresMedia || len(post.Images) == 0 {
+		return mastodon.Publish(conf, post.Text, mastodonOptions(post))
+	}
+	return mastodon.PublishWithImages(ctx, conf, post.Text, mastodonOptions(post), post.Images)
+}
+
+// mastodonOptions returns the options of the status of post.
+func mastodonOptions(post Post) mastodon.Options {
+	return mastodon.Options{ContentWarning: post.ContentWarning, InReplyTo: post.InReplyTo}
+}
+
+func (mastodonPublisher) CanSchedule(conf config.Config, at, now time.Time) bool {
+	return mastodon.CanSchedule(conf, at, now)
+}
+
+func (mastodonPublisher) Schedule(ctx context.Context, conf config.Config, post Post, at time.Time) error {
+	return mastodon.Schedule(ctx, conf, post.Text, mastodonOptions(post), at)
+}
+
+func (mastodonPublisher) Verify(ctx context.Context, conf *config.Config) error {
+	return mastodon.Verify(ctx, conf)
+}
+
+func (mastodonPublisher) CheckCredentials(ctx context.Context, conf config.Config) (time.Time, error) {
+	return time.Time{}, mastodon.CheckCredentials(ctx, conf)
+}
+
+func (mastodonPublisher) Account(ctx context.Context, conf config.Config) (string, error) {
+	return mastodon.Account(ctx, conf)
+}
+
+func (mastodonPublisher) Update(_ context.Context, conf config.Config, id string, post Post) error {
+	return mastodon.EditPost(conf, id, post.Text, post.ContentWarning)
+}
+
+func (mastodonPublisher) Repost(_ context.Context, conf config.Config, id string) error {
+	return mastodon.Boost(conf, id)
+}
+
+func (mastodonPublisher) Pin(ctx context.Context, conf config.Config, id string) error {
+	return mastodon.Pin(ctx, conf, id)
+}
+
+func (mastodonPublisher) Unpin(ctx context.Context, conf config.Config, id string) error {
+	return mastodon.Unpin(ctx, conf, id)
+}
+
+// blueskyPublisher publishes Bluesky posts, with up to
+// Config.BlueskyImages images attached, and reposts them.
+type blueskyPublisher struct{}
+
+func (blueskyPublisher) Publish(ctx context.Context, conf config.Config, post Post) (string, error) {
+	n := max(min(conf.BlueskyImages, bluesky.MaxImages, len(post.Images)), 0)
+	if n == 0 {
+		return bluesky.Publish(ctx, conf, post.Text, blueskyOptions(post))
+	}
+	return bluesky.PublishWithImages(ctx, conf, post.Text, blueskyOptions(post), post.Images[:n])
+}
+
+// blueskyOptions returns the options of the Bluesky post of post.
+func blueskyOptions(post Post) bluesky.Options {
+	return bluesky.Options{Labels: post.Labels, Quote: post.Quote, ReplyTo: post.InReplyTo}
+}
+
+func (blueskyPublisher) Repost(ctx context.Context, conf config.Config, uri string) error {
+	return bluesky.Repost(ctx, conf, uri)
+}
+
+func (blueskyPublisher) CheckCredentials(ctx context.Context, conf config.Config) (time.Time, error) {
+	return time.Time{}, bluesky.CheckCredentials(ctx, conf)
+}
+
+func (blueskyPublisher) Account(ctx context.Context, conf config.Config) (string, error) {
+	return bluesky.Account(ctx, conf)
+}
+
+// threadsPublisher publishes Threads posts and replies to or quotes them
+// according to Config.ThreadsUpdateMode.
+type threadsPublisher struct{}
+
+func (threadsPublisher) Publish(ctx context.Context, conf config.Config, post Post) (string, error) {
+	return threads.Publish(ctx, conf, post.Text)
+}
+
+func (threadsPublisher) CheckCredentials(ctx context.Context, conf config.Config) (time.Time, error) {
+	return threads.CheckCredentials(ctx, conf)
+}
+
+func (threadsPublisher) Account(ctx context.Context, conf config.Config) (string, error) {
+	return threads.Account(ctx, conf)
+}
+
+func (threadsPublisher) Update(ctx context.Context, conf config.Config, id string, post Post) error {
+	if conf.ThreadsUpdateMode == config.ThreadsUpdateQuote {
+		return threads.Quote(ctx, conf, id, post.Text)
+	}
+	return threads.Reply(ctx, conf, id, post.Text)
+}
+
+// newsletterPublisher emails new posts through Config.NewsletterProvider,
+// rendered from the feed item as HTML.
+type newsletterPublisher struct{}
+
+func (newsletterPublisher) Publish(ctx context.Context, conf config.Config, post Post) (string, error) {
+	return newsletter.Send(ctx, conf, post.Item, post.Text)
+}
+
+// dbStore is the Store backed by the db package. The times it records come
+// from clock and are written in the time zone loc, and content is hashed and
+// kept as content says.
+type dbStore struct {
+	clock   Clock
+	content db.Content
+	loc     *time.Location
+}
+
+func (s dbStore) HasPostChanged(link, content string) (bool, bool, error) {
+	return db.HasPostChanged(link, content, s.content.Hashing)
+}
+
+func (s dbStore) StoreTootedPost(link, content, startupTime string) error {
+	return db.StoreTootedPost(link, content, startupTime, s.clock.Now(), s.content, s.loc)
+}
+
+func (dbStore) StoredContent(link string) (string, error)  { return db.StoredContent(link) }
+func (dbStore) CountPublished() (int, error)               { return db.CountPublished() }
+func (dbStore) FirstSeen(link string) (time.Time, error)   { return db.FirstSeen(link) }
+func (dbStore) StoredLink(feedLink string) (string, error) { return db.StoredLink(feedLink) }
+func (dbStore) SetFeedLink(link, feedLink string) error    { return db.SetFeedLink(link, feedLink) }
+func (dbStore) MastodonPinnedPosts() ([]string, error)     { return db.MastodonPinnedPosts() }
+func (dbStore) SetMastodonPinned(link string, pinned bool) error {
+	return db.SetMastodonPinned(link, pinned)
+}
+
+func (dbStore) IsSitePosted(link, site string) (bool, error) { return db.IsSitePosted(link, site) }
+func (s dbStore) MarkSitePosted(link, site string) error {
+	return db.MarkSitePosted(link, site, s.clock.Now(), s.loc)
+}
+func (s dbStore) SetPublishedAt(link string, published time.Time) error {
+	return db.SetPublishedAt(link, published, s.loc)
+}
+
+func (dbStore) SetSitePostID(link, site, id string) error { return db.SetSitePostID(link, site, id) }
+func (dbStore) SetSiteVariant(link, site, variant string) error {
+	return db.SetSiteVariant(link, site, variant)
+}
+func (dbStore) SitePostID(link, site string) (string, error) { return db.SitePostID(link, site) }
+func (dbStore) IsFirstCycle() bool                           { return db.IsFirstCycle() }
+func (dbStore) UnpublishedPosts() ([]string, error)          { return db.UnpublishedPosts() }
+func (dbStore) MarkRepromoted(link string) error             { return db.MarkRepromoted(link) }
+
+func (dbStore) PostsToRepromote(publishedBefore time.Time) ([]string, error) {
+	return db.PostsToRepromote(publishedBefore)
+}
+
+func (s dbStore) RecordEvent(action, site, link, detail string) error {
+	return db.RecordEvent(action, site, link, detail, s.clock.Now(), s.loc)
+}
+
+func (dbStore) Retry(link, site string) (db.Retry, error)   { return db.GetRetry(link, site) }
+func (s dbStore) SaveRetry(r db.Retry) error                { return db.SaveRetry(r, s.loc) }
+func (dbStore) ClearRetry(link, site string) error          { return db.ClearRetry(link, site) }
+func (dbStore) PendingRetries() ([]db.Retry, error)         { return db.PendingRetries() }
+func (dbStore) PruneEvents(before time.Time) (int64, error) { return db.PruneEvents(before) }
+
+func (dbStore) CachedEnrichment(guid, kind string, since time.Time) (string, bool, error) {
+	return db.CachedEnrichment(guid, kind, since)
+}
+
+func (s dbStore) SaveEnrichment(guid, kind, value string, fetched time.Time) error {
+	return db.SaveEnrichment(guid, kind, value, fetched, s.loc)
+}
+
+func (dbStore) PruneEnrichments(before time.Time) (int64, error) {
+	return db.PruneEnrichments(before)
+}
+
+func (dbStore) HighWaterMark(feed string) (time.Time, error) { return db.HighWaterMark(feed) }
+
+func (s dbStore) RaiseHighWaterMark(feed string, published time.Time) error {
+	return db.RaiseHighWaterMark(feed, published, s.loc)
+}
+
+func (dbStore) SetCategories(link string, categories []string) error {
+	return db.SetCategories(link, categories)
+}
+
+func (dbStore) LatestInCategories(categories []string, exclude string) (db.TootedPost, bool, error) {
+	return db.LatestInCategories(categories, exclude)
+}
+
+func (dbStore) SetSeriesPart(link, series string, part int) error {
+	return db.SetSeriesPart(link, series, part)
+}
+
+func (dbStore) PreviousPart(series string, part int) (string, bool, error) {
+	return db.PreviousPart(series, part)
+}
+
+func (dbStore) LastEventTime(action, site string) (time.Time, error) {
+	return db.LastEventTime(action, site)
+}
+
+func (dbStore) AcquireLock(name, owner string, ttl time.Duration) (bool, error) {
+	return db.AcquireLock(name, owner, ttl)
+}
+func (dbStore) ReleaseLock(name, owner string) error { return db.ReleaseLock(name, owner) }
+
+// notifier is the Notifier backed by the notify package.
+type notifier struct{}
+
+func (notifier) LogFailure(conf *config.Config, title, postURL string, err error) {
+	notify.LogFailure(conf, title, postURL, err)
+}
+
+func (notifier) LogSuccess(conf *config.Config, message, postURL string) {
+	notify.LogSuccess(conf, message, postURL)
+}
+
+func (notifier) Notify(conf *config.Config, ev notify.Event) {
+	notify.Send(conf, ev)
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time                         { return time.Now() }
+func (systemClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
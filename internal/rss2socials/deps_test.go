@@ -0,0 +1,2593 @@
+package rss2socials
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/toozej/rss2socials/internal/db"
+	"github.com/toozej/rss2socials/internal/ghactions"
+	"github.com/toozej/rss2socials/internal/metrics"
+	"github.com/toozej/rss2socials/internal/notify"
+	"github.com/toozej/rss2socials/internal/posttemplate"
+	"github.com/toozej/rss2socials/internal/redact"
+	"github.com/toozej/rss2socials/internal/redisstore"
+	"github.com/toozej/rss2socials/internal/rss"
+	"github.com/toozej/rss2socials/internal/testutil"
+	"github.com/toozej/rss2socials/pkg/config"
+)
+
+// memStore is an in-memory Store. Posts are stored at time now.
+type memStore struct {
+	mu         sync.Mutex
+	now        time.Time
+	hashes     map[string]string
+	storedAt   map[string]time.Time
+	posted     map[string]map[string]bool
+	ids        map[string]map[string]string
+	repromoted map[string]bool
+	retries    map[string]db.Retry
+	events     []db.Event
+}
+
+func newMemStore() *memStore {
+	return &memStore{
+		hashes:     make(map[string]string),
+		storedAt:   make(map[string]time.Time),
+		posted:     make(map[string]map[string]bool),
+		ids:        make(map[string]map[string]string),
+		repromoted: make(map[string]bool),
+		retries:    make(map[string]db.Retry),
+	}
+}
+
+func (s *memStore) HasPostChanged(link, content string) (bool, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	hash, ok := s.hashes[link]
+	if !ok {
+		return false, false, nil
+	}
+	return true, hash != content, nil
+}
+
+func (s *memStore) StoreTootedPost(link, content, _ string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hashes[link] = content
+	s.storedAt[link] = s.now
+	if s.posted[link] == nil {
+		s.posted[link] = make(map[string]bool)
+	}
+	return nil
+}
+
+func (s *memStore) IsSitePosted(link, site string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.posted[link][site], nil
+}
+
+func (s *memStore) MarkSitePosted(link, site string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.posted[link] == nil {
+		return errors.New("no post found with link: " + link)
+	}
+	s.posted[link][site] = true
+	return nil
+}
+
+func (s *memStore) SetPublishedAt(string, time.Time) error { return nil }
+
+func (s *memStore) SetSitePostID(link, site, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ids[link] == nil {
+		s.ids[link] = make(map[string]string)
+	}
+	s.ids[link][site] = id
+	return nil
+}
+
+func (s *memStore) SitePostID(link, site string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ids[link][site], nil
+}
+
+func (s *memStore) IsFirstCycle() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.hashes) == 0
+}
+
+func (s *memStore) UnpublishedPosts() ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	handled := make(map[string]bool)
+	for _, ev := range s.events {
+		if ev.Action != db.ActionFetched {
+			handled[ev.Link] = true
+		}
+	}
+	for _, r := range s.retries {
+		handled[r.Link] = true
+	}
+	var links []string
+	for link, sites := range s.posted {
+		if len(sites) == 0 && !handled[link] {
+			links = append(links, link)
+		}
+	}
+	return links, nil
+}
+
+func (s *memStore) PostsToRepromote(publishedBefore time.Time) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var links []string
+	for link, ids := range s.ids {
+		if len(ids) > 0 && !s.repromoted[link] && !s.storedAt[link].After(publishedBefore) {
+			links = append(links, link)
+		}
+	}
+	return links, nil
+}
+
+func (s *memStore) MarkRepromoted(link string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.repromoted[link] = true
+	return nil
+}
+
+func (s *memStore) RecordEvent(action, site, link, detail string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, db.Event{Action: action, Site: site, Link: link, Detail: detail})
+	return nil
+}
+
+func (s *memStore) Retry(link, site string) (db.Retry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if r, ok := s.retries[link+" "+site]; ok {
+		return r, nil
+	}
+	return db.Retry{Link: link, Site: site}, nil
+}
+
+func (s *memStore) SaveRetry(r db.Retry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.retries[r.Link+" "+r.Site] = r
+	return nil
+}
+
+func (s *memStore) ClearRetry(link, site string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.retries, link+" "+site)
+	return nil
+}
+
+func (s *memStore) PendingRetries() ([]db.Retry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var retries []db.Retry
+	for _, r := range s.retries {
+		if !r.Dead {
+			retries = append(retries, r)
+		}
+	}
+	return retries, nil
+}
+
+func (s *memStore) PruneEvents(time.Time) (int64, error) { return 0, nil }
+
+// bareStore hides the optional interfaces of the Store it wraps.
+type bareStore struct{ Store }
+
+// recordingPublisher records published posts and fails while err is set.
+type recordingPublisher struct {
+	mu       sync.Mutex
+	err      error
+	contents []string
+	posts    []Post
+}
+
+func (p *recordingPublisher) Publish(_ context.Context, _ config.Config, post Post) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.err != nil {
+		return "", p.err
+	}
+	p.contents = append(p.contents, post.Text)
+	p.posts = append(p.posts, post)
+	return fmt.Sprintf("id-%d", len(p.contents)), nil
+}
+
+// recordingReposter is a recordingPublisher that also records reposted IDs.
+type recordingReposter struct {
+	recordingPublisher
+	reposts []string
+}
+
+func (p *recordingReposter) Repost(_ context.Context, _ config.Config, id string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.reposts = append(p.reposts, id)
+	return nil
+}
+
+// verifyingPublisher is a recordingPublisher that sets the Mastodon status
+// length limit when verified, like an instance reporting its own limit.
+type verifyingPublisher struct {
+	recordingPublisher
+	maxChars int
+}
+
+func (p *verifyingPublisher) Verify(_ context.Context, conf *config.Config) error {
+	conf.MastodonMaxChars = p.maxChars
+	return nil
+}
+
+// schedulingPublisher is a recordingPublisher that records the times posts
+// are scheduled for, allowing any time at least minLead ahead.
+type schedulingPublisher struct {
+	recordingPublisher
+	minLead   time.Duration
+	scheduled []time.Time
+}
+
+func (p *schedulingPublisher) CanSchedule(_ config.Config, at, now time.Time) bool {
+	return at.Sub(now) >= p.minLead
+}
+
+func (p *schedulingPublisher) Schedule(_ context.Context, _ config.Config, _ Post, at time.Time) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.scheduled = append(p.scheduled, at)
+	return nil
+}
+
+// recordingNotifier records failure titles and errors and success messages.
+type recordingNotifier struct {
+	mu        sync.Mutex
+	failures  []string
+	errs      []string
+	successes []string
+}
+
+func (n *recordingNotifier) LogFailure(_ *config.Config, title, _ string, err error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.failures = append(n.failures, title)
+	n.errs = append(n.errs, err.Error())
+}
+
+func (n *recordingNotifier) LogSuccess(_ *config.Config, message, _ string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.successes = append(n.successes, message)
+}
+
+type fixedClock struct{ now time.Time }
+
+func (c fixedClock) Now() time.Time { return c.now }
+func (c fixedClock) After(time.Duration) <-chan time.Time {
+	ch := make(chan time.Time, 1)
+	ch <- c.now
+	return ch
+}
+
+func staticFeed(items ...rss.RSSItem) FeedFetcher {
+	return FeedFetcherFunc(func(context.Context, string) ([]rss.RSSItem, error) {
+		return items, nil
+	})
+}
+
+func TestRunOnce_WithInjectedDeps(t *testing.T) {
+	store := newMemStore()
+	masto := &recordingPublisher{}
+	bsky := &recordingPublisher{err: errors.New("bluesky down")}
+	notifier := &recordingNotifier{}
+
+	conf := config.Config{
+		FeedURL:       "memory://feed",
+		SocialSites:   []string{"mastodon", "bluesky"},
+		BlueskyHandle: "test.bsky.social",
+		BlueskyAppKey: "app-key",
+	}
+	deps := Deps{
+		FeedFetcher: staticFeed(rss.RSSItem{Title: "Hello", Link: "https://example.com/hello"}),
+		Publishers:  map[string]Publisher{"mastodon": masto, "bluesky": bsky},
+		Store:       store,
+		Notifier:    notifier,
+		Clock:       fixedClock{now: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}
+
+	require.NoError(t, RunOnce(context.Background(), conf, deps))
+
+	assert.Equal(t, []string{"New post: https://example.com/hello"}, masto.contents)
+	assert.Empty(t, bsky.contents)
+	assert.Empty(t, notifier.successes, "a partial failure is reported in a single notification")
+	assert.Equal(t, []string{"Failed to post to Bluesky: Hello"}, notifier.failures)
+	assert.Equal(t, []string{"Mastodon: published\nBluesky: failed: bluesky down"}, notifier.errs)
+
+	posted, _ := store.IsSitePosted("https://example.com/hello", "mastodon")
+	assert.True(t, posted)
+	id, _ := store.SitePostID("https://example.com/hello", "mastodon")
+	assert.Equal(t, "id-1", id, "the ID returned by the publisher is stored")
+	posted, _ = store.IsSitePosted("https://example.com/hello", "bluesky")
+	assert.False(t, posted)
+
+	var labels []string
+	for _, ev := range store.events {
+		labels = append(labels, ev.Label())
+	}
+	assert.Equal(t, []string{"fetched", "published-mastodon", "failed-bluesky"}, labels)
+
+	// Only the failed site is retried on the next cycle.
+	bsky.err = nil
+	require.NoError(t, RunOnce(context.Background(), conf, deps))
+	assert.Len(t, masto.contents, 1)
+	assert.Equal(t, []string{"New post: https://example.com/hello"}, bsky.contents)
+}
+
+func TestRunOnce_ClockSetsStartupTime(t *testing.T) {
+	store := newMemStore()
+	masto := &recordingPublisher{}
+	now := time.Date(2026, 1, 2, 12, 0, 0, 0, time.UTC)
+
+	conf := config.Config{FeedURL: "memory://feed", SocialSites: []string{"mastodon"}, PostNewEntriesOnly: true, Timezone: "UTC"}
+	deps := Deps{
+		FeedFetcher: staticFeed(
+			rss.RSSItem{Title: "Old", Link: "https://example.com/old", PubDate: now.Add(-time.Hour).Format(time.RFC1123Z)},
+			rss.RSSItem{Title: "New", Link: "https://example.com/new", PubDate: now.Add(time.Hour).Format(time.RFC1123Z)},
+		),
+		Publishers: map[string]Publisher{"mastodon": masto},
+		Store:      store,
+		Notifier:   &recordingNotifier{},
+		Clock:      fixedClock{now: now},
+	}
+
+	require.NoError(t, RunOnce(context.Background(), conf, deps))
+	assert.Equal(t, []string{"New post: https://example.com/new"}, masto.contents)
+}
+
+func TestWithDefaults_KeepsBuiltinPublishersForMissingSites(t *testing.T) {
+	custom := &recordingPublisher{}
+	publishers := map[string]Publisher{"mastodon": custom}
+	d := Deps{Publishers: publishers}.withDefaults()
+
+	assert.Same(t, custom, d.Publishers["mastodon"])
+	assert.Contains(t, d.Publishers, "bluesky")
+	assert.Contains(t, d.Publishers, "threads")
+	assert.NotNil(t, d.FeedFetcher)
+	assert.IsType(t, dbStore{}, d.Store)
+	assert.IsType(t, notifier{}, d.Notifier)
+	assert.IsType(t, systemClock{}, d.Clock)
+	assert.Len(t, publishers, 1, "withDefaults must not mutate the caller's map")
+}
+
+func TestNewRunner_KeepsSettingsPerRunner(t *testing.T) {
+	tuned, err := newRunner(config.Config{
+		FeedURL:                "memory://tuned",
+		Interval:               60,
+		HashAlgorithm:          rss.HashFNV,
+		FeedMinIntervalSeconds: 60,
+		SentryDSN:              "https://key@sentry.example.com/42",
+		Timezone:               "Asia/Tokyo",
+	}, Deps{})
+	require.NoError(t, err)
+	plain, err := newRunner(config.Config{FeedURL: "memory://plain", Interval: 60, StoreContent: true}, Deps{})
+	require.NoError(t, err)
+
+	assert.Equal(t, db.Content{Hashing: rss.Hashing{Algorithm: rss.HashFNV}}, tuned.deps.Store.(dbStore).content)
+	assert.Equal(t, db.Content{Hashing: rss.Hashing{Algorithm: rss.HashSHA256}, Snapshots: true}, plain.deps.Store.(dbStore).content)
+	assert.NotSame(t, tuned.deps.fetcher, plain.deps.fetcher)
+	assert.True(t, tuned.deps.reporter.Enabled())
+	assert.False(t, plain.deps.reporter.Enabled(), "a runner without a DSN reports nothing")
+	assert.Equal(t, "Asia/Tokyo", tuned.deps.Store.(dbStore).loc.String())
+	assert.Equal(t, time.Local, plain.deps.Store.(dbStore).loc)
+}
+
+func TestRunOnce_RepromotesOnceAfterConfiguredDays(t *testing.T) {
+	store := newMemStore()
+	masto := &recordingReposter{}
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	store.now = start
+
+	conf := config.Config{
+		FeedURL:             "memory://feed",
+		SocialSites:         []string{"mastodon"},
+		RepromoteAfterDays:  2,
+		RepromoteCategories: []string{"blog"},
+	}
+	deps := Deps{
+		FeedFetcher: staticFeed(
+			rss.RSSItem{Title: "Blog post", Link: "https://example.com/blog-post"},
+			rss.RSSItem{Title: "Note", Link: "https://example.com/note"},
+		),
+		Publishers: map[string]Publisher{"mastodon": masto},
+		Store:      store,
+		Notifier:   &recordingNotifier{},
+	}
+
+	deps.Clock = fixedClock{now: start}
+	require.NoError(t, RunOnce(context.Background(), conf, deps))
+	require.Len(t, masto.contents, 2)
+	assert.Empty(t, masto.reposts)
+
+	deps.Clock = fixedClock{now: start.AddDate(0, 0, 1)}
+	require.NoError(t, RunOnce(context.Background(), conf, deps))
+	assert.Empty(t, masto.reposts, "posts are not re-promoted before RepromoteAfterDays")
+
+	deps.Clock = fixedClock{now: start.AddDate(0, 0, 2)}
+	require.NoError(t, RunOnce(context.Background(), conf, deps))
+	assert.Equal(t, []string{"id-1"}, masto.reposts, "only posts matching RepromoteCategories are re-promoted")
+
+	deps.Clock = fixedClock{now: start.AddDate(0, 0, 3)}
+	require.NoError(t, RunOnce(context.Background(), conf, deps))
+	assert.Len(t, masto.reposts, 1, "posts are re-promoted only once")
+}
+
+func TestNewRunner_DisablesRepromotionWithoutRepromoteStore(t *testing.T) {
+	conf := config.Config{FeedURL: "memory://feed", Interval: 60, RepromoteAfterDays: 2}
+
+	r, err := newRunner(conf, Deps{Store: newMemStore()})
+	require.NoError(t, err)
+	assert.Equal(t, 2, r.conf.RepromoteAfterDays)
+
+	r, err = newRunner(conf, Deps{Store: bareStore{newMemStore()}})
+	require.NoError(t, err)
+	assert.Zero(t, r.conf.RepromoteAfterDays, "a Store that cannot re-promote turns re-promotion off")
+}
+
+func TestRunOnce_TruncatesPerNetworkLimits(t *testing.T) {
+	masto := &recordingPublisher{}
+	bsky := &recordingPublisher{}
+	link := "https://example.com/" + strings.Repeat("a", 600)
+
+	conf := config.Config{
+		FeedURL:       "memory://feed",
+		SocialSites:   []string{"mastodon", "bluesky"},
+		BlueskyHandle: "test.bsky.social",
+		BlueskyAppKey: "app-key",
+	}
+	deps := Deps{
+		FeedFetcher: staticFeed(rss.RSSItem{Title: "Long", Link: link}),
+		Publishers:  map[string]Publisher{"mastodon": masto, "bluesky": bsky},
+		Store:       newMemStore(),
+		Notifier:    &recordingNotifier{},
+		Clock:       fixedClock{now: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}
+
+	require.NoError(t, RunOnce(context.Background(), conf, deps))
+	assert.Equal(t, []string{"New post: " + link}, masto.contents, "Mastodon counts the link as 23 characters")
+	assert.Equal(t, []string{"New post:…"}, bsky.contents, "the link does not fit within Bluesky's limit")
+}
+
+func TestRunOnce_PassesItemImagesToPublishers(t *testing.T) {
+	masto := &recordingPublisher{}
+	bsky := &recordingPublisher{}
+
+	conf := config.Config{
+		FeedURL:       "memory://feed",
+		SocialSites:   []string{"mastodon", "bluesky"},
+		BlueskyHandle: "test.bsky.social",
+		BlueskyAppKey: "app-key",
+		BlueskyImages: 1,
+	}
+	deps := Deps{
+		FeedFetcher: staticFeed(
+			rss.RSSItem{Title: "Pictures", Link: "https://example.com/pictures", Content: `<img src="/a.png" alt="A"><img src="/b.png">`},
+			rss.RSSItem{Title: "Text", Link: "https://example.com/text", Content: "<p>No images</p>"},
+		),
+		Publishers: map[string]Publisher{"mastodon": masto, "bluesky": bsky},
+		Store:      newMemStore(),
+		Notifier:   &recordingNotifier{},
+		Clock:      fixedClock{now: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}
+
+	require.NoError(t, RunOnce(context.Background(), conf, deps))
+	assert.Len(t, masto.contents, 2)
+	require.Len(t, bsky.posts, 2)
+	images := map[string][]rss.Image{}
+	for _, post := range bsky.posts {
+		images[post.Link] = post.Images
+	}
+	assert.Equal(t, map[string][]rss.Image{
+		"https://example.com/pictures": {
+			{URL: "https://example.com/a.png", Alt: "A"},
+			{URL: "https://example.com/b.png"},
+		},
+		"https://example.com/text": nil,
+	}, images)
+}
+
+func TestRunOnce_PassesStructuredPosts(t *testing.T) {
+	masto := &recordingPublisher{}
+
+	conf := config.Config{
+		FeedURL:      "memory://feed",
+		SocialSites:  []string{"mastodon"},
+		PostTemplate: "{{.Title}} {{.Link}}",
+		Locale:       "de_AT.UTF-8",
+	}
+	item := rss.RSSItem{
+		Title:      "Hello",
+		Link:       "https://example.com/hello",
+		Content:    "<p>Hello <b>world</b></p>",
+		Categories: []string{"go", "rss"},
+	}
+	deps := Deps{
+		FeedFetcher: staticFeed(item),
+		Publishers:  map[string]Publisher{"mastodon": masto},
+		Store:       newMemStore(),
+		Notifier:    &recordingNotifier{},
+		Clock:       fixedClock{now: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}
+
+	require.NoError(t, RunOnce(context.Background(), conf, deps))
+	require.Len(t, masto.posts, 1)
+	post := masto.posts[0]
+	assert.Equal(t, "Hello https://example.com/hello", post.Text)
+	assert.Equal(t, "Hello", post.Title)
+	assert.Equal(t, "https://example.com/hello", post.Link)
+	assert.Equal(t, "Hello world", post.Summary)
+	assert.Equal(t, []string{"go", "rss"}, post.Tags)
+	assert.Equal(t, "de", post.Language)
+	assert.False(t, post.IsUpdate)
+	assert.Empty(t, post.ContentWarning)
+	assert.Empty(t, post.Labels)
+	assert.Equal(t, item.Title, post.Item.Title)
+}
+
+func TestRunOnce_SensitivePosts(t *testing.T) {
+	masto := &recordingPublisher{}
+
+	conf := config.Config{
+		FeedURL:         "memory://feed",
+		SocialSites:     []string{"mastodon"},
+		Locale:          "de",
+		SensitiveLabels: map[string]string{"nsfw": "sexual", "adult": "porn", "spoilers": ""},
+	}
+	rated := rss.Extensions{"media": {"rating": {{Name: "rating", Value: "adult"}}}}
+	deps := Deps{
+		FeedFetcher: staticFeed(
+			rss.RSSItem{Title: "Tagged", Link: "https://example.com/tagged", Categories: []string{" NSFW "}},
+			rss.RSSItem{Title: "Rated", Link: "https://example.com/rated", Categories: []string{"nsfw"}, Extensions: rated},
+			rss.RSSItem{Title: "Spoilers", Link: "https://example.com/spoilers", Categories: []string{"Spoilers"}},
+			rss.RSSItem{Title: "Plain", Link: "https://example.com/plain", Categories: []string{"go"}},
+		),
+		Publishers: map[string]Publisher{"mastodon": masto},
+		Store:      newMemStore(),
+		Notifier:   &recordingNotifier{},
+		Clock:      fixedClock{now: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}
+
+	require.NoError(t, RunOnce(context.Background(), conf, deps))
+	require.Len(t, masto.posts, 4)
+	assert.Equal(t, "Sensibler Inhalt", masto.posts[0].ContentWarning)
+	assert.Equal(t, []string{"sexual"}, masto.posts[0].Labels)
+	assert.Equal(t, []string{"porn", "sexual"}, masto.posts[1].Labels, "ratings and categories are combined")
+	assert.Equal(t, "Sensibler Inhalt", masto.posts[2].ContentWarning, "items can be sensitive without a self-label")
+	assert.Empty(t, masto.posts[2].Labels)
+	assert.Empty(t, masto.posts[3].ContentWarning)
+	assert.Empty(t, masto.posts[3].Labels)
+}
+
+// categoryStore is a memStore that records the categories of posts.
+type categoryStore struct {
+	*memStore
+	categories map[string][]string
+	order      []string
+}
+
+func (s *categoryStore) SetCategories(link string, categories []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.categories[link] = categories
+	s.order = append(s.order, link)
+	return nil
+}
+
+func (s *categoryStore) LatestInCategories(categories []string, exclude string) (db.TootedPost, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, link := range slices.Backward(s.order) {
+		if link == exclude || len(s.posted[link]) == 0 {
+			continue
+		}
+		for _, category := range s.categories[link] {
+			if slices.ContainsFunc(categories, func(c string) bool { return strings.EqualFold(c, category) }) {
+				return db.TootedPost{Link: link, BlueskyURI: s.ids[link]["bluesky"]}, true, nil
+			}
+		}
+	}
+	return db.TootedPost{}, false, nil
+}
+
+func TestRunOnce_PreviousPost(t *testing.T) {
+	masto := &recordingPublisher{}
+	bsky := &recordingPublisher{}
+	store := &categoryStore{memStore: newMemStore(), categories: map[string][]string{}}
+	conf := config.Config{
+		FeedURL:       "memory://feed",
+		SocialSites:   []string{"mastodon", "bluesky"},
+		BlueskyHandle: "me.example.com",
+		BlueskyAppKey: "app-key",
+		Locale:        "de",
+		PreviousPost:  config.PreviousPostQuote,
+	}
+	deps := Deps{
+		FeedFetcher: staticFeed(
+			rss.RSSItem{Title: "Go 1", Link: "https://example.com/go-1", Categories: []string{"Go"}},
+			rss.RSSItem{Title: "Rust", Link: "https://example.com/rust", Categories: []string{"rust"}},
+			rss.RSSItem{Title: "Go 2", Link: "https://example.com/go-2", Categories: []string{"go"}},
+		),
+		Publishers: map[string]Publisher{"mastodon": masto, "bluesky": bsky},
+		Store:      store,
+		Notifier:   &recordingNotifier{},
+		Clock:      fixedClock{now: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}
+
+	require.NoError(t, RunOnce(context.Background(), conf, deps))
+	require.Len(t, masto.posts, 3)
+	require.Len(t, bsky.posts, 3)
+	assert.NotContains(t, masto.posts[1].Text, "Zuvor:", "posts without an earlier post in their categories")
+	assert.True(t, strings.HasSuffix(masto.posts[2].Text, "\n\nZuvor: https://example.com/go-1"), masto.posts[2].Text)
+	assert.Equal(t, "id-1", bsky.posts[2].Quote, "the earlier Bluesky post is quoted")
+	assert.NotContains(t, bsky.posts[2].Text, "Zuvor:")
+	assert.Empty(t, bsky.posts[1].Quote)
+}
+
+// defaultSeriesPattern is the default of Config.SeriesPattern.
+const defaultSeriesPattern = `(?i)^(?P<series>.*?)[\s,:(\[–—-]*\bpart\s+(?P<part>\d+)\b`
+
+func TestSeriesPart(t *testing.T) {
+	conf := &config.Config{SeriesPattern: defaultSeriesPattern}
+	for _, tt := range []struct {
+		title  string
+		series string
+		part   int
+		ok     bool
+	}{
+		{title: "Part 2: Parsing feeds", part: 2, ok: true},
+		{title: "Building  a Blog, Part 3: Templates", series: "building a blog", part: 3, ok: true},
+		{title: "Building a blog (part 12)", series: "building a blog", part: 12, ok: true},
+		{title: "Go in Practice - PART 1", series: "go in practice", part: 1, ok: true},
+		{title: "Party time"},
+		{title: "Spare parts"},
+	} {
+		series, part, ok := seriesPart(conf, tt.title)
+		assert.Equal(t, tt.ok, ok, tt.title)
+		assert.Equal(t, tt.series, series, tt.title)
+		assert.Equal(t, tt.part, part, tt.title)
+	}
+}
+
+// seriesStore is a memStore that records the parts of series.
+type seriesStore struct {
+	*memStore
+	parts map[string]map[int]string
+}
+
+func (s *seriesStore) SetSeriesPart(link, series string, part int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.parts[series] == nil {
+		s.parts[series] = make(map[int]string)
+	}
+	s.parts[series][part] = link
+	return nil
+}
+
+func (s *seriesStore) PreviousPart(series string, part int) (string, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for p := part - 1; p > 0; p-- {
+		if link, ok := s.parts[series][p]; ok {
+			return link, true, nil
+		}
+	}
+	return "", false, nil
+}
+
+func TestRunOnce_SeriesThreading(t *testing.T) {
+	masto := &recordingPublisher{}
+	bsky := &recordingPublisher{}
+	store := &seriesStore{memStore: newMemStore(), parts: map[string]map[int]string{}}
+	conf := config.Config{
+		FeedURL:         "memory://feed",
+		SocialSites:     []string{"mastodon", "bluesky"},
+		BlueskyHandle:   "me.example.com",
+		BlueskyAppKey:   "app-key",
+		SeriesThreading: true,
+		SeriesPattern:   defaultSeriesPattern,
+	}
+	deps := Deps{
+		FeedFetcher: staticFeed(
+			rss.RSSItem{Title: "Feeds, Part 1: Fetching", Link: "https://example.com/feeds-1"},
+			rss.RSSItem{Title: "Unrelated", Link: "https://example.com/unrelated"},
+			rss.RSSItem{Title: "Feeds, Part 2: Parsing", Link: "https://example.com/feeds-2"},
+			rss.RSSItem{Title: "Templates, Part 2", Link: "https://example.com/templates-2"},
+		),
+		Publishers: map[string]Publisher{"mastodon": masto, "bluesky": bsky},
+		Store:      store,
+		Notifier:   &recordingNotifier{},
+		Clock:      fixedClock{now: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}
+
+	require.NoError(t, RunOnce(context.Background(), conf, deps))
+	require.Len(t, masto.posts, 4)
+	require.Len(t, bsky.posts, 4)
+	assert.Empty(t, masto.posts[0].InReplyTo)
+	assert.Empty(t, masto.posts[1].InReplyTo)
+	assert.Equal(t, "id-1", masto.posts[2].InReplyTo, "the second part replies to the first")
+	assert.Equal(t, "id-1", bsky.posts[2].InReplyTo)
+	assert.Empty(t, masto.posts[3].InReplyTo, "series are kept apart")
+
+	conf.SeriesThreading = false
+	store.memStore = newMemStore()
+	deps.Store = store
+	require.NoError(t, RunOnce(context.Background(), conf, deps))
+	assert.Empty(t, masto.posts[6].InReplyTo, "without series threading parts are posted on their own")
+}
+
+func TestOriginalUpdater_NeedsPostIDStore(t *testing.T) {
+	conf := &config.Config{ThreadsUpdateMode: config.ThreadsUpdateReply}
+	store := newMemStore()
+	require.NoError(t, store.SetSitePostID("https://example.com/a", "threads", "p1"))
+
+	updater, id := Deps{Store: store}.originalUpdater(conf, "threads", threadsPublisher{}, "https://example.com/a")
+	assert.NotNil(t, updater)
+	assert.Equal(t, "p1", id)
+
+	updater, id = Deps{Store: bareStore{store}}.originalUpdater(conf, "threads", threadsPublisher{}, "https://example.com/a")
+	assert.Nil(t, updater, "without post IDs the update is published as a new post")
+	assert.Empty(t, id)
+}
+
+// updaterFunc adapts a function to the Updater interface.
+type updaterFunc func(id string, post Post) error
+
+func (f updaterFunc) Update(_ context.Context, _ config.Config, id string, post Post) error {
+	return f(id, post)
+}
+
+func TestUpdatePost_FailureSchedulesRetry(t *testing.T) {
+	conf := &config.Config{RetryMaxAttempts: 3, RetryBackoffMinutes: 10}
+	store := newMemStore()
+	link := "https://example.com/a"
+	deps := Deps{Store: store, Notifier: &recordingNotifier{}, Clock: fixedClock{now: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)}}
+	p := Post{Item: rss.RSSItem{Title: "A", Link: link}}
+
+	failing := updaterFunc(func(string, Post) error { return errors.New("edit rejected") })
+	require.Error(t, deps.updatePost(context.Background(), conf, "mastodon", failing, "123", p))
+	r, err := store.Retry(link, "mastodon")
+	require.NoError(t, err)
+	assert.Equal(t, 1, r.Attempts, "a failed edit is retried like a failed post")
+	assert.False(t, deps.retryDue("mastodon", link))
+
+	succeeding := updaterFunc(func(string, Post) error { return nil })
+	require.NoError(t, deps.updatePost(context.Background(), conf, "mastodon", succeeding, "123", p))
+	r, _ = store.Retry(link, "mastodon")
+	assert.Zero(t, r.Attempts)
+}
+
+func TestRunOnce_PublishesWithBareStore(t *testing.T) {
+	masto := &recordingPublisher{}
+	store := newMemStore()
+	deps := Deps{
+		FeedFetcher: staticFeed(rss.RSSItem{Title: "Hello", Link: "https://example.com/hello", PubDate: "Thu, 01 Jan 2026 00:00:00 GMT"}),
+		Publishers:  map[string]Publisher{"mastodon": masto},
+		Store:       bareStore{store},
+		Notifier:    &recordingNotifier{},
+		Clock:       fixedClock{now: time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC)},
+	}
+
+	require.NoError(t, RunOnce(context.Background(), config.Config{FeedURL: "memory://feed", SocialSites: []string{"mastodon"}}, deps))
+	assert.Len(t, masto.contents, 1)
+	id, err := store.SitePostID("https://example.com/hello", "mastodon")
+	require.NoError(t, err)
+	assert.Empty(t, id, "post IDs are only stored by a PostIDStore")
+}
+
+func TestRunOnce_SiteDependencies(t *testing.T) {
+	masto := &recordingPublisher{err: errors.New("mastodon down")}
+	bsky := &recordingPublisher{}
+	threads := &recordingPublisher{}
+	store := newMemStore()
+
+	conf := config.Config{
+		FeedURL:             "memory://feed",
+		SocialSites:         []string{"mastodon", "bluesky", "threads"},
+		BlueskyHandle:       "test.bsky.social",
+		BlueskyAppKey:       "app-key",
+		ThreadsToken:        "token",
+		ThreadsClientID:     "client-id",
+		ThreadsClientSecret: "client-secret",
+		SiteDependencies:    map[string]string{"bluesky": "mastodon"},
+	}
+	deps := Deps{
+		FeedFetcher: staticFeed(rss.RSSItem{Title: "Hello", Link: "https://example.com/hello"}),
+		Publishers:  map[string]Publisher{"mastodon": masto, "bluesky": bsky, "threads": threads},
+		Store:       store,
+		Notifier:    &recordingNotifier{},
+		Clock:       fixedClock{now: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}
+
+	require.NoError(t, RunOnce(context.Background(), conf, deps))
+	assert.Empty(t, bsky.contents, "Bluesky waits for Mastodon")
+	assert.Len(t, threads.contents, 1, "Threads is independent")
+
+	masto.err = nil
+	require.NoError(t, RunOnce(context.Background(), conf, deps))
+	assert.Len(t, masto.contents, 1)
+	assert.Len(t, bsky.contents, 1, "Bluesky is published once Mastodon succeeds")
+	assert.Len(t, threads.contents, 1)
+}
+
+func TestRunOnce_NewsletterOnlyAnnouncesNewPosts(t *testing.T) {
+	masto := &recordingPublisher{}
+	letter := &recordingPublisher{}
+	item := rss.RSSItem{Title: "Hello", Link: "https://example.com/hello", Content: "original"}
+
+	conf := config.Config{
+		FeedURL:            "memory://feed",
+		SocialSites:        []string{"mastodon", "newsletter"},
+		NewsletterProvider: config.NewsletterButtondown,
+		ButtondownAPIKey:   "key",
+	}
+	deps := Deps{
+		FeedFetcher: FeedFetcherFunc(func(context.Context, string) ([]rss.RSSItem, error) {
+			return []rss.RSSItem{item}, nil
+		}),
+		Publishers: map[string]Publisher{"mastodon": masto, "newsletter": letter},
+		Store:      newMemStore(),
+		Notifier:   &recordingNotifier{},
+		Clock:      fixedClock{now: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}
+
+	require.NoError(t, RunOnce(context.Background(), conf, deps))
+	require.Len(t, letter.posts, 1)
+	assert.Equal(t, "Hello", letter.posts[0].Item.Title, "the newsletter gets the feed item")
+
+	item.Content = "updated content"
+	require.NoError(t, RunOnce(context.Background(), conf, deps))
+	assert.Len(t, masto.contents, 2, "Mastodon announces the update")
+	assert.Len(t, letter.posts, 1, "the update is not emailed")
+}
+
+func TestRunOnce_SkipsBlockedSites(t *testing.T) {
+	masto := &recordingPublisher{}
+	bsky := &recordingPublisher{}
+	store := newMemStore()
+	notifier := &recordingNotifier{}
+
+	conf := config.Config{
+		FeedURL:          "memory://feed",
+		SocialSites:      []string{"mastodon", "bluesky"},
+		BlueskyHandle:    "test.bsky.social",
+		BlueskyAppKey:    "app-key",
+		PostTemplate:     "{{.Title}} {{.Link}}",
+		BlueskyBlocklist: []string{"acme"},
+	}
+	deps := Deps{
+		FeedFetcher: staticFeed(rss.RSSItem{Title: "Why I left Acme", Link: "https://example.com/acme"}),
+		Publishers:  map[string]Publisher{"mastodon": masto, "bluesky": bsky},
+		Store:       store,
+		Notifier:    notifier,
+		Clock:       fixedClock{now: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}
+
+	require.NoError(t, RunOnce(context.Background(), conf, deps))
+	assert.Len(t, masto.contents, 1)
+	assert.Empty(t, bsky.contents)
+	assert.Equal(t, []string{"Blocked post to Bluesky: Why I left Acme"}, notifier.failures)
+	assert.Contains(t, store.events, db.Event{Action: db.ActionSkippedBlocklist, Site: "bluesky", Link: "https://example.com/acme", Detail: "acme"})
+
+	// The post is checked again in later cycles, but only alerted once.
+	require.NoError(t, RunOnce(context.Background(), conf, deps))
+	assert.Empty(t, bsky.contents)
+	assert.Len(t, notifier.failures, 1)
+}
+
+func TestPublishOrder(t *testing.T) {
+	tests := []struct {
+		name    string
+		order   []string
+		deps    map[string]string
+		want    []string
+		wantErr bool
+	}{
+		{name: "Default", want: []string{"mastodon", "bluesky", "threads", "newsletter"}},
+		{name: "Custom order", order: []string{"threads", "bluesky"}, want: []string{"threads", "bluesky", "mastodon", "newsletter"}},
+		{name: "Dependency first", order: []string{"bluesky"}, deps: map[string]string{"bluesky": "threads"}, want: []string{"threads", "bluesky", "mastodon", "newsletter"}},
+		{name: "Unknown site", order: []string{"myspace"}, wantErr: true},
+		{name: "Unknown dependency", deps: map[string]string{"bluesky": "myspace"}, wantErr: true},
+		{name: "Cycle", deps: map[string]string{"bluesky": "mastodon", "mastodon": "bluesky"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := publishOrder(&config.Config{SiteOrder: tt.order, SiteDependencies: tt.deps})
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestRunOnce_NotifiesSuccessPerSite(t *testing.T) {
+	notifier := &recordingNotifier{}
+	conf := config.Config{
+		FeedURL:       "memory://feed",
+		SocialSites:   []string{"mastodon", "bluesky"},
+		BlueskyHandle: "test.bsky.social",
+		BlueskyAppKey: "app-key",
+	}
+	deps := Deps{
+		FeedFetcher: staticFeed(rss.RSSItem{Title: "Hello", Link: "https://example.com/hello"}),
+		Publishers:  map[string]Publisher{"mastodon": &recordingPublisher{}, "bluesky": &recordingPublisher{}},
+		Store:       newMemStore(),
+		Notifier:    notifier,
+		Clock:       fixedClock{now: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}
+
+	require.NoError(t, RunOnce(context.Background(), conf, deps))
+	assert.Empty(t, notifier.failures)
+	assert.Equal(t, []string{"Successfully posted to Mastodon: Hello", "Successfully posted to Bluesky: Hello"}, notifier.successes)
+}
+
+func TestRunOnce_DatabaseRecordsClockTimes(t *testing.T) {
+	dbFile := setupRunTestDB(t)
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	link := "https://example.com/clocked"
+
+	conf := config.Config{
+		FeedURL:     "memory://feed",
+		DBPath:      dbFile,
+		SocialSites: []string{"mastodon"},
+	}
+	deps := Deps{
+		FeedFetcher: staticFeed(rss.RSSItem{Title: "Clocked", Link: link}),
+		Publishers:  map[string]Publisher{"mastodon": &recordingPublisher{}},
+		Notifier:    &recordingNotifier{},
+		Clock:       fixedClock{now: now},
+	}
+	require.NoError(t, RunOnce(context.Background(), conf, deps))
+
+	db.InitDB(dbFile)
+	defer db.CloseDB()
+	firstSeen, err := db.FirstSeen(link)
+	require.NoError(t, err)
+	assert.True(t, now.Equal(firstSeen), "first seen at %s, want %s", firstSeen, now)
+	events, err := db.EventsSince(time.Time{})
+	require.NoError(t, err)
+	require.NotEmpty(t, events)
+	for _, ev := range events {
+		assert.True(t, now.Equal(ev.Timestamp), "%s recorded at %s, want %s", ev.Label(), ev.Timestamp, now)
+	}
+}
+
+func TestRunOnce_RedactsEventDetails(t *testing.T) {
+	redact.Register("s3cr3t-token")
+	t.Cleanup(redact.Reset)
+	store := newMemStore()
+	conf := config.Config{FeedURL: "memory://feed", SocialSites: []string{"mastodon"}}
+	deps := Deps{
+		FeedFetcher: staticFeed(rss.RSSItem{Title: "Hello", Link: "https://example.com/hello"}),
+		Publishers:  map[string]Publisher{"mastodon": &recordingPublisher{err: errors.New("unauthorized: s3cr3t-token")}},
+		Store:       store,
+		Notifier:    &recordingNotifier{},
+	}
+	require.NoError(t, RunOnce(context.Background(), conf, deps))
+
+	require.NotEmpty(t, store.events)
+	for _, ev := range store.events {
+		assert.NotContains(t, ev.Detail, "s3cr3t-token")
+	}
+	assert.Contains(t, store.events, db.Event{Action: db.ActionFailed, Site: "mastodon", Link: "https://example.com/hello", Detail: "unauthorized: " + redact.Placeholder})
+}
+
+// hangingPublisher blocks publishing the link until ctx is done, and
+// publishes every other post with next.
+type hangingPublisher struct {
+	link string
+	next Publisher
+}
+
+func (p hangingPublisher) Publish(ctx context.Context, conf config.Config, post Post) (string, error) {
+	if post.Link == p.link {
+		<-ctx.Done()
+		return "", ctx.Err()
+	}
+	return p.next.Publish(ctx, conf, post)
+}
+
+func TestRunOnce_PostTimeoutLetsTheNextItemThrough(t *testing.T) {
+	hung := "https://example.com/hung"
+	masto := &recordingPublisher{}
+	store := newMemStore()
+	conf := config.Config{
+		FeedURL:            "memory://feed",
+		SocialSites:        []string{"mastodon"},
+		PostTimeoutSeconds: 1,
+	}
+	deps := Deps{
+		FeedFetcher: staticFeed(
+			rss.RSSItem{Title: "Hung", Link: hung},
+			rss.RSSItem{Title: "Next", Link: "https://example.com/next"},
+		),
+		Publishers: map[string]Publisher{"mastodon": hangingPublisher{link: hung, next: masto}},
+		Store:      store,
+		Notifier:   &recordingNotifier{},
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- RunOnce(context.Background(), conf, deps) }()
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(10 * time.Second):
+		t.Fatal("the cycle did not give up on the hung item")
+	}
+
+	assert.Len(t, masto.contents, 1, "the item after the hung one is published")
+	retry, err := store.Retry(hung, "mastodon")
+	require.NoError(t, err)
+	assert.Equal(t, 1, retry.Attempts, "the hung item is retried")
+}
+
+// steppingClock is a Clock whose time is advanced by the test.
+type steppingClock struct{ now time.Time }
+
+func (c *steppingClock) Now() time.Time { return c.now }
+func (c *steppingClock) After(time.Duration) <-chan time.Time {
+	ch := make(chan time.Time, 1)
+	ch <- c.now
+	return ch
+}
+
+func TestRunOnce_RetriesWithBackoffThenDeadLetters(t *testing.T) {
+	masto := &recordingPublisher{err: errors.New("mastodon down")}
+	store := newMemStore()
+	notifier := &recordingNotifier{}
+	clock := &steppingClock{now: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)}
+	link := "https://example.com/hello"
+
+	conf := config.Config{
+		FeedURL:             "memory://feed",
+		SocialSites:         []string{"mastodon"},
+		RetryMaxAttempts:    3,
+		RetryBackoffMinutes: 10,
+	}
+	deps := Deps{
+		FeedFetcher: staticFeed(rss.RSSItem{Title: "Hello", Link: link}),
+		Publishers:  map[string]Publisher{"mastodon": masto},
+		Store:       store,
+		Notifier:    notifier,
+		Clock:       clock,
+	}
+	attempts := func() int {
+		r, _ := store.Retry(link, "mastodon")
+		return r.Attempts
+	}
+
+	require.NoError(t, RunOnce(context.Background(), conf, deps))
+	assert.Equal(t, 1, attempts())
+
+	clock.now = clock.now.Add(5 * time.Minute)
+	require.NoError(t, RunOnce(context.Background(), conf, deps))
+	assert.Equal(t, 1, attempts(), "not retried before the backoff elapsed")
+
+	clock.now = clock.now.Add(5 * time.Minute)
+	require.NoError(t, RunOnce(context.Background(), conf, deps))
+	assert.Equal(t, 2, attempts())
+
+	clock.now = clock.now.Add(20 * time.Minute)
+	require.NoError(t, RunOnce(context.Background(), conf, deps))
+	r, _ := store.Retry(link, "mastodon")
+	assert.Equal(t, 3, r.Attempts)
+	assert.True(t, r.Dead)
+	assert.Contains(t, notifier.failures, "Gave up posting to Mastodon after 3 attempts: Hello")
+
+	masto.err = nil
+	clock.now = clock.now.Add(48 * time.Hour)
+	require.NoError(t, RunOnce(context.Background(), conf, deps))
+	assert.Empty(t, masto.contents, "dead-lettered posts are not retried")
+}
+
+func TestRunOnce_SuccessClearsRetry(t *testing.T) {
+	masto := &recordingPublisher{err: errors.New("mastodon down")}
+	store := newMemStore()
+	link := "https://example.com/hello"
+
+	conf := config.Config{FeedURL: "memory://feed", SocialSites: []string{"mastodon"}, RetryMaxAttempts: 3}
+	deps := Deps{
+		FeedFetcher: staticFeed(rss.RSSItem{Title: "Hello", Link: link}),
+		Publishers:  map[string]Publisher{"mastodon": masto},
+		Store:       store,
+		Notifier:    &recordingNotifier{},
+		Clock:       fixedClock{now: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}
+
+	require.NoError(t, RunOnce(context.Background(), conf, deps))
+	masto.err = nil
+	require.NoError(t, RunOnce(context.Background(), conf, deps))
+	assert.Len(t, masto.contents, 1)
+	r, _ := store.Retry(link, "mastodon")
+	assert.Zero(t, r.Attempts)
+}
+
+func TestRunOnce_ReportsRepeatedFailuresToSentry(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		events []map[string]any
+	)
+	sentry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event map[string]any
+		_ = json.NewDecoder(r.Body).Decode(&event)
+		mu.Lock()
+		events = append(events, event)
+		mu.Unlock()
+	}))
+	defer sentry.Close()
+
+	masto := &recordingPublisher{err: errors.New("mastodon down")}
+	link := "https://example.com/hello"
+	conf := config.Config{
+		FeedURL:                "memory://feed",
+		SocialSites:            []string{"mastodon"},
+		SentryDSN:              strings.Replace(sentry.URL, "http://", "http://key@", 1) + "/42",
+		SentryFailureThreshold: 2,
+	}
+	deps := Deps{
+		FeedFetcher: staticFeed(rss.RSSItem{Title: "Hello", Link: link}),
+		Publishers:  map[string]Publisher{"mastodon": masto},
+		Store:       newMemStore(),
+		Notifier:    &recordingNotifier{},
+		Clock:       fixedClock{now: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}
+
+	require.NoError(t, RunOnce(context.Background(), conf, deps))
+	assert.Empty(t, events, "a single failure is not reported")
+
+	require.NoError(t, RunOnce(context.Background(), conf, deps))
+	require.Len(t, events, 1, "RunOnce waits for the report to be sent")
+	assert.Equal(t, map[string]any{
+		"feed":     "memory://feed",
+		"network":  "mastodon",
+		"link":     link,
+		"attempts": "2",
+		"gave_up":  "false",
+	}, events[0]["tags"])
+	assert.Equal(t, []any{"publish-failure", "mastodon"}, events[0]["fingerprint"])
+
+	deps.Store = bareStore{newMemStore()}
+	require.NoError(t, RunOnce(context.Background(), conf, deps))
+	require.Len(t, events, 2, "failures are reported without a RetryStore to count them")
+	assert.Equal(t, "1", events[1]["tags"].(map[string]any)["attempts"])
+}
+
+// panickingPublisher panics on every publish, like a client dereferencing
+// an unexpected API response.
+type panickingPublisher struct{}
+
+func (panickingPublisher) Publish(context.Context, config.Config, Post) (string, error) {
+	var resp *struct{ ID string }
+	return resp.ID, nil
+}
+
+func TestRunOnce_RecoversPublisherPanic(t *testing.T) {
+	metrics.Default.Reset()
+	t.Cleanup(metrics.Default.Reset)
+	bsky := &recordingPublisher{}
+	store := newMemStore()
+	notifier := &recordingNotifier{}
+	link := "https://example.com/hello"
+
+	conf := config.Config{
+		FeedURL:       "memory://feed",
+		SocialSites:   []string{"mastodon", "bluesky"},
+		BlueskyHandle: "user.bsky.social",
+		BlueskyAppKey: "app-key",
+	}
+	deps := Deps{
+		FeedFetcher: staticFeed(rss.RSSItem{Title: "Hello", Link: link}),
+		Publishers:  map[string]Publisher{"mastodon": panickingPublisher{}, "bluesky": bsky},
+		Store:       store,
+		Notifier:    notifier,
+		Clock:       fixedClock{now: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}
+
+	require.NoError(t, RunOnce(context.Background(), conf, deps))
+	assert.Len(t, bsky.contents, 1, "the other sites are still published to")
+	r, _ := store.Retry(link, "mastodon")
+	assert.Equal(t, 1, r.Attempts, "the panic is retried like a failure")
+	assert.Contains(t, r.LastError, "panic: runtime error: invalid memory address or nil pointer dereference")
+	require.Len(t, notifier.failures, 1)
+	assert.Equal(t, int64(1), metrics.Default.Get(metrics.PanicsRecovered))
+}
+
+// panickingStore panics when the item at link is looked up.
+type panickingStore struct {
+	*memStore
+	link string
+}
+
+func (s panickingStore) HasPostChanged(link, content string) (bool, bool, error) {
+	if link == s.link {
+		panic("corrupt row")
+	}
+	return s.memStore.HasPostChanged(link, content)
+}
+
+func TestRunOnce_SkipsItemThatPanics(t *testing.T) {
+	masto := &recordingPublisher{}
+	conf := config.Config{FeedURL: "memory://feed", SocialSites: []string{"mastodon"}}
+	deps := Deps{
+		FeedFetcher: staticFeed(
+			rss.RSSItem{Title: "Bad", Link: "https://example.com/bad"},
+			rss.RSSItem{Title: "Good", Link: "https://example.com/good"},
+		),
+		Publishers: map[string]Publisher{"mastodon": masto},
+		Store:      panickingStore{memStore: newMemStore(), link: "https://example.com/bad"},
+		Notifier:   &recordingNotifier{},
+	}
+
+	require.NoError(t, RunOnce(context.Background(), conf, deps))
+	assert.Equal(t, []string{"New post: https://example.com/good"}, masto.contents)
+}
+
+func TestRunOnce_RecoversCyclePanic(t *testing.T) {
+	conf := config.Config{FeedURL: "memory://feed", SocialSites: []string{"mastodon"}}
+	deps := Deps{
+		FeedFetcher: FeedFetcherFunc(func(context.Context, string) ([]rss.RSSItem, error) {
+			panic("parser bug")
+		}),
+		Publishers: map[string]Publisher{"mastodon": &recordingPublisher{}},
+		Store:      newMemStore(),
+		Notifier:   &recordingNotifier{},
+	}
+
+	err := RunOnce(context.Background(), conf, deps)
+	require.Error(t, err)
+	assert.Equal(t, "panic: parser bug", err.Error())
+}
+
+func TestRunOnce_ExpandsFeedURLPlaceholders(t *testing.T) {
+	var fetched []string
+	conf := config.Config{FeedURL: "https://example.com/feed/{{year}}-{{month}}.xml", SocialSites: []string{"mastodon"}, Timezone: "Europe/Berlin"}
+	deps := Deps{
+		FeedFetcher: FeedFetcherFunc(func(_ context.Context, feedURL string) ([]rss.RSSItem, error) {
+			fetched = append(fetched, feedURL)
+			return nil, nil
+		}),
+		Publishers: map[string]Publisher{"mastodon": &recordingPublisher{}},
+		Store:      newMemStore(),
+		Notifier:   &recordingNotifier{},
+		// It is already 2027 in Berlin.
+		Clock: fixedClock{now: time.Date(2026, 12, 31, 23, 30, 0, 0, time.UTC)},
+	}
+
+	require.NoError(t, RunOnce(context.Background(), conf, deps))
+	assert.Equal(t, []string{"https://example.com/feed/2027-01.xml"}, fetched)
+}
+
+func TestRetryBackoff(t *testing.T) {
+	conf := &config.Config{RetryBackoffMinutes: 15}
+	assert.Equal(t, 15*time.Minute, retryBackoff(conf, 1))
+	assert.Equal(t, 30*time.Minute, retryBackoff(conf, 2))
+	assert.Equal(t, 2*time.Hour, retryBackoff(conf, 4))
+	assert.Equal(t, maxRetryBackoff, retryBackoff(conf, 20))
+	assert.Zero(t, retryBackoff(&config.Config{}, 3))
+}
+
+func TestRunOnce_ResumesPendingRetriesAfterRestart(t *testing.T) {
+	masto := &recordingPublisher{}
+	bsky := &recordingPublisher{err: errors.New("bluesky down")}
+	store := newMemStore()
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	clock := &steppingClock{now: start}
+
+	conf := config.Config{
+		FeedURL:             "memory://feed",
+		SocialSites:         []string{"mastodon", "bluesky"},
+		BlueskyHandle:       "test.bsky.social",
+		BlueskyAppKey:       "app-key",
+		PostNewEntriesOnly:  true,
+		RetryMaxAttempts:    5,
+		RetryBackoffMinutes: 60,
+	}
+	item := rss.RSSItem{Title: "Hello", Link: "https://example.com/hello", PubDate: start.Add(time.Minute).Format(time.RFC1123Z)}
+	deps := Deps{
+		FeedFetcher: staticFeed(item),
+		Publishers:  map[string]Publisher{"mastodon": masto, "bluesky": bsky},
+		Store:       store,
+		Notifier:    &recordingNotifier{},
+		Clock:       clock,
+	}
+
+	require.NoError(t, RunOnce(context.Background(), conf, deps))
+	assert.Len(t, masto.contents, 1)
+	assert.Empty(t, bsky.contents)
+
+	// After a restart the item's pubDate is before the new startup time and
+	// the retry backoff has not elapsed, yet the pending retry is resumed.
+	bsky.err = nil
+	clock.now = start.Add(5 * time.Minute)
+	conf.Interval = 60
+	conf.ShortRun = true
+	require.NoError(t, Start(context.Background(), conf, deps))
+	assert.Len(t, masto.contents, 1)
+	assert.Len(t, bsky.contents, 1)
+	pending, _ := store.PendingRetries()
+	assert.Empty(t, pending)
+}
+
+func TestRunOnce_RecordsAndReplaysFeed(t *testing.T) {
+	feed := filepath.Join(t.TempDir(), "feed.xml")
+	require.NoError(t, os.WriteFile(feed, []byte(`<rss><channel>
+<item><title>Hello</title><link>https://example.com/hello</link></item>
+</channel></rss>`), 0o600))
+	recordings := filepath.Join(t.TempDir(), "recordings")
+
+	masto := &recordingPublisher{}
+	conf := config.Config{
+		FeedURL:       "file://" + feed,
+		RecordFeedDir: recordings,
+		SocialSites:   []string{"mastodon"},
+	}
+	deps := Deps{
+		Publishers: map[string]Publisher{"mastodon": masto},
+		Store:      newMemStore(),
+		Notifier:   &recordingNotifier{},
+		Clock:      fixedClock{now: time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)},
+	}
+	require.NoError(t, RunOnce(context.Background(), conf, deps))
+	assert.Equal(t, []string{"New post: https://example.com/hello"}, masto.contents)
+
+	recorded := filepath.Join(recordings, "feed-20260101T120000.000Z.xml")
+	require.FileExists(t, recorded)
+	require.NoError(t, os.Remove(feed))
+
+	// Replaying the recording into a fresh store publishes the same items.
+	replay := &recordingPublisher{}
+	conf.FeedURL, conf.RecordFeedDir = "file://"+recorded, ""
+	deps.Publishers = map[string]Publisher{"mastodon": replay}
+	deps.Store = newMemStore()
+	require.NoError(t, RunOnce(context.Background(), conf, deps))
+	assert.Equal(t, masto.contents, replay.contents)
+}
+
+func TestRunOnce_ContentSources(t *testing.T) {
+	masto := &recordingPublisher{}
+	conf := config.Config{
+		FeedURL:        "memory://feed",
+		SocialSites:    []string{"mastodon"},
+		PostTemplate:   "{{.Content | stripHTML}} {{.Link}}",
+		ContentSources: []string{"content:encoded", "description"},
+	}
+	deps := Deps{
+		FeedFetcher: staticFeed(
+			rss.RSSItem{Title: "Full", Link: "https://example.com/full", Content: "Summary", Encoded: "<p>Full text</p>"},
+			rss.RSSItem{Title: "Summary only", Link: "https://example.com/summary", Content: "Summary"},
+		),
+		Publishers: map[string]Publisher{"mastodon": masto},
+		Store:      newMemStore(),
+		Notifier:   &recordingNotifier{},
+	}
+
+	require.NoError(t, RunOnce(context.Background(), conf, deps))
+	assert.ElementsMatch(t, []string{
+		"Full text https://example.com/full",
+		"Summary https://example.com/summary",
+	}, masto.contents)
+}
+
+func TestRunOnce_ClassifiesNetworkErrors(t *testing.T) {
+	notifier := &recordingNotifier{}
+	conf := config.Config{FeedURL: "memory://feed", SocialSites: []string{"mastodon"}}
+	deps := Deps{
+		FeedFetcher: staticFeed(rss.RSSItem{Title: "Hello", Link: "https://example.com/hello"}),
+		Publishers: map[string]Publisher{"mastodon": &recordingPublisher{
+			err: fmt.Errorf("post status: %w", &net.DNSError{Err: "no such host", Name: "mastodon.example", IsNotFound: true}),
+		}},
+		Store:    newMemStore(),
+		Notifier: notifier,
+	}
+
+	require.NoError(t, RunOnce(context.Background(), conf, deps))
+	assert.Equal(t, []string{"DNS lookup failed: post status: lookup mastodon.example: no such host"}, notifier.errs)
+
+	deps.FeedFetcher = FeedFetcherFunc(func(context.Context, string) ([]rss.RSSItem, error) {
+		return nil, fmt.Errorf("HTTP request failed: %w", context.DeadlineExceeded)
+	})
+	assert.EqualError(t, RunOnce(context.Background(), conf, deps), "timeout: HTTP request failed: context deadline exceeded")
+}
+
+func TestRunOnce_BlueskyOAuthNeedsNoAppKey(t *testing.T) {
+	bsky := &recordingPublisher{}
+
+	conf := config.Config{
+		FeedURL:       "memory://feed",
+		BlueskyHandle: "test.bsky.social",
+		BlueskyAuth:   config.BlueskyAuthOAuth,
+	}
+	deps := Deps{
+		FeedFetcher: staticFeed(rss.RSSItem{Title: "Hello", Link: "https://example.com/hello"}),
+		Publishers:  map[string]Publisher{"bluesky": bsky},
+		Store:       newMemStore(),
+		Notifier:    &recordingNotifier{},
+		Clock:       fixedClock{now: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}
+
+	require.NoError(t, RunOnce(context.Background(), conf, deps))
+	assert.Equal(t, []string{"New post: https://example.com/hello"}, bsky.contents)
+}
+
+func TestRunOnce_VerifiesSitesAtStartup(t *testing.T) {
+	masto := &verifyingPublisher{maxChars: 20}
+	link := "https://example.com/" + strings.Repeat("a", 40)
+
+	conf := config.Config{
+		FeedURL:        "memory://feed",
+		SocialSites:    []string{"mastodon"},
+		MastodonFlavor: config.MastodonFlavorGoToSocial,
+	}
+	deps := Deps{
+		FeedFetcher: staticFeed(rss.RSSItem{Title: "Long", Link: link}),
+		Publishers:  map[string]Publisher{"mastodon": masto},
+		Store:       newMemStore(),
+		Notifier:    &recordingNotifier{},
+		Clock:       fixedClock{now: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}
+
+	require.NoError(t, RunOnce(context.Background(), conf, deps))
+	assert.Equal(t, []string{"New post:…"}, masto.contents, "the verified limit applies and GoToSocial counts the link in full")
+}
+
+// credentialPublisher is a recordingPublisher whose credentials expire at
+// expires, or are rejected with checkErr.
+type credentialPublisher struct {
+	recordingPublisher
+	expires  time.Time
+	checkErr error
+	checks   int
+}
+
+func (p *credentialPublisher) CheckCredentials(context.Context, config.Config) (time.Time, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.checks++
+	return p.expires, p.checkErr
+}
+
+// eventNotifier is a recordingNotifier that records other events as well.
+type eventNotifier struct {
+	recordingNotifier
+	events []notify.Event
+}
+
+func (n *eventNotifier) Notify(_ *config.Config, ev notify.Event) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.events = append(n.events, ev)
+}
+
+// eventTimeStore is a memStore that remembers when each action was last
+// recorded for a site, by the time of clock.
+type eventTimeStore struct {
+	*memStore
+	clock Clock
+	times map[string]time.Time
+}
+
+func (s *eventTimeStore) RecordEvent(action, site, link, detail string) error {
+	s.mu.Lock()
+	s.times[action+" "+site] = s.clock.Now()
+	s.mu.Unlock()
+	return s.memStore.RecordEvent(action, site, link, detail)
+}
+
+func (s *eventTimeStore) LastEventTime(action, site string) (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.times[action+" "+site], nil
+}
+
+func TestRunOnce_ChecksCredentials(t *testing.T) {
+	clock := &steppingClock{now: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)}
+	masto := &credentialPublisher{checkErr: errors.New("401 Unauthorized: The access token was revoked")}
+	bsky := &credentialPublisher{}
+	threads := &credentialPublisher{expires: clock.now.AddDate(0, 0, 10)}
+	store := &eventTimeStore{memStore: newMemStore(), clock: clock, times: make(map[string]time.Time)}
+	notifier := &eventNotifier{}
+
+	conf := config.Config{
+		FeedURL:                     "memory://feed",
+		SocialSites:                 []string{"mastodon", "bluesky", "threads"},
+		BlueskyHandle:               "test.bsky.social",
+		BlueskyAppKey:               "app-key",
+		ThreadsToken:                "token",
+		ThreadsClientID:             "id",
+		ThreadsClientSecret:         "secret",
+		CredentialCheckDays:         7,
+		CredentialExpiryWarningDays: 14,
+	}
+	deps := Deps{
+		FeedFetcher: staticFeed(),
+		Publishers:  map[string]Publisher{"mastodon": masto, "bluesky": bsky, "threads": threads},
+		Store:       store,
+		Notifier:    notifier,
+		Clock:       clock,
+	}
+
+	require.NoError(t, RunOnce(context.Background(), conf, deps))
+	require.Len(t, notifier.events, 2)
+	assert.Equal(t, notify.EventTokenExpiry, notifier.events[0].Type)
+	assert.Equal(t, notify.SeverityError, notifier.events[0].Severity)
+	assert.Equal(t, "Mastodon credentials rejected", notifier.events[0].Title)
+	assert.Contains(t, notifier.events[0].Message, "revoked")
+	assert.Equal(t, notify.SeverityWarning, notifier.events[1].Severity)
+	assert.Equal(t, "Threads credentials expire soon", notifier.events[1].Title)
+	assert.Contains(t, notifier.events[1].Message, "2026-01-11, in 10 days")
+	assert.Contains(t, store.events, db.Event{Action: db.ActionCredentialsChecked, Site: "bluesky", Detail: "valid"})
+	assert.Empty(t, notifier.failures)
+
+	// The checks are not repeated until CredentialCheckDays have passed,
+	// also by later runs.
+	clock.now = clock.now.AddDate(0, 0, 6)
+	require.NoError(t, RunOnce(context.Background(), conf, deps))
+	assert.Equal(t, []int{1, 1, 1}, []int{masto.checks, bsky.checks, threads.checks})
+
+	clock.now = clock.now.AddDate(0, 0, 1)
+	masto.checkErr = nil
+	require.NoError(t, RunOnce(context.Background(), conf, deps))
+	assert.Equal(t, []int{2, 2, 2}, []int{masto.checks, bsky.checks, threads.checks})
+	require.Len(t, notifier.events, 3)
+	assert.Equal(t, "Threads credentials expire soon", notifier.events[2].Title)
+	assert.Contains(t, notifier.events[2].Message, "in 3 days")
+}
+
+func TestRunOnce_RetriesCredentialChecksAfterNetworkErrors(t *testing.T) {
+	masto := &credentialPublisher{checkErr: &net.DNSError{Err: "no such host", Name: "mastodon.example", IsNotFound: true}}
+	store := newMemStore()
+	notifier := &recordingNotifier{}
+
+	conf := config.Config{
+		FeedURL:             "memory://feed",
+		SocialSites:         []string{"mastodon"},
+		CredentialCheckDays: 7,
+	}
+	deps := Deps{
+		FeedFetcher: staticFeed(),
+		Publishers:  map[string]Publisher{"mastodon": masto},
+		Store:       store,
+		Notifier:    notifier,
+		Clock:       fixedClock{now: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}
+
+	r, err := newRunner(conf, deps)
+	require.NoError(t, err)
+	ctx := context.Background()
+	r.checkCredentials(ctx)
+	assert.Empty(t, notifier.failures, "network errors are not alerted")
+
+	masto.checkErr = errors.New("invalid token")
+	r.checkCredentials(ctx)
+	r.checkCredentials(ctx)
+	assert.Equal(t, 2, masto.checks, "the check is retried until it reaches the site")
+	assert.Equal(t, []string{"Mastodon credentials rejected"}, notifier.failures, "Notifiers get other events as failures")
+}
+
+func TestRunOnce_SchedulesFutureItems(t *testing.T) {
+	masto := &schedulingPublisher{minLead: 10 * time.Minute}
+	bsky := &recordingPublisher{}
+	store := newMemStore()
+	notifier := &recordingNotifier{}
+	clock := &steppingClock{now: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)}
+	embargo := clock.now.Add(time.Hour)
+	soon := clock.now.Add(5 * time.Minute)
+
+	conf := config.Config{
+		FeedURL:             "memory://feed",
+		SocialSites:         []string{"mastodon", "bluesky"},
+		BlueskyHandle:       "test.bsky.social",
+		BlueskyAppKey:       "app-key",
+		ScheduleFutureItems: true,
+	}
+	deps := Deps{
+		FeedFetcher: staticFeed(
+			rss.RSSItem{Title: "Embargoed", Link: "https://example.com/embargoed", PubDate: embargo.Format(time.RFC1123Z)},
+			rss.RSSItem{Title: "Soon", Link: "https://example.com/soon", PubDate: soon.Format(time.RFC1123Z)},
+		),
+		Publishers: map[string]Publisher{"mastodon": masto, "bluesky": bsky},
+		Store:      store,
+		Notifier:   notifier,
+		Clock:      clock,
+	}
+
+	require.NoError(t, RunOnce(context.Background(), conf, deps))
+	require.Len(t, masto.scheduled, 1, "only the embargo far enough ahead is scheduled")
+	assert.True(t, masto.scheduled[0].Equal(embargo))
+	assert.Empty(t, masto.contents)
+	assert.Empty(t, bsky.contents, "Bluesky cannot schedule, so it waits for the pubDate")
+	assert.Equal(t, []string{"Successfully scheduled Mastodon post for " + embargo.Format(time.RFC3339) + ": Embargoed"}, notifier.successes)
+	assert.Equal(t, db.ActionScheduled, store.events[len(store.events)-1].Action)
+
+	clock.now = soon.Add(time.Minute)
+	require.NoError(t, RunOnce(context.Background(), conf, deps))
+	assert.Equal(t, []string{"New post: https://example.com/soon"}, masto.contents, "too close to schedule, so published once due")
+	assert.Equal(t, []string{"New post: https://example.com/soon"}, bsky.contents)
+
+	clock.now = embargo.Add(time.Minute)
+	require.NoError(t, RunOnce(context.Background(), conf, deps))
+	assert.Len(t, masto.scheduled, 1)
+	assert.Len(t, masto.contents, 1, "the scheduled post is not published again")
+	assert.Equal(t, []string{"New post: https://example.com/soon", "New post: https://example.com/embargoed"}, bsky.contents)
+}
+
+func TestRunOnce_PublishesFutureItemsWhenSchedulingDisabled(t *testing.T) {
+	masto := &schedulingPublisher{}
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	conf := config.Config{FeedURL: "memory://feed", SocialSites: []string{"mastodon"}}
+	deps := Deps{
+		FeedFetcher: staticFeed(rss.RSSItem{Title: "Embargoed", Link: "https://example.com/embargoed", PubDate: now.Add(time.Hour).Format(time.RFC1123Z)}),
+		Publishers:  map[string]Publisher{"mastodon": masto},
+		Store:       newMemStore(),
+		Notifier:    &recordingNotifier{},
+		Clock:       fixedClock{now: now},
+	}
+
+	require.NoError(t, RunOnce(context.Background(), conf, deps))
+	assert.Empty(t, masto.scheduled)
+	assert.Len(t, masto.contents, 1)
+}
+
+func TestRunOnce_FallsBackToMemoryDatabase(t *testing.T) {
+	masto := &recordingPublisher{}
+	notifier := &recordingNotifier{}
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	conf := config.Config{
+		FeedURL:          "memory://feed",
+		SocialSites:      []string{"mastodon"},
+		Interval:         60,
+		DBPath:           filepath.Join(t.TempDir(), "missing", "db.sqlite"),
+		DBMemoryFallback: true,
+	}
+	deps := Deps{
+		FeedFetcher: staticFeed(
+			rss.RSSItem{Title: "Old", Link: "https://example.com/old", PubDate: now.Add(-2 * time.Hour).Format(time.RFC1123Z)},
+			rss.RSSItem{Title: "Undated", Link: "https://example.com/undated"},
+			rss.RSSItem{Title: "New", Link: "https://example.com/new", PubDate: now.Add(-10 * time.Minute).Format(time.RFC1123Z)},
+		),
+		Publishers: map[string]Publisher{"mastodon": masto},
+		Notifier:   notifier,
+		Clock:      fixedClock{now: now},
+	}
+
+	require.NoError(t, RunOnce(context.Background(), conf, deps))
+	assert.Equal(t, []string{"New post: https://example.com/new"}, masto.contents, "only items published since the previous check are posted")
+	assert.Equal(t, []string{"Database unavailable, running on an in-memory database"}, notifier.failures)
+}
+
+func TestRunOnce_MemoryDriver(t *testing.T) {
+	masto := &recordingPublisher{}
+	dbPath := filepath.Join(t.TempDir(), "unused.db")
+
+	conf := config.Config{
+		FeedURL:     "memory://feed",
+		SocialSites: []string{"mastodon"},
+		DBDriver:    config.DBDriverMemory,
+		DBPath:      dbPath,
+	}
+	deps := Deps{
+		FeedFetcher: staticFeed(rss.RSSItem{Title: "Hello", Link: "https://example.com/hello"}),
+		Publishers:  map[string]Publisher{"mastodon": masto},
+		Notifier:    &recordingNotifier{},
+		Clock:       fixedClock{now: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}
+
+	require.NoError(t, RunOnce(context.Background(), conf, deps))
+	require.NoError(t, RunOnce(context.Background(), conf, deps))
+	assert.Len(t, masto.contents, 2, "nothing is remembered between runs")
+	assert.NoFileExists(t, dbPath)
+
+	err := DeletePost(context.Background(), conf, "https://example.com/hello")
+	assert.Error(t, err)
+}
+
+func TestRunOnce_RedisDriver(t *testing.T) {
+	srv := testutil.NewRedisServer(t, "secret")
+	masto := &recordingPublisher{}
+
+	conf := config.Config{
+		FeedURL:        "memory://feed",
+		SocialSites:    []string{"mastodon"},
+		DBDriver:       config.DBDriverRedis,
+		RedisURL:       srv.URL,
+		RedisKeyPrefix: "feed:",
+	}
+	deps := Deps{
+		FeedFetcher: staticFeed(rss.RSSItem{Title: "Hello", Link: "https://example.com/hello"}),
+		Publishers:  map[string]Publisher{"mastodon": masto},
+		Notifier:    &recordingNotifier{},
+		Clock:       fixedClock{now: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}
+
+	require.NoError(t, RunOnce(context.Background(), conf, deps))
+	require.NoError(t, RunOnce(context.Background(), conf, deps))
+	assert.Len(t, masto.contents, 1, "replicas sharing the Redis server publish once")
+	assert.Equal(t, "1", srv.Hash("feed:post:https://example.com/hello")["mastodon_posted"])
+
+	conf.RedisURL = "redis://127.0.0.1:1"
+	conf.DBMemoryFallback = true
+	notifier := &recordingNotifier{}
+	deps.Notifier = notifier
+	require.NoError(t, RunOnce(context.Background(), conf, deps))
+	assert.Len(t, notifier.failures, 1, "an unreachable Redis server falls back to an in-memory database")
+}
+
+func TestRunOnce_CycleLock(t *testing.T) {
+	srv := testutil.NewRedisServer(t, "")
+	other, err := redisstore.New(srv.URL, "rss2socials:", 0)
+	require.NoError(t, err)
+	defer other.Close()
+
+	masto := &recordingPublisher{}
+	conf := config.Config{
+		FeedURL:             "memory://feed",
+		SocialSites:         []string{"mastodon"},
+		DBDriver:            config.DBDriverRedis,
+		RedisURL:            srv.URL,
+		RedisKeyPrefix:      "rss2socials:",
+		CycleLock:           true,
+		CycleLockTTLSeconds: 60,
+	}
+	deps := Deps{
+		FeedFetcher: staticFeed(rss.RSSItem{Title: "Hello", Link: "https://example.com/hello"}),
+		Publishers:  map[string]Publisher{"mastodon": masto},
+		Notifier:    &recordingNotifier{},
+		Clock:       fixedClock{now: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}
+
+	acquired, err := other.AcquireLock("cycle:memory://feed", "other", time.Minute)
+	require.NoError(t, err)
+	require.True(t, acquired)
+	require.NoError(t, RunOnce(context.Background(), conf, deps))
+	assert.Empty(t, masto.contents, "the cycle is skipped while another instance holds the lock")
+
+	require.NoError(t, other.ReleaseLock("cycle:memory://feed", "other"))
+	require.NoError(t, RunOnce(context.Background(), conf, deps))
+	assert.Len(t, masto.contents, 1)
+
+	acquired, err = other.AcquireLock("cycle:memory://feed", "other", time.Minute)
+	require.NoError(t, err)
+	assert.True(t, acquired, "the lock is released after the cycle")
+}
+
+// accountPublisher is a recordingPublisher that knows its account.
+type accountPublisher struct {
+	recordingPublisher
+	account string
+	err     error
+}
+
+func (p *accountPublisher) Account(context.Context, config.Config) (string, error) {
+	return p.account, p.err
+}
+
+func TestStart_LogsSettings(t *testing.T) {
+	hook := test.NewGlobal()
+	defer hook.Reset()
+
+	conf := config.Config{
+		FeedURL:       "memory://feed",
+		Interval:      30,
+		ShortRun:      true,
+		SocialSites:   []string{"mastodon", "bluesky", "threads"},
+		BlueskyHandle: "me.example.com",
+		BlueskyAppKey: "app-key",
+		GotifyURL:     "https://gotify.example.com",
+		GotifyToken:   "token",
+		DBDriver:      config.DBDriverMemory,
+	}
+	deps := Deps{
+		FeedFetcher: staticFeed(),
+		Publishers: map[string]Publisher{
+			"mastodon": &accountPublisher{account: "@me@mastodon.example"},
+			"bluesky":  &accountPublisher{err: errors.New("resolution failed")},
+			"threads":  &recordingPublisher{},
+		},
+		Notifier: &recordingNotifier{},
+		Clock:    fixedClock{now: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	require.NoError(t, Start(context.Background(), conf, deps))
+
+	var entry *log.Entry
+	for _, e := range hook.AllEntries() {
+		if e.Message == "Starting rss2socials" {
+			entry = e
+		}
+	}
+	require.NotNil(t, entry)
+	assert.Equal(t, "memory://feed", entry.Data["feed"])
+	assert.Equal(t, "30 minutes", entry.Data["interval"])
+	assert.Equal(t, "Mastodon (@me@mastodon.example), Bluesky (account unknown), Threads (not configured)", entry.Data["networks"])
+	assert.Equal(t, "gotify", entry.Data["notifications"])
+	assert.Equal(t, "memory", entry.Data["database"])
+	assert.NotContains(t, entry.Data, "category")
+}
+
+func TestRunOnce_Timings(t *testing.T) {
+	metrics.DefaultTimings.Reset()
+	t.Cleanup(metrics.DefaultTimings.Reset)
+	hook := test.NewGlobal()
+	defer hook.Reset()
+	level := log.GetLevel()
+	log.SetLevel(log.DebugLevel)
+	defer log.SetLevel(level)
+
+	feed := filepath.Join(t.TempDir(), "feed.xml")
+	require.NoError(t, os.WriteFile(feed, []byte(`<rss><channel>
+<item><title>Hello</title><link>https://example.com/hello</link></item>
+</channel></rss>`), 0o600))
+	conf := config.Config{
+		FeedURL:     "file://" + feed,
+		SocialSites: []string{"mastodon"},
+	}
+	deps := Deps{
+		Publishers: map[string]Publisher{"mastodon": &recordingPublisher{}},
+		Store:      newMemStore(),
+		Notifier:   &recordingNotifier{},
+	}
+	require.NoError(t, RunOnce(context.Background(), conf, deps))
+
+	timings := metrics.DefaultTimings.Snapshot()
+	assert.EqualValues(t, 1, timings[metrics.Series{Name: metrics.FeedFetch}].Count)
+	assert.EqualValues(t, 1, timings[metrics.Series{Name: metrics.FeedParse}].Count)
+	assert.EqualValues(t, 1, timings[metrics.Series{Name: metrics.Publish, Network: "mastodon"}].Count)
+
+	var logged bool
+	for _, e := range hook.AllEntries() {
+		if e.Level == log.DebugLevel && strings.HasPrefix(e.Message, "Cycle timings: feed_fetch=") {
+			logged = strings.Contains(e.Message, "publish_mastodon=")
+		}
+	}
+	assert.True(t, logged, "the timings of the cycle are logged at debug level")
+}
+
+func TestServeMetrics(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := ln.Addr().String()
+	ln.Close()
+
+	stop := serveMetrics(addr)
+	resp, err := http.Get("http://" + addr + "/metrics")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	stop()
+	_, err = http.Get("http://" + addr + "/metrics")
+	assert.Error(t, err, "the server is stopped")
+}
+
+func TestFeedBackoff(t *testing.T) {
+	assert.Equal(t, time.Minute, feedBackoff(time.Minute, 1))
+	assert.Equal(t, 2*time.Minute, feedBackoff(time.Minute, 2))
+	assert.Equal(t, 8*time.Minute, feedBackoff(time.Minute, 4))
+	assert.Equal(t, maxFeedBackoff, feedBackoff(time.Minute, 20))
+	assert.Equal(t, 2*time.Hour, feedBackoff(2*time.Hour, 5), "the backoff is never shorter than the interval")
+}
+
+// waitRecordingClock is a Clock that records the durations waited for and
+// cancels the run after a number of waits.
+type waitRecordingClock struct {
+	fixedClock
+	waits  []time.Duration
+	limit  int
+	cancel context.CancelFunc
+}
+
+func (c *waitRecordingClock) After(d time.Duration) <-chan time.Time {
+	c.waits = append(c.waits, d)
+	if len(c.waits) >= c.limit {
+		c.cancel()
+	}
+	return c.fixedClock.After(d)
+}
+
+func TestStart_BacksOffWhileFeedIsDown(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	clock := &waitRecordingClock{fixedClock: fixedClock{now: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)}, limit: 6, cancel: cancel}
+
+	fetches := 0
+	deps := Deps{
+		FeedFetcher: FeedFetcherFunc(func(context.Context, string) ([]rss.RSSItem, error) {
+			fetches++
+			if fetches == 4 {
+				return nil, nil
+			}
+			return nil, errors.New("feed down")
+		}),
+		Publishers: map[string]Publisher{"mastodon": &recordingPublisher{}},
+		Store:      newMemStore(),
+		Notifier:   &recordingNotifier{},
+		Clock:      clock,
+	}
+	conf := config.Config{FeedURL: "memory://feed", Interval: 5, SocialSites: []string{"mastodon"}}
+	require.NoError(t, Start(ctx, conf, deps))
+
+	assert.Equal(t, []time.Duration{
+		5 * time.Minute, 10 * time.Minute, 20 * time.Minute, // failing
+		5 * time.Minute,                   // recovered
+		5 * time.Minute, 10 * time.Minute, // failing again
+	}, clock.waits, "a failed check waits for the interval, doubled while the feed stays down")
+	assert.Equal(t, 6, fetches)
+}
+
+func TestStart_WaitsForRetryAfter(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	clock := &waitRecordingClock{fixedClock: fixedClock{now: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)}, limit: 2, cancel: cancel}
+
+	deps := Deps{
+		FeedFetcher: FeedFetcherFunc(func(context.Context, string) ([]rss.RSSItem, error) {
+			return nil, &rss.StatusError{StatusCode: http.StatusServiceUnavailable, RetryAfter: 2 * time.Hour}
+		}),
+		Publishers: map[string]Publisher{"mastodon": &recordingPublisher{}},
+		Store:      newMemStore(),
+		Notifier:   &recordingNotifier{},
+		Clock:      clock,
+	}
+	conf := config.Config{FeedURL: "memory://feed", Interval: 5, SocialSites: []string{"mastodon"}}
+	require.NoError(t, Start(ctx, conf, deps))
+
+	assert.Equal(t, []time.Duration{2 * time.Hour, 2 * time.Hour}, clock.waits, "Retry-After outlasts the backoff")
+}
+
+// sleepingClock advances by every wait, and by jump on top of it, recording
+// the times it woke up at, and cancels after limit waits.
+type sleepingClock struct {
+	now    time.Time
+	jump   time.Duration
+	woke   []time.Time
+	limit  int
+	cancel context.CancelFunc
+}
+
+func (c *sleepingClock) Now() time.Time { return c.now }
+func (c *sleepingClock) After(d time.Duration) <-chan time.Time {
+	c.now = c.now.Add(d + c.jump)
+	c.woke = append(c.woke, c.now)
+	if len(c.woke) >= c.limit {
+		c.cancel()
+	}
+	ch := make(chan time.Time, 1)
+	ch <- c.now
+	return ch
+}
+
+func TestStart_FollowsCheckSchedule(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// Friday evening, after the last scheduled check of the week.
+	clock := &sleepingClock{now: time.Date(2026, 1, 2, 20, 50, 0, 0, time.UTC), limit: 3, cancel: cancel}
+
+	fetches := 0
+	deps := Deps{
+		FeedFetcher: FeedFetcherFunc(func(context.Context, string) ([]rss.RSSItem, error) {
+			fetches++
+			return nil, nil
+		}),
+		Publishers: map[string]Publisher{"mastodon": &recordingPublisher{}},
+		Store:      newMemStore(),
+		Notifier:   &recordingNotifier{},
+		Clock:      clock,
+	}
+	conf := config.Config{
+		FeedURL:       "memory://feed",
+		Interval:      60,
+		CheckSchedule: "*/15 8-20 * * MON-FRI",
+		Timezone:      "UTC",
+		SocialSites:   []string{"mastodon"},
+	}
+	require.NoError(t, Start(ctx, conf, deps))
+
+	assert.Equal(t, []time.Time{
+		time.Date(2026, 1, 5, 8, 0, 0, 0, time.UTC),
+		time.Date(2026, 1, 5, 8, 15, 0, 0, time.UTC),
+		time.Date(2026, 1, 5, 8, 30, 0, 0, time.UTC),
+	}, clock.woke)
+	assert.Equal(t, 2, fetches, "nothing is fetched before the first scheduled check")
+}
+
+func TestStart_LimitsPostsAfterClockJump(t *testing.T) {
+	metrics.Default.Reset()
+	t.Cleanup(metrics.Default.Reset)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// The machine was suspended for a night during the wait.
+	clock := &sleepingClock{now: time.Date(2026, 1, 1, 20, 0, 0, 0, time.UTC), jump: 10 * time.Hour, limit: 2, cancel: cancel}
+
+	fetches := 0
+	masto := &recordingPublisher{}
+	deps := Deps{
+		FeedFetcher: FeedFetcherFunc(func(context.Context, string) ([]rss.RSSItem, error) {
+			fetches++
+			if fetches == 1 {
+				return nil, nil
+			}
+			return []rss.RSSItem{
+				{Title: "One", Link: "https://example.com/one"},
+				{Title: "Two", Link: "https://example.com/two"},
+				{Title: "Three", Link: "https://example.com/three"},
+			}, nil
+		}),
+		Publishers: map[string]Publisher{"mastodon": masto},
+		Store:      newMemStore(),
+		Notifier:   &recordingNotifier{},
+		Clock:      clock,
+	}
+	conf := config.Config{FeedURL: "memory://feed", Interval: 60, ClockJumpMaxPosts: 1, SocialSites: []string{"mastodon"}}
+	require.NoError(t, Start(ctx, conf, deps))
+
+	assert.Equal(t, 2, fetches)
+	assert.Len(t, masto.contents, 1, "the backlog is not posted at once after the jump")
+	assert.Equal(t, int64(1), metrics.Default.Snapshot()[metrics.ClockJumps])
+}
+
+func TestStart_ShortRunStopsAfterFeedError(t *testing.T) {
+	fetches := 0
+	deps := Deps{
+		FeedFetcher: FeedFetcherFunc(func(context.Context, string) ([]rss.RSSItem, error) {
+			fetches++
+			return nil, errors.New("feed down")
+		}),
+		Publishers: map[string]Publisher{"mastodon": &recordingPublisher{}},
+		Store:      newMemStore(),
+		Notifier:   &recordingNotifier{},
+		Clock:      fixedClock{},
+	}
+	conf := config.Config{FeedURL: "memory://feed", Interval: 5, ShortRun: true, SocialSites: []string{"mastodon"}}
+	require.NoError(t, Start(context.Background(), conf, deps))
+	assert.Equal(t, 1, fetches)
+}
+
+func TestRunOnce_EmitsEvents(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	var events strings.Builder
+
+	conf := config.Config{
+		FeedURL:       "memory://feed",
+		SocialSites:   []string{"mastodon", "bluesky"},
+		BlueskyHandle: "test.bsky.social",
+		BlueskyAppKey: "app-key",
+	}
+	deps := Deps{
+		FeedFetcher: staticFeed(rss.RSSItem{Title: "Hello", Link: "https://example.com/hello"}),
+		Publishers: map[string]Publisher{
+			"mastodon": &recordingPublisher{},
+			"bluesky":  &recordingPublisher{err: errors.New("rate limited")},
+		},
+		Store:    newMemStore(),
+		Notifier: &recordingNotifier{},
+		Clock:    fixedClock{now: now},
+		Events:   &events,
+	}
+
+	require.NoError(t, RunOnce(context.Background(), conf, deps))
+
+	var got []StreamEvent
+	for _, line := range strings.Split(strings.TrimSpace(events.String()), "\n") {
+		var ev StreamEvent
+		require.NoError(t, json.Unmarshal([]byte(line), &ev), line)
+		assert.True(t, ev.Time.Equal(now))
+		ev.Time = time.Time{}
+		got = append(got, ev)
+	}
+	assert.Equal(t, []StreamEvent{
+		{Event: EventFeedFetched, Action: db.ActionFetched, Link: "memory://feed", Detail: "1 items"},
+		{Event: EventPostDetected, Link: "https://example.com/hello", Title: "Hello", Detail: "new"},
+		{Event: EventPublished, Action: db.ActionPublished, Site: "mastodon", Link: "https://example.com/hello"},
+		{Event: EventFailed, Action: db.ActionFailed, Site: "bluesky", Link: "https://example.com/hello", Detail: "rate limited"},
+	}, got)
+}
+
+func TestCheck_ReturnsOutcome(t *testing.T) {
+	conf := config.Config{
+		FeedURL:       "memory://feed",
+		SocialSites:   []string{"mastodon", "bluesky"},
+		BlueskyHandle: "test.bsky.social",
+		BlueskyAppKey: "app-key",
+	}
+	deps := Deps{
+		FeedFetcher: staticFeed(
+			rss.RSSItem{Title: "One", Link: "https://example.com/one"},
+			rss.RSSItem{Title: "Two", Link: "https://example.com/two"},
+		),
+		Publishers: map[string]Publisher{
+			"mastodon": &recordingPublisher{},
+			"bluesky":  &recordingPublisher{err: errors.New("bluesky down")},
+		},
+		Store:    newMemStore(),
+		Notifier: &recordingNotifier{},
+		Clock:    fixedClock{now: time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)},
+	}
+
+	outcome, err := Check(context.Background(), conf, deps)
+	require.NoError(t, err)
+	assert.Equal(t, Outcome{Published: 2, Failed: 2}, outcome)
+
+	deps.FeedFetcher = FeedFetcherFunc(func(context.Context, string) ([]rss.RSSItem, error) {
+		return nil, errors.New("connection refused")
+	})
+	outcome, err = Check(context.Background(), conf, deps)
+	var feedErr *FeedError
+	require.ErrorAs(t, err, &feedErr)
+	assert.Equal(t, "memory://feed", feedErr.URL)
+	assert.Zero(t, outcome)
+}
+
+func TestRunOnce_AnnotatesGitHubActions(t *testing.T) {
+	summary := filepath.Join(t.TempDir(), "summary.md")
+	t.Setenv(ghactions.SummaryEnv, summary)
+	var out strings.Builder
+
+	conf := config.Config{
+		FeedURL:       "memory://feed",
+		SocialSites:   []string{"mastodon", "bluesky"},
+		BlueskyHandle: "test.bsky.social",
+		BlueskyAppKey: "app-key",
+		GitHubActions: true,
+	}
+	deps := Deps{
+		FeedFetcher: staticFeed(rss.RSSItem{Title: "Hello", Link: "https://example.com/hello"}),
+		Publishers: map[string]Publisher{
+			"mastodon": &recordingPublisher{},
+			"bluesky":  &recordingPublisher{err: errors.New("rate limited")},
+		},
+		Store:    newMemStore(),
+		Notifier: &recordingNotifier{},
+		Clock:    fixedClock{now: time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)},
+		actions:  ghactions.New(&out),
+	}
+
+	require.NoError(t, RunOnce(context.Background(), conf, deps))
+	assert.Equal(t,
+		"::notice title=Published to Mastodon::https://example.com/hello\n"+
+			"::error title=Publishing to Bluesky failed::https://example.com/hello: rate limited\n",
+		out.String())
+
+	got, err := os.ReadFile(summary)
+	require.NoError(t, err)
+	assert.Contains(t, string(got), "| published | Mastodon | https://example.com/hello |  |\n")
+	assert.Contains(t, string(got), "| failed | Bluesky | https://example.com/hello | rate limited |\n")
+}
+
+func TestRunOnce_RotatesFooters(t *testing.T) {
+	conf := config.Config{
+		FeedURL:            "memory://feed",
+		SocialSites:        []string{"mastodon", "bluesky"},
+		BlueskyHandle:      "test.bsky.social",
+		BlueskyAppKey:      "app-key",
+		FooterLines:        []string{"Support me on Ko-fi", "Get the newsletter"},
+		FooterEvery:        2,
+		BlueskyFooterLines: []string{config.FooterNone},
+	}
+	var items []rss.RSSItem
+	for i := range 5 {
+		items = append(items, rss.RSSItem{Title: fmt.Sprintf("Post %d", i), Link: fmt.Sprintf("https://example.com/%d", i)})
+	}
+	masto, bsky := &recordingPublisher{}, &recordingPublisher{}
+	deps := Deps{
+		FeedFetcher: staticFeed(items...),
+		Publishers:  map[string]Publisher{"mastodon": masto, "bluesky": bsky},
+		Store:       newMemStore(),
+		Notifier:    &recordingNotifier{},
+		Clock:       fixedClock{now: time.Now()},
+	}
+
+	require.NoError(t, RunOnce(context.Background(), conf, deps))
+
+	require.Len(t, masto.contents, 5)
+	for i, content := range masto.contents {
+		switch i {
+		case 1:
+			assert.True(t, strings.HasSuffix(content, "\n\nSupport me on Ko-fi"), content)
+		case 3:
+			assert.True(t, strings.HasSuffix(content, "\n\nGet the newsletter"), content)
+		default:
+			assert.NotContains(t, content, "\n\n", "only every second post gets a footer")
+		}
+	}
+	require.Len(t, bsky.contents, 5)
+	for _, content := range bsky.contents {
+		assert.NotContains(t, content, "\n\n", "Bluesky has footers disabled")
+	}
+}
+
+// variantStore is a memStore recording template variants.
+type variantStore struct {
+	*memStore
+	variants map[string]string
+}
+
+func (s *variantStore) SetSiteVariant(link, site, variant string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.variants[site+" "+link] = variant
+	return nil
+}
+
+func TestRunOnce_RecordsTemplateVariants(t *testing.T) {
+	conf := config.Config{
+		FeedURL:       "memory://feed",
+		SocialSites:   []string{"mastodon", "bluesky"},
+		BlueskyHandle: "test.bsky.social",
+		BlueskyAppKey: "app-key",
+		TemplateVariants: []string{
+			"short=Short: {{.Link}}",
+			"teaser={{.Title}}: {{.Link}}",
+			"bluesky/plain={{.Link}}",
+		},
+	}
+	var items []rss.RSSItem
+	for i := range 6 {
+		items = append(items, rss.RSSItem{Title: fmt.Sprintf("Post %d", i), Link: fmt.Sprintf("https://example.com/%d", i)})
+	}
+	masto, bsky := &recordingPublisher{}, &recordingPublisher{}
+	store := &variantStore{memStore: newMemStore(), variants: make(map[string]string)}
+	deps := Deps{
+		FeedFetcher: staticFeed(items...),
+		Publishers:  map[string]Publisher{"mastodon": masto, "bluesky": bsky},
+		Store:       store,
+		Notifier:    &recordingNotifier{},
+		Clock:       fixedClock{now: time.Now()},
+	}
+
+	require.NoError(t, RunOnce(context.Background(), conf, deps))
+
+	require.Len(t, masto.contents, 6)
+	for _, content := range masto.contents {
+		assert.True(t, strings.HasPrefix(content, "Short: ") || strings.HasPrefix(content, "Post "), content)
+	}
+	require.Len(t, bsky.contents, 6)
+	for _, content := range bsky.contents {
+		assert.True(t, strings.HasPrefix(content, "https://"), content)
+	}
+	for _, item := range items {
+		v, _ := posttemplate.SelectVariant(conf, "mastodon", item)
+		assert.Equal(t, v.Name, store.variants["mastodon "+item.Link])
+		assert.Equal(t, "plain", store.variants["bluesky "+item.Link])
+	}
+}
+
+func TestRunOnce_HoldsBackItemsUntilLinkIsLive(t *testing.T) {
+	masto := &recordingPublisher{}
+	store := newMemStore()
+	clock := &steppingClock{now: time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)}
+	published := clock.now.Add(-5 * time.Minute)
+	live := map[string]bool{}
+	var checked []string
+
+	conf := config.Config{
+		FeedURL:               "memory://feed",
+		SocialSites:           []string{"mastodon"},
+		LinkCheck:             true,
+		LinkCheckGraceMinutes: 30,
+	}
+	deps := Deps{
+		FeedFetcher: staticFeed(
+			rss.RSSItem{Title: "Lagging", Link: "https://example.com/lagging", PubDate: published.Format(time.RFC1123Z)},
+			rss.RSSItem{Title: "Dead", Link: "https://example.com/dead", PubDate: published.Format(time.RFC1123Z)},
+		),
+		Publishers: map[string]Publisher{"mastodon": masto},
+		Store:      store,
+		Notifier:   &recordingNotifier{},
+		Clock:      clock,
+		LinkChecker: LinkCheckerFunc(func(_ context.Context, _ config.Config, link string) error {
+			checked = append(checked, link)
+			if !live[link] {
+				return errors.New("unexpected HTTP status: 404")
+			}
+			return nil
+		}),
+	}
+
+	require.NoError(t, RunOnce(context.Background(), conf, deps))
+	assert.Empty(t, masto.contents, "pages that are not live are held back")
+	assert.Equal(t, db.ActionHeldBack, store.events[len(store.events)-1].Action)
+
+	live["https://example.com/lagging"] = true
+	clock.now = clock.now.Add(10 * time.Minute)
+	require.NoError(t, RunOnce(context.Background(), conf, deps))
+	assert.Equal(t, []string{"New post: https://example.com/lagging"}, masto.contents)
+
+	clock.now = published.Add(31 * time.Minute)
+	checked = nil
+	require.NoError(t, RunOnce(context.Background(), conf, deps))
+	assert.Equal(t, []string{"New post: https://example.com/lagging", "New post: https://example.com/dead"}, masto.contents, "published anyway after the grace period")
+	assert.Equal(t, []string{"https://example.com/dead"}, checked, "published items are not checked again")
+}
+
+func TestRunOnce_UsesCanonicalLinks(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/proxy/1", "/proxy/1-again":
+			fmt.Fprint(w, `<html><head><link rel="canonical" href="https://blog.example.com/1"></head></html>`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	masto := &recordingPublisher{}
+	store := newMemStore()
+	conf := config.Config{
+		FeedURL:        "memory://feed",
+		SocialSites:    []string{"mastodon"},
+		CanonicalLinks: true,
+	}
+	deps := Deps{
+		FeedFetcher: staticFeed(
+			rss.RSSItem{Title: "One", Link: srv.URL + "/proxy/1"},
+			rss.RSSItem{Title: "One again", Link: srv.URL + "/proxy/1-again"},
+			rss.RSSItem{Title: "Gone", Link: srv.URL + "/proxy/2"},
+		),
+		Publishers: map[string]Publisher{"mastodon": masto},
+		Store:      store,
+		Notifier:   &recordingNotifier{},
+		Clock:      fixedClock{now: time.Now()},
+	}
+
+	require.NoError(t, RunOnce(context.Background(), conf, deps))
+	assert.Equal(t, []string{
+		"New post: https://blog.example.com/1",
+		"New post: " + srv.URL + "/proxy/2",
+	}, masto.contents, "links resolving to the same canonical URL are posted once; unresolvable links are kept")
+	assert.Contains(t, store.hashes, "https://blog.example.com/1")
+	assert.NotContains(t, store.hashes, srv.URL+"/proxy/1")
+}
+
+// enrichmentStore is a memStore that caches page lookups.
+type enrichmentStore struct {
+	*memStore
+	enrichments map[string]db.Enrichment
+}
+
+func (s *enrichmentStore) CachedEnrichment(guid, kind string, since time.Time) (string, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.enrichments[guid+" "+kind]
+	if !ok || e.FetchedAt.Before(since) {
+		return "", false, nil
+	}
+	return e.Value, true, nil
+}
+
+func (s *enrichmentStore) SaveEnrichment(guid, kind, value string, fetched time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.enrichments[guid+" "+kind] = db.Enrichment{GUID: guid, Kind: kind, Value: value, FetchedAt: fetched}
+	return nil
+}
+
+func (s *enrichmentStore) PruneEnrichments(before time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var n int64
+	for key, e := range s.enrichments {
+		if e.FetchedAt.Before(before) {
+			delete(s.enrichments, key)
+			n++
+		}
+	}
+	return n, nil
+}
+
+func TestRunOnce_CachesPageLookups(t *testing.T) {
+	var mu sync.Mutex
+	fetches := map[string]int{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		fetches[r.URL.Path]++
+		mu.Unlock()
+		fmt.Fprint(w, `<html><head><link rel="canonical" href="/1"><meta name="description" content="Excerpt"></head></html>`)
+	}))
+	defer srv.Close()
+
+	clock := &steppingClock{now: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)}
+	masto := &recordingPublisher{err: errors.New("mastodon down")}
+	// Bluesky stays down, so that the item is prepared on every cycle.
+	bsky := &recordingPublisher{err: errors.New("bluesky down")}
+	store := &enrichmentStore{memStore: newMemStore(), enrichments: map[string]db.Enrichment{}}
+	conf := config.Config{
+		FeedURL:              "memory://feed",
+		SocialSites:          []string{"mastodon", "bluesky"},
+		BlueskyHandle:        "me.example.com",
+		BlueskyAppKey:        "app-key",
+		PostTemplate:         "{{.Content}} {{.Link}}",
+		ContentSources:       []string{"page"},
+		CanonicalLinks:       true,
+		EnrichmentCacheHours: 24,
+	}
+	deps := Deps{
+		FeedFetcher: staticFeed(rss.RSSItem{Title: "One", Link: srv.URL + "/proxy/1", GUID: "post-1"}),
+		Publishers:  map[string]Publisher{"mastodon": masto, "bluesky": bsky},
+		Store:       store,
+		Notifier:    &recordingNotifier{},
+		Clock:       clock,
+	}
+
+	require.NoError(t, RunOnce(context.Background(), conf, deps))
+	require.NoError(t, RunOnce(context.Background(), conf, deps))
+	masto.err = nil
+	require.NoError(t, RunOnce(context.Background(), conf, deps))
+	assert.Equal(t, []string{"Excerpt " + srv.URL + "/1"}, masto.contents)
+	assert.Equal(t, map[string]int{"/proxy/1": 1, "/1": 1}, fetches, "the canonical URL and the excerpt are fetched once")
+	assert.Contains(t, store.enrichments, "post-1 canonical")
+	assert.Contains(t, store.enrichments, "post-1 page")
+
+	clock.now = clock.now.Add(25 * time.Hour)
+	require.NoError(t, RunOnce(context.Background(), conf, deps))
+	assert.Equal(t, map[string]int{"/proxy/1": 2, "/1": 2}, fetches, "expired lookups are fetched again")
+	assert.Equal(t, clock.now, store.enrichments["post-1 page"].FetchedAt)
+}
+
+// highWaterStore is a memStore that keeps the high-water marks of feeds.
+type highWaterStore struct {
+	*memStore
+	marks map[string]time.Time
+}
+
+func (s *highWaterStore) HighWaterMark(feed string) (time.Time, error) { return s.marks[feed], nil }
+
+func (s *highWaterStore) RaiseHighWaterMark(feed string, published time.Time) error {
+	if s.marks[feed].Before(published) {
+		s.marks[feed] = published
+	}
+	return nil
+}
+
+func TestRunOnce_HighWaterMark(t *testing.T) {
+	clock := &steppingClock{now: time.Date(2026, 1, 10, 0, 0, 0, 0, time.UTC)}
+	masto := &recordingPublisher{}
+	store := &highWaterStore{memStore: newMemStore(), marks: map[string]time.Time{}}
+	conf := config.Config{FeedURL: "memory://feed", SocialSites: []string{"mastodon"}, ReplayProtection: true}
+	old := rss.RSSItem{Title: "Old", Link: "https://example.com/old", PubDate: "Thu, 01 Jan 2026 10:00:00 +0000"}
+	newer := rss.RSSItem{Title: "Newer", Link: "https://example.com/newer", PubDate: "Mon, 05 Jan 2026 10:00:00 +0000"}
+	future := rss.RSSItem{Title: "Future", Link: "https://example.com/future", PubDate: "Sat, 10 Jan 2099 10:00:00 +0000"}
+	deps := Deps{
+		FeedFetcher: staticFeed(old, newer, future),
+		Publishers:  map[string]Publisher{"mastodon": masto},
+		Store:       store,
+		Notifier:    &recordingNotifier{},
+		Clock:       clock,
+	}
+	links := func() []string {
+		var links []string
+		for _, p := range masto.posts {
+			links = append(links, p.Link)
+		}
+		return links
+	}
+
+	require.NoError(t, RunOnce(context.Background(), conf, deps))
+	assert.Equal(t, []string{old.Link, newer.Link, future.Link}, links())
+	assert.Equal(t, clock.now, store.marks[conf.FeedURL], "the mark is not raised beyond now")
+
+	// The posts are pruned from the database.
+	store.memStore = newMemStore()
+	deps.Store = store
+	clock.now = clock.now.Add(time.Hour)
+	later := rss.RSSItem{Title: "Later", Link: "https://example.com/later", PubDate: "Sat, 10 Jan 2026 00:30:00 +0000"}
+	deps.FeedFetcher = staticFeed(old, newer, later)
+	outcome, err := Check(context.Background(), conf, deps)
+	require.NoError(t, err)
+	assert.Equal(t, []string{old.Link, newer.Link, future.Link, later.Link}, links(), "only items after the mark are posted again")
+	assert.Equal(t, 2, outcome.Suppressed)
+	assert.Equal(t, int64(2), metrics.LastCycle()[metrics.HighWaterSuppressed])
+	assert.Contains(t, store.events, db.Event{Action: db.ActionSkippedFilter, Link: old.Link, Detail: "pubDate before high-water mark"})
+
+	store.memStore = newMemStore()
+	deps.Store = store
+	conf.ReplayProtection = false
+	deps.FeedFetcher = staticFeed(old)
+	require.NoError(t, RunOnce(context.Background(), conf, deps))
+	assert.Equal(t, old.Link, links()[4], "without replay protection the mark is ignored")
+}
+
+// pinningPublisher is a recordingPublisher that also records pins.
+type pinningPublisher struct {
+	recordingPublisher
+	pins, unpins []string
+}
+
+func (p *pinningPublisher) Pin(_ context.Context, _ config.Config, id string) error {
+	p.pins = append(p.pins, id)
+	return nil
+}
+
+func (p *pinningPublisher) Unpin(_ context.Context, _ config.Config, id string) error {
+	p.unpins = append(p.unpins, id)
+	return nil
+}
+
+// pinStore is a memStore recording pinned posts.
+type pinStore struct {
+	*memStore
+	pinned []string
+}
+
+func (s *pinStore) MastodonPinnedPosts() ([]string, error) { return slices.Clone(s.pinned), nil }
+
+func (s *pinStore) SetMastodonPinned(link string, pinned bool) error {
+	s.pinned = slices.DeleteFunc(s.pinned, func(l string) bool { return l == link })
+	if pinned {
+		s.pinned = append(s.pinned, link)
+	}
+	return nil
+}
+
+func TestRunOnce_PinsLatestMastodonPost(t *testing.T) {
+	masto := &pinningPublisher{}
+	store := &pinStore{memStore: newMemStore()}
+	conf := config.Config{
+		FeedURL:           "memory://feed",
+		SocialSites:       []string{"mastodon"},
+		MastodonPinLatest: true,
+	}
+	deps := Deps{
+		FeedFetcher: staticFeed(
+			rss.RSSItem{Title: "One", Link: "https://example.com/1"},
+			rss.RSSItem{Title: "Two", Link: "https://example.com/2"},
+		),
+		Publishers: map[string]Publisher{"mastodon": masto},
+		Store:      store,
+		Notifier:   &recordingNotifier{},
+		Clock:      fixedClock{now: time.Now()},
+	}
+
+	require.NoError(t, RunOnce(context.Background(), conf, deps))
+	assert.Equal(t, []string{"id-1", "id-2"}, masto.pins)
+	assert.Equal(t, []string{"id-1"}, masto.unpins, "the earlier post is unpinned once the newer one is pinned")
+	assert.Equal(t, []string{"https://example.com/2"}, store.pinned)
+	assert.Equal(t, db.ActionPinned, store.events[len(store.events)-1].Action)
+
+	conf.MastodonPinLatest = false
+	deps.FeedFetcher = staticFeed(rss.RSSItem{Title: "Three", Link: "https://example.com/3"})
+	require.NoError(t, RunOnce(context.Background(), conf, deps))
+	assert.Len(t, masto.pins, 2, "nothing is pinned with the option off")
+}
@@ -0,0 +1,73 @@
+package rss2socials
+
+import (
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/toozej/rss2socials/internal/content"
+	"github.com/toozej/rss2socials/pkg/config"
+)
+
+// enrichmentCanonical is the kind of enrichment the canonical URL of the
+// page of an item is cached as. The content sources are cached under their
+// own names.
+const enrichmentCanonical = "canonical"
+
+// enrichmentCache is the content.Cache of a Store that implements
+// EnrichmentStore, keeping results for ttl.
+type enrichmentCache struct {
+	store EnrichmentStore
+	clock Clock
+	ttl   time.Duration
+}
+
+// enrichmentCache returns the cache of page lookups for conf, or nil when
+// EnrichmentCacheHours is zero or the Store cannot cache them.
+func (d Deps) enrichmentCache(conf *config.Config) content.Cache {
+	es, ok := d.Store.(EnrichmentStore)
+	if !ok || conf.EnrichmentCacheHours <= 0 {
+		return nil
+	}
+	return enrichmentCache{store: es, clock: d.Clock, ttl: time.Duration(conf.EnrichmentCacheHours) * time.Hour}
+}
+
+func (c enrichmentCache) Get(key, kind string) (string, bool) {
+	value, ok, err := c.store.CachedEnrichment(key, kind, c.clock.Now().Add(-c.ttl))
+	if err != nil {
+		log.Errorf("Failed to look up the cached %s of %s: %v", kind, key, err)
+		return "", false
+	}
+	if ok {
+		log.Debugf("Using the cached %s of %s", kind, key)
+	}
+	return value, ok
+}
+
+func (c enrichmentCache) Put(key, kind, value string) {
+	if err := c.store.SaveEnrichment(key, kind, value, c.clock.Now()); err != nil {
+		log.Errorf("Failed to cache the %s of %s: %v", kind, key, err)
+	}
+}
+
+// refreshCache is a content.Cache that fetches every page again and caches
+// the result, for items whose feed entry changed.
+type refreshCache struct{ content.Cache }
+
+func (refreshCache) Get(string, string) (string, bool) { return "", false }
+
+// pruneEnrichments removes cached page lookups older than cacheHours.
+func (d Deps) pruneEnrichments(cacheHours int) {
+	es, ok := d.Store.(EnrichmentStore)
+	if !ok || cacheHours <= 0 {
+		return
+	}
+	n, err := es.PruneEnrichments(d.Clock.Now().Add(-time.Duration(cacheHours) * time.Hour))
+	if err != nil {
+		log.Error("Failed to prune cached page lookups: ", err)
+		return
+	}
+	if n > 0 {
+		log.Debugf("Pruned %d cached page lookups older than %d hours", n, cacheHours)
+	}
+}
@@ -0,0 +1,104 @@
+package rss2socials
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/toozej/rss2socials/internal/db"
+	"github.com/toozej/rss2socials/internal/redact"
+)
+
+// Kinds of events in the event stream.
+const (
+	EventFeedFetched  = "feed_fetched"
+	EventPostDetected = "post_detected"
+	EventSkipped      = "skipped"
+	EventPublished    = "published"
+	EventFailed       = "failed"
+	EventDeleted      = "deleted"
+	// EventCredentials reports a check of the credentials of a site, with
+	// the problem found, if any, as its detail.
+	EventCredentials = "credentials_checked"
+)
+
+// streamKinds maps the actions of the audit trail to the kind of event they
+// are streamed as. The action itself is streamed along, to tell e.g. an
+// update from a new post.
+var streamKinds = map[string]string{
+	db.ActionFetched:            EventFeedFetched,
+	db.ActionSkippedFilter:      EventSkipped,
+	db.ActionSkippedDependency:  EventSkipped,
+	db.ActionSkippedBlocklist:   EventSkipped,
+	db.ActionHeldBack:           EventSkipped,
+	db.ActionPublished:          EventPublished,
+	db.ActionUpdated:            EventPublished,
+	db.ActionScheduled:          EventPublished,
+	db.ActionRepromoted:         EventPublished,
+	db.ActionPinned:             EventPublished,
+	db.ActionFailed:             EventFailed,
+	db.ActionDeadLettered:       EventFailed,
+	db.ActionDeleted:            EventDeleted,
+	db.ActionCredentialsChecked: EventCredentials,
+}
+
+// StreamEvent is a line of the event stream written to Deps.Events, for
+// composing rss2socials in pipelines or supervising it by its output.
+type StreamEvent struct {
+	Time  time.Time `json:"time"`
+	Event string    `json:"event"`
+	// Action is the audit trail action the event was recorded as, e.g.
+	// "updated" for a published event.
+	Action string `json:"action,omitempty"`
+	Site   string `json:"site,omitempty"`
+	Link   string `json:"link,omitempty"`
+	Title  string `json:"title,omitempty"`
+	// Detail is the error of a failed event, the reason of a skipped one,
+	// the ID of an updated or repromoted post, or "new" or "updated" for a
+	// detected post. Secrets are redacted.
+	Detail string `json:"detail,omitempty"`
+}
+
+// eventStream writes StreamEvents as newline-delimited JSON. It is safe for
+// concurrent use, and stops writing after the first error, e.g. once the
+// reading end of a pipe is closed.
+type eventStream struct {
+	mu     sync.Mutex
+	enc    *json.Encoder
+	broken bool
+}
+
+func newEventStream(w io.Writer) *eventStream {
+	return &eventStream{enc: json.NewEncoder(w)}
+}
+
+func (s *eventStream) write(ev StreamEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.broken {
+		return
+	}
+	if err := s.enc.Encode(ev); err != nil {
+		log.Errorf("Failed to write event, no further events are written: %v", err)
+		s.broken = true
+	}
+}
+
+// emit writes ev to the event stream and reports it to GitHub Actions, if
+// enabled.
+func (d Deps) emit(ev StreamEvent) {
+	if d.stream == nil && d.actions == nil {
+		return
+	}
+	ev.Time = d.Clock.Now()
+	ev.Detail = redact.String(ev.Detail)
+	if d.stream != nil {
+		d.stream.write(ev)
+	}
+	if d.actions != nil {
+		annotate(d.actions, ev)
+	}
+}
@@ -0,0 +1,70 @@
+package rss2socials
+
+import (
+	log "github.com/sirupsen/logrus"
+
+	"github.com/toozej/rss2socials/pkg/config"
+)
+
+// footerTurn returns the turn of the footer rotation the next new post
+// takes, counting from 1, or 0 when it gets no footer. Every FooterEvery-th
+// published post gets one, counted by the Store when it is a PostCounter.
+func (r *runner) footerTurn() int {
+	every := r.conf.FooterEvery
+	if every <= 0 || !hasFooters(&r.conf) {
+		return 0
+	}
+	n := r.newPosts
+	if pc, ok := r.deps.Store.(PostCounter); ok {
+		published, err := pc.CountPublished()
+		if err != nil {
+			log.Errorf("Failed to count published posts for the footer: %v", err)
+			return 0
+		}
+		n = published
+	}
+	// The next post is the (n+1)th.
+	if (n+1)%every != 0 {
+		return 0
+	}
+	return (n + 1) / every
+}
+
+// hasFooters reports whether any site has footer lines.
+func hasFooters(conf *config.Config) bool {
+	for _, site := range siteOrder {
+		if len(conf.SiteFooterLines(site)) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// siteContent returns the content of c as published to site, rendered with
+// the template variant of site when it has one: truncated to the post
+// length limit of site, with the line linking to the previous post and the
+// footer line of its turn appended when it has them and they fit.
+func siteContent(conf *config.Config, site string, c candidate) string {
+	content := c.content
+	if v, ok := c.variants[site]; ok {
+		content = v.content
+	}
+	if line := previousLine(conf, site, c); line != "" {
+		withPrevious := content + "\n\n" + line
+		if truncate(conf, site, withPrevious) == withPrevious {
+			content = withPrevious
+		} else {
+			log.Debugf("Leaving out the previous post on %s for %s: the post would be too long", siteNames[site], c.post.Link)
+		}
+	}
+	lines := conf.SiteFooterLines(site)
+	if c.footer == 0 || len(lines) == 0 {
+		return truncate(conf, site, content)
+	}
+	withFooter := content + "\n\n" + lines[(c.footer-1)%len(lines)]
+	if truncate(conf, site, withFooter) != withFooter {
+		log.Debugf("Leaving out the footer on %s for %s: the post would be too long", siteNames[site], c.post.Link)
+		return truncate(conf, site, content)
+	}
+	return withFooter
+}
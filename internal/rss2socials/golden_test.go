@@ -0,0 +1,95 @@
+package rss2socials
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/toozej/rss2socials/pkg/config"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files of TestGoldenFeeds")
+
+// TestGoldenFeeds runs snapshots of real-world feeds in testdata/feeds
+// through the pipeline and compares the posts every site receives with
+// testdata/golden. Run with -update after an intended change of the
+// output. Atom feeds, such as those of YouTube and GitHub releases, have no
+// items as far as the RSS parser is concerned.
+func TestGoldenFeeds(t *testing.T) {
+	feeds, err := filepath.Glob(filepath.Join("testdata", "feeds", "*.xml"))
+	require.NoError(t, err)
+	require.NotEmpty(t, feeds)
+
+	for _, feed := range feeds {
+		name := strings.TrimSuffix(filepath.Base(feed), ".xml")
+		t.Run(name, func(t *testing.T) {
+			abs, err := filepath.Abs(feed)
+			require.NoError(t, err)
+			publishers := map[string]*recordingPublisher{"mastodon": {}, "bluesky": {}, "threads": {}}
+			conf := config.Config{
+				FeedURL:             "file://" + abs,
+				SocialSites:         []string{"mastodon", "bluesky", "threads"},
+				BlueskyHandle:       "me.example.com",
+				BlueskyAppKey:       "app-key",
+				ThreadsToken:        "token",
+				ThreadsClientID:     "id",
+				ThreadsClientSecret: "secret",
+				ContentSources:      []string{"content:encoded", "description"},
+				PostTemplate:        `{{.Title}}: {{.Content | stripHTML | firstSentence | ellipsis 280}} {{.Link}}`,
+			}
+			deps := Deps{
+				Publishers: map[string]Publisher{},
+				Store:      newMemStore(),
+				Notifier:   &recordingNotifier{},
+				Clock:      fixedClock{now: time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC)},
+			}
+			for site, p := range publishers {
+				deps.Publishers[site] = p
+			}
+			require.NoError(t, RunOnce(context.Background(), conf, deps))
+
+			got := goldenPosts(t, publishers)
+			path := filepath.Join("testdata", "golden", name+".golden")
+			if *update {
+				require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+				require.NoError(t, os.WriteFile(path, []byte(got), 0o644))
+			}
+			want, err := os.ReadFile(path)
+			require.NoError(t, err, "run go test -run TestGoldenFeeds -update to create the golden file")
+			assert.Equal(t, string(want), got)
+		})
+	}
+}
+
+// goldenPosts describes the posts of publishers, one item after another.
+func goldenPosts(t *testing.T, publishers map[string]*recordingPublisher) string {
+	t.Helper()
+	masto := publishers["mastodon"].posts
+	var b strings.Builder
+	if len(masto) == 0 {
+		b.WriteString("no items\n")
+	}
+	for i, post := range masto {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "# %s\nlink: %s\ntags: %s\n", post.Title, post.Link, strings.Join(post.Tags, ", "))
+		for _, img := range post.Images {
+			fmt.Fprintf(&b, "image: %s %q\n", img.URL, img.Alt)
+		}
+		for _, site := range []string{"mastodon", "bluesky", "threads"} {
+			posts := publishers[site].posts
+			require.Len(t, posts, len(masto), site)
+			fmt.Fprintf(&b, "--- %s\n%s\n", site, posts[i].Text)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,49 @@
+package rss2socials
+
+import (
+	log "github.com/sirupsen/logrus"
+
+	"github.com/toozej/rss2socials/internal/rss"
+	"github.com/toozej/rss2socials/pkg/config"
+)
+
+// belowHighWater reports whether post, which is not stored, is dated before
+// the high-water mark of the feed, so that it was published before and its
+// post has since been removed from the Store.
+func (d Deps) belowHighWater(conf *config.Config, post rss.RSSItem) bool {
+	hs, ok := d.Store.(HighWaterStore)
+	if !ok || !conf.ReplayProtection {
+		return false
+	}
+	published, err := post.ParsePubDate()
+	if err != nil {
+		return false
+	}
+	mark, err := hs.HighWaterMark(conf.FeedURL)
+	if err != nil {
+		log.Errorf("Failed to look up the high-water mark of the feed: %v", err)
+		return false
+	}
+	return published.Before(mark)
+}
+
+// raiseHighWater raises the high-water mark of the feed to the pubDate of
+// post, which was published to a site. It is not raised beyond now, so that
+// an item dated in the future does not hold back the items published until
+// then.
+func (d Deps) raiseHighWater(conf *config.Config, post rss.RSSItem) {
+	hs, ok := d.Store.(HighWaterStore)
+	if !ok || !conf.ReplayProtection {
+		return
+	}
+	published, err := post.ParsePubDate()
+	if err != nil {
+		return
+	}
+	if now := d.Clock.Now(); published.After(now) {
+		published = now
+	}
+	if err := hs.RaiseHighWaterMark(conf.FeedURL, published); err != nil {
+		log.Errorf("Failed to raise the high-water mark of the feed: %v", err)
+	}
+}
@@ -0,0 +1,214 @@
+package rss2socials
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/toozej/rss2socials/internal/rss"
+	"github.com/toozej/rss2socials/internal/testutil"
+	"github.com/toozej/rss2socials/pkg/config"
+)
+
+// integrationConfig returns a config wired to fake servers for every
+// supported site and Gotify.
+func integrationConfig(t *testing.T, feed *testutil.FeedServer, masto *testutil.MastodonServer, threadsSrv *testutil.ThreadsServer, gotifySrv *testutil.GotifyServer) config.Config {
+	t.Helper()
+	return config.Config{
+		FeedURL:              feed.URL,
+		Interval:             60,
+		DBPath:               filepath.Join(t.TempDir(), "integration.db"),
+		StoreContent:         true,
+		MastodonURL:          masto.URL,
+		MastodonClientKey:    "key",
+		MastodonClientSecret: "secret",
+		MastodonAccessToken:  "token",
+		BlueskyHandle:        "test.bsky.social",
+		BlueskyAppKey:        "app-key",
+		ThreadsToken:         "threads-token",
+		ThreadsClientID:      "threads-client-id",
+		ThreadsClientSecret:  "threads-client-secret",
+		ThreadsRedirectURI:   "https://example.com/callback",
+		ThreadsAPIURL:        threadsSrv.URL,
+		GotifyURL:            gotifySrv.URL,
+		GotifyToken:          "gotify-token",
+	}
+}
+
+func TestIntegration_RunOncePublishesToAllSites(t *testing.T) {
+	feed := testutil.NewFeedServer(t, testutil.Items(2, time.Now())...)
+	masto := testutil.NewMastodonServer(t)
+	bsky := testutil.NewBlueskyServer(t)
+	bsky.Route(t)
+	threadsSrv := testutil.NewThreadsServer(t)
+	gotifySrv := testutil.NewGotifyServer(t)
+
+	conf := integrationConfig(t, feed, masto, threadsSrv, gotifySrv)
+
+	require.NoError(t, RunOnce(context.Background(), conf, Deps{}))
+
+	// Items are published oldest first.
+	expected := []string{"New post: https://example.com/post-1", "New post: https://example.com/post-0"}
+	assert.Equal(t, expected, masto.Received())
+	assert.Equal(t, expected, bsky.Received())
+	assert.Equal(t, expected, threadsSrv.Received())
+	assert.Zero(t, gotifySrv.Count(), "no failures means no Gotify notifications")
+
+	// A second cycle with an unchanged feed publishes nothing new.
+	require.NoError(t, RunOnce(context.Background(), conf, Deps{}))
+	assert.Equal(t, 2, masto.Count())
+	assert.Equal(t, 2, bsky.Count())
+	assert.Equal(t, 2, threadsSrv.Count())
+}
+
+func TestIntegration_FailureNotifiesGotifyAndRetries(t *testing.T) {
+	feed := testutil.NewFeedServer(t, testutil.Items(1, time.Now())...)
+	masto := testutil.NewMastodonServer(t)
+	bsky := testutil.NewBlueskyServer(t)
+	bsky.Route(t)
+	threadsSrv := testutil.NewThreadsServer(t)
+	gotifySrv := testutil.NewGotifyServer(t)
+
+	conf := integrationConfig(t, feed, masto, threadsSrv, gotifySrv)
+	conf.SocialSites = []string{"mastodon"}
+
+	masto.SetFail(true)
+	require.NoError(t, RunOnce(context.Background(), conf, Deps{}))
+	assert.Zero(t, masto.Count())
+	require.Equal(t, 1, gotifySrv.Count())
+	assert.Equal(t, "Failed to post to Mastodon: Post 0", gotifySrv.Received()[0])
+	assert.Contains(t, gotifySrv.Payloads()[0]["message"], "https://example.com/post-0")
+
+	masto.SetFail(false)
+	require.NoError(t, RunOnce(context.Background(), conf, Deps{}))
+	assert.Equal(t, []string{"New post: https://example.com/post-0"}, masto.Received())
+}
+
+func TestIntegration_ThreadsFailureNotifiesGotify(t *testing.T) {
+	feed := testutil.NewFeedServer(t, testutil.Items(1, time.Now())...)
+	masto := testutil.NewMastodonServer(t)
+	threadsSrv := testutil.NewThreadsServer(t)
+	gotifySrv := testutil.NewGotifyServer(t)
+
+	conf := integrationConfig(t, feed, masto, threadsSrv, gotifySrv)
+	conf.SocialSites = []string{"mastodon", "threads"}
+
+	threadsSrv.SetFail(true)
+	require.NoError(t, RunOnce(context.Background(), conf, Deps{}))
+	assert.Equal(t, 1, masto.Count())
+	require.Equal(t, 1, gotifySrv.Count())
+	assert.Equal(t, "Failed to post to Threads: Post 0", gotifySrv.Received()[0])
+	message, _ := gotifySrv.Payloads()[0]["message"].(string)
+	assert.Contains(t, message, "Mastodon: published")
+	assert.Contains(t, message, "Threads: failed:")
+	assert.Contains(t, message, "https://example.com/post-0")
+}
+
+func TestIntegration_RunOnceWithCustomFeedFetcher(t *testing.T) {
+	masto := testutil.NewMastodonServer(t)
+
+	conf := config.Config{
+		FeedURL:              "memory://feed",
+		DBPath:               filepath.Join(t.TempDir(), "integration.db"),
+		MastodonURL:          masto.URL,
+		MastodonClientKey:    "key",
+		MastodonClientSecret: "secret",
+		MastodonAccessToken:  "token",
+	}
+	deps := Deps{
+		FeedFetcher: FeedFetcherFunc(func(_ context.Context, feedURL string) ([]rss.RSSItem, error) {
+			return []rss.RSSItem{{Title: "In memory", Link: "https://example.com/in-memory"}}, nil
+		}),
+	}
+
+	require.NoError(t, RunOnce(context.Background(), conf, deps))
+	assert.Equal(t, []string{"New post: https://example.com/in-memory"}, masto.Received())
+
+	deps.FeedFetcher = FeedFetcherFunc(func(_ context.Context, feedURL string) ([]rss.RSSItem, error) {
+		return nil, fmt.Errorf("feed unavailable")
+	})
+	assert.EqualError(t, RunOnce(context.Background(), conf, deps), "feed unavailable")
+}
+
+func TestIntegration_DeletePostRemovesBlueskyRecord(t *testing.T) {
+	feed := testutil.NewFeedServer(t, testutil.Items(1, time.Now())...)
+	masto := testutil.NewMastodonServer(t)
+	bsky := testutil.NewBlueskyServer(t)
+	bsky.Route(t)
+	threadsSrv := testutil.NewThreadsServer(t)
+	gotifySrv := testutil.NewGotifyServer(t)
+
+	conf := integrationConfig(t, feed, masto, threadsSrv, gotifySrv)
+	conf.SocialSites = []string{"bluesky"}
+
+	require.NoError(t, RunOnce(context.Background(), conf, Deps{}))
+	require.Equal(t, 1, bsky.Count())
+
+	require.NoError(t, DeletePost(context.Background(), conf, "https://example.com/post-0"))
+	assert.Len(t, bsky.Deleted(), 1)
+
+	// The link stays marked as posted so it is not republished.
+	require.NoError(t, RunOnce(context.Background(), conf, Deps{}))
+	assert.Equal(t, 1, bsky.Count())
+}
+
+func TestIntegration_MastodonEditUpdatesInPlace(t *testing.T) {
+	items := testutil.Items(1, time.Now())
+	feed := testutil.NewFeedServer(t, items...)
+	masto := testutil.NewMastodonServer(t)
+	threadsSrv := testutil.NewThreadsServer(t)
+	gotifySrv := testutil.NewGotifyServer(t)
+
+	conf := integrationConfig(t, feed, masto, threadsSrv, gotifySrv)
+	conf.SocialSites = []string{"mastodon"}
+	conf.MastodonEditUpdates = true
+
+	require.NoError(t, RunOnce(context.Background(), conf, Deps{}))
+	require.Equal(t, 1, masto.Count())
+
+	items[0].Content = "Revised content"
+	feed.SetItems(items...)
+	require.NoError(t, RunOnce(context.Background(), conf, Deps{}))
+
+	assert.Equal(t, 1, masto.Count(), "the update edits the original toot instead of posting a new one")
+	assert.Equal(t, map[string]string{"1": "Updated post: https://example.com/post-0 (added: Revised content)"}, masto.Edited())
+}
+
+func TestIntegration_ThreadsUpdateModes(t *testing.T) {
+	tests := []struct {
+		mode    string
+		targets []string
+	}{
+		{mode: config.ThreadsUpdatePost, targets: []string{"", ""}},
+		{mode: config.ThreadsUpdateReply, targets: []string{"", "reply:p1"}},
+		{mode: config.ThreadsUpdateQuote, targets: []string{"", "quote:p1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			items := testutil.Items(1, time.Now())
+			feed := testutil.NewFeedServer(t, items...)
+			masto := testutil.NewMastodonServer(t)
+			threadsSrv := testutil.NewThreadsServer(t)
+			gotifySrv := testutil.NewGotifyServer(t)
+
+			conf := integrationConfig(t, feed, masto, threadsSrv, gotifySrv)
+			conf.SocialSites = []string{"threads"}
+			conf.ThreadsUpdateMode = tt.mode
+
+			require.NoError(t, RunOnce(context.Background(), conf, Deps{}))
+
+			items[0].Content = "Revised content"
+			feed.SetItems(items...)
+			require.NoError(t, RunOnce(context.Background(), conf, Deps{}))
+
+			assert.Equal(t, []string{"New post: https://example.com/post-0", "Updated post: https://example.com/post-0 (added: Revised content)"}, threadsSrv.Received())
+			assert.Equal(t, tt.targets, threadsSrv.Targets())
+		})
+	}
+}
@@ -0,0 +1,793 @@
+package rss2socials
+
+import (
+	"context"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/toozej/rss2socials/internal/content"
+	"github.com/toozej/rss2socials/internal/db"
+	"github.com/toozej/rss2socials/internal/errreport"
+	"github.com/toozej/rss2socials/internal/metrics"
+	"github.com/toozej/rss2socials/internal/posttemplate"
+	"github.com/toozej/rss2socials/internal/rss"
+	"github.com/toozej/rss2socials/pkg/config"
+)
+
+// A cycle runs as a pipeline of stages, each in its own goroutine and
+// connected by unbuffered channels:
+//
+//	source → filter → transform → publish → record
+//
+// source emits the items of the fetched feed, oldest first. filter drops the
+// items that must not be posted. transform works out whether an item is new
+// or updated and renders its post, which may fetch the item's page. publish
+// stores the item and publishes it to every site, one item at a time, and
+// stops the pipeline on shutdown, when the cycle lock is lost or after
+// MaxPostsPerCycle items. record notifies the outcome.
+//
+// Each item has PostTimeoutSeconds to be transformed and published, the time
+// it waits between the stages aside. Once it runs out, what is left of its
+// requests is cancelled and the next item goes ahead.
+//
+// While an item is published, the next one is filtered and transformed, so
+// the Store and Notifier must be safe for concurrent use. A panic while an
+// item goes through a stage is recovered, reported and counted, and the item
+// is dropped from the cycle; a panic of a publisher counts as a failure to
+// publish to its site and is retried as such.
+
+// candidate is a feed item that passed the filter, with the post transform
+// rendered for it.
+type candidate struct {
+	post rss.RSSItem
+	// exists is set when the item is stored already, isUpdate when its
+	// content changed since.
+	exists   bool
+	isUpdate bool
+	content  string
+	// summary is the content of the item selected by ContentSources, as
+	// plain text.
+	summary string
+	// footer is the turn of the footer rotation the post takes, or 0
+	// when it gets no footer.
+	footer int
+	// previous is the latest earlier post in one of the categories of a
+	// new post, for Config.PreviousPost. Its Link is empty when there is
+	// none.
+	previous db.TootedPost
+	// parents are the IDs of the posts of the previous part of a series
+	// by site, which the post replies to with Config.SeriesThreading.
+	parents map[string]string
+	// variants are the template variants of new posts by site, for sites
+	// with variants.
+	variants map[string]variant
+	// budget is what is left of the item's PostTimeoutSeconds after it was
+	// transformed, or 0 when the time is not limited.
+	budget time.Duration
+}
+
+// variant is the content of a post rendered with a template variant.
+type variant struct {
+	name    string
+	content string
+}
+
+// result is the outcome of publishing a candidate.
+type result struct {
+	candidate
+	// attempted is set when publishing to at least one site was attempted,
+	// queued when a site holds the item back until its pubDate.
+	attempted bool
+	queued    bool
+	outcomes  []siteOutcome
+}
+
+// runPipeline runs the stages of the pipeline on posts and returns the
+// outcome of the publishes once every stage has finished.
+func (r *runner) runPipeline(ctx context.Context, posts []rss.RSSItem) Outcome {
+	ctx, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	stage := func(f func()) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// Items are guarded individually; this only catches a
+			// panic of the stage itself.
+			defer r.deps.recoverPanic(nil, errreport.Event{Message: "Panic in the check cycle pipeline", Tags: map[string]string{"feed": r.conf.FeedURL}})
+			f()
+		}()
+	}
+
+	items := make(chan rss.RSSItem)
+	admitted := make(chan rss.RSSItem)
+	candidates := make(chan candidate)
+	results := make(chan result)
+	stage(func() { source(ctx, posts, items) })
+	stage(func() { r.filter(ctx, items, admitted) })
+	stage(func() { r.deps.transform(ctx, &r.conf, admitted, candidates) })
+	stage(func() { r.publishCandidates(ctx, candidates, results) })
+	outcome := r.deps.record(&r.conf, results)
+
+	// publish may stop before its input is drained; the earlier stages are
+	// stopped with it.
+	cancel()
+	wg.Wait()
+	return outcome
+}
+
+// send sends v on out, reporting false when ctx is cancelled first.
+func send[T any](ctx context.Context, out chan<- T, v T) bool {
+	select {
+	case out <- v:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// source emits posts on out.
+func source(ctx context.Context, posts []rss.RSSItem, out chan<- rss.RSSItem) {
+	defer close(out)
+	for _, post := range posts {
+		if !send(ctx, out, post) {
+			return
+		}
+	}
+}
+
+// filter passes on the items of in that admit accepts.
+func (r *runner) filter(ctx context.Context, in <-chan rss.RSSItem, out chan<- rss.RSSItem) {
+	defer close(out)
+	seen := make(map[string]bool)
+	for post := range in {
+		if ctx.Err() != nil {
+			return
+		}
+		var admitted bool
+		r.deps.guard(&r.conf, "filter", post, func() {
+			post = r.canonicalize(ctx, post)
+			admitted = r.admit(post, seen)
+		})
+		if admitted && !send(ctx, out, post) {
+			return
+		}
+	}
+}
+
+// canonicalize replaces the link of post by the canonical URL of its page
+// with CanonicalLinks, keeping the feed link in FeedLink. Each feed link is
+// resolved once per runner, and items the Store knows keep the link they
+// are stored under, so that enabling CanonicalLinks does not publish them
+// again. When the page cannot be fetched or has no canonical URL, the feed
+// link is kept.
+func (r *runner) canonicalize(ctx context.Context, post rss.RSSItem) rss.RSSItem {
+	if !r.conf.CanonicalLinks || strings.TrimSpace(post.Link) == "" {
+		return post
+	}
+	link, ok := r.canonical[post.Link]
+	if !ok {
+		link = r.resolveLink(ctx, post)
+		if r.canonical == nil {
+			r.canonical = make(map[string]string)
+		}
+		r.canonical[post.Link] = link
+	}
+	if link != "" && link != post.Link {
+		log.Debugf("Using canonical URL %s for %s", link, post.Link)
+		post.FeedLink, post.Link = post.Link, link
+	}
+	return post
+}
+
+// resolveLink returns the link post is stored under, or else the canonical
+// URL of its page, or "" when there is none. Canonical URLs are cached by
+// the guid of post for EnrichmentCacheHours.
+func (r *runner) resolveLink(ctx context.Context, post rss.RSSItem) string {
+	feedLink := post.Link
+	if ls, ok := r.deps.Store.(LinkStore); ok {
+		stored, err := ls.StoredLink(feedLink)
+		if err != nil {
+			log.Errorf("Failed to look up the stored link of %s: %v", feedLink, err)
+		} else if stored != "" {
+			return stored
+		}
+	}
+	cache := r.deps.enrichmentCache(&r.conf)
+	if cache != nil {
+		if canonical, ok := cache.Get(post.Key(), enrichmentCanonical); ok {
+			return canonical
+		}
+	}
+	canonical, err := content.CanonicalURL(ctx, feedLink)
+	if err != nil {
+		log.Warnf("Error resolving the canonical URL of %s, using the feed link: %v", feedLink, err)
+		return canonical
+	}
+	if cache != nil {
+		cache.Put(post.Key(), enrichmentCanonical, canonical)
+	}
+	return canonical
+}
+
+// admit reports whether post may be posted: it has a link that did not
+// appear earlier in the feed, it matches the category filters, and with
+// PostNewEntriesOnly it was not published before startup. Rejected items are
+// counted, and recorded unless they are malformed.
+func (r *runner) admit(post rss.RSSItem, seen map[string]bool) bool {
+	conf := &r.conf
+	d := r.deps
+
+	if strings.TrimSpace(post.Link) == "" {
+		log.Warnf("Skipping malformed item %q: missing link", post.Title)
+		metrics.Inc(metrics.MalformedItems)
+		return false
+	}
+
+	// Items are published while later ones are transformed, so a link
+	// appearing twice would not be found in the Store the second time.
+	if seen[post.Link] {
+		log.Debugf("Skipping post %s: its link appears earlier in the feed", post.Title)
+		metrics.Inc(metrics.DuplicatesSuppressed)
+		return false
+	}
+	seen[post.Link] = true
+
+	if shouldSkipPost(post, conf.SkipPrefixCategories) {
+		log.Debugf("Skipping post %s: matches skip prefix category", post.Title)
+		metrics.Inc(metrics.FilteredSkipPrefix)
+		d.recordEvent(db.ActionSkippedFilter, "", post.Link, "skip prefix category")
+		return false
+	}
+
+	if conf.Category != "" && !matchesCategory(post, conf.Category, conf.CategoryFilterMode) {
+		log.Debugf("Skipping post %s: category filter '%s' matches neither URL segment '%s' nor categories %q (mode %s)", post.Title, conf.Category, path.Base(post.Link), post.Categories, conf.CategoryFilterMode)
+		metrics.Inc(metrics.FilteredCategory)
+		d.recordEvent(db.ActionSkippedFilter, "", post.Link, "category "+conf.Category)
+		return false
+	}
+
+	if domain, ok := linkDomainAllowed(post.Link, conf.LinkDomainAllowlist, conf.LinkDomainDenylist); !ok {
+		log.Debugf("Skipping post %s: link domain %s is not allowed", post.Link, domain)
+		metrics.Inc(metrics.FilteredDomain)
+		d.recordEvent(db.ActionSkippedFilter, "", post.Link, "domain "+domain)
+		return false
+	}
+
+	if len(conf.ExtensionFilters) > 0 && !matchesExtensions(post, conf.ExtensionFilters) {
+		log.Debugf("Skipping post %s: extension filters %v do not match", post.Title, conf.ExtensionFilters)
+		metrics.Inc(metrics.FilteredExtension)
+		d.recordEvent(db.ActionSkippedFilter, "", post.Link, "extension filters")
+		return false
+	}
+
+	if conf.PostNewEntriesOnly && post.PubDate != "" && !r.inFlight[post.Link] {
+		pubTime, err := post.ParsePubDate()
+		if err != nil {
+			log.Warnf("Could not parse pubDate %q for %s: %v", post.PubDate, post.Link, err)
+			metrics.Inc(metrics.UnparsablePubDates)
+		} else if pubTime.Before(r.startupTime) {
+			log.Infof("Skipping post %s: pubDate %s (%s) is before startup time %s", post.Link, post.PubDate, pubTime, r.startupTimeStr)
+			metrics.Inc(metrics.GatedPubDate)
+			d.recordEvent(db.ActionSkippedFilter, "", post.Link, "pubDate before startup")
+			return false
+		}
+	}
+	return true
+}
+
+// transform passes on the items of in that need publishing as candidates.
+func (d Deps) transform(ctx context.Context, conf *config.Config, in <-chan rss.RSSItem, out chan<- candidate) {
+	defer close(out)
+	timeout := postTimeout(conf)
+	for post := range in {
+		if ctx.Err() != nil {
+			return
+		}
+		skipIfExisting := conf.PostNewEntriesOnly && d.Store.IsFirstCycle()
+		var (
+			c  candidate
+			ok bool
+		)
+		start := time.Now()
+		itemCtx, cancel := withBudget(ctx, timeout)
+		d.guard(conf, "transform", post, func() { c, ok = d.prepare(itemCtx, post, conf, skipIfExisting) })
+		timedOut := outOfTime(ctx, itemCtx)
+		cancel()
+		if timeout > 0 {
+			c.budget = timeout - time.Since(start)
+			timedOut = timedOut || c.budget <= 0
+		}
+		if timedOut {
+			log.Warnf("Preparing %s took longer than %s: leaving it for the next cycle", post.Link, timeout)
+			continue
+		}
+		if ok && !send(ctx, out, c) {
+			return
+		}
+	}
+}
+
+// postTimeout returns the time an item may take to be transformed and
+// published, or 0 when it is not limited.
+func postTimeout(conf *config.Config) time.Duration {
+	return time.Duration(conf.PostTimeoutSeconds) * time.Second
+}
+
+// withBudget returns a context of ctx that is cancelled after budget, or
+// only with ctx when budget is 0.
+func withBudget(ctx context.Context, budget time.Duration) (context.Context, context.CancelFunc) {
+	if budget <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, budget)
+}
+
+// outOfTime reports whether itemCtx, derived from ctx with withBudget, ran
+// out of time while ctx itself is still live.
+func outOfTime(ctx, itemCtx context.Context) bool {
+	return ctx.Err() == nil && itemCtx.Err() == context.DeadlineExceeded
+}
+
+// prepare works out whether post is new, updated or published to every site
+// already, and renders the post for it. It reports false when there is
+// nothing to publish.
+func (d Deps) prepare(ctx context.Context, post rss.RSSItem, conf *config.Config, skipIfExisting bool) (candidate, bool) {
+	exists, updated, err := d.Store.HasPostChanged(post.Link, post.Content)
+	if err != nil {
+		log.Error("Database error: ", err)
+		return candidate{}, false
+	}
+
+	if skipIfExisting && exists && !updated {
+		log.Debugf("Skipping existing post %s: PostNewEntriesOnly enabled on first cycle", post.Link)
+		metrics.Inc(metrics.DuplicatesSuppressed)
+		return candidate{}, false
+	}
+
+	var isUpdate bool
+
+	switch {
+	case exists && updated:
+		log.Printf("Post has been updated: %s", post.Title)
+		isUpdate = true
+	case !exists:
+		if d.belowHighWater(conf, post) {
+			log.Infof("Skipping post %s: its pubDate %s is before the latest published item of the feed", post.Link, post.PubDate)
+			metrics.Inc(metrics.HighWaterSuppressed)
+			d.recordEvent(db.ActionSkippedFilter, "", post.Link, "pubDate before high-water mark")
+			return candidate{}, false
+		}
+		isUpdate = false
+	case exists && !updated:
+		if d.postedEverywhere(conf, post.Link) {
+			metrics.Inc(metrics.DuplicatesSuppressed)
+			return candidate{}, false
+		}
+		isUpdate = false
+	default:
+		return candidate{}, false
+	}
+
+	rendered := post
+	cache := d.enrichmentCache(conf)
+	if isUpdate && cache != nil {
+		cache = refreshCache{cache}
+	}
+	rendered.Content = content.Select(ctx, conf.ContentSources, conf.ContentMinChars, post, cache)
+	var tootContent string
+	if isUpdate {
+		diff := posttemplate.DiffContent(d.storedContent(post.Link), post.Content)
+		tootContent, err = posttemplate.RenderUpdate(*conf, rendered, diff)
+	} else {
+		tootContent, err = posttemplate.Render(*conf, rendered, false)
+	}
+	if err != nil {
+		log.Error("Rendering post failed: ", err)
+		return candidate{}, false
+	}
+	var variants map[string]variant
+	if !isUpdate {
+		if variants, err = renderVariants(conf, rendered); err != nil {
+			log.Error("Rendering post failed: ", err)
+			return candidate{}, false
+		}
+	}
+	detail := "new"
+	if isUpdate {
+		detail = "updated"
+	}
+	d.emit(StreamEvent{Event: EventPostDetected, Link: post.Link, Title: post.Title, Detail: detail})
+	return candidate{
+		post:     post,
+		exists:   exists,
+		isUpdate: isUpdate,
+		content:  tootContent,
+		summary:  posttemplate.StripHTML(rendered.Content),
+		variants: variants,
+	}, true
+}
+
+// postedEverywhere reports whether link was published to every enabled
+// and configured site. publishCandidate skips the other sites, so an item
+// published to all of these has nothing left to do and is not rendered
+// again on every cycle. Sites whose status cannot be looked up count as
+// published.
+func (d Deps) postedEverywhere(conf *config.Config, link string) bool {
+	for _, site := range conf.EnabledSites() {
+		if !siteConfigured(conf, site) {
+			continue
+		}
+		if posted, err := d.Store.IsSitePosted(link, site); err == nil && !posted {
+			return false
+		}
+	}
+	return true
+}
+
+// renderVariants renders item with the template variant selected for each
+// site that has variants.
+func renderVariants(conf *config.Config, item rss.RSSItem) (map[string]variant, error) {
+	var variants map[string]variant
+	for _, site := range siteOrder {
+		v, ok := posttemplate.SelectVariant(*conf, site, item)
+		if !ok {
+			continue
+		}
+		text, err := posttemplate.RenderVariant(*conf, item, v)
+		if err != nil {
+			return nil, err
+		}
+		if variants == nil {
+			variants = make(map[string]variant)
+		}
+		variants[site] = variant{name: v.Name, content: text}
+	}
+	return variants, nil
+}
+
+// storedContent returns the content link was last stored with, or an empty
+// string when the Store does not keep it.
+func (d Deps) storedContent(link string) string {
+	cs, ok := d.Store.(ContentStore)
+	if !ok {
+		return ""
+	}
+	content, err := cs.StoredContent(link)
+	if err != nil {
+		log.Errorf("Failed to look up the previous content of %s: %v", link, err)
+	}
+	return content
+}
+
+// publishCandidates publishes the candidates of in one at a time, until the
+// cycle is shut down, the cycle lock is lost or maxPosts candidates were
+// attempted.
+func (r *runner) publishCandidates(ctx context.Context, in <-chan candidate, out chan<- result) {
+	defer close(out)
+	conf := &r.conf
+	maxPosts := r.maxPosts()
+	publishedThisCycle := 0
+	for c := range in {
+		if ctx.Err() != nil {
+			log.Info("Shutdown signal received, stopping before next post")
+			return
+		}
+
+		if !r.lock() {
+			log.Warn("Lost the cycle lock, stopping before next post")
+			return
+		}
+
+		if maxPosts > 0 && publishedThisCycle >= maxPosts {
+			log.Infof("Reached the limit of %d post(s) per cycle: remaining items will be published in subsequent cycles", maxPosts)
+			return
+		}
+
+		if !c.exists {
+			c.footer = r.footerTurn()
+		}
+
+		var (
+			res result
+			ok  bool
+		)
+		itemCtx, cancel := withBudget(ctx, c.budget)
+		r.deps.guard(conf, "publish", c.post, func() { res, ok = r.deps.publishCandidate(itemCtx, conf, c, r.startupTimeStr) })
+		if outOfTime(ctx, itemCtx) {
+			log.Warnf("Publishing %s took longer than %s: the sites it did not reach are retried", c.post.Link, postTimeout(conf))
+		}
+		cancel()
+		if !ok {
+			continue
+		}
+		if res.attempted {
+			publishedThisCycle++
+			if !c.exists {
+				r.newPosts++
+			}
+		}
+		// The result is recorded even when the cycle is shut down
+		// meanwhile, as the item was published.
+		out <- res
+	}
+}
+
+// publishCandidate stores the item of c and publishes it to every enabled
+// social site that has not already received it. It reports false when the
+// item could not be stored.
+func (d Deps) publishCandidate(ctx context.Context, conf *config.Config, c candidate, startupTime string) (result, bool) {
+	post := c.post
+	if err := d.Store.StoreTootedPost(post.Link, post.Content, startupTime); err != nil {
+		log.Error("Storing post in database failed: ", err)
+		return result{}, false
+	}
+	if ls, ok := d.Store.(LinkStore); ok && post.FeedLink != "" {
+		if err := ls.SetFeedLink(post.Link, post.FeedLink); err != nil {
+			log.Errorf("Failed to store the feed link of %s: %v", post.Link, err)
+		}
+	}
+	if !c.isUpdate {
+		c.previous = d.previousPost(conf, post)
+		c.parents = d.seriesParents(conf, post)
+	}
+	// embargo is the future pubDate the post is held back until, if any.
+	var embargo time.Time
+	if published, err := post.ParsePubDate(); err == nil {
+		if ps, ok := d.Store.(PublishedAtStore); ok {
+			if err := ps.SetPublishedAt(post.Link, published); err != nil {
+				log.Error("Storing post pubDate in database failed: ", err)
+			}
+		}
+		if conf.ScheduleFutureItems && published.After(d.Clock.Now()) {
+			embargo = published
+		}
+	}
+
+	res := result{candidate: c}
+	if conf.LinkCheck && !c.isUpdate && embargo.IsZero() && d.linkPending(ctx, conf, post) {
+		res.queued = true
+		return res, true
+	}
+
+	enabledSites := conf.EnabledSites()
+	siteMap := make(map[string]bool, len(enabledSites))
+	for _, s := range enabledSites {
+		siteMap[s] = true
+	}
+
+	order, err := publishOrder(conf)
+	if err != nil {
+		order = siteOrder
+	}
+	// succeeded records the sites the post is published to, for
+	// SiteDependencies.
+	succeeded := make(map[string]bool, len(order))
+
+	for _, site := range order {
+		if !siteMap[site] || !siteConfigured(conf, site) {
+			continue
+		}
+		publisher, ok := d.Publishers[site]
+		if !ok {
+			continue
+		}
+		if dep := conf.SiteDependencies[site]; dep != "" && !succeeded[dep] {
+			log.Debugf("Skipping %s for %s: it depends on %s, which was not published", siteNames[site], post.Link, siteNames[dep])
+			d.recordEvent(db.ActionSkippedDependency, site, post.Link, dep)
+			continue
+		}
+
+		alreadyPosted, err := d.Store.IsSitePosted(post.Link, site)
+		switch {
+		case err != nil:
+			log.Errorf("Error checking %s post status: %v", site, err)
+		case alreadyPosted && !c.isUpdate:
+			log.Debugf("Skipping %s: already posted %s", siteNames[site], post.Link)
+			succeeded[site] = true
+		case c.isUpdate && site == "newsletter":
+			log.Debugf("Not emailing the update of %s: the newsletter only announces new posts", post.Link)
+			succeeded[site] = true
+		default:
+			if !d.retryDue(site, post.Link) {
+				continue
+			}
+			content := siteContent(conf, site, c)
+			if entry, blocked := blockedBy(conf, site, content); blocked {
+				d.skipBlocked(conf, site, c, entry)
+				continue
+			}
+			if !embargo.IsZero() {
+				if scheduler, ok := publisher.(Scheduler); ok && !alreadyPosted && scheduler.CanSchedule(*conf, embargo, d.Clock.Now()) {
+					res.attempted = true
+					err := d.schedulePost(ctx, conf, site, scheduler, newPost(conf, site, c, content), embargo)
+					succeeded[site] = err == nil
+					res.outcomes = append(res.outcomes, siteOutcome{site: site, scheduledAt: embargo, err: err})
+					continue
+				}
+				log.Debugf("Holding back %s for %s until its pubDate %s", post.Link, siteNames[site], embargo.Format(time.RFC3339))
+				res.queued = true
+				continue
+			}
+			res.attempted = true
+			if alreadyPosted && c.isUpdate {
+				if updater, id := d.originalUpdater(conf, site, publisher, post.Link); updater != nil {
+					err := d.updatePost(ctx, conf, site, updater, id, newPost(conf, site, c, content))
+					succeeded[site] = err == nil
+					res.outcomes = append(res.outcomes, siteOutcome{site: site, updated: true, err: err})
+					continue
+				}
+			}
+			id, err := d.publish(ctx, conf, site, publisher, newPost(conf, site, c, content))
+			res.outcomes = append(res.outcomes, siteOutcome{site: site, err: err})
+			if err != nil {
+				d.recordEvent(db.ActionFailed, site, post.Link, err.Error())
+				d.scheduleRetry(conf, site, post, err)
+			} else {
+				succeeded[site] = true
+				d.recordEvent(db.ActionPublished, site, post.Link, "")
+				d.clearRetry(site, post.Link)
+				if markErr := d.Store.MarkSitePosted(post.Link, site); markErr != nil {
+					log.Errorf("Failed to mark %s as posted: %v", site, markErr)
+				}
+				if ids, ok := d.Store.(PostIDStore); ok && id != "" {
+					if idErr := ids.SetSitePostID(post.Link, site, id); idErr != nil {
+						log.Errorf("Failed to store %s post ID: %v", site, idErr)
+					}
+				}
+				if site == "mastodon" && conf.MastodonPinLatest && !c.isUpdate && id != "" {
+					d.pinLatest(ctx, conf, publisher, post.Link, id)
+				}
+				if v, ok := c.variants[site]; ok && !c.isUpdate {
+					if vs, ok := d.Store.(VariantStore); ok {
+						if vErr := vs.SetSiteVariant(post.Link, site, v.name); vErr != nil {
+							log.Errorf("Failed to store %s template variant: %v", site, vErr)
+						}
+					}
+				}
+			}
+		}
+	}
+	for _, ok := range succeeded {
+		if ok {
+			d.raiseHighWater(conf, post)
+			break
+		}
+	}
+	return res, true
+}
+
+// pinLatest pins the Mastodon status id of the new post link, and unpins the
+// statuses pinned for earlier posts once it is pinned. It needs a publisher
+// implementing Pinner and a Store implementing PinStore and PostIDStore.
+// Failures are notified like those of re-promotion and do not fail the
+// publish.
+func (d Deps) pinLatest(ctx context.Context, conf *config.Config, publisher Publisher, link, id string) {
+	pinner, ok := publisher.(Pinner)
+	if !ok {
+		return
+	}
+	ps, ok := d.Store.(PinStore)
+	ids, idsOK := d.Store.(PostIDStore)
+	if !ok || !idsOK {
+		log.Warn("Pinning the latest post needs a database that records pinned posts")
+		return
+	}
+	previous, err := ps.MastodonPinnedPosts()
+	if err != nil {
+		log.Errorf("Failed to load the pinned Mastodon posts: %v", err)
+		return
+	}
+
+	if err := pinner.Pin(ctx, *conf, id); err != nil {
+		d.Notifier.LogFailure(conf, "Failed to pin Mastodon post", link, err)
+		d.recordEvent(db.ActionFailed, "mastodon", link, "pin: "+err.Error())
+		return
+	}
+	if err := ps.SetMastodonPinned(link, true); err != nil {
+		log.Errorf("Failed to record the pinned Mastodon status of %s: %v", link, err)
+	}
+	d.recordEvent(db.ActionPinned, "mastodon", link, id)
+
+	for _, old := range previous {
+		if old == link {
+			continue
+		}
+		oldID, err := ids.SitePostID(old, "mastodon")
+		if err == nil && oldID != "" {
+			err = pinner.Unpin(ctx, *conf, oldID)
+		}
+		if err != nil {
+			log.Errorf("Failed to unpin the Mastodon status of %s: %v", old, err)
+			continue
+		}
+		log.Infof("Unpinned the Mastodon status of %s", old)
+		if err := ps.SetMastodonPinned(old, false); err != nil {
+			log.Errorf("Failed to record the unpinned Mastodon status of %s: %v", old, err)
+		}
+	}
+}
+
+// linkPending reports whether post is held back because its page is not
+// live yet. Pages are waited for until Config.LinkCheckGraceMinutes after
+// the post was first seen, or after its pubDate when the Store does not
+// know; posts published to a site already are not checked again.
+func (d Deps) linkPending(ctx context.Context, conf *config.Config, post rss.RSSItem) bool {
+	for _, site := range conf.EnabledSites() {
+		if posted, err := d.Store.IsSitePosted(post.Link, site); err == nil && posted {
+			return false
+		}
+	}
+	err := d.LinkChecker.CheckLink(ctx, *conf, post.Link)
+	if err == nil {
+		return false
+	}
+
+	var since time.Time
+	if fs, ok := d.Store.(FirstSeenStore); ok {
+		seen, fsErr := fs.FirstSeen(post.Link)
+		if fsErr != nil {
+			log.Errorf("Failed to look up when %s was first seen: %v", post.Link, fsErr)
+		}
+		since = seen
+	}
+	if since.IsZero() {
+		since, _ = post.ParsePubDate()
+	}
+	deadline := since.Add(time.Duration(conf.LinkCheckGraceMinutes) * time.Minute)
+	if since.IsZero() || !d.Clock.Now().Before(deadline) {
+		log.Warnf("Publishing %s although its page is not live: %v", post.Link, err)
+		return false
+	}
+	log.Infof("Holding back %s until its page is live, at most until %s: %v", post.Link, deadline.Format(time.RFC3339), err)
+	d.recordEvent(db.ActionHeldBack, "", post.Link, err.Error())
+	return true
+}
+
+// record reports every result of in until it is closed, and returns their
+// outcome.
+func (d Deps) record(conf *config.Config, in <-chan result) Outcome {
+	var outcome Outcome
+	for res := range in {
+		for _, o := range res.outcomes {
+			if o.err != nil {
+				outcome.Failed++
+			} else {
+				outcome.Published++
+			}
+		}
+		d.guard(conf, "record", res.post, func() { d.report(conf, res) })
+	}
+	return outcome
+}
+
+// report notifies the outcome of res, and counts an item that was stored
+// already and not published anywhere as a suppressed duplicate.
+func (d Deps) report(conf *config.Config, res result) {
+	d.notifyOutcomes(conf, res.post, res.isUpdate, res.outcomes)
+
+	if res.exists && !res.isUpdate && !res.attempted && !res.queued {
+		metrics.Inc(metrics.DuplicatesSuppressed)
+	}
+}
+
+// handlePost runs post through the transform, publish and record stages on
+// its own. It reports whether a publish was attempted on at least one site.
+// d must have its defaults applied.
+func (d Deps) handlePost(ctx context.Context, post rss.RSSItem, conf *config.Config, startupTime string, skipIfExisting bool) bool {
+	ctx, cancel := withBudget(ctx, postTimeout(conf))
+	defer cancel()
+	c, ok := d.prepare(ctx, post, conf, skipIfExisting)
+	if !ok {
+		return false
+	}
+	res, ok := d.publishCandidate(ctx, conf, c, startupTime)
+	if !ok {
+		return false
+	}
+	d.report(conf, res)
+	return res.attempted
+}
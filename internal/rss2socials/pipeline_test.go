@@ -0,0 +1,114 @@
+package rss2socials
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/toozej/rss2socials/internal/rss"
+	"github.com/toozej/rss2socials/pkg/config"
+)
+
+// runStage feeds items to stage and returns everything it emits.
+func runStage[In, Out any](stage func(context.Context, <-chan In, chan<- Out), items ...In) []Out {
+	in := make(chan In, len(items))
+	for _, item := range items {
+		in <- item
+	}
+	close(in)
+	out := make(chan Out)
+	go stage(context.Background(), in, out)
+	var emitted []Out
+	for v := range out {
+		emitted = append(emitted, v)
+	}
+	return emitted
+}
+
+func TestFilter(t *testing.T) {
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	r, err := newRunner(config.Config{
+		Interval:             60,
+		Category:             "go",
+		SkipPrefixCategories: []string{"draft"},
+		PostNewEntriesOnly:   true,
+	}, Deps{Store: newMemStore(), Notifier: &recordingNotifier{}})
+	require.NoError(t, err)
+	r.startupTime = start
+
+	admitted := runStage(r.filter,
+		rss.RSSItem{Title: "New", Link: "https://example.com/go", PubDate: start.Add(time.Minute).Format(time.RFC1123Z)},
+		rss.RSSItem{Title: "No link"},
+		rss.RSSItem{Title: "Repeated", Link: "https://example.com/go"},
+		rss.RSSItem{Title: "Draft: soon", Link: "https://example.com/go-draft"},
+		rss.RSSItem{Title: "Other category", Link: "https://example.com/rust"},
+		rss.RSSItem{Title: "Old", Link: "https://example.com/go-old", PubDate: start.Add(-time.Minute).Format(time.RFC1123Z)},
+	)
+	require.Len(t, admitted, 1)
+	assert.Equal(t, "New", admitted[0].Title)
+}
+
+func TestTransform(t *testing.T) {
+	store := newMemStore()
+	require.NoError(t, store.StoreTootedPost("https://example.com/posted", "content", ""))
+	require.NoError(t, store.MarkSitePosted("https://example.com/posted", "mastodon"))
+	require.NoError(t, store.MarkSitePosted("https://example.com/posted", "bluesky"))
+	require.NoError(t, store.MarkSitePosted("https://example.com/posted", "threads"))
+	require.NoError(t, store.StoreTootedPost("https://example.com/edited", "old", ""))
+	d := Deps{Store: store, Notifier: &recordingNotifier{}}.withDefaults()
+	conf := &config.Config{}
+
+	candidates := runStage(func(ctx context.Context, in <-chan rss.RSSItem, out chan<- candidate) {
+		d.transform(ctx, conf, in, out)
+	},
+		rss.RSSItem{Title: "New", Link: "https://example.com/new"},
+		rss.RSSItem{Title: "Posted", Link: "https://example.com/posted", Content: "content"},
+		rss.RSSItem{Title: "Edited", Link: "https://example.com/edited", Content: "new"},
+	)
+	require.Len(t, candidates, 2, "items published everywhere already are dropped")
+	assert.Equal(t, "New post: https://example.com/new", candidates[0].content)
+	assert.False(t, candidates[0].isUpdate)
+	assert.Equal(t, "Updated post: https://example.com/edited", candidates[1].content)
+	assert.True(t, candidates[1].isUpdate)
+	assert.True(t, candidates[1].exists)
+}
+
+func TestPublishCandidates_StopsAtMaxPostsPerCycle(t *testing.T) {
+	masto := &recordingPublisher{}
+	r, err := newRunner(config.Config{
+		Interval:         60,
+		SocialSites:      []string{"mastodon"},
+		MaxPostsPerCycle: 2,
+	}, Deps{
+		Publishers: map[string]Publisher{"mastodon": masto},
+		Store:      newMemStore(),
+		Notifier:   &recordingNotifier{},
+	})
+	require.NoError(t, err)
+
+	results := runStage(r.publishCandidates,
+		candidate{post: rss.RSSItem{Link: "https://example.com/1"}, content: "one"},
+		candidate{post: rss.RSSItem{Link: "https://example.com/2"}, content: "two"},
+		candidate{post: rss.RSSItem{Link: "https://example.com/3"}, content: "three"},
+	)
+	require.Len(t, results, 2)
+	assert.True(t, results[0].attempted)
+	assert.Equal(t, []siteOutcome{{site: "mastodon"}}, results[1].outcomes)
+	assert.Equal(t, []string{"one", "two"}, masto.contents)
+}
+
+func TestRecord(t *testing.T) {
+	notifier := &recordingNotifier{}
+	d := Deps{Store: newMemStore(), Notifier: notifier}.withDefaults()
+	in := make(chan result, 2)
+	in <- result{candidate: candidate{post: rss.RSSItem{Title: "Hello"}}, attempted: true, outcomes: []siteOutcome{{site: "mastodon"}}}
+	in <- result{candidate: candidate{post: rss.RSSItem{Title: "Broken"}}, attempted: true, outcomes: []siteOutcome{{site: "bluesky", err: assert.AnError}}}
+	close(in)
+
+	d.record(&config.Config{GotifyNotifyOnSuccess: true}, in)
+	assert.Equal(t, []string{"Successfully posted to Mastodon: Hello"}, notifier.successes)
+	assert.Equal(t, []string{"Failed to post to Bluesky: Broken"}, notifier.failures)
+}
@@ -0,0 +1,109 @@
+package rss2socials
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/toozej/rss2socials/internal/bluesky"
+	"github.com/toozej/rss2socials/internal/messages"
+	"github.com/toozej/rss2socials/internal/rss"
+	"github.com/toozej/rss2socials/pkg/config"
+)
+
+// Post is a feed item as it is published to a site. Text is the post
+// rendered for the site from the templates, with its footer and within its
+// length limit, which the built-in publishers post as is; the other fields
+// describe the item, for publishers that render it in their own way, such
+// as with facets, embeds or content warnings.
+type Post struct {
+	Text  string
+	Title string
+	Link  string
+	// Summary is the content selected by Config.ContentSources, as plain
+	// text.
+	Summary string
+	// Tags are the categories of the item.
+	Tags []string
+	// Images are the images of the item, with their alt text, up to
+	// maxPostImages.
+	Images []rss.Image
+	// Language is the language code of Config.Locale, e.g. "de", or empty
+	// when no locale is configured.
+	Language string
+	// IsUpdate is set when the post announces an update to an item that
+	// was published before.
+	IsUpdate bool
+	// ContentWarning is the content_warning phrase of the locale when the
+	// item is sensitive according to Config.SensitiveLabels, and empty
+	// otherwise.
+	ContentWarning string
+	// Labels are the Bluesky self-labels of sensitive items.
+	Labels []string
+	// Quote is the at:// URI of the Bluesky post of the previous post in
+	// the categories of the item, with Config.PreviousPost set to quote.
+	Quote string
+	// InReplyTo is the ID of the post of the previous part of a series on
+	// the site, which the post replies to with Config.SeriesThreading.
+	InReplyTo string
+	// Item is the feed item the post was rendered from.
+	Item rss.RSSItem
+}
+
+// maxPostImages is how many images of an item a Post carries, the most any
+// site attaches.
+const maxPostImages = bluesky.MaxImages
+
+// newPost returns the Post of c on site, whose text is text.
+func newPost(conf *config.Config, site string, c candidate, text string) Post {
+	item := c.post
+	p := Post{
+		Text:     text,
+		Title:    item.Title,
+		Link:     item.Link,
+		Summary:  c.summary,
+		Tags:     item.Categories,
+		Images:   item.Images(maxPostImages),
+		Language: messages.Language(conf.Locale),
+		IsUpdate: c.isUpdate,
+		Item:     item,
+	}
+	if labels, sensitive := sensitivity(conf, item); sensitive {
+		p.ContentWarning, p.Labels = contentWarning(conf), labels
+	}
+	if site == "bluesky" && conf.PreviousPost == config.PreviousPostQuote {
+		p.Quote = c.previous.BlueskyURI
+	}
+	p.InReplyTo = c.parents[site]
+	return p
+}
+
+// sensitivity returns the Bluesky self-labels of item, and whether it is
+// sensitive, by the categories and media:rating values of
+// Config.SensitiveLabels.
+func sensitivity(conf *config.Config, item rss.RSSItem) ([]string, bool) {
+	markers := append(slices.Clone(item.Categories), item.MediaRatings()...)
+	var labels []string
+	sensitive := false
+	for marker, label := range conf.SensitiveLabels {
+		marker = strings.TrimSpace(marker)
+		if !slices.ContainsFunc(markers, func(m string) bool { return strings.EqualFold(strings.TrimSpace(m), marker) }) {
+			continue
+		}
+		sensitive = true
+		if label != "" && !slices.Contains(labels, label) {
+			labels = append(labels, label)
+		}
+	}
+	slices.Sort(labels)
+	return labels, sensitive
+}
+
+// contentWarning returns the content_warning phrase of the locale.
+func contentWarning(conf *config.Config) string {
+	catalog, err := messages.New(conf.Locale, conf.Messages)
+	if err != nil {
+		catalog = messages.Catalog{}
+	}
+	warning, _ := catalog.Get(messages.ContentWarning)
+	return warning
+}
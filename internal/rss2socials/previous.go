@@ -0,0 +1,49 @@
+package rss2socials
+
+import (
+	log "github.com/sirupsen/logrus"
+
+	"github.com/toozej/rss2socials/internal/db"
+	"github.com/toozej/rss2socials/internal/messages"
+	"github.com/toozej/rss2socials/internal/rss"
+	"github.com/toozej/rss2socials/pkg/config"
+)
+
+// previousPost records the categories of post, which is stored, and returns
+// the latest other published post in one of them when Config.PreviousPost is
+// set. It needs a Store implementing CategoryStore.
+func (d Deps) previousPost(conf *config.Config, post rss.RSSItem) db.TootedPost {
+	cs, ok := d.Store.(CategoryStore)
+	if !ok {
+		return db.TootedPost{}
+	}
+	if err := cs.SetCategories(post.Link, post.Categories); err != nil {
+		log.Errorf("Failed to store the categories of %s: %v", post.Link, err)
+	}
+	if conf.PreviousPost == "" {
+		return db.TootedPost{}
+	}
+	previous, _, err := cs.LatestInCategories(post.Categories, post.Link)
+	if err != nil {
+		log.Errorf("Failed to look up the previous post of %s: %v", post.Link, err)
+		return db.TootedPost{}
+	}
+	return previous
+}
+
+// previousLine returns the line linking to the previous post of c on site,
+// or an empty string when it has none or quotes its Bluesky post instead.
+func previousLine(conf *config.Config, site string, c candidate) string {
+	if c.previous.Link == "" {
+		return ""
+	}
+	if site == "bluesky" && conf.PreviousPost == config.PreviousPostQuote && c.previous.BlueskyURI != "" {
+		return ""
+	}
+	catalog, err := messages.New(conf.Locale, conf.Messages)
+	if err != nil {
+		catalog = messages.Catalog{}
+	}
+	prefix, _ := catalog.Get(messages.Previously)
+	return prefix + " " + c.previous.Link
+}
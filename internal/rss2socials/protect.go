@@ -0,0 +1,37 @@
+package rss2socials
+
+import (
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/toozej/rss2socials/internal/redact"
+	"github.com/toozej/rss2socials/internal/transport"
+	"github.com/toozej/rss2socials/pkg/config"
+)
+
+// protectOnce sets up the process-wide part of Protect.
+var protectOnce sync.Once
+
+// Protect registers the secrets of conf for redaction and, the first time it
+// is called, adds the redacting log hook and wraps http.DefaultTransport so
+// that requests identify themselves with conf.UserAgent, response bodies are
+// capped and requests keep within the limits of conf. Every runner calls it,
+// so that programs embedding the pipeline are protected like the command.
+//
+// The transport is shared by the whole process: later calls only register
+// secrets, and a program that configures the transport with
+// transport.Configure must do so before the first call.
+func Protect(conf config.Config) {
+	redact.Register(conf.Secrets()...)
+	protectOnce.Do(func() {
+		log.AddHook(redact.Hook{})
+		transport.SetUserAgent(conf.UserAgent)
+		transport.LimitResponses()
+		transport.Throttle(transport.Limits{
+			MaxInFlight: conf.MaxConnections,
+			PerMinute:   conf.RequestsPerMinute,
+			Burst:       conf.RequestBurst,
+		})
+	})
+}
@@ -0,0 +1,66 @@
+package rss2socials
+
+import (
+	"fmt"
+	"runtime/debug"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/toozej/rss2socials/internal/errreport"
+	"github.com/toozej/rss2socials/internal/metrics"
+	"github.com/toozej/rss2socials/internal/rss"
+	"github.com/toozej/rss2socials/pkg/config"
+)
+
+// recoverPanic recovers a panic of the function deferring it, so that a
+// single bad feed, item or API response cannot take down the daemon. The
+// panic is logged with its stack trace, counted and reported to Sentry with
+// the context of ev, and stored in *err unless err is nil. It must be
+// deferred directly: defer d.recoverPanic(&err, ev).
+func (d Deps) recoverPanic(err *error, ev errreport.Event) {
+	if v := recover(); v != nil {
+		d.reportPanic(v, err, ev)
+	}
+}
+
+// reportPanic handles the recovered panic v as recoverPanic describes.
+func (d Deps) reportPanic(v any, err *error, ev errreport.Event) {
+	metrics.Inc(metrics.PanicsRecovered)
+	fields := make(log.Fields, len(ev.Tags))
+	for k, tag := range ev.Tags {
+		fields[k] = tag
+	}
+	log.WithFields(fields).Errorf("%s: %v\n%s", ev.Message, v, debug.Stack())
+	d.reporter.CapturePanic(v, ev)
+	if err != nil {
+		*err = fmt.Errorf("panic: %v", v)
+	}
+}
+
+// guard calls f, recovering a panic of it as recoverPanic does with the
+// itemPanic event of post and stage. The event is only built on a panic,
+// as every item goes through guard at every stage of every cycle.
+func (d Deps) guard(conf *config.Config, stage string, post rss.RSSItem, f func()) {
+	defer func() {
+		if v := recover(); v != nil {
+			d.reportPanic(v, nil, itemPanic(conf, stage, post))
+		}
+	}()
+	f()
+}
+
+// itemPanic describes a panic while post went through stage of the pipeline.
+func itemPanic(conf *config.Config, stage string, post rss.RSSItem) errreport.Event {
+	return errreport.Event{
+		Message: fmt.Sprintf("Panic in the %s stage", stage),
+		Tags:    map[string]string{"feed": conf.FeedURL, "stage": stage, "link": post.Link},
+	}
+}
+
+// sitePanic describes a panic while post was published to site.
+func sitePanic(conf *config.Config, site string, post rss.RSSItem) errreport.Event {
+	return errreport.Event{
+		Message: "Panic publishing to " + siteNames[site],
+		Tags:    map[string]string{"feed": conf.FeedURL, "network": site, "link": post.Link},
+	}
+}
@@ -4,20 +4,38 @@ package rss2socials
 
 import (
 	"context"
+	"crypto/rand"
+	"errors"
 	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
 	"path"
+	"slices"
+	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	log "github.com/sirupsen/logrus"
 
 	"github.com/toozej/rss2socials/internal/bluesky"
+	"github.com/toozej/rss2socials/internal/charcount"
 	"github.com/toozej/rss2socials/internal/db"
-	"github.com/toozej/rss2socials/internal/gotify"
+	"github.com/toozej/rss2socials/internal/errreport"
+	"github.com/toozej/rss2socials/internal/ghactions"
 	"github.com/toozej/rss2socials/internal/mastodon"
+	"github.com/toozej/rss2socials/internal/metrics"
+	"github.com/toozej/rss2socials/internal/neterr"
+	"github.com/toozej/rss2socials/internal/notify"
+	"github.com/toozej/rss2socials/internal/redact"
+	"github.com/toozej/rss2socials/internal/redisstore"
 	"github.com/toozej/rss2socials/internal/rss"
-	"github.com/toozej/rss2socials/internal/threads"
+	"github.com/toozej/rss2socials/internal/schedule"
 	"github.com/toozej/rss2socials/pkg/config"
+	"github.com/toozej/rss2socials/pkg/version"
 )
 
 // shouldSkipPost checks whether a post should be skipped based on the
@@ -38,188 +56,1374 @@ func shouldSkipPost(post rss.RSSItem, skipPrefixCategories []string) bool {
 	return false
 }
 
-func Run(conf config.Config) {
-	if conf.FeedURL == "" {
-		log.Fatal("RSS feed URL is required")
+// matchesCategory reports whether post is in category according to mode, a
+// Config.CategoryFilterMode: category is contained in the last path segment
+// of the post link, or equal, ignoring case, to one of its RSS categories.
+func matchesCategory(post rss.RSSItem, category, mode string) bool {
+	inSegment := strings.Contains(path.Base(post.Link), category)
+	inCategories := slices.ContainsFunc(post.Categories, func(c string) bool {
+		return strings.EqualFold(strings.TrimSpace(c), category)
+	})
+	switch mode {
+	case config.CategoryFilterRSSCategory:
+		return inCategories
+	case config.CategoryFilterBoth:
+		return inSegment || inCategories
+	default:
+		return inSegment
 	}
+}
 
-	if conf.Interval <= 0 {
-		log.Error("Interval must be a positive integer")
-		conf.Interval = 60
+// matchesExtensions reports whether post has every namespaced element of
+// filters, each with a value containing the filter's text ignoring case.
+func matchesExtensions(post rss.RSSItem, filters map[string]string) bool {
+	for name, text := range filters {
+		if !post.Extensions.Has(name) {
+			return false
+		}
+		if !strings.Contains(strings.ToLower(post.Extensions.Get(name)), strings.ToLower(text)) {
+			return false
+		}
 	}
+	return true
+}
 
-	db.InitDB(conf.DBPath)
-	defer db.CloseDB()
+// linkDomainAllowed reports whether the host of link is in allow, unless
+// allow is empty, and not in deny. A domain includes its subdomains. It
+// returns the matching denied domain, or the host when it is not allowed.
+func linkDomainAllowed(link string, allow, deny []string) (string, bool) {
+	u, err := url.Parse(strings.TrimSpace(link))
+	if err != nil {
+		return link, len(allow) == 0 && len(deny) == 0
+	}
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	if domain, ok := inDomains(host, deny); ok {
+		return domain, false
+	}
+	if _, ok := inDomains(host, allow); len(allow) > 0 && !ok {
+		return host, false
+	}
+	return "", true
+}
 
-	var startupTimeStr string
-	var startupTime time.Time
-	firstCycle := true
+// inDomains returns the first of domains that host is, or is a subdomain
+// of, ignoring case and a leading "*." or ".".
+func inDomains(host string, domains []string) (string, bool) {
+	for _, domain := range domains {
+		d := strings.ToLower(strings.TrimSpace(domain))
+		d = strings.TrimSuffix(strings.TrimPrefix(strings.TrimPrefix(d, "*"), "."), ".")
+		if d != "" && (host == d || strings.HasSuffix(host, "."+d)) {
+			return domain, true
+		}
+	}
+	return "", false
+}
 
-	for {
-		posts, err := rss.CheckRSSFeed(conf.FeedURL)
+// sortPostsChronologically orders posts by pubDate ascending so that, when
+// several new items are detected at once, they appear on timelines in the
+// order they were written rather than in feed-document (usually newest-first)
+// order. Items whose pubDate is missing or unparsable keep their relative
+// order and are placed after all dated items.
+func sortPostsChronologically(posts []rss.RSSItem) {
+	slices.SortStableFunc(posts, func(a, b rss.RSSItem) int {
+		aTime, aErr := a.ParsePubDate()
+		bTime, bErr := b.ParsePubDate()
+		switch {
+		case aErr != nil && bErr != nil:
+			return 0
+		case aErr != nil:
+			return 1
+		case bErr != nil:
+			return -1
+		}
+		return aTime.Compare(bTime)
+	})
+}
+
+// runner holds the state shared across check cycles of a single run.
+type runner struct {
+	conf   config.Config
+	deps   Deps
+	ownsDB bool
+	// redis is the Store the runner created for DBDriver redis.
+	redis          *redisstore.Store
+	loc            *time.Location
+	startupTime    time.Time
+	startupTimeStr string
+	firstCycle     bool
+	inFlight       map[string]bool
+	// degraded is set when running on an in-memory database because the
+	// database file is unavailable; seeding is set until its first cycle
+	// has stored the existing feed items.
+	degraded bool
+	seeding  bool
+	// lockOwner identifies this instance as the holder of the cycle lock.
+	lockOwner string
+	// outcome is the outcome of the publishes of the last cycle.
+	outcome Outcome
+	// schedule is the parsed CheckSchedule, checked on instead of every
+	// Interval minutes when set.
+	schedule *schedule.Schedule
+	// clockJumped is set for the first cycle after the wall clock jumped
+	// ahead while waiting for it.
+	clockJumped bool
+	// newPosts counts the new posts attempted, to rotate footers when the
+	// Store cannot count published posts.
+	newPosts int
+	// canonical caches the links feed links were resolved to with
+	// CanonicalLinks.
+	canonical map[string]string
+	// credentialsChecked holds when the credentials of each site were
+	// last checked with CredentialCheckDays.
+	credentialsChecked map[string]time.Time
+}
+
+// newRunner validates conf, replacing invalid values with defaults as
+// Config.WithDefaults does, and returns a runner ready to be opened. It
+// returns an error when the Redis URL of conf is invalid.
+func newRunner(conf config.Config, deps Deps) (*runner, error) {
+	Protect(conf)
+
+	conf, replaced := conf.WithDefaults()
+	for _, p := range replaced {
+		log.Errorf("Invalid configuration, using the default: %s", p)
+	}
+
+	deps.content = db.Content{Hashing: conf.Hashing(), Snapshots: conf.StoreContent}
+	deps.fetcher = rss.NewFetcher(rss.RedirectPolicy{
+		MaxRedirects:   conf.FeedMaxRedirects,
+		AllowDowngrade: conf.FeedAllowHTTPDowngrade,
+		PinHost:        conf.FeedPinHost,
+	}, time.Duration(conf.FeedMinIntervalSeconds)*time.Second)
+
+	for site, dep := range conf.SiteDependencies {
+		if !slices.Contains(conf.EnabledSites(), dep) {
+			log.Warnf("%s depends on %s, which is not enabled; nothing will be published to %s", siteNames[site], siteNames[dep], siteNames[site])
+		}
+	}
+
+	var redis *redisstore.Store
+	if conf.DBDriver == config.DBDriverRedis && deps.Store == nil {
+		var err error
+		redis, err = redisstore.New(conf.RedisURL, conf.RedisKeyPrefix, time.Duration(conf.EventsRetentionDays)*24*time.Hour)
 		if err != nil {
-			log.Printf("Error fetching RSS feed: %v", err)
-			continue
+			return nil, fmt.Errorf("invalid REDIS_URL: %w", err)
 		}
+		redis.SetStoreContent(conf.StoreContent)
+		redis.SetHashing(deps.content.Hashing)
+		deps.Store = redis
+	}
 
-		if firstCycle {
-			startupTime = time.Now()
-			startupTimeStr = startupTime.Format(time.RFC3339)
-			if conf.PostNewEntriesOnly && !db.IsFirstCycle() {
-				log.Info("PostNewEntriesOnly enabled: skipping posts already in DB from first cycle")
-			}
-			firstCycle = false
+	if conf.RepromoteAfterDays > 0 && deps.Store != nil {
+		_, ok := deps.Store.(RepromoteStore)
+		if _, hasIDs := deps.Store.(PostIDStore); !ok || !hasIDs {
+			log.Error("RepromoteAfterDays is not supported by the configured Store; posts are not re-promoted")
+			conf.RepromoteAfterDays = 0
 		}
+	}
 
-		if conf.ShortRun && len(posts) > 3 {
-			log.Info("Short run mode: processing only the 3 most recent items")
-			posts = posts[:3]
+	if conf.CycleLock {
+		if _, ok := deps.Store.(Locker); deps.Store != nil && !ok {
+			log.Error("CycleLock is not supported by the configured Store; running cycles without a lock")
+			conf.CycleLock = false
+		} else if conf.DBDriver == config.DBDriverMemory {
+			log.Warn("CycleLock has no effect with DBDriver memory, which is not shared with other instances")
 		}
+	}
 
-		for _, post := range posts {
-			if shouldSkipPost(post, conf.SkipPrefixCategories) {
-				log.Debugf("Skipping post %s: matches skip prefix category", post.Title)
-				continue
+	reporter, err := errreport.New(conf.SentryDSN, conf.SentryEnvironment)
+	if err != nil {
+		log.Errorf("%v; errors are not reported to Sentry", err)
+	}
+	deps.reporter = reporter
+
+	loc, err := conf.Location()
+	if err != nil {
+		log.Errorf("%v; falling back to local time", err)
+		loc = time.Local
+	}
+	deps.loc = loc
+
+	sched, err := conf.Schedule()
+	if err != nil {
+		log.Errorf("Invalid CHECK_SCHEDULE: %v; checking every %d minutes instead", err, conf.Interval)
+	}
+
+	if conf.EmitEvents && deps.Events == nil {
+		deps.Events = os.Stdout
+	}
+	d := deps.withDefaults()
+	if redis != nil {
+		redis.SetClock(d.Clock.Now)
+	}
+	if conf.GitHubActions && d.actions == nil {
+		d.actions = ghactions.New(os.Stdout)
+	}
+	if deps.FeedFetcher == nil && conf.RecordFeedDir != "" {
+		d.FeedFetcher = recordingFeedFetcher(conf.RecordFeedDir, d.Clock, d.fetcher)
+	}
+
+	return &runner{
+		conf:       conf,
+		deps:       d,
+		ownsDB:     deps.Store == nil,
+		redis:      redis,
+		loc:        loc,
+		schedule:   sched,
+		firstCycle: true,
+		lockOwner:  newLockOwner(),
+	}, nil
+}
+
+// newLockOwner returns an identifier of this instance that is unique among
+// the replicas sharing the cycle lock.
+func newLockOwner() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "rss2socials"
+	}
+	return fmt.Sprintf("%s-%d-%s", host, os.Getpid(), rand.Text()[:8])
+}
+
+// lock takes or renews the cycle lock of the feed when CycleLock is set. It
+// reports false when another instance holds it, or it could not be taken.
+func (r *runner) lock() bool {
+	locker, ok := r.deps.Store.(Locker)
+	if !r.conf.CycleLock || !ok {
+		return true
+	}
+	acquired, err := locker.AcquireLock("cycle:"+r.conf.FeedURL, r.lockOwner, time.Duration(r.conf.CycleLockTTLSeconds)*time.Second)
+	if err != nil {
+		log.Errorf("Failed to acquire the cycle lock: %v", err)
+		return false
+	}
+	return acquired
+}
+
+// unlock releases the cycle lock of the feed, if held, so that another
+// instance can take its turn.
+func (r *runner) unlock() {
+	locker, ok := r.deps.Store.(Locker)
+	if !r.conf.CycleLock || !ok {
+		return
+	}
+	if err := locker.ReleaseLock("cycle:"+r.conf.FeedURL, r.lockOwner); err != nil {
+		log.Errorf("Failed to release the cycle lock: %v", err)
+	}
+}
+
+// open initializes the database, unless a custom Store was supplied, and
+// recovers posts left in flight or pending retry by a previous run. It
+// returns an error when the database or Redis cannot be opened and
+// DBMemoryFallback is not set.
+func (r *runner) open() error {
+	if r.ownsDB {
+		if r.conf.DBDriver == config.DBDriverMemory {
+			if err := db.InitMemory(); err != nil {
+				return fmt.Errorf("failed to open in-memory database: %w", err)
+			}
+			log.Warn("DBDriver is memory: posts are not remembered after rss2socials exits")
+		} else if err := db.Init(r.conf.DBPath); err != nil {
+			if !r.conf.DBMemoryFallback {
+				return err
+			}
+			if err := r.openMemory(err); err != nil {
+				return err
+			}
+		}
+	}
+	if r.redis != nil {
+		if err := r.redis.Ping(); err != nil {
+			err = fmt.Errorf("failed to reach Redis: %w", err)
+			r.redis.Close()
+			r.redis = nil
+			if !r.conf.DBMemoryFallback {
+				return err
+			}
+			r.ownsDB = true
+			r.deps.Store = dbStore{clock: r.deps.Clock, content: r.deps.content, loc: r.deps.loc}
+			if err := r.openMemory(err); err != nil {
+				return err
 			}
+		}
+	}
+	r.inFlight = r.deps.recoverInFlightPosts()
+	for _, link := range r.deps.pendingRetryLinks() {
+		if r.inFlight == nil {
+			r.inFlight = make(map[string]bool)
+		}
+		r.inFlight[link] = true
+	}
+	return nil
+}
+
+// openMemory falls back to an in-memory database after the database file
+// could not be opened because of cause. PostNewEntriesOnly is enforced, as
+// nothing is known about what was published before.
+func (r *runner) openMemory(cause error) error {
+	if err := db.InitMemory(); err != nil {
+		return fmt.Errorf("%w; opening an in-memory database instead failed too: %w", cause, err)
+	}
+	log.Errorf("DATABASE UNAVAILABLE: %v", cause)
+	log.Error("Running in degraded mode on an in-memory database: only items published since the previous check are posted, and nothing is remembered after rss2socials exits")
+	r.degraded = true
+	r.conf.PostNewEntriesOnly = true
+	r.deps.Notifier.LogFailure(&r.conf, "Database unavailable, running on an in-memory database", "", cause)
+	return nil
+}
+
+func (r *runner) close() {
+	if r.deps.actions != nil {
+		if err := r.deps.actions.WriteSummary("rss2socials"); err != nil {
+			log.Error("Error writing the GitHub Actions job summary: ", err)
+		}
+	}
+	if r.ownsDB {
+		db.CloseDB()
+	}
+	if r.redis != nil {
+		if err := r.redis.Close(); err != nil {
+			log.Error("Error closing Redis connection: ", err)
+		}
+	}
+}
+
+// Run watches the configured feed, publishing new and updated items every
+// Interval minutes until it receives SIGINT/SIGTERM. In ShortRun mode it
+// returns after a single cycle.
+func Run(conf config.Config) {
+	// Stop cleanly on SIGINT/SIGTERM (e.g. docker stop) so that the post
+	// currently being handled finishes and the database is closed.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := Start(ctx, conf, Deps{}); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// Start runs check cycles every Interval minutes, or whenever CheckSchedule
+// matches, until ctx is cancelled, or after a single cycle in ShortRun mode.
+// Feed fetch errors and panics of a cycle are logged and the cycle is
+// retried after feedBackoff, or with a CheckSchedule at its next match,
+// unless the feed server sent a longer Retry-After; Start only returns an
+// error for invalid configuration or when the database cannot be opened.
+func Start(ctx context.Context, conf config.Config, deps Deps) error {
+	if conf.FeedURL == "" {
+		return fmt.Errorf("RSS feed URL is required")
+	}
+
+	r, err := newRunner(conf, deps)
+	if err != nil {
+		return err
+	}
+	defer r.deps.reporter.Flush(5 * time.Second)
+	defer r.deps.reporter.Recover()
+	if conf.MetricsAddr != "" {
+		defer serveMetrics(conf.MetricsAddr)()
+	}
+	r.verifySites(ctx)
+	if err := r.open(); err != nil {
+		return err
+	}
+	defer r.close()
+	r.logSettings(ctx)
+	r.deps.resumePendingRetries()
 
-			if conf.Category != "" {
-				lastSegment := path.Base(post.Link)
-				if !strings.Contains(lastSegment, conf.Category) {
-					log.Debugf("Skipping post %s: category filter '%s' not in URL segment '%s'", post.Title, conf.Category, lastSegment)
-					continue
-				}
+	interval := time.Duration(r.conf.Interval) * time.Minute
+	failures := 0
+	var wait time.Duration
+	for {
+		if r.schedule != nil && !r.conf.ShortRun {
+			// Checks wait for the next match of the schedule, after
+			// any Retry-After.
+			now := r.deps.Clock.Now()
+			next := r.schedule.Next(now.Add(wait).In(r.loc))
+			wait = next.Sub(now)
+			log.Infof("Next check at %s", next.Format(time.RFC3339))
+		}
+		waitStart := r.deps.Clock.Now()
+		if wait > 0 {
+			select {
+			case <-ctx.Done():
+			case <-r.deps.Clock.After(wait):
 			}
+		}
+		if ctx.Err() != nil {
+			log.Info("Shutdown signal received, exiting")
+			return nil
+		}
+		if wait > 0 {
+			r.clockJumped = r.checkClockJump(wait, waitStart, r.deps.Clock.Now())
+		}
 
-			if conf.PostNewEntriesOnly && post.PubDate != "" {
-				pubTime, err := post.ParsePubDate()
-				if err != nil {
-					log.Warnf("Could not parse pubDate %q for %s: %v", post.PubDate, post.Link, err)
-				} else if pubTime.Before(startupTime) {
-					log.Infof("Skipping post %s: pubDate %s (%s) is before startup time %s", post.Link, post.PubDate, pubTime, startupTimeStr)
-					continue
-				}
+		wait = interval
+		if r.schedule != nil {
+			wait = 0
+		}
+		if err := r.cycle(ctx); err != nil {
+			failures++
+			// A server asking to wait longer than the backoff is obeyed.
+			retryAfter := rss.RetryAfter(err, r.deps.Clock.Now())
+			if r.schedule != nil {
+				wait = retryAfter
+				log.Errorf("Error fetching RSS feed: %v (failed %d times in a row, retrying at the next scheduled check)", err, failures)
+			} else {
+				wait = max(feedBackoff(interval, failures), retryAfter)
+				log.Errorf("Error fetching RSS feed: %v (failed %d times in a row, retrying in %s)", err, failures, wait)
 			}
+		} else {
+			failures = 0
+		}
+		r.clockJumped = false
 
-			skipIfExisting := conf.PostNewEntriesOnly && db.IsFirstCycle()
-			handlePost(post, &conf, startupTimeStr, skipIfExisting)
+		if ctx.Err() != nil {
+			log.Info("Shutdown signal received, exiting")
+			return nil
 		}
 
-		if conf.ShortRun {
+		if r.conf.ShortRun {
 			log.Info("Short run mode complete, exiting")
-			return
+			return nil
 		}
+	}
+}
+
+// clockJumpTolerance is how much longer than the wait the wall clock may
+// advance before it counts as a jump, allowing for timers firing late on a
+// busy machine.
+const clockJumpTolerance = time.Minute
+
+// checkClockJump reports whether the wall clock jumped ahead while waiting
+// for wait from before until after. Waits run on the monotonic clock, which
+// stands still while the machine is suspended, so a check is never repeated
+// to make up for lost time; but a wall clock that ran on, like one stepped
+// by NTP, may have let more feed items and due retries pile up than usual.
+// Times are compared as instants, so DST changes are no jumps.
+func (r *runner) checkClockJump(wait time.Duration, before, after time.Time) bool {
+	// Round(0) strips the monotonic reading, comparing wall clock times.
+	elapsed := after.Round(0).Sub(before.Round(0))
+	switch {
+	case elapsed > wait+clockJumpTolerance:
+		metrics.Inc(metrics.ClockJumps)
+		log.Warnf("The clock jumped ahead by %s while waiting, e.g. by a suspend or a clock change", (elapsed - wait).Round(time.Second))
+		return true
+	case elapsed < wait-clockJumpTolerance:
+		log.Warnf("The clock jumped back by %s while waiting, e.g. by a clock change; retries and repromotions may run late", (wait - elapsed).Round(time.Second))
+	}
+	return false
+}
+
+// maxPosts returns how many items the current cycle may publish, zero
+// meaning unlimited: MaxPostsPerCycle, or ClockJumpMaxPosts if lower after a
+// clock jump.
+func (r *runner) maxPosts() int {
+	limit := r.conf.MaxPostsPerCycle
+	if jumpLimit := r.conf.ClockJumpMaxPosts; r.clockJumped && jumpLimit > 0 && (limit == 0 || jumpLimit < limit) {
+		limit = jumpLimit
+	}
+	return limit
+}
 
-		time.Sleep(time.Duration(conf.Interval) * time.Minute)
+// interval describes how often the feed is checked.
+func (r *runner) interval() string {
+	if r.schedule != nil {
+		return "on schedule " + r.schedule.String()
 	}
+	return fmt.Sprintf("%d minutes", r.conf.Interval)
 }
 
-func handlePost(post rss.RSSItem, conf *config.Config, startupTime string, skipIfExisting bool) {
-	exists, updated, err := db.HasPostChanged(post.Link, post.Content)
+// maxFeedBackoff caps the delay between checks of a feed that keeps failing
+// to be fetched, unless Interval is longer.
+const maxFeedBackoff = time.Hour
+
+// feedBackoff returns how long to wait before checking the feed again after
+// fetching it failed failures times in a row: interval, doubled for every
+// further failure, capped at maxFeedBackoff or interval, whichever is longer.
+// A feed that is down is thus not checked more often than usual, and less
+// often the longer it stays down.
+func feedBackoff(interval time.Duration, failures int) time.Duration {
+	limit := max(interval, maxFeedBackoff)
+	backoff := interval
+	for i := 1; i < failures && backoff < limit; i++ {
+		backoff *= 2
+	}
+	return min(backoff, limit)
+}
+
+// serveMetrics serves the metrics at /metrics on addr until the returned
+// function is called. Failing to listen on addr is logged, as metrics are not
+// essential to publishing.
+func serveMetrics(addr string) (stop func()) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		log.Errorf("Failed to serve metrics: %v", err)
+		return func() {}
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Errorf("Error serving metrics: %v", err)
+		}
+	}()
+	log.Infof("Serving Prometheus metrics on http://%s/metrics", ln.Addr())
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(ctx)
+	}
+}
+
+// RunOnce performs a single check cycle: it opens the database, fetches the
+// feed, publishes new and updated items and closes the database again. It is
+// intended for tests and for embedding the pipeline in other programs.
+// Failures to publish are retried in later cycles rather than returned; use
+// Check to learn about them.
+func RunOnce(ctx context.Context, conf config.Config, deps Deps) error {
+	_, err := Check(ctx, conf, deps)
+	return err
+}
+
+// Outcome counts the publishes of a check cycle, per site and post, and the
+// items it did not publish again because they were published already or
+// predate the latest published item of the feed.
+type Outcome struct {
+	Published  int
+	Failed     int
+	Suppressed int
+}
+
+// FeedError is returned when the feed could not be fetched.
+type FeedError struct {
+	URL string
+	Err error
+}
+
+func (e *FeedError) Error() string { return e.Err.Error() }
+
+func (e *FeedError) Unwrap() error { return e.Err }
+
+// Check performs a single check cycle like RunOnce, and also returns the
+// outcome of its publishes, e.g. for an exit code. A failure to fetch the
+// feed is returned as a *FeedError.
+func Check(ctx context.Context, conf config.Config, deps Deps) (Outcome, error) {
+	if conf.FeedURL == "" {
+		return Outcome{}, fmt.Errorf("RSS feed URL is required")
+	}
+
+	r, err := newRunner(conf, deps)
 	if err != nil {
-		log.Error("Database error: ", err)
+		return Outcome{}, err
+	}
+	defer r.deps.reporter.Flush(5 * time.Second)
+	defer r.deps.reporter.Recover()
+	r.verifySites(ctx)
+	if err := r.open(); err != nil {
+		return Outcome{}, err
+	}
+	defer r.close()
+
+	err = r.cycle(ctx)
+	return r.outcome, err
+}
+
+// verifySites lets the publishers of the enabled sites check their site
+// against the configuration, which they may adjust.
+func (r *runner) verifySites(ctx context.Context) {
+	for _, site := range r.conf.EnabledSites() {
+		v, ok := r.deps.Publishers[site].(Verifier)
+		if !ok || !siteConfigured(&r.conf, site) {
+			continue
+		}
+		if err := v.Verify(ctx, &r.conf); err != nil {
+			log.Warnf("Could not verify %s: %v", siteNames[site], neterr.Classify(err))
+		}
+	}
+}
+
+// logSettings logs a summary of the effective settings, including the
+// accounts the enabled sites publish as, so that a glance at the logs shows
+// whether the deployment is configured as intended. Secrets are redacted by
+// the log hook.
+func (r *runner) logSettings(ctx context.Context) {
+	conf := &r.conf
+	var networks []string
+	for _, site := range conf.EnabledSites() {
+		account := "not configured"
+		if siteConfigured(conf, site) {
+			account = r.account(ctx, site)
+		}
+		networks = append(networks, fmt.Sprintf("%s (%s)", siteNames[site], account))
+	}
+	channels := notify.Channels(conf)
+	if len(channels) == 0 {
+		channels = []string{"none"}
+	}
+
+	fields := log.Fields{
+		"version":       version.Version,
+		"feed":          conf.FeedURL,
+		"interval":      r.interval(),
+		"networks":      strings.Join(networks, ", "),
+		"notifications": strings.Join(channels, ", "),
+		"database":      r.database(),
+	}
+	if conf.Category != "" {
+		fields["category"] = conf.Category
+	}
+	if conf.MetricsAddr != "" {
+		fields["metrics"] = conf.MetricsAddr
+	}
+	log.WithFields(fields).Info("Starting rss2socials")
+}
+
+// account returns the account site publishes as, or "account unknown" when
+// its publisher cannot tell.
+func (r *runner) account(ctx context.Context, site string) string {
+	resolver, ok := r.deps.Publishers[site].(AccountResolver)
+	if !ok {
+		return "account unknown"
+	}
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	account, err := resolver.Account(ctx, r.conf)
+	if err != nil {
+		log.Warnf("Could not look up the %s account: %v", siteNames[site], neterr.Classify(err))
+		return "account unknown"
+	}
+	return account
+}
+
+// database describes where posts are stored.
+func (r *runner) database() string {
+	switch {
+	case r.degraded:
+		return "memory (database unavailable)"
+	case r.conf.DBDriver == config.DBDriverMemory:
+		return "memory"
+	case r.redis != nil:
+		u, err := url.Parse(r.conf.RedisURL)
+		if err != nil {
+			return "redis"
+		}
+		return fmt.Sprintf("redis %s (prefix %s)", u.Redacted(), r.conf.RedisKeyPrefix)
+	case !r.ownsDB:
+		return "custom store"
+	}
+	path := r.conf.DBPath
+	if path == "" {
+		path = "./tooted_posts.db"
+	}
+	return "sqlite " + path
+}
+
+// cycle fetches the feed once and handles every item in it. It returns an
+// error only when the feed could not be fetched or the cycle panicked;
+// per-item problems are logged, recorded and notified instead.
+func (r *runner) cycle(ctx context.Context) (err error) {
+	conf := &r.conf
+	d := r.deps
+	defer d.recoverPanic(&err, errreport.Event{Message: "Panic in the check cycle", Tags: map[string]string{"feed": conf.FeedURL}})
+
+	if !r.lock() {
+		log.Infof("Another instance holds the cycle lock for %s, skipping this check", conf.FeedURL)
+		// Once this instance takes over, items published since it started
+		// are the new ones.
+		r.initStartupTime()
+		return nil
+	}
+	defer r.unlock()
+
+	d.pruneEvents(conf.EventsRetentionDays)
+	d.pruneEnrichments(conf.EnrichmentCacheHours)
+
+	timingsStart := metrics.DefaultTimings.Snapshot()
+	defer func() {
+		if timings := metrics.DefaultTimings.Snapshot().Sub(timingsStart); len(timings) > 0 {
+			log.Debugf("Cycle timings: %s", timings)
+		}
+	}()
+
+	feedURL := rss.ExpandFeedURL(conf.FeedURL, d.Clock.Now().In(r.loc))
+	if feedURL != conf.FeedURL {
+		log.Debugf("Fetching feed %s", feedURL)
+	}
+	posts, err := d.FeedFetcher.Fetch(ctx, feedURL)
+	if err != nil {
+		err = neterr.Classify(err)
+		d.recordEvent(db.ActionFailed, "feed", feedURL, err.Error())
+		return &FeedError{URL: feedURL, Err: err}
+	}
+	d.recordEvent(db.ActionFetched, "", feedURL, fmt.Sprintf("%d items", len(posts)))
+
+	r.initStartupTime()
+
+	if conf.ShortRun && len(posts) > 3 {
+		log.Info("Short run mode: processing only the 3 most recent items")
+		posts = posts[:3]
+	}
+
+	sortPostsChronologically(posts)
+
+	if r.seeding {
+		posts = d.seedPosts(posts, r.startupTime, r.startupTimeStr)
+		r.seeding = false
+	}
+
+	cycleStart := metrics.Default.Snapshot()
+	metrics.Default.Add(metrics.ItemsFetched, int64(len(posts)))
+	defer func() {
+		cycle := metrics.Default.Snapshot().Sub(cycleStart)
+		metrics.SetLastCycle(cycle)
+		r.outcome.Suppressed = int(cycle[metrics.DuplicatesSuppressed] + cycle[metrics.HighWaterSuppressed])
+		logCycleMetrics(cycle)
+	}()
+
+	r.outcome = r.runPipeline(ctx, posts)
+
+	d.repromotePosts(ctx, conf)
+
+	r.checkCredentials(ctx)
+
+	return nil
+}
+
+// initStartupTime sets the startup time in the first cycle.
+func (r *runner) initStartupTime() {
+	if !r.firstCycle {
 		return
 	}
+	r.startupTime = r.deps.Clock.Now().In(r.loc)
+	if r.degraded {
+		// Without the database, the items published since the
+		// previous check would have run are the new ones.
+		r.startupTime = r.startupTime.Add(-time.Duration(r.conf.Interval) * time.Minute)
+		r.seeding = true
+	}
+	r.startupTimeStr = r.startupTime.Format(time.RFC3339)
+	if r.conf.PostNewEntriesOnly && !r.deps.Store.IsFirstCycle() {
+		log.Info("PostNewEntriesOnly enabled: skipping posts already in DB from first cycle")
+	}
+	r.firstCycle = false
+}
 
-	if skipIfExisting && exists && !updated {
-		log.Debugf("Skipping existing post %s: PostNewEntriesOnly enabled on first cycle", post.Link)
+// seedPosts stores the posts published before cutoff, or without a pubDate,
+// as published to every site without publishing them, so that an in-memory
+// database does not treat the existing items of the feed as new. It returns
+// the remaining posts.
+func (d Deps) seedPosts(posts []rss.RSSItem, cutoff time.Time, startupTime string) []rss.RSSItem {
+	var remaining []rss.RSSItem
+	for _, post := range posts {
+		pubTime, err := post.ParsePubDate()
+		if strings.TrimSpace(post.Link) == "" || (err == nil && !pubTime.Before(cutoff)) {
+			remaining = append(remaining, post)
+			continue
+		}
+		if err := d.Store.StoreTootedPost(post.Link, post.Content, startupTime); err != nil {
+			log.Error("Storing post in database failed: ", err)
+			continue
+		}
+		for _, site := range siteOrder {
+			if err := d.Store.MarkSitePosted(post.Link, site); err != nil {
+				log.Errorf("Failed to mark %s as posted: %v", site, err)
+			}
+		}
+	}
+	log.Infof("Stored %d existing feed items in the in-memory database without posting them", len(posts)-len(remaining))
+	return remaining
+}
+
+// repromotePosts boosts or reposts, once, every published post whose
+// publication is at least RepromoteAfterDays old and whose link matches
+// RepromoteCategories. Only sites whose publisher implements Reposter and
+// that have a stored post ID are re-promoted, so the Store must implement
+// RepromoteStore and PostIDStore.
+func (d Deps) repromotePosts(ctx context.Context, conf *config.Config) {
+	if conf.RepromoteAfterDays <= 0 {
+		return
+	}
+	rs, ok := d.Store.(RepromoteStore)
+	ids, hasIDs := d.Store.(PostIDStore)
+	if !ok || !hasIDs {
+		return
+	}
+
+	links, err := rs.PostsToRepromote(d.Clock.Now().AddDate(0, 0, -conf.RepromoteAfterDays))
+	if err != nil {
+		log.Error("Error loading posts to re-promote: ", err)
 		return
 	}
 
-	var tootContent string
-	var isUpdate bool
+	for _, link := range links {
+		if ctx.Err() != nil {
+			return
+		}
+		if !matchesRepromoteCategories(link, conf.RepromoteCategories) {
+			continue
+		}
 
-	switch {
-	case exists && updated:
-		log.Printf("Post has been updated: %s", post.Title)
-		tootContent = fmt.Sprintf("Updated post: %s", post.Link)
-		isUpdate = true
-	case !exists:
-		tootContent = mastodon.GetTootContent(post)
-		isUpdate = false
-	case exists && !updated:
-		if sitePosted, err := db.IsSitePosted(post.Link, "mastodon"); err != nil || sitePosted {
-			if sitePosted, err := db.IsSitePosted(post.Link, "bluesky"); err != nil || sitePosted {
-				if sitePosted, err := db.IsSitePosted(post.Link, "threads"); err != nil || sitePosted {
-					return
-				}
+		for _, site := range siteOrder {
+			if !slices.Contains(conf.EnabledSites(), site) || !siteConfigured(conf, site) {
+				continue
+			}
+			reposter, ok := d.Publishers[site].(Reposter)
+			if !ok {
+				continue
+			}
+			id, err := ids.SitePostID(link, site)
+			if err != nil || id == "" {
+				continue
+			}
+			if err := reposter.Repost(ctx, *conf, id); err != nil {
+				d.Notifier.LogFailure(conf, fmt.Sprintf("Failed to re-promote %s post", siteNames[site]), link, err)
+				d.recordEvent(db.ActionFailed, site, link, err.Error())
+				continue
 			}
+			log.Infof("Re-promoted %s post for %s", siteNames[site], link)
+			d.recordEvent(db.ActionRepromoted, site, link, id)
 		}
-		tootContent = mastodon.GetTootContent(post)
-		isUpdate = false
-	default:
+
+		// Re-promotion happens once, even if a site failed, so that sites
+		// which succeeded are not boosted again.
+		if err := rs.MarkRepromoted(link); err != nil {
+			log.Errorf("Failed to mark %s as re-promoted: %v", link, err)
+		}
+	}
+}
+
+// matchesRepromoteCategories reports whether the last path segment of link
+// contains one of categories. An empty list matches every link.
+func matchesRepromoteCategories(link string, categories []string) bool {
+	if len(categories) == 0 {
+		return true
+	}
+	lastSegment := path.Base(link)
+	for _, cat := range categories {
+		if strings.Contains(lastSegment, cat) {
+			return true
+		}
+	}
+	return false
+}
+
+// recordEvent appends an entry to the audit trail and writes it to the event
+// stream, logging rather than propagating failures. Secrets are redacted from
+// detail, which often holds an error message, before it reaches any Store.
+func (d Deps) recordEvent(action, site, link, detail string) {
+	detail = redact.String(detail)
+	if err := d.Store.RecordEvent(action, site, link, detail); err != nil {
+		log.Error("Failed to record event: ", err)
+	}
+	d.emit(StreamEvent{Event: streamKinds[action], Action: action, Site: site, Link: link, Detail: detail})
+}
+
+// pruneEvents removes audit trail entries older than retentionDays. A
+// non-positive retention keeps events forever.
+func (d Deps) pruneEvents(retentionDays int) {
+	if retentionDays <= 0 {
 		return
 	}
+	n, err := d.Store.PruneEvents(d.Clock.Now().AddDate(0, 0, -retentionDays))
+	if err != nil {
+		log.Error("Failed to prune events: ", err)
+		return
+	}
+	if n > 0 {
+		log.Debugf("Pruned %d events older than %d days", n, retentionDays)
+	}
+}
 
-	if err := db.StoreTootedPost(post.Link, post.Content, startupTime); err != nil {
-		log.Error("Storing post in database failed: ", err)
+// logCycleMetrics logs the feed anomaly counters for one cycle. Malformed
+// items are logged as a warning since they usually mean the feed itself has
+// degraded.
+func logCycleMetrics(cycle metrics.Snapshot) {
+	if len(cycle) == 0 {
+		return
+	}
+	if cycle[metrics.MalformedItems] > 0 || cycle[metrics.UnparsablePubDates] > 0 {
+		log.Warnf("Feed anomalies this cycle: %s (totals: %s)", cycle, metrics.Default.Snapshot())
 		return
 	}
+	log.Infof("Cycle metrics: %s (totals: %s)", cycle, metrics.Default.Snapshot())
+}
 
-	enabledSites := conf.EnabledSites()
-	siteMap := make(map[string]bool, len(enabledSites))
-	for _, s := range enabledSites {
-		siteMap[s] = true
+// recoverInFlightPosts finds posts left stored but unpublished by a previous
+// run that was stopped or crashed mid-post, before any attempt or outcome of
+// them was recorded. Posts that failed, were skipped or were held back are
+// not in flight. They are not posted here; the returned set exempts them
+// from the PostNewEntriesOnly pubDate cutoff so the regular cycle retries
+// them while they remain in the feed.
+func (d Deps) recoverInFlightPosts() map[string]bool {
+	links, err := d.Store.UnpublishedPosts()
+	if err != nil {
+		log.Error("Error checking for in-flight posts from a previous run: ", err)
+		return nil
+	}
+	if len(links) == 0 {
+		return nil
 	}
+	log.Warnf("Found %d post(s) stored but not published by a previous run; retrying them while they remain in the feed", len(links))
+	inFlight := make(map[string]bool, len(links))
+	for _, link := range links {
+		log.Debugf("In-flight post from previous run: %s", link)
+		inFlight[link] = true
+	}
+	return inFlight
+}
 
-	if siteMap["mastodon"] {
-		alreadyPosted, err := db.IsSitePosted(post.Link, "mastodon")
-		switch {
-		case err != nil:
-			log.Error("Error checking mastodon post status: ", err)
-		case alreadyPosted && !isUpdate:
-			log.Debugf("Skipping Mastodon: already posted %s", post.Link)
-		default:
-			err = mastodon.TootPost(*conf, tootContent)
-			if err != nil {
-				if isUpdate {
-					gotify.LogFailure("Failed to toot updated post", err, conf)
-				} else {
-					gotify.LogFailure("Failed to toot new post", err, conf)
-				}
-			} else {
-				gotify.LogSuccess(fmt.Sprintf("Successfully posted to Mastodon: %s", post.Title), conf)
-				if markErr := db.MarkSitePosted(post.Link, "mastodon"); markErr != nil {
-					log.Error("Failed to mark mastodon as posted: ", markErr)
-				}
+// pendingRetryLinks returns the links of failed posts that are still being
+// retried. Like in-flight posts, they are exempted from the
+// PostNewEntriesOnly pubDate cutoff, which would otherwise skip them once
+// the process restarts.
+func (d Deps) pendingRetryLinks() []string {
+	rs, ok := d.Store.(RetryStore)
+	if !ok {
+		return nil
+	}
+	retries, err := rs.PendingRetries()
+	if err != nil {
+		log.Error("Error loading pending retries: ", err)
+		return nil
+	}
+	links := make([]string, 0, len(retries))
+	for _, r := range retries {
+		links = append(links, r.Link)
+	}
+	return links
+}
+
+// resumePendingRetries makes the failed posts a previous process was still
+// retrying due immediately, so that they are retried in the first cycle
+// after a restart instead of waiting out a backoff computed before it.
+func (d Deps) resumePendingRetries() {
+	rs, ok := d.Store.(RetryStore)
+	if !ok {
+		return
+	}
+	retries, err := rs.PendingRetries()
+	if err != nil {
+		log.Error("Error loading pending retries from a previous run: ", err)
+		return
+	}
+	if len(retries) == 0 {
+		return
+	}
+	log.Infof("Resuming %d pending retries from a previous run", len(retries))
+
+	now := d.Clock.Now()
+	for _, r := range retries {
+		log.Debugf("Pending %s retry from previous run: %s (%d attempts)", siteNames[r.Site], r.Link, r.Attempts)
+		if !r.NextAttempt.After(now) {
+			continue
+		}
+		r.NextAttempt = now
+		if err := rs.SaveRetry(r); err != nil {
+			log.Errorf("Failed to reschedule %s retry of %s: %v", r.Site, r.Link, err)
+		}
+	}
+}
+
+// siteOrder is the order in which enabled sites are published to.
+var siteOrder = []string{"mastodon", "bluesky", "threads", "newsletter"}
+
+// publishOrder returns the order in which sites are published to: the sites
+// of Config.SiteOrder followed by the remaining sites of siteOrder, with
+// every site moved after the site it depends on according to
+// Config.SiteDependencies. It fails on unknown sites and dependency cycles.
+func publishOrder(conf *config.Config) ([]string, error) {
+	for site, dep := range conf.SiteDependencies {
+		for _, s := range []string{site, dep} {
+			if _, ok := siteNames[s]; !ok {
+				return nil, fmt.Errorf("unknown site %q in SiteDependencies", s)
 			}
 		}
 	}
 
-	if siteMap["bluesky"] && conf.BlueskyHandle != "" && conf.BlueskyAppKey != "" {
-		alreadyPosted, err := db.IsSitePosted(post.Link, "bluesky")
-		switch {
-		case err != nil:
-			log.Error("Error checking bluesky post status: ", err)
-		case alreadyPosted && !isUpdate:
-			log.Debugf("Skipping Bluesky: already posted %s", post.Link)
-		default:
-			if err := bluesky.Post(context.Background(), *conf, tootContent); err != nil {
-				gotify.LogFailure(fmt.Sprintf("Failed to post to Bluesky: %s", post.Title), err, conf)
-			} else {
-				gotify.LogSuccess(fmt.Sprintf("Successfully posted to Bluesky: %s", post.Title), conf)
-				if markErr := db.MarkSitePosted(post.Link, "bluesky"); markErr != nil {
-					log.Error("Failed to mark bluesky as posted: ", markErr)
-				}
+	order := make([]string, 0, len(siteOrder))
+	visiting := map[string]bool{}
+	visited := map[string]bool{}
+	var visit func(site string) error
+	visit = func(site string) error {
+		if visited[site] {
+			return nil
+		}
+		if visiting[site] {
+			return fmt.Errorf("SiteDependencies contains a cycle involving %s", site)
+		}
+		visiting[site] = true
+		if dep := conf.SiteDependencies[site]; dep != "" {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		visited[site] = true
+		order = append(order, site)
+		return nil
+	}
+
+	for _, site := range conf.SiteOrder {
+		if _, ok := siteNames[site]; !ok {
+			return nil, fmt.Errorf("unknown site %q in SiteOrder", site)
+		}
+		if err := visit(site); err != nil {
+			return nil, err
+		}
+	}
+	for _, site := range siteOrder {
+		if err := visit(site); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
+
+// siteNames are the display names of each site used in log messages.
+var siteNames = map[string]string{
+	"mastodon":   "Mastodon",
+	"bluesky":    "Bluesky",
+	"threads":    "Threads",
+	"newsletter": "Newsletter",
+}
+
+// siteConfigured reports whether the credentials required to publish to site
+// are present.
+func siteConfigured(conf *config.Config, site string) bool {
+	switch site {
+	case "bluesky":
+		return conf.BlueskyHandle != "" && (conf.BlueskyAppKey != "" || conf.BlueskyAuth == config.BlueskyAuthOAuth)
+	case "threads":
+		return conf.ThreadsToken != "" && conf.ThreadsClientID != "" && conf.ThreadsClientSecret != ""
+	case "newsletter":
+		return conf.NewsletterConfigured()
+	}
+	return true
+}
+
+// failureTitle returns the notification title used when publishing post to
+// site fails.
+func failureTitle(site string, post rss.RSSItem, isUpdate bool) string {
+	return failureTitleFor([]string{siteNames[site]}, post, isUpdate)
+}
+
+// failureTitleFor returns the notification title used when publishing post
+// to the sites with the given display names fails.
+func failureTitleFor(names []string, post rss.RSSItem, isUpdate bool) string {
+	if isUpdate {
+		return fmt.Sprintf("Failed to post update to %s: %s", strings.Join(names, ", "), post.Title)
+	}
+	return fmt.Sprintf("Failed to post to %s: %s", strings.Join(names, ", "), post.Title)
+}
+
+// updatesOriginal reports whether updated posts should be published in
+// relation to the original post on site (edited on Mastodon, replied to or
+// quoted on Threads) rather than as a standalone post.
+func updatesOriginal(conf *config.Config, site string) bool {
+	switch site {
+	case "mastodon":
+		return conf.MastodonEditUpdates && mastodon.FlavorOf(*conf).CanEdit
+	case "threads":
+		return conf.ThreadsUpdateMode == config.ThreadsUpdateReply || conf.ThreadsUpdateMode == config.ThreadsUpdateQuote
+	}
+	return false
+}
+
+// originalUpdater returns the Updater and stored post ID to use for updating
+// the original post published to site for link, or a nil Updater when the
+// update should be published as a standalone post instead: updating the
+// original is disabled, the publisher does not support it, the Store does not
+// implement PostIDStore, or no post ID was recorded.
+func (d Deps) originalUpdater(conf *config.Config, site string, publisher Publisher, link string) (Updater, string) {
+	if !updatesOriginal(conf, site) {
+		return nil, ""
+	}
+	updater, ok := publisher.(Updater)
+	if !ok {
+		return nil, ""
+	}
+	ids, ok := d.Store.(PostIDStore)
+	if !ok {
+		return nil, ""
+	}
+	id, err := ids.SitePostID(link, site)
+	if err != nil {
+		log.Errorf("Error loading %s post ID: %v", site, err)
+		return nil, ""
+	}
+	if id == "" {
+		log.Debugf("No %s post ID stored for %s; publishing the update as a new post", siteNames[site], link)
+		return nil, ""
+	}
+	return updater, id
+}
+
+// updatePost publishes p as an update to the post with the given ID on site.
+func (d Deps) updatePost(ctx context.Context, conf *config.Config, site string, updater Updater, id string, p Post) error {
+	post := p.Item
+	start := time.Now()
+	err := func() (err error) {
+		defer d.recoverPanic(&err, sitePanic(conf, site, post))
+		return updater.Update(ctx, *conf, id, p)
+	}()
+	metrics.Observe(metrics.Publish, site, time.Since(start))
+	if err != nil {
+		err = neterr.Classify(err)
+		d.recordEvent(db.ActionFailed, site, post.Link, err.Error())
+		d.scheduleRetry(conf, site, post, err)
+		return err
+	}
+	d.recordEvent(db.ActionUpdated, site, post.Link, id)
+	d.clearRetry(site, post.Link)
+	if err := d.Store.MarkSitePosted(post.Link, site); err != nil {
+		log.Errorf("Failed to mark %s as posted: %v", site, err)
+	}
+	return nil
+}
+
+// maxRetryBackoff caps the delay between retries of a failed post.
+const maxRetryBackoff = 24 * time.Hour
+
+// retryBackoff returns how long to wait before retrying a post that failed
+// attempts times: RetryBackoffMinutes, doubled for every further attempt,
+// capped at maxRetryBackoff.
+func retryBackoff(conf *config.Config, attempts int) time.Duration {
+	backoff := time.Duration(conf.RetryBackoffMinutes) * time.Minute
+	if backoff <= 0 {
+		return 0
+	}
+	for i := 1; i < attempts && backoff < maxRetryBackoff; i++ {
+		backoff *= 2
+	}
+	return min(backoff, maxRetryBackoff)
+}
+
+// retryDue reports whether publishing link to site may be attempted now: it
+// has not been given up on and its next retry, if any, is due.
+func (d Deps) retryDue(site, link string) bool {
+	rs, ok := d.Store.(RetryStore)
+	if !ok {
+		return true
+	}
+	r, err := rs.Retry(link, site)
+	if err != nil {
+		log.Errorf("Error loading %s retry state: %v", site, err)
+		return true
+	}
+	switch {
+	case r.Dead:
+		log.Debugf("Skipping %s for %s: gave up after %d attempts", siteNames[site], link, r.Attempts)
+		return false
+	case d.Clock.Now().Before(r.NextAttempt):
+		log.Debugf("Skipping %s for %s: next retry at %s", siteNames[site], link, r.NextAttempt.Format(time.RFC3339))
+		return false
+	}
+	return true
+}
+
+// scheduleRetry records a failed attempt to publish post to site and
+// schedules the next one. After RetryMaxAttempts failures the post is given
+// up on, which is recorded as an event and notified. Failures are reported to
+// Sentry after SentryFailureThreshold attempts; when the Store does not
+// implement RetryStore they are not counted, so every one is reported.
+func (d Deps) scheduleRetry(conf *config.Config, site string, post rss.RSSItem, err error) {
+	var r db.Retry
+	rs, counted := d.Store.(RetryStore)
+	if counted {
+		var getErr error
+		if r, getErr = rs.Retry(post.Link, site); getErr != nil {
+			log.Errorf("Error loading %s retry state: %v", site, getErr)
+			r, counted = db.Retry{}, false
+		}
+	}
+	now := d.Clock.Now()
+	r.Link, r.Site = post.Link, site
+	r.Attempts++
+	r.LastAttempt = now
+	r.LastError = err.Error()
+	r.NextAttempt = now.Add(retryBackoff(conf, r.Attempts))
+	r.Dead = counted && conf.RetryMaxAttempts > 0 && r.Attempts >= conf.RetryMaxAttempts
+
+	if !counted || r.Attempts >= conf.SentryFailureThreshold {
+		d.reporter.Capture(errreport.Event{
+			Message: "Failed to publish to " + siteNames[site],
+			Err:     err,
+			Tags: map[string]string{
+				"feed":     conf.FeedURL,
+				"network":  site,
+				"link":     post.Link,
+				"attempts": strconv.Itoa(r.Attempts),
+				"gave_up":  strconv.FormatBool(r.Dead),
+			},
+			Fingerprint: []string{"publish-failure", site},
+		})
+	}
+
+	if !counted {
+		return
+	}
+	if saveErr := rs.SaveRetry(r); saveErr != nil {
+		log.Errorf("Failed to store %s retry state: %v", site, saveErr)
+		return
+	}
+
+	if r.Dead {
+		d.recordEvent(db.ActionDeadLettered, site, post.Link, r.LastError)
+		d.Notifier.LogFailure(conf, fmt.Sprintf("Gave up posting to %s after %d attempts: %s", siteNames[site], r.Attempts, post.Title), post.Link, err)
+	}
+}
+
+// clearRetry forgets the failed attempts to publish link to site once it was
+// published there.
+func (d Deps) clearRetry(site, link string) {
+	rs, ok := d.Store.(RetryStore)
+	if !ok {
+		return
+	}
+	if err := rs.ClearRetry(link, site); err != nil {
+		log.Errorf("Failed to clear %s retry state: %v", site, err)
+	}
+}
+
+// siteOutcome is the result of publishing a post to a single site.
+type siteOutcome struct {
+	site string
+	// updated is set when the original post was updated rather than a new
+	// post published.
+	updated bool
+	// scheduledAt is set when the post was scheduled on the site rather
+	// than published.
+	scheduledAt time.Time
+	err         error
+}
+
+// notifyOutcomes reports the outcome of publishing post. When every site
+// succeeded, each success is reported on its own. Otherwise a single failure
+// notification lists the outcome on every site that was attempted, so that a
+// partial failure is reported once and with its full context.
+func (d Deps) notifyOutcomes(conf *config.Config, post rss.RSSItem, isUpdate bool, outcomes []siteOutcome) {
+	var failed []string
+	for _, o := range outcomes {
+		if o.err != nil {
+			failed = append(failed, siteNames[o.site])
+		}
+	}
+
+	if len(failed) == 0 {
+		for _, o := range outcomes {
+			msg := fmt.Sprintf("Successfully posted to %s: %s", siteNames[o.site], post.Title)
+			switch {
+			case o.updated:
+				msg = fmt.Sprintf("Successfully updated %s post: %s", siteNames[o.site], post.Title)
+			case !o.scheduledAt.IsZero():
+				msg = fmt.Sprintf("Successfully scheduled %s post for %s: %s", siteNames[o.site], o.scheduledAt.Format(time.RFC3339), post.Title)
 			}
+			d.Notifier.LogSuccess(conf, msg, post.Link)
 		}
+		return
+	}
+
+	if len(outcomes) == 1 {
+		d.Notifier.LogFailure(conf, failureTitle(outcomes[0].site, post, isUpdate), post.Link, outcomes[0].err)
+		return
 	}
 
-	if siteMap["threads"] && conf.ThreadsToken != "" && conf.ThreadsClientID != "" && conf.ThreadsClientSecret != "" {
-		alreadyPosted, err := db.IsSitePosted(post.Link, "threads")
+	lines := make([]string, 0, len(outcomes))
+	for _, o := range outcomes {
 		switch {
-		case err != nil:
-			log.Error("Error checking threads post status: ", err)
-		case alreadyPosted && !isUpdate:
-			log.Debugf("Skipping Threads: already posted %s", post.Link)
+		case o.err != nil:
+			lines = append(lines, fmt.Sprintf("%s: failed: %v", siteNames[o.site], o.err))
+		case o.updated:
+			lines = append(lines, fmt.Sprintf("%s: updated", siteNames[o.site]))
+		case !o.scheduledAt.IsZero():
+			lines = append(lines, fmt.Sprintf("%s: scheduled for %s", siteNames[o.site], o.scheduledAt.Format(time.RFC3339)))
 		default:
-			if err := threads.Post(context.Background(), *conf, tootContent); err != nil {
-				gotify.LogFailure(fmt.Sprintf("Failed to post to Threads: %s", post.Title), err, conf)
-			} else {
-				gotify.LogSuccess(fmt.Sprintf("Successfully posted to Threads: %s", post.Title), conf)
-				if markErr := db.MarkSitePosted(post.Link, "threads"); markErr != nil {
-					log.Error("Failed to mark threads as posted: ", markErr)
-				}
-			}
+			lines = append(lines, fmt.Sprintf("%s: published", siteNames[o.site]))
+		}
+	}
+	d.Notifier.LogFailure(conf, failureTitleFor(failed, post, isUpdate), post.Link, errors.New(strings.Join(lines, "\n")))
+}
+
+// schedulePost schedules p on site to be published at at. A scheduled post
+// counts as posted, so it is not published again once at has passed.
+func (d Deps) schedulePost(ctx context.Context, conf *config.Config, site string, scheduler Scheduler, p Post, at time.Time) error {
+	post := p.Item
+	err := func() (err error) {
+		defer d.recoverPanic(&err, sitePanic(conf, site, post))
+		return scheduler.Schedule(ctx, *conf, p, at)
+	}()
+	if err := neterr.Classify(err); err != nil {
+		d.recordEvent(db.ActionFailed, site, post.Link, err.Error())
+		d.scheduleRetry(conf, site, post, err)
+		return err
+	}
+	log.Infof("Scheduled %s post of %s for %s", siteNames[site], post.Link, at.Format(time.RFC3339))
+	d.recordEvent(db.ActionScheduled, site, post.Link, at.Format(time.RFC3339))
+	d.clearRetry(site, post.Link)
+	if err := d.Store.MarkSitePosted(post.Link, site); err != nil {
+		log.Errorf("Failed to mark %s as posted: %v", site, err)
+	}
+	return nil
+}
+
+// truncate shortens content to the post length limit of site.
+func truncate(conf *config.Config, site, content string) string {
+	if site == "mastodon" {
+		return mastodon.Truncate(*conf, content)
+	}
+	return charcount.Truncate(site, content, charcount.Limits[site])
+}
+
+// publish publishes p with the publisher of site. Network errors are
+// classified by neterr, and a panic of the publisher is returned as an error.
+func (d Deps) publish(ctx context.Context, conf *config.Config, site string, publisher Publisher, p Post) (id string, err error) {
+	start := time.Now()
+	defer func() { metrics.Observe(metrics.Publish, site, time.Since(start)) }()
+	defer d.recoverPanic(&err, sitePanic(conf, site, p.Item))
+	id, err = publisher.Publish(ctx, *conf, p)
+	return id, neterr.Classify(err)
+}
+
+// DeletePost removes the social posts published for link. Currently only
+// Bluesky records can be deleted, using the at:// URI stored at publish time.
+// The post stays in the database, still marked as posted, so it is not
+// republished while it remains in the feed.
+func DeletePost(ctx context.Context, conf config.Config, link string) error {
+	if conf.DBDriver == config.DBDriverMemory || conf.DBDriver == config.DBDriverRedis {
+		return fmt.Errorf("deleting posts is only supported with DBDriver sqlite")
+	}
+	db.InitDB(conf.DBPath)
+	defer db.CloseDB()
+	d := Deps{}.withDefaults()
+
+	uri, err := db.SitePostID(link, "bluesky")
+	if err != nil {
+		return err
+	}
+
+	if uri == "" {
+		if posted, _ := db.IsSitePosted(link, "bluesky"); posted {
+			log.Warnf("No Bluesky record URI stored for %s; it was published before URIs were recorded and must be deleted manually", link)
+		} else {
+			log.Infof("%s was not posted to Bluesky", link)
+		}
+	} else {
+		if err := bluesky.DeletePost(ctx, conf, uri); err != nil {
+			d.recordEvent(db.ActionFailed, "bluesky", link, err.Error())
+			return err
+		}
+		if err := db.SetSitePostID(link, "bluesky", ""); err != nil {
+			log.Error("Failed to clear Bluesky record URI: ", err)
+		}
+		d.recordEvent(db.ActionDeleted, "bluesky", link, uri)
+		log.Infof("Deleted Bluesky post %s for %s", uri, link)
+	}
+
+	for _, site := range []string{"mastodon", "threads"} {
+		if posted, _ := db.IsSitePosted(link, site); posted {
+			log.Warnf("Deleting %s posts is not supported; remove the %s post for %s manually", siteNames[site], siteNames[site], link)
 		}
 	}
+
+	return nil
 }
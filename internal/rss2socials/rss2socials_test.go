@@ -1,6 +1,7 @@
 package rss2socials
 
 import (
+	"context"
 	"encoding/json"
 	"encoding/xml"
 	"fmt"
@@ -18,12 +19,16 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/toozej/rss2socials/internal/db"
+	"github.com/toozej/rss2socials/internal/metrics"
 	"github.com/toozej/rss2socials/internal/rss"
 	"github.com/toozej/rss2socials/pkg/config"
 
 	_ "github.com/glebarez/sqlite"
 )
 
+// defaultDeps publishes through the production clients and database.
+var defaultDeps = Deps{}.withDefaults()
+
 type MockRSSChecker struct {
 	mock.Mock
 }
@@ -112,6 +117,81 @@ func TestShouldSkipPost(t *testing.T) {
 	}
 }
 
+func TestMatchesCategory(t *testing.T) {
+	segmentOnly := rss.RSSItem{Link: "https://example.com/go-tips-tech"}
+	rssOnly := rss.RSSItem{Link: "https://example.com/2024/hello", Categories: []string{"Go", " Tech "}}
+
+	tests := []struct {
+		name string
+		post rss.RSSItem
+		mode string
+		want bool
+	}{
+		{"url-segment matches segment", segmentOnly, config.CategoryFilterURLSegment, true},
+		{"url-segment ignores categories", rssOnly, config.CategoryFilterURLSegment, false},
+		{"empty mode is url-segment", segmentOnly, "", true},
+		{"rss-category matches categories case-insensitively", rssOnly, config.CategoryFilterRSSCategory, true},
+		{"rss-category ignores segment", segmentOnly, config.CategoryFilterRSSCategory, false},
+		{"both matches segment", segmentOnly, config.CategoryFilterBoth, true},
+		{"both matches categories", rssOnly, config.CategoryFilterBoth, true},
+		{"both matches neither", rss.RSSItem{Link: "https://example.com/hello", Categories: []string{"Life"}}, config.CategoryFilterBoth, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, matchesCategory(tt.post, "tech", tt.mode))
+		})
+	}
+}
+
+func TestMatchesExtensions(t *testing.T) {
+	post := rss.RSSItem{Extensions: rss.Extensions{
+		"itunes": {"episodeType": {{Name: "episodeType", Value: "Full"}}},
+	}}
+
+	tests := []struct {
+		name    string
+		filters map[string]string
+		want    bool
+	}{
+		{"value contained ignoring case", map[string]string{"itunes:episodeType": "full"}, true},
+		{"value not contained", map[string]string{"itunes:episodeType": "trailer"}, false},
+		{"empty value requires presence", map[string]string{"itunes:episodeType": ""}, true},
+		{"missing element", map[string]string{"itunes:explicit": ""}, false},
+		{"every filter must match", map[string]string{"itunes:episodeType": "full", "itunes:explicit": "no"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, matchesExtensions(post, tt.filters))
+		})
+	}
+}
+
+func TestLinkDomainAllowed(t *testing.T) {
+	tests := []struct {
+		name        string
+		link        string
+		allow, deny []string
+		want        bool
+		wantDomain  string
+	}{
+		{"no lists", "https://example.com/post", nil, nil, true, ""},
+		{"allowed domain", "https://example.com/post", []string{"example.com"}, nil, true, ""},
+		{"allowed subdomain", "https://blog.Example.com:8443/post", []string{"example.com"}, nil, true, ""},
+		{"not allowed", "https://partner.net/post", []string{"example.com"}, nil, false, "partner.net"},
+		{"suffix is not a subdomain", "https://notexample.com/post", []string{"example.com"}, nil, false, "notexample.com"},
+		{"denied subdomain", "https://news.partner.net/post", nil, []string{"*.partner.net"}, false, "*.partner.net"},
+		{"denylist wins", "https://partner.example.com/post", []string{"example.com"}, []string{"partner.example.com"}, false, "partner.example.com"},
+		{"not denied", "https://example.com/post", nil, []string{"partner.net"}, true, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			domain, ok := linkDomainAllowed(tt.link, tt.allow, tt.deny)
+			assert.Equal(t, tt.want, ok)
+			assert.Equal(t, tt.wantDomain, domain)
+		})
+	}
+}
+
 func setupTestDB(t *testing.T) {
 	t.Helper()
 	db.InitDB()
@@ -145,9 +225,9 @@ func TestHandlePost_NewPost(t *testing.T) {
 	}
 
 	post := rss.RSSItem{Link: "https://example.com/new-post", Content: "content", Title: "New Post"}
-	handlePost(post, conf, "2026-01-01T00:00:00Z", false)
+	defaultDeps.handlePost(context.Background(), post, conf, "2026-01-01T00:00:00Z", false)
 
-	exists, updated, err := db.HasPostChanged(post.Link, post.Content)
+	exists, updated, err := db.HasPostChanged(post.Link, post.Content, rss.DefaultHashing)
 	assert.NoError(t, err)
 	assert.True(t, exists)
 	assert.False(t, updated)
@@ -184,10 +264,10 @@ func TestHandlePost_UnchangedPostSkipsPosting(t *testing.T) {
 
 	post := rss.RSSItem{Link: "https://example.com/unchanged-post", Content: "same content", Title: "Same Post"}
 
-	handlePost(post, conf, "2026-01-01T00:00:00Z", false)
+	defaultDeps.handlePost(context.Background(), post, conf, "2026-01-01T00:00:00Z", false)
 	assert.Equal(t, 1, postCount, "Should post once for new post")
 
-	handlePost(post, conf, "2026-01-01T00:00:00Z", false)
+	defaultDeps.handlePost(context.Background(), post, conf, "2026-01-01T00:00:00Z", false)
 	assert.Equal(t, 1, postCount, "Should NOT post again for unchanged post")
 }
 
@@ -218,7 +298,7 @@ func TestHandlePost_NoDuplicatesOnRestart(t *testing.T) {
 
 	// First run
 	setupTestDB(t)
-	handlePost(post, conf, "2026-01-01T00:00:00Z", false)
+	defaultDeps.handlePost(context.Background(), post, conf, "2026-01-01T00:00:00Z", false)
 	assert.Equal(t, 1, postCount, "Should post once for new post")
 
 	// Close DB (simulating application shutdown)
@@ -231,7 +311,7 @@ func TestHandlePost_NoDuplicatesOnRestart(t *testing.T) {
 		os.Remove("./tooted_posts.db")
 	})
 
-	handlePost(post, conf, "2026-01-01T00:00:00Z", false)
+	defaultDeps.handlePost(context.Background(), post, conf, "2026-01-01T00:00:00Z", false)
 	assert.Equal(t, 1, postCount, "Should NOT post again after restart for same post")
 }
 
@@ -267,11 +347,11 @@ func TestHandlePost_PartialFailureRetries(t *testing.T) {
 	post := rss.RSSItem{Link: "https://example.com/partial-fail", Content: "content", Title: "Partial Fail"}
 
 	// First attempt: Mastodon fails
-	handlePost(post, conf, "2026-01-01T00:00:00Z", false)
+	defaultDeps.handlePost(context.Background(), post, conf, "2026-01-01T00:00:00Z", false)
 	assert.Equal(t, 1, callCount, "Should attempt to post once")
 
 	// Post is stored in DB even though Mastodon failed
-	exists, _, err := db.HasPostChanged(post.Link, post.Content)
+	exists, _, err := db.HasPostChanged(post.Link, post.Content, rss.DefaultHashing)
 	assert.NoError(t, err)
 	assert.True(t, exists)
 
@@ -281,7 +361,7 @@ func TestHandlePost_PartialFailureRetries(t *testing.T) {
 	assert.False(t, posted, "Mastodon should NOT be marked posted after failure")
 
 	// Second attempt: Mastodon succeeds (retries because site not marked)
-	handlePost(post, conf, "2026-01-01T00:00:00Z", false)
+	defaultDeps.handlePost(context.Background(), post, conf, "2026-01-01T00:00:00Z", false)
 	assert.Equal(t, 2, callCount, "Should retry posting since Mastodon was not marked as posted")
 
 	// Now Mastodon IS marked as posted
@@ -290,7 +370,7 @@ func TestHandlePost_PartialFailureRetries(t *testing.T) {
 	assert.True(t, posted, "Mastodon should be marked posted after success")
 
 	// Third attempt: should not post again
-	handlePost(post, conf, "2026-01-01T00:00:00Z", false)
+	defaultDeps.handlePost(context.Background(), post, conf, "2026-01-01T00:00:00Z", false)
 	assert.Equal(t, 2, callCount, "Should NOT retry after successful post")
 }
 
@@ -321,7 +401,7 @@ func TestHandlePost_PerSiteIndependence(t *testing.T) {
 
 	post := rss.RSSItem{Link: "https://example.com/multi-site", Content: "content", Title: "Multi Site"}
 
-	handlePost(post, conf, "2026-01-01T00:00:00Z", false)
+	defaultDeps.handlePost(context.Background(), post, conf, "2026-01-01T00:00:00Z", false)
 
 	// Mastodon posted and marked
 	assert.Equal(t, 1, mastodonCallCount)
@@ -367,7 +447,7 @@ func TestHandlePost_UpdatedPostReposts(t *testing.T) {
 
 	post := rss.RSSItem{Link: "https://example.com/updated-post", Content: "original", Title: "Updated Post"}
 
-	handlePost(post, conf, "2026-01-01T00:00:00Z", false)
+	defaultDeps.handlePost(context.Background(), post, conf, "2026-01-01T00:00:00Z", false)
 	assert.Equal(t, 1, postCount, "Should post for new post")
 
 	posted, err := db.IsSitePosted(post.Link, "mastodon")
@@ -375,7 +455,7 @@ func TestHandlePost_UpdatedPostReposts(t *testing.T) {
 	assert.True(t, posted, "Mastodon should be marked posted after first post")
 
 	post.Content = "updated content"
-	handlePost(post, conf, "2026-01-01T00:00:00Z", false)
+	defaultDeps.handlePost(context.Background(), post, conf, "2026-01-01T00:00:00Z", false)
 	assert.Equal(t, 2, postCount, "Should post again for updated content")
 }
 
@@ -431,7 +511,7 @@ func TestHandlePost_WithCategoryMatch(t *testing.T) {
 
 	post := rss.RSSItem{Link: "https://example.com/new-post-tech", Content: "content", Title: "New Post"}
 
-	handlePost(post, conf, "2026-01-01T00:00:00Z", false)
+	defaultDeps.handlePost(context.Background(), post, conf, "2026-01-01T00:00:00Z", false)
 	assert.Equal(t, 1, postCount)
 }
 
@@ -456,9 +536,9 @@ func TestHandlePost_MastodonErrorDoesNotMarkPosted(t *testing.T) {
 
 	post := rss.RSSItem{Link: "https://example.com/error-post", Content: "content", Title: "Error Post"}
 
-	handlePost(post, conf, "2026-01-01T00:00:00Z", false)
+	defaultDeps.handlePost(context.Background(), post, conf, "2026-01-01T00:00:00Z", false)
 
-	exists, _, err := db.HasPostChanged(post.Link, post.Content)
+	exists, _, err := db.HasPostChanged(post.Link, post.Content, rss.DefaultHashing)
 	assert.NoError(t, err)
 	assert.True(t, exists, "Post should be stored in DB even on Mastodon error")
 
@@ -632,9 +712,9 @@ func TestBasicIntegration(t *testing.T) {
 	}
 
 	post := rss.RSSItem{Link: "https://test.com/new-post", Content: "test content", Title: "Test Post"}
-	handlePost(post, conf, "2026-01-01T00:00:00Z", false)
+	defaultDeps.handlePost(context.Background(), post, conf, "2026-01-01T00:00:00Z", false)
 
-	exists, updated, err := db.HasPostChanged(post.Link, post.Content)
+	exists, updated, err := db.HasPostChanged(post.Link, post.Content, rss.DefaultHashing)
 	assert.NoError(t, err)
 	assert.True(t, exists)
 	assert.False(t, updated)
@@ -644,14 +724,14 @@ func TestBasicIntegration(t *testing.T) {
 	assert.True(t, posted)
 
 	post.Content = "updated content"
-	existsBefore, updatedBefore, err := db.HasPostChanged(post.Link, post.Content)
+	existsBefore, updatedBefore, err := db.HasPostChanged(post.Link, post.Content, rss.DefaultHashing)
 	assert.NoError(t, err)
 	assert.True(t, existsBefore)
 	assert.True(t, updatedBefore)
 
-	handlePost(post, conf, "2026-01-01T00:00:00Z", false)
+	defaultDeps.handlePost(context.Background(), post, conf, "2026-01-01T00:00:00Z", false)
 
-	exists, updated, err = db.HasPostChanged(post.Link, post.Content)
+	exists, updated, err = db.HasPostChanged(post.Link, post.Content, rss.DefaultHashing)
 	assert.NoError(t, err)
 	assert.True(t, exists)
 	assert.False(t, updated)
@@ -685,17 +765,17 @@ func TestHandlePost_SkipExistingOnFirstCycle(t *testing.T) {
 	existingPost := rss.RSSItem{Link: "https://example.com/existing-post", Content: "old content", Title: "Existing Post"}
 	newPost := rss.RSSItem{Link: "https://example.com/new-post", Content: "new content", Title: "New Post"}
 
-	if err := db.StoreTootedPost(existingPost.Link, existingPost.Content, "2025-01-01T00:00:00Z"); err != nil {
+	if err := db.StoreTootedPost(existingPost.Link, existingPost.Content, "2025-01-01T00:00:00Z", time.Now(), db.DefaultContent, time.Local); err != nil {
 		t.Fatalf("Failed to seed existing post: %v", err)
 	}
-	if err := db.MarkSitePosted(existingPost.Link, "mastodon"); err != nil {
+	if err := db.MarkSitePosted(existingPost.Link, "mastodon", time.Now(), time.Local); err != nil {
 		t.Fatalf("Failed to mark existing post as posted: %v", err)
 	}
 
-	handlePost(existingPost, conf, "2026-01-01T00:00:00Z", true)
+	defaultDeps.handlePost(context.Background(), existingPost, conf, "2026-01-01T00:00:00Z", true)
 	assert.Equal(t, 0, postCount, "Should NOT post existing entry when skipIfExisting=true")
 
-	handlePost(newPost, conf, "2026-01-01T00:00:00Z", true)
+	defaultDeps.handlePost(context.Background(), newPost, conf, "2026-01-01T00:00:00Z", true)
 	assert.Equal(t, 1, postCount, "Should post truly new entry even when skipIfExisting=true")
 }
 
@@ -727,17 +807,17 @@ func TestHandlePost_PostAllWhenSkipDisabled(t *testing.T) {
 	existingPost := rss.RSSItem{Link: "https://example.com/existing-post2", Content: "old content", Title: "Existing Post"}
 	newPost := rss.RSSItem{Link: "https://example.com/new-post2", Content: "new content", Title: "New Post"}
 
-	if err := db.StoreTootedPost(existingPost.Link, existingPost.Content, "2025-01-01T00:00:00Z"); err != nil {
+	if err := db.StoreTootedPost(existingPost.Link, existingPost.Content, "2025-01-01T00:00:00Z", time.Now(), db.DefaultContent, time.Local); err != nil {
 		t.Fatalf("Failed to seed existing post: %v", err)
 	}
-	if err := db.MarkSitePosted(existingPost.Link, "mastodon"); err != nil {
+	if err := db.MarkSitePosted(existingPost.Link, "mastodon", time.Now(), time.Local); err != nil {
 		t.Fatalf("Failed to mark existing post as posted: %v", err)
 	}
 
-	handlePost(existingPost, conf, "2026-01-01T00:00:00Z", false)
+	defaultDeps.handlePost(context.Background(), existingPost, conf, "2026-01-01T00:00:00Z", false)
 	assert.Equal(t, 0, postCount, "Should not re-post already-fully-posted entry even with skipIfExisting=false")
 
-	handlePost(newPost, conf, "2026-01-01T00:00:00Z", false)
+	defaultDeps.handlePost(context.Background(), newPost, conf, "2026-01-01T00:00:00Z", false)
 	assert.Equal(t, 1, postCount, "Should post new entry with skipIfExisting=false")
 }
 
@@ -767,12 +847,12 @@ func TestHandlePost_FirstCycleSkipOnlyExistingUnchanged(t *testing.T) {
 	}
 
 	updatedPost := rss.RSSItem{Link: "https://example.com/updated-first-cycle", Content: "original", Title: "Updated Post"}
-	if err := db.StoreTootedPost(updatedPost.Link, "original", "2025-01-01T00:00:00Z"); err != nil {
+	if err := db.StoreTootedPost(updatedPost.Link, "original", "2025-01-01T00:00:00Z", time.Now(), db.DefaultContent, time.Local); err != nil {
 		t.Fatalf("Failed to seed post: %v", err)
 	}
 
 	updatedPost.Content = "updated content"
-	handlePost(updatedPost, conf, "2026-01-01T00:00:00Z", true)
+	defaultDeps.handlePost(context.Background(), updatedPost, conf, "2026-01-01T00:00:00Z", true)
 	assert.Equal(t, 1, postCount, "Should post updated entry even when skipIfExisting=true")
 }
 
@@ -990,10 +1070,10 @@ func TestRun_ShortRunSkipsAlreadyPostedItems(t *testing.T) {
 	// already posted to mastodon. SHORT_RUN should skip it and post
 	// only the next two items (post-1, post-2).
 	db.InitDB(dbFile)
-	if err := db.StoreTootedPost("https://example.com/post-0", "Content 0", "2025-01-01T00:00:00Z"); err != nil {
+	if err := db.StoreTootedPost("https://example.com/post-0", "Content 0", "2025-01-01T00:00:00Z", time.Now(), db.DefaultContent, time.Local); err != nil {
 		t.Fatalf("seed StoreTootedPost failed: %v", err)
 	}
-	if err := db.MarkSitePosted("https://example.com/post-0", "mastodon"); err != nil {
+	if err := db.MarkSitePosted("https://example.com/post-0", "mastodon", time.Now(), time.Local); err != nil {
 		t.Fatalf("seed MarkSitePosted failed: %v", err)
 	}
 	db.CloseDB()
@@ -1319,3 +1399,132 @@ func TestRun_PostNewEntriesOnlyDisabled_PostsAllRegardlessOfPubDate(t *testing.T
 	assert.Equal(t, int32(1), atomic.LoadInt32(&mastodonCalls),
 		"When PostNewEntriesOnly is disabled, posts should not be filtered by pubDate")
 }
+
+func TestRun_MaxPostsPerCycleDefersSurplus(t *testing.T) {
+	dbFile := setupRunTestDB(t)
+
+	var mastodonCalls int32
+	rssURL, mastodonURL := shortRunTestServers(t, 10, &mastodonCalls)
+
+	conf := config.Config{
+		FeedURL:              rssURL,
+		Interval:             60,
+		ShortRun:             true,
+		PostNewEntriesOnly:   true,
+		MaxPostsPerCycle:     2,
+		DBPath:               dbFile,
+		MastodonURL:          mastodonURL,
+		MastodonClientKey:    "key",
+		MastodonClientSecret: "secret",
+		MastodonAccessToken:  "token",
+	}
+
+	Run(conf)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&mastodonCalls),
+		"first cycle should publish only MaxPostsPerCycle items")
+
+	Run(conf)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&mastodonCalls),
+		"second cycle should publish the item deferred by the first cycle")
+}
+
+func TestSortPostsChronologically(t *testing.T) {
+	posts := []rss.RSSItem{
+		{Link: "https://example.com/newest", PubDate: "Wed, 03 Jan 2024 10:00:00 +0000"},
+		{Link: "https://example.com/undated-1"},
+		{Link: "https://example.com/middle", PubDate: "Tue, 02 Jan 2024 10:00:00 +0000"},
+		{Link: "https://example.com/undated-2", PubDate: "not a date"},
+		{Link: "https://example.com/oldest", PubDate: "Mon, 01 Jan 2024 10:00:00 +0000"},
+	}
+
+	sortPostsChronologically(posts)
+
+	var links []string
+	for _, p := range posts {
+		links = append(links, path.Base(p.Link))
+	}
+	assert.Equal(t, []string{"oldest", "middle", "newest", "undated-1", "undated-2"}, links)
+}
+
+func TestRun_RetriesInFlightPostsFromPreviousRun(t *testing.T) {
+	dbFile := setupRunTestDB(t)
+
+	oldTime := time.Now().UTC().Add(-48 * time.Hour).Format("Mon, 02 Jan 2006 15:04:05 -0700")
+
+	// Simulate a previous run that stored the post but was stopped before
+	// it could publish to any site.
+	db.InitDB(dbFile)
+	if err := db.StoreTootedPost("https://example.com/in-flight", "in-flight content", "2025-01-01T00:00:00Z", time.Now(), db.DefaultContent, time.Local); err != nil {
+		t.Fatalf("seed StoreTootedPost failed: %v", err)
+	}
+	// A post it held back was handled, not left in flight.
+	if err := db.StoreTootedPost("https://example.com/held-back", "held-back content", "2025-01-01T00:00:00Z", time.Now(), db.DefaultContent, time.Local); err != nil {
+		t.Fatalf("seed StoreTootedPost failed: %v", err)
+	}
+	if err := db.RecordEvent(db.ActionHeldBack, "", "https://example.com/held-back", "link check", time.Now(), time.Local); err != nil {
+		t.Fatalf("seed RecordEvent failed: %v", err)
+	}
+	db.CloseDB()
+
+	var mastodonCalls int32
+	items := []rss.RSSItem{
+		{Title: "In Flight", Link: "https://example.com/in-flight", Content: "in-flight content", PubDate: oldTime},
+		{Title: "Held Back", Link: "https://example.com/held-back", Content: "held-back content", PubDate: oldTime},
+		{Title: "Old Post", Link: "https://example.com/old-post", Content: "old content", PubDate: oldTime},
+	}
+	rssURL, mastodonURL := pubDateTestServers(t, items, &mastodonCalls)
+
+	conf := config.Config{
+		FeedURL:              rssURL,
+		Interval:             60,
+		ShortRun:             true,
+		PostNewEntriesOnly:   true,
+		DBPath:               dbFile,
+		SocialSites:          []string{"mastodon"},
+		MastodonURL:          mastodonURL,
+		MastodonClientKey:    "key",
+		MastodonClientSecret: "secret",
+		MastodonAccessToken:  "token",
+	}
+
+	Run(conf)
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&mastodonCalls),
+		"in-flight post should be retried despite its old pubDate; handled and other old posts stay skipped")
+}
+
+func TestRun_RecordsFeedAnomalyMetrics(t *testing.T) {
+	dbFile := setupRunTestDB(t)
+	metrics.Default.Reset()
+	t.Cleanup(metrics.Default.Reset)
+
+	var mastodonCalls int32
+	// SHORT_RUN processes only three items, so keep the feed at three.
+	items := []rss.RSSItem{
+		{Title: "Go", Link: "https://example.com/go-post", Content: "posted"},
+		{Title: "No Link", Content: "malformed"},
+		{Title: "Thoughts on Go", Link: "https://example.com/thoughts-go", Content: "skip prefix"},
+	}
+	rssURL, mastodonURL := pubDateTestServers(t, items, &mastodonCalls)
+
+	conf := config.Config{
+		FeedURL:              rssURL,
+		Interval:             60,
+		ShortRun:             true,
+		SkipPrefixCategories: []string{"Thoughts"},
+		DBPath:               dbFile,
+		SocialSites:          []string{"mastodon"},
+		MastodonURL:          mastodonURL,
+		MastodonClientKey:    "key",
+		MastodonClientSecret: "secret",
+		MastodonAccessToken:  "token",
+	}
+
+	Run(conf)
+	Run(conf)
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&mastodonCalls))
+	assert.Equal(t, int64(2), metrics.Default.Get(metrics.MalformedItems))
+	assert.Equal(t, int64(2), metrics.Default.Get(metrics.FilteredSkipPrefix))
+	assert.Equal(t, int64(1), metrics.Default.Get(metrics.DuplicatesSuppressed))
+}
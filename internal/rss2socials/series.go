@@ -0,0 +1,84 @@
+package rss2socials
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/toozej/rss2socials/internal/rss"
+	"github.com/toozej/rss2socials/pkg/config"
+)
+
+// threadedSites are the sites that publish the parts of a series as
+// replies with Config.SeriesThreading.
+var threadedSites = []string{"mastodon", "bluesky"}
+
+// seriesPart returns the series of title and its part number in it by
+// Config.SeriesPattern, and reports whether title is part of a series. The
+// series is in lower case without surrounding punctuation, and empty when
+// the pattern does not name it.
+func seriesPart(conf *config.Config, title string) (string, int, bool) {
+	re, err := regexp.Compile(conf.SeriesPattern)
+	if err != nil {
+		return "", 0, false
+	}
+	m := re.FindStringSubmatch(title)
+	i := re.SubexpIndex("part")
+	if m == nil || i < 0 {
+		return "", 0, false
+	}
+	part, err := strconv.Atoi(m[i])
+	if err != nil {
+		return "", 0, false
+	}
+	var series string
+	if i := re.SubexpIndex("series"); i >= 0 {
+		series = strings.ToLower(strings.Join(strings.Fields(m[i]), " "))
+		series = strings.Trim(series, " ,:;([–—-")
+	}
+	return series, part, true
+}
+
+// seriesParents records post, which is stored, as part of its series with
+// Config.SeriesThreading, and returns the IDs of the posts of the previous
+// part by site, which post replies to. It needs a Store implementing
+// SeriesStore and PostIDStore.
+func (d Deps) seriesParents(conf *config.Config, post rss.RSSItem) map[string]string {
+	ss, ok := d.Store.(SeriesStore)
+	if !ok || !conf.SeriesThreading {
+		return nil
+	}
+	ids, ok := d.Store.(PostIDStore)
+	if !ok {
+		return nil
+	}
+	series, part, ok := seriesPart(conf, post.Title)
+	if !ok {
+		return nil
+	}
+	if err := ss.SetSeriesPart(post.Link, series, part); err != nil {
+		log.Errorf("Failed to store the series of %s: %v", post.Link, err)
+	}
+	previous, ok, err := ss.PreviousPart(series, part)
+	if err != nil {
+		log.Errorf("Failed to look up the previous part of %s: %v", post.Link, err)
+		return nil
+	}
+	if !ok {
+		return nil
+	}
+	parents := make(map[string]string)
+	for _, site := range threadedSites {
+		id, err := ids.SitePostID(previous, site)
+		if err != nil {
+			log.Errorf("Failed to look up the %s post of %s: %v", siteNames[site], previous, err)
+			continue
+		}
+		if id != "" {
+			parents[site] = id
+		}
+	}
+	return parents
+}
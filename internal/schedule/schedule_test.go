@@ -0,0 +1,67 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNext(t *testing.T) {
+	// Thursday.
+	at := time.Date(2026, 1, 1, 12, 7, 30, 0, time.UTC)
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2026, 1, 1, 12, 8, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2026, 1, 1, 12, 15, 0, 0, time.UTC)},
+		{"5/20 * * * *", time.Date(2026, 1, 1, 12, 25, 0, 0, time.UTC)},
+		{"0,30 9-17 * * *", time.Date(2026, 1, 1, 12, 30, 0, 0, time.UTC)},
+		{"*/15 8-20 * * MON-FRI", time.Date(2026, 1, 1, 12, 15, 0, 0, time.UTC)},
+		{"0 8 * * sat", time.Date(2026, 1, 3, 8, 0, 0, 0, time.UTC)},
+		{"0 8 * * 7", time.Date(2026, 1, 4, 8, 0, 0, 0, time.UTC)},
+		{"0 0 1 mar *", time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)},
+		// Either day field matches when both are restricted.
+		{"0 9 15 * MON", time.Date(2026, 1, 5, 9, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2026, 1, 1, 13, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC)},
+		{"0 0 30 2 *", time.Time{}},
+	}
+	for _, tt := range tests {
+		s, err := Parse(tt.expr)
+		require.NoError(t, err, tt.expr)
+		assert.Equal(t, tt.want, s.Next(at), tt.expr)
+	}
+}
+
+func TestNext_InLocation(t *testing.T) {
+	kolkata, err := time.LoadLocation("Asia/Kolkata")
+	require.NoError(t, err)
+	s, err := Parse("0 9 * * *")
+	require.NoError(t, err)
+
+	assert.Equal(t, time.Date(2026, 1, 2, 9, 0, 0, 0, kolkata), s.Next(time.Date(2026, 1, 1, 9, 30, 0, 0, kolkata)))
+}
+
+func TestParse_Invalid(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"10-5 * * * *",
+		"* * * * MON-FUN",
+		"@often",
+	} {
+		_, err := Parse(expr)
+		assert.Error(t, err, expr)
+	}
+}
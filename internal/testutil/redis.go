@@ -0,0 +1,431 @@
+package testutil
+
+import (
+	"bufio"
+	"cmp"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// RedisServer is an in-memory fake of the subset of Redis commands used by
+// internal/redisstore, speaking RESP2 over TCP.
+type RedisServer struct {
+	// URL is the redis:// URL of the server, including the password.
+	URL string
+
+	ln       net.Listener
+	password string
+
+	mu        sync.Mutex
+	conns     map[net.Conn]bool
+	dropReply map[string]bool
+	strings   map[string]string
+	hashes    map[string]map[string]string
+	sets      map[string]map[string]bool
+	zsets     map[string]map[string]float64
+	ints      map[string]int64
+	ttls      map[string]time.Duration
+	deadlines map[string]time.Time
+}
+
+// NewRedisServer starts a fake Redis server that requires password, unless
+// it is empty.
+func NewRedisServer(t testing.TB, password string) *RedisServer {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to start fake Redis server: %v", err)
+	}
+	s := &RedisServer{
+		URL:       "redis://" + ln.Addr().String(),
+		ln:        ln,
+		password:  password,
+		conns:     make(map[net.Conn]bool),
+		dropReply: make(map[string]bool),
+		strings:   make(map[string]string),
+		hashes:    make(map[string]map[string]string),
+		sets:      make(map[string]map[string]bool),
+		zsets:     make(map[string]map[string]float64),
+		ints:      make(map[string]int64),
+		ttls:      make(map[string]time.Duration),
+		deadlines: make(map[string]time.Time),
+	}
+	if password != "" {
+		s.URL = "redis://:" + password + "@" + ln.Addr().String()
+	}
+	go s.serve()
+	t.Cleanup(s.close)
+	return s
+}
+
+// TTL returns the expiry last set on key, or zero.
+func (s *RedisServer) TTL(key string) time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ttls[key]
+}
+
+// Hash returns a copy of the hash at key.
+func (s *RedisServer) Hash(key string) map[string]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make(map[string]string, len(s.hashes[key]))
+	for k, v := range s.hashes[key] {
+		out[k] = v
+	}
+	return out
+}
+
+// DropConnections closes every client connection, as a server restart or
+// network failure would.
+func (s *RedisServer) DropConnections() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for c := range s.conns {
+		c.Close()
+		delete(s.conns, c)
+	}
+}
+
+// DropReplyTo makes the server close the connection instead of replying the
+// next time it runs cmd, as a network failure after the command ran would.
+func (s *RedisServer) DropReplyTo(cmd string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dropReply[strings.ToUpper(cmd)] = true
+}
+
+func (s *RedisServer) close() {
+	s.ln.Close()
+	s.DropConnections()
+}
+
+func (s *RedisServer) serve() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.conns[conn] = true
+		s.mu.Unlock()
+		go s.handle(conn)
+	}
+}
+
+func (s *RedisServer) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	authed := s.password == ""
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(args[0])
+		var reply string
+		switch {
+		case cmd == "AUTH":
+			if args[len(args)-1] == s.password {
+				authed = true
+				reply = "+OK\r\n"
+			} else {
+				reply = "-WRONGPASS invalid username-password pair\r\n"
+			}
+		case !authed:
+			reply = "-NOAUTH Authentication required.\r\n"
+		default:
+			s.mu.Lock()
+			reply = s.exec(cmd, args[1:])
+			drop := s.dropReply[cmd]
+			delete(s.dropReply, cmd)
+			s.mu.Unlock()
+			if drop {
+				return
+			}
+		}
+		if _, err := io.WriteString(conn, reply); err != nil {
+			return
+		}
+	}
+}
+
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "*")))
+	if err != nil || n < 1 {
+		return nil, fmt.Errorf("malformed command %q", line)
+	}
+	args := make([]string, n)
+	for i := range args {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "$")))
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+	return args, nil
+}
+
+func bulk(s string) string { return fmt.Sprintf("$%d\r\n%s\r\n", len(s), s) }
+
+func array(items []string, present []bool) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(items))
+	for i, item := range items {
+		if present != nil && !present[i] {
+			b.WriteString("$-1\r\n")
+			continue
+		}
+		b.WriteString(bulk(item))
+	}
+	return b.String()
+}
+
+// expire deletes the keys whose TTL has passed.
+func (s *RedisServer) expire() {
+	for key, deadline := range s.deadlines {
+		if time.Now().Before(deadline) {
+			continue
+		}
+		delete(s.strings, key)
+		delete(s.hashes, key)
+		delete(s.sets, key)
+		delete(s.zsets, key)
+		delete(s.ints, key)
+		delete(s.deadlines, key)
+	}
+}
+
+// setTTL sets the TTL of key to ms milliseconds.
+func (s *RedisServer) setTTL(key, ms string) bool {
+	n, err := strconv.ParseInt(ms, 10, 64)
+	if err != nil {
+		return false
+	}
+	s.ttls[key] = time.Duration(n) * time.Millisecond
+	s.deadlines[key] = time.Now().Add(s.ttls[key])
+	return true
+}
+
+// storePost runs the script of redisstore.Store.StoreTootedPost.
+func (s *RedisServer) storePost(keys, argv []string) string {
+	if old := s.hashes[keys[0]]["content_hash"]; old != "" && old != argv[1] {
+		s.exec("HSET", []string{keys[0], "previous_content", s.hashes[keys[0]]["content"]})
+	}
+	s.exec("HSET", []string{keys[0], "link", argv[0], "content_hash", argv[1], "content", argv[2], "timestamp", argv[3], "startup_time", argv[4]})
+	s.exec("HSETNX", []string{keys[0], "first_seen", argv[5]})
+	return s.exec("SADD", []string{keys[1], argv[0]})
+}
+
+// exec runs a command with s.mu held and returns its encoded reply.
+func (s *RedisServer) exec(cmd string, args []string) string {
+	s.expire()
+	hash := func(key string) map[string]string {
+		if s.hashes[key] == nil {
+			s.hashes[key] = make(map[string]string)
+		}
+		return s.hashes[key]
+	}
+
+	switch cmd {
+	case "PING":
+		return "+PONG\r\n"
+	case "SELECT":
+		return "+OK\r\n"
+	case "HSET":
+		h, added := hash(args[0]), 0
+		for i := 1; i+1 < len(args); i += 2 {
+			if _, ok := h[args[i]]; !ok {
+				added++
+			}
+			h[args[i]] = args[i+1]
+		}
+		return fmt.Sprintf(":%d\r\n", added)
+	case "HSETNX":
+		h := hash(args[0])
+		if _, ok := h[args[1]]; ok {
+			return ":0\r\n"
+		}
+		h[args[1]] = args[2]
+		return ":1\r\n"
+	case "HGET":
+		v, ok := s.hashes[args[0]][args[1]]
+		if !ok {
+			return "$-1\r\n"
+		}
+		return bulk(v)
+	case "HMGET":
+		values, present := make([]string, len(args)-1), make([]bool, len(args)-1)
+		for i, field := range args[1:] {
+			values[i], present[i] = s.hashes[args[0]][field]
+		}
+		return array(values, present)
+	case "HDEL":
+		deleted := 0
+		for _, field := range args[1:] {
+			if _, ok := s.hashes[args[0]][field]; ok {
+				delete(s.hashes[args[0]], field)
+				deleted++
+			}
+		}
+		return fmt.Sprintf(":%d\r\n", deleted)
+	case "HVALS":
+		var values []string
+		for _, v := range s.hashes[args[0]] {
+			values = append(values, v)
+		}
+		return array(values, nil)
+	case "SET":
+		if _, exists := s.strings[args[0]]; exists && slices.Contains(args[2:], "NX") {
+			return "$-1\r\n"
+		}
+		s.strings[args[0]] = args[1]
+		delete(s.deadlines, args[0])
+		if i := slices.Index(args, "PX"); i > 0 && i+1 < len(args) && !s.setTTL(args[0], args[i+1]) {
+			return "-ERR value is not an integer\r\n"
+		}
+		return "+OK\r\n"
+	case "GET":
+		v, ok := s.strings[args[0]]
+		if !ok {
+			return "$-1\r\n"
+		}
+		return bulk(v)
+	case "EVAL":
+		// Only the scripts of internal/redisstore are supported, told apart
+		// by the fields and commands they use.
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n > len(args)-2 {
+			return "-ERR invalid number of keys\r\n"
+		}
+		keys, argv := args[2:2+n], args[2+n:]
+		if strings.Contains(args[0], "previous_content") {
+			return s.storePost(keys, argv)
+		}
+		if v, ok := s.strings[keys[0]]; !ok || v != argv[0] {
+			return ":0\r\n"
+		}
+		switch {
+		case strings.Contains(args[0], "pexpire") && len(argv) > 1:
+			s.setTTL(keys[0], argv[1])
+		case strings.Contains(args[0], "del"):
+			delete(s.strings, keys[0])
+			delete(s.deadlines, keys[0])
+		default:
+			return "-ERR unsupported script\r\n"
+		}
+		return ":1\r\n"
+	case "EXISTS":
+		_, str := s.strings[args[0]]
+		_, h := s.hashes[args[0]]
+		_, set := s.sets[args[0]]
+		_, z := s.zsets[args[0]]
+		if str || h || set || z {
+			return ":1\r\n"
+		}
+		return ":0\r\n"
+	case "SADD":
+		if s.sets[args[0]] == nil {
+			s.sets[args[0]] = make(map[string]bool)
+		}
+		added := 0
+		for _, m := range args[1:] {
+			if !s.sets[args[0]][m] {
+				s.sets[args[0]][m] = true
+				added++
+			}
+		}
+		return fmt.Sprintf(":%d\r\n", added)
+	case "SREM":
+		removed := 0
+		for _, m := range args[1:] {
+			if s.sets[args[0]][m] {
+				delete(s.sets[args[0]], m)
+				removed++
+			}
+		}
+		return fmt.Sprintf(":%d\r\n", removed)
+	case "SCARD":
+		return fmt.Sprintf(":%d\r\n", len(s.sets[args[0]]))
+	case "SMEMBERS":
+		var members []string
+		for m := range s.sets[args[0]] {
+			members = append(members, m)
+		}
+		return array(members, nil)
+	case "INCR":
+		s.ints[args[0]]++
+		return fmt.Sprintf(":%d\r\n", s.ints[args[0]])
+	case "ZADD":
+		if s.zsets[args[0]] == nil {
+			s.zsets[args[0]] = make(map[string]float64)
+		}
+		score, err := strconv.ParseFloat(args[1], 64)
+		if err != nil {
+			return "-ERR value is not a valid float\r\n"
+		}
+		_, exists := s.zsets[args[0]][args[2]]
+		s.zsets[args[0]][args[2]] = score
+		if exists {
+			return ":0\r\n"
+		}
+		return ":1\r\n"
+	case "ZRANGE":
+		// Only the whole set, "ZRANGE key 0 -1", is supported.
+		if args[1] != "0" || args[2] != "-1" {
+			return "-ERR unsupported range\r\n"
+		}
+		members := make([]string, 0, len(s.zsets[args[0]]))
+		for m := range s.zsets[args[0]] {
+			members = append(members, m)
+		}
+		z := s.zsets[args[0]]
+		slices.SortFunc(members, func(a, b string) int {
+			if c := cmp.Compare(z[a], z[b]); c != 0 {
+				return c
+			}
+			return strings.Compare(a, b)
+		})
+		return array(members, nil)
+	case "ZREMRANGEBYSCORE":
+		max, exclusive := args[2], strings.HasPrefix(args[2], "(")
+		limit, err := strconv.ParseFloat(strings.TrimPrefix(max, "("), 64)
+		if err != nil {
+			return "-ERR max is not a float\r\n"
+		}
+		removed := 0
+		for m, score := range s.zsets[args[0]] {
+			if score < limit || (!exclusive && score == limit) || math.IsInf(limit, 1) {
+				delete(s.zsets[args[0]], m)
+				removed++
+			}
+		}
+		return fmt.Sprintf(":%d\r\n", removed)
+	case "PEXPIRE":
+		if !s.setTTL(args[0], args[1]) {
+			return "-ERR value is not an integer\r\n"
+		}
+		return ":1\r\n"
+	}
+	return fmt.Sprintf("-ERR unknown command '%s'\r\n", cmd)
+}
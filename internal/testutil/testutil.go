@@ -0,0 +1,500 @@
+// Package testutil provides canned fake servers for the external services
+// rss2socials talks to (RSS feeds, Mastodon, Bluesky, Threads, Gotify and
+// Redis) together with RSS fixtures, so that the full pipeline can be
+// exercised in tests without real network access.
+//
+// Every HTTP server is an httptest.Server that records what it received.
+// All servers are closed automatically via t.Cleanup.
+package testutil
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/toozej/rss2socials/internal/rss"
+)
+
+// Items returns n distinct RSS items, newest first, with pubDates one hour
+// apart ending at base. Links have the form https://example.com/post-<i>.
+func Items(n int, base time.Time) []rss.RSSItem {
+	items := make([]rss.RSSItem, 0, n)
+	for i := 0; i < n; i++ {
+		items = append(items, rss.RSSItem{
+			Title:   fmt.Sprintf("Post %d", i),
+			Link:    fmt.Sprintf("https://example.com/post-%d", i),
+			Content: fmt.Sprintf("Content %d", i),
+			PubDate: base.Add(-time.Duration(i) * time.Hour).Format(time.RFC1123Z),
+		})
+	}
+	return items
+}
+
+// FeedServer serves an RSS feed whose items can be changed between requests.
+type FeedServer struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	items    []rss.RSSItem
+	status   int
+	requests int
+}
+
+// NewFeedServer starts an RSS feed server serving items.
+func NewFeedServer(t testing.TB, items ...rss.RSSItem) *FeedServer {
+	t.Helper()
+	f := &FeedServer{items: items, status: http.StatusOK}
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		f.requests++
+		status := f.status
+		feed := rss.RSSFeed{}
+		feed.Channel.Title = "Test Feed"
+		feed.Channel.Items = append([]rss.RSSItem(nil), f.items...)
+		f.mu.Unlock()
+
+		if status != http.StatusOK {
+			w.WriteHeader(status)
+			return
+		}
+		w.Header().Set("Content-Type", "application/rss+xml")
+		if err := xml.NewEncoder(w).Encode(feed); err != nil {
+			t.Logf("failed to encode rss feed: %v", err)
+		}
+	}))
+	t.Cleanup(f.Close)
+	return f
+}
+
+// SetItems replaces the items served by the feed.
+func (f *FeedServer) SetItems(items ...rss.RSSItem) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.items = items
+}
+
+// SetStatus makes the feed respond with the given HTTP status code.
+func (f *FeedServer) SetStatus(status int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.status = status
+}
+
+// Requests returns how many times the feed has been fetched.
+func (f *FeedServer) Requests() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.requests
+}
+
+// recorder collects the text of posts or messages received by a fake server
+// and can be told to fail.
+type recorder struct {
+	mu       sync.Mutex
+	received []string
+	fail     bool
+}
+
+func (r *recorder) record(s string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.received = append(r.received, s)
+}
+
+func (r *recorder) failing() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.fail
+}
+
+// Received returns everything recorded so far, in order.
+func (r *recorder) Received() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.received...)
+}
+
+// Count returns the number of recorded posts or messages.
+func (r *recorder) Count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.received)
+}
+
+// SetFail makes the server reject subsequent posts with a 500 error.
+func (r *recorder) SetFail(fail bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.fail = fail
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// MastodonServer is a fake Mastodon instance recording posted and edited
+// statuses.
+type MastodonServer struct {
+	*httptest.Server
+	recorder
+
+	mu     sync.Mutex
+	edited map[string]string
+}
+
+// Edited returns the latest text of each edited status, keyed by status ID.
+func (m *MastodonServer) Edited() map[string]string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	edited := make(map[string]string, len(m.edited))
+	for id, status := range m.edited {
+		edited[id] = status
+	}
+	return edited
+}
+
+// NewMastodonServer starts a fake Mastodon API server.
+func NewMastodonServer(t testing.TB) *MastodonServer {
+	t.Helper()
+	m := &MastodonServer{edited: make(map[string]string)}
+	m.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut && strings.HasPrefix(r.URL.Path, "/api/v1/statuses/") {
+			if m.failing() {
+				writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "fake mastodon failure"})
+				return
+			}
+			if err := r.ParseForm(); err != nil {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+				return
+			}
+			id := strings.TrimPrefix(r.URL.Path, "/api/v1/statuses/")
+			m.mu.Lock()
+			m.edited[id] = r.Form.Get("status")
+			m.mu.Unlock()
+			writeJSON(w, http.StatusOK, map[string]string{"id": id})
+			return
+		}
+		if r.Method == http.MethodPost && r.URL.Path == "/api/v1/statuses" {
+			if m.failing() {
+				writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "fake mastodon failure"})
+				return
+			}
+			if err := r.ParseForm(); err != nil {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+				return
+			}
+			m.record(r.Form.Get("status"))
+			writeJSON(w, http.StatusOK, map[string]string{"id": fmt.Sprintf("%d", m.Count())})
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	t.Cleanup(m.Close)
+	return m
+}
+
+// GotifyServer is a fake Gotify server recording notification messages.
+type GotifyServer struct {
+	*httptest.Server
+	recorder
+
+	mu       sync.Mutex
+	payloads []map[string]interface{}
+}
+
+// NewGotifyServer starts a fake Gotify server.
+func NewGotifyServer(t testing.TB) *GotifyServer {
+	t.Helper()
+	g := &GotifyServer{}
+	g.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/message" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if g.failing() {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		var payload map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		g.mu.Lock()
+		g.payloads = append(g.payloads, payload)
+		g.mu.Unlock()
+		title, _ := payload["title"].(string)
+		g.record(title)
+		writeJSON(w, http.StatusOK, map[string]int{"id": g.Count()})
+	}))
+	t.Cleanup(g.Close)
+	return g
+}
+
+// Payloads returns the decoded JSON bodies of all received messages.
+func (g *GotifyServer) Payloads() []map[string]interface{} {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return append([]map[string]interface{}(nil), g.payloads...)
+}
+
+// ThreadsUserID is the user ID reported by the fake Threads server.
+const ThreadsUserID = "1000"
+
+// ThreadsServer is a fake Threads Graph API server recording published text.
+// Point config.Config.ThreadsAPIURL at its URL.
+type ThreadsServer struct {
+	*httptest.Server
+	recorder
+
+	mu         sync.Mutex
+	containers map[string]threadsContainer
+	targets    []string
+}
+
+// threadsContainer is an unpublished Threads media container.
+type threadsContainer struct {
+	text string
+	// target describes the post replied to or quoted, e.g. "reply:p1".
+	target string
+}
+
+// Targets returns, for every published post in order, "reply:<id>" or
+// "quote:<id>" for replies and quote posts, or "" for standalone posts.
+func (s *ThreadsServer) Targets() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.targets...)
+}
+
+// NewThreadsServer starts a fake Threads Graph API server.
+func NewThreadsServer(t testing.TB) *ThreadsServer {
+	t.Helper()
+	s := &ThreadsServer{containers: make(map[string]threadsContainer)}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *ThreadsServer) handle(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+	switch {
+	case r.URL.Path == "/debug_token":
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"data": map[string]interface{}{
+				"is_valid":   true,
+				"user_id":    ThreadsUserID,
+				"issued_at":  now.Unix(),
+				"expires_at": now.Add(60 * 24 * time.Hour).Unix(),
+				"scopes":     []string{"threads_basic", "threads_content_publish"},
+			},
+		})
+	case r.Method == http.MethodPost && r.URL.Path == "/"+ThreadsUserID+"/threads":
+		if s.failing() {
+			writeJSON(w, http.StatusInternalServerError, map[string]interface{}{
+				"error": map[string]interface{}{"message": "fake threads failure", "code": 2},
+			})
+			return
+		}
+		values := formValues(r)
+		container := threadsContainer{text: values("text")}
+		if replyTo := values("reply_to_id"); replyTo != "" {
+			container.target = "reply:" + replyTo
+		} else if quoted := values("quote_post_id"); quoted != "" {
+			container.target = "quote:" + quoted
+		}
+		s.mu.Lock()
+		id := fmt.Sprintf("c%d", len(s.containers)+1)
+		s.containers[id] = container
+		s.mu.Unlock()
+		writeJSON(w, http.StatusOK, map[string]string{"id": id})
+	case r.Method == http.MethodPost && r.URL.Path == "/"+ThreadsUserID+"/threads_publish":
+		containerID := formValues(r)("creation_id")
+		s.mu.Lock()
+		container := s.containers[containerID]
+		s.targets = append(s.targets, container.target)
+		s.mu.Unlock()
+		s.record(container.text)
+		writeJSON(w, http.StatusOK, map[string]string{"id": "p" + strings.TrimPrefix(containerID, "c")})
+	case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/c"):
+		writeJSON(w, http.StatusOK, map[string]string{"id": strings.TrimPrefix(r.URL.Path, "/"), "status": "FINISHED"})
+	case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/p"):
+		id := strings.TrimPrefix(r.URL.Path, "/")
+		writeJSON(w, http.StatusOK, map[string]string{
+			"id":        id,
+			"permalink": "https://www.threads.net/post/" + id,
+			"timestamp": now.Format("2006-01-02T15:04:05-0700"),
+		})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// formValues reads the request body, either form-encoded or JSON, and
+// returns a function looking up its parameters.
+func formValues(r *http.Request) func(key string) string {
+	body, _ := io.ReadAll(r.Body)
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		var m map[string]interface{}
+		_ = json.Unmarshal(body, &m)
+		return func(key string) string {
+			v, _ := m[key].(string)
+			return v
+		}
+	}
+	values, _ := url.ParseQuery(string(body))
+	return func(key string) string {
+		if v := values.Get(key); v != "" {
+			return v
+		}
+		return r.URL.Query().Get(key)
+	}
+}
+
+// BlueskyDID is the DID reported by the fake Bluesky server.
+const BlueskyDID = "did:plc:rss2socialstest"
+
+// BlueskyServer is a fake Bluesky PDS recording created and deleted post
+// records. It also serves the DID document of BlueskyDID, as plc.directory
+// does. Because the Bluesky client library always talks to bsky.social, use
+// Route to direct that host and plc.directory at the fake server.
+type BlueskyServer struct {
+	*httptest.Server
+	recorder
+
+	mu      sync.Mutex
+	deleted []string
+}
+
+// Deleted returns the rkeys of the post records deleted so far.
+func (b *BlueskyServer) Deleted() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]string(nil), b.deleted...)
+}
+
+// NewBlueskyServer starts a fake Bluesky PDS.
+func NewBlueskyServer(t testing.TB) *BlueskyServer {
+	t.Helper()
+	b := &BlueskyServer{}
+	b.Server = httptest.NewServer(http.HandlerFunc(b.handle))
+	t.Cleanup(b.Close)
+	return b
+}
+
+// Route directs requests for bsky.social and plc.directory at b for the
+// duration of the test.
+func (b *BlueskyServer) Route(t testing.TB) {
+	t.Helper()
+	RouteHost(t, "bsky.social", b.URL)
+	RouteHost(t, "plc.directory", b.URL)
+}
+
+func (b *BlueskyServer) handle(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/" + BlueskyDID:
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"id":          BlueskyDID,
+			"alsoKnownAs": []string{"at://test.bsky.social"},
+			"service": []map[string]string{{
+				"id":              "#atproto_pds",
+				"type":            "AtprotoPersonalDataServer",
+				"serviceEndpoint": "https://fake.us-east.host.bsky.network",
+			}},
+		})
+	case "/xrpc/com.atproto.identity.resolveHandle":
+		writeJSON(w, http.StatusOK, map[string]string{"did": BlueskyDID})
+	case "/xrpc/com.atproto.server.createSession", "/xrpc/com.atproto.server.refreshSession":
+		writeJSON(w, http.StatusOK, map[string]string{
+			"accessJwt":  fakeJWT(2 * time.Hour),
+			"refreshJwt": fakeJWT(24 * time.Hour),
+			"handle":     "test.bsky.social",
+			"did":        BlueskyDID,
+		})
+	case "/xrpc/com.atproto.repo.createRecord":
+		if b.failing() {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "InternalServerError", "message": "fake bluesky failure"})
+			return
+		}
+		var input struct {
+			Record struct {
+				Text string `json:"text"`
+			} `json:"record"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "InvalidRequest", "message": err.Error()})
+			return
+		}
+		b.record(input.Record.Text)
+		rkey := fmt.Sprintf("3kfake%d", b.Count())
+		writeJSON(w, http.StatusOK, map[string]string{
+			"uri": "at://" + BlueskyDID + "/app.bsky.feed.post/" + rkey,
+			"cid": "bafyreifake" + rkey,
+		})
+	case "/xrpc/com.atproto.repo.deleteRecord":
+		var input struct {
+			Rkey string `json:"rkey"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "InvalidRequest", "message": err.Error()})
+			return
+		}
+		b.mu.Lock()
+		b.deleted = append(b.deleted, input.Rkey)
+		b.mu.Unlock()
+		writeJSON(w, http.StatusOK, map[string]string{})
+	default:
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "MethodNotImplemented"})
+	}
+}
+
+// fakeJWT returns an unsigned JWT whose exp claim is ttl from now. Clients
+// only inspect the expiry, so no signature is needed.
+func fakeJWT(ttl time.Duration) string {
+	enc := base64.RawURLEncoding
+	header := enc.EncodeToString([]byte(`{"alg":"none","typ":"JWT"}`))
+	payload := enc.EncodeToString([]byte(fmt.Sprintf(`{"sub":%q,"exp":%d}`, BlueskyDID, time.Now().Add(ttl).Unix())))
+	return header + "." + payload + "." + enc.EncodeToString([]byte("sig"))
+}
+
+// RouteHost redirects every request made through http.DefaultTransport for
+// host (e.g. "bsky.social") to target, for the duration of the test. It is
+// meant for client libraries that hardcode their API host.
+func RouteHost(t testing.TB, host string, target string) {
+	t.Helper()
+	targetURL, err := url.Parse(target)
+	if err != nil {
+		t.Fatalf("invalid route target %q: %v", target, err)
+	}
+	orig := http.DefaultTransport
+	http.DefaultTransport = &routingTransport{base: orig, host: host, target: targetURL}
+	t.Cleanup(func() { http.DefaultTransport = orig })
+}
+
+type routingTransport struct {
+	base   http.RoundTripper
+	host   string
+	target *url.URL
+}
+
+func (rt *routingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Hostname() != rt.host {
+		return rt.base.RoundTrip(req)
+	}
+	clone := req.Clone(req.Context())
+	clone.URL.Scheme = rt.target.Scheme
+	clone.URL.Host = rt.target.Host
+	clone.Host = rt.target.Host
+	return rt.base.RoundTrip(clone)
+}
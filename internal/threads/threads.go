@@ -2,7 +2,9 @@ package threads
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"time"
 
 	threadsgo "github.com/tirthpatell/threads-go"
 
@@ -19,6 +21,7 @@ func NewClient(conf config.Config) (*threadsgo.Client, error) {
 		ClientSecret: conf.ThreadsClientSecret,
 		RedirectURI:  conf.ThreadsRedirectURI,
 		Scopes:       []string{"threads_basic", "threads_content_publish"},
+		BaseURL:      conf.ThreadsAPIURL,
 	}
 
 	if conf.ThreadsToken != "" {
@@ -36,22 +39,90 @@ func NewClient(conf config.Config) (*threadsgo.Client, error) {
 	return client, nil
 }
 
-func Post(ctx context.Context, conf config.Config, content string) error {
-	if conf.ThreadsClientID == "" || conf.ThreadsClientSecret == "" {
-		return fmt.Errorf("threads client ID and client secret are required")
+// Account returns the username the access token belongs to, e.g. "@blog".
+func Account(ctx context.Context, conf config.Config) (string, error) {
+	client, err := NewClient(conf)
+	if err != nil {
+		return "", err
 	}
+	user, err := client.GetMe(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch threads account: %w", err)
+	}
+	return "@" + user.Username, nil
+}
 
+// CheckCredentials inspects the access token with the debug_token endpoint
+// and returns when it expires, or the zero time when it does not.
+func CheckCredentials(ctx context.Context, conf config.Config) (time.Time, error) {
 	client, err := NewClient(conf)
 	if err != nil {
-		return err
+		return time.Time{}, err
+	}
+	info, err := client.DebugToken(ctx, "")
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to check threads access token: %w", err)
+	}
+	if !info.Data.IsValid {
+		return time.Time{}, errors.New("threads access token is not valid")
 	}
+	if info.Data.ExpiresAt == 0 {
+		return time.Time{}, nil
+	}
+	return time.Unix(info.Data.ExpiresAt, 0), nil
+}
 
-	_, err = client.CreateTextPost(ctx, &threadsgo.TextPostContent{
+func Post(ctx context.Context, conf config.Config, content string) error {
+	_, err := Publish(ctx, conf, content)
+	return err
+}
+
+// Publish creates a Threads post and returns its media ID, which is needed to
+// reply to or quote the post later.
+func Publish(ctx context.Context, conf config.Config, content string) (string, error) {
+	return createPost(ctx, conf, &threadsgo.TextPostContent{
 		Text: content,
 	})
+}
+
+// Reply publishes content as a reply to the post with the given media ID.
+func Reply(ctx context.Context, conf config.Config, replyToID string, content string) error {
+	if replyToID == "" {
+		return fmt.Errorf("threads post ID to reply to is required")
+	}
+	_, err := createPost(ctx, conf, &threadsgo.TextPostContent{
+		Text:    content,
+		ReplyTo: replyToID,
+	})
+	return err
+}
+
+// Quote publishes content as a quote post of the post with the given media ID.
+func Quote(ctx context.Context, conf config.Config, quotedID string, content string) error {
+	if quotedID == "" {
+		return fmt.Errorf("threads post ID to quote is required")
+	}
+	_, err := createPost(ctx, conf, &threadsgo.TextPostContent{
+		Text:         content,
+		QuotedPostID: quotedID,
+	})
+	return err
+}
+
+func createPost(ctx context.Context, conf config.Config, content *threadsgo.TextPostContent) (string, error) {
+	if conf.ThreadsClientID == "" || conf.ThreadsClientSecret == "" {
+		return "", fmt.Errorf("threads client ID and client secret are required")
+	}
+
+	client, err := NewClient(conf)
+	if err != nil {
+		return "", err
+	}
+
+	post, err := client.CreateTextPost(ctx, content)
 	if err != nil {
-		return fmt.Errorf("failed to create threads post: %w", err)
+		return "", fmt.Errorf("failed to create threads post: %w", err)
 	}
 
-	return nil
+	return post.ID, nil
 }
@@ -2,10 +2,14 @@ package threads
 
 import (
 	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/toozej/rss2socials/pkg/config"
 )
 
@@ -116,3 +120,60 @@ func TestPost_Integration(t *testing.T) {
 		t.Log("Post timed out as expected for invalid credentials")
 	}
 }
+
+func TestReplyAndQuote_MissingPostID(t *testing.T) {
+	conf := config.Config{
+		ThreadsClientID:     "clientid123",
+		ThreadsClientSecret: "secret123",
+		ThreadsToken:        "token123",
+	}
+
+	err := Reply(context.Background(), conf, "", "Updated post")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "reply to is required")
+
+	err = Quote(context.Background(), conf, "", "Updated post")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "quote is required")
+}
+
+func TestCheckCredentials(t *testing.T) {
+	expires := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name        string
+		body        string
+		wantExpires time.Time
+		wantErr     string
+	}{
+		{name: "Expiring", body: fmt.Sprintf(`{"data":{"is_valid":true,"expires_at":%d}}`, expires.Unix()), wantExpires: expires},
+		{name: "Not expiring", body: `{"data":{"is_valid":true,"expires_at":0}}`},
+		{name: "Invalidated", body: `{"data":{"is_valid":false}}`, wantErr: "not valid"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Contains(t, r.URL.Path, "/debug_token")
+				assert.Equal(t, "test-token", r.URL.Query().Get("input_token"))
+				w.Header().Set("Content-Type", "application/json")
+				fmt.Fprint(w, tt.body)
+			}))
+			defer srv.Close()
+
+			conf := config.Config{
+				ThreadsClientID:     "test-client-id",
+				ThreadsClientSecret: "test-client-secret",
+				ThreadsRedirectURI:  "https://example.com/callback",
+				ThreadsToken:        "test-token",
+				ThreadsAPIURL:       srv.URL,
+			}
+			got, err := CheckCredentials(context.Background(), conf)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.True(t, tt.wantExpires.Equal(got), "got %s, want %s", got, tt.wantExpires)
+		})
+	}
+}
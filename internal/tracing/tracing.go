@@ -0,0 +1,216 @@
+// Package tracing provides verbose HTTP tracing for outbound requests.
+// When enabled, every request made through http.DefaultTransport is logged at
+// trace level with its method, URL, status, latency, rate-limit headers and a
+// truncated body, with credentials redacted.
+package tracing
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/toozej/rss2socials/internal/redact"
+)
+
+// DefaultMaxBodyBytes is the number of body bytes logged per request or response.
+const DefaultMaxBodyBytes = 1024
+
+const redacted = redact.Placeholder
+
+// sensitiveHeaders are header names whose values are never logged.
+var sensitiveHeaders = map[string]bool{
+	"Authorization":       true,
+	"Proxy-Authorization": true,
+	"Cookie":              true,
+	"Set-Cookie":          true,
+	"X-Gotify-Key":        true,
+	"Dpop":                true,
+}
+
+// sensitiveParams are query, form and JSON field names whose values are never logged.
+var sensitiveParams = []string{
+	"token",
+	"access_token",
+	"refresh_token",
+	"client_secret",
+	"code",
+	"code_verifier",
+	"password",
+	"accessJwt",
+	"refreshJwt",
+}
+
+var (
+	jsonSecretPattern = regexp.MustCompile(`"(` + strings.Join(sensitiveParams, "|") + `)"\s*:\s*"[^"]*"`)
+	formSecretPattern = regexp.MustCompile(`\b(` + strings.Join(sensitiveParams, "|") + `)=[^&\s]*`)
+)
+
+// Transport is an http.RoundTripper that logs request and response metadata
+// at trace level before delegating to Base.
+type Transport struct {
+	// Base is the underlying RoundTripper. http.DefaultTransport is used when nil.
+	Base http.RoundTripper
+	// MaxBodyBytes limits how much of each body is logged.
+	MaxBodyBytes int
+}
+
+// Enable wraps http.DefaultTransport with a tracing Transport so that all
+// HTTP clients relying on the default transport are traced.
+func Enable() {
+	if _, ok := http.DefaultTransport.(*Transport); ok {
+		return
+	}
+	http.DefaultTransport = &Transport{Base: http.DefaultTransport, MaxBodyBytes: DefaultMaxBodyBytes}
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	// Only log request bodies that can be replayed through GetBody so the
+	// request passed to Base is never consumed or modified.
+	var reqBody string
+	if req.GetBody != nil && req.Body != nil && req.Body != http.NoBody {
+		if rc, err := req.GetBody(); err == nil {
+			data, _ := io.ReadAll(io.LimitReader(rc, int64(t.maxBodyBytes())+1))
+			rc.Close()
+			reqBody = t.truncate(data)
+		}
+	}
+
+	fields := log.Fields{
+		"method":  req.Method,
+		"url":     RedactURL(req.URL),
+		"headers": redactHeaders(req.Header),
+	}
+	if reqBody != "" {
+		fields["body"] = RedactBody(reqBody)
+	}
+	log.WithFields(fields).Trace("HTTP request")
+
+	start := time.Now()
+	resp, err := base.RoundTrip(req)
+	latency := time.Since(start)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"method":  req.Method,
+			"url":     RedactURL(req.URL),
+			"latency": latency,
+		}).Tracef("HTTP request failed: %v", err)
+		return nil, err
+	}
+
+	respFields := log.Fields{
+		"method":  req.Method,
+		"url":     RedactURL(req.URL),
+		"status":  resp.StatusCode,
+		"latency": latency,
+	}
+	if rl := rateLimitHeaders(resp.Header); len(rl) > 0 {
+		respFields["rate_limit"] = rl
+	}
+	if resp.Body != nil {
+		// One byte more than is logged tells truncate the body is longer.
+		head, err := io.ReadAll(io.LimitReader(resp.Body, int64(t.maxBodyBytes())+1))
+		if err == nil {
+			resp.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.MultiReader(bytes.NewReader(head), resp.Body), resp.Body}
+			if len(head) > 0 {
+				respFields["body"] = RedactBody(t.truncate(head))
+			}
+		}
+	}
+	log.WithFields(respFields).Trace("HTTP response")
+
+	return resp, nil
+}
+
+func (t *Transport) maxBodyBytes() int {
+	if t.MaxBodyBytes <= 0 {
+		return DefaultMaxBodyBytes
+	}
+	return t.MaxBodyBytes
+}
+
+func (t *Transport) truncate(data []byte) string {
+	limit := t.maxBodyBytes()
+	if len(data) > limit {
+		return string(data[:limit]) + "...(truncated)"
+	}
+	return string(data)
+}
+
+// RedactURL returns the URL as a string with sensitive query parameters and
+// user info replaced by a placeholder.
+func RedactURL(u *url.URL) string {
+	if u == nil {
+		return ""
+	}
+	clean := *u
+	if clean.User != nil {
+		clean.User = url.User(redacted)
+	}
+	q := clean.Query()
+	changed := false
+	for key := range q {
+		if isSensitiveParam(key) {
+			q.Set(key, redacted)
+			changed = true
+		}
+	}
+	if changed {
+		clean.RawQuery = q.Encode()
+	}
+	return clean.String()
+}
+
+// RedactBody replaces registered secrets and the values of well-known
+// credential fields in JSON and form-encoded bodies with a placeholder.
+func RedactBody(body string) string {
+	body = redact.String(body)
+	body = jsonSecretPattern.ReplaceAllString(body, `"$1":"`+redacted+`"`)
+	return formSecretPattern.ReplaceAllString(body, "$1="+redacted)
+}
+
+func isSensitiveParam(name string) bool {
+	for _, p := range sensitiveParams {
+		if strings.EqualFold(name, p) {
+			return true
+		}
+	}
+	return false
+}
+
+func redactHeaders(h http.Header) map[string]string {
+	out := make(map[string]string, len(h))
+	for name, values := range h {
+		if sensitiveHeaders[http.CanonicalHeaderKey(name)] {
+			out[name] = redacted
+			continue
+		}
+		out[name] = strings.Join(values, ", ")
+	}
+	return out
+}
+
+func rateLimitHeaders(h http.Header) map[string]string {
+	out := make(map[string]string)
+	for name, values := range h {
+		lower := strings.ToLower(name)
+		if strings.Contains(lower, "ratelimit") || strings.Contains(lower, "rate-limit") || lower == "retry-after" {
+			out[name] = strings.Join(values, ", ")
+		}
+	}
+	return out
+}
@@ -0,0 +1,164 @@
+package transport
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Limits bound the outbound requests made through http.DefaultTransport,
+// which feeds, pages and every site share, so that a burst of new items
+// does not open dozens of connections at once and trip the abuse detection
+// of the providers. Zero fields set no bound.
+type Limits struct {
+	// MaxInFlight caps the requests in flight at once, from sending the
+	// request until its response body is read or closed.
+	MaxInFlight int
+	// PerMinute is the rate requests are sent at, on average. Up to Burst
+	// requests, at least one, are sent at once after a quiet spell.
+	PerMinute int
+	Burst     int
+}
+
+// Throttle wraps http.DefaultTransport so that its requests keep within l,
+// waiting for their turn unless their context ends first. Like Configure,
+// it must be called before http.DefaultTransport is wrapped by
+// tracing.Enable.
+func Throttle(l Limits) {
+	base := http.DefaultTransport
+	if t, ok := base.(*throttleTransport); ok {
+		base = t.base
+	}
+	if l.MaxInFlight <= 0 && l.PerMinute <= 0 {
+		http.DefaultTransport = base
+		return
+	}
+	t := &throttleTransport{base: base}
+	if l.MaxInFlight > 0 {
+		t.slots = make(chan struct{}, l.MaxInFlight)
+	}
+	if l.PerMinute > 0 {
+		t.bucket = newTokenBucket(l.PerMinute, l.Burst, time.Now)
+	}
+	http.DefaultTransport = t
+}
+
+// throttleTransport holds requests back until one of slots is free and
+// bucket has a token for them.
+type throttleTransport struct {
+	base   http.RoundTripper
+	slots  chan struct{}
+	bucket *tokenBucket
+}
+
+func (t *throttleTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	release := func() {}
+	if t.slots != nil {
+		select {
+		case t.slots <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		release = sync.OnceFunc(func() { <-t.slots })
+	}
+	if t.bucket != nil {
+		if err := t.bucket.wait(ctx); err != nil {
+			release()
+			return nil, err
+		}
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil || resp.Body == nil || t.slots == nil {
+		release()
+		return resp, err
+	}
+	resp.Body = &releasingBody{ReadCloser: resp.Body, release: release}
+	return resp, nil
+}
+
+// releasingBody is a response body that calls release once it is read to
+// the end, fails or is closed.
+type releasingBody struct {
+	io.ReadCloser
+	release func()
+}
+
+func (b *releasingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err != nil {
+		b.release()
+	}
+	return n, err
+}
+
+func (b *releasingBody) Close() error {
+	defer b.release()
+	return b.ReadCloser.Close()
+}
+
+// tokenBucket hands out perMinute tokens a minute, holding up to burst of
+// them. Tokens are reserved in the order they are asked for, so waiters
+// are served first come, first served.
+type tokenBucket struct {
+	mu       sync.Mutex
+	tokens   float64
+	burst    float64
+	interval time.Duration
+	last     time.Time
+	now      func() time.Time
+}
+
+func newTokenBucket(perMinute, burst int, now func() time.Time) *tokenBucket {
+	burst = max(burst, 1)
+	return &tokenBucket{
+		tokens:   float64(burst),
+		burst:    float64(burst),
+		interval: time.Minute / time.Duration(perMinute),
+		last:     now(),
+		now:      now,
+	}
+}
+
+// reserve takes a token and returns how long to wait until it is due.
+func (b *tokenBucket) reserve() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := b.now()
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens = min(b.burst, b.tokens+float64(elapsed)/float64(b.interval))
+		b.last = now
+	}
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens * float64(b.interval))
+}
+
+// cancel returns a token reserved but not used.
+func (b *tokenBucket) cancel() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens = min(b.burst, b.tokens+1)
+}
+
+// wait takes a token, waiting until it is due unless ctx ends first.
+func (b *tokenBucket) wait(ctx context.Context) error {
+	d := b.reserve()
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		b.cancel()
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,95 @@
+package transport
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenBucket(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	b := newTokenBucket(60, 2, func() time.Time { return now })
+
+	assert.Zero(t, b.reserve(), "the burst is available at once")
+	assert.Zero(t, b.reserve())
+	assert.Equal(t, time.Second, b.reserve())
+	assert.Equal(t, 2*time.Second, b.reserve(), "waiters queue up")
+
+	now = now.Add(time.Minute)
+	assert.Zero(t, b.reserve(), "the bucket refills up to the burst")
+	assert.Zero(t, b.reserve())
+	assert.Equal(t, time.Second, b.reserve())
+	b.cancel()
+	assert.Equal(t, time.Second, b.reserve(), "a cancelled token is given back")
+}
+
+func TestThrottle_MaxInFlight(t *testing.T) {
+	var inFlight, most atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			m := most.Load()
+			if n <= m || most.CompareAndSwap(m, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+	}))
+	defer srv.Close()
+	orig := http.DefaultTransport
+	t.Cleanup(func() { http.DefaultTransport = orig })
+
+	Throttle(Limits{MaxInFlight: 2})
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Go(func() {
+			resp, err := http.Get(srv.URL)
+			if assert.NoError(t, err) {
+				_, _ = io.Copy(io.Discard, resp.Body)
+				resp.Body.Close()
+			}
+		})
+	}
+	wg.Wait()
+	assert.Equal(t, int32(2), most.Load())
+
+	Throttle(Limits{})
+	assert.Same(t, orig, http.DefaultTransport, "zero limits remove the throttle")
+}
+
+func TestThrottle_WaitsForItsTurn(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	defer srv.Close()
+	client := &http.Client{Transport: &throttleTransport{
+		base:   http.DefaultTransport,
+		slots:  make(chan struct{}, 1),
+		bucket: newTokenBucket(1, 1, time.Now),
+	}}
+
+	resp, err := client.Get(srv.URL)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+	require.NoError(t, err)
+	_, err = client.Do(req)
+	require.ErrorIs(t, err, context.DeadlineExceeded, "the slot is held until the body is closed")
+
+	resp.Body.Close()
+	ctx, cancel = context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	req, err = http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+	require.NoError(t, err)
+	_, err = client.Do(req)
+	require.ErrorIs(t, err, context.DeadlineExceeded, "the next token is a minute away")
+}
@@ -0,0 +1,211 @@
+// Package transport configures how http.DefaultTransport, which every HTTP
+// client of rss2socials uses, makes outbound connections: forcing IPv4 on
+// hosts with broken IPv6, resolving host names through a custom DNS server
+// and bounding how long dialing and TLS handshakes may take, and which
+// User-Agent its requests identify themselves with.
+package transport
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/toozej/rss2socials/internal/httpbody"
+	"github.com/toozej/rss2socials/pkg/version"
+)
+
+// RepositoryURL is where the operators of the servers rss2socials talks to
+// can find out what it is.
+const RepositoryURL = "https://github.com/toozej/rss2socials"
+
+// DefaultUserAgent returns the User-Agent sent unless configured otherwise,
+// e.g. "rss2socials/v1.2.0 (+https://github.com/toozej/rss2socials)". Some
+// feed hosts block Go's default User-Agent, and API providers ask clients to
+// identify themselves.
+func DefaultUserAgent() string {
+	return fmt.Sprintf("rss2socials/%s (+%s)", version.Version, RepositoryURL)
+}
+
+// Options configure outbound connections. Zero fields keep the defaults of
+// http.DefaultTransport.
+type Options struct {
+	// ForceIPv4 only connects to, and resolves, IPv4 addresses.
+	ForceIPv4 bool
+	// Resolver is the host[:port] of the DNS server host names are resolved
+	// with, instead of the system resolver. The port defaults to 53.
+	Resolver string
+	// DialTimeout bounds establishing a connection, including resolving.
+	DialTimeout time.Duration
+	// TLSHandshakeTimeout bounds the TLS handshake.
+	TLSHandshakeTimeout time.Duration
+}
+
+// Configure replaces http.DefaultTransport with a copy that connects as
+// opts say. It must be called before http.DefaultTransport is wrapped, e.g.
+// by tracing.Enable.
+func Configure(opts Options) error {
+	if opts == (Options{}) {
+		return nil
+	}
+	base, ok := http.DefaultTransport.(*http.Transport)
+	if !ok {
+		return fmt.Errorf("http.DefaultTransport is a %T, not an *http.Transport", http.DefaultTransport)
+	}
+	dial, err := DialContext(opts)
+	if err != nil {
+		return err
+	}
+
+	t := base.Clone()
+	t.DialContext = dial
+	if opts.TLSHandshakeTimeout > 0 {
+		t.TLSHandshakeTimeout = opts.TLSHandshakeTimeout
+	}
+	http.DefaultTransport = t
+	return nil
+}
+
+// SetUserAgent wraps http.DefaultTransport so that requests without a
+// User-Agent header are sent with userAgent, or with DefaultUserAgent when it
+// is empty. Like Configure, it must be called before http.DefaultTransport is
+// wrapped by tracing.Enable.
+func SetUserAgent(userAgent string) {
+	if userAgent == "" {
+		userAgent = DefaultUserAgent()
+	}
+	base := http.DefaultTransport
+	if t, ok := base.(*userAgentTransport); ok {
+		base = t.base
+	}
+	http.DefaultTransport = &userAgentTransport{base: base, userAgent: userAgent}
+}
+
+// userAgentTransport sets the User-Agent of requests that have none.
+type userAgentTransport struct {
+	base      http.RoundTripper
+	userAgent string
+}
+
+func (t *userAgentTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Header.Get("User-Agent") == "" {
+		// A RoundTripper must not modify the request it was given.
+		req = req.Clone(req.Context())
+		req.Header.Set("User-Agent", t.userAgent)
+	}
+	return t.base.RoundTrip(req)
+}
+
+// MaxResponseSize caps the body of every response received through
+// http.DefaultTransport, well above the largest feed, page or image
+// rss2socials reads, so that API clients that read bodies without a limit,
+// such as those of the site libraries, cannot be made to exhaust memory.
+const MaxResponseSize = 64 << 20
+
+// LimitResponses wraps http.DefaultTransport so that reading more than
+// MaxResponseSize bytes of a response body fails with an
+// *httpbody.TooLargeError. Like Configure, it must be called before
+// http.DefaultTransport is wrapped by tracing.Enable.
+func LimitResponses() {
+	if _, ok := http.DefaultTransport.(*limitTransport); ok {
+		return
+	}
+	http.DefaultTransport = &limitTransport{base: http.DefaultTransport, limit: MaxResponseSize}
+}
+
+// limitTransport limits the bodies of responses to limit bytes.
+type limitTransport struct {
+	base  http.RoundTripper
+	limit int64
+}
+
+func (t *limitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil || resp.Body == nil {
+		return resp, err
+	}
+	resp.Body = &limitedBody{ReadCloser: resp.Body, left: t.limit, limit: t.limit}
+	return resp, nil
+}
+
+// limitedBody is a response body that fails once more than limit bytes
+// were read from it.
+type limitedBody struct {
+	io.ReadCloser
+	left, limit int64
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.left < 0 {
+		return 0, &httpbody.TooLargeError{Limit: b.limit}
+	}
+	// Read one byte more than is left, to tell a body of exactly limit
+	// bytes from a longer one.
+	if int64(len(p)) > b.left+1 {
+		p = p[:b.left+1]
+	}
+	n, err := b.ReadCloser.Read(p)
+	b.left -= int64(n)
+	if b.left < 0 {
+		return n + int(b.left), &httpbody.TooLargeError{Limit: b.limit}
+	}
+	return n, err
+}
+
+// DialContext returns a dial function for http.Transport that connects as
+// opts say.
+func DialContext(opts Options) (func(ctx context.Context, network, addr string) (net.Conn, error), error) {
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	if opts.DialTimeout > 0 {
+		dialer.Timeout = opts.DialTimeout
+	}
+
+	if opts.Resolver != "" {
+		server, err := resolverAddr(opts.Resolver)
+		if err != nil {
+			return nil, err
+		}
+		dnsDialer := &net.Dialer{Timeout: dialer.Timeout}
+		dialer.Resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				return dnsDialer.DialContext(ctx, network, server)
+			},
+		}
+	}
+
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if opts.ForceIPv4 {
+			network = ipv4Network(network)
+		}
+		return dialer.DialContext(ctx, network, addr)
+	}, nil
+}
+
+// resolverAddr returns the host:port of the DNS server resolver, adding the
+// default DNS port when it has none.
+func resolverAddr(resolver string) (string, error) {
+	host, port, err := net.SplitHostPort(resolver)
+	if err != nil {
+		host, port = strings.Trim(resolver, "[]"), "53"
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 || host == "" || strings.ContainsAny(host, "/ ") {
+		return "", fmt.Errorf("invalid DNS resolver %q, expected host[:port]", resolver)
+	}
+	return net.JoinHostPort(host, port), nil
+}
+
+// ipv4Network returns the IPv4-only variant of network.
+func ipv4Network(network string) string {
+	switch network {
+	case "tcp", "tcp6":
+		return "tcp4"
+	case "udp", "udp6":
+		return "udp4"
+	}
+	return network
+}
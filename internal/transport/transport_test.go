@@ -0,0 +1,168 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/toozej/rss2socials/internal/httpbody"
+)
+
+func TestResolverAddr(t *testing.T) {
+	tests := []struct {
+		in, want string
+		wantErr  bool
+	}{
+		{in: "1.1.1.1", want: "1.1.1.1:53"},
+		{in: "1.1.1.1:5353", want: "1.1.1.1:5353"},
+		{in: "2606:4700:4700::1111", want: "[2606:4700:4700::1111]:53"},
+		{in: "[2606:4700:4700::1111]:53", want: "[2606:4700:4700::1111]:53"},
+		{in: "dns.example", want: "dns.example:53"},
+		{in: ":53", wantErr: true},
+		{in: "https://dns.example/", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := resolverAddr(tt.in)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestSetUserAgent(t *testing.T) {
+	var got []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = append(got, r.UserAgent())
+	}))
+	defer srv.Close()
+	orig := http.DefaultTransport
+	t.Cleanup(func() { http.DefaultTransport = orig })
+
+	get := func(userAgent string) {
+		req, err := http.NewRequest(http.MethodGet, srv.URL, nil)
+		require.NoError(t, err)
+		if userAgent != "" {
+			req.Header.Set("User-Agent", userAgent)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+
+	SetUserAgent("")
+	get("")
+	SetUserAgent("my-bot/1.0")
+	get("")
+	get("explicit/2.0")
+
+	require.Len(t, got, 3)
+	assert.Regexp(t, `^rss2socials/\S+ \(\+https://github.com/toozej/rss2socials\)$`, got[0])
+	assert.Equal(t, "my-bot/1.0", got[1], "setting it again replaces the User-Agent")
+	assert.Equal(t, "explicit/2.0", got[2], "a User-Agent set by the caller is kept")
+}
+
+func TestLimitTransport(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, strings.Repeat("a", len(r.URL.Path)-1))
+	}))
+	defer srv.Close()
+	client := &http.Client{Transport: &limitTransport{base: http.DefaultTransport, limit: 5}}
+
+	get := func(path string) ([]byte, error) {
+		resp, err := client.Get(srv.URL + path)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		return io.ReadAll(resp.Body)
+	}
+
+	body, err := get("/12345")
+	require.NoError(t, err)
+	assert.Equal(t, "aaaaa", string(body))
+
+	body, err = get("/123456")
+	var tooLarge *httpbody.TooLargeError
+	require.ErrorAs(t, err, &tooLarge)
+	assert.Equal(t, "aaaaa", string(body), "only the limit is read")
+}
+
+func TestDialContext_ForceIPv4(t *testing.T) {
+	ln, err := net.Listen("tcp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+
+	dial, err := DialContext(Options{ForceIPv4: true})
+	require.NoError(t, err)
+
+	conn, err := dial(context.Background(), "tcp", ln.Addr().String())
+	require.NoError(t, err)
+	conn.Close()
+
+	_, err = dial(context.Background(), "tcp", "[::1]:1")
+	assert.ErrorContains(t, err, "no suitable address", "IPv6 addresses are not dialed")
+}
+
+func TestDialContext_Resolver(t *testing.T) {
+	// A DNS server that never answers records that it was queried.
+	pc, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer pc.Close()
+	queried := make(chan struct{}, 1)
+	go func() {
+		buf := make([]byte, 512)
+		if _, _, err := pc.ReadFrom(buf); err == nil {
+			queried <- struct{}{}
+		}
+	}()
+
+	dial, err := DialContext(Options{Resolver: pc.LocalAddr().String(), DialTimeout: 500 * time.Millisecond})
+	require.NoError(t, err)
+
+	_, err = dial(context.Background(), "tcp", "rss2socials.test:80")
+	var dnsErr *net.DNSError
+	require.True(t, errors.As(err, &dnsErr), "got %v", err)
+	select {
+	case <-queried:
+	case <-time.After(time.Second):
+		t.Fatal("the configured resolver was not queried")
+	}
+
+	_, err = DialContext(Options{Resolver: "https://dns.example/"})
+	assert.Error(t, err)
+}
+
+func TestConfigure(t *testing.T) {
+	orig := http.DefaultTransport
+	t.Cleanup(func() { http.DefaultTransport = orig })
+
+	require.NoError(t, Configure(Options{}))
+	assert.Same(t, orig, http.DefaultTransport, "zero options keep the default transport")
+
+	require.NoError(t, Configure(Options{ForceIPv4: true, TLSHandshakeTimeout: 3 * time.Second}))
+	tr, ok := http.DefaultTransport.(*http.Transport)
+	require.True(t, ok)
+	assert.NotSame(t, orig, tr)
+	assert.Equal(t, 3*time.Second, tr.TLSHandshakeTimeout)
+	assert.NotNil(t, tr.DialContext)
+
+	http.DefaultTransport = roundTripperFunc(func(*http.Request) (*http.Response, error) { return nil, nil })
+	assert.Error(t, Configure(Options{ForceIPv4: true}), "a wrapped transport cannot be configured")
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
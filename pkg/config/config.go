@@ -29,13 +29,24 @@
 package config
 
 import (
+	"errors"
 	"fmt"
+	"maps"
+	"net/url"
 	"os"
 	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
+	"unicode/utf8"
 
 	"github.com/caarlos0/env/v11"
 	"github.com/joho/godotenv"
+
+	"github.com/toozej/rss2socials/internal/rss"
+	"github.com/toozej/rss2socials/internal/schedule"
 )
 
 // Config represents the application configuration structure.
@@ -61,35 +72,304 @@ type Config struct {
 	MastodonClientSecret string `env:"MASTODON_CLIENT_SECRET"`
 	// MastodonAccessToken is the access token for Mastodon API.
 	MastodonAccessToken string `env:"MASTODON_ACCESS_TOKEN"`
+	// MastodonEditUpdates edits the original toot of an updated post in
+	// place instead of posting a new "Updated post" status.
+	MastodonEditUpdates bool `env:"MASTODON_EDIT_UPDATES"`
+	// MastodonPinLatest pins the status of every new post to the profile
+	// and unpins the status pinned for the post before, so that the profile
+	// features the latest article. Statuses pinned by hand are left alone.
+	MastodonPinLatest bool `env:"MASTODON_PIN_LATEST"`
+	// MastodonFlavor is the server software behind MastodonURL: "mastodon"
+	// (default), "gotosocial", "akkoma" or "pixelfed". It selects the status
+	// length limit and the API features used, and is checked against the
+	// instance at startup.
+	MastodonFlavor string `env:"MASTODON_FLAVOR" envDefault:"mastodon"`
+	// MastodonMaxChars overrides the status length limit. Zero uses the
+	// limit the instance reports at startup, or else the flavor's default.
+	MastodonMaxChars int `env:"MASTODON_MAX_CHARS"`
 
 	// GotifyURL is the URL of the Gotify instance.
 	GotifyURL string `env:"GOTIFY_URL"`
 
 	// GotifyToken is the token for Gotify notifications.
 	GotifyToken string `env:"GOTIFY_TOKEN"`
+	// GotifyPriority is the priority of Gotify notifications (default 5).
+	GotifyPriority int `env:"GOTIFY_PRIORITY" envDefault:"5"`
 	// GotifyNotifyOnSuccess enables Gotify notifications for successful posts.
 	GotifyNotifyOnSuccess bool `env:"GOTIFY_NOTIFY_ON_SUCCESS"`
+	// GotifyTokens maps event types, severities or "*" to the token of the
+	// Gotify application their notifications are sent to, e.g.
+	// "error=token1,info=token2", like NotifyRoutes. Other events use
+	// GotifyToken.
+	GotifyTokens map[string]string `env:"GOTIFY_TOKENS" envSeparator:"," envKeyValSeparator:"="`
+	// GotifyPriorities maps event types, severities or "*" to the priority of
+	// their Gotify notifications, e.g. "post_failure=8,info=2". A priority
+	// in NotifyRoutes takes precedence; other events use GotifyPriority.
+	GotifyPriorities map[string]int `env:"GOTIFY_PRIORITIES" envSeparator:"," envKeyValSeparator:"="`
+
+	// NotifyRoutes maps event types (post_failure, post_success,
+	// token_expiry, error), severities (info, warning, error) or "*" to
+	// notification channels (gotify, ntfy, email, slack, mattermost), e.g. "post_failure=gotify:8,post_success=ntfy:low".
+	// Multiple channels are separated by "|". When empty, failures go to
+	// Gotify and successes go to Gotify if GotifyNotifyOnSuccess is set.
+	NotifyRoutes map[string]string `env:"NOTIFY_ROUTES" envSeparator:"," envKeyValSeparator:"=" envDefault:""`
+
+	// NtfyURL is the full ntfy topic URL (e.g. https://ntfy.sh/my-topic).
+	NtfyURL string `env:"NTFY_URL"`
+	// NtfyToken is an optional ntfy access token.
+	NtfyToken string `env:"NTFY_TOKEN"`
+
+	// SlackWebhookURL is the URL of a Slack incoming webhook.
+	SlackWebhookURL string `env:"SLACK_WEBHOOK_URL"`
+	// MattermostWebhookURL is the URL of a Mattermost incoming webhook.
+	MattermostWebhookURL string `env:"MATTERMOST_WEBHOOK_URL"`
+
+	// SMTP configuration for email notifications.
+	SMTPHost     string `env:"SMTP_HOST"`
+	SMTPPort     int    `env:"SMTP_PORT" envDefault:"587"`
+	SMTPUsername string `env:"SMTP_USERNAME"`
+	SMTPPassword string `env:"SMTP_PASSWORD"`
+	SMTPFrom     string `env:"SMTP_FROM"`
+	// NotifyEmailTo is the list of recipients for email notifications.
+	NotifyEmailTo []string `env:"NOTIFY_EMAIL_TO" envSeparator:","`
+
+	// NewsletterProvider announces new posts to an email list as well, as
+	// the "newsletter" site: "smtp" mails them to NewsletterEmailTo through
+	// the SMTP server above, "listmonk" and "buttondown" create and send a
+	// campaign through the API of that service. Empty (default) sends no
+	// newsletter. Updates of posts are not emailed.
+	NewsletterProvider string `env:"NEWSLETTER_PROVIDER"`
+	// NewsletterEmailTo are the recipients of the newsletter with
+	// NewsletterProvider smtp, typically the address of a mailing list.
+	NewsletterEmailTo []string `env:"NEWSLETTER_EMAIL_TO" envSeparator:","`
+	// NewsletterSubjectTemplate is the Go text/template of the email
+	// subject, executed with the fields of the post templates.
+	NewsletterSubjectTemplate string `env:"NEWSLETTER_SUBJECT_TEMPLATE" envDefault:"{{.Title}}"`
+	// NewsletterTemplate is the Go html/template of the email body, executed
+	// with the fields of the post templates, where .Content is the HTML of
+	// the item, and .Post, the text posted to the social sites. Defaults to
+	// the linked title followed by the content.
+	NewsletterTemplate string `env:"NEWSLETTER_TEMPLATE" envDefault:""`
+	// ListmonkURL is the URL of the Listmonk instance, and ListmonkUsername
+	// and ListmonkToken are the API user and its token.
+	ListmonkURL      string `env:"LISTMONK_URL"`
+	ListmonkUsername string `env:"LISTMONK_USERNAME"`
+	ListmonkToken    string `env:"LISTMONK_TOKEN"`
+	// ListmonkListIDs are the IDs of the Listmonk lists campaigns are sent
+	// to.
+	ListmonkListIDs []int `env:"LISTMONK_LIST_IDS" envSeparator:","`
+	// ButtondownAPIKey is the API key of the Buttondown newsletter.
+	ButtondownAPIKey string `env:"BUTTONDOWN_API_KEY"`
+	// ButtondownAPIURL overrides the Buttondown API base URL, for testing
+	// or proxies. Defaults to https://api.buttondown.com when empty.
+	ButtondownAPIURL string `env:"BUTTONDOWN_API_URL"`
 
 	// Debug enables debug-level logging.
 	Debug bool `env:"DEBUG"`
+	// LogLevel is the least severe level logged: "trace", "debug", "info"
+	// (default), "warn" or "error". Debug lowers it to "debug".
+	LogLevel string `env:"LOG_LEVEL" envDefault:"info"`
+	// LogFormat is "text" (default) for human-readable logs on standard
+	// error, or "json" for one JSON object per line on standard output, for
+	// log collectors. It defaults to "json" in a container.
+	LogFormat string `env:"LOG_FORMAT" envDefault:"text"`
+	// LogFile is a file logs are written to in addition to the console. It
+	// is rotated once it exceeds LogFileMaxSizeMB megabytes (0 = never),
+	// keeping LogFileMaxBackups rotated files.
+	LogFile           string `env:"LOG_FILE"`
+	LogFileMaxSizeMB  int    `env:"LOG_FILE_MAX_SIZE_MB" envDefault:"10"`
+	LogFileMaxBackups int    `env:"LOG_FILE_MAX_BACKUPS" envDefault:"5"`
+	// EmitEvents writes an event per line as JSON to standard output, e.g.
+	// {"event":"published","site":"mastodon","link":"..."}, for composing
+	// rss2socials in pipelines. Logs then always go to standard error.
+	EmitEvents bool `env:"EMIT_EVENTS"`
+	// GitHubActions annotates the workflow run with an error for every
+	// failure and a notice for every publish, and appends a table of them
+	// to the job summary, for running rss2socials as a scheduled workflow.
+	GitHubActions bool `env:"GITHUB_ACTIONS_MODE"`
+	// MetricsAddr is the address, e.g. ":9090", to serve Prometheus
+	// metrics on at /metrics. Metrics are not served when it is empty.
+	MetricsAddr string `env:"METRICS_ADDR"`
+	// SentryDSN is the DSN of a Sentry project, e.g.
+	// "https://key@o1.ingest.sentry.io/42", to report panics and repeated
+	// publish failures to. Nothing is reported when it is empty.
+	SentryDSN string `env:"SENTRY_DSN"`
+	// SentryEnvironment tags reported errors, e.g. "production".
+	SentryEnvironment string `env:"SENTRY_ENVIRONMENT"`
+	// SentryFailureThreshold is the number of times in a row publishing a
+	// post to a network must fail before its failures are reported; 0 and 1
+	// report every failure.
+	SentryFailureThreshold int `env:"SENTRY_FAILURE_THRESHOLD" envDefault:"3"`
+
+	// Tenants are the names of the tenants one instance runs for, each with
+	// its own feed, credentials, database and notification routing, set by
+	// the variables prefixed with its upper-cased name and an underscore,
+	// e.g. ALICE_FEED_URL. Variables without a prefix are shared by every
+	// tenant. Each tenant runs in a process of its own.
+	Tenants []string `env:"TENANTS" envSeparator:","`
+	// Tenant is the tenant this process runs for; see TenantEnv.
+	Tenant string `env:"RSS2SOCIALS_TENANT"`
+
+	// SecretStore is where credentials are kept: "env" (default) in the
+	// environment or .env file, or "keyring" in the OS keyring, from which
+	// the SecretVars that are not set in the environment are read.
+	SecretStore string `env:"SECRET_STORE" envDefault:"env"`
 
-	// FeedURL is the RSS feed URL to watch.
+	// FeedURL is the RSS feed URL to watch. A file:// URL reads a local
+	// file and "-" reads the feed from standard input. The placeholders
+	// {{year}}, {{month}} and {{day}} are replaced with the date of every
+	// check, in Timezone.
 	FeedURL string `env:"FEED_URL"`
 
+	// RecordFeedDir, when set, is the directory every fetched feed document
+	// is saved to, named after the time it was fetched, so that a cycle can
+	// be replayed later with a file:// FeedURL.
+	RecordFeedDir string `env:"RECORD_FEED_DIR"`
+
 	// Interval is the check interval in minutes.
 	Interval int `env:"INTERVAL" envDefault:"60"`
+	// CheckSchedule is a cron expression the feed is checked on instead of
+	// every Interval minutes, e.g. "*/15 8-20 * * MON-FRI", evaluated in
+	// Timezone.
+	CheckSchedule string `env:"CHECK_SCHEDULE"`
+	// FeedMinIntervalSeconds is the minimum time between two fetches from
+	// the feed's host, however often the feed is checked. 0 disables it; a
+	// Retry-After sent by the server is honored either way.
+	FeedMinIntervalSeconds int `env:"FEED_MIN_INTERVAL_SECONDS" envDefault:"60"`
+	// FeedMaxRedirects is how many redirects a feed fetch follows; 0
+	// follows none. Redirects from https to http are refused unless
+	// FeedAllowHTTPDowngrade is set, and redirects to another host when
+	// FeedPinHost is set.
+	FeedMaxRedirects       int  `env:"FEED_MAX_REDIRECTS" envDefault:"10"`
+	FeedAllowHTTPDowngrade bool `env:"FEED_ALLOW_HTTP_DOWNGRADE"`
+	FeedPinHost            bool `env:"FEED_PIN_HOST"`
 
-	// Category is the URL category filter (optional).
+	// Category is the category filter (optional). Only items in this
+	// category are published; see CategoryFilterMode.
 	Category string `env:"CATEGORY"`
+	// CategoryFilterMode selects what Category is matched against:
+	// "url-segment" (default) matches it as a substring of the last path
+	// segment of the item link, "rss-category" against the item's
+	// <category> elements (case-insensitive), and "both" accepts items
+	// matching either.
+	CategoryFilterMode string `env:"CATEGORY_FILTER_MODE" envDefault:"url-segment"`
 
 	// SkipPrefixCategories is a list of categories that use the "Content - Link" format
 	// instead of the default "New blog post: Link" format.
 	SkipPrefixCategories []string `env:"SKIP_PREFIX_CATEGORIES" envSeparator:"," envDefault:"Thoughts"`
 
+	// ExtensionFilters only publishes items whose namespaced elements
+	// match, by element and the text its value must contain ignoring case,
+	// e.g. "itunes:episodeType=full,media:rating=nonadult". An empty text
+	// only requires the element to be present.
+	ExtensionFilters map[string]string `env:"EXTENSION_FILTERS" envSeparator:"," envKeyValSeparator:"="`
+
+	// SensitiveLabels marks items as sensitive by their categories or
+	// media:rating values, ignoring case, mapping each to the Bluesky
+	// self-label of their posts (one of BlueskySelfLabels), or to nothing.
+	// Sensitive Mastodon posts are marked sensitive behind a content
+	// warning.
+	SensitiveLabels map[string]string `env:"SENSITIVE_LABELS" envSeparator:"," envKeyValSeparator:"=" envDefault:"nsfw=sexual,adult=sexual"`
+
+	// LinkDomainAllowlist only publishes items linking to these domains or
+	// their subdomains, and LinkDomainDenylist never publishes items linking
+	// to them, e.g. partner content of aggregated feeds. The denylist wins.
+	LinkDomainAllowlist []string `env:"LINK_DOMAIN_ALLOWLIST" envSeparator:","`
+	LinkDomainDenylist  []string `env:"LINK_DOMAIN_DENYLIST" envSeparator:","`
+
+	// PostTemplate is the Go text/template used for the text of new posts,
+	// e.g. "{{.Title}}: {{.Content | stripHTML | ellipsis 200}} {{.Link}}".
+	// Defaults to `{{msg "new_post"}} {{.Link}}`, "New post: Link" in English,
+	// when empty.
+	PostTemplate string `env:"POST_TEMPLATE" envDefault:""`
+	// UpdateTemplate is the template used for posts announcing an updated
+	// item. Defaults to `{{msg "updated_post"}} {{.Link}}` when empty.
+	UpdateTemplate string `env:"UPDATE_TEMPLATE" envDefault:""`
+	// TemplateVariants are alternative templates for new posts, to compare
+	// phrasing styles; see Variants for their syntax. They are separated by
+	// ";;", as templates may contain "|" and ",".
+	TemplateVariants []string `env:"TEMPLATE_VARIANTS" envSeparator:";;" envDefault:""`
+	// TemplateVariantSelection is how the variant of a post is picked:
+	// "hash" (default) picks the same variant for a link every time,
+	// "random" picks one at random. Both follow the variants' weights.
+	TemplateVariantSelection string `env:"TEMPLATE_VARIANT_SELECTION" envDefault:"hash"`
+
+	// FooterLines are occasional lines, e.g. a support link or a newsletter
+	// plug, appended to every FooterEvery-th new post, taking turns.
+	// Lines are separated by "|".
+	FooterLines []string `env:"FOOTER_LINES" envSeparator:"|"`
+	// FooterEvery is how many new posts apart footer lines are appended.
+	// Zero disables footers.
+	FooterEvery int `env:"FOOTER_EVERY" envDefault:"5"`
+	// MastodonFooterLines, BlueskyFooterLines and ThreadsFooterLines
+	// replace FooterLines on that network; "none" appends no footer there.
+	MastodonFooterLines []string `env:"MASTODON_FOOTER_LINES" envSeparator:"|"`
+	BlueskyFooterLines  []string `env:"BLUESKY_FOOTER_LINES" envSeparator:"|"`
+	ThreadsFooterLines  []string `env:"THREADS_FOOTER_LINES" envSeparator:"|"`
+
+	// PreviousPost links new posts to the latest earlier post in one of
+	// their categories: "link" appends a "Previously:" line with its link,
+	// "quote" quotes its Bluesky post on Bluesky and appends the line on the
+	// other networks. Empty disables it.
+	PreviousPost string `env:"PREVIOUS_POST"`
+
+	// SeriesThreading publishes the parts of a series as replies to the
+	// Mastodon status and Bluesky post of the previous part, building a
+	// thread across the series. SeriesPattern recognizes the parts by their
+	// title: a regular expression whose "part" group is the part number and
+	// whose optional "series" group names the series.
+	SeriesThreading bool   `env:"SERIES_THREADING"`
+	SeriesPattern   string `env:"SERIES_PATTERN" envDefault:"(?i)^(?P<series>.*?)[\\s,:(\\[–—-]*\\bpart\\s+(?P<part>\\d+)\\b"`
+
+	// Blocklist holds back posts from every network when their text
+	// matches one of its entries; see SiteBlocklist for their syntax.
+	// Entries are separated by "|".
+	Blocklist []string `env:"BLOCKLIST" envSeparator:"|"`
+	// MastodonBlocklist, BlueskyBlocklist, ThreadsBlocklist and
+	// NewsletterBlocklist add entries to Blocklist on that network.
+	MastodonBlocklist   []string `env:"MASTODON_BLOCKLIST" envSeparator:"|"`
+	BlueskyBlocklist    []string `env:"BLUESKY_BLOCKLIST" envSeparator:"|"`
+	ThreadsBlocklist    []string `env:"THREADS_BLOCKLIST" envSeparator:"|"`
+	NewsletterBlocklist []string `env:"NEWSLETTER_BLOCKLIST" envSeparator:"|"`
+
+	// ContentSources are the item fields that post templates see as
+	// .Content, tried in order until one is not empty: "description",
+	// "content:encoded", "title", "page", the description meta tag of the
+	// article page, or "article", the main text extracted from it.
+	ContentSources []string `env:"CONTENT_SOURCES" envSeparator:"," envDefault:"description"`
+	// ContentMinChars skips content sources with less text than this, e.g.
+	// one-line summaries, unless no source is long enough.
+	ContentMinChars int `env:"CONTENT_MIN_CHARS"`
+
+	// Locale selects the language of the phrases in posts, such as the
+	// "New post:" prefix of the default templates, e.g. "de" or "fr_FR".
+	// Defaults to English.
+	Locale string `env:"LOCALE" envDefault:""`
+	// Messages overrides phrases of the locale's message catalog, e.g.
+	// "new_post=Fresh from the blog:".
+	Messages map[string]string `env:"MESSAGES" envSeparator:"," envKeyValSeparator:"=" envDefault:""`
+
 	// Bluesky configuration
 	BlueskyHandle string `env:"BLUESKY_HANDLE"`
 	BlueskyAppKey string `env:"BLUESKY_APPKEY"`
 	BlueskyPDS    string `env:"BLUESKY_PDS"`
+	// BlueskyAuth selects how rss2socials logs in to Bluesky: "app-password"
+	// (default) with BlueskyAppKey, or "oauth" with the session created by
+	// "rss2socials bluesky login".
+	BlueskyAuth string `env:"BLUESKY_AUTH" envDefault:"app-password"`
+	// BlueskyOAuthClientID is the URL of the OAuth client metadata document.
+	// Defaults to a loopback client for BlueskyOAuthRedirectURI, which needs
+	// no hosted metadata.
+	BlueskyOAuthClientID string `env:"BLUESKY_OAUTH_CLIENT_ID"`
+	// BlueskyOAuthRedirectURI is where the authorization server sends the
+	// browser back to after login; "bluesky login" listens on its address.
+	BlueskyOAuthRedirectURI string `env:"BLUESKY_OAUTH_REDIRECT_URI" envDefault:"http://127.0.0.1:8765/callback"`
+	// BlueskyOAuthSessionFile stores the OAuth tokens and DPoP key. It is
+	// rewritten whenever the tokens are refreshed.
+	BlueskyOAuthSessionFile string `env:"BLUESKY_OAUTH_SESSION_FILE" envDefault:"./bluesky-oauth.json"`
+	// BlueskyImages attaches up to this many images of the feed item's
+	// content (at most 4) to Bluesky posts. Zero (default) posts text only.
+	BlueskyImages int `env:"BLUESKY_IMAGES" envDefault:"0"`
 
 	// Threads configuration
 	ThreadsUserID       string `env:"THREADS_USER_ID"`
@@ -97,35 +377,312 @@ type Config struct {
 	ThreadsClientID     string `env:"THREADS_CLIENT_ID"`
 	ThreadsClientSecret string `env:"THREADS_CLIENT_SECRET"`
 	ThreadsRedirectURI  string `env:"THREADS_REDIRECT_URI"`
+	// ThreadsAPIURL overrides the Threads Graph API base URL, for testing or
+	// proxies. Defaults to https://graph.threads.net when empty.
+	ThreadsAPIURL string `env:"THREADS_API_URL"`
+	// ThreadsUpdateMode controls how updated posts are published to Threads:
+	// "post" (default) publishes a standalone post, "reply" replies to the
+	// original post and "quote" quotes it.
+	ThreadsUpdateMode string `env:"THREADS_UPDATE_MODE" envDefault:"post"`
 
 	// SocialSites specifies which social media sites to post to.
 	// If empty, defaults to all sites with their required credentials fulfilled.
-	// Valid values: "mastodon", "bluesky", "threads"
+	// Valid values: "mastodon", "bluesky", "threads", "newsletter"
 	SocialSites []string `env:"SOCIAL_SITES" envSeparator:","`
 
+	// SiteOrder is the order sites are published to. Sites that are not
+	// listed follow in the default order: mastodon, bluesky, threads,
+	// newsletter.
+	SiteOrder []string `env:"SITE_ORDER" envSeparator:"," envDefault:""`
+
+	// SiteDependencies maps a site to the site it depends on, e.g.
+	// "bluesky=mastodon" publishes to Bluesky only once the post was
+	// successfully published to Mastodon. Dependencies are published first.
+	// Sites without an entry are independent.
+	SiteDependencies map[string]string `env:"SITE_DEPENDENCIES" envSeparator:"," envKeyValSeparator:"=" envDefault:""`
+
 	// PostNewEntriesOnly prevents posting all existing RSS entries on first startup.
 	// When true (default), only entries that appear after the first successful
 	// feed check are posted. Existing entries are stored in the DB but not posted.
 	PostNewEntriesOnly bool `env:"POST_NEW_ENTRIES_ONLY" envDefault:"true"`
 
+	// ReplayProtection keeps the latest pubDate of the items published from
+	// the feed as its high-water mark, and skips items dated before it that
+	// are not stored, e.g. after their posts were deleted from the database.
+	ReplayProtection bool `env:"REPLAY_PROTECTION" envDefault:"true"`
+
+	// ScheduleFutureItems holds back feed items whose pubDate is in the
+	// future until that time. Mastodon servers that support it schedule the
+	// post themselves; other sites receive it in the first check cycle after
+	// the pubDate. When false, future-dated items are published immediately.
+	ScheduleFutureItems bool `env:"SCHEDULE_FUTURE_ITEMS" envDefault:"true"`
+
+	// CanonicalLinks fetches the page of every feed item and uses the URL of
+	// its <link rel="canonical"> tag instead of the feed link, in posts and
+	// to store the item, so that proxy and tracking links of syndicated
+	// feeds are not posted.
+	CanonicalLinks bool `env:"CANONICAL_LINKS"`
+
+	// LinkCheck fetches the page of a new item before posting it, and holds
+	// the item back while the page does not answer 200 OK or is a soft 404,
+	// e.g. while a CDN does not serve it yet.
+	LinkCheck bool `env:"LINK_CHECK"`
+	// LinkCheckGraceMinutes is how long after an item was first seen its
+	// page is waited for. Once it has passed, the item is published even if
+	// its page is still not live.
+	LinkCheckGraceMinutes int `env:"LINK_CHECK_GRACE_MINUTES" envDefault:"30"`
+	// LinkCheckSoft404 are phrases that mark a page as a soft 404 when its
+	// title contains one of them, ignoring case.
+	LinkCheckSoft404 []string `env:"LINK_CHECK_SOFT_404" envDefault:"page not found,404 not found,error 404,404 error"`
+
+	// EnrichmentCacheHours is how long the results of fetching the page of
+	// a feed item, its canonical URL and the text of the page and article
+	// content sources, are kept in the database, keyed by the item's guid,
+	// so that the page is not fetched every cycle while the item waits to
+	// be published. Zero disables the cache.
+	EnrichmentCacheHours int `env:"ENRICHMENT_CACHE_HOURS" envDefault:"24"`
+
+	// ProfileWebsiteLabel and ProfileLatestLabel name the profile fields
+	// "profile sync" keeps current with the site of the feed's newest item
+	// and its link. Bluesky has no profile fields, so there they are lines
+	// "<label>: <value>" of the bio. An empty label leaves that field alone.
+	ProfileWebsiteLabel string `env:"PROFILE_WEBSITE_LABEL" envDefault:"Website"`
+	ProfileLatestLabel  string `env:"PROFILE_LATEST_LABEL" envDefault:"Latest post"`
+
 	// ShortRun enables a short run mode that only processes the 3 most recent
 	// RSS feed items instead of all items in the feed.
 	ShortRun bool `env:"SHORT_RUN"`
 
+	// MaxPostsPerCycle caps how many feed items are published per check
+	// cycle. Surplus items remain pending and are published in subsequent
+	// cycles. Zero (default) means unlimited.
+	MaxPostsPerCycle int `env:"MAX_POSTS_PER_CYCLE" envDefault:"0"`
+	// ClockJumpMaxPosts caps how many feed items are published in the first
+	// cycle after the wall clock jumped ahead while waiting for it, e.g.
+	// when a laptop resumes from sleep, so that the backlog is not posted
+	// at once. Zero disables the cap.
+	ClockJumpMaxPosts int `env:"CLOCK_JUMP_MAX_POSTS" envDefault:"1"`
+	// PostTimeoutSeconds bounds how long a feed item may take to be
+	// prepared, its page fetched included, and published to every site, so
+	// that a page or API that hangs does not hold up the rest of the cycle.
+	// An item that runs out of time is tried again in the next cycle. Zero
+	// disables the bound.
+	PostTimeoutSeconds int `env:"POST_TIMEOUT_SECONDS" envDefault:"300"`
+
+	// RepromoteAfterDays boosts the Mastodon status and reposts the Bluesky
+	// post of each published item once, this many days after it was
+	// published. Zero (default) disables re-promotion.
+	RepromoteAfterDays int `env:"REPROMOTE_AFTER_DAYS" envDefault:"0"`
+
+	// RepromoteCategories limits re-promotion to posts whose link's last
+	// path segment contains one of these categories. When empty, every
+	// published post is re-promoted.
+	RepromoteCategories []string `env:"REPROMOTE_CATEGORIES" envSeparator:","`
+
+	// CredentialCheckDays is how often, in days, the credentials of the
+	// enabled sites are checked against their APIs, so that a revoked or
+	// expiring token is reported before a post fails. Zero disables the
+	// checks.
+	CredentialCheckDays int `env:"CREDENTIAL_CHECK_DAYS" envDefault:"7"`
+
+	// CredentialExpiryWarningDays is how many days before a credential
+	// expires a check warns about it, for sites whose tokens expire, like
+	// Threads.
+	CredentialExpiryWarningDays int `env:"CREDENTIAL_EXPIRY_WARNING_DAYS" envDefault:"14"`
+
+	// Timezone is the IANA time zone name (e.g. "Europe/Berlin") used for
+	// time-of-day scheduling decisions and for timestamps stored in the
+	// database. Defaults to the process local time zone when empty.
+	Timezone string `env:"TIMEZONE"`
+
+	// RetryMaxAttempts is how many times publishing a post to a site is
+	// attempted before it is given up on and listed by "db list --failed".
+	// Zero retries for as long as the post remains in the feed.
+	RetryMaxAttempts int `env:"RETRY_MAX_ATTEMPTS" envDefault:"5"`
+
+	// RetryBackoffMinutes is the delay before the first retry of a failed
+	// post. Every further retry waits twice as long, up to a day. Zero
+	// retries in every check cycle.
+	RetryBackoffMinutes int `env:"RETRY_BACKOFF_MINUTES" envDefault:"15"`
+
+	// EventsRetentionDays is how long entries in the database events audit
+	// trail are kept. Zero or negative keeps them forever.
+	EventsRetentionDays int `env:"EVENTS_RETENTION_DAYS" envDefault:"30"`
+
+	// ForceIPv4 makes all outbound connections over IPv4, for hosts with
+	// broken IPv6 connectivity.
+	ForceIPv4 bool `env:"FORCE_IPV4"`
+	// DNSResolver is the host[:port] of a DNS server to resolve host names
+	// with instead of the system resolver, e.g. "1.1.1.1".
+	DNSResolver string `env:"DNS_RESOLVER"`
+	// DialTimeoutSeconds bounds establishing an outbound connection.
+	DialTimeoutSeconds int `env:"DIAL_TIMEOUT_SECONDS" envDefault:"30"`
+	// TLSHandshakeTimeoutSeconds bounds the TLS handshake of an outbound
+	// connection.
+	TLSHandshakeTimeoutSeconds int `env:"TLS_HANDSHAKE_TIMEOUT_SECONDS" envDefault:"10"`
+	// UserAgent is the User-Agent outbound requests identify themselves
+	// with. Defaults to "rss2socials/<version> (+<repository URL>)".
+	UserAgent string `env:"USER_AGENT"`
+	// MaxConnections caps the outbound requests in flight at once, across
+	// the feed, pages and every site. 0 sets no cap.
+	MaxConnections int `env:"MAX_CONNECTIONS"`
+	// RequestsPerMinute limits the rate of outbound requests, allowing
+	// bursts of up to RequestBurst of them. 0 sets no limit.
+	RequestsPerMinute int `env:"REQUESTS_PER_MINUTE"`
+	RequestBurst      int `env:"REQUEST_BURST" envDefault:"10"`
+
+	// MediaCacheDir is the directory downloaded and resized images are
+	// cached in. Defaults to a directory below the system temp directory.
+	MediaCacheDir string `env:"MEDIA_CACHE_DIR"`
+
+	// DBDriver selects where posts are stored: "sqlite" (default) in the
+	// database at DBPath, "redis" on the Redis server at RedisURL, which
+	// replicas can share, or "memory" in a database that only lives as long
+	// as the process, for demos and stateless runs. Without a database file,
+	// items are posted again after every restart.
+	DBDriver string `env:"DB_DRIVER" envDefault:"sqlite"`
+
+	// RedisURL is the redis:// (or rediss:// for TLS) URL of the Redis
+	// server used with DBDriver redis, e.g.
+	// "redis://:password@localhost:6379/0".
+	RedisURL string `env:"REDIS_URL"`
+
+	// RedisKeyPrefix is prepended to every Redis key, so that several
+	// feeds can share a Redis database.
+	RedisKeyPrefix string `env:"REDIS_KEY_PREFIX" envDefault:"rss2socials:"`
+
 	// DBPath is the filesystem path for the SQLite database.
 	// Defaults to "./tooted_posts.db" when empty.
 	DBPath string `env:"DB_PATH" envDefault:"./tooted_posts.db"`
+
+	// StoreContent stores the content of posts, compressed, along with its
+	// hash, together with the content an update replaced. Update
+	// announcements describe what changed from it, and `db content` shows it
+	// to tell why an update was detected.
+	StoreContent bool `env:"STORE_CONTENT" envDefault:"true"`
+
+	// HashAlgorithm is the algorithm content is hashed with to detect
+	// updates: "sha256" (default), "sha512" or "fnv64a".
+	HashAlgorithm string `env:"HASH_ALGORITHM" envDefault:"sha256"`
+	// HashNormalize are the normalization steps applied to content before
+	// hashing it, in order: "strip_html" removes HTML tags and their
+	// attributes, "collapse_whitespace" collapses runs of whitespace and
+	// "lowercase" ignores changes of case. "none" hashes the content as is.
+	// Normalizing keeps cosmetic changes of a CMS from being announced as
+	// updates.
+	HashNormalize []string `env:"HASH_NORMALIZE" envDefault:"strip_html,collapse_whitespace" envSeparator:","`
+
+	// DBMemoryFallback keeps rss2socials running with an in-memory database
+	// when the database at DBPath cannot be opened or written to, or the
+	// Redis server cannot be reached, instead of exiting. Nothing is
+	// remembered across restarts in that mode.
+	DBMemoryFallback bool `env:"DB_MEMORY_FALLBACK"`
+
+	// CycleLock makes replicas sharing the database or Redis server take
+	// turns: a cycle only runs while holding a lock on the feed, and is
+	// skipped while another instance holds it.
+	CycleLock bool `env:"CYCLE_LOCK"`
+	// CycleLockTTLSeconds is how long the lock is held without being
+	// renewed, so that another instance takes over once the holder died.
+	// The holder renews it before handling every item.
+	CycleLockTTLSeconds int `env:"CYCLE_LOCK_TTL_SECONDS" envDefault:"300"`
+
+	// parseProblems are the environment variables GetEnvVars could not
+	// parse, reported by Validate.
+	parseProblems []Problem
 }
 
+// BlueskySelfLabels are the self-labels Bluesky applies to posts, the values
+// of Config.SensitiveLabels.
+var BlueskySelfLabels = []string{"sexual", "porn", "nudity", "graphic-media"}
+
+// Values of Config.CategoryFilterMode.
+const (
+	CategoryFilterURLSegment  = "url-segment"
+	CategoryFilterRSSCategory = "rss-category"
+	CategoryFilterBoth        = "both"
+)
+
+// Values of Config.PreviousPost.
+const (
+	PreviousPostLink  = "link"
+	PreviousPostQuote = "quote"
+)
+
+// Values of Config.MastodonFlavor.
+const (
+	MastodonFlavorMastodon   = "mastodon"
+	MastodonFlavorGoToSocial = "gotosocial"
+	MastodonFlavorAkkoma     = "akkoma"
+	MastodonFlavorPixelfed   = "pixelfed"
+)
+
+// Values of Config.BlueskyAuth.
+const (
+	BlueskyAuthAppPassword = "app-password"
+	BlueskyAuthOAuth       = "oauth"
+)
+
+// Values of Config.LogLevel.
+const (
+	LogLevelTrace = "trace"
+	LogLevelDebug = "debug"
+	LogLevelInfo  = "info"
+	LogLevelWarn  = "warn"
+	LogLevelError = "error"
+)
+
+// Values of Config.LogFormat.
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+// Values of Config.TemplateVariantSelection.
+const (
+	VariantSelectionHash   = "hash"
+	VariantSelectionRandom = "random"
+)
+
+// FooterNone disables footers on a network in the footer lines of a site.
+const FooterNone = "none"
+
+// HashNormalizeNone disables normalization in Config.HashNormalize.
+const HashNormalizeNone = "none"
+
+// Values of Config.DBDriver.
+const (
+	DBDriverSQLite = "sqlite"
+	DBDriverRedis  = "redis"
+	DBDriverMemory = "memory"
+)
+
+// Values of Config.ThreadsUpdateMode.
+const (
+	ThreadsUpdatePost  = "post"
+	ThreadsUpdateReply = "reply"
+	ThreadsUpdateQuote = "quote"
+)
+
+// Values of Config.NewsletterProvider.
+const (
+	NewsletterSMTP       = "smtp"
+	NewsletterListmonk   = "listmonk"
+	NewsletterButtondown = "buttondown"
+)
+
 // GetEnvVars loads and returns the application configuration from environment
 // variables and .env files with comprehensive security validation.
 //
 // This function performs the following operations:
 //  1. Securely determines the current working directory
 //  2. Constructs and validates the .env file path to prevent traversal attacks
-//  3. Loads .env file if it exists in the current directory
-//  4. Parses environment variables into the Config struct
-//  5. Validates required fields
+//  3. Loads .env file if it exists in the current directory, or else the
+//     .env.age or .env.gpg file decrypted with ConfigKey
+//  4. Parses environment variables into the Config struct, defaulting
+//     paths to the /data volume and logs to JSON when running in a
+//     container (see InContainer)
+//  5. Validates every setting, collecting all problems
 //  6. Returns the populated configuration
 //
 // Security measures implemented:
@@ -137,7 +694,10 @@ type Config struct {
 // Returns:
 //   - Config: A populated configuration struct with values from environment
 //     variables and/or .env file
-//   - error: Non-nil if any critical error occurs during configuration loading
+//   - error: Non-nil if any critical error occurs during configuration loading.
+//     When any setting is missing or invalid in a way rss2socials cannot run
+//     with, it is a *ValidationError listing every problem found, returned
+//     along with the configuration
 //
 // Example:
 //
@@ -170,44 +730,311 @@ func GetEnvVars() (Config, error) {
 		return Config{}, fmt.Errorf("error: .env file path traversal detected")
 	}
 
-	// Load .env file if it exists
+	// Load .env file if it exists, or else the encrypted one
 	if _, err := os.Stat(envPath); err == nil {
 		if err := godotenv.Load(envPath); err != nil {
 			return Config{}, fmt.Errorf("error loading .env file: %w", err)
 		}
+	} else if encPath := encryptedEnvFile(cleanCwd); encPath != "" {
+		if err := loadEncryptedEnv(encPath); err != nil {
+			return Config{}, fmt.Errorf("error loading %s: %w", filepath.Base(encPath), err)
+		}
 	}
 
-	// Parse environment variables into config struct
+	// Parse environment variables into config struct, collecting the
+	// variables that cannot be parsed
+	// A tenant's process parses the variables of the tenant
+	vars := environment()
+	if err := keyringEnvironment(vars, vars[TenantEnv]); err != nil {
+		return Config{}, err
+	}
+	if tenant := vars[TenantEnv]; tenant != "" {
+		vars = tenantEnvironment(vars, tenant)
+	}
 	var conf Config
-	if err := env.Parse(&conf); err != nil {
-		return Config{}, fmt.Errorf("error parsing environment variables: %w", err)
+	if err := env.ParseWithOptions(&conf, env.Options{Environment: vars}); err != nil {
+		conf.parseProblems = parseProblems(err)
 	}
 
-	// Validate required configuration
-	var missing []string
-	if conf.MastodonURL == "" {
-		missing = append(missing, "MASTODON_URL")
+	// Validate the configuration, reporting every problem at once
+	if err := conf.Validate(); err != nil {
+		var verr *ValidationError
+		if errors.As(err, &verr) && verr.Fatal() {
+			return conf, err
+		}
 	}
-	if conf.MastodonClientKey == "" {
-		missing = append(missing, "MASTODON_CLIENT_KEY")
+
+	return conf, nil
+}
+
+// Secrets returns the configured credential values that must never appear in
+// log output or notifications. Empty values are omitted.
+func (c Config) Secrets() []string {
+	var secrets []string
+	for _, s := range []string{
+		c.MastodonClientSecret,
+		c.MastodonAccessToken,
+		c.GotifyToken,
+		c.NtfyToken,
+		c.SlackWebhookURL,
+		c.MattermostWebhookURL,
+		c.SMTPPassword,
+		c.ListmonkToken,
+		c.ButtondownAPIKey,
+		c.BlueskyAppKey,
+		c.ThreadsToken,
+		c.ThreadsClientSecret,
+		c.redisPassword(),
+		c.sentryKey(),
+	} {
+		if s != "" {
+			secrets = append(secrets, s)
+		}
 	}
-	if conf.MastodonClientSecret == "" {
-		missing = append(missing, "MASTODON_CLIENT_SECRET")
+	for _, key := range slices.Sorted(maps.Keys(c.GotifyTokens)) {
+		if s := c.GotifyTokens[key]; s != "" {
+			secrets = append(secrets, s)
+		}
 	}
-	if conf.MastodonAccessToken == "" {
-		missing = append(missing, "MASTODON_ACCESS_TOKEN")
+	return secrets
+}
+
+// sentryKey returns the project key of SentryDSN, if any.
+func (c Config) sentryKey() string {
+	u, err := url.Parse(c.SentryDSN)
+	if err != nil || u.User == nil {
+		return ""
 	}
-	if conf.GotifyURL == "" {
-		missing = append(missing, "GOTIFY_URL")
+	return u.User.Username()
+}
+
+// redisPassword returns the password of RedisURL, if any.
+func (c Config) redisPassword() string {
+	u, err := url.Parse(c.RedisURL)
+	if err != nil || u.User == nil {
+		return ""
 	}
-	if conf.GotifyToken == "" {
-		missing = append(missing, "GOTIFY_TOKEN")
+	password, _ := u.User.Password()
+	return password
+}
+
+// Location returns the *time.Location named by Timezone, or time.Local when
+// Timezone is empty. An error is returned for unknown time zone names.
+func (c Config) Location() (*time.Location, error) {
+	if c.Timezone == "" {
+		return time.Local, nil
 	}
-	if len(missing) > 0 {
-		return conf, fmt.Errorf("required environment variables not set: %s", strings.Join(missing, ", "))
+	loc, err := time.LoadLocation(c.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid TIMEZONE %q: %w", c.Timezone, err)
 	}
+	return loc, nil
+}
 
-	return conf, nil
+// TemplateVariant is an alternative template for new posts.
+type TemplateVariant struct {
+	// Site is the site the variant is used on, or empty for every site
+	// without variants of its own.
+	Site     string
+	Name     string
+	Weight   int
+	Template string
+}
+
+// Variants parses TemplateVariants. Each is "name=template", where the name
+// may be followed by "*weight" to pick the variant weight times as often as
+// one of weight 1, and preceded by "site/" to only use it on that site, e.g.
+// "bluesky/teaser*2={{.Title}} {{.Link}}".
+func (c Config) Variants() ([]TemplateVariant, error) {
+	var variants []TemplateVariant
+	seen := make(map[string]bool)
+	for _, spec := range c.TemplateVariants {
+		if strings.TrimSpace(spec) == "" {
+			continue
+		}
+		key, text, ok := strings.Cut(spec, "=")
+		key = strings.TrimSpace(key)
+		if !ok || strings.TrimSpace(text) == "" {
+			return nil, fmt.Errorf("template variant %q must be name=template", key)
+		}
+		v := TemplateVariant{Weight: 1, Template: text}
+		if site, name, ok := strings.Cut(key, "/"); ok {
+			if !slices.Contains([]string{"mastodon", "bluesky", "threads"}, site) {
+				return nil, fmt.Errorf("template variant %q is for unknown site %q", key, site)
+			}
+			v.Site, key = site, name
+		}
+		if name, weight, ok := strings.Cut(key, "*"); ok {
+			w, err := strconv.Atoi(weight)
+			if err != nil || w <= 0 {
+				return nil, fmt.Errorf("template variant %q must have a positive weight", key)
+			}
+			v.Weight, key = w, name
+		}
+		if key == "" {
+			return nil, fmt.Errorf("template variant %q has no name", spec)
+		}
+		v.Name = key
+		if seen[v.Site+"/"+v.Name] {
+			return nil, fmt.Errorf("template variant %q is defined twice", v.Name)
+		}
+		seen[v.Site+"/"+v.Name] = true
+		variants = append(variants, v)
+	}
+	return variants, nil
+}
+
+// SiteVariants returns the template variants used on site: its own, or
+// else the ones for every site.
+func (c Config) SiteVariants(site string) []TemplateVariant {
+	variants, err := c.Variants()
+	if err != nil {
+		return nil
+	}
+	var own, shared []TemplateVariant
+	for _, v := range variants {
+		switch v.Site {
+		case site:
+			own = append(own, v)
+		case "":
+			shared = append(shared, v)
+		}
+	}
+	if len(own) > 0 {
+		return own
+	}
+	return shared
+}
+
+// SiteFooterLines returns the footer lines of site: its own, or else
+// FooterLines. It returns nil when site appends no footer.
+func (c Config) SiteFooterLines(site string) []string {
+	lines := map[string][]string{
+		"mastodon": c.MastodonFooterLines,
+		"bluesky":  c.BlueskyFooterLines,
+		"threads":  c.ThreadsFooterLines,
+	}[site]
+	if len(lines) == 0 {
+		lines = c.FooterLines
+	}
+	var footers []string
+	for _, line := range lines {
+		if line = strings.TrimSpace(line); line != "" && line != FooterNone {
+			footers = append(footers, line)
+		}
+	}
+	return footers
+}
+
+// BlockRule is a parsed blocklist entry.
+type BlockRule struct {
+	// Entry is the entry as configured.
+	Entry   string
+	Pattern *regexp.Regexp
+}
+
+// SiteBlocklist parses the entries of Blocklist and of the blocklist of
+// site. An entry between slashes is a regular expression, e.g.
+// "/(?i)acme\s+corp/"; any other entry is a word or phrase matched as whole
+// words regardless of case, e.g. "layoffs".
+func (c Config) SiteBlocklist(site string) ([]BlockRule, error) {
+	entries := slices.Concat(c.Blocklist, map[string][]string{
+		"mastodon":   c.MastodonBlocklist,
+		"bluesky":    c.BlueskyBlocklist,
+		"threads":    c.ThreadsBlocklist,
+		"newsletter": c.NewsletterBlocklist,
+	}[site])
+
+	var rules []BlockRule
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		expr := wholeWords(entry)
+		if len(entry) > 2 && strings.HasPrefix(entry, "/") && strings.HasSuffix(entry, "/") {
+			expr = entry[1 : len(entry)-1]
+		}
+		pattern, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid blocklist entry %q: %w", entry, err)
+		}
+		rules = append(rules, BlockRule{Entry: entry, Pattern: pattern})
+	}
+	return rules, nil
+}
+
+// wholeWords returns a case-insensitive regular expression matching phrase
+// where it is not part of a longer word. Word boundaries, which are ASCII
+// only in Go, are only required next to ASCII letters and digits, so that
+// e.g. "C++" matches too.
+func wholeWords(phrase string) string {
+	expr := regexp.QuoteMeta(phrase)
+	isWord := func(r rune) bool {
+		return r == '_' || ('a' <= r && r <= 'z') || ('A' <= r && r <= 'Z') || ('0' <= r && r <= '9')
+	}
+	if r, _ := utf8.DecodeRuneInString(phrase); isWord(r) {
+		expr = `\b` + expr
+	}
+	if r, _ := utf8.DecodeLastRuneInString(phrase); isWord(r) {
+		expr += `\b`
+	}
+	return "(?i)" + expr
+}
+
+// ProfileField is a labelled value of a social profile.
+type ProfileField struct {
+	Name  string
+	Value string
+}
+
+// ProfileFields returns the profile fields "profile sync" sets for item,
+// the newest item of the feed: ProfileWebsiteLabel with the scheme and host
+// of its link, and ProfileLatestLabel with the link itself. Fields with an
+// empty label are left out.
+func (c Config) ProfileFields(item rss.RSSItem) []ProfileField {
+	var fields []ProfileField
+	if label := strings.TrimSpace(c.ProfileWebsiteLabel); label != "" {
+		if u, err := url.Parse(item.Link); err == nil && u.Host != "" {
+			fields = append(fields, ProfileField{Name: label, Value: u.Scheme + "://" + u.Host})
+		}
+	}
+	if label := strings.TrimSpace(c.ProfileLatestLabel); label != "" && item.Link != "" {
+		fields = append(fields, ProfileField{Name: label, Value: item.Link})
+	}
+	return fields
+}
+
+// Hashing returns how content is hashed to detect updates, from
+// HashAlgorithm and HashNormalize.
+func (c Config) Hashing() rss.Hashing {
+	h := rss.Hashing{Algorithm: c.HashAlgorithm}
+	if h.Algorithm == "" {
+		h.Algorithm = rss.HashSHA256
+	}
+	for _, step := range c.HashNormalize {
+		if step = strings.TrimSpace(step); step != "" && step != HashNormalizeNone {
+			h.Normalize = append(h.Normalize, step)
+		}
+	}
+	return h
+}
+
+// Schedule returns the parsed CheckSchedule, or nil when it is empty. An
+// error is returned for invalid cron expressions and for ones that never
+// match.
+func (c Config) Schedule() (*schedule.Schedule, error) {
+	if c.CheckSchedule == "" {
+		return nil, nil
+	}
+	s, err := schedule.Parse(c.CheckSchedule)
+	if err != nil {
+		return nil, err
+	}
+	if s.Next(time.Now()).IsZero() {
+		return nil, fmt.Errorf("cron expression %q never matches", c.CheckSchedule)
+	}
+	return s, nil
 }
 
 // EnabledSites returns the list of social media sites that should be posted to.
@@ -222,11 +1049,28 @@ func (c Config) EnabledSites() []string {
 	if c.MastodonURL != "" && c.MastodonAccessToken != "" {
 		sites = append(sites, "mastodon")
 	}
-	if c.BlueskyHandle != "" && c.BlueskyAppKey != "" {
+	if c.BlueskyHandle != "" && (c.BlueskyAppKey != "" || c.BlueskyAuth == BlueskyAuthOAuth) {
 		sites = append(sites, "bluesky")
 	}
 	if c.ThreadsToken != "" && c.ThreadsClientID != "" && c.ThreadsClientSecret != "" {
 		sites = append(sites, "threads")
 	}
+	if c.NewsletterConfigured() {
+		sites = append(sites, "newsletter")
+	}
 	return sites
 }
+
+// NewsletterConfigured reports whether NewsletterProvider is set along with
+// the settings it needs to send the newsletter.
+func (c Config) NewsletterConfigured() bool {
+	switch c.NewsletterProvider {
+	case NewsletterSMTP:
+		return c.SMTPHost != "" && c.SMTPFrom != "" && len(c.NewsletterEmailTo) > 0
+	case NewsletterListmonk:
+		return c.ListmonkURL != "" && c.ListmonkUsername != "" && c.ListmonkToken != "" && len(c.ListmonkListIDs) > 0
+	case NewsletterButtondown:
+		return c.ButtondownAPIKey != ""
+	}
+	return false
+}
@@ -0,0 +1,57 @@
+package config
+
+import (
+	"os"
+	"strconv"
+	"strings"
+)
+
+// containerMarkers are files container runtimes create in the root of a
+// container: Docker's and Podman's.
+var containerMarkers = []string{"/.dockerenv", "/run/.containerenv"}
+
+// containerDefaults are the settings used in a container unless set
+// otherwise, so that all state lives on a single volume mounted at /data and
+// logs can be collected from standard output.
+var containerDefaults = map[string]string{
+	"DB_PATH":                    "/data/rss2socials.db",
+	"MEDIA_CACHE_DIR":            "/data/media-cache",
+	"BLUESKY_OAUTH_SESSION_FILE": "/data/bluesky-oauth.json",
+	"LOG_FORMAT":                 LogFormatJSON,
+}
+
+// InContainer reports whether rss2socials runs in a container: as
+// RSS2SOCIALS_CONTAINER says when it is set to a boolean, or else whether a
+// file Docker or Podman create in containers exists.
+func InContainer() bool {
+	if v, err := strconv.ParseBool(os.Getenv("RSS2SOCIALS_CONTAINER")); err == nil {
+		return v
+	}
+	for _, marker := range containerMarkers {
+		if _, err := os.Stat(marker); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// environment returns the environment to parse the configuration from: the
+// process environment, plus the container defaults of the variables it does
+// not set when running in a container.
+func environment() map[string]string {
+	vars := make(map[string]string)
+	for _, kv := range os.Environ() {
+		if key, value, ok := strings.Cut(kv, "="); ok {
+			vars[key] = value
+		}
+	}
+	if !InContainer() {
+		return vars
+	}
+	for key, value := range containerDefaults {
+		if _, ok := vars[key]; !ok {
+			vars[key] = value
+		}
+	}
+	return vars
+}
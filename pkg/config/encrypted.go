@@ -0,0 +1,80 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/joho/godotenv"
+
+	"github.com/toozej/rss2socials/internal/configcrypt"
+	"github.com/toozej/rss2socials/internal/keyring"
+)
+
+// ConfigKeyEnv is the environment variable holding the key the encrypted
+// .env file is decrypted with: an age identity for .env.age, or the
+// passphrase of .env.gpg.
+const ConfigKeyEnv = "RSS2SOCIALS_CONFIG_KEY"
+
+// EncryptedEnvFiles are the encrypted .env files, in the order they are
+// looked for when there is no .env file.
+var EncryptedEnvFiles = []string{".env.age", ".env.gpg"}
+
+// decryptFile decrypts an encrypted .env file, replaceable in tests.
+var decryptFile = configcrypt.Decrypt
+
+// ConfigKey returns the key of the encrypted .env file: ConfigKeyEnv, or
+// else the key stored in the OS keyring with "rss2socials auth store
+// RSS2SOCIALS_CONFIG_KEY".
+func ConfigKey() (string, error) {
+	if key := os.Getenv(ConfigKeyEnv); key != "" {
+		return key, nil
+	}
+	key, err := keyringGet(KeyringService, ConfigKeyEnv)
+	if err != nil {
+		if !errors.Is(err, keyring.ErrNotFound) && !errors.Is(err, keyring.ErrUnsupported) {
+			return "", fmt.Errorf("error reading %s from the keyring: %w", ConfigKeyEnv, err)
+		}
+		return "", fmt.Errorf("no key to decrypt the configuration: set %s or store it with \"rss2socials auth store %s\"", ConfigKeyEnv, ConfigKeyEnv)
+	}
+	return key, nil
+}
+
+// encryptedEnvFile returns the path of the first of EncryptedEnvFiles in
+// dir, or an empty string when there is none.
+func encryptedEnvFile(dir string) string {
+	for _, name := range EncryptedEnvFiles {
+		path := filepath.Join(dir, name)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+// loadEncryptedEnv decrypts the .env file path and sets the variables it
+// defines that are not set yet, like godotenv.Load. The plaintext is never
+// written to disk.
+func loadEncryptedEnv(path string) error {
+	key, err := ConfigKey()
+	if err != nil {
+		return err
+	}
+	plaintext, err := decryptFile(key, path)
+	if err != nil {
+		return err
+	}
+	vars, err := godotenv.UnmarshalBytes(plaintext)
+	if err != nil {
+		return fmt.Errorf("error parsing the decrypted file: %w", err)
+	}
+	for name, value := range vars {
+		if _, ok := os.LookupEnv(name); !ok {
+			if err := os.Setenv(name, value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
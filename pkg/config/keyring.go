@@ -0,0 +1,72 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/toozej/rss2socials/internal/keyring"
+)
+
+// Values of Config.SecretStore.
+const (
+	SecretStoreEnv     = "env"
+	SecretStoreKeyring = "keyring"
+)
+
+// KeyringService is the service the secrets of rss2socials are stored under
+// in the OS keyring.
+const KeyringService = "rss2socials"
+
+// SecretVars are the environment variables holding credentials. With
+// SECRET_STORE=keyring, those that are not set are read from the OS
+// keyring, where "rss2socials auth store" puts them.
+var SecretVars = []string{
+	"MASTODON_CLIENT_SECRET",
+	"MASTODON_ACCESS_TOKEN",
+	"BLUESKY_APPKEY",
+	"THREADS_ACCESS_TOKEN",
+	"THREADS_CLIENT_SECRET",
+	"GOTIFY_TOKEN",
+	"GOTIFY_TOKENS",
+	"NTFY_TOKEN",
+	"SLACK_WEBHOOK_URL",
+	"MATTERMOST_WEBHOOK_URL",
+	"SMTP_PASSWORD",
+	"LISTMONK_TOKEN",
+	"BUTTONDOWN_API_KEY",
+	"REDIS_URL",
+	"SENTRY_DSN",
+}
+
+// keyringGet reads a secret from the OS keyring, replaceable in tests.
+var keyringGet = keyring.Get
+
+// keyringEnvironment adds the secrets stored in the OS keyring to vars for
+// the SecretVars that are not set, when vars selects the keyring with
+// SECRET_STORE. For tenant, its prefixed variables are looked up as well.
+func keyringEnvironment(vars map[string]string, tenant string) error {
+	if vars["SECRET_STORE"] != SecretStoreKeyring {
+		return nil
+	}
+	prefixes := []string{""}
+	if tenant != "" {
+		prefixes = append(prefixes, TenantPrefix(tenant))
+	}
+	for _, prefix := range prefixes {
+		for _, name := range SecretVars {
+			key := prefix + name
+			if vars[key] != "" {
+				continue
+			}
+			secret, err := keyringGet(KeyringService, key)
+			switch {
+			case errors.Is(err, keyring.ErrNotFound):
+				continue
+			case err != nil:
+				return fmt.Errorf("error reading %s from the keyring: %w", key, err)
+			}
+			vars[key] = secret
+		}
+	}
+	return nil
+}
@@ -0,0 +1,178 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/caarlos0/env/v11"
+)
+
+// TenantEnv names the tenant a process runs for. The tenant supervisor sets
+// it for every tenant it starts; set it yourself to run a command, e.g.
+// `db list`, on the database of a tenant.
+const TenantEnv = "RSS2SOCIALS_TENANT"
+
+// tenantNamePattern matches valid tenant names.
+var tenantNamePattern = regexp.MustCompile(`^[A-Za-z0-9]+$`)
+
+// TenantPrefix returns the prefix of the variables of tenant name, e.g.
+// "ALICE_" for alice.
+func TenantPrefix(name string) string {
+	return strings.ToUpper(name) + "_"
+}
+
+// TenantNames returns the names of the configured tenants, or nil when
+// rss2socials runs for a single feed or for a single tenant.
+func (c Config) TenantNames() []string {
+	if c.Tenant != "" {
+		return nil
+	}
+	var names []string
+	for _, name := range c.Tenants {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// TenantConfig returns the configuration of tenant name, as the process
+// started for it parses it.
+func (c Config) TenantConfig(name string) Config {
+	var conf Config
+	vars := environment()
+	if err := keyringEnvironment(vars, name); err != nil {
+		conf.parseProblems = append(conf.parseProblems, Problem{Var: "SECRET_STORE", Message: err.Error(), Fatal: true})
+	}
+	if err := env.ParseWithOptions(&conf, env.Options{Environment: tenantEnvironment(vars, name)}); err != nil {
+		conf.parseProblems = append(conf.parseProblems, parseProblems(err)...)
+	}
+	return conf
+}
+
+// tenantEnvironment returns the environment tenant name runs with: the
+// shared variables of vars, overridden by the ones prefixed with
+// TenantPrefix, without the variables of other tenants. Unless the tenant
+// sets them, the database, Redis keys, Bluesky OAuth session, log file and
+// recorded feeds are namespaced by the tenant name, and METRICS_ADDR is
+// dropped, as tenants cannot share a listen address.
+func tenantEnvironment(vars map[string]string, name string) map[string]string {
+	prefix := TenantPrefix(name)
+	var others []string
+	for _, other := range strings.Split(vars["TENANTS"], ",") {
+		if other = strings.TrimSpace(other); other != "" && !strings.EqualFold(other, name) {
+			others = append(others, TenantPrefix(other))
+		}
+	}
+
+	out := make(map[string]string, len(vars))
+	own := make(map[string]string)
+	for key, value := range vars {
+		if k, ok := strings.CutPrefix(key, prefix); ok && k != "" {
+			own[k] = value
+			continue
+		}
+		if key == "TENANTS" || hasAnyPrefix(key, others) {
+			continue
+		}
+		out[key] = value
+	}
+
+	namespaced := map[string]func(string) string{
+		"DB_PATH":                    func(v string) string { return tenantPath(v, name) },
+		"BLUESKY_OAUTH_SESSION_FILE": func(v string) string { return tenantPath(v, name) },
+		"LOG_FILE":                   func(v string) string { return tenantPath(v, name) },
+		"RECORD_FEED_DIR":            func(v string) string { return filepath.Join(v, name) },
+		"REDIS_KEY_PREFIX":           func(v string) string { return v + name + ":" },
+	}
+	for key, namespace := range namespaced {
+		value, ok := out[key]
+		if !ok {
+			value = envDefault(key)
+		}
+		if value != "" {
+			out[key] = namespace(value)
+		}
+	}
+	delete(out, "METRICS_ADDR")
+
+	for key, value := range own {
+		out[key] = value
+	}
+	out[TenantEnv] = name
+	return out
+}
+
+// tenantPath returns path with "-<name>" inserted before its extension.
+func tenantPath(path, name string) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "-" + name + ext
+}
+
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// envDefault returns the default of the variable name.
+func envDefault(name string) string {
+	t := reflect.TypeOf(Config{})
+	for i := range t.NumField() {
+		if key, _, _ := strings.Cut(t.Field(i).Tag.Get("env"), ","); key == name {
+			return t.Field(i).Tag.Get("envDefault")
+		}
+	}
+	return ""
+}
+
+// validateTenants returns the problems of the tenants: invalid names, and
+// the problems of each tenant's configuration, named by the variables of
+// the tenant.
+func (c Config) validateTenants() []Problem {
+	var problems []Problem
+	seen := make(map[string]bool)
+	for _, name := range c.TenantNames() {
+		if !tenantNamePattern.MatchString(name) {
+			problems = append(problems, Problem{Var: "TENANTS", Message: fmt.Sprintf("tenant name %q must only contain letters and digits", name), Example: "alice,bob", Fatal: true})
+			continue
+		}
+		if seen[strings.ToUpper(name)] {
+			problems = append(problems, Problem{Var: "TENANTS", Message: fmt.Sprintf("tenant %q is listed twice", name), Fatal: true})
+			continue
+		}
+		seen[strings.ToUpper(name)] = true
+		if v := shadowedVar(TenantPrefix(name)); v != "" {
+			problems = append(problems, Problem{Var: "TENANTS", Message: fmt.Sprintf("tenant name %q cannot be told apart from %s", name, v), Fatal: true})
+			continue
+		}
+
+		err := c.TenantConfig(name).Validate()
+		if verr, ok := err.(*ValidationError); ok {
+			for _, p := range verr.Problems {
+				if p.Var != "" {
+					p.Var = TenantPrefix(name) + p.Var
+				}
+				problems = append(problems, p)
+			}
+		}
+	}
+	return problems
+}
+
+// shadowedVar returns a variable of Config starting with prefix, if any.
+func shadowedVar(prefix string) string {
+	t := reflect.TypeOf(Config{})
+	for i := range t.NumField() {
+		if key, _, _ := strings.Cut(t.Field(i).Tag.Get("env"), ","); strings.HasPrefix(key, prefix) {
+			return key
+		}
+	}
+	return ""
+}
@@ -0,0 +1,432 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/caarlos0/env/v11"
+
+	"github.com/toozej/rss2socials/internal/messages"
+	"github.com/toozej/rss2socials/internal/rss"
+)
+
+// sites are the sites rss2socials can publish to, in the default order of
+// SITE_ORDER.
+var sites = []string{"mastodon", "bluesky", "threads", "newsletter"}
+
+// A Check reports problems with settings that are interpreted by other
+// packages, such as the post templates, which this package cannot import.
+type Check func(c Config) []Problem
+
+var checks []Check
+
+// RegisterCheck adds check to those Validate runs. It is meant to be called
+// from the init functions of the packages interpreting the settings.
+func RegisterCheck(check Check) {
+	checks = append(checks, check)
+}
+
+// Problem is a missing or invalid configuration value.
+type Problem struct {
+	// Var is the environment variable holding the value.
+	Var string
+	// Message describes what is wrong with the value.
+	Message string
+	// Example is a valid value for Var.
+	Example string
+	// Fatal is set for problems rss2socials cannot run with. Invalid
+	// values of other settings are replaced with their defaults at startup;
+	// see Config.WithDefaults.
+	Fatal bool
+}
+
+// String returns the problem with its example, e.g.
+// "INTERVAL: must be a positive number of minutes, got 0 (e.g. INTERVAL=60)".
+func (p Problem) String() string {
+	s := p.Message
+	if p.Var != "" {
+		s = p.Var + ": " + s
+	}
+	if p.Example != "" {
+		s += fmt.Sprintf(" (e.g. %s=%s)", p.Var, p.Example)
+	}
+	return s
+}
+
+// ValidationError lists every problem found in a configuration, so that they
+// can be fixed at once.
+type ValidationError struct {
+	Problems []Problem
+}
+
+func (e *ValidationError) Error() string {
+	var b strings.Builder
+	if len(e.Problems) == 1 {
+		b.WriteString("invalid configuration:")
+	} else {
+		fmt.Fprintf(&b, "invalid configuration (%d problems):", len(e.Problems))
+	}
+	for _, p := range e.Problems {
+		b.WriteString("\n  - " + p.String())
+	}
+	return b.String()
+}
+
+// Fatal reports whether any of the problems is fatal.
+func (e *ValidationError) Fatal() bool {
+	return slices.ContainsFunc(e.Problems, func(p Problem) bool { return p.Fatal })
+}
+
+// parseProblems converts the errors of env.Parse to problems, naming the
+// environment variable of each field that could not be parsed.
+func parseProblems(err error) []Problem {
+	var errs []error
+	var agg env.AggregateError
+	if errors.As(err, &agg) {
+		errs = agg.Errors
+	} else {
+		errs = []error{err}
+	}
+
+	var problems []Problem
+	for _, err := range errs {
+		var parseErr env.ParseError
+		if !errors.As(err, &parseErr) {
+			problems = append(problems, Problem{Message: err.Error(), Fatal: true})
+			continue
+		}
+		p := Problem{Var: parseErr.Name, Message: fmt.Sprintf("not a valid %s: %v", parseErr.Type, parseErr.Err), Fatal: true}
+		var numErr *strconv.NumError
+		if errors.As(parseErr.Err, &numErr) {
+			p.Message = fmt.Sprintf("not a valid %s: %q", parseErr.Type, numErr.Num)
+		}
+		if f, ok := reflect.TypeOf(Config{}).FieldByName(parseErr.Name); ok {
+			p.Var, _, _ = strings.Cut(f.Tag.Get("env"), ",")
+			p.Example = f.Tag.Get("envDefault")
+		}
+		problems = append(problems, p)
+	}
+	return problems
+}
+
+// Validate checks every setting and returns a *ValidationError listing all
+// problems found, or nil.
+func (c Config) Validate() error {
+	problems := slices.Clone(c.parseProblems)
+	add := func(fatal bool, name, example, format string, args ...any) {
+		// A variable that could not be parsed is only reported once.
+		if slices.ContainsFunc(c.parseProblems, func(p Problem) bool { return p.Var == name }) {
+			return
+		}
+		problems = append(problems, Problem{Var: name, Message: fmt.Sprintf(format, args...), Example: example, Fatal: fatal})
+	}
+
+	// The supervisor of tenants only needs their settings
+	if len(c.TenantNames()) > 0 {
+		problems = append(problems, c.validateTenants()...)
+		if len(problems) == 0 {
+			return nil
+		}
+		return &ValidationError{Problems: problems}
+	}
+
+	for _, required := range []struct{ name, value, example string }{
+		{"MASTODON_URL", c.MastodonURL, "https://mastodon.social"},
+		{"MASTODON_CLIENT_KEY", c.MastodonClientKey, "your_mastodon_client_key"},
+		{"MASTODON_CLIENT_SECRET", c.MastodonClientSecret, "your_mastodon_client_secret"},
+		{"MASTODON_ACCESS_TOKEN", c.MastodonAccessToken, "your_mastodon_token"},
+		{"GOTIFY_URL", c.GotifyURL, "https://gotify.example.com"},
+		{"GOTIFY_TOKEN", c.GotifyToken, "your_gotify_token"},
+	} {
+		if required.value == "" {
+			add(true, required.name, required.example, "required but not set")
+		}
+	}
+
+	if _, err := c.Location(); err != nil {
+		add(true, "TIMEZONE", "Europe/Berlin", "unknown time zone %q", c.Timezone)
+	}
+
+	if c.DBDriver == DBDriverRedis {
+		if c.RedisURL == "" {
+			add(true, "REDIS_URL", "redis://:password@localhost:6379/0", "required with DB_DRIVER=redis but not set")
+		} else if u, err := url.Parse(c.RedisURL); err != nil || (u.Scheme != "redis" && u.Scheme != "rediss") || u.Hostname() == "" {
+			// The URL is not quoted, as it may contain a password.
+			add(true, "REDIS_URL", "redis://:password@localhost:6379/0", "not a redis:// or rediss:// URL")
+		}
+	}
+
+	var newsletterRequired []struct{ name, value, example string }
+	switch c.NewsletterProvider {
+	case NewsletterSMTP:
+		newsletterRequired = []struct{ name, value, example string }{
+			{"SMTP_HOST", c.SMTPHost, "smtp.example.com"},
+			{"SMTP_FROM", c.SMTPFrom, "rss2socials@example.com"},
+			{"NEWSLETTER_EMAIL_TO", strings.Join(c.NewsletterEmailTo, ","), "readers@lists.example.com"},
+		}
+	case NewsletterListmonk:
+		var ids string
+		if len(c.ListmonkListIDs) > 0 {
+			ids = fmt.Sprint(c.ListmonkListIDs)
+		}
+		newsletterRequired = []struct{ name, value, example string }{
+			{"LISTMONK_URL", c.ListmonkURL, "https://listmonk.example.com"},
+			{"LISTMONK_USERNAME", c.ListmonkUsername, "rss2socials"},
+			{"LISTMONK_TOKEN", c.ListmonkToken, "your_listmonk_token"},
+			{"LISTMONK_LIST_IDS", ids, "1"},
+		}
+	case NewsletterButtondown:
+		newsletterRequired = []struct{ name, value, example string }{
+			{"BUTTONDOWN_API_KEY", c.ButtondownAPIKey, "your_buttondown_api_key"},
+		}
+	}
+	for _, required := range newsletterRequired {
+		if required.value == "" {
+			add(true, required.name, required.example, "required with NEWSLETTER_PROVIDER=%s but not set", c.NewsletterProvider)
+		}
+	}
+
+	if _, err := c.Variants(); err != nil {
+		add(false, "TEMPLATE_VARIANTS", "short=New: {{.Link}};;teaser*2={{.Title}} {{.Link}}", "%v", err)
+	}
+
+	// A broken blocklist is fatal, as posts it should hold back could go out.
+	for _, list := range []struct {
+		name    string
+		entries []string
+	}{
+		{"BLOCKLIST", c.Blocklist},
+		{"MASTODON_BLOCKLIST", c.MastodonBlocklist},
+		{"BLUESKY_BLOCKLIST", c.BlueskyBlocklist},
+		{"THREADS_BLOCKLIST", c.ThreadsBlocklist},
+		{"NEWSLETTER_BLOCKLIST", c.NewsletterBlocklist},
+	} {
+		if _, err := (Config{Blocklist: list.entries}).SiteBlocklist(""); err != nil {
+			add(true, list.name, "layoffs|/(?i)acme\\s+corp/", "%v", err)
+		}
+	}
+
+	if _, err := c.Schedule(); err != nil {
+		add(true, "CHECK_SCHEDULE", "*/15 8-20 * * MON-FRI", "%v", err)
+	}
+
+	if c.Interval <= 0 {
+		add(false, "INTERVAL", "60", "must be a positive number of minutes, got %d", c.Interval)
+	}
+	for _, setting := range []struct {
+		name    string
+		value   int
+		example string
+	}{
+		{"FEED_MIN_INTERVAL_SECONDS", c.FeedMinIntervalSeconds, "60"},
+		{"FEED_MAX_REDIRECTS", c.FeedMaxRedirects, "10"},
+		{"MAX_POSTS_PER_CYCLE", c.MaxPostsPerCycle, "0"},
+		{"CLOCK_JUMP_MAX_POSTS", c.ClockJumpMaxPosts, "1"},
+		{"POST_TIMEOUT_SECONDS", c.PostTimeoutSeconds, "300"},
+		{"FOOTER_EVERY", c.FooterEvery, "5"},
+		{"LINK_CHECK_GRACE_MINUTES", c.LinkCheckGraceMinutes, "30"},
+		{"ENRICHMENT_CACHE_HOURS", c.EnrichmentCacheHours, "24"},
+		{"REPROMOTE_AFTER_DAYS", c.RepromoteAfterDays, "0"},
+		{"CREDENTIAL_CHECK_DAYS", c.CredentialCheckDays, "7"},
+		{"CREDENTIAL_EXPIRY_WARNING_DAYS", c.CredentialExpiryWarningDays, "14"},
+		{"RETRY_MAX_ATTEMPTS", c.RetryMaxAttempts, "5"},
+		{"RETRY_BACKOFF_MINUTES", c.RetryBackoffMinutes, "15"},
+		{"CONTENT_MIN_CHARS", c.ContentMinChars, "0"},
+		{"LOG_FILE_MAX_SIZE_MB", c.LogFileMaxSizeMB, "10"},
+		{"LOG_FILE_MAX_BACKUPS", c.LogFileMaxBackups, "5"},
+		{"SENTRY_FAILURE_THRESHOLD", c.SentryFailureThreshold, "3"},
+		{"MAX_CONNECTIONS", c.MaxConnections, "4"},
+		{"REQUESTS_PER_MINUTE", c.RequestsPerMinute, "60"},
+		{"REQUEST_BURST", c.RequestBurst, "10"},
+	} {
+		if setting.value < 0 {
+			add(false, setting.name, setting.example, "must not be negative, got %d", setting.value)
+		}
+	}
+	// 4 is the number of images a Bluesky post can hold.
+	if c.BlueskyImages < 0 || c.BlueskyImages > 4 {
+		add(false, "BLUESKY_IMAGES", "4", "must be between 0 and 4, got %d", c.BlueskyImages)
+	}
+	if c.CycleLock && c.CycleLockTTLSeconds <= 0 {
+		add(false, "CYCLE_LOCK_TTL_SECONDS", "300", "must be a positive number of seconds, got %d", c.CycleLockTTLSeconds)
+	}
+
+	for _, enum := range []struct {
+		name, value string
+		values      []string
+	}{
+		{"CATEGORY_FILTER_MODE", c.CategoryFilterMode, []string{CategoryFilterURLSegment, CategoryFilterRSSCategory, CategoryFilterBoth}},
+		{"MASTODON_FLAVOR", c.MastodonFlavor, []string{MastodonFlavorMastodon, MastodonFlavorGoToSocial, MastodonFlavorAkkoma, MastodonFlavorPixelfed}},
+		{"BLUESKY_AUTH", c.BlueskyAuth, []string{BlueskyAuthAppPassword, BlueskyAuthOAuth}},
+		{"THREADS_UPDATE_MODE", c.ThreadsUpdateMode, []string{ThreadsUpdatePost, ThreadsUpdateReply, ThreadsUpdateQuote}},
+		{"NEWSLETTER_PROVIDER", c.NewsletterProvider, []string{NewsletterSMTP, NewsletterListmonk, NewsletterButtondown}},
+		{"SECRET_STORE", c.SecretStore, []string{SecretStoreEnv, SecretStoreKeyring}},
+		{"DB_DRIVER", c.DBDriver, []string{DBDriverSQLite, DBDriverRedis, DBDriverMemory}},
+		{"PREVIOUS_POST", c.PreviousPost, []string{PreviousPostLink, PreviousPostQuote}},
+		{"TEMPLATE_VARIANT_SELECTION", c.TemplateVariantSelection, []string{VariantSelectionHash, VariantSelectionRandom}},
+		{"HASH_ALGORITHM", c.HashAlgorithm, []string{rss.HashSHA256, rss.HashSHA512, rss.HashFNV}},
+		{"LOG_LEVEL", c.LogLevel, []string{LogLevelInfo, LogLevelTrace, LogLevelDebug, LogLevelWarn, LogLevelError}},
+		{"LOG_FORMAT", c.LogFormat, []string{LogFormatText, LogFormatJSON}},
+	} {
+		if enum.value != "" && !slices.Contains(enum.values, enum.value) {
+			add(false, enum.name, enum.values[0], "must be one of %s, got %q", strings.Join(enum.values, ", "), enum.value)
+		}
+	}
+
+	for _, step := range c.HashNormalize {
+		if step = strings.TrimSpace(step); step != "" && !slices.Contains([]string{rss.NormalizeStripHTML, rss.NormalizeWhitespace, rss.NormalizeLowercase, HashNormalizeNone}, step) {
+			add(false, "HASH_NORMALIZE", "strip_html,collapse_whitespace", "unknown normalization %q", step)
+		}
+	}
+
+	// A filter that can never match would hold back every item, and one
+	// dropped at startup would publish items meant to be held back.
+	for name := range c.ExtensionFilters {
+		if prefix, local, ok := strings.Cut(name, ":"); !ok || prefix == "" || local == "" {
+			add(true, "EXTENSION_FILTERS", "itunes:episodeType=full", "element %q must be named prefix:name", name)
+		}
+	}
+
+	for marker, label := range c.SensitiveLabels {
+		if label != "" && !slices.Contains(BlueskySelfLabels, label) {
+			add(true, "SENSITIVE_LABELS", "nsfw=sexual,gore=graphic-media", "label %q of %q must be one of %s, or empty", label, marker, strings.Join(BlueskySelfLabels, ", "))
+		}
+	}
+
+	if c.SeriesThreading {
+		if re, err := regexp.Compile(c.SeriesPattern); err != nil {
+			add(false, "SERIES_PATTERN", `(?i)\bpart (?P<part>\d+)`, "invalid regular expression: %v", err)
+		} else if re.SubexpIndex("part") < 0 {
+			add(false, "SERIES_PATTERN", `(?i)\bpart (?P<part>\d+)`, "must have a (?P<part>...) group")
+		}
+	}
+
+	for _, list := range []struct {
+		name    string
+		domains []string
+	}{
+		{"LINK_DOMAIN_ALLOWLIST", c.LinkDomainAllowlist},
+		{"LINK_DOMAIN_DENYLIST", c.LinkDomainDenylist},
+	} {
+		for _, domain := range list.domains {
+			if domain = strings.TrimSpace(domain); domain == "" || strings.ContainsAny(domain, "/:@ ") {
+				add(true, list.name, "example.com,blog.example.org", "%q is not a domain", domain)
+			}
+		}
+	}
+
+	for _, site := range c.SocialSites {
+		if !slices.Contains(sites, site) {
+			add(false, "SOCIAL_SITES", "mastodon,bluesky", "unknown site %q", site)
+		}
+	}
+	for _, site := range c.SiteOrder {
+		if !slices.Contains(sites, site) {
+			add(false, "SITE_ORDER", "bluesky,mastodon", "unknown site %q", site)
+		}
+	}
+	if err := c.checkSiteDependencies(); err != nil {
+		add(false, "SITE_DEPENDENCIES", "bluesky=mastodon", "%v", err)
+	}
+
+	if _, err := messages.New(c.Locale, nil); err != nil {
+		add(false, "LOCALE", "de", "%v", err)
+	}
+	if _, err := messages.New("", c.Messages); err != nil {
+		add(false, "MESSAGES", "new_post=Fresh from the blog:", "%v", err)
+	}
+
+	for _, check := range checks {
+		for _, p := range check(c) {
+			add(p.Fatal, p.Var, p.Example, "%s", p.Message)
+		}
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+	return &ValidationError{Problems: problems}
+}
+
+// checkSiteDependencies reports unknown sites and cycles in
+// SiteDependencies.
+func (c Config) checkSiteDependencies() error {
+	for site, dep := range c.SiteDependencies {
+		for _, s := range []string{site, dep} {
+			if !slices.Contains(sites, s) {
+				return fmt.Errorf("unknown site %q", s)
+			}
+		}
+	}
+	for site := range c.SiteDependencies {
+		// A chain of dependencies longer than the number of sites
+		// visits a site twice.
+		dep := site
+		for range len(sites) + 1 {
+			if dep = c.SiteDependencies[dep]; dep == "" {
+				break
+			}
+			if dep == site {
+				return fmt.Errorf("cycle involving %s", site)
+			}
+		}
+	}
+	return nil
+}
+
+// defaults returns the configuration with every setting at its envDefault.
+// It is parsed anew every time, so that callers can modify it.
+func defaults() Config {
+	var c Config
+	_ = env.ParseWithOptions(&c, env.Options{Environment: map[string]string{}})
+	return c
+}
+
+// WithDefaults returns c with the setting of every problem Validate finds
+// that is not fatal replaced with its default, along with those problems.
+// Settings without a default, e.g. SOCIAL_SITES, are kept as they are and
+// left to be handled where they are used.
+func (c Config) WithDefaults() (Config, []Problem) {
+	var verr *ValidationError
+	if !errors.As(c.Validate(), &verr) {
+		return c, nil
+	}
+	conf := reflect.ValueOf(&c).Elem()
+	def := reflect.ValueOf(defaults())
+	var replaced []Problem
+	for _, p := range verr.Problems {
+		if p.Fatal {
+			continue
+		}
+		i, ok := fieldOf(p.Var)
+		if !ok {
+			continue
+		}
+		conf.Field(i).Set(def.Field(i))
+		replaced = append(replaced, p)
+	}
+	return c, replaced
+}
+
+// fieldOf returns the index of the Config field read from the environment
+// variable name, if it has a default. Settings whose default is their zero
+// value, such as an empty POST_TEMPLATE for the built-in template, are
+// tagged with an empty envDefault.
+func fieldOf(name string) (int, bool) {
+	t := reflect.TypeOf(Config{})
+	for i := range t.NumField() {
+		f := t.Field(i)
+		if tag, _, _ := strings.Cut(f.Tag.Get("env"), ","); tag != name {
+			continue
+		}
+		_, ok := f.Tag.Lookup("envDefault")
+		return i, ok
+	}
+	return 0, false
+}
@@ -0,0 +1,196 @@
+// Package pipeline exposes the rss2socials feed-to-socials pipeline as a
+// library so that other Go programs can embed it.
+//
+// A Pipeline watches an RSS feed and publishes new and updated items to the
+// social sites enabled in its configuration. Every external dependency (the
+// feed fetcher, the per-site publishers, the post store, the notifier and the
+// clock) can be replaced through Options; anything left unset uses the same
+// implementation as the rss2socials command.
+//
+// Like the command, a Pipeline redacts the secrets of its configuration from
+// the log output, and its requests, made through http.DefaultTransport,
+// identify themselves with Config.UserAgent, have their response bodies
+// capped and keep within Config.MaxConnections and Config.RequestsPerMinute.
+// The transport is shared by the whole process, so it is set up once, by the
+// first Pipeline that runs.
+//
+// Example usage:
+//
+//	import (
+//		"github.com/toozej/rss2socials/pkg/config"
+//		"github.com/toozej/rss2socials/pkg/pipeline"
+//	)
+//
+//	func main() {
+//		conf, err := config.GetEnvVars()
+//		if err != nil {
+//			log.Fatal(err)
+//		}
+//		p, err := pipeline.New(conf)
+//		if err != nil {
+//			log.Fatal(err)
+//		}
+//		if err := p.Start(ctx); err != nil {
+//			log.Fatal(err)
+//		}
+//	}
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"github.com/toozej/rss2socials/internal/db"
+	"github.com/toozej/rss2socials/internal/rss"
+	"github.com/toozej/rss2socials/internal/rss2socials"
+	"github.com/toozej/rss2socials/pkg/config"
+)
+
+// Item is a single RSS feed item.
+type Item = rss.RSSItem
+
+// Image is an image of a feed item, with its alt text.
+type Image = rss.Image
+
+// Post is a feed item as it is published to a site: the text rendered for
+// the site, and the title, link, summary, tags, images and language of the
+// item for publishers that render it themselves.
+type Post = rss2socials.Post
+
+// FeedFetcher fetches and parses the items of an RSS feed.
+type FeedFetcher = rss2socials.FeedFetcher
+
+// FeedFetcherFunc adapts a function to the FeedFetcher interface.
+type FeedFetcherFunc = rss2socials.FeedFetcherFunc
+
+// Publisher publishes posts to a single social site.
+type Publisher = rss2socials.Publisher
+
+// PublisherFunc adapts a function to the Publisher interface.
+type PublisherFunc = rss2socials.PublisherFunc
+
+// Updater is implemented by publishers that can revise a post they published
+// earlier instead of publishing a new one.
+type Updater = rss2socials.Updater
+
+// Reposter is implemented by publishers that can boost or repost a post they
+// published earlier.
+type Reposter = rss2socials.Reposter
+
+// Store persists which posts have been seen and published.
+type Store = rss2socials.Store
+
+// RetryStore is implemented by Stores that keep the retry state of failed
+// publishes, so that retries back off and are given up on after
+// Config.RetryMaxAttempts. With other Stores, a failed publish is retried in
+// every cycle.
+type RetryStore = rss2socials.RetryStore
+
+// PostIDStore is implemented by Stores that keep the identifiers of the posts
+// created on each site. With other Stores, updates are published as new posts
+// instead of editing or replying to the original.
+type PostIDStore = rss2socials.PostIDStore
+
+// RepromoteStore is implemented by Stores that know which published posts
+// were re-promoted. With other Stores, Config.RepromoteAfterDays is ignored.
+type RepromoteStore = rss2socials.RepromoteStore
+
+// PublishedAtStore is implemented by Stores that record the pubDate of
+// stored posts.
+type PublishedAtStore = rss2socials.PublishedAtStore
+
+// Retry is the retry state of publishing a post to a site.
+type Retry = db.Retry
+
+// Notifier reports publish outcomes.
+type Notifier = rss2socials.Notifier
+
+// Clock abstracts the passage of time.
+type Clock = rss2socials.Clock
+
+// Outcome counts the publishes of a check cycle, per site and post, and the
+// items it suppressed as published already.
+type Outcome = rss2socials.Outcome
+
+// FeedError is returned when the feed could not be fetched.
+type FeedError = rss2socials.FeedError
+
+// Option customizes a Pipeline.
+type Option func(*rss2socials.Deps)
+
+// WithFeedFetcher replaces the HTTP feed fetcher.
+func WithFeedFetcher(f FeedFetcher) Option {
+	return func(d *rss2socials.Deps) { d.FeedFetcher = f }
+}
+
+// WithPublisher replaces the publisher for site ("mastodon", "bluesky" or
+// "threads"). The site must still be enabled in the configuration.
+func WithPublisher(site string, p Publisher) Option {
+	return func(d *rss2socials.Deps) {
+		if d.Publishers == nil {
+			d.Publishers = make(map[string]Publisher)
+		}
+		d.Publishers[site] = p
+	}
+}
+
+// WithStore replaces the SQLite database. When set, Config.DBPath is ignored.
+// s must be safe for concurrent use.
+func WithStore(s Store) Option {
+	return func(d *rss2socials.Deps) { d.Store = s }
+}
+
+// WithNotifier replaces the Gotify/ntfy/email notifier. n must be safe for
+// concurrent use.
+func WithNotifier(n Notifier) Option {
+	return func(d *rss2socials.Deps) { d.Notifier = n }
+}
+
+// WithEvents writes the events of the pipeline as newline-delimited JSON to
+// w. Writes are serialized.
+func WithEvents(w io.Writer) Option {
+	return func(d *rss2socials.Deps) { d.Events = w }
+}
+
+// WithClock replaces the system clock.
+func WithClock(c Clock) Option {
+	return func(d *rss2socials.Deps) { d.Clock = c }
+}
+
+// Pipeline watches a feed and publishes its items.
+type Pipeline struct {
+	conf config.Config
+	deps rss2socials.Deps
+}
+
+// New returns a Pipeline for conf. It returns an error when conf has no feed URL.
+func New(conf config.Config, opts ...Option) (*Pipeline, error) {
+	if conf.FeedURL == "" {
+		return nil, errors.New("RSS feed URL is required")
+	}
+	p := &Pipeline{conf: conf}
+	for _, opt := range opts {
+		opt(&p.deps)
+	}
+	return p, nil
+}
+
+// Start checks the feed every Config.Interval minutes until ctx is cancelled,
+// or once when Config.ShortRun is set.
+func (p *Pipeline) Start(ctx context.Context) error {
+	return rss2socials.Start(ctx, p.conf, p.deps)
+}
+
+// RunOnce checks the feed a single time and publishes any new or updated items.
+// It returns an error when the feed cannot be fetched.
+func (p *Pipeline) RunOnce(ctx context.Context) error {
+	return rss2socials.RunOnce(ctx, p.conf, p.deps)
+}
+
+// Check checks the feed a single time like RunOnce, and also returns how
+// many publishes succeeded and failed. It returns a *FeedError when the feed
+// cannot be fetched.
+func (p *Pipeline) Check(ctx context.Context) (Outcome, error) {
+	return rss2socials.Check(ctx, p.conf, p.deps)
+}
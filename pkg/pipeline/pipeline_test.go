@@ -0,0 +1,220 @@
+package pipeline_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/toozej/rss2socials/pkg/config"
+	"github.com/toozej/rss2socials/pkg/pipeline"
+)
+
+type recordingPublisher struct {
+	mu       sync.Mutex
+	contents []string
+}
+
+func (p *recordingPublisher) Publish(_ context.Context, _ config.Config, post pipeline.Post) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.contents = append(p.contents, post.Text)
+	return "", nil
+}
+
+func (p *recordingPublisher) count() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.contents)
+}
+
+func feed(items ...pipeline.Item) pipeline.FeedFetcher {
+	return pipeline.FeedFetcherFunc(func(context.Context, string) ([]pipeline.Item, error) {
+		return items, nil
+	})
+}
+
+func testConfig(t *testing.T) config.Config {
+	t.Helper()
+	return config.Config{
+		FeedURL:     "memory://feed",
+		Interval:    1,
+		DBPath:      filepath.Join(t.TempDir(), "pipeline.db"),
+		SocialSites: []string{"mastodon"},
+	}
+}
+
+func TestNew_RequiresFeedURL(t *testing.T) {
+	_, err := pipeline.New(config.Config{})
+	assert.EqualError(t, err, "RSS feed URL is required")
+}
+
+func TestRunOnce(t *testing.T) {
+	pub := &recordingPublisher{}
+	p, err := pipeline.New(testConfig(t),
+		pipeline.WithFeedFetcher(feed(pipeline.Item{Title: "Hello", Link: "https://example.com/hello"})),
+		pipeline.WithPublisher("mastodon", pub),
+	)
+	require.NoError(t, err)
+
+	require.NoError(t, p.RunOnce(context.Background()))
+	require.NoError(t, p.RunOnce(context.Background()))
+
+	assert.Equal(t, []string{"New post: https://example.com/hello"}, pub.contents)
+}
+
+func TestRunOnce_FetchError(t *testing.T) {
+	p, err := pipeline.New(testConfig(t),
+		pipeline.WithFeedFetcher(pipeline.FeedFetcherFunc(func(context.Context, string) ([]pipeline.Item, error) {
+			return nil, errors.New("feed unavailable")
+		})),
+	)
+	require.NoError(t, err)
+
+	assert.EqualError(t, p.RunOnce(context.Background()), "feed unavailable")
+}
+
+func TestStart_StopsWhenContextCancelled(t *testing.T) {
+	pub := &recordingPublisher{}
+	p, err := pipeline.New(testConfig(t),
+		pipeline.WithFeedFetcher(feed(pipeline.Item{Title: "Hello", Link: "https://example.com/hello"})),
+		pipeline.WithPublisher("mastodon", pub),
+	)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- p.Start(ctx) }()
+
+	require.Eventually(t, func() bool { return pub.count() == 1 }, 5*time.Second, 10*time.Millisecond)
+	cancel()
+
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Start did not return after the context was cancelled")
+	}
+}
+
+// mapStore is a Store kept in maps, as an embedding program may implement
+// it. It keeps no retry state.
+type mapStore struct {
+	mu     sync.Mutex
+	posts  map[string]string
+	posted map[string]bool
+}
+
+func newMapStore() *mapStore {
+	return &mapStore{posts: map[string]string{}, posted: map[string]bool{}}
+}
+
+func (s *mapStore) HasPostChanged(link, content string) (bool, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored, ok := s.posts[link]
+	return ok, ok && stored != content, nil
+}
+
+func (s *mapStore) StoreTootedPost(link, content, _ string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.posts[link] = content
+	return nil
+}
+
+func (s *mapStore) IsSitePosted(link, site string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.posted[link+" "+site], nil
+}
+
+func (s *mapStore) MarkSitePosted(link, site string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.posted[link+" "+site] = true
+	return nil
+}
+
+func (s *mapStore) SetPublishedAt(string, time.Time) error           { return nil }
+func (s *mapStore) SetSitePostID(string, string, string) error       { return nil }
+func (s *mapStore) SitePostID(string, string) (string, error)        { return "", nil }
+func (s *mapStore) IsFirstCycle() bool                               { return false }
+func (s *mapStore) UnpublishedPosts() ([]string, error)              { return nil, nil }
+func (s *mapStore) PostsToRepromote(time.Time) ([]string, error)     { return nil, nil }
+func (s *mapStore) MarkRepromoted(string) error                      { return nil }
+func (s *mapStore) RecordEvent(string, string, string, string) error { return nil }
+func (s *mapStore) PruneEvents(time.Time) (int64, error)             { return 0, nil }
+
+func TestWithStore_WithoutRetryState(t *testing.T) {
+	failing := true
+	pub := &recordingPublisher{}
+	p, err := pipeline.New(testConfig(t),
+		pipeline.WithFeedFetcher(feed(pipeline.Item{Title: "Hello", Link: "https://example.com/hello"})),
+		pipeline.WithPublisher("mastodon", pipeline.PublisherFunc(func(ctx context.Context, conf config.Config, post pipeline.Post) (string, error) {
+			if failing {
+				return "", errors.New("mastodon down")
+			}
+			return pub.Publish(ctx, conf, post)
+		})),
+		pipeline.WithStore(newMapStore()),
+	)
+	require.NoError(t, err)
+
+	outcome, err := p.Check(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, outcome.Failed)
+
+	failing = false
+	require.NoError(t, p.RunOnce(context.Background()))
+	require.NoError(t, p.RunOnce(context.Background()))
+	assert.Equal(t, 1, pub.count(), "the failed post is retried in the next cycle and published once")
+}
+
+func TestCheck_ReturnsStoreErrors(t *testing.T) {
+	conf := testConfig(t)
+	conf.DBDriver = config.DBDriverRedis
+	conf.RedisURL = "http://localhost"
+	p, err := pipeline.New(conf, pipeline.WithFeedFetcher(feed()))
+	require.NoError(t, err)
+	_, err = p.Check(context.Background())
+	assert.ErrorContains(t, err, "invalid REDIS_URL")
+
+	notADir := filepath.Join(t.TempDir(), "file")
+	require.NoError(t, os.WriteFile(notADir, nil, 0600))
+	conf = testConfig(t)
+	conf.DBPath = filepath.Join(notADir, "pipeline.db")
+	p, err = pipeline.New(conf, pipeline.WithFeedFetcher(feed()))
+	require.NoError(t, err)
+	_, err = p.Check(context.Background())
+	assert.Error(t, err, "a database that cannot be opened is returned rather than exiting")
+}
+
+func TestCheck_RedactsSecretsFromLogs(t *testing.T) {
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	conf := testConfig(t)
+	conf.MastodonAccessToken = "embedded-secret-token"
+	p, err := pipeline.New(conf,
+		pipeline.WithFeedFetcher(feed(pipeline.Item{Title: "Hello", Link: "https://example.com/hello"})),
+		pipeline.WithPublisher("mastodon", pipeline.PublisherFunc(func(context.Context, config.Config, pipeline.Post) (string, error) {
+			return "", errors.New("rejected embedded-secret-token")
+		})),
+	)
+	require.NoError(t, err)
+	_, err = p.Check(context.Background())
+	require.NoError(t, err)
+
+	assert.Contains(t, logs.String(), "rejected [REDACTED]")
+	assert.NotContains(t, logs.String(), "embedded-secret-token")
+}